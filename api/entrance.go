@@ -42,6 +42,12 @@ type APIGroup struct {
 	WafHttpAuthBaseApi
 	WafTaskApi
 	WafBlockingPageApi
+	WafConfigBundleApi
+	WafDetectExclusionApi
+	WafApiSpecApi
+	WafSpiderBotApi
+	WafYaraApi
+	WafGrpcDescriptorApi
 	WafGPTApi
 	WafOtpApi
 	WafAnalysisApi
@@ -50,6 +56,7 @@ type APIGroup struct {
 	WafCacheRuleApi
 	WafTamperRuleApi
 	WafTunnelApi
+	WafTunnelLoadBalanceApi
 	WafVpConfigApi
 	WafFileApi
 	WafSystemMonitorApi
@@ -146,6 +153,7 @@ var (
 	wafCacheRuleService    = waf_service.WafCacheRuleServiceApp
 	wafTamperRuleService   = waf_service.WafTamperRuleServiceApp
 	wafTunnelService       = waf_service.WafTunnelServiceApp
+	wafTunnelLBService     = waf_service.WafTunnelLoadBalanceServiceApp
 
 	wafMonitorService = waf_service.WafSystemMonitorServiceApp
 
@@ -174,4 +182,16 @@ var (
 	wafUIPreferenceService = waf_service.WafUIPreferenceServiceApp
 
 	wafUpgradeNoticeService = waf_service.WafUpgradeNoticeServiceApp
+
+	wafConfigBundleService = waf_service.WafConfigBundleServiceApp
+
+	wafDetectExclusionService = waf_service.WafDetectExclusionServiceApp
+
+	wafApiSpecService = waf_service.WafApiSpecServiceApp
+
+	wafSpiderBotService = waf_service.WafSpiderBotServiceApp
+
+	wafYaraService = waf_service.WafYaraServiceApp
+
+	wafGrpcDescriptorService = waf_service.WafGrpcDescriptorServiceApp
 )
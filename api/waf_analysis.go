@@ -34,3 +34,16 @@ func (w *WafAnalysisApi) AnalysisSpiderRangeApi(c *gin.Context) {
 		response.FailWithMessage("解析失败", c)
 	}
 }
+
+// AnalysisSpiderReportApi 数据分析界面- 爬虫流量报表
+func (w *WafAnalysisApi) AnalysisSpiderReportApi(c *gin.Context) {
+	var req request.WafAnalysisSpiderReq
+	err := c.ShouldBind(&req)
+	if err == nil {
+		bean := wafAnalysisService.AnalysisSpiderReportApi(req)
+		response.OkWithDetailed(bean, "获取成功", c)
+	} else {
+
+		response.FailWithMessage("解析失败", c)
+	}
+}
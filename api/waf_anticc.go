@@ -9,6 +9,7 @@ import (
 	response2 "SamWaf/model/response"
 	"SamWaf/model/spec"
 	"SamWaf/utils"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -49,12 +50,30 @@ func (w *WafAntiCCApi) AddApi(c *gin.Context) {
 				return
 			}
 		}
+		if !isValidCCAction(req.Action) {
+			response.FailWithMessage("超限动作只能是 block 或 challenge", c)
+			return
+		}
+		if msg := checkCCEscalation(req.Escalation); msg != "" {
+			response.FailWithMessage(msg, c)
+			return
+		}
+		if req.LimitKey != "" {
+			if _, err := model.ParseCCLimitKey(req.LimitKey); err != nil {
+				response.FailWithMessage(err.Error(), c)
+				return
+			}
+		}
 
 		err = wafAntiCCService.CheckIsExistApi(req)
 		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 			err = wafAntiCCService.AddApi(req)
 			if err == nil {
-				w.NotifyWaf(req.HostCode)
+				if req.LimitKey == "" {
+					w.NotifyWaf(req.HostCode)
+				} else {
+					w.NotifyWafKeyed(req.HostCode)
+				}
 				response.OkWithMessage("添加成功", c)
 			} else {
 
@@ -62,7 +81,7 @@ func (w *WafAntiCCApi) AddApi(c *gin.Context) {
 			}
 			return
 		} else {
-			response.FailWithMessage("当前网站的Url已经存在", c)
+			response.FailWithMessage("当前网站已存在相同限流键的CC防护配置", c)
 			return
 		}
 
@@ -189,7 +208,11 @@ func (w *WafAntiCCApi) DelAntiCCApi(c *gin.Context) {
 		} else if err != nil {
 			response.FailWithMessage("发生错误", c)
 		} else {
-			w.NotifyWaf(bean.HostCode)
+			if bean.LimitKey == "" {
+				w.NotifyWaf(bean.HostCode)
+			} else {
+				w.NotifyWafKeyed(bean.HostCode)
+			}
 			response.OkWithMessage("删除成功", c)
 		}
 
@@ -227,6 +250,20 @@ func (w *WafAntiCCApi) ModifyAntiCCApi(c *gin.Context) {
 				return
 			}
 		}
+		if !isValidCCAction(req.Action) {
+			response.FailWithMessage("超限动作只能是 block 或 challenge", c)
+			return
+		}
+		if msg := checkCCEscalation(req.Escalation); msg != "" {
+			response.FailWithMessage(msg, c)
+			return
+		}
+		if req.LimitKey != "" {
+			if _, err := model.ParseCCLimitKey(req.LimitKey); err != nil {
+				response.FailWithMessage(err.Error(), c)
+				return
+			}
+		}
 
 		//编辑前先取旧记录，拿到可能被本次编辑改掉的旧 host_code(issue #898)
 		bean := wafAntiCCService.GetDetailByIdApi(req.Id)
@@ -234,7 +271,13 @@ func (w *WafAntiCCApi) ModifyAntiCCApi(c *gin.Context) {
 		if err != nil {
 			response.FailWithMessage("编辑发生错误", c)
 		} else {
-			notifyWafHostChanged(w.NotifyWaf, bean.HostCode, req.HostCode)
+			//按IP限流和按键限流分开下发，编辑前后涉及哪种就通知哪种
+			if bean.LimitKey == "" || req.LimitKey == "" {
+				notifyWafHostChanged(w.NotifyWaf, bean.HostCode, req.HostCode)
+			}
+			if bean.LimitKey != "" || req.LimitKey != "" {
+				notifyWafHostChanged(w.NotifyWafKeyed, bean.HostCode, req.HostCode)
+			}
 			response.OkWithMessage("编辑成功", c)
 		}
 
@@ -249,7 +292,7 @@ func (w *WafAntiCCApi) ModifyAntiCCApi(c *gin.Context) {
 */
 func (w *WafAntiCCApi) NotifyWaf(host_code string) {
 	var antiCC model.AntiCC
-	global.GWAF_LOCAL_DB.Where("host_code = ? ", host_code).Limit(1).Find(&antiCC)
+	global.GWAF_LOCAL_DB.Where("host_code = ? and (limit_key='' or limit_key is null)", host_code).Limit(1).Find(&antiCC)
 	var chanInfo = spec.ChanCommonHost{
 		HostCode: host_code,
 		Type:     enums.ChanTypeAnticc,
@@ -258,3 +301,47 @@ func (w *WafAntiCCApi) NotifyWaf(host_code string) {
 	global.GWAF_CHAN_MSG <- chanInfo
 
 }
+
+// NotifyWafKeyed 按键限流规则通知到waf引擎实时生效
+func (w *WafAntiCCApi) NotifyWafKeyed(host_code string) {
+	var keyedList []model.AntiCC
+	global.GWAF_LOCAL_DB.Where("host_code = ? and limit_key<>''", host_code).Order("create_time").Find(&keyedList)
+	global.GWAF_CHAN_MSG <- spec.ChanCommonHost{
+		HostCode: host_code,
+		Type:     enums.ChanTypeAnticcKeyed,
+		Content:  keyedList,
+	}
+}
+
+// isValidCCAction 超限动作为空时按封禁处理
+func isValidCCAction(action string) bool {
+	return action == "" || action == model.CCActionBlock || action == model.CCActionChallenge
+}
+
+// checkCCEscalation 校验逐级处置配置，返回空串表示合法
+func checkCCEscalation(escalation string) string {
+	if escalation == "" {
+		return ""
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(escalation), &raw); err != nil {
+		return "逐级处置配置不是合法的JSON"
+	}
+	cfg := model.ParseCCEscalationConfig(escalation)
+	if cfg.IsEnable != 1 {
+		return ""
+	}
+	if cfg.SlowMode != model.CCSlowModeTarpit && cfg.SlowMode != model.CCSlowModeThrottle {
+		return "减速方式只能是 tarpit 或 throttle"
+	}
+	if cfg.ChallengeTimes < 0 || cfg.SlowTimes < 0 || cfg.StrikeSeconds < 0 || cfg.ResetMinutes <= 0 {
+		return "逐级处置的次数和时间不能为负数，重置时间必须大于0"
+	}
+	if cfg.SlowMode == model.CCSlowModeTarpit && (cfg.TarpitMs <= 0 || cfg.TarpitMs > 60000) {
+		return "延迟应答时间必须在 1~60000 毫秒之间"
+	}
+	if cfg.SlowMode == model.CCSlowModeThrottle && cfg.ThrottleKbps <= 0 {
+		return "限速带宽必须大于0"
+	}
+	return ""
+}
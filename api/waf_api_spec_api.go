@@ -0,0 +1,138 @@
+package api
+
+import (
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"SamWaf/model/spec"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WafApiSpecApi struct{}
+
+// AddApi 新增接口规范
+func (w *WafApiSpecApi) AddApi(c *gin.Context) {
+	var req request.WafApiSpecAddReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if err := wafApiSpecService.CheckParam(req.Mode, req.PathPrefix, req.SpecContent); err != nil {
+		response.FailWithMessage("接口规范有误:"+err.Error(), c)
+		return
+	}
+	if wafApiSpecService.CheckIsExistApi(req) > 0 {
+		response.FailWithMessage("当前记录已经存在", c)
+		return
+	}
+	if err := wafApiSpecService.AddApi(req); err != nil {
+		response.FailWithMessage("添加失败", c)
+		return
+	}
+	w.NotifyWaf(req.HostCode)
+	response.OkWithMessage("添加成功", c)
+}
+
+// GetDetailApi 获取接口规范详情
+func (w *WafApiSpecApi) GetDetailApi(c *gin.Context) {
+	var req request.WafApiSpecDetailReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafApiSpecService.GetDetailApi(req)
+	response.OkWithDetailed(bean, "获取成功", c)
+}
+
+// GetListApi 获取接口规范列表
+func (w *WafApiSpecApi) GetListApi(c *gin.Context) {
+	var req request.WafApiSpecSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	list, total, _ := wafApiSpecService.GetListApi(req)
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// DelApi 删除接口规范
+func (w *WafApiSpecApi) DelApi(c *gin.Context) {
+	var req request.WafApiSpecDelReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafApiSpecService.GetDetailByIdApi(req.Id)
+	if bean.Id == "" {
+		response.FailWithMessage("未找到信息", c)
+		return
+	}
+	err := wafApiSpecService.DelApi(req)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.FailWithMessage("请检测参数", c)
+	} else if err != nil {
+		response.FailWithMessage("发生错误", c)
+	} else {
+		w.NotifyWaf(bean.HostCode)
+		response.OkWithMessage("删除成功", c)
+	}
+}
+
+// ModifyApi 编辑接口规范
+func (w *WafApiSpecApi) ModifyApi(c *gin.Context) {
+	var req request.WafApiSpecEditReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if err := wafApiSpecService.CheckParam(req.Mode, req.PathPrefix, req.SpecContent); err != nil {
+		response.FailWithMessage("接口规范有误:"+err.Error(), c)
+		return
+	}
+	bean := wafApiSpecService.GetDetailByIdApi(req.Id)
+	if err := wafApiSpecService.ModifyApi(req); err != nil {
+		response.FailWithMessage("编辑发生错误"+err.Error(), c)
+		return
+	}
+	notifyWafHostChanged(w.NotifyWaf, bean.HostCode, req.HostCode)
+	response.OkWithMessage("编辑成功", c)
+}
+
+// LearnApi 从访问日志学习生成规范草稿（不保存，由用户检查后再新增）
+func (w *WafApiSpecApi) LearnApi(c *gin.Context) {
+	var req request.WafApiSpecLearnReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	content, samples, err := wafApiSpecService.LearnApi(req)
+	if err != nil {
+		response.FailWithMessage("学习失败:"+err.Error(), c)
+		return
+	}
+	response.OkWithDetailed(gin.H{
+		"spec_content": content,
+		"samples":      samples,
+	}, "生成成功", c)
+}
+
+// NotifyWaf 通知 WAF 引擎实时生效
+func (w *WafApiSpecApi) NotifyWaf(hostCode string) {
+	var list []model.ApiSpec
+	global.GWAF_LOCAL_DB.Where("host_code = ?", hostCode).Order("create_time asc").Find(&list)
+	chanInfo := spec.ChanCommonHost{
+		HostCode: hostCode,
+		Type:     enums.ChanTypeApiSpec,
+		Content:  list,
+	}
+	global.GWAF_CHAN_MSG <- chanInfo
+}
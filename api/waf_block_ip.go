@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"time"
 )
 
 type WafBlockIpApi struct {
@@ -41,6 +42,9 @@ func (w *WafBlockIpApi) AddApi(c *gin.Context) {
 		return
 	}
 	req.IpType, req.Ip, req.GroupCode = ipType, ip, groupCode
+	// "封禁 N 小时"在这里统一换算成到期时间，系统层和 WAF 层用同一个到期点
+	req.ExpireTime = model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix())
+	req.ExpireHours = 0
 
 	// 封禁层级：""/waf=WAF应用层(默认) | system=系统防火墙 | both=两者
 	layer := req.TargetLayer
@@ -57,11 +61,12 @@ func (w *WafBlockIpApi) AddApi(c *gin.Context) {
 			return
 		}
 		fwReq := request.WafFirewallIPBlockAddReq{
-			HostCode:  req.HostCode,
-			IP:        req.Ip,
-			Reason:    "手动加入黑名单",
-			BlockType: "manual",
-			Remarks:   req.Remarks,
+			HostCode:   req.HostCode,
+			IP:         req.Ip,
+			Reason:     "手动加入黑名单",
+			BlockType:  "manual",
+			Remarks:    req.Remarks,
+			ExpireTime: req.ExpireTime,
 		}
 		if ferr := wafFirewallIPBlockService.AddApi(fwReq); ferr != nil {
 			response.FailWithMessage("系统防火墙封禁失败: "+ferr.Error(), c)
@@ -29,6 +29,7 @@ func (w *WafBlockingPageApi) AddApi(c *gin.Context) {
 	err := c.ShouldBindJSON(&req)
 	if err == nil {
 		req.ContentPriority = normalizeContentPriority(req.ContentPriority)
+		req.ContentType = model.NormalizeBlockingPageContentType(req.ContentType)
 		cnt := wafBlockingPageService.CheckIsExistApi(req)
 		if cnt == 0 {
 			err = wafBlockingPageService.AddApi(req)
@@ -104,6 +105,7 @@ func (w *WafBlockingPageApi) ModifyApi(c *gin.Context) {
 	err := c.ShouldBindJSON(&req)
 	if err == nil {
 		req.ContentPriority = normalizeContentPriority(req.ContentPriority)
+		req.ContentType = model.NormalizeBlockingPageContentType(req.ContentType)
 		bean := wafBlockingPageService.GetDetailByIdApi(req.Id)
 		err = wafBlockingPageService.ModifyApi(req)
 		if err != nil {
@@ -129,8 +131,9 @@ func (w *WafBlockingPageApi) NotifyWaf(hostCode string) {
 			} else if blockingPageList[i].BlockingType == "other_block" {
 				// other_block 类型根据 response_code 区分不同的错误页面
 				// 例如: 403(WAF拦截), 404, 500, 502 等
+				// 非 html 格式的页面键为 "响应码@格式"，见 model.BlockingPageKey
 				if blockingPageList[i].ResponseCode != "" {
-					blockingPageMap[blockingPageList[i].ResponseCode] = blockingPageList[i]
+					blockingPageMap[model.BlockingPageKey(blockingPageList[i].ResponseCode, blockingPageList[i].ContentType)] = blockingPageList[i]
 				}
 			}
 		}
@@ -158,6 +158,31 @@ func (w *WafCacheRuleApi) ModifyApi(c *gin.Context) {
 	}
 }
 
+// PurgeApi 清理网站缓存
+// @Summary      清理网站缓存
+// @Description  按精确路径、路径前缀、通配符或缓存标签（源站 Cache-Tag/Surrogate-Key）清理网站的内存与文件缓存，返回清理条目数
+// @Tags         网站防护-缓存规则
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafCachePurgeReq  true  "清理条件"
+// @Success      200   {object}  response.Response  "清理成功"
+// @Security     ApiKeyAuth
+// @Router       /wafhost/cache/purge [post]
+func (w *WafCacheRuleApi) PurgeApi(c *gin.Context) {
+	var req request.WafCachePurgeReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		removed, err := wafCacheRuleService.PurgeApi(req)
+		if err != nil {
+			response.FailWithMessage("清理失败:"+err.Error(), c)
+			return
+		}
+		response.OkWithDetailed(gin.H{"removed": removed}, "清理成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
 // NotifyWaf  通知到waf引擎实时生效
 func (w *WafCacheRuleApi) NotifyWaf(host_code string) {
 	var list []model.CacheRule
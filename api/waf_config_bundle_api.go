@@ -0,0 +1,104 @@
+package api
+
+import (
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WafConfigBundleApi struct {
+}
+
+// ExportApi 导出网站配置包
+// @Summary      导出网站配置包
+// @Description  导出单个网站（host_code 非空）或全部网站及其下属配置，敏感字段以 ${private:key} 引用密钥管理
+// @Tags         配置即代码
+// @Accept       json
+// @Produce      json
+// @Param        request  body      request.WafConfigBundleExportReq  true  "导出参数"
+// @Success      200      {object}  response.Response{data=string}  "配置包内容"
+// @Security     ApiKeyAuth
+// @Router       /configbundle/export [post]
+func (w *WafConfigBundleApi) ExportApi(c *gin.Context) {
+	var req request.WafConfigBundleExportReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		bundle, err := wafConfigBundleService.ExportApi(req.HostCode)
+		if err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
+		content, err := wafConfigBundleService.MarshalBundle(bundle, req.Format)
+		if err != nil {
+			response.FailWithMessage("导出失败:"+err.Error(), c)
+			return
+		}
+		response.OkWithDetailed(string(content), "导出成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// PlanApi 预览配置包变更
+// @Summary      预览配置包变更
+// @Description  比对配置包与当前配置，列出将要新增/修改/删除的条目，不做任何修改
+// @Tags         配置即代码
+// @Accept       json
+// @Produce      json
+// @Param        request  body      request.WafConfigBundleApplyReq  true  "配置包"
+// @Success      200      {object}  response.Response{data=model.ConfigBundlePlan}  "变更计划"
+// @Security     ApiKeyAuth
+// @Router       /configbundle/plan [post]
+func (w *WafConfigBundleApi) PlanApi(c *gin.Context) {
+	var req request.WafConfigBundleApplyReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		bundle, err := wafConfigBundleService.ParseBundle([]byte(req.Content))
+		if err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
+		response.OkWithDetailed(wafConfigBundleService.PlanApi(bundle, req.Prune), "获取成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// ApplyApi 应用配置包
+// @Summary      应用配置包
+// @Description  在一个事务中执行变更计划并通知引擎重新加载涉及的网站；计划中有错误项时整体拒绝
+// @Tags         配置即代码
+// @Accept       json
+// @Produce      json
+// @Param        request  body      request.WafConfigBundleApplyReq  true  "配置包"
+// @Success      200      {object}  response.Response{data=model.ConfigBundlePlan}  "已执行的变更"
+// @Security     ApiKeyAuth
+// @Router       /configbundle/apply [post]
+func (w *WafConfigBundleApi) ApplyApi(c *gin.Context) {
+	var req request.WafConfigBundleApplyReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		bundle, err := wafConfigBundleService.ParseBundle([]byte(req.Content))
+		if err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
+		plan, changes, err := wafConfigBundleService.ApplyApi(bundle, req.Prune)
+		if err != nil {
+			response.FailWithDetailed(plan, err.Error(), c)
+			return
+		}
+		hostApi := WafHostAPi{}
+		for _, change := range changes {
+			if change.Created {
+				hostApi.NotifyWaf(change.HostCode, nil)
+			} else {
+				hostApi.NotifyWaf(change.HostCode, change.OldHost)
+			}
+		}
+		response.OkWithDetailed(plan, "应用成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
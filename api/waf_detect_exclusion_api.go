@@ -0,0 +1,151 @@
+package api
+
+import (
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"SamWaf/model/spec"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WafDetectExclusionApi struct{}
+
+// AddApi 新增内置检测误报排除
+func (w *WafDetectExclusionApi) AddApi(c *gin.Context) {
+	var req request.WafDetectExclusionAddReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if err := wafDetectExclusionService.CheckParam(req.Detector, req.CompareType, req.Path); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if wafDetectExclusionService.CheckIsExistApi(req) > 0 {
+		response.FailWithMessage("当前记录已经存在", c)
+		return
+	}
+	if err := wafDetectExclusionService.AddApi(req); err != nil {
+		response.FailWithMessage("添加失败", c)
+		return
+	}
+	w.NotifyWaf(req.HostCode)
+	response.OkWithMessage("添加成功", c)
+}
+
+// AddFromLogApi 从攻击日志一键生成误报排除（只排除命中的那个参数）
+func (w *WafDetectExclusionApi) AddFromLogApi(c *gin.Context) {
+	var req request.WafDetectExclusionFromLogReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	weblog, _ := wafLogService.GetDetailApi(request.WafAttackLogDetailReq{
+		CurrrentDbName: req.CurrrentDbName,
+		REQ_UUID:       req.REQ_UUID,
+	})
+	addReq, err := wafDetectExclusionService.BuildFromWebLog(weblog)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if req.Remarks != "" {
+		addReq.Remarks = req.Remarks
+	}
+	if wafDetectExclusionService.CheckIsExistApi(addReq) > 0 {
+		response.FailWithMessage("当前记录已经存在", c)
+		return
+	}
+	if err := wafDetectExclusionService.AddApi(addReq); err != nil {
+		response.FailWithMessage("添加失败", c)
+		return
+	}
+	w.NotifyWaf(addReq.HostCode)
+	response.OkWithDetailed(addReq, "添加成功", c)
+}
+
+// GetDetailApi 获取误报排除详情
+func (w *WafDetectExclusionApi) GetDetailApi(c *gin.Context) {
+	var req request.WafDetectExclusionDetailReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafDetectExclusionService.GetDetailApi(req)
+	response.OkWithDetailed(bean, "获取成功", c)
+}
+
+// GetListApi 获取误报排除列表
+func (w *WafDetectExclusionApi) GetListApi(c *gin.Context) {
+	var req request.WafDetectExclusionSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	list, total, _ := wafDetectExclusionService.GetListApi(req)
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// DelApi 删除误报排除
+func (w *WafDetectExclusionApi) DelApi(c *gin.Context) {
+	var req request.WafDetectExclusionDelReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafDetectExclusionService.GetDetailByIdApi(req.Id)
+	if bean.Id == "" {
+		response.FailWithMessage("未找到信息", c)
+		return
+	}
+	err := wafDetectExclusionService.DelApi(req)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.FailWithMessage("请检测参数", c)
+	} else if err != nil {
+		response.FailWithMessage("发生错误", c)
+	} else {
+		w.NotifyWaf(bean.HostCode)
+		response.OkWithMessage("删除成功", c)
+	}
+}
+
+// ModifyApi 编辑误报排除
+func (w *WafDetectExclusionApi) ModifyApi(c *gin.Context) {
+	var req request.WafDetectExclusionEditReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if err := wafDetectExclusionService.CheckParam(req.Detector, req.CompareType, req.Path); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	bean := wafDetectExclusionService.GetDetailByIdApi(req.Id)
+	if err := wafDetectExclusionService.ModifyApi(req); err != nil {
+		response.FailWithMessage("编辑发生错误"+err.Error(), c)
+		return
+	}
+	notifyWafHostChanged(w.NotifyWaf, bean.HostCode, req.HostCode)
+	response.OkWithMessage("编辑成功", c)
+}
+
+// NotifyWaf 通知 WAF 引擎实时生效
+func (w *WafDetectExclusionApi) NotifyWaf(hostCode string) {
+	var list []model.DetectExclusion
+	global.GWAF_LOCAL_DB.Where("host_code = ?", hostCode).Order("create_time asc").Find(&list)
+	chanInfo := spec.ChanCommonHost{
+		HostCode: hostCode,
+		Type:     enums.ChanTypeDetectExclusion,
+		Content:  list,
+	}
+	global.GWAF_CHAN_MSG <- chanInfo
+}
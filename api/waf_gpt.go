@@ -49,7 +49,7 @@ rule R<唯一标识> "规则中文描述" salience <优先级数字> {
 - when：条件，为 true 时命中。then：命中后的动作，必须写且只能写一个。
 
 # 可用请求字段（MF 开头，代表当前请求）
-MF.HOST 请求域名 | MF.URL 请求地址 | MF.REFERER 来源页 | MF.USER_AGENT UA | MF.METHOD 请求方法 | MF.COOKIES Cookie | MF.BODY 请求体 | MF.PORT 端口(数值) | MF.SRC_IP 访客IP | MF.COUNTRY 国家(中文如"中国") | MF.PROVINCE 省 | MF.CITY 市
+MF.HOST 请求域名 | MF.URL 请求地址 | MF.REFERER 来源页 | MF.USER_AGENT UA | MF.METHOD 请求方法 | MF.COOKIES Cookie | MF.BODY 请求体 | MF.PORT 端口(数值) | MF.SRC_IP 访客IP | MF.COUNTRY 国家(中文如"中国") | MF.PROVINCE 省 | MF.CITY 市 | MF.GRPC_SERVICE gRPC服务全名(如 pkg.UserService) | MF.GRPC_METHOD gRPC方法名 | MF.GRAPHQL_OPERATION GraphQL操作名(批量时逗号分隔) | MF.GRAPHQL_COST GraphQL查询复杂度(数值)
 字段方法：
 - MF.<字符串字段>.Contains("子串") == true / HasPrefix("前缀") == true / HasSuffix("后缀") == true
 - MF.GetHeaderValue("头名").Contains("值") == true    取任意请求头再判断
@@ -60,9 +60,10 @@ MF.HOST 请求域名 | MF.URL 请求地址 | MF.REFERER 来源页 | MF.USER_AGEN
 RF.IPMatch(MF.SRC_IP,"10.10.*.*")==true（单IP/CIDR/通配符/区间统一匹配，推荐优先用它；IPv4通配按八位组、*可在任意位置，IPv6通配须写满8段且不能用::，区间写"起-止"） | RF.IPInGroup(MF.SRC_IP,"办公室出口")==true（IP组，可跨站点复用的IP集合，在 网站防护-IP组 维护，可传组名或组短码） | RF.IPInRange(MF.SRC_IP,"起","止")==true | RF.IPInRanges(MF.SRC_IP,"起-止","CIDR","10.10.*.*",...)==true | RF.IPInCIDR(MF.SRC_IP,"192.168.1.0/24")==true | RF.IPEquals(MF.SRC_IP,"1.2.3.4")==true | RF.In(MF.METHOD,"GET","POST")==true | RF.InIgnoreCase(值,列表...)==true | RF.ContainsAny(MF.URL,"a","b")==true | RF.ContainsAnyIgnoreCase(MF.USER_AGENT,...)==true | RF.ContainsAll(MF.URL,"a","b")==true | RF.StartsWithAny(MF.URL,"/admin")==true | RF.EndsWithAny(MF.URL,".php")==true | RF.IntInRange(MF.PORT,8000,9000)==true | RF.IntIn(MF.PORT,80,443)==true | RF.Not(表达式)==true | RF.IsEmpty(值)==true | RF.IsNotEmpty(值)==true | RF.LengthBetween(MF.URL,0,512)==true
 条件之间用 &&(且) 或 ||(或) 连接。
 
-# 命中动作（then 里，四选一）
+# 命中动作（then 里，五选一）
 RF.Deny();            拦截（默认）
 RF.Log();             仅记录不拦截（灰度观察）
+RF.Challenge();       浏览器挑战，通过后放行
 RF.Allow();           放行（后续检测照常）
 RF.Allow("CC","AI");  放行并跳过指定检测模块
 RF.AllowAll();        放行并跳过后续所有检测
@@ -108,7 +109,7 @@ Notes:
 - when: condition; matches when true. then: exactly one action.
 
 # Request fields (MF = current request)
-MF.HOST host | MF.URL url | MF.REFERER referer | MF.USER_AGENT UA | MF.METHOD method | MF.COOKIES cookies | MF.BODY body | MF.PORT port(number) | MF.SRC_IP client IP | MF.COUNTRY country(Chinese, e.g. "中国") | MF.PROVINCE | MF.CITY
+MF.HOST host | MF.URL url | MF.REFERER referer | MF.USER_AGENT UA | MF.METHOD method | MF.COOKIES cookies | MF.BODY body | MF.PORT port(number) | MF.SRC_IP client IP | MF.COUNTRY country(Chinese, e.g. "中国") | MF.PROVINCE | MF.CITY | MF.GRPC_SERVICE gRPC full service name (e.g. pkg.UserService) | MF.GRPC_METHOD gRPC method name | MF.GRAPHQL_OPERATION GraphQL operation name(s), comma-separated for batches | MF.GRAPHQL_COST GraphQL query cost(number)
 Field methods:
 - MF.<stringField>.Contains("s") == true / HasPrefix("p") == true / HasSuffix("s") == true
 - MF.GetHeaderValue("Name").Contains("v") == true    read any request header
@@ -122,6 +123,7 @@ Join conditions with && (and) or || (or).
 # Actions (in then, pick one)
 RF.Deny();            block (default)
 RF.Log();             log only, no block (canary observation)
+RF.Challenge();       browser challenge, allowed once passed
 RF.Allow();           allow (later checks still run)
 RF.Allow("CC","AI");  allow and skip given detection modules
 RF.AllowAll();        allow and skip all later checks
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"SamWaf/global"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// maxGrpcDescriptorUpload 单个描述文件上限
+const maxGrpcDescriptorUpload = 8 << 20
+
+type WafGrpcDescriptorApi struct{}
+
+// UploadApi 上传 protoc --descriptor_set_out 生成的描述文件(.pb/.desc/.protoset)：同名存在时替换内容，否则新建并启用
+func (w *WafGrpcDescriptorApi) UploadApi(c *gin.Context) {
+	var req request.WafGrpcDescriptorUploadReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		response.FailWithMessage("文件上传失败: "+err.Error(), c)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".pb" && ext != ".desc" && ext != ".protoset" {
+		response.FailWithMessage("不支持的文件类型，仅支持 .pb/.desc/.protoset 描述文件", c)
+		return
+	}
+	if file.Size > maxGrpcDescriptorUpload {
+		response.FailWithMessage("描述文件过大（上限 8MB）", c)
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.FailWithMessage("打开上传文件失败: "+err.Error(), c)
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxGrpcDescriptorUpload+1))
+	if err != nil {
+		response.FailWithMessage("读取上传文件失败: "+err.Error(), c)
+		return
+	}
+	if len(data) > maxGrpcDescriptorUpload {
+		response.FailWithMessage("描述文件过大（上限 8MB）", c)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file.Filename), filepath.Ext(file.Filename))
+	}
+	desc, err := wafGrpcDescriptorService.CheckParam(name, data)
+	if err != nil {
+		response.FailWithMessage("描述文件有误:"+err.Error(), c)
+		return
+	}
+	replaced, err := wafGrpcDescriptorService.UploadApi(name, req.Remarks, data, desc)
+	if err != nil {
+		response.FailWithMessage("保存失败:"+err.Error(), c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithDetailed(gin.H{
+		"name":         name,
+		"services":     desc.Services,
+		"method_count": desc.MethodCount(),
+		"replaced":     replaced,
+	}, "上传成功", c)
+}
+
+// GetDetailApi 获取描述文件详情
+func (w *WafGrpcDescriptorApi) GetDetailApi(c *gin.Context) {
+	var req request.WafGrpcDescriptorDetailReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafGrpcDescriptorService.GetDetailApi(req)
+	response.OkWithDetailed(bean, "获取成功", c)
+}
+
+// GetListApi 获取描述文件列表
+func (w *WafGrpcDescriptorApi) GetListApi(c *gin.Context) {
+	var req request.WafGrpcDescriptorSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	list, total, _ := wafGrpcDescriptorService.GetListApi(req)
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// ModifyApi 启用/停用描述文件、改备注；内容只能重新上传
+func (w *WafGrpcDescriptorApi) ModifyApi(c *gin.Context) {
+	var req request.WafGrpcDescriptorEditReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if err := wafGrpcDescriptorService.ModifyApi(req); err != nil {
+		response.FailWithMessage("编辑发生错误"+err.Error(), c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithMessage("编辑成功", c)
+}
+
+// DelApi 删除描述文件
+func (w *WafGrpcDescriptorApi) DelApi(c *gin.Context) {
+	var req request.WafGrpcDescriptorDelReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	err := wafGrpcDescriptorService.DelApi(req)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.FailWithMessage("请检测参数", c)
+	} else if err != nil {
+		response.FailWithMessage("发生错误", c)
+	} else {
+		w.NotifyWaf()
+		response.OkWithMessage("删除成功", c)
+	}
+}
+
+// NotifyWaf 通知 WAF 引擎重新加载描述文件，不重启 Worker
+func (w *WafGrpcDescriptorApi) NotifyWaf() {
+	global.GWAF_CHAN_GRPC_DESCRIPTOR <- 1
+}
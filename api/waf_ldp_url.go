@@ -20,14 +20,17 @@ func (w *WafLdpUrlApi) AddApi(c *gin.Context) {
 	var req request.WafLdpUrlAddReq
 	err := c.ShouldBindJSON(&req)
 	if err == nil {
+		if err = wafLdpUrlService.CheckMaskJSON(req.MaskJSON); err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
 		err = wafLdpUrlService.CheckIsExistApi(req)
 		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 			err = wafLdpUrlService.AddApi(req)
 			if err == nil {
-
+				w.NotifyWaf(req.HostCode)
 				response.OkWithMessage("添加成功", c)
 			} else {
-				w.NotifyWaf(req.HostCode)
 				response.FailWithMessage("添加失败", c)
 			}
 			return
@@ -89,6 +92,10 @@ func (w *WafLdpUrlApi) ModifyLdpUrlApi(c *gin.Context) {
 	var req request.WafLdpUrlEditReq
 	err := c.ShouldBindJSON(&req)
 	if err == nil {
+		if err = wafLdpUrlService.CheckMaskJSON(req.MaskJSON); err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
 		//编辑前先取旧记录，拿到可能被本次编辑改掉的旧 host_code(issue #898)
 		bean := wafLdpUrlService.GetDetailByIdApi(req.Id)
 		err = wafLdpUrlService.ModifyApi(req)
@@ -467,6 +467,42 @@ var routeDetailMap = map[string]routeDetail{
 		ParamExample:    `{"host_code":"abc123","url_pattern":"/static/","cache_time":3600,"remarks":"静态资源缓存"}`,
 		ResponseExample: `{"code":0,"data":{},"msg":"操作成功"}`,
 	},
+	"POST /api/v1/wafhost/cache/purge": {
+		Description:     "清理网站缓存（purge_type: all/url/prefix/wildcard/tag，tag 取自源站 Cache-Tag/Surrogate-Key 响应头）",
+		ParamExample:    `{"host_code":"abc123","purge_type":"prefix","values":["/static/"]}`,
+		ResponseExample: `{"code":0,"data":{"removed":12},"msg":"清理成功"}`,
+	},
+
+	// ======== 爬虫库 ========
+	"POST /api/v1/spiderbot/list": {
+		Description:     "获取爬虫库列表（分页，按匹配顺序）",
+		ParamExample:    `{"pageIndex":1,"pageSize":10,"name":"","category":"search"}`,
+		ResponseExample: `{"code":0,"data":{"list":[{"id":"xxx","name":"百度爬虫","category":"search","ua_patterns":"Baiduspider","rdns_suffixes":".baidu.com\n.baidu.jp","builtin":1,"status":1}],"total":1},"msg":"获取成功"}`,
+	},
+	"POST /api/v1/spiderbot/add": {
+		Description:     "新增爬虫定义（UA 特征必填；反向DNS后缀与公开IP段用于核验真伪，都不填则只按 UA 识别）",
+		ParamExample:    `{"name":"示例爬虫","category":"seo","ua_patterns":"ExampleBot","rdns_suffixes":".example.com","ip_ranges":"","sort":200,"status":1}`,
+		ResponseExample: `{"code":0,"data":{},"msg":"添加成功"}`,
+	},
+
+	// ======== YARA 规则 ========
+	"POST /api/v1/yara/add": {
+		Description:     "新增 YARA 规则集（全局生效；各网站在文件上传检测配置里开启 yara_scan/yara_body_scan 后使用；action: block 拦截 / log 仅记录）",
+		ParamExample:    `{"name":"webshell","content":"rule php_eval { strings: $a = \"eval($_POST\" nocase condition: $a }","action":"block","status":1}`,
+		ResponseExample: `{"code":0,"data":{},"msg":"添加成功"}`,
+	},
+	"POST /api/v1/yara/upload": {
+		Description:     "上传 .yar/.yara 规则文件（multipart 表单，字段 file，可选 name/action/remarks）；同名规则集存在时替换规则文本，实时生效",
+		ParamExample:    `file=@webshell.yar name=webshell action=log`,
+		ResponseExample: `{"code":0,"data":{"name":"webshell","rule_count":12,"replaced":true},"msg":"上传成功"}`,
+	},
+
+	// ======== gRPC 描述文件 ========
+	"POST /api/v1/grpc_descriptor/upload": {
+		Description:     "上传 protoc --descriptor_set_out --include_imports 生成的描述文件（multipart 表单，字段 file，.pb/.desc/.protoset，可选 name/remarks）；开启 gRPC 检测的网站按它把请求消息解成带字段名的 JSON 再检测，同名存在时替换，实时生效",
+		ParamExample:    `file=@api.protoset name=api`,
+		ResponseExample: `{"code":0,"data":{"name":"api","services":["shop.v1.OrderService"],"method_count":5,"replaced":false},"msg":"上传成功"}`,
+	},
 }
 
 // routeModuleMap 路由路径前缀到模块名的映射
@@ -488,7 +524,11 @@ var routeModuleMap = map[string]string{
 	"/api/v1/wafhost/httpauthbase": "网站防护-HTTP认证",
 	"/api/v1/wafhost/blockingpage": "网站防护-拦截页面",
 	"/api/v1/wafhost/cacherule":    "网站防护-缓存规则",
+	"/api/v1/wafhost/cache":        "网站防护-缓存规则",
 	"/api/v1/wafhost/otp":          "安全-OTP双因素",
+	"/api/v1/spiderbot":            "爬虫库",
+	"/api/v1/yara":                 "YARA规则",
+	"/api/v1/grpc_descriptor":      "gRPC描述文件",
 	"/api/v1/waflog/attack":        "日志-攻击日志",
 	"/api/v1/stat":                 "统计-数据统计",
 	"/api/v1/wafhost/engine":       "引擎-WAF引擎",
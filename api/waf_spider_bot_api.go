@@ -0,0 +1,125 @@
+package api
+
+import (
+	"SamWaf/global"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type WafSpiderBotApi struct{}
+
+// AddApi 新增爬虫定义
+func (w *WafSpiderBotApi) AddApi(c *gin.Context) {
+	var req request.WafSpiderBotAddReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := wafSpiderBotService.CheckParam(req.Name, req.Category, req.UAPatterns, req.IPRanges); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if wafSpiderBotService.CheckIsExistApi(req.Name) > 0 {
+		response.FailWithMessage("当前记录已经存在", c)
+		return
+	}
+	if err := wafSpiderBotService.AddApi(req); err != nil {
+		response.FailWithMessage("添加失败", c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithMessage("添加成功", c)
+}
+
+// GetDetailApi 获取爬虫定义详情
+func (w *WafSpiderBotApi) GetDetailApi(c *gin.Context) {
+	var req request.WafSpiderBotDetailReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafSpiderBotService.GetDetailApi(req)
+	response.OkWithDetailed(bean, "获取成功", c)
+}
+
+// GetListApi 获取爬虫库列表
+func (w *WafSpiderBotApi) GetListApi(c *gin.Context) {
+	var req request.WafSpiderBotSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	list, total, _ := wafSpiderBotService.GetListApi(req)
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// DelApi 删除爬虫定义（内置的只能停用）
+func (w *WafSpiderBotApi) DelApi(c *gin.Context) {
+	var req request.WafSpiderBotDelReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafSpiderBotService.GetDetailByIdApi(req.Id)
+	if bean.Id == "" {
+		response.FailWithMessage("未找到信息", c)
+		return
+	}
+	if bean.Builtin == 1 {
+		response.FailWithMessage("内置爬虫不能删除，可以停用", c)
+		return
+	}
+	err := wafSpiderBotService.DelApi(req)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.FailWithMessage("请检测参数", c)
+	} else if err != nil {
+		response.FailWithMessage("发生错误", c)
+	} else {
+		w.NotifyWaf()
+		response.OkWithMessage("删除成功", c)
+	}
+}
+
+// ModifyApi 编辑爬虫定义
+func (w *WafSpiderBotApi) ModifyApi(c *gin.Context) {
+	var req request.WafSpiderBotEditReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := wafSpiderBotService.CheckParam(req.Name, req.Category, req.UAPatterns, req.IPRanges); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	bean := wafSpiderBotService.GetDetailByIdApi(req.Id)
+	if bean.Id == "" {
+		response.FailWithMessage("未找到信息", c)
+		return
+	}
+	if bean.Builtin == 1 && bean.Name != req.Name {
+		response.FailWithMessage("内置爬虫不能改名", c)
+		return
+	}
+	if err := wafSpiderBotService.ModifyApi(req); err != nil {
+		response.FailWithMessage("编辑发生错误"+err.Error(), c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithMessage("编辑成功", c)
+}
+
+// NotifyWaf 通知 WAF 引擎重新加载爬虫库
+func (w *WafSpiderBotApi) NotifyWaf() {
+	global.GWAF_CHAN_SPIDER_BOT <- 1
+}
@@ -261,6 +261,9 @@ func (w *WafTunnelApi) GetTunnelConnectionsApi(c *gin.Context) {
 			tcpSourceIPs := []map[string]string{}
 			// UDP来源连接IP列表
 			udpSourceIPs := []map[string]string{}
+			// 连接明细（带连接ID和实时字节数，供手工断开使用）
+			tcpConns := []waftunnelmodel.ConnDetail{}
+			udpSessions := []waftunnelmodel.ConnDetail{}
 
 			// 获取TCP连接数和IP列表
 			if globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE != nil {
@@ -290,6 +293,10 @@ func (w *WafTunnelApi) GetTunnelConnectionsApi(c *gin.Context) {
 						"region": fmt.Sprintf("%v", region),
 					})
 				}
+
+				tcpConns = globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE.TCPConnections.GetPortConnsDetail(port, waftunnelmodel.ConnTypeSource)
+				// UDP 一个会话对应一条目标连接
+				udpSessions = globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE.UDPConnections.GetPortConnsDetail(port, waftunnelmodel.ConnTypeTarget)
 			}
 
 			portInfo := map[string]interface{}{
@@ -300,6 +307,8 @@ func (w *WafTunnelApi) GetTunnelConnectionsApi(c *gin.Context) {
 				"udp_target_count": udpTargetCount,
 				"tcp_source_ips":   tcpSourceIPs,
 				"udp_source_ips":   udpSourceIPs,
+				"tcp_conns":        tcpConns,
+				"udp_sessions":     udpSessions,
 			}
 
 			portInfoList = append(portInfoList, portInfo)
@@ -317,3 +326,109 @@ func (w *WafTunnelApi) GetTunnelConnectionsApi(c *gin.Context) {
 		response.FailWithMessage("解析失败", c)
 	}
 }
+
+// KillConnectionApi 手工断开一条存活连接
+// @Summary      断开隧道连接
+// @Description  按连接ID断开指定端口上的一条存活连接（TCP 两端一起关，UDP 结束该会话）
+// @Tags         隧道管理
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelConnKillReq  true  "连接信息"
+// @Success      200   {object}  response.Response  "断开成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/conn/kill [post]
+func (w *WafTunnelApi) KillConnectionApi(c *gin.Context) {
+	var req request.WafTunnelConnKillReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if req.ConnId == "" || req.Port <= 0 {
+		response.FailWithMessage("端口和连接ID不能为空", c)
+		return
+	}
+	if globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE == nil {
+		response.FailWithMessage("隧道引擎未启动", c)
+		return
+	}
+	found := false
+	switch strings.ToLower(req.Protocol) {
+	case "udp":
+		found = globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE.UDPConnections.KillConn(req.Port, req.ConnId)
+	default:
+		found = globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE.TCPConnections.KillConn(req.Port, req.ConnId)
+	}
+	if !found {
+		response.FailWithMessage("连接不存在或已断开", c)
+		return
+	}
+	response.OkWithMessage("断开成功", c)
+}
+
+// GetConnLogListApi 隧道连接审计日志
+// @Summary      隧道连接审计日志
+// @Description  分页查询隧道连接记录：来源、时长、字节数、关闭原因、是否被规则拒绝
+// @Tags         隧道管理
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelConnLogSearchReq  true  "查询条件"
+// @Success      200   {object}  response.Response
+// @Security     ApiKeyAuth
+// @Router       /tunnel/connlog/list [post]
+func (w *WafTunnelApi) GetConnLogListApi(c *gin.Context) {
+	var req request.WafTunnelConnLogSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if req.PageIndex <= 0 {
+		req.PageIndex = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > 500 {
+		req.PageSize = 20
+	}
+	list, total, err := wafTunnelService.GetConnLogList(req)
+	if err != nil {
+		response.FailWithMessage("查询失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// GetTunnelStatsApi 隧道流量统计
+// @Summary      隧道流量统计
+// @Description  按天或按小时查询隧道的连接数、拒绝数和进出流量
+// @Tags         隧道管理
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelStatsReq  true  "查询条件"
+// @Success      200   {object}  response.Response
+// @Security     ApiKeyAuth
+// @Router       /tunnel/stats [post]
+func (w *WafTunnelApi) GetTunnelStatsApi(c *gin.Context) {
+	var req request.WafTunnelStatsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	if req.Unit == "hour" {
+		list, err := wafTunnelService.GetTunnelHourStats(req)
+		if err != nil {
+			response.FailWithMessage("查询失败: "+err.Error(), c)
+			return
+		}
+		response.OkWithDetailed(list, "获取成功", c)
+		return
+	}
+	list, err := wafTunnelService.GetTunnelDayStats(req)
+	if err != nil {
+		response.FailWithMessage("查询失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithDetailed(list, "获取成功", c)
+}
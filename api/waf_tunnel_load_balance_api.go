@@ -0,0 +1,204 @@
+package api
+
+import (
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/globalobj"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"SamWaf/model/spec"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WafTunnelLoadBalanceApi struct {
+}
+
+// AddApi 新增隧道负载目标
+// @Summary      新增隧道负载目标
+// @Description  为指定隧道新增一个转发目标（需在隧道上启用多目标负载才生效）
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelLoadBalanceAddReq  true  "目标配置"
+// @Success      200   {object}  response.Response  "添加成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/add [post]
+func (w *WafTunnelLoadBalanceApi) AddApi(c *gin.Context) {
+	var req request.WafTunnelLoadBalanceAddReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		if req.TunnelCode == "" || req.RemoteIp == "" || req.RemotePort <= 0 || req.RemotePort > 65535 {
+			response.FailWithMessage("隧道、目标IP和端口不能为空", c)
+			return
+		}
+		err = wafTunnelLBService.CheckIsExistApi(req)
+		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+			err = wafTunnelLBService.AddApi(req)
+			if err == nil {
+				w.NotifyTunnel(req.TunnelCode)
+				response.OkWithMessage("添加成功", c)
+			} else {
+				response.FailWithMessage("添加失败", c)
+			}
+			return
+		} else {
+			response.FailWithMessage("当前目标IP+端口已经存在", c)
+			return
+		}
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// GetDetailApi 获取隧道负载目标详情
+// @Summary      获取隧道负载目标详情
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        id  query     string  true  "目标ID"
+// @Success      200  {object}  response.Response  "获取成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/detail [get]
+func (w *WafTunnelLoadBalanceApi) GetDetailApi(c *gin.Context) {
+	var req request.WafTunnelLoadBalanceDetailReq
+	err := c.ShouldBind(&req)
+	if err == nil {
+		bean := wafTunnelLBService.GetDetailByIdApi(req.Id)
+		response.OkWithDetailed(bean, "获取成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// GetListApi 获取隧道负载目标列表
+// @Summary      获取隧道负载目标列表
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelLoadBalanceSearchReq  true  "分页查询参数"
+// @Success      200   {object}  response.Response{data=response.PageResult}  "获取成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/list [post]
+func (w *WafTunnelLoadBalanceApi) GetListApi(c *gin.Context) {
+	var req request.WafTunnelLoadBalanceSearchReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		list, total, _ := wafTunnelLBService.GetListApi(req)
+		response.OkWithDetailed(response.PageResult{
+			List:      list,
+			Total:     total,
+			PageIndex: req.PageIndex,
+			PageSize:  req.PageSize,
+		}, "获取成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// DelApi 删除隧道负载目标
+// @Summary      删除隧道负载目标
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        id  query     string  true  "目标ID"
+// @Success      200  {object}  response.Response  "删除成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/del [get]
+func (w *WafTunnelLoadBalanceApi) DelApi(c *gin.Context) {
+	var req request.WafTunnelLoadBalanceDelReq
+	err := c.ShouldBind(&req)
+	if err == nil {
+		bean := wafTunnelLBService.GetDetailByIdApi(req.Id)
+		err = wafTunnelLBService.DelApi(req)
+		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+			response.FailWithMessage("请检测参数", c)
+		} else if err != nil {
+			response.FailWithMessage("发生错误", c)
+		} else {
+			w.NotifyTunnel(bean.TunnelCode)
+			response.OkWithMessage("删除成功", c)
+		}
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// ModifyApi 编辑隧道负载目标
+// @Summary      编辑隧道负载目标
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        data  body      request.WafTunnelLoadBalanceEditReq  true  "目标配置"
+// @Success      200   {object}  response.Response  "编辑成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/edit [post]
+func (w *WafTunnelLoadBalanceApi) ModifyApi(c *gin.Context) {
+	var req request.WafTunnelLoadBalanceEditReq
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		bean := wafTunnelLBService.GetDetailByIdApi(req.Id)
+		err = wafTunnelLBService.ModifyApi(req)
+		if err != nil {
+			response.FailWithMessage("编辑发生错误 "+err.Error(), c)
+		} else {
+			w.NotifyTunnel(bean.TunnelCode)
+			if req.TunnelCode != bean.TunnelCode {
+				w.NotifyTunnel(req.TunnelCode)
+			}
+			response.OkWithMessage("编辑成功", c)
+		}
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+// GetHealthApi 隧道负载目标运行状态
+// @Summary      隧道负载目标运行状态
+// @Description  各目标的健康状态、当前连接数和最近一次探测结果；未启用多目标负载时返回空列表
+// @Tags         隧道管理-负载均衡
+// @Accept       json
+// @Produce      json
+// @Param        tunnel_code  query     string  true  "隧道唯一码"
+// @Success      200  {object}  response.Response  "获取成功"
+// @Security     ApiKeyAuth
+// @Router       /tunnel/loadbalance/health [get]
+func (w *WafTunnelLoadBalanceApi) GetHealthApi(c *gin.Context) {
+	var req request.WafTunnelTargetHealthReq
+	err := c.ShouldBind(&req)
+	if err == nil {
+		if globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE == nil {
+			response.OkWithDetailed([]interface{}{}, "获取成功", c)
+			return
+		}
+		list := globalobj.GWAF_RUNTIME_OBJ_TUNNEL_ENGINE.GetTargetStatus(req.TunnelCode)
+		if list == nil {
+			response.OkWithDetailed([]interface{}{}, "获取成功", c)
+			return
+		}
+		response.OkWithDetailed(list, "获取成功", c)
+	} else {
+		response.FailWithMessage("解析失败", c)
+	}
+}
+
+/*
+*
+目标变化后通知隧道引擎重建负载（新旧内容相同，引擎只重建目标，不重启监听）
+*/
+func (w *WafTunnelLoadBalanceApi) NotifyTunnel(tunnelCode string) {
+	if tunnelCode == "" {
+		return
+	}
+	tunnel, err := wafTunnelService.GetTunnelByCode(tunnelCode)
+	if err != nil {
+		return
+	}
+	global.GWAF_CHAN_COMMON_MSG <- spec.ChanCommon{
+		Type:       enums.ChanComTypeTunnel,
+		OpType:     enums.OP_TYPE_UPDATE,
+		Content:    tunnel,
+		OldContent: tunnel,
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/common/response"
+	"SamWaf/model/request"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// maxYaraUpload 单个规则文件上限，规则文本整段存库并在每次变更时全部重新编译
+const maxYaraUpload = 4 << 20
+
+type WafYaraApi struct{}
+
+// AddApi 新增 YARA 规则集
+func (w *WafYaraApi) AddApi(c *gin.Context) {
+	var req request.WafYaraRuleSetAddReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	ruleCount, err := wafYaraService.CheckParam(req.Name, req.Action, req.Content)
+	if err != nil {
+		response.FailWithMessage("YARA 规则有误:"+err.Error(), c)
+		return
+	}
+	if wafYaraService.CheckIsExistApi(req.Name) > 0 {
+		response.FailWithMessage("当前记录已经存在", c)
+		return
+	}
+	if err := wafYaraService.AddApi(req, ruleCount); err != nil {
+		response.FailWithMessage("添加失败", c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithMessage("添加成功", c)
+}
+
+// UploadApi 上传 .yar/.yara 规则文件：同名规则集存在时替换规则文本，否则新建(默认启用、拦截)
+func (w *WafYaraApi) UploadApi(c *gin.Context) {
+	var req request.WafYaraRuleSetUploadReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		response.FailWithMessage("文件上传失败: "+err.Error(), c)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".yar" && ext != ".yara" {
+		response.FailWithMessage("不支持的文件类型，仅支持 .yar/.yara 规则文件", c)
+		return
+	}
+	if file.Size > maxYaraUpload {
+		response.FailWithMessage("规则文件过大（上限 4MB）", c)
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.FailWithMessage("打开上传文件失败: "+err.Error(), c)
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxYaraUpload+1))
+	if err != nil {
+		response.FailWithMessage("读取上传文件失败: "+err.Error(), c)
+		return
+	}
+	if len(data) > maxYaraUpload {
+		response.FailWithMessage("规则文件过大（上限 4MB）", c)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file.Filename), filepath.Ext(file.Filename))
+	}
+	exist := wafYaraService.GetDetailByNameApi(name)
+	action, remarks, status := req.Action, req.Remarks, 1
+	if exist.Id != "" {
+		if action == "" {
+			action = exist.Action
+		}
+		if remarks == "" {
+			remarks = exist.Remarks
+		}
+		status = exist.Status
+	} else if action == "" {
+		action = model.YaraActionBlock
+	}
+	ruleCount, err := wafYaraService.CheckParam(name, action, string(data))
+	if err != nil {
+		response.FailWithMessage("YARA 规则有误:"+err.Error(), c)
+		return
+	}
+
+	if exist.Id != "" {
+		err = wafYaraService.ModifyApi(request.WafYaraRuleSetEditReq{
+			Id: exist.Id, Name: name, Content: string(data), Action: action, Status: status, Remarks: remarks,
+		}, ruleCount)
+	} else {
+		err = wafYaraService.AddApi(request.WafYaraRuleSetAddReq{
+			Name: name, Content: string(data), Action: action, Status: status, Remarks: remarks,
+		}, ruleCount)
+	}
+	if err != nil {
+		response.FailWithMessage("保存失败:"+err.Error(), c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithDetailed(gin.H{
+		"name":       name,
+		"rule_count": ruleCount,
+		"replaced":   exist.Id != "",
+	}, "上传成功", c)
+}
+
+// GetDetailApi 获取 YARA 规则集详情
+func (w *WafYaraApi) GetDetailApi(c *gin.Context) {
+	var req request.WafYaraRuleSetDetailReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	bean := wafYaraService.GetDetailApi(req)
+	response.OkWithDetailed(bean, "获取成功", c)
+}
+
+// GetListApi 获取 YARA 规则集列表
+func (w *WafYaraApi) GetListApi(c *gin.Context) {
+	var req request.WafYaraRuleSetSearchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	list, total, _ := wafYaraService.GetListApi(req)
+	response.OkWithDetailed(response.PageResult{
+		List:      list,
+		Total:     total,
+		PageIndex: req.PageIndex,
+		PageSize:  req.PageSize,
+	}, "获取成功", c)
+}
+
+// DelApi 删除 YARA 规则集
+func (w *WafYaraApi) DelApi(c *gin.Context) {
+	var req request.WafYaraRuleSetDelReq
+	if err := c.ShouldBind(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	err := wafYaraService.DelApi(req)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		response.FailWithMessage("请检测参数", c)
+	} else if err != nil {
+		response.FailWithMessage("发生错误", c)
+	} else {
+		w.NotifyWaf()
+		response.OkWithMessage("删除成功", c)
+	}
+}
+
+// ModifyApi 编辑 YARA 规则集
+func (w *WafYaraApi) ModifyApi(c *gin.Context) {
+	var req request.WafYaraRuleSetEditReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("解析失败", c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	ruleCount, err := wafYaraService.CheckParam(req.Name, req.Action, req.Content)
+	if err != nil {
+		response.FailWithMessage("YARA 规则有误:"+err.Error(), c)
+		return
+	}
+	if err := wafYaraService.ModifyApi(req, ruleCount); err != nil {
+		response.FailWithMessage("编辑发生错误"+err.Error(), c)
+		return
+	}
+	w.NotifyWaf()
+	response.OkWithMessage("编辑成功", c)
+}
+
+// NotifyWaf 通知 WAF 引擎重新编译 YARA 规则，不重启 Worker
+func (w *WafYaraApi) NotifyWaf() {
+	global.GWAF_CHAN_YARA <- 1
+}
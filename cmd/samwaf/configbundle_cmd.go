@@ -0,0 +1,95 @@
+package main
+
+import (
+	"SamWaf/service/waf_service"
+	"SamWaf/wafdb"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runConfigBundleCmd 配置即代码命令行：
+//
+//	samwaf configbundle export [--host=网站code] [--file=输出文件] [--format=yaml|json]
+//	samwaf configbundle plan   --file=配置包 [--prune]
+//	samwaf configbundle apply  --file=配置包 [--prune]
+//
+// 命令行直接读写本地库，不经过运行中的引擎：apply 之后需要重启服务，
+// 或改用管理端接口 /api/v1/configbundle/apply（会即时通知引擎重新加载）。
+func runConfigBundleCmd(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: configbundle export|plan|apply [--host=] [--file=] [--format=yaml|json] [--prune]")
+	}
+	var hostCode, file, format string
+	prune := false
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--prune":
+			prune = true
+		case strings.HasPrefix(arg, "--host="):
+			hostCode = strings.TrimPrefix(arg, "--host=")
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		}
+	}
+
+	wafdb.InitCoreDb("")
+	svc := waf_service.WafConfigBundleServiceApp
+
+	switch args[0] {
+	case "export":
+		bundle, err := svc.ExportApi(hostCode)
+		if err != nil {
+			return err
+		}
+		content, err := svc.MarshalBundle(bundle, format)
+		if err != nil {
+			return err
+		}
+		if file == "" {
+			fmt.Println(string(content))
+		} else if err := os.WriteFile(file, content, 0600); err != nil {
+			return err
+		} else {
+			fmt.Printf("已导出 %d 个网站到 %s\n", len(bundle.Hosts), file)
+		}
+		for _, key := range bundle.MissingSecrets {
+			fmt.Fprintf(os.Stderr, "提示: 密钥管理中缺少 %s，目标环境 apply 前需先建好\n", key)
+		}
+		return nil
+	case "plan", "apply":
+		if file == "" {
+			return fmt.Errorf("缺少 --file=配置包路径")
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		bundle, err := svc.ParseBundle(content)
+		if err != nil {
+			return err
+		}
+		if args[0] == "plan" {
+			printConfigBundlePlan(svc.PlanApi(bundle, prune))
+			return nil
+		}
+		plan, changes, err := svc.ApplyApi(bundle, prune)
+		printConfigBundlePlan(plan)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			fmt.Printf("已应用，涉及 %d 个网站。如服务正在运行，请重启服务使配置生效。\n", len(changes))
+		}
+		return nil
+	}
+	return fmt.Errorf("未知子命令: %s", args[0])
+}
+
+func printConfigBundlePlan(plan interface{}) {
+	out, _ := json.MarshalIndent(plan, "", "  ")
+	fmt.Println(string(out))
+}
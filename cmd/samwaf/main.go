@@ -22,6 +22,7 @@ import (
 	"SamWaf/wafconfig"
 	"SamWaf/wafdb"
 	"SamWaf/wafenginecore"
+	"SamWaf/wafenginecore/wafapispec"
 	"SamWaf/wafenginecore/wafcaptcha"
 	"SamWaf/wafhostguard"
 	"SamWaf/wafinit"
@@ -226,7 +227,11 @@ func (m *wafSystenService) run() {
 	if err != nil {
 		zlog.Error("access", err.Error())
 	}
-	//TODO 准备释放最新spider bot
+	// 爬虫库资源释放（内置爬虫定义与公开IP列表）
+	err = wafinit.CheckAndReleaseDataset(spiderBotAssets, utils.GetCurrentDir()+"/data/spiderbot", "spiderbot")
+	if err != nil {
+		zlog.Error("spiderbot", err.Error())
+	}
 
 	//初始化cache
 	{
@@ -305,6 +310,8 @@ func (m *wafSystenService) run() {
 	// 不共用 keyspace 是因为上面那套计数会被自定义规则的 MF.GetIPFailureCount 读取，
 	// 混入 SSH/RDP 的失败会静默改变用户已有 WAF 规则的语义。
 	wafipban.InitHostLoginFailureManager(global.GCACHE_WAFCACHE)
+	// 网站登录接口失败计数器(防撞库)：同样共用缓存、键前缀独立
+	wafipban.InitSiteLoginFailureManager(global.GCACHE_WAFCACHE)
 	// 把事件落库能力注入主机防护引擎（反向注入避免 service 与 wafhostguard 循环依赖）
 	waf_service.WafHostGuardServiceApp.InitEventSink()
 
@@ -442,6 +449,12 @@ func (m *wafSystenService) run() {
 	//快照未发布时 accessgate.Get() 返回"全部关闭"的兜底配置(误放行而非误拦)，
 	//所以这一行的作用是把真实策略尽早顶上去。
 	waf_service.WafAccessConfigServiceApp.PublishConfig()
+	//内置爬虫定义同步进爬虫库(按名称去重，不覆盖用户修改)，StartWaf 里编译生效
+	if added, err := waf_service.WafSpiderBotServiceApp.SyncBuiltin(filepath.Join(utils.GetCurrentDir(), "data", "spiderbot", "registry.json")); err != nil {
+		zlog.Warn("爬虫库", err.Error())
+	} else if added > 0 {
+		zlog.Info("爬虫库新增内置爬虫", "count", added)
+	}
 	http.Handle("/", globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE)
 	globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.StartWaf()
 
@@ -500,6 +513,8 @@ func (m *wafSystenService) run() {
 	globalobj.GWAF_RUNTIME_OBJ_WAF_TaskRegistry.RegisterTask(enums.TASK_ACCESS_CLEAN, waftask.TaskAccessClean)
 	globalobj.GWAF_RUNTIME_OBJ_WAF_TaskRegistry.RegisterTask(enums.TASK_HOSTGUARD_CLEAN_EXPIRED, waftask.TaskHostGuardCleanExpired)
 	globalobj.GWAF_RUNTIME_OBJ_WAF_TaskRegistry.RegisterTask(enums.TASK_TRAFFIC_FLUSH, waftask.TaskTrafficFlush)
+	globalobj.GWAF_RUNTIME_OBJ_WAF_TaskRegistry.RegisterTask(enums.TASK_TUNNEL_TRAFFIC_FLUSH, waftask.TaskTunnelTrafficFlush)
+	globalobj.GWAF_RUNTIME_OBJ_WAF_TaskRegistry.RegisterTask(enums.TASK_LIST_EXPIRE_SWEEP, waftask.TaskListExpireSweep)
 
 	// 进程启动重放：把各启用威胁情报渠道的快照重新灌入系统 ipset(内存态重启会丢) 并重建 WAF 并集
 	go waf_service.WafThreatIPServiceApp.RestoreAllOnStartup()
@@ -641,6 +656,9 @@ func (m *wafSystenService) run() {
 				case enums.ChanTypeAnticc:
 					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ApplyAntiCCConfig(msg.HostCode, msg.Content.(model.AntiCC))
 					break
+				case enums.ChanTypeAnticcKeyed:
+					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ApplyAntiCCKeyed(msg.HostCode, msg.Content.([]model.AntiCC))
+					break
 				case enums.ChanTypeHttpauth:
 					httpAuthBases := msg.Content.([]model.HttpAuthBase)
 					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.UpdateHost(msg.HostCode, func(h *wafenginmodel.HostSafe) { h.HttpAuthBases = httpAuthBases })
@@ -721,6 +739,18 @@ func (m *wafSystenService) run() {
 					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.UpdateHost(msg.HostCode, func(h *wafenginmodel.HostSafe) { h.PathRules = pathRules })
 					zlog.Debug("远程配置", zap.Any("配置路径路由规则", pathRules))
 					break
+				case enums.ChanTypeDetectExclusion:
+					exclusions := msg.Content.([]model.DetectExclusion)
+					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.UpdateHost(msg.HostCode, func(h *wafenginmodel.HostSafe) { h.DetectExclusions = exclusions })
+					zlog.Debug("远程配置", zap.Any("配置内置检测误报排除", exclusions))
+					break
+				case enums.ChanTypeApiSpec:
+					apiSpecs, apiSpecErrs := wafapispec.CompileList(msg.Content.([]model.ApiSpec))
+					for _, specErr := range apiSpecErrs {
+						zlog.Error("远程配置", zap.String("接口规范", msg.HostCode), zap.Error(specErr))
+					}
+					globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.UpdateHost(msg.HostCode, func(h *wafenginmodel.HostSafe) { h.ApiSpecs = apiSpecs })
+					break
 				}
 
 				//end switch
@@ -882,6 +912,18 @@ func (m *wafSystenService) run() {
 			zlog.Debug("远程配置", sensitive)
 			globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ReLoadSensitive()
 			break
+		case spiderBot := <-global.GWAF_CHAN_SPIDER_BOT:
+			zlog.Debug("远程配置", spiderBot)
+			globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ReLoadSpiderBot()
+			break
+		case yara := <-global.GWAF_CHAN_YARA:
+			zlog.Debug("远程配置", yara)
+			globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ReLoadYara()
+			break
+		case grpcDescriptor := <-global.GWAF_CHAN_GRPC_DESCRIPTOR:
+			zlog.Debug("远程配置", grpcDescriptor)
+			globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ReLoadGrpcDescriptors()
+			break
 		case sslOrderChan := <-global.GWAF_CHAN_SSLOrder:
 			zlog.Debug("ssl证书申请", sslOrderChan)
 			globalobj.GWAF_RUNTIME_OBJ_WAF_ENGINE.ApplySSLOrder(sslOrderChan.Type, sslOrderChan.Content.(model.SslOrder))
@@ -1221,6 +1263,11 @@ func main() {
 				fmt.Println("迁移失败:", err)
 				os.Exit(1)
 			}
+		case "configbundle": // 配置即代码：导出/预览/应用网站配置包
+			if err := runConfigBundleCmd(os.Args[2:]); err != nil {
+				fmt.Println("configbundle 失败:", err)
+				os.Exit(1)
+			}
 		case "rollback": //版本回退
 			fmt.Println("================================================")
 			fmt.Println("         SamWaf 版本回退工具")
@@ -5,6 +5,8 @@ const (
 	CACHE_OTP_ERROR      = "CACHE_OTP_ERROR"       //二次验证(OTP)错误，按账户名计数，防 TOTP 爆破
 	CACHE_NOTICE_PRE     = "CACHE_NOTICE_PRE"      //通知前缀
 	CACHE_CCVISITBAN_PRE = "CACHE_CCVISITBAN_PRE_" //CC封禁前缀
+	CACHE_CCESCALATE_PRE = "CACHE_CCESCALATE_PRE_" //CC逐级处置的超限记录前缀，键后缀是 ip|host_code
+	CACHE_CCKEYBAN_PRE   = "CACHE_CCKEYBAN_PRE_"   //CC按键限流封禁前缀，键后缀是 规则ID|限流键值
 	CACHE_TOKEN          = "CACHE_TOKEN"           //鉴权信息
 	CACHE_DNS_BOT_IP     = "CACHE_DNS_BOT_IP"      //IP反向域名解析
 	CACHE_DNS_NORMAL_IP  = "CACHE_DNS_NORMAL_IP"   //正常IP
@@ -17,6 +19,13 @@ const (
 	CACHE_REPLAY_NONCE   = "CACHE_REPLAY_NONCE_"   // 防重放 nonce 前缀
 	CACHE_TOKEN_BINDFAIL = "CACHE_TOKEN_BINDFAIL_" // 令牌绑定校验(设备指纹/严格IP)连续失败次数，键后缀是令牌
 
+	// —— 网站登录接口防撞库 ——
+	// 与主机登录、MF.GetIPFailureCount 的失败计数都不共用 keyspace，互不影响
+	CACHE_SITE_LOGIN_FAIL_PRE = "CACHE_SITE_LOGIN_FAIL_" //登录失败计数，键后缀是 host_code:维度:值
+
+	// —— 爬虫策略 ——
+	CACHE_ROBOTS_PRE = "CACHE_ROBOTS_" //源站 robots.txt 原文，键后缀是 host_code，4xx 时存空串(全部允许)
+
 	// —— 统一访问认证(Access 模式) ——
 	// 令牌与会话的真相源是数据库，缓存只是热路径加速。
 	// 正向缓存 TTL 有 60 秒硬上限(model.AccessDefaultCachePosTTL)，
@@ -18,4 +18,7 @@ const (
 	ChanTypeCacheRule
 	ChanTypeHostPathRule
 	ChanTypeTamperRule
+	ChanTypeDetectExclusion
+	ChanTypeApiSpec
+	ChanTypeAnticcKeyed
 )
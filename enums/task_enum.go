@@ -28,4 +28,6 @@ const (
 	TASK_ACCESS_CLEAN                 = "task_access_clean"                 //统一访问认证：清理过期会话/令牌/票据与审计日志
 	TASK_HOSTGUARD_CLEAN_EXPIRED      = "task_hostguard_clean_expired"      //主机防爆破：解封到期封禁(每分钟，因最短阶梯只有5分钟)
 	TASK_TRAFFIC_FLUSH                = "task_traffic_flush"                //站点流量计量落库(30秒一次，引擎侧字节计量与日志解耦)
+	TASK_TUNNEL_TRAFFIC_FLUSH         = "task_tunnel_traffic_flush"         //隧道流量统计落库(30秒一次)
+	TASK_LIST_EXPIRE_SWEEP            = "task_list_expire_sweep"            //清理到期的临时黑白名单条目(1分钟一次)
 )
@@ -121,6 +121,9 @@ var (
 	GWAF_CHAN_COMMON_MSG                            = make(chan spec.ChanCommon, 10)     //全局共用通讯包
 	GWAF_CHAN_UPDATE                                = make(chan int, 10)                 //升级后处理链
 	GWAF_CHAN_SENSITIVE                             = make(chan int, 10)                 //敏感词处理链
+	GWAF_CHAN_SPIDER_BOT                            = make(chan int, 10)                 //爬虫库处理链
+	GWAF_CHAN_YARA                                  = make(chan int, 10)                 //YARA 规则处理链
+	GWAF_CHAN_GRPC_DESCRIPTOR                       = make(chan int, 10)                 //gRPC 描述文件处理链
 	GWAF_CHAN_SSL                                   = make(chan string, 10)              //证书处理链
 	GWAF_CHAN_SSLOrder                              = make(chan spec.ChanSslOrder, 10)   //SSL证书申请
 	GWAF_CHAN_SSL_EXPIRE_CHECK                      = make(chan int, 10)                 //SSL证书到期检测
@@ -0,0 +1,82 @@
+package global
+
+import (
+	"sync"
+)
+
+// 隧道流量累加器：和站点流量（traffic_stats.go）同一套思路，按「隧道 + 天 + 整点」分桶，
+// 由定时任务取走增量落库。隧道的连接频率远低于 HTTP 请求，且只在连接结束时累加一次，
+// 一把锁足够，不做分片。
+
+// TunnelTrafficKey 一个隧道流量桶的键
+type TunnelTrafficKey struct {
+	TunnelCode string // 隧道唯一码
+	TunnelName string // 隧道名称（落库时写入，便于旧行缺失时新建）
+	Day        int    // 年月日，如 20261018
+	HourTime   int64  // 整点 unix 时间戳（秒）
+}
+
+// TunnelTrafficSnapshot Drain 出来的一个桶的增量
+type TunnelTrafficSnapshot struct {
+	TunnelTrafficKey
+	Conns  int64 // 连接数
+	Denies int64 // 被拒绝数
+	In     int64 // 入站字节
+	Out    int64 // 出站字节
+}
+
+var (
+	tunnelTrafficMu sync.Mutex
+	tunnelTrafficM  map[TunnelTrafficKey]*TunnelTrafficSnapshot
+)
+
+// AddTunnelTraffic 累加一次连接的结果。tunnelCode 为空直接丢弃，无处归属。
+func AddTunnelTraffic(tunnelCode, tunnelName string, day int, hourTime int64, conns, denies, in, out int64) {
+	if tunnelCode == "" || (conns <= 0 && denies <= 0 && in <= 0 && out <= 0) {
+		return
+	}
+	k := TunnelTrafficKey{TunnelCode: tunnelCode, TunnelName: tunnelName, Day: day, HourTime: hourTime}
+	tunnelTrafficMu.Lock()
+	if tunnelTrafficM == nil {
+		tunnelTrafficM = make(map[TunnelTrafficKey]*TunnelTrafficSnapshot, 8)
+	}
+	s := tunnelTrafficM[k]
+	if s == nil {
+		s = &TunnelTrafficSnapshot{TunnelTrafficKey: k}
+		tunnelTrafficM[k] = s
+	}
+	if conns > 0 {
+		s.Conns += conns
+	}
+	if denies > 0 {
+		s.Denies += denies
+	}
+	if in > 0 {
+		s.In += in
+	}
+	if out > 0 {
+		s.Out += out
+	}
+	tunnelTrafficMu.Unlock()
+}
+
+// DrainTunnelTraffic 取走全部累计增量并清空
+func DrainTunnelTraffic() []TunnelTrafficSnapshot {
+	tunnelTrafficMu.Lock()
+	old := tunnelTrafficM
+	tunnelTrafficM = nil
+	tunnelTrafficMu.Unlock()
+
+	out := make([]TunnelTrafficSnapshot, 0, len(old))
+	for _, s := range old {
+		out = append(out, *s)
+	}
+	return out
+}
+
+// RestoreTunnelTraffic 落库失败时把增量放回累加器，等下个周期重试
+func RestoreTunnelTraffic(list []TunnelTrafficSnapshot) {
+	for _, s := range list {
+		AddTunnelTraffic(s.TunnelCode, s.TunnelName, s.Day, s.HourTime, s.Conns, s.Denies, s.In, s.Out)
+	}
+}
@@ -0,0 +1,37 @@
+package innerbean
+
+// 请求参数来源
+const (
+	ReqArgSourceQuery     = "query"     //URL查询参数
+	ReqArgSourceForm      = "form"      //x-www-form-urlencoded 表单
+	ReqArgSourceJSON      = "json"      //JSON 请求体，Name 为嵌套路径，如 user.tags[0]
+	ReqArgSourceXML       = "xml"       //XML 请求体，Name 为元素路径，属性为 a.b@attr
+	ReqArgSourceMultipart = "multipart" //multipart 的非文件字段
+	ReqArgSourceGraphQL   = "graphql"   //GraphQL 变量及查询文档中的字符串字面量
+	ReqArgSourceCookie    = "cookie"
+	ReqArgSourceHeader    = "header"
+	ReqArgSourceBody      = "body"      //无法按结构解析的请求体整体
+	ReqArgSourceWebSocket = "websocket" //WebSocket 文本消息，JSON 消息的 Name 为嵌套路径
+	ReqArgSourceGrpc      = "grpc"      //gRPC 请求消息，Name 为字段路径(有描述文件时是字段名，否则是字段编号)
+)
+
+// ReqArg 从请求中拆出的一个具名参数值，内置检测逐个对其判定
+type ReqArg struct {
+	Source string
+	Name   string
+	Value  string
+	// IsName 为 true 时 Value 是参数名所在的整段(k=v)，JSON 请求体里则是对象的键名。
+	// 查询串里 ?1'or'1'='1 这类载荷会被按 = 拆到参数名里，只看值会漏掉
+	IsName bool
+}
+
+// Label 记录到日志的参数标识，如 json:user.name、cookie:sid
+func (a ReqArg) Label() string {
+	if a.Name == "" {
+		return a.Source
+	}
+	if a.IsName {
+		return a.Source + ":" + a.Name + "(参数名)"
+	}
+	return a.Source + ":" + a.Name
+}
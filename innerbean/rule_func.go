@@ -313,3 +313,7 @@ func (rf *RuleFunc) Allow(modules ...string) {}
 // AllowAll 命中后放行并跳过后续所有检测，直通后端（等价于 RF.Allow("ALL")）
 // 使用示例: then RF.AllowAll();
 func (rf *RuleFunc) AllowAll() {}
+
+// Challenge 命中后要求访客先通过浏览器挑战(站点验证码配置的引擎，未开启验证码时用 JS 挑战)，已通过的放行
+// 使用示例: then RF.Challenge();
+func (rf *RuleFunc) Challenge() {}
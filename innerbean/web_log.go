@@ -53,12 +53,45 @@ type WebLog struct {
 	IsBalance            int     `json:"is_balance"`                                                        //是否是负载均衡 1 是 0 不是
 	BalanceInfo          string  `gorm:"size:255" json:"balance_info"`                                      //负载均衡IP端口信息
 	AI_SCORE             float64 `json:"ai_score"`                                                          //AI检测得分[0,1]，0表示未经AI检测或未命中；命中(观察/拦截)时记录实际分数
+	MATCH_ARG            string  `gorm:"size:512" json:"match_arg"`                                         //内置检测命中的请求参数，如 json:user.name、cookie:sid
+	SPEC_VIOLATION       string  `gorm:"type:text" json:"spec_violation"`                                   //不符合接口规范(OpenAPI)的明细，多条以换行分隔
+	MASK_HITS            string  `gorm:"type:text" json:"mask_hits"`                                        //隐私保护字段级脱敏命中明细(规则 ×次数)，多条以换行分隔
+	UPLOAD_QUARANTINE    string  `gorm:"type:text" json:"upload_quarantine"`                                //杀毒扫描拦截的上传文件隔离记录(文件名/SHA-256/大小/病毒名)，多条以换行分隔
+	YARA_MATCH           string  `gorm:"type:text" json:"yara_match"`                                       //命中的 YARA 规则(规则集/规则名)，多条以换行分隔；仅记录动作的规则集命中也记在这里
+	WS_SUMMARY           string  `gorm:"type:text" json:"ws_summary"`                                       //WebSocket 检测的连接摘要(上下行消息数/字节数/时长/关闭原因/命中明细)，连接结束时记录
+	GRPC_SERVICE         string  `gorm:"size:255" json:"grpc_service"`                                      //gRPC 请求的服务全名，如 pkg.UserService
+	GRPC_METHOD          string  `gorm:"size:255" json:"grpc_method"`                                       //gRPC 请求的方法名，如 GetUser
+	GRPC_SKIP            string  `gorm:"size:255" json:"grpc_skip"`                                         //开启 gRPC 检测但首条消息未能检测的原因，如 等待首条消息超时
+	GRAPHQL_OPERATION    string  `gorm:"size:255" json:"graphql_operation"`                                 //GraphQL 操作名，批量请求多个以逗号分隔，匿名操作不记
+	GRAPHQL_COST         int64   `json:"graphql_cost"`                                                      //GraphQL 查询估算的复杂度，批量请求为各项之和
 
 	// GeoUnresolved 本次请求的地区无法判定（没有可用的地区库，或查询失败），
 	// 区别于"查出来是未知"。为 true 时规则引擎会跳过引用了 COUNTRY/PROVINCE/CITY 的规则，
 	// 避免 `MF.COUNTRY != "中国"` 这类规则在 IPv6 地区库缺失时把访客整片误杀。
 	// 仅运行期使用，不落库、不出接口。
 	GeoUnresolved bool `gorm:"-" json:"-"`
+
+	// ReqArgs 按结构拆出的请求参数，首个需要它的检测项解析一次后缓存在这里。仅运行期使用。
+	ReqArgs []ReqArg `gorm:"-" json:"-"`
+	// CacheRevalidate web 缓存条目已过期、回源时由加载阶段挂在这里，响应阶段据此把源站的 304
+	// 还原成缓存里的完整响应，或在回源失败时返回旧内容(stale-if-error)。仅运行期使用。
+	CacheRevalidate *WebCacheRevalidate `gorm:"-" json:"-"`
+	// CacheFlightKey 缓存未命中时本请求代表同一缓存键的并发请求回源，结束时据此唤醒等待者。仅运行期使用。
+	CacheFlightKey string `gorm:"-" json:"-"`
+	// CacheBackground 为 true 表示是 stale-while-revalidate 的后台刷新请求，不是访客流量，不记访问日志。
+	CacheBackground bool `gorm:"-" json:"-"`
+	// LoginAttempt 命中登录防护端点的请求由检测阶段挂在这里，响应阶段据此判定登录成败并计数。仅运行期使用。
+	LoginAttempt *LoginAttempt `gorm:"-" json:"-"`
+	// AccessUser 通过统一访问认证的账号名，响应阶段按它做隐私保护豁免。仅运行期使用。
+	AccessUser string `gorm:"-" json:"-"`
+	// WsInspect 站点开启了 WebSocket 消息检测的升级请求，握手日志推迟到连接结束时连同会话摘要一起记录。仅运行期使用。
+	WsInspect bool `gorm:"-" json:"-"`
+	// GrpcContentType gRPC/gRPC-Web 请求的原始 Content-Type，转换成 gRPC 转发后拦截/出错响应仍按它回给客户端。仅运行期使用。
+	GrpcContentType string `gorm:"-" json:"-"`
+	// GrpcWebTranslated gRPC-Web 请求已转成 gRPC 发给后端，响应需要转回 gRPC-Web。仅运行期使用。
+	GrpcWebTranslated bool `gorm:"-" json:"-"`
+	// GraphQLViolation GraphQL 防护检查不通过的类型与明细(类型:明细)，由检测阶段据此拦截。仅运行期使用。
+	GraphQLViolation string `gorm:"-" json:"-"`
 }
 
 // GetHeaderValue 从HEADER字段中提取指定header的值
@@ -195,3 +228,24 @@ type WAFLog struct {
 	CREATE_TIME string `json:"create_time"`
 	USER_CODE   string `json:"user_code"`
 }
+
+// WebCacheRevalidate 过期缓存回源时随请求带到响应阶段的信息
+type WebCacheRevalidate struct {
+	Key               string //缓存条目的存储键
+	Entry             []byte //过期的缓存条目（完整响应）
+	Conditional       bool   //回源带了缓存条目的 ETag/Last-Modified
+	IfNoneMatch       string //客户端原本的条件请求头，回源时被换成了缓存条目的校验值
+	IfModifiedSince   string
+	StaleIfErrorUntil int64 //回源失败时可以返回旧内容的截止时间(unix)
+	Background        bool  //后台刷新(stale-while-revalidate)，旧内容已经返回给访客
+	HostCode          string
+}
+
+// LoginAttempt 一次登录尝试，检测阶段记录、响应阶段判定
+type LoginAttempt struct {
+	HostCode string
+	Endpoint int    //命中的登录端点下标
+	Username string //已转小写并去空白，取不到时为空
+	ClientIP string
+	Subnet   string //IPv4 /24、IPv6 /64
+}
@@ -13,6 +13,8 @@ type IPAllowList struct {
 	// 存量行为空串，等同于 ip，判定处一律只判 == IPEntryTypeGroup。
 	IpType    string `gorm:"size:20" json:"ip_type"`
 	GroupCode string `gorm:"size:64" json:"group_code"` //IpType=group 时指向 ip_group.group_code
+	// ExpireTime 到期时间(unix秒)，0 表示永久。到期后不再参与匹配，并由定时任务清理
+	ExpireTime int64 `json:"expire_time"`
 }
 type URLAllowList struct {
 	baseorm.BaseOrm
@@ -1,6 +1,12 @@
 package model
 
-import "SamWaf/model/baseorm"
+import (
+	"SamWaf/model/baseorm"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 /**
 
@@ -20,5 +26,123 @@ type AntiCC struct {
 	IsEnableRule  bool   `json:"is_enable_rule" gorm:"column:is_enable_rule"`       //是否启动规则
 	RuleContent   string `json:"rule_content" gorm:"column:rule_content;type:text"` //规则内容
 	SkipGlobalCC  bool   `json:"skip_global_cc" gorm:"column:skip_global_cc"`       //命中局部CC规则后跳过全局CC检测
+	Action        string `json:"action" gorm:"column:action;size:20"`               //超限动作: "block" 封禁(默认) 或 "challenge" 浏览器挑战
+	Escalation    string `json:"escalation" gorm:"column:escalation;type:text"`     //逐级处置配置(JSON)，开启后取代超限动作
+	LimitKey      string `json:"limit_key" gorm:"column:limit_key;size:500"`        //限流键，空=按IP限流(每个网站一条)；非空时按键限流(每个网站可多条)
 	Remarks       string `gorm:"size:500" json:"remarks"`                           //备注
 }
+
+// CC 超限动作
+const (
+	CCActionBlock     = "block"     //封禁IP（默认）
+	CCActionChallenge = "challenge" //不封禁，要求通过浏览器挑战/验证码，通过后放行
+)
+
+// 逐级处置的减速方式
+const (
+	CCSlowModeTarpit   = "tarpit"   //延迟应答
+	CCSlowModeThrottle = "throttle" //限制响应带宽
+)
+
+// CCEscalationConfig CC 逐级处置：同一IP第一次超限出挑战，反复超限减速，持续超限才封禁
+type CCEscalationConfig struct {
+	IsEnable       int    `json:"is_enable"`       //是否开启 1开启 0关闭
+	ChallengeTimes int    `json:"challenge_times"` //前几次超限用挑战处置
+	SlowTimes      int    `json:"slow_times"`      //挑战之后再有几次超限用减速处置，之后封禁
+	SlowMode       string `json:"slow_mode"`       //减速方式 tarpit 或 throttle
+	TarpitMs       int    `json:"tarpit_ms"`       //tarpit 每个请求延迟的毫秒数
+	ThrottleKbps   int    `json:"throttle_kbps"`   //throttle 响应带宽上限(KB/s)
+	StrikeSeconds  int    `json:"strike_seconds"`  //同一IP在这段时间内的连续超限只算一次
+	ResetMinutes   int    `json:"reset_minutes"`   //多久没有再超限就回到第一级
+}
+
+// ParseCCEscalationConfig 解析逐级处置配置，空串或解析失败时返回默认值(关闭)
+func ParseCCEscalationConfig(escalationJSON string) CCEscalationConfig {
+	config := CCEscalationConfig{
+		IsEnable:       0,
+		ChallengeTimes: 1,
+		SlowTimes:      2,
+		SlowMode:       CCSlowModeTarpit,
+		TarpitMs:       3000,
+		ThrottleKbps:   32,
+		StrikeSeconds:  10,
+		ResetMinutes:   30,
+	}
+	if escalationJSON != "" {
+		if err := json.Unmarshal([]byte(escalationJSON), &config); err != nil {
+			return config
+		}
+	}
+	return config
+}
+
+// 限流键的组成部分，多个部分用 + 连接，例如 "ip+path:/api/users/{id}"、"header:X-Api-Key"、"jwt:sub"、"ip+grpc:pkg.UserService/*"、"ip+graphql:Login"
+const (
+	CCKeyIP      = "ip"      //客户端IP(按网站的IP模式取)
+	CCKeyPath    = "path"    //请求路径；带模板时只有匹配模板的请求才参与限流，键取模板本身
+	CCKeyHeader  = "header"  //请求头
+	CCKeyCookie  = "cookie"  //Cookie
+	CCKeyQuery   = "query"   //URL 查询参数
+	CCKeyJwt     = "jwt"     //Authorization: Bearer 里 JWT 的声明(只解码不验签)
+	CCKeyGrpc    = "grpc"    //gRPC 方法(服务全名/方法名)；带模式(pkg.Svc/Method 或 pkg.Svc/*)时只有匹配的调用才参与限流，键取模式本身
+	CCKeyGraphQL = "graphql" //GraphQL 操作名(需开启站点 GraphQL 防护)；带操作名时只有包含该操作的请求才参与限流
+)
+
+// graphQLNameRegex GraphQL 名称语法
+var graphQLNameRegex = regexp.MustCompile(`^[_A-Za-z][_A-Za-z0-9]*$`)
+
+// CCKeyPart 限流键的一个组成部分
+type CCKeyPart struct {
+	Kind string //ip/path/header/cookie/query/jwt/grpc/graphql
+	Name string //header/cookie/query/jwt 的名称；path 的模板、grpc 的方法模式、graphql 的操作名，可空
+}
+
+// String 还原成配置里的写法
+func (p CCKeyPart) String() string {
+	if p.Name == "" {
+		return p.Kind
+	}
+	return p.Kind + ":" + p.Name
+}
+
+// ParseCCLimitKey 解析限流键，例如 "ip+path:/login" 或 "header:X-Api-Key+cookie:sid"
+func ParseCCLimitKey(limitKey string) ([]CCKeyPart, error) {
+	var parts []CCKeyPart
+	for _, item := range strings.Split(limitKey, "+") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("限流键 %q 有空的组成部分", limitKey)
+		}
+		kind, name, _ := strings.Cut(item, ":")
+		part := CCKeyPart{Kind: strings.ToLower(strings.TrimSpace(kind)), Name: strings.TrimSpace(name)}
+		switch part.Kind {
+		case CCKeyIP:
+			if part.Name != "" {
+				return nil, fmt.Errorf("限流键 ip 不需要名称: %s", item)
+			}
+		case CCKeyPath:
+			if part.Name != "" && !strings.HasPrefix(part.Name, "/") {
+				return nil, fmt.Errorf("路径模板必须以 / 开头: %s", item)
+			}
+		case CCKeyGrpc:
+			if part.Name != "" {
+				service, method, found := strings.Cut(part.Name, "/")
+				if !found || service == "" || method == "" || strings.Contains(method, "/") {
+					return nil, fmt.Errorf("gRPC 方法模式应为 服务全名/方法名 或 服务全名/*: %s", item)
+				}
+			}
+		case CCKeyGraphQL:
+			if part.Name != "" && !graphQLNameRegex.MatchString(part.Name) {
+				return nil, fmt.Errorf("GraphQL 操作名只能由字母、数字、下划线组成: %s", item)
+			}
+		case CCKeyHeader, CCKeyCookie, CCKeyQuery, CCKeyJwt:
+			if part.Name == "" {
+				return nil, fmt.Errorf("限流键 %s 需要指定名称，例如 %s:xxx", part.Kind, part.Kind)
+			}
+		default:
+			return nil, fmt.Errorf("不支持的限流键: %s", item)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
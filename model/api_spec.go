@@ -0,0 +1,22 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+// 接口规范校验模式
+const (
+	ApiSpecModeLog     = "log"     //仅记录：不符合规范的请求记入日志，照常放行
+	ApiSpecModeEnforce = "enforce" //拦截：不符合规范的请求直接拦截
+)
+
+// ApiSpec 接口规范（OpenAPI 3，正向安全模型）。按网站上传，可用路径前缀限定到某个路径路由下，
+// 请求的路径、方法、参数、请求体都要符合规范才算合法。
+type ApiSpec struct {
+	baseorm.BaseOrm
+	HostCode    string `gorm:"size:64" json:"host_code"`      //网站唯一码（主要键）
+	PathPrefix  string `gorm:"size:255" json:"path_prefix"`   //作用的路径前缀，为空表示整个网站；一般与路径路由规则的前缀一致
+	StripPrefix int    `json:"strip_prefix"`                  //1 规范中的路径不含前缀（后端收到的是去掉前缀后的路径）
+	SpecContent string `gorm:"type:text" json:"spec_content"` //OpenAPI 3 文档（YAML 或 JSON）
+	Mode        string `gorm:"size:20" json:"mode"`           //log 仅记录 / enforce 拦截
+	Status      int    `json:"status"`                        //1 启用 0 停用
+	Remarks     string `gorm:"size:500" json:"remarks"`       //备注
+}
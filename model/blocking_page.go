@@ -13,6 +13,16 @@ const (
 	BlockingPageContentPriorityBackend = "backend"
 )
 
+const (
+	// 拦截页面适用的响应格式，按请求的 Accept/Content-Type 协商（见 wafenginecore/block_negotiate.go）。
+	// 空值等同 html，老数据无需回填。
+	BlockingPageContentTypeHTML = "html" //浏览器
+	BlockingPageContentTypeJSON = "json" //接口/XHR/移动端，ResponseContent 为 JSON 模版
+	BlockingPageContentTypeXML  = "xml"  //接口，ResponseContent 为 XML 模版
+	// BlockingPageContentTypeGRPC gRPC 没有响应体：ResponseCode 填 grpc-status(0-16)，ResponseContent 渲染为 grpc-message
+	BlockingPageContentTypeGRPC = "grpc"
+)
+
 // BlockingPage 自定义拦截模板界面
 type BlockingPage struct {
 	baseorm.BaseOrm
@@ -24,9 +34,34 @@ type BlockingPage struct {
 	ResponseHeader   string `gorm:"type:text" json:"response_header"`   //响应Header头信息（JSON）
 	ResponseContent  string `gorm:"type:text" json:"response_content"`  //响应内容
 	ContentPriority  string `gorm:"size:20" json:"content_priority"`    //内容优先级 samwaf=优先自定义模版(默认,空值等同) backend=优先后端响应
+	ContentType      string `gorm:"size:20" json:"content_type"`        //适用的响应格式 html(默认,空值等同)/json/xml/grpc
 }
 
 // IsBackendContentFirst 是否为「优先后端响应」模式（空值按默认的 samwaf 处理，保证老数据行为不变）
 func (b *BlockingPage) IsBackendContentFirst() bool {
 	return b.ContentPriority == BlockingPageContentPriorityBackend
 }
+
+// NormalizedContentType 适用的响应格式，空值与未知取值按 html 处理
+func (b *BlockingPage) NormalizedContentType() string {
+	return NormalizeBlockingPageContentType(b.ContentType)
+}
+
+// NormalizeBlockingPageContentType 归一化响应格式：只接受白名单取值，其余一律按 html 处理
+func NormalizeBlockingPageContentType(v string) string {
+	switch v {
+	case BlockingPageContentTypeJSON, BlockingPageContentTypeXML, BlockingPageContentTypeGRPC:
+		return v
+	}
+	return BlockingPageContentTypeHTML
+}
+
+// BlockingPageKey 站点内存里拦截页面 map 的键。html 页面沿用响应码本身（与历史键一致），
+// 其他格式追加 "@格式"，例如 "403@json"，同一响应码可以按格式各配一份。
+func BlockingPageKey(responseCode string, contentType string) string {
+	contentType = NormalizeBlockingPageContentType(contentType)
+	if contentType == BlockingPageContentTypeHTML {
+		return responseCode
+	}
+	return responseCode + "@" + contentType
+}
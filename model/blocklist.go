@@ -13,6 +13,8 @@ type IPBlockList struct {
 	// 存量行为空串，等同于 ip，判定处一律只判 == IPEntryTypeGroup。
 	IpType    string `gorm:"size:20" json:"ip_type"`
 	GroupCode string `gorm:"size:64" json:"group_code"` //IpType=group 时指向 ip_group.group_code
+	// ExpireTime 到期时间(unix秒)，0 表示永久。到期后不再参与匹配，并由定时任务清理
+	ExpireTime int64 `json:"expire_time"`
 }
 
 type URLBlockList struct {
@@ -21,4 +23,23 @@ type URLBlockList struct {
 	CompareType string `gorm:"size:50" json:"compare_type" form:"compare_type"` //对比方式
 	Url         string `gorm:"type:text" json:"url"`                            //限制请求地址
 	Remarks     string `gorm:"size:500" json:"remarks"`                         //备注
+	ExpireTime  int64  `json:"expire_time"`                                     //到期时间(unix秒)，0 表示永久
+}
+
+// ListEntryExpired 名单条目（IP/URL 黑白名单、IP组条目）在 now(unix秒) 时是否已到期。
+// expireTime 为 0 表示永久，永不到期。
+func ListEntryExpired(expireTime int64, now int64) bool {
+	return expireTime > 0 && expireTime <= now
+}
+
+// ResolveListExpireTime 把接口里"封禁 N 小时"换算成到期时间(unix秒)。
+// hours > 0 时以 now 起算，优先于直接传入的 expireTime；都不传为永久。
+func ResolveListExpireTime(hours int, expireTime int64, now int64) int64 {
+	if hours > 0 {
+		return now + int64(hours)*3600
+	}
+	if expireTime < 0 {
+		return 0
+	}
+	return expireTime
 }
@@ -13,5 +13,12 @@ type CacheRule struct {
 	CacheTime     int    `json:"cache_time" gorm:"column:cache_time"`                 // 缓存时间(秒)：0-不缓存
 	Priority      int    `json:"priority" gorm:"column:priority"`                     // 优先级：数字越大优先级越高
 	RequestMethod string `json:"request_method" gorm:"column:request_method;size:20"` // 请求方式：GET;HEAD;POST等，多个用分号分隔
-	Remarks       string `json:"remarks" gorm:"column:remarks;size:500"`              // 备注
+	// 默认遵守源站响应指令：Cache-Control 的 no-store/private/no-cache/max-age/s-maxage、Expires，
+	// 以及带 Authorization 的请求只缓存明确允许共享的响应。置 1 时忽略这些指令，一律按 CacheTime 缓存
+	OverrideOrigin int `json:"override_origin" gorm:"column:override_origin"`   // 忽略源站缓存指令：1-忽略 0-遵守
+	CacheSetCookie int `json:"cache_set_cookie" gorm:"column:cache_set_cookie"` // 带 Set-Cookie 的响应：1-去掉 Set-Cookie 后缓存 0-不缓存
+	// 过期后的宽限期(秒)，源站 Cache-Control 里的 stale-while-revalidate/stale-if-error 优先（忽略源站指令时只看这里）
+	StaleWhileRevalidate int    `json:"stale_while_revalidate" gorm:"column:stale_while_revalidate"` // 过期后先返回旧内容、后台回源刷新
+	StaleIfError         int    `json:"stale_if_error" gorm:"column:stale_if_error"`                 // 回源失败或源站 5xx 时返回旧内容
+	Remarks              string `json:"remarks" gorm:"column:remarks;size:500"`                      // 备注
 }
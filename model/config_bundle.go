@@ -0,0 +1,53 @@
+package model
+
+// 配置即代码：把网站及其下属配置导出成可以进 git 的 YAML/JSON，再在另一套环境里 plan/apply。
+// 所有条目都用稳定的业务键（网站 code、规则 rule_code、名单的 ip/url 等）定位，不带数据库 ID，
+// 同一份文件反复 apply 结果不变。敏感字段不落文件，以 ${private:密钥key} 的形式引用密钥管理(PrivateInfo)。
+
+const (
+	ConfigBundleApiVersion = "samwaf.config/v1"
+
+	ConfigBundleScopeHost   = "host"   //单个网站
+	ConfigBundleScopeTenant = "tenant" //全部网站
+
+	ConfigBundleActionCreate = "create"
+	ConfigBundleActionUpdate = "update"
+	ConfigBundleActionDelete = "delete"
+	ConfigBundleActionError  = "error" //无法执行（如引用的密钥/证书/IP组在目标环境不存在），存在该项时 apply 整体拒绝
+)
+
+// ConfigBundle 导出文件的顶层结构
+type ConfigBundle struct {
+	ApiVersion string             `json:"api_version" yaml:"api_version"`
+	Scope      string             `json:"scope" yaml:"scope"`
+	ExportedAt string             `json:"exported_at" yaml:"exported_at"`
+	Hosts      []ConfigBundleHost `json:"hosts" yaml:"hosts"`
+	// MissingSecrets 导出时在密钥管理里找不到对应条目的敏感字段引用，apply 前需要先在目标环境建好这些密钥
+	MissingSecrets []string `json:"missing_secrets,omitempty" yaml:"missing_secrets,omitempty"`
+}
+
+// ConfigBundleHost 一个网站的全部配置。Host 为网站本身的字段，Resources 按类型存放下属配置条目。
+type ConfigBundleHost struct {
+	Code      string                              `json:"code" yaml:"code"`
+	Host      map[string]interface{}              `json:"host" yaml:"host"`
+	Resources map[string][]map[string]interface{} `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// ConfigBundlePlanItem 计划中的一项变更
+type ConfigBundlePlanItem struct {
+	HostCode string   `json:"host_code"`
+	Kind     string   `json:"kind"` //host 或下属配置类型，如 rules/ip_block
+	Key      string   `json:"key"`  //业务键
+	Action   string   `json:"action"`
+	Fields   []string `json:"fields,omitempty"` //update 时变化的字段
+	Message  string   `json:"message,omitempty"`
+}
+
+// ConfigBundlePlan plan/apply 的结果
+type ConfigBundlePlan struct {
+	Items  []ConfigBundlePlanItem `json:"items"`
+	Create int                    `json:"create"`
+	Update int                    `json:"update"`
+	Delete int                    `json:"delete"`
+	Errors int                    `json:"errors"`
+}
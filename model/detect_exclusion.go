@@ -0,0 +1,32 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+// 误报排除可作用的内置检测（与自定义规则 Allow 可跳过的模块同名）
+const (
+	DetectExclusionSQLI = "SQLI"
+	DetectExclusionXSS  = "XSS"
+	DetectExclusionRCE  = "RCE"
+	DetectExclusionDIR  = "DIR"
+	DetectExclusionSSRF = "SSRF"
+	DetectExclusionAll  = "ALL"
+)
+
+// DetectExclusion 内置检测误报排除：在指定路径上，指定检测不再看某个参数，其余参数照常检测。
+// 比 URL 白名单（整条请求放行）和关闭整站检测的粒度都细。
+// HostCode 为全局网站时对所有网站生效。
+type DetectExclusion struct {
+	baseorm.BaseOrm
+	HostCode    string `gorm:"size:64" json:"host_code"`    //网站唯一码（主要键）
+	CompareType string `gorm:"size:50" json:"compare_type"` //路径判断类型：等于、前缀匹配、后缀匹配、包含匹配；为空表示不限路径
+	Path        string `gorm:"size:500" json:"path"`        //请求路径（不含查询串）
+	ArgSource   string `gorm:"size:20" json:"arg_source"`   //参数来源 query/form/json/xml/multipart/graphql/cookie/header/body，为空表示任意来源
+	ArgName     string `gorm:"size:255" json:"arg_name"`    //参数名或 JSON 路径（如 content、post.body、items[*].html），* 匹配任意字符；为空表示该路径下全部参数
+	Detector    string `gorm:"size:20" json:"detector"`     //SQLI/XSS/RCE/DIR/SSRF/ALL
+	Remarks     string `gorm:"size:500" json:"remarks"`     //备注
+}
+
+// DetectExclusionDetectors 可选的检测项
+func DetectExclusionDetectors() []string {
+	return []string{DetectExclusionSQLI, DetectExclusionXSS, DetectExclusionRCE, DetectExclusionDIR, DetectExclusionSSRF, DetectExclusionAll}
+}
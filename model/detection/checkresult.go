@@ -1,5 +1,7 @@
 package detection
 
+import "time"
+
 /*
 *
 检测结果
@@ -26,6 +28,15 @@ type Result struct {
 	*/
 	IsLogOnly bool
 	/**
+	挑战：没有通过浏览器挑战/验证码的访客先出示挑战页，已通过的放行
+	*/
+	IsChallenge bool
+	/**
+	减速：不拦截，先延迟 SlowDelay 再放行；ThrottleKbps 大于0时限制本次响应带宽(KB/s)
+	*/
+	SlowDelay    time.Duration
+	ThrottleKbps int
+	/**
 	自定义规则放行：不拦截，可按 SkipModules 跳过后续指定检测
 	*/
 	IsRuleAllow bool
@@ -33,4 +44,8 @@ type Result struct {
 	放行时要跳过的检测模块（大写模块名，含 "ALL" 表示跳过全部）
 	*/
 	SkipModules []string
+	/**
+	拦截时下发的 Retry-After 秒数（429 限流类拦截用），0 不下发
+	*/
+	RetryAfter int
 }
@@ -0,0 +1,16 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+// GrpcDescriptorSet gRPC 描述文件（全局），protoc --descriptor_set_out --include_imports 生成的 FileDescriptorSet。
+// 开启 gRPC 检测的网站按请求路径(/包名.服务/方法)找到入参的消息定义，把 protobuf 解成带字段名的 JSON 再检测；
+// 没有对应描述时按字段编号解码。增删后实时生效，无需重启
+type GrpcDescriptorSet struct {
+	baseorm.BaseOrm
+	Name        string `gorm:"size:100" json:"name"`      //描述文件名称
+	Content     []byte `json:"-"`                         //FileDescriptorSet 二进制内容
+	Services    string `gorm:"type:text" json:"services"` //包含的服务全名，逗号分隔，上传时解析得出
+	MethodCount int    `json:"method_count"`              //方法数，上传时解析得出
+	Status      int    `json:"status"`                    //1 启用 0 停用
+	Remarks     string `gorm:"size:500" json:"remarks"`   //备注
+}
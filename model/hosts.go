@@ -3,6 +3,7 @@ package model
 import (
 	"SamWaf/model/baseorm"
 	"encoding/json"
+	"strings"
 )
 
 type Hosts struct {
@@ -53,6 +54,13 @@ type Hosts struct {
 	CsrfJSON                  string `gorm:"type:text" json:"csrf_json"`                    //CSRF防护配置 json（Origin/Referer 强校验）
 	TamperJSON                string `gorm:"type:text" json:"tamper_json"`                  //网页防篡改配置 json（响应基线比对）
 	UploadSecurityJSON        string `gorm:"type:text" json:"upload_security_json"`         //文件上传内容检测配置 json（扩展名/Webshell/类型/大小）
+	LoginProtectJSON          string `gorm:"type:text" json:"login_protect_json"`           //登录接口防撞库配置 json（登录端点/失败信号/阈值）
+	SpiderPolicyJSON          string `gorm:"type:text" json:"spider_policy_json"`           //爬虫策略配置 json（按爬虫类别放行/拦截/限速）
+	WebSocketJSON             string `gorm:"type:text" json:"websocket_json"`               //WebSocket 消息检测配置 json（帧大小/消息频率/内容检测）
+	GrpcJSON                  string `gorm:"type:text" json:"grpc_json"`                    //gRPC 检测配置 json（消息解码/gRPC-Web 转换）
+	GraphQLJSON               string `gorm:"type:text" json:"graphql_json"`                 //GraphQL 防护配置 json（深度/别名/批量/复杂度/自省/持久化查询白名单）
+	ProtocolJSON              string `gorm:"type:text" json:"protocol_json"`                //协议合规检测配置 json（头部数量/大小、URI长度、参数个数上限，拦截或归一）
+	SsrfJSON                  string `gorm:"type:text" json:"ssrf_json"`                    //SSRF 与开放重定向检测配置 json（放行的内网地址、允许跳转的外部域名）
 	IPMode                    string `gorm:"size:20" json:"ip_mode"`                        //IP提取模式: "nic" 网卡模式 或 "proxy" 代理模式
 	DisableHTTP2             int    `json:"disable_http2"`              //对外HTTP/2开关 0启用(默认/现状) 1关闭(该站点ALPN只提供http/1.1,兼容安卓等原生WebSocket客户端)
 	IsEnableResponseBuffering int    `json:"is_enable_response_buffering"` //响应缓冲 1开启(默认) 0关闭(类似 nginx proxy_buffering off，边收边推，利于流式/SSE/大文件)
@@ -75,6 +83,9 @@ type HostsDefense struct {
 	DEFENSE_DIR_TRAVERSAL int `json:"traversal"` //目录穿越检测
 	DEFENSE_OWASP_SET     int `json:"owaspset"`  //OWASP集检测
 	DEFENSE_AI            int `json:"ai"`        //AI智能检测（默认关闭，需先上传模型包并开启全局AI开关）
+	DEFENSE_PROTOCOL      int `json:"protocol"`  //协议合规检测（默认关闭，请求走私、畸形头部、超长请求，开启后在白名单之前执行）
+	DEFENSE_SSRF          int `json:"ssrf"`         //SSRF检测（默认关闭，参数里指向内网、云元数据、危险协议的地址）
+	DEFENSE_OPEN_REDIRECT int `json:"openredirect"` //开放重定向检测（默认关闭，跳转目标来自请求参数且不在允许域名内时拦截响应）
 }
 
 // HealthyConfig 健康度检测
@@ -95,7 +106,7 @@ type CaptchaConfig struct {
 	ExcludeURLs     string `json:"exclude_urls"`      // 排除验证码的URL列表
 	ExpireTime      int    `json:"expire_time"`       // 验证通过后的有效期(小时)
 	IPMode          string `json:"ip_mode"`           // IP提取模式: "nic" 网卡模式 或 "proxy" 代理模式
-	EngineType      string `json:"engine_type"`       // 验证码引擎类型: 传统方式 "traditional",capJS工作量证明 "capJs"
+	EngineType      string `json:"engine_type"`       // 验证码引擎类型: 传统方式 "traditional",capJS工作量证明 "capJs",无交互浏览器挑战 "jschallenge"
 	PathPrefix      string `json:"path_prefix"`       // 验证码路径前缀，用于隐藏系统特征，默认为随机生成
 	CapJsConfig     struct {
 		ChallengeCount      int `json:"challengeCount,omitempty"`      // Number of challenges to generate (default: 50)
@@ -111,6 +122,9 @@ type CaptchaConfig struct {
 			Zh string `json:"zh,omitempty"` // Chinese text
 		} `json:"infoText,omitempty"` // Multi-language info text
 	} `json:"cap_js_config"`
+	JsChallengeConfig struct {
+		BindMode string `json:"bind_mode,omitempty"` // 通过凭证绑定方式: "ip" 绑定IP(默认) 或 "fingerprint" 绑定浏览器特征，适合出口IP经常变化的访客
+	} `json:"js_challenge_config"`
 }
 
 // ParseCaptchaConfig 解析验证码配置
@@ -123,6 +137,7 @@ func ParseCaptchaConfig(captchaJSON string) CaptchaConfig {
 	config.ExpireTime = 24
 	config.IPMode = "nic"             // 默认使用网卡模式
 	config.EngineType = "traditional" // 默认使用传统方式
+	config.JsChallengeConfig.BindMode = "ip"
 
 	// 初始化CapJsConfig默认值
 	config.CapJsConfig.ChallengeCount = 50     // 默认生成50个挑战
@@ -296,6 +311,17 @@ type UploadSecurityConfig struct {
 	OverLimitAction string `json:"over_limit_action"` // 请求体超过检测上限时：block(默认,fail-closed防绕过)/pass(放行不检测)
 	IncludePaths    string `json:"include_paths"`     // 只检测这些路径前缀，换行分隔；空=所有路径
 	ExcludePaths    string `json:"exclude_paths"`     // 跳过这些路径前缀，换行分隔；优先于 include
+	// 杀毒扫描：每个上传文件完整送 clamd(INSTREAM) 或 ICAP(REQMOD) 扫描，放在其余检测之后
+	AVScan       int    `json:"av_scan"`        // 1 启用杀毒扫描
+	AVEngine     string `json:"av_engine"`      // clamd(默认)/icap
+	AVAddress    string `json:"av_address"`     // clamd: 127.0.0.1:3310 或 unix:/var/run/clamav/clamd.ctl；icap: icap://127.0.0.1:1344/avscan
+	AVTimeoutMs  int    `json:"av_timeout_ms"`  // 单次请求内所有文件扫描的总超时毫秒，默认5000
+	AVMaxSizeKB  int    `json:"av_max_size_kb"` // 送扫文件大小上限KB，默认10240；超出的文件不送扫，按 av_fail_action 处理
+	AVFailAction string `json:"av_fail_action"` // 扫描失败/超时/超上限时：pass(默认,fail-open)/block(fail-closed)
+	// YARA 规则检测：规则集在「YARA 规则」里全局维护，这里只决定本网站是否使用
+	YaraScan      int `json:"yara_scan"`        // 1 上传文件用 YARA 规则扫描
+	YaraBodyScan  int `json:"yara_body_scan"`   // 1 非 multipart 的请求体(PUT 原始文件、JSON 里的 base64 文档等)也扫描
+	YaraBodyMinKB int `json:"yara_body_min_kb"` // 请求体达到该大小才扫描，默认64；小请求体由 SQLi/XSS 等检测覆盖。超过 max_size_kb 的只扫前 max_size_kb
 }
 
 // DefaultUploadExtBlacklist 默认危险扩展名黑名单
@@ -320,6 +346,297 @@ func ParseUploadSecurityConfig(jsonStr string) UploadSecurityConfig {
 	if c.MaxSizeKB <= 0 {
 		c.MaxSizeKB = 10240
 	}
+	if c.AVEngine == "" {
+		c.AVEngine = "clamd"
+	}
+	if c.AVTimeoutMs <= 0 {
+		c.AVTimeoutMs = 5000
+	}
+	if c.AVMaxSizeKB <= 0 {
+		c.AVMaxSizeKB = 10240
+	}
+	if c.AVFailAction == "" {
+		c.AVFailAction = "pass"
+	}
+	if c.YaraBodyMinKB <= 0 {
+		c.YaraBodyMinKB = 64
+	}
+	return c
+}
+
+// 登录防护触发阈值后的动作
+const (
+	LoginProtectActionChallenge = "challenge" //出验证码/浏览器挑战(默认)
+	LoginProtectActionBlock     = "block"     //直接拦截
+)
+
+// LoginEndpoint 受保护的登录端点；失败信号(状态码/跳转/正文标记)任一命中即算一次失败，都没配置时 401/403 算失败
+type LoginEndpoint struct {
+	Path          string `json:"path"`           // 登录路径，忽略大小写、末尾斜杠与 ;参数后匹配
+	Method        string `json:"method"`         // 请求方法，默认 POST
+	UsernameField string `json:"username_field"` // 用户名字段：表单/查询参数名，JSON 正文支持 a.b 点路径
+	FailStatus    string `json:"fail_status"`    // 失败状态码，逗号分隔，如 "401,403"
+	FailRedirect  string `json:"fail_redirect"`  // 失败时跳转地址包含的内容，如 "/login?error"
+	FailBodyMark  string `json:"fail_body_mark"` // 失败时响应正文包含的内容，如 "密码错误"
+}
+
+// LoginProtectConfig 登录接口防撞库/账号接管配置：按IP、用户名、IP网段统计登录失败
+type LoginProtectConfig struct {
+	IsEnable       int             `json:"is_enable"`        // 1 开启 0 关闭（默认0）
+	Endpoints      []LoginEndpoint `json:"endpoints"`        // 登录端点
+	WindowMinutes  int             `json:"window_minutes"`   // 统计窗口(分钟)，默认 10
+	IPLimit        int             `json:"ip_limit"`         // 单个IP失败次数上限，默认 10
+	UserLimit      int             `json:"user_limit"`       // 单个用户名失败次数上限(不论来自多少IP)，默认 5
+	SubnetLimit    int             `json:"subnet_limit"`     // 单个网段(IPv4 /24、IPv6 /64)失败次数上限，默认 30
+	UserIPsLimit   int             `json:"user_ips_limit"`   // 同一用户名的失败来自多少个不同IP(分布式爆破)，默认 5
+	IPUsersLimit   int             `json:"ip_users_limit"`   // 同一IP的失败涉及多少个不同用户名(撞库)，默认 5
+	Action         string          `json:"action"`           // 达到上限后的动作 challenge / block
+	RiskHeader     string          `json:"risk_header"`      // 转发给源站的风险分请求头(0-100)，空则不加
+	ClearOnSuccess int             `json:"clear_on_success"` // 登录成功后清除该用户名的失败计数 1是(默认) 0否
+}
+
+// ParseLoginProtectConfig 解析登录防护配置；空 JSON 给默认值（默认关闭）
+func ParseLoginProtectConfig(jsonStr string) LoginProtectConfig {
+	c := LoginProtectConfig{
+		IsEnable:       0,
+		WindowMinutes:  10,
+		IPLimit:        10,
+		UserLimit:      5,
+		SubnetLimit:    30,
+		UserIPsLimit:   5,
+		IPUsersLimit:   5,
+		Action:         LoginProtectActionChallenge,
+		RiskHeader:     "X-SamWaf-Login-Risk",
+		ClearOnSuccess: 1,
+	}
+	if jsonStr == "" {
+		return c
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+		return LoginProtectConfig{IsEnable: 0}
+	}
+	if c.WindowMinutes <= 0 {
+		c.WindowMinutes = 10
+	}
+	for i := range c.Endpoints {
+		if c.Endpoints[i].Method == "" {
+			c.Endpoints[i].Method = "POST"
+		}
+	}
+	return c
+}
+
+// 爬虫策略动作
+const (
+	SpiderPolicyAllow = "allow" //放行(默认)
+	SpiderPolicyDeny  = "deny"  //拦截
+	SpiderPolicyLimit = "limit" //限速
+)
+
+// SpiderPolicyConfig 爬虫策略：只作用于核验通过(或只能按 UA 识别)的爬虫，伪装爬虫仍按系统的爬虫拦截开关处理。
+// 拦截默认返回 403(攻击类型 crawler_policy)，限速超限与 deny_status=429 返回 429 并带 Retry-After(攻击类型 crawler_throttle)，
+// 两种攻击类型都可以在拦截页面里配置自定义页面。
+type SpiderPolicyConfig struct {
+	IsEnable           int               `json:"is_enable"`            // 1 开启 0 关闭（默认0）
+	Categories         map[string]string `json:"categories"`           // 爬虫类别 -> allow/deny/limit，未配置的类别放行
+	LimitPerMinute     int               `json:"limit_per_minute"`     // limit 动作下每个爬虫每分钟最多请求数，默认 60
+	DenyStatus         int               `json:"deny_status"`          // deny 动作的响应码 403(默认)/429
+	RetryAfter         int               `json:"retry_after"`          // 429 响应的 Retry-After 秒数，默认 60
+	EnforceRobots      int               `json:"enforce_robots"`       // 1 按源站 robots.txt 的 Disallow 拦截放行类别的爬虫（默认0）
+	RobotsCacheMinutes int               `json:"robots_cache_minutes"` // 源站 robots.txt 缓存分钟数，默认 1440
+}
+
+// ParseSpiderPolicyConfig 解析爬虫策略配置；空 JSON 给默认值（默认关闭）
+func ParseSpiderPolicyConfig(jsonStr string) SpiderPolicyConfig {
+	c := SpiderPolicyConfig{IsEnable: 0, LimitPerMinute: 60, DenyStatus: 403, RetryAfter: 60, RobotsCacheMinutes: 1440}
+	if jsonStr == "" {
+		return c
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+		return SpiderPolicyConfig{IsEnable: 0}
+	}
+	if c.LimitPerMinute <= 0 {
+		c.LimitPerMinute = 60
+	}
+	if c.DenyStatus != 429 {
+		c.DenyStatus = 403
+	}
+	if c.RetryAfter <= 0 {
+		c.RetryAfter = 60
+	}
+	if c.RobotsCacheMinutes <= 0 {
+		c.RobotsCacheMinutes = 1440
+	}
+	return c
+}
+
+// WebSocketConfig WebSocket 消息检测配置。开启后升级成功的连接逐帧解析，文本消息按站点防御开关走
+// SQL注入/XSS/敏感词检测及引用了 MF.BODY 的自定义规则；握手时会去掉压缩扩展，保证帧内容可检测
+type WebSocketConfig struct {
+	IsEnable      int    `json:"is_enable"`        // 1 开启 0 关闭（默认0）
+	MaxFrameKB    int    `json:"max_frame_kb"`     // 单帧/单条消息(分片重组后)上限，超过以 1009 关闭，默认 1024
+	MaxMsgsPerSec int    `json:"max_msgs_per_sec"` // 每条连接客户端每秒最多发送的消息数，超过以 1008 关闭，0 不限，默认 50
+	InspectServer int    `json:"inspect_server"`   // 1 后端下发的文本消息也检测（默认1）
+	Action        string `json:"action"`           // 内容检测命中后的动作：block 关闭连接(默认，1008)/log 只记录
+}
+
+// ParseWebSocketConfig 解析 WebSocket 消息检测配置；空 JSON 给默认值（默认关闭）
+func ParseWebSocketConfig(jsonStr string) WebSocketConfig {
+	c := WebSocketConfig{IsEnable: 0, MaxFrameKB: 1024, MaxMsgsPerSec: 50, InspectServer: 1, Action: "block"}
+	if jsonStr == "" {
+		return c
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+		return WebSocketConfig{IsEnable: 0}
+	}
+	if c.MaxFrameKB <= 0 {
+		c.MaxFrameKB = 1024
+	}
+	if c.MaxMsgsPerSec < 0 {
+		c.MaxMsgsPerSec = 0
+	}
+	if c.Action != "log" {
+		c.Action = "block"
+	}
+	return c
+}
+
+// GrpcConfig gRPC 检测配置。服务名/方法名对所有 gRPC 请求都会记入日志供规则和 CC 使用；
+// 开启后再解出请求的首条消息(有上传的描述文件时按 protobuf 定义解成 JSON)交给内置检测和自定义规则
+type GrpcConfig struct {
+	IsEnable       int    `json:"is_enable"`         // 1 开启 0 关闭（默认0）
+	MaxMessageKB   int    `json:"max_message_kb"`    // 参与检测的单条消息上限，超过不解码，默认 1024
+	FirstMsgWaitMs int    `json:"first_msg_wait_ms"` // 等待客户端首条消息的时长，超时不检测直接转发(双向流先等服务端发言的场景)，默认 1000
+	WebTranslate   int    `json:"web_translate"`     // 1 把 gRPC-Web(含 -text) 请求转成 gRPC 发给后端，响应再转回 gRPC-Web
+	WebCorsOrigins string `json:"web_cors_origins"`  // gRPC-Web 允许的跨域来源，逗号分隔，* 表示任意；空不处理跨域
+	SkipAction     string `json:"skip_action"`       // 首条消息无法检测(等待超时/超过上限/压缩算法不支持/解码失败)时：pass(默认,照常转发)/block(fail-closed)
+}
+
+// ParseGrpcConfig 解析 gRPC 检测配置；空 JSON 给默认值（默认关闭）
+func ParseGrpcConfig(jsonStr string) GrpcConfig {
+	c := GrpcConfig{IsEnable: 0, MaxMessageKB: 1024, FirstMsgWaitMs: 1000, SkipAction: "pass"}
+	if jsonStr == "" {
+		return c
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+		return GrpcConfig{IsEnable: 0, MaxMessageKB: 1024, FirstMsgWaitMs: 1000, SkipAction: "pass"}
+	}
+	if c.MaxMessageKB <= 0 {
+		c.MaxMessageKB = 1024
+	}
+	if c.FirstMsgWaitMs <= 0 {
+		c.FirstMsgWaitMs = 1000
+	}
+	if c.SkipAction != "block" {
+		c.SkipAction = "pass"
+	}
+	return c
+}
+
+// GraphQLConfig GraphQL 防护配置。只检查 Paths 里列出的接口地址；
+// 操作名与复杂度对这些地址的所有请求都记入日志，供规则和 CC 按键限流使用
+type GraphQLConfig struct {
+	IsEnable             int    `json:"is_enable"`             // 1 开启 0 关闭（默认0）
+	Paths                string `json:"paths"`                 // GraphQL 接口路径，逗号分隔，默认 /graphql
+	MaxDepth             int    `json:"max_depth"`             // 最大查询深度，默认 15
+	MaxAliases           int    `json:"max_aliases"`           // 单个查询最多别名数，默认 30（别名可把同一字段在一次请求里调用很多次）
+	MaxBatch             int    `json:"max_batch"`             // 批量请求(JSON 数组)最多条数，默认 10
+	MaxCost              int64  `json:"max_cost"`              // 复杂度预算：每个字段计 1，分页参数(first/last/limit…)放大其下的子查询，默认 10000
+	DisableIntrospection int    `json:"disable_introspection"` // 1 禁止 __schema/__type 自省查询
+	PersistedOnly        int    `json:"persisted_only"`        // 1 只放行白名单里的持久化查询
+	PersistedHashes      string `json:"persisted_hashes"`      // 持久化查询白名单：查询文本的 sha256，逗号或换行分隔
+	LogOnly              int    `json:"log_only"`              // 1 只记录不拦截，上线前观察用
+}
+
+// ParseGraphQLConfig 解析 GraphQL 防护配置；空 JSON 给默认值（默认关闭），数值项为 0 时取默认值
+func ParseGraphQLConfig(jsonStr string) GraphQLConfig {
+	c := GraphQLConfig{}
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+			c = GraphQLConfig{}
+		}
+	}
+	if strings.TrimSpace(c.Paths) == "" {
+		c.Paths = "/graphql"
+	}
+	if c.MaxDepth <= 0 {
+		c.MaxDepth = 15
+	}
+	if c.MaxAliases <= 0 {
+		c.MaxAliases = 30
+	}
+	if c.MaxBatch <= 0 {
+		c.MaxBatch = 10
+	}
+	if c.MaxCost <= 0 {
+		c.MaxCost = 10000
+	}
+	return c
+}
+
+// MatchPath 请求路径是否是配置的 GraphQL 接口(忽略末尾的 /)
+func (c GraphQLConfig) MatchPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, p := range strings.Split(c.Paths, ",") {
+		if p = strings.TrimSuffix(strings.TrimSpace(p), "/"); p != "" && p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// ProtocolConfig 协议合规检测配置，总开关在 DEFENSE_JSON 的 protocol 项
+type ProtocolConfig struct {
+	Mode           string `json:"mode"`             // 协议异常的处理方式：block 拦截(默认)，normalize 归一后放行并记录；超限一律拦截
+	MaxHeaderCount int    `json:"max_header_count"` // 最多请求头个数，默认 100
+	MaxHeaderSize  int    `json:"max_header_size"`  // 请求头总字节数上限，默认 32768
+	MaxURILength   int    `json:"max_uri_length"`   // 请求地址(含查询串)最大长度，默认 8192
+	MaxArgCount    int    `json:"max_arg_count"`    // 查询串与表单参数总个数上限，默认 1000
+}
+
+// ProtocolModeNormalize 归一模式
+const ProtocolModeNormalize = "normalize"
+
+// ParseProtocolConfig 解析协议合规检测配置；空 JSON 或数值项为 0 时取默认值
+func ParseProtocolConfig(jsonStr string) ProtocolConfig {
+	c := ProtocolConfig{}
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+			c = ProtocolConfig{}
+		}
+	}
+	if c.Mode != ProtocolModeNormalize {
+		c.Mode = "block"
+	}
+	if c.MaxHeaderCount <= 0 {
+		c.MaxHeaderCount = 100
+	}
+	if c.MaxHeaderSize <= 0 {
+		c.MaxHeaderSize = 32768
+	}
+	if c.MaxURILength <= 0 {
+		c.MaxURILength = 8192
+	}
+	if c.MaxArgCount <= 0 {
+		c.MaxArgCount = 1000
+	}
+	return c
+}
+
+// SsrfConfig SSRF 与开放重定向检测配置，开关在 DEFENSE_JSON 的 ssrf / openredirect 项
+type SsrfConfig struct {
+	AllowHosts           string `json:"allow_hosts"`            // SSRF 放行的地址：域名(可用 *.example.com)、IP 或网段，换行分隔（如业务本身要回调的内网服务）
+	RedirectAllowDomains string `json:"redirect_allow_domains"` // 允许跳转的外部域名(可用 *.example.com)，换行分隔；本站域名与绑定的多域名自动允许
+}
+
+// ParseSsrfConfig 解析 SSRF 与开放重定向检测配置
+func ParseSsrfConfig(jsonStr string) SsrfConfig {
+	c := SsrfConfig{}
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &c); err != nil {
+			c = SsrfConfig{}
+		}
+	}
 	return c
 }
 
@@ -489,6 +806,9 @@ func ParseHostsDefense(defenseJSON string) HostsDefense {
 	defense.DEFENSE_DIR_TRAVERSAL = 1
 	defense.DEFENSE_OWASP_SET = 0
 	defense.DEFENSE_AI = 0
+	defense.DEFENSE_PROTOCOL = 0
+	defense.DEFENSE_SSRF = 0
+	defense.DEFENSE_OPEN_REDIRECT = 0
 
 	// 如果JSON不为空，则解析覆盖默认值
 	if defenseJSON != "" {
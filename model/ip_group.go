@@ -37,9 +37,10 @@ func (IPGroup) TableName() string {
 // (39 + '-' + 39)，64 位会被截断（SQLite 静默截断、MySQL 严格模式直接报错）。
 type IPGroupItem struct {
 	baseorm.BaseOrm
-	GroupCode string `gorm:"size:64"  json:"group_code"` //所属组短码
-	Ip        string `gorm:"size:128" json:"ip"`         //单IP / CIDR / 通配符 / 区间，语法见 wafenginecore/ipset/pattern.go
-	Remarks   string `gorm:"size:500" json:"remarks"`    //备注
+	GroupCode  string `gorm:"size:64"  json:"group_code"` //所属组短码
+	Ip         string `gorm:"size:128" json:"ip"`         //单IP / CIDR / 通配符 / 区间，语法见 wafenginecore/ipset/pattern.go
+	Remarks    string `gorm:"size:500" json:"remarks"`    //备注
+	ExpireTime int64  `json:"expire_time"`                //到期时间(unix秒)，0 表示永久
 }
 
 func (IPGroupItem) TableName() string {
@@ -2,6 +2,7 @@ package model
 
 import (
 	"SamWaf/model/baseorm"
+	"encoding/json"
 )
 
 /*
@@ -14,4 +15,54 @@ type LDPUrl struct {
 	CompareType string `gorm:"size:50" json:"compare_type"` //判断类型，包含、开始、结束、完全匹配
 	Url         string `gorm:"type:text" json:"url"`        //请求地址
 	Remarks     string `gorm:"size:500" json:"remarks"`     //备注
+	MaskJSON    string `gorm:"type:text" json:"mask_json"`  //字段级脱敏策略 json，为空时整个响应体按默认规则脱敏（旧行为）
+}
+
+// 脱敏目标
+const (
+	LDPMaskTargetJSON   = "json"   //按 JSON 路径取响应体里的字段
+	LDPMaskTargetBody   = "body"   //在整个响应体文本里按识别器查找
+	LDPMaskTargetHeader = "header" //响应头
+)
+
+// 识别器：决定字段里哪些内容要脱敏，为空表示整个字段值
+const (
+	LDPDetectorAll      = ""
+	LDPDetectorPhone    = "phone"    //手机号
+	LDPDetectorIDCard   = "idcard"   //身份证号（18位校验码校验）
+	LDPDetectorBankCard = "bankcard" //银行卡号（Luhn 校验）
+	LDPDetectorEmail    = "email"    //邮箱
+	LDPDetectorCustom   = "custom"   //自定义正则，如工号
+)
+
+// 掩码方式
+const (
+	LDPMaskStylePartial = "partial" //保留首尾，中间打码（默认）
+	LDPMaskStyleHash    = "hash"    //替换为哈希，同一原值结果相同，便于关联排查
+	LDPMaskStyleFull    = "full"    //全部打码
+)
+
+// LDPMaskPolicy 字段级脱敏策略（LDPUrl.MaskJSON）
+type LDPMaskPolicy struct {
+	Rules             []LDPMaskRule `json:"rules"`
+	HashSalt          string        `json:"hash_salt"`           //hash 方式的盐值。手机号这类取值空间小的数据不加盐可被穷举还原，建议设置
+	ExemptIPs         string        `json:"exempt_ips"`          //豁免的客户端 IP/CIDR，逗号或换行分隔
+	ExemptAccessUsers string        `json:"exempt_access_users"` //豁免的统一访问认证账号名，逗号或换行分隔（Access 账号没有角色，按账号豁免）
+}
+
+// LDPMaskRule 一条脱敏规则
+type LDPMaskRule struct {
+	Name     string `json:"name"`     //规则名，记入日志；为空时用 目标:路径
+	Target   string `json:"target"`   //json/body/header
+	Path     string `json:"path"`     //json: 点路径，* 匹配任意键或数组元素，遇到数组自动展开，如 data.list.phone；header: 响应头名
+	Detector string `json:"detector"` //识别器，target=body 时必填
+	Pattern  string `json:"pattern"`  //detector=custom 时的正则
+	Style    string `json:"style"`    //partial/hash/full
+}
+
+// ParseLDPMaskPolicy 解析字段级脱敏策略
+func ParseLDPMaskPolicy(jsonStr string) (LDPMaskPolicy, error) {
+	var p LDPMaskPolicy
+	err := json.Unmarshal([]byte(jsonStr), &p)
+	return p, err
 }
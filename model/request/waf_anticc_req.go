@@ -11,6 +11,9 @@ type WafAntiCCAddReq struct {
 	LimitMode     string `json:"limit_mode"  form:"limit_mode" binding:"required"`          // "rate" 或 "window"
 	IsEnableRule  bool   `json:"is_enable_rule" form:"is_enable_rule"`                      //是否启动规则
 	SkipGlobalCC  bool   `json:"skip_global_cc" form:"skip_global_cc"`                      //命中局部CC规则后跳过全局CC检测
+	Action        string `json:"action" form:"action"`                                      //超限动作: "block" 封禁(默认) 或 "challenge" 浏览器挑战
+	Escalation    string `json:"escalation" form:"escalation"`                              //逐级处置配置(JSON)
+	LimitKey      string `json:"limit_key" form:"limit_key"`                                //限流键，空=按IP限流
 	RuleContent   string `json:"rule_content" form:"rule_content"`                          //规则内容
 	Remarks       string `json:"remarks" form:"remarks"`                                    //备注
 }
@@ -34,6 +37,9 @@ type WafAntiCCEditReq struct {
 	LimitMode     string `json:"limit_mode"  form:"limit_mode" binding:"required"`           // "rate" 或 "window"
 	IsEnableRule  bool   `json:"is_enable_rule" form:"is_enable_rule"`                       //是否启动规则
 	SkipGlobalCC  bool   `json:"skip_global_cc" form:"skip_global_cc"`                       //命中局部CC规则后跳过全局CC检测
+	Action        string `json:"action" form:"action"`                                       //超限动作: "block" 封禁(默认) 或 "challenge" 浏览器挑战
+	Escalation    string `json:"escalation" form:"escalation"`                               //逐级处置配置(JSON)
+	LimitKey      string `json:"limit_key" form:"limit_key"`                                 //限流键，空=按IP限流
 	RuleContent   string `json:"rule_content" form:"rule_content"`                           //规则内容
 	Remarks       string `json:"remarks" form:"remarks"`                                     //备注
 }
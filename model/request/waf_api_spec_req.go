@@ -0,0 +1,45 @@
+package request
+
+import "SamWaf/model/common/request"
+
+type WafApiSpecAddReq struct {
+	HostCode    string `json:"host_code"`
+	PathPrefix  string `json:"path_prefix"`
+	StripPrefix int    `json:"strip_prefix"`
+	SpecContent string `json:"spec_content"`
+	Mode        string `json:"mode"`
+	Status      int    `json:"status"`
+	Remarks     string `json:"remarks"`
+}
+
+type WafApiSpecEditReq struct {
+	Id          string `json:"id"`
+	HostCode    string `json:"host_code"`
+	PathPrefix  string `json:"path_prefix"`
+	StripPrefix int    `json:"strip_prefix"`
+	SpecContent string `json:"spec_content"`
+	Mode        string `json:"mode"`
+	Status      int    `json:"status"`
+	Remarks     string `json:"remarks"`
+}
+
+type WafApiSpecDetailReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafApiSpecDelReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafApiSpecSearchReq struct {
+	HostCode string `json:"host_code" form:"host_code"`
+	request.PageInfo
+}
+
+// WafApiSpecLearnReq 从访问日志学习生成规范草稿
+type WafApiSpecLearnReq struct {
+	HostCode   string `json:"host_code"`
+	PathPrefix string `json:"path_prefix"` //只学习该前缀下的请求，为空表示整个网站
+	Days       int    `json:"days"`        //最近多少天的日志，默认 7
+	Limit      int    `json:"limit"`       //最多取多少条，默认 5000，最大 50000
+}
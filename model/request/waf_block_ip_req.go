@@ -12,15 +12,19 @@ type WafBlockIpAddReq struct {
 	TargetLayer string `json:"target_layer"`                 //封禁层级: ""/waf(WAF应用层) | system(系统防火墙) | both(两者)
 	IpType      string `json:"ip_type"`                      //条目类型: ""/ip(单条) | group(引用IP组)
 	GroupCode   string `json:"group_code"`                   //IpType=group 时的IP组短码
+	ExpireHours int    `json:"expire_hours"`                 //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`                  //到期时间(unix秒)，0 表示永久
 }
 
 type WafBlockIpEditReq struct {
-	Id        string `json:"id" binding:"required"`        //Block IP唯一键
-	HostCode  string `json:"host_code" binding:"required"` //网站唯一码（主要键）
-	Ip        string `json:"ip"`                           //Block ip：单IP / CIDR / 通配符 / 区间
-	Remarks   string `json:"remarks"`                      //备注
-	IpType    string `json:"ip_type"`                      //条目类型: ""/ip(单条) | group(引用IP组)
-	GroupCode string `json:"group_code"`                   //IpType=group 时的IP组短码
+	Id          string `json:"id" binding:"required"`        //Block IP唯一键
+	HostCode    string `json:"host_code" binding:"required"` //网站唯一码（主要键）
+	Ip          string `json:"ip"`                           //Block ip：单IP / CIDR / 通配符 / 区间
+	Remarks     string `json:"remarks"`                      //备注
+	IpType      string `json:"ip_type"`                      //条目类型: ""/ip(单条) | group(引用IP组)
+	GroupCode   string `json:"group_code"`                   //IpType=group 时的IP组短码
+	ExpireHours int    `json:"expire_hours"`                 //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`                  //到期时间(unix秒)，0 表示永久
 }
 type WafBlockIpDelReq struct {
 	Id string `json:"id"  form:"id"` //Block IP唯一键
@@ -7,6 +7,8 @@ type WafBlockUrlAddReq struct {
 	CompareType string `json:"compare_type" form:"compare_type"  binding:"required"` //对比方式
 	Url         string `json:"url"  binding:"required"`                              //Block url
 	Remarks     string `json:"remarks"`                                              //备注
+	ExpireHours int    `json:"expire_hours"`                                         //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`                                          //到期时间(unix秒)，0 表示永久
 }
 type WafBlockUrlSearchReq struct {
 	HostCode string `json:"host_code" ` //主机码
@@ -26,6 +28,8 @@ type WafBlockUrlEditReq struct {
 	CompareType string `json:"compare_type" form:"compare_type" binding:"required"` //对比方式
 	Url         string `json:"url" binding:"required"`                              //Block url
 	Remarks     string `json:"remarks"`                                             //备注
+	ExpireHours int    `json:"expire_hours"`                                        //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`                                         //到期时间(unix秒)，0 表示永久
 }
 
 // 批量删除请求结构体
@@ -11,6 +11,7 @@ type WafBlockingPageAddReq struct {
 	ResponseHeader   string `json:"response_header" form:"response_header"`
 	ResponseContent  string `json:"response_content" form:"response_content"`
 	ContentPriority  string `json:"content_priority" form:"content_priority"`
+	ContentType      string `json:"content_type" form:"content_type"` //适用的响应格式 html(默认)/json/xml/grpc
 }
 type WafBlockingPageEditReq struct {
 	Id               string `json:"id"`
@@ -22,6 +23,7 @@ type WafBlockingPageEditReq struct {
 	ResponseHeader   string `json:"response_header" form:"response_header"`
 	ResponseContent  string `json:"response_content" form:"response_content"`
 	ContentPriority  string `json:"content_priority" form:"content_priority"`
+	ContentType      string `json:"content_type" form:"content_type"` //适用的响应格式 html(默认)/json/xml/grpc
 }
 type WafBlockingPageDetailReq struct {
 	Id string `json:"id"   form:"id"`
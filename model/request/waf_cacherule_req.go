@@ -3,27 +3,35 @@ package request
 import "SamWaf/model/common/request"
 
 type WafCacheRuleAddReq struct {
-	HostCode      string `json:"host_code" gorm:"column:host_code" form:"host_code" gorm:"column:host_code"`
-	RuleName      string `json:"rule_name" gorm:"column:rule_name" form:"rule_name" gorm:"column:rule_name"`
-	RuleType      int    `json:"rule_type" gorm:"column:rule_type" form:"rule_type" gorm:"column:rule_type"`
-	RuleContent   string `json:"rule_content" gorm:"column:rule_content" form:"rule_content" gorm:"column:rule_content"`
-	ParamType     int    `json:"param_type" gorm:"column:param_type" form:"param_type" gorm:"column:param_type"`
-	CacheTime     int    `json:"cache_time" gorm:"column:cache_time" form:"cache_time" gorm:"column:cache_time"`
-	Priority      int    `json:"priority" gorm:"column:priority" form:"priority" gorm:"column:priority"`
-	RequestMethod string `json:"request_method" gorm:"column:request_method" form:"request_method" gorm:"column:request_method"`
-	Remarks       string `json:"remarks" gorm:"column:remarks" form:"remarks" gorm:"column:remarks"`
+	HostCode             string `json:"host_code" gorm:"column:host_code" form:"host_code" gorm:"column:host_code"`
+	RuleName             string `json:"rule_name" gorm:"column:rule_name" form:"rule_name" gorm:"column:rule_name"`
+	RuleType             int    `json:"rule_type" gorm:"column:rule_type" form:"rule_type" gorm:"column:rule_type"`
+	RuleContent          string `json:"rule_content" gorm:"column:rule_content" form:"rule_content" gorm:"column:rule_content"`
+	ParamType            int    `json:"param_type" gorm:"column:param_type" form:"param_type" gorm:"column:param_type"`
+	CacheTime            int    `json:"cache_time" gorm:"column:cache_time" form:"cache_time" gorm:"column:cache_time"`
+	Priority             int    `json:"priority" gorm:"column:priority" form:"priority" gorm:"column:priority"`
+	RequestMethod        string `json:"request_method" gorm:"column:request_method" form:"request_method" gorm:"column:request_method"`
+	OverrideOrigin       int    `json:"override_origin" form:"override_origin"`
+	CacheSetCookie       int    `json:"cache_set_cookie" form:"cache_set_cookie"`
+	StaleWhileRevalidate int    `json:"stale_while_revalidate" form:"stale_while_revalidate"`
+	StaleIfError         int    `json:"stale_if_error" form:"stale_if_error"`
+	Remarks              string `json:"remarks" gorm:"column:remarks" form:"remarks" gorm:"column:remarks"`
 }
 type WafCacheRuleEditReq struct {
-	Id            string `json:"id"`
-	HostCode      string `json:"host_code" gorm:"column:host_code" form:"host_code" gorm:"column:host_code"`
-	RuleName      string `json:"rule_name" gorm:"column:rule_name" form:"rule_name" gorm:"column:rule_name"`
-	RuleType      int    `json:"rule_type" gorm:"column:rule_type" form:"rule_type" gorm:"column:rule_type"`
-	RuleContent   string `json:"rule_content" gorm:"column:rule_content" form:"rule_content" gorm:"column:rule_content"`
-	ParamType     int    `json:"param_type" gorm:"column:param_type" form:"param_type" gorm:"column:param_type"`
-	CacheTime     int    `json:"cache_time" gorm:"column:cache_time" form:"cache_time" gorm:"column:cache_time"`
-	Priority      int    `json:"priority" gorm:"column:priority" form:"priority" gorm:"column:priority"`
-	RequestMethod string `json:"request_method" gorm:"column:request_method" form:"request_method" gorm:"column:request_method"`
-	Remarks       string `json:"remarks" gorm:"column:remarks" form:"remarks" gorm:"column:remarks"`
+	Id                   string `json:"id"`
+	HostCode             string `json:"host_code" gorm:"column:host_code" form:"host_code" gorm:"column:host_code"`
+	RuleName             string `json:"rule_name" gorm:"column:rule_name" form:"rule_name" gorm:"column:rule_name"`
+	RuleType             int    `json:"rule_type" gorm:"column:rule_type" form:"rule_type" gorm:"column:rule_type"`
+	RuleContent          string `json:"rule_content" gorm:"column:rule_content" form:"rule_content" gorm:"column:rule_content"`
+	ParamType            int    `json:"param_type" gorm:"column:param_type" form:"param_type" gorm:"column:param_type"`
+	CacheTime            int    `json:"cache_time" gorm:"column:cache_time" form:"cache_time" gorm:"column:cache_time"`
+	Priority             int    `json:"priority" gorm:"column:priority" form:"priority" gorm:"column:priority"`
+	RequestMethod        string `json:"request_method" gorm:"column:request_method" form:"request_method" gorm:"column:request_method"`
+	OverrideOrigin       int    `json:"override_origin" form:"override_origin"`
+	CacheSetCookie       int    `json:"cache_set_cookie" form:"cache_set_cookie"`
+	StaleWhileRevalidate int    `json:"stale_while_revalidate" form:"stale_while_revalidate"`
+	StaleIfError         int    `json:"stale_if_error" form:"stale_if_error"`
+	Remarks              string `json:"remarks" gorm:"column:remarks" form:"remarks" gorm:"column:remarks"`
 }
 type WafCacheRuleDetailReq struct {
 	Id string `json:"id"   form:"id"`
@@ -35,3 +43,10 @@ type WafCacheRuleSearchReq struct {
 	HostCode string `json:"host_code" gorm:"column:host_code" form:"host_code" gorm:"column:host_code"`
 	request.PageInfo
 }
+
+// WafCachePurgeReq 清理网站缓存
+type WafCachePurgeReq struct {
+	HostCode  string   `json:"host_code" form:"host_code"`
+	PurgeType string   `json:"purge_type" form:"purge_type"` //all/url/prefix/wildcard/tag
+	Values    []string `json:"values" form:"values"`         //路径、前缀、通配符或标签，可多个
+}
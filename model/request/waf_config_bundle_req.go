@@ -0,0 +1,13 @@
+package request
+
+// WafConfigBundleExportReq 导出配置包。HostCode 为空时导出全部网站
+type WafConfigBundleExportReq struct {
+	HostCode string `json:"host_code" form:"host_code"`
+	Format   string `json:"format" form:"format"` // yaml(默认) / json
+}
+
+// WafConfigBundleApplyReq plan/apply 共用：Content 为配置包原文(YAML 或 JSON)
+type WafConfigBundleApplyReq struct {
+	Content string `json:"content" form:"content"`
+	Prune   bool   `json:"prune" form:"prune"` // 删除配置包中已列出类型里多出的条目
+}
@@ -0,0 +1,46 @@
+package request
+
+import "SamWaf/model/common/request"
+
+type WafDetectExclusionAddReq struct {
+	HostCode    string `json:"host_code"`
+	CompareType string `json:"compare_type"`
+	Path        string `json:"path"`
+	ArgSource   string `json:"arg_source"`
+	ArgName     string `json:"arg_name"`
+	Detector    string `json:"detector"`
+	Remarks     string `json:"remarks"`
+}
+
+type WafDetectExclusionEditReq struct {
+	Id          string `json:"id"`
+	HostCode    string `json:"host_code"`
+	CompareType string `json:"compare_type"`
+	Path        string `json:"path"`
+	ArgSource   string `json:"arg_source"`
+	ArgName     string `json:"arg_name"`
+	Detector    string `json:"detector"`
+	Remarks     string `json:"remarks"`
+}
+
+type WafDetectExclusionDetailReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafDetectExclusionDelReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafDetectExclusionSearchReq struct {
+	HostCode string `json:"host_code" form:"host_code"`
+	Path     string `json:"path" form:"path"`
+	Detector string `json:"detector" form:"detector"`
+	request.PageInfo
+}
+
+// WafDetectExclusionFromLogReq 从攻击日志一键生成误报排除
+type WafDetectExclusionFromLogReq struct {
+	CurrrentDbName string `json:"current_db_name"`
+	REQ_UUID       string `json:"req_uuid"`
+	Remarks        string `json:"remarks"`
+}
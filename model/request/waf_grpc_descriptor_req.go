@@ -0,0 +1,28 @@
+package request
+
+import "SamWaf/model/common/request"
+
+// WafGrpcDescriptorUploadReq 上传描述文件(multipart 表单)，同名描述文件存在时替换内容
+type WafGrpcDescriptorUploadReq struct {
+	Name    string `form:"name"`    //描述文件名称，为空取文件名(去扩展名)
+	Remarks string `form:"remarks"` //备注，为空时替换保持原值
+}
+
+type WafGrpcDescriptorEditReq struct {
+	Id      string `json:"id"`
+	Status  int    `json:"status"`  //1 启用 0 停用
+	Remarks string `json:"remarks"` //备注
+}
+
+type WafGrpcDescriptorDetailReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafGrpcDescriptorDelReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafGrpcDescriptorSearchReq struct {
+	Name string `json:"name" form:"name"`
+	request.PageInfo
+}
@@ -47,6 +47,13 @@ type WafHostAddReq struct {
 	CsrfJSON                  string `json:"csrf_json"`                    //CSRF防护配置 json
 	TamperJSON                string `json:"tamper_json"`                  //网页防篡改配置 json
 	UploadSecurityJSON        string `json:"upload_security_json"`         //文件上传内容检测配置 json
+	LoginProtectJSON          string `json:"login_protect_json"`           //登录接口防撞库配置 json
+	SpiderPolicyJSON          string `json:"spider_policy_json"`           //爬虫策略配置 json
+	WebSocketJSON             string `json:"websocket_json"`               //WebSocket 消息检测配置 json
+	GrpcJSON                  string `json:"grpc_json"`                    //gRPC 检测配置 json
+	GraphQLJSON               string `json:"graphql_json"`                 //GraphQL 防护配置 json
+	ProtocolJSON              string `json:"protocol_json"`                //协议合规检测配置 json
+	SsrfJSON                  string `json:"ssrf_json"`                    //SSRF 与开放重定向检测配置 json
 	IPMode                    string `json:"ip_mode"`                      //IP提取模式: "nic" 网卡模式 或 "proxy" 代理模式
 	DisableHTTP2              int    `json:"disable_http2"`                 //对外HTTP/2开关 0启用 1关闭(该站点只走http/1.1,兼容原生WebSocket客户端)
 	IsEnableResponseBuffering int    `json:"is_enable_response_buffering"`  //响应缓冲 1开启(默认) 0关闭(类似 nginx proxy_buffering off)
@@ -111,6 +118,13 @@ type WafHostEditReq struct {
 	CsrfJSON                  string `json:"csrf_json"`                    //CSRF防护配置 json
 	TamperJSON                string `json:"tamper_json"`                  //网页防篡改配置 json
 	UploadSecurityJSON        string `json:"upload_security_json"`         //文件上传内容检测配置 json
+	LoginProtectJSON          string `json:"login_protect_json"`           //登录接口防撞库配置 json
+	SpiderPolicyJSON          string `json:"spider_policy_json"`           //爬虫策略配置 json
+	WebSocketJSON             string `json:"websocket_json"`               //WebSocket 消息检测配置 json
+	GrpcJSON                  string `json:"grpc_json"`                    //gRPC 检测配置 json
+	GraphQLJSON               string `json:"graphql_json"`                 //GraphQL 防护配置 json
+	ProtocolJSON              string `json:"protocol_json"`                //协议合规检测配置 json
+	SsrfJSON                  string `json:"ssrf_json"`                    //SSRF 与开放重定向检测配置 json
 	IPMode                    string `json:"ip_mode"`                      //IP提取模式: "nic" 网卡模式 或 "proxy" 代理模式
 	DisableHTTP2              int    `json:"disable_http2"`                 //对外HTTP/2开关 0启用 1关闭(该站点只走http/1.1,兼容原生WebSocket客户端)
 	IsEnableResponseBuffering int    `json:"is_enable_response_buffering"`  //响应缓冲 1开启(默认) 0关闭(类似 nginx proxy_buffering off)
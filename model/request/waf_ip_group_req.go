@@ -45,15 +45,19 @@ type WafIPGroupValidateReq struct {
 // ---------- IP 组内条目 ----------
 
 type WafIPGroupItemAddReq struct {
-	GroupCode string `json:"group_code" binding:"required"`
-	Ip        string `json:"ip" binding:"required"` //单IP / CIDR / 通配符 / 区间
-	Remarks   string `json:"remarks"`
+	GroupCode   string `json:"group_code" binding:"required"`
+	Ip          string `json:"ip" binding:"required"` //单IP / CIDR / 通配符 / 区间
+	Remarks     string `json:"remarks"`
+	ExpireHours int    `json:"expire_hours"` //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`  //到期时间(unix秒)，0 表示永久
 }
 
 type WafIPGroupItemEditReq struct {
-	Id      string `json:"id" binding:"required"`
-	Ip      string `json:"ip" binding:"required"`
-	Remarks string `json:"remarks"`
+	Id          string `json:"id" binding:"required"`
+	Ip          string `json:"ip" binding:"required"`
+	Remarks     string `json:"remarks"`
+	ExpireHours int    `json:"expire_hours"` //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`  //到期时间(unix秒)，0 表示永久
 }
 
 type WafIPGroupItemDelReq struct {
@@ -76,9 +80,11 @@ type WafIPGroupItemBatchDelReq struct {
 
 // WafIPGroupItemBatchAddReq 多行文本批量录入，每行一个 IP 模式（忽略空行与 # 开头的注释行）
 type WafIPGroupItemBatchAddReq struct {
-	GroupCode string `json:"group_code" binding:"required"`
-	Content   string `json:"content" binding:"required"`
-	Remarks   string `json:"remarks"`
+	GroupCode   string `json:"group_code" binding:"required"`
+	Content     string `json:"content" binding:"required"`
+	Remarks     string `json:"remarks"`
+	ExpireHours int    `json:"expire_hours"` //有效期(小时)，>0 时按当前时间起算，优先于 expire_time
+	ExpireTime  int64  `json:"expire_time"`  //到期时间(unix秒)，0 表示永久
 }
 
 type WafIPGroupItemDelAllReq struct {
@@ -7,6 +7,7 @@ type WafLdpUrlAddReq struct {
 	CompareType string `json:"compare_type"` //对比方式
 	Url         string `json:"url"`          //加隐私保护的url
 	Remarks     string `json:"remarks"`      //备注
+	MaskJSON    string `json:"mask_json"`    //字段级脱敏策略 json，为空时整页脱敏
 }
 type WafLdpUrlDelReq struct {
 	Id string `json:"id"  form:"id"` //隐私保护url唯一键
@@ -20,6 +21,7 @@ type WafLdpUrlEditReq struct {
 	CompareType string `json:"compare_type"` //对比方式
 	Url         string `json:"url"`          //隐私保护url
 	Remarks     string `json:"remarks"`      //备注
+	MaskJSON    string `json:"mask_json"`    //字段级脱敏策略 json，为空时整页脱敏
 }
 type WafLdpUrlSearchReq struct {
 	HostCode string `json:"host_code" ` //主机码
@@ -0,0 +1,42 @@
+package request
+
+import "SamWaf/model/common/request"
+
+type WafSpiderBotAddReq struct {
+	Name         string `json:"name"`          //爬虫名称
+	Category     string `json:"category"`      //类别 search/ai/seo/monitor/scraper
+	UAPatterns   string `json:"ua_patterns"`   //UA 特征，每行一个
+	RDNSSuffixes string `json:"rdns_suffixes"` //反向DNS 域名后缀，每行一个
+	IPRanges     string `json:"ip_ranges"`     //公开IP段，每行一个
+	IPFiles      string `json:"ip_files"`      //公开IP列表文件，逗号分隔
+	Sort         int    `json:"sort"`          //匹配顺序
+	Status       int    `json:"status"`        //1 启用 0 停用
+	Remarks      string `json:"remarks"`       //备注
+}
+
+type WafSpiderBotEditReq struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Category     string `json:"category"`
+	UAPatterns   string `json:"ua_patterns"`
+	RDNSSuffixes string `json:"rdns_suffixes"`
+	IPRanges     string `json:"ip_ranges"`
+	IPFiles      string `json:"ip_files"`
+	Sort         int    `json:"sort"`
+	Status       int    `json:"status"`
+	Remarks      string `json:"remarks"`
+}
+
+type WafSpiderBotDetailReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafSpiderBotDelReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafSpiderBotSearchReq struct {
+	Name     string `json:"name" form:"name"`
+	Category string `json:"category" form:"category"`
+	request.PageInfo
+}
@@ -24,6 +24,10 @@ type WafTunnelAddReq struct {
 	SSLCertificate    string `json:"ssl_certificate" form:"ssl_certificate"`
 	SSLCertificateKey string `json:"ssl_certificate_key" form:"ssl_certificate_key"`
 	SSLProtocols      string `json:"ssl_protocols" form:"ssl_protocols"`
+
+	IsEnableLoadBalance int    `json:"is_enable_load_balance" form:"is_enable_load_balance"`
+	LoadBalanceStage    int    `json:"load_balance_stage" form:"load_balance_stage"`
+	HealthyJSON         string `json:"healthy_json" form:"healthy_json"`
 }
 type WafTunnelEditReq struct {
 	Id string `json:"id"`
@@ -49,6 +53,10 @@ type WafTunnelEditReq struct {
 	SSLCertificate    string `json:"ssl_certificate" form:"ssl_certificate"`
 	SSLCertificateKey string `json:"ssl_certificate_key" form:"ssl_certificate_key"`
 	SSLProtocols      string `json:"ssl_protocols" form:"ssl_protocols"`
+
+	IsEnableLoadBalance int    `json:"is_enable_load_balance" form:"is_enable_load_balance"`
+	LoadBalanceStage    int    `json:"load_balance_stage" form:"load_balance_stage"`
+	HealthyJSON         string `json:"healthy_json" form:"healthy_json"`
 }
 type WafTunnelDetailReq struct {
 	Id string `json:"id"   form:"id"`
@@ -64,3 +72,63 @@ type WafTunnelSearchReq struct {
 type WafTunnelConnReq struct {
 	ID string `json:"id" form:"id"`
 }
+
+// WafTunnelConnKillReq 手工断开一条存活连接
+type WafTunnelConnKillReq struct {
+	Protocol string `json:"protocol" form:"protocol"` // tcp / udp
+	Port     int    `json:"port" form:"port"`         // 本地监听端口
+	ConnId   string `json:"conn_id" form:"conn_id"`   // 连接ID，见连接详情里的 conn_id
+}
+
+// WafTunnelConnLogSearchReq 隧道连接审计日志查询
+type WafTunnelConnLogSearchReq struct {
+	TunnelCode  string `json:"tunnel_code" form:"tunnel_code"`
+	ClientIP    string `json:"client_ip" form:"client_ip"`       // 模糊匹配
+	Protocol    string `json:"protocol" form:"protocol"`         // tcp / udp
+	CloseReason string `json:"close_reason" form:"close_reason"` //
+	DenyRule    string `json:"deny_rule" form:"deny_rule"`       // ip / time，传 "any" 只看被拒绝的
+	StartTime   int64  `json:"start_time" form:"start_time"`     // unix毫秒，0=不限
+	EndTime     int64  `json:"end_time" form:"end_time"`
+	request.PageInfo
+}
+
+// WafTunnelStatsReq 隧道流量统计查询
+type WafTunnelStatsReq struct {
+	TunnelCode string `json:"tunnel_code" form:"tunnel_code"` // 空=全部隧道
+	Unit       string `json:"unit" form:"unit"`               // day / hour，默认 day
+	StartDay   int    `json:"start_day" form:"start_day"`     // unit=day 时使用，如 20261001
+	EndDay     int    `json:"end_day" form:"end_day"`
+	StartTime  int64  `json:"start_time" form:"start_time"` // unit=hour 时使用，unix秒
+	EndTime    int64  `json:"end_time" form:"end_time"`
+}
+
+type WafTunnelLoadBalanceAddReq struct {
+	TunnelCode string `json:"tunnel_code"` //隧道唯一码
+	RemoteIp   string `json:"remote_ip"`   //目标IP
+	RemotePort int    `json:"remote_port"` //目标端口
+	Weight     int    `json:"weight"`      //权重
+	Remarks    string `json:"remarks"`     //备注
+}
+type WafTunnelLoadBalanceEditReq struct {
+	Id         string `json:"id"`
+	TunnelCode string `json:"tunnel_code"`
+	RemoteIp   string `json:"remote_ip"`
+	RemotePort int    `json:"remote_port"`
+	Weight     int    `json:"weight"`
+	Remarks    string `json:"remarks"`
+}
+type WafTunnelLoadBalanceDetailReq struct {
+	Id string `json:"id"   form:"id"`
+}
+type WafTunnelLoadBalanceDelReq struct {
+	Id string `json:"id"   form:"id"`
+}
+type WafTunnelLoadBalanceSearchReq struct {
+	TunnelCode string `json:"tunnel_code"`
+	request.PageInfo
+}
+
+// WafTunnelTargetHealthReq 查询隧道目标健康状态
+type WafTunnelTargetHealthReq struct {
+	TunnelCode string `json:"tunnel_code" form:"tunnel_code"`
+}
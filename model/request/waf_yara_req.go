@@ -0,0 +1,40 @@
+package request
+
+import "SamWaf/model/common/request"
+
+type WafYaraRuleSetAddReq struct {
+	Name    string `json:"name"`    //规则集名称
+	Content string `json:"content"` //YARA 规则文本
+	Action  string `json:"action"`  //block 拦截 / log 仅记录
+	Status  int    `json:"status"`  //1 启用 0 停用
+	Remarks string `json:"remarks"` //备注
+}
+
+type WafYaraRuleSetEditReq struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Action  string `json:"action"`
+	Status  int    `json:"status"`
+	Remarks string `json:"remarks"`
+}
+
+type WafYaraRuleSetDetailReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafYaraRuleSetDelReq struct {
+	Id string `json:"id" form:"id"`
+}
+
+type WafYaraRuleSetSearchReq struct {
+	Name string `json:"name" form:"name"`
+	request.PageInfo
+}
+
+// WafYaraRuleSetUploadReq 上传 .yar 文件(multipart 表单)，同名规则集存在时替换规则文本
+type WafYaraRuleSetUploadReq struct {
+	Name    string `form:"name"`    //规则集名称，为空取文件名(去扩展名)
+	Action  string `form:"action"`  //block/log，为空时新建用 block，替换时保持原值
+	Remarks string `form:"remarks"` //备注，为空时替换保持原值
+}
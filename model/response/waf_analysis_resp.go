@@ -5,3 +5,14 @@ type WafAnalysisSpiderResp struct {
 	Name  string `json:"name"  form:"name"`
 	Value int64  `json:"value"  form:"value"`
 }
+
+// WafAnalysisSpiderReportResp 按爬虫汇总的流量报表
+type WafAnalysisSpiderReportResp struct {
+	Name     string `json:"name"`      //爬虫名称(访客身份识别)
+	Category string `json:"category"`  //爬虫类别，爬虫库里查不到的为空
+	IsFake   bool   `json:"is_fake"`   //是否伪装爬虫
+	Requests int64  `json:"requests"`  //请求数
+	Blocked  int64  `json:"blocked"`   //被拦截数
+	Bytes    int64  `json:"bytes"`     //响应字节数
+	LastTime int64  `json:"last_time"` //最近访问时间(unix 毫秒)
+}
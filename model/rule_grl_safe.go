@@ -43,19 +43,23 @@ func EscapeGrlString(s string) string {
 
 // 允许在规则条件里使用的事实字段（与前端下拉保持一致，服务端独立校验，不信任前端传上来的值）
 var ruleAttrSimpleWhiteList = map[string]bool{
-	"HOST":        true,
-	"URL":         true,
-	"REFERER":     true,
-	"USER_AGENT":  true,
-	"METHOD":      true,
-	"COOKIES":     true,
-	"BODY":        true,
-	"PORT":        true,
-	"SRC_IP":      true,
-	"COUNTRY":     true,
-	"PROVINCE":    true,
-	"CITY":        true,
-	"IsSafeBot()": true,
+	"HOST":              true,
+	"URL":               true,
+	"REFERER":           true,
+	"USER_AGENT":        true,
+	"METHOD":            true,
+	"COOKIES":           true,
+	"BODY":              true,
+	"PORT":              true,
+	"SRC_IP":            true,
+	"COUNTRY":           true,
+	"PROVINCE":          true,
+	"CITY":              true,
+	"GRPC_SERVICE":      true,
+	"GRPC_METHOD":       true,
+	"GRAPHQL_OPERATION": true,
+	"GRAPHQL_COST":      true,
+	"IsSafeBot()":       true,
 }
 
 // 方法型字段：GetHeaderValue("xxx") / GetIPFailureCount(5)
@@ -21,7 +21,7 @@ func IfCompare(condition bool, trueVal, falseVal interface{}) interface{} {
 type RuleInfo struct {
 	IsManualRule     string             `json:"is_manual_rule"`
 	RuleContent      string             `json:"rule_content"`      //规则内容
-	RuleAction       string             `json:"rule_action"`       //命中之后的动作 deny(拦截,默认) allow(放行) log(仅记录)
+	RuleAction       string             `json:"rule_action"`       //命中之后的动作 deny(拦截,默认) challenge(浏览器挑战) allow(放行) log(仅记录)
 	RuleActionSkips  []string           `json:"rule_action_skips"` //放行时要跳过的检测模块 如 ["CC","AI"]，["ALL"]表示全部
 	RuleBase         RuleBase           `json:"rule_base"`
 	RuleCondition    RuleCondition      `json:"rule_condition"`
@@ -81,6 +81,8 @@ func genRuleActionStmt(rule RuleInfo) string {
 	switch rule.RuleAction {
 	case "log":
 		return "RF.Log();"
+	case "challenge":
+		return "RF.Challenge();"
 	case "allow":
 		//跳过的模块名只能来自白名单枚举，非法值直接丢弃，绝不把用户传来的字符串原样拼进规则
 		skips := make([]string, 0, len(rule.RuleActionSkips))
@@ -114,8 +116,8 @@ func genRuleActionStmt(rule RuleInfo) string {
 // ruleSkipModuleWhiteList 与 utils.RuleSkipModules 保持一致
 // （model 包不能引 utils，会形成循环依赖，所以这里单独列一份，加规则模块时两边都要改）
 var ruleSkipModuleWhiteList = map[string]bool{
-	"BOT": true, "SQLI": true, "XSS": true, "SCAN": true, "RCE": true,
-	"DIR": true, "CC": true, "AI": true, "SENSITIVE": true, "OWASP": true,
+	"BOT": true, "APISPEC": true, "GRAPHQL": true, "SQLI": true, "XSS": true, "SCAN": true, "RCE": true,
+	"DIR": true, "SSRF": true, "CC": true, "LOGIN": true, "AI": true, "SENSITIVE": true, "OWASP": true,
 	"ANTILEECH": true, "CSRF": true, "UPLOAD": true, "CAPTCHA": true,
 }
 
@@ -0,0 +1,29 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+// 爬虫类别，网站按类别配置放行/拦截/限速策略
+const (
+	SpiderBotCategorySearch  = "search"  //搜索引擎
+	SpiderBotCategoryAI      = "ai"      //AI 训练/AI 搜索
+	SpiderBotCategorySEO     = "seo"     //SEO 分析
+	SpiderBotCategoryMonitor = "monitor" //监控/拨测
+	SpiderBotCategoryScraper = "scraper" //通用采集脚本/无头浏览器（只能按 UA 识别）
+)
+
+// SpiderBot 爬虫库中的一个爬虫定义。UA 命中后按「公开IP段 → 反向DNS+正向确认」核验真伪；
+// 两者都没配置的只按 UA 识别(无法核验)。
+// 内置定义随发布包的 data/spiderbot/registry.json 同步进来，按名称去重，用户修改过的不会被覆盖。
+type SpiderBot struct {
+	baseorm.BaseOrm
+	Name         string `gorm:"size:100" json:"name"`           //爬虫名称，如 百度爬虫（唯一）
+	Category     string `gorm:"size:20" json:"category"`        //类别 search/ai/seo/monitor/scraper
+	UAPatterns   string `gorm:"type:text" json:"ua_patterns"`   //UA 特征，每行一个，不区分大小写的包含匹配
+	RDNSSuffixes string `gorm:"type:text" json:"rdns_suffixes"` //反向DNS 可接受的域名后缀，每行一个，如 .baidu.com
+	IPRanges     string `gorm:"type:text" json:"ip_ranges"`     //公开IP段，每行一个 IP 或 CIDR
+	IPFiles      string `gorm:"size:500" json:"ip_files"`       //data/spiderbot 下的公开IP列表文件，逗号分隔，如 googlebot.json
+	Sort         int    `json:"sort"`                           //匹配顺序，小的先匹配（UA 特征有包含关系时把更具体的排前面）
+	Builtin      int    `json:"builtin"`                        //1 内置 0 自定义
+	Status       int    `json:"status"`                         //1 启用 0 停用
+	Remarks      string `gorm:"size:500" json:"remarks"`        //备注
+}
@@ -162,3 +162,33 @@ type StatsSiteDayPoint struct {
 	NormalCount int64 `json:"normal_count"`
 	UvCount     int64 `json:"uv_count"`
 }
+
+/*
+*
+按天统计隧道流量（天级聚合，永久保留）
+*/
+type StatsTunnelDay struct {
+	baseorm.BaseOrm
+	TunnelCode string `gorm:"size:64" json:"tunnel_code"`  //隧道唯一码（主要键）
+	Day        int    `json:"day"`                         //年月日（主要键）如 20261018
+	TunnelName string `gorm:"size:255" json:"tunnel_name"` //隧道名称
+	ConnCount  int64  `json:"conn_count"`                  //连接数（UDP为会话数）
+	DenyCount  int64  `json:"deny_count"`                  //被拒绝的连接数
+	TrafficIn  int64  `json:"traffic_in"`                  //入站流量(bytes)
+	TrafficOut int64  `json:"traffic_out"`                 //出站流量(bytes)
+}
+
+/*
+*
+按小时统计隧道流量（小时级聚合，仅保留最近3天）
+*/
+type StatsTunnelHour struct {
+	baseorm.BaseOrm
+	TunnelCode string `gorm:"size:64" json:"tunnel_code"`  //隧道唯一码（主要键）
+	HourTime   int64  `json:"hour_time"`                   //整点unix时间戳(秒)（主要键）
+	TunnelName string `gorm:"size:255" json:"tunnel_name"` //隧道名称
+	ConnCount  int64  `json:"conn_count"`                  //连接数（UDP为会话数）
+	DenyCount  int64  `json:"deny_count"`                  //被拒绝的连接数
+	TrafficIn  int64  `json:"traffic_in"`                  //入站流量(bytes)
+	TrafficOut int64  `json:"traffic_out"`                 //出站流量(bytes)
+}
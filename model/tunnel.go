@@ -28,4 +28,25 @@ type Tunnel struct {
 	SSLCertificate    string `gorm:"size:500" json:"ssl_certificate"`     // SSL证书路径
 	SSLCertificateKey string `gorm:"size:500" json:"ssl_certificate_key"` // SSL密钥路径
 	SSLProtocols      string `gorm:"size:100" json:"ssl_protocols"`       // SSL协议版本 如 TLSv1.2 TLSv1.3
+
+	IsEnableLoadBalance int    `json:"is_enable_load_balance"`        // 是否启用多目标负载 1 启用 非1 只用 RemoteIp/RemotePort
+	LoadBalanceStage    int    `json:"load_balance_stage"`            // 负载策略 见 TunnelLB*
+	HealthyJSON         string `gorm:"type:text" json:"healthy_json"` // 目标健康检测 json 见 TunnelHealthyConfig
+}
+
+// 隧道负载策略
+const (
+	TunnelLBRoundRobin = 1 // 加权轮询
+	TunnelLBLeastConn  = 2 // 最少连接（按权重折算）
+	TunnelLBSourceHash = 3 // 源地址哈希，同一客户端IP固定落到同一目标
+)
+
+// TunnelHealthyConfig 隧道目标健康检测（TCP 建连探测）
+type TunnelHealthyConfig struct {
+	IsEnableHealthy int `json:"is_enable_healthy"` // 是否开启健康检查
+	Interval        int `json:"interval"`          // 探测间隔(秒) 默认10
+	Timeout         int `json:"timeout"`           // 建连超时(秒) 默认3
+	FailCount       int `json:"fail_count"`        // 连续失败多少次摘除 默认3
+	SuccessCount    int `json:"success_count"`     // 连续成功多少次恢复 默认2
+	ProbePort       int `json:"probe_port"`        // 探测端口 0=目标端口；UDP 目标一般要指定一个 TCP 端口
 }
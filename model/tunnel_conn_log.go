@@ -0,0 +1,54 @@
+package model
+
+import (
+	"SamWaf/model/baseorm"
+)
+
+// 隧道连接的关闭原因
+const (
+	TunnelCloseClient  = "client_close" // 客户端先断开
+	TunnelCloseTarget  = "target_close" // 目标服务器先断开
+	TunnelCloseTimeout = "timeout"      // 读写/连接超时，UDP 会话空闲超时也归到这里
+	TunnelCloseDial    = "dial_fail"    // 连接目标失败
+	TunnelCloseLimit   = "limit"        // 超出入站/出站连接数限制
+	TunnelCloseDenied  = "denied"       // 被 IP 或时间段规则拒绝
+	TunnelCloseKilled  = "killed"       // 管理员在控制台手工断开
+	TunnelCloseStop    = "server_stop"  // 隧道服务停止/重启
+)
+
+// 拒绝连接的规则类型
+const (
+	TunnelDenyNone = ""     // 未拒绝
+	TunnelDenyIP   = "ip"   // 命中 IP 黑名单或不在白名单
+	TunnelDenyTime = "time" // 不在允许访问的时间段
+)
+
+// TunnelConnLog 隧道连接审计日志，一条连接(UDP 为一个会话)落一行。
+//
+// 放 log 库：和 web_logs 一样随流量线性增长，属于可按保留策略清理的观测数据。
+type TunnelConnLog struct {
+	baseorm.BaseOrm
+	TunnelCode  string `gorm:"size:64" json:"tunnel_code"`  // 隧道唯一码
+	TunnelName  string `gorm:"size:255" json:"tunnel_name"` // 隧道名称（冗余，隧道删了也能看懂日志）
+	Protocol    string `gorm:"size:20" json:"protocol"`     // tcp / udp
+	ServerPort  int    `json:"server_port"`                 // 本地监听端口
+	ClientIP    string `gorm:"size:64" json:"client_ip"`    // 客户端IP
+	ClientPort  int    `json:"client_port"`                 // 客户端端口
+	TargetAddr  string `gorm:"size:128" json:"target_addr"` // 实际连接的目标地址
+	Country     string `gorm:"size:100" json:"country"`     // 国家
+	Province    string `gorm:"size:100" json:"province"`    // 省份
+	City        string `gorm:"size:100" json:"city"`        // 城市
+	StartTime   int64  `json:"start_time"`                  // 连接开始(unix毫秒)
+	EndTime     int64  `json:"end_time"`                    // 连接结束(unix毫秒)
+	Duration    int64  `json:"duration"`                    // 持续时长(毫秒)
+	BytesIn     int64  `json:"bytes_in"`                    // 客户端->目标 字节数
+	BytesOut    int64  `json:"bytes_out"`                   // 目标->客户端 字节数
+	CloseReason string `gorm:"size:32" json:"close_reason"` // 关闭原因，见 TunnelClose*
+	DenyRule    string `gorm:"size:16" json:"deny_rule"`    // 拒绝规则，见 TunnelDeny*，空表示未拒绝
+	Day         int    `json:"day"`                         // 年月日，如 20261018
+}
+
+// TableName 表名
+func (TunnelConnLog) TableName() string {
+	return "tunnel_conn_log"
+}
@@ -0,0 +1,20 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+/*
+隧道负载均衡目标
+*/
+type TunnelLoadBalance struct {
+	baseorm.BaseOrm
+	TunnelCode string `gorm:"size:64" json:"tunnel_code"` //隧道唯一码（主要键）
+	RemotePort int    `json:"remote_port"`                //目标端口
+	RemoteIp   string `gorm:"size:64" json:"remote_ip"`   //目标IP
+	Weight     int    `json:"weight"`                     //权重
+	Remarks    string `gorm:"size:500" json:"remarks"`    //备注
+}
+
+// TableName 表名
+func (TunnelLoadBalance) TableName() string {
+	return "tunnel_load_balance"
+}
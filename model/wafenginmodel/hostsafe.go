@@ -5,6 +5,7 @@ import (
 	"SamWaf/utils"
 	"SamWaf/wafenginecore/ipset"
 	"SamWaf/wafenginecore/loadbalance"
+	"SamWaf/wafenginecore/wafapispec"
 	"SamWaf/wafproxy"
 	"SamWaf/webplugin"
 	"sync"
@@ -22,6 +23,7 @@ type HostSafe struct {
 	RuleVersionSum      int //规则版本的汇总 通过这个来进行版本动态加载
 	Host                model.Hosts
 	PluginIpRateLimiter *webplugin.IPRateLimiter //ip限流
+	SpiderLimiter       *webplugin.IPRateLimiter //爬虫策略限速，计数维度是爬虫名称；随网站重新加载重建，未开启爬虫策略时为 nil
 	IPWhiteLists        []model.IPAllowList      //ip 白名单
 	UrlWhiteLists       []model.URLAllowList     //url 白名单
 	LdpUrlLists         []model.LDPUrl           //url 隐私保护
@@ -39,11 +41,14 @@ type HostSafe struct {
 	LoadBalanceLists   []model.LoadBalance           //负载均衡
 	LoadBalanceRuntime *LoadBalanceRuntime           //负载运行时
 	AntiCCBean         model.AntiCC                  //抵御CC
+	CCKeyedLimiters    []*CCKeyedLimiter             //按自定义键限流的CC规则，按创建顺序检测
 	HttpAuthBases      []model.HttpAuthBase          //HTTP AUTH校验
 	BlockingPage       map[string]model.BlockingPage //自定义拦截界面
 	CacheRule          []model.CacheRule             //CacheRule
 	TamperRules        []model.TamperRule            //网页防篡改规则（含基线正文，供响应比对/回吐）
 	PathRules          []model.HostPathRule          //路径路由规则
+	DetectExclusions   []model.DetectExclusion       //内置检测误报排除
+	ApiSpecs           []*wafapispec.Spec            //编译后的接口规范(OpenAPI)，前缀长的在前
 	StaticConfig       model.StaticSiteConfig        //解析后的静态站点安全配置，供路径规则静态服务共享
 }
 
@@ -55,3 +60,10 @@ type LoadBalanceRuntime struct {
 	WeightRoundRobinBalance *loadbalance.WeightRoundRobinBalance //权重轮询
 	IpHashBalance           *loadbalance.ConsistentHashBalance   //ipHash
 }
+
+// CCKeyedLimiter 按自定义键(请求头、Cookie、JWT声明、路径模板等)限流的CC规则
+type CCKeyedLimiter struct {
+	AntiCC  model.AntiCC             //规则配置(速率、窗口、动作)
+	Key     []model.CCKeyPart        //解析后的限流键
+	Limiter *webplugin.IPRateLimiter //计数器，以键值代替IP
+}
@@ -1,8 +1,11 @@
 package waftunnelmodel
 
 import (
+	"SamWaf/model"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,8 +17,57 @@ const (
 
 // ConnInfo 连接信息结构体
 type ConnInfo struct {
-	ConnType   int       // 连接类型：0-来源连接，1-目标连接
-	CreateTime time.Time // 连接创建时间
+	ConnType    int          // 连接类型：0-来源连接，1-目标连接
+	CreateTime  time.Time    // 连接创建时间
+	Id          string       // 连接ID，控制台按它手工断开
+	ClientAddr  string       // 客户端地址 ip:port。UDP 会话登记的是目标连接，RemoteAddr 是目标地址，所以单独记
+	Counter     *ConnCounter // 实时字节计数，可为 nil
+	CloseReason string       // 被外部关闭时的原因（如手工断开），由处理协程在收尾时读取
+}
+
+// ConnCounter 单条连接的实时字节计数
+type ConnCounter struct {
+	In  atomic.Int64 // 客户端->目标
+	Out atomic.Int64 // 目标->客户端
+}
+
+// ConnDetail 对外展示的连接详情
+type ConnDetail struct {
+	Id         string `json:"conn_id"`
+	ClientIP   string `json:"ip"`
+	ClientPort string `json:"client_port"`
+	CreateTime int64  `json:"create_time"` // unix毫秒
+	BytesIn    int64  `json:"bytes_in"`
+	BytesOut   int64  `json:"bytes_out"`
+}
+
+// buildConnDetail 把连接信息转成展示结构，addr 为空时用 ClientAddr
+func buildConnDetail(info ConnInfo, addr string) ConnDetail {
+	if info.ClientAddr != "" {
+		addr = info.ClientAddr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	d := ConnDetail{
+		Id:         info.Id,
+		ClientIP:   host,
+		ClientPort: port,
+		CreateTime: info.CreateTime.UnixMilli(),
+	}
+	if info.Counter != nil {
+		d.BytesIn = info.Counter.In.Load()
+		d.BytesOut = info.Counter.Out.Load()
+	}
+	return d
+}
+
+var connIdSeq atomic.Uint64
+
+// NewConnId 生成进程内唯一的连接ID（只用于控制台定位，不落库做主键）
+func NewConnId() string {
+	return strconv.FormatInt(time.Now().Unix(), 36) + "-" + strconv.FormatUint(connIdSeq.Add(1), 36)
 }
 
 // SafeTCPConnMap 线程安全的TCP连接管理Map
@@ -46,6 +98,73 @@ func (m *SafeTCPConnMap) AddConn(port int, conn net.Conn, connType int) {
 	}
 }
 
+// AddConnInfo 添加连接并带上完整连接信息
+func (m *SafeTCPConnMap) AddConnInfo(port int, conn net.Conn, info ConnInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.items[port]; !exists {
+		m.items[port] = make(map[net.Conn]ConnInfo)
+	}
+	if info.CreateTime.IsZero() {
+		info.CreateTime = time.Now()
+	}
+	m.items[port][conn] = info
+}
+
+// KillConn 按连接ID断开指定端口上的连接（来源、目标两端一起关），返回是否找到
+func (m *SafeTCPConnMap) KillConn(port int, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	if conns, exists := m.items[port]; exists && id != "" {
+		for conn, info := range conns {
+			if info.Id == id {
+				info.CloseReason = model.TunnelCloseKilled
+				conns[conn] = info
+				conn.Close()
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// CloseReasonOf 查询连接被外部关闭的原因。exists=false 表示连接已被整端口清理（服务停止）
+func (m *SafeTCPConnMap) CloseReasonOf(port int, conn net.Conn) (reason string, exists bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if conns, ok := m.items[port]; ok {
+		if info, ok := conns[conn]; ok {
+			return info.CloseReason, true
+		}
+	}
+	return "", false
+}
+
+// GetPortConnsDetail 获取指定端口指定类型的连接详情
+func (m *SafeTCPConnMap) GetPortConnsDetail(port int, connType int) []ConnDetail {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]ConnDetail, 0)
+	if conns, exists := m.items[port]; exists {
+		for conn, info := range conns {
+			if info.ConnType != connType {
+				continue
+			}
+			addr := ""
+			if remoteAddr := conn.RemoteAddr(); remoteAddr != nil {
+				addr = remoteAddr.String()
+			}
+			list = append(list, buildConnDetail(info, addr))
+		}
+	}
+	return list
+}
+
 // RemoveConn 移除连接
 func (m *SafeTCPConnMap) RemoveConn(port int, conn net.Conn) {
 	m.mu.Lock()
@@ -167,6 +286,73 @@ func (m *SafeUDPConnMap) AddConn(port int, conn *net.UDPConn, connType int) {
 	}
 }
 
+// AddConnInfo 添加连接并带上完整连接信息
+func (m *SafeUDPConnMap) AddConnInfo(port int, conn *net.UDPConn, info ConnInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.items[port]; !exists {
+		m.items[port] = make(map[*net.UDPConn]ConnInfo)
+	}
+	if info.CreateTime.IsZero() {
+		info.CreateTime = time.Now()
+	}
+	m.items[port][conn] = info
+}
+
+// KillConn 按连接ID断开指定端口上的 UDP 会话（关闭会话的目标连接），返回是否找到
+func (m *SafeUDPConnMap) KillConn(port int, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	if conns, exists := m.items[port]; exists && id != "" {
+		for conn, info := range conns {
+			if info.Id == id {
+				info.CloseReason = model.TunnelCloseKilled
+				conns[conn] = info
+				conn.Close()
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// CloseReasonOf 查询连接被外部关闭的原因。exists=false 表示连接已被整端口清理（服务停止）
+func (m *SafeUDPConnMap) CloseReasonOf(port int, conn *net.UDPConn) (reason string, exists bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if conns, ok := m.items[port]; ok {
+		if info, ok := conns[conn]; ok {
+			return info.CloseReason, true
+		}
+	}
+	return "", false
+}
+
+// GetPortConnsDetail 获取指定端口指定类型的连接详情。UDP 会话按 ConnTypeTarget 登记，地址取 ClientAddr
+func (m *SafeUDPConnMap) GetPortConnsDetail(port int, connType int) []ConnDetail {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]ConnDetail, 0)
+	if conns, exists := m.items[port]; exists {
+		for conn, info := range conns {
+			if info.ConnType != connType {
+				continue
+			}
+			addr := ""
+			if remoteAddr := conn.RemoteAddr(); remoteAddr != nil {
+				addr = remoteAddr.String()
+			}
+			list = append(list, buildConnDetail(info, addr))
+		}
+	}
+	return list
+}
+
 // RemoveConn 移除连接
 func (m *SafeUDPConnMap) RemoveConn(port int, conn *net.UDPConn) {
 	m.mu.Lock()
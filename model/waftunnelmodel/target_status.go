@@ -0,0 +1,14 @@
+package waftunnelmodel
+
+// TunnelTargetStatus 隧道目标运行状态（控制台展示用）
+type TunnelTargetStatus struct {
+	Index        int    `json:"index"`         // 目标编号，对应目标列表按创建时间的顺序
+	Addr         string `json:"addr"`          // ip:port
+	Weight       int    `json:"weight"`        // 权重
+	Healthy      bool   `json:"healthy"`       // 是否健康
+	ActiveConns  int64  `json:"active_conns"`  // 当前连接数(UDP 为会话数)
+	FailCount    int    `json:"fail_count"`    // 连续失败次数
+	SuccessCount int    `json:"success_count"` // 连续成功次数
+	LastError    string `json:"last_error"`    // 最近一次探测失败原因
+	LastCheck    int64  `json:"last_check"`    // 最近一次探测时间(unix毫秒)，0 表示未探测
+}
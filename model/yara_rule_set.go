@@ -0,0 +1,21 @@
+package model
+
+import "SamWaf/model/baseorm"
+
+// YARA 规则集命中后的动作
+const (
+	YaraActionBlock = "block" //拦截
+	YaraActionLog   = "log"   //仅记录：命中的规则名记入日志，照常放行，新规则上线前先观察误报
+)
+
+// YaraRuleSet YARA 规则集（全局），由安全团队维护的 webshell/恶意文档规则。
+// 各网站在文件上传检测配置里开启后，对上传文件(及可选的请求体)生效；增删改后实时生效，无需重启。
+type YaraRuleSet struct {
+	baseorm.BaseOrm
+	Name      string `gorm:"size:100" json:"name"`     //规则集名称，日志里以 规则集/规则名 标识命中
+	Content   string `gorm:"type:text" json:"content"` //YARA 规则文本
+	RuleCount int    `json:"rule_count"`               //规则条数，保存时编译得出
+	Action    string `gorm:"size:20" json:"action"`    //block 拦截 / log 仅记录
+	Status    int    `json:"status"`                   //1 启用 0 停用
+	Remarks   string `gorm:"size:500" json:"remarks"`  //备注
+}
@@ -75,6 +75,12 @@ type ApiGroup struct {
 	WafAIRouter
 	WafUIPreferenceRouter
 	UpgradeNoticeRouter
+	WafConfigBundleRouter
+	WafDetectExclusionRouter
+	WafApiSpecRouter
+	WafSpiderBotRouter
+	WafYaraRouter
+	WafGrpcDescriptorRouter
 }
 type PublicApiGroup struct {
 	LoginRouter
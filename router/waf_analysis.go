@@ -14,4 +14,5 @@ func (receiver *AnalysisRouter) InitAnalysisRouter(group *gin.RouterGroup) {
 	//数据分析
 	router.GET("/api/v1/analysis/wafanalysisdaycountryrange", analysisApi.StatAnalysisDayCountryRangeApi)
 	router.GET("/api/v1/analysis/spider", analysisApi.AnalysisSpiderRangeApi)
+	router.GET("/api/v1/analysis/spiderreport", analysisApi.AnalysisSpiderReportApi)
 }
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"SamWaf/api"
+	"github.com/gin-gonic/gin"
+)
+
+type WafApiSpecRouter struct{}
+
+func (r *WafApiSpecRouter) InitWafApiSpecRouter(group *gin.RouterGroup) {
+	a := api.APIGroupAPP.WafApiSpecApi
+	router := group.Group("")
+	router.POST("/api/v1/wafhost/apispec/add", a.AddApi)
+	router.POST("/api/v1/wafhost/apispec/list", a.GetListApi)
+	router.GET("/api/v1/wafhost/apispec/detail", a.GetDetailApi)
+	router.POST("/api/v1/wafhost/apispec/edit", a.ModifyApi)
+	router.GET("/api/v1/wafhost/apispec/del", a.DelApi)
+	router.POST("/api/v1/wafhost/apispec/learn", a.LearnApi)
+}
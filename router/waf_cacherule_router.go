@@ -16,4 +16,5 @@ func (receiver *WafCacheRuleRouter) InitWafCacheRuleRouter(group *gin.RouterGrou
 	router.GET("/api/v1/wafhost/cacherule/detail", api.GetDetailApi)
 	router.POST("/api/v1/wafhost/cacherule/edit", api.ModifyApi)
 	router.GET("/api/v1/wafhost/cacherule/del", api.DelApi)
+	router.POST("/api/v1/wafhost/cache/purge", api.PurgeApi)
 }
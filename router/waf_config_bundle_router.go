@@ -0,0 +1,19 @@
+package router
+
+import (
+	"SamWaf/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WafConfigBundleRouter struct {
+}
+
+// InitWafConfigBundleRouter 配置即代码：网站配置导出/预览变更/应用
+func (receiver *WafConfigBundleRouter) InitWafConfigBundleRouter(group *gin.RouterGroup) {
+	api := api.APIGroupAPP.WafConfigBundleApi
+	router := group.Group("")
+	router.POST("/api/v1/configbundle/export", api.ExportApi)
+	router.POST("/api/v1/configbundle/plan", api.PlanApi)
+	router.POST("/api/v1/configbundle/apply", api.ApplyApi)
+}
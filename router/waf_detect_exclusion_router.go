@@ -0,0 +1,19 @@
+package router
+
+import (
+	"SamWaf/api"
+	"github.com/gin-gonic/gin"
+)
+
+type WafDetectExclusionRouter struct{}
+
+func (r *WafDetectExclusionRouter) InitWafDetectExclusionRouter(group *gin.RouterGroup) {
+	a := api.APIGroupAPP.WafDetectExclusionApi
+	router := group.Group("")
+	router.POST("/api/v1/wafhost/detectexclusion/add", a.AddApi)
+	router.POST("/api/v1/wafhost/detectexclusion/fromlog", a.AddFromLogApi)
+	router.POST("/api/v1/wafhost/detectexclusion/list", a.GetListApi)
+	router.GET("/api/v1/wafhost/detectexclusion/detail", a.GetDetailApi)
+	router.POST("/api/v1/wafhost/detectexclusion/edit", a.ModifyApi)
+	router.GET("/api/v1/wafhost/detectexclusion/del", a.DelApi)
+}
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"SamWaf/api"
+	"github.com/gin-gonic/gin"
+)
+
+type WafGrpcDescriptorRouter struct{}
+
+func (r *WafGrpcDescriptorRouter) InitWafGrpcDescriptorRouter(group *gin.RouterGroup) {
+	a := api.APIGroupAPP.WafGrpcDescriptorApi
+	router := group.Group("")
+	router.POST("/api/v1/grpc_descriptor/upload", a.UploadApi)
+	router.POST("/api/v1/grpc_descriptor/list", a.GetListApi)
+	router.GET("/api/v1/grpc_descriptor/detail", a.GetDetailApi)
+	router.POST("/api/v1/grpc_descriptor/edit", a.ModifyApi)
+	router.GET("/api/v1/grpc_descriptor/del", a.DelApi)
+}
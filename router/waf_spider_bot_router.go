@@ -0,0 +1,18 @@
+package router
+
+import (
+	"SamWaf/api"
+	"github.com/gin-gonic/gin"
+)
+
+type WafSpiderBotRouter struct{}
+
+func (r *WafSpiderBotRouter) InitWafSpiderBotRouter(group *gin.RouterGroup) {
+	a := api.APIGroupAPP.WafSpiderBotApi
+	router := group.Group("")
+	router.POST("/api/v1/spiderbot/add", a.AddApi)
+	router.POST("/api/v1/spiderbot/list", a.GetListApi)
+	router.GET("/api/v1/spiderbot/detail", a.GetDetailApi)
+	router.POST("/api/v1/spiderbot/edit", a.ModifyApi)
+	router.GET("/api/v1/spiderbot/del", a.DelApi)
+}
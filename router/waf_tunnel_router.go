@@ -9,6 +9,7 @@ type WafTunnelRouter struct {
 }
 
 func (receiver *WafTunnelRouter) InitWafTunnelRouter(group *gin.RouterGroup) {
+	lbApi := api.APIGroupAPP.WafTunnelLoadBalanceApi
 	api := api.APIGroupAPP.WafTunnelApi
 	router := group.Group("")
 	router.POST("/api/v1/tunnel/tunnel/add", api.AddApi)
@@ -17,4 +18,14 @@ func (receiver *WafTunnelRouter) InitWafTunnelRouter(group *gin.RouterGroup) {
 	router.POST("/api/v1/tunnel/tunnel/edit", api.ModifyApi)
 	router.GET("/api/v1/tunnel/tunnel/del", api.DelApi)
 	router.GET("/api/v1/tunnel/tunnel/connections", api.GetTunnelConnectionsApi)
+	router.POST("/api/v1/tunnel/conn/kill", api.KillConnectionApi)
+	router.POST("/api/v1/tunnel/connlog/list", api.GetConnLogListApi)
+	router.POST("/api/v1/tunnel/stats", api.GetTunnelStatsApi)
+
+	router.POST("/api/v1/tunnel/loadbalance/add", lbApi.AddApi)
+	router.POST("/api/v1/tunnel/loadbalance/list", lbApi.GetListApi)
+	router.GET("/api/v1/tunnel/loadbalance/detail", lbApi.GetDetailApi)
+	router.POST("/api/v1/tunnel/loadbalance/edit", lbApi.ModifyApi)
+	router.GET("/api/v1/tunnel/loadbalance/del", lbApi.DelApi)
+	router.GET("/api/v1/tunnel/loadbalance/health", lbApi.GetHealthApi)
 }
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"SamWaf/api"
+	"github.com/gin-gonic/gin"
+)
+
+type WafYaraRouter struct{}
+
+func (r *WafYaraRouter) InitWafYaraRouter(group *gin.RouterGroup) {
+	a := api.APIGroupAPP.WafYaraApi
+	router := group.Group("")
+	router.POST("/api/v1/yara/add", a.AddApi)
+	router.POST("/api/v1/yara/upload", a.UploadApi)
+	router.POST("/api/v1/yara/list", a.GetListApi)
+	router.GET("/api/v1/yara/detail", a.GetDetailApi)
+	router.POST("/api/v1/yara/edit", a.ModifyApi)
+	router.GET("/api/v1/yara/del", a.DelApi)
+}
@@ -24,11 +24,12 @@ func (receiver *WafWhiteIpService) AddApi(wafWhiteIpAddReq request.WafAllowIpAdd
 			CREATE_TIME: customtype.JsonTime(time.Now()),
 			UPDATE_TIME: customtype.JsonTime(time.Now()),
 		},
-		HostCode:  wafWhiteIpAddReq.HostCode,
-		Ip:        wafWhiteIpAddReq.Ip,
-		Remarks:   wafWhiteIpAddReq.Remarks,
-		IpType:    wafWhiteIpAddReq.IpType,
-		GroupCode: wafWhiteIpAddReq.GroupCode,
+		HostCode:   wafWhiteIpAddReq.HostCode,
+		Ip:         wafWhiteIpAddReq.Ip,
+		Remarks:    wafWhiteIpAddReq.Remarks,
+		ExpireTime: model.ResolveListExpireTime(wafWhiteIpAddReq.ExpireHours, wafWhiteIpAddReq.ExpireTime, time.Now().Unix()),
+		IpType:     wafWhiteIpAddReq.IpType,
+		GroupCode:  wafWhiteIpAddReq.GroupCode,
 	}
 	global.GWAF_LOCAL_DB.Create(wafHost)
 	return nil
@@ -64,6 +65,7 @@ func (receiver *WafWhiteIpService) ModifyApi(wafWhiteIpEditReq request.WafAllowI
 		"host_code":   wafWhiteIpEditReq.HostCode,
 		"Ip":          wafWhiteIpEditReq.Ip,
 		"Remarks":     wafWhiteIpEditReq.Remarks,
+		"expire_time": model.ResolveListExpireTime(wafWhiteIpEditReq.ExpireHours, wafWhiteIpEditReq.ExpireTime, time.Now().Unix()),
 		"ip_type":     wafWhiteIpEditReq.IpType,
 		"group_code":  wafWhiteIpEditReq.GroupCode,
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
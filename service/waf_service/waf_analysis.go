@@ -6,6 +6,7 @@ import (
 	"SamWaf/model"
 	"SamWaf/model/request"
 	response2 "SamWaf/model/response"
+	"strings"
 )
 
 type WafAnalysisService struct{}
@@ -43,3 +44,31 @@ func (receiver *WafAnalysisService) AnalysisSpiderApi(req request.WafAnalysisSpi
 	}
 	return CountOfRange
 }
+
+// AnalysisSpiderReportApi 按爬虫汇总请求数、拦截数、流量，类别从爬虫库补齐
+func (receiver *WafAnalysisService) AnalysisSpiderReportApi(req request.WafAnalysisSpiderReq) []response2.WafAnalysisSpiderReportResp {
+	var list []response2.WafAnalysisSpiderReportResp
+	query := global.GWAF_LOCAL_LOG_DB.Model(&innerbean.WebLog{}).Where("day between ? and ? and  is_bot=1 ", req.StartDay, req.EndDay)
+	if req.Host != "" {
+		query = query.Where("host_code = ? ", req.Host)
+	}
+	query.Select(" guest_id_entification as name ,count(1) as requests ,"+
+		"sum(case when action in (?, ?) then 1 else 0 end) as blocked ,sum(res_content_length) as bytes ,max(unix_add_time) as last_time", "阻止", "禁止").
+		Group("guest_id_entification").Order("count(1) desc").Scan(&list)
+
+	var bots []model.SpiderBot
+	global.GWAF_LOCAL_DB.Select("name, category").Find(&bots)
+	categories := make(map[string]string, len(bots))
+	for _, bot := range bots {
+		categories[bot.Name] = bot.Category
+	}
+	for i := range list {
+		name := list[i].Name
+		if strings.HasPrefix(name, "伪装") {
+			list[i].IsFake = true
+			name = strings.TrimPrefix(name, "伪装")
+		}
+		list[i].Category = categories[name]
+	}
+	return list
+}
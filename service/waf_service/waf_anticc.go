@@ -9,6 +9,8 @@ import (
 	"SamWaf/model/request"
 	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type WafAntiCCService struct{}
@@ -17,7 +19,7 @@ var WafAntiCCServiceApp = new(WafAntiCCService)
 
 func (receiver *WafAntiCCService) AddApi(req request.WafAntiCCAddReq) error {
 	var existingRecord model.AntiCC
-	result := global.GWAF_LOCAL_DB.Where("host_code = ?", req.HostCode).First(&existingRecord)
+	result := whereAntiCCKey(req.HostCode, req.LimitKey).First(&existingRecord)
 	if result.Error == nil {
 		// 记录已存在，返回错误
 		return errors.New("当前网站已存在CC防护配置")
@@ -39,6 +41,9 @@ func (receiver *WafAntiCCService) AddApi(req request.WafAntiCCAddReq) error {
 		LimitMode:     req.LimitMode,
 		IsEnableRule:  req.IsEnableRule,
 		SkipGlobalCC:  req.SkipGlobalCC,
+		Action:        req.Action,
+		Escalation:    req.Escalation,
+		LimitKey:      req.LimitKey,
 		RuleContent:   req.RuleContent,
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
@@ -46,15 +51,22 @@ func (receiver *WafAntiCCService) AddApi(req request.WafAntiCCAddReq) error {
 }
 
 func (receiver *WafAntiCCService) CheckIsExistApi(req request.WafAntiCCAddReq) error {
-	// 仅按 host_code 判断是否已存在（与 AddApi 一致）；tenant/user 由 before_query 自动追加。
-	// 注意：占位符数必须与参数数一致，多传参数会整体顺移导致 "expected N arguments, got N+1"。
-	return global.GWAF_LOCAL_DB.First(&model.AntiCC{}, "host_code = ?", req.HostCode).Error
+	// 按 host_code + 限流键判断是否已存在（与 AddApi 一致）；tenant/user 由 before_query 自动追加。
+	return whereAntiCCKey(req.HostCode, req.LimitKey).First(&model.AntiCC{}).Error
+}
+
+// whereAntiCCKey 按IP限流每个网站只有一条(limit_key 为空)，按键限流每个网站每个限流键一条
+func whereAntiCCKey(hostCode string, limitKey string) *gorm.DB {
+	if limitKey == "" {
+		return global.GWAF_LOCAL_DB.Where("host_code = ? and (limit_key = '' or limit_key is null)", hostCode)
+	}
+	return global.GWAF_LOCAL_DB.Where("host_code = ? and limit_key = ?", hostCode, limitKey)
 }
 func (receiver *WafAntiCCService) ModifyApi(req request.WafAntiCCEditReq) error {
 	var ipWhite model.AntiCC
-	global.GWAF_LOCAL_DB.Where("host_code = ?", req.HostCode).Find(&ipWhite)
-	if ipWhite.Id != "" && ipWhite.Url != req.Url {
-		return errors.New("当前网站已经存在")
+	whereAntiCCKey(req.HostCode, req.LimitKey).Find(&ipWhite)
+	if ipWhite.Id != "" && ipWhite.Id != req.Id {
+		return errors.New("当前网站已存在相同限流键的CC防护配置")
 	}
 	ipWhiteMap := map[string]interface{}{
 		"host_code":     req.HostCode,
@@ -67,6 +79,9 @@ func (receiver *WafAntiCCService) ModifyApi(req request.WafAntiCCEditReq) error
 		"LimitMode":     req.LimitMode,
 		"IsEnableRule":  req.IsEnableRule,
 		"SkipGlobalCC":  req.SkipGlobalCC,
+		"Action":        req.Action,
+		"Escalation":    req.Escalation,
+		"LimitKey":      req.LimitKey,
 		"RuleContent":   req.RuleContent,
 	}
 	err := global.GWAF_LOCAL_DB.Model(model.AntiCC{}).Where("id = ?", req.Id).Updates(ipWhiteMap).Error
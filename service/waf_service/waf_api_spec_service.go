@@ -0,0 +1,177 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"SamWaf/wafenginecore/wafapispec"
+	"errors"
+	"strings"
+	"time"
+)
+
+type WafApiSpecService struct{}
+
+var WafApiSpecServiceApp = new(WafApiSpecService)
+
+// CheckParam 校验模式并试编译规范，规范有错时在保存前就报出来
+func (s *WafApiSpecService) CheckParam(mode string, pathPrefix string, content string) error {
+	if mode != model.ApiSpecModeLog && mode != model.ApiSpecModeEnforce {
+		return errors.New("校验模式只能是 log 或 enforce")
+	}
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		return errors.New("路径前缀必须以 / 开头")
+	}
+	_, err := wafapispec.Compile(model.ApiSpec{PathPrefix: pathPrefix, SpecContent: content, Mode: mode})
+	return err
+}
+
+func (s *WafApiSpecService) AddApi(req request.WafApiSpecAddReq) error {
+	bean := &model.ApiSpec{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		HostCode:    req.HostCode,
+		PathPrefix:  req.PathPrefix,
+		StripPrefix: req.StripPrefix,
+		SpecContent: req.SpecContent,
+		Mode:        req.Mode,
+		Status:      req.Status,
+		Remarks:     req.Remarks,
+	}
+	return global.GWAF_LOCAL_DB.Create(bean).Error
+}
+
+func (s *WafApiSpecService) CheckIsExistApi(req request.WafApiSpecAddReq) int {
+	var total int64
+	global.GWAF_LOCAL_DB.Model(&model.ApiSpec{}).
+		Where("host_code=? AND path_prefix=?", req.HostCode, req.PathPrefix).
+		Count(&total)
+	return int(total)
+}
+
+func (s *WafApiSpecService) ModifyApi(req request.WafApiSpecEditReq) error {
+	var bean model.ApiSpec
+	global.GWAF_LOCAL_DB.Model(&model.ApiSpec{}).
+		Where("host_code=? AND path_prefix=?", req.HostCode, req.PathPrefix).
+		Limit(1).Find(&bean)
+
+	if bean.Id != "" && bean.Id != req.Id {
+		return errors.New("当前记录已经存在")
+	}
+
+	beanMap := map[string]interface{}{
+		"HostCode":    req.HostCode,
+		"PathPrefix":  req.PathPrefix,
+		"StripPrefix": req.StripPrefix,
+		"SpecContent": req.SpecContent,
+		"Mode":        req.Mode,
+		"Status":      req.Status,
+		"Remarks":     req.Remarks,
+		"UPDATE_TIME": customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.ApiSpec{}).Where("id = ?", req.Id).Updates(beanMap).Error
+}
+
+func (s *WafApiSpecService) GetDetailApi(req request.WafApiSpecDetailReq) model.ApiSpec {
+	var bean model.ApiSpec
+	global.GWAF_LOCAL_DB.Where("id=?", req.Id).Find(&bean)
+	return bean
+}
+
+func (s *WafApiSpecService) GetDetailByIdApi(id string) model.ApiSpec {
+	var bean model.ApiSpec
+	global.GWAF_LOCAL_DB.Where("id=?", id).Find(&bean)
+	return bean
+}
+
+func (s *WafApiSpecService) GetListApi(req request.WafApiSpecSearchReq) ([]model.ApiSpec, int64, error) {
+	var list []model.ApiSpec
+	var total int64
+
+	query := global.GWAF_LOCAL_DB.Model(&model.ApiSpec{})
+	if len(req.HostCode) > 0 {
+		query = query.Where("host_code=?", req.HostCode)
+	}
+
+	query.Count(&total)
+	query.Order("create_time desc").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list)
+
+	return list, total, nil
+}
+
+func (s *WafApiSpecService) DelApi(req request.WafApiSpecDelReq) error {
+	var bean model.ApiSpec
+	if err := global.GWAF_LOCAL_DB.Where("id = ?", req.Id).First(&bean).Error; err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.ApiSpec{}).Error
+}
+
+func (s *WafApiSpecService) GetListByHostCode(hostCode string) []model.ApiSpec {
+	var list []model.ApiSpec
+	global.GWAF_LOCAL_DB.Where("host_code=?", hostCode).Order("create_time asc").Find(&list)
+	return list
+}
+
+// LearnApi 取该网站最近放行且未命中任何规则的访问日志，生成 OpenAPI 规范草稿（YAML），返回草稿与样本数。
+// 草稿里的路径是完整路径，保存时不要勾选 StripPrefix。
+func (s *WafApiSpecService) LearnApi(req request.WafApiSpecLearnReq) (string, int, error) {
+	if req.HostCode == "" {
+		return "", 0, errors.New("请选择网站")
+	}
+	if req.Days <= 0 {
+		req.Days = 7
+	}
+	if req.Limit <= 0 {
+		req.Limit = 5000
+	}
+	if req.Limit > 50000 {
+		req.Limit = 50000
+	}
+	cutoff := time.Now().AddDate(0, 0, -req.Days).Unix()
+	query := global.GWAF_LOCAL_LOG_DB.Model(&innerbean.WebLog{}).
+		Select("METHOD", "URL", "RawQuery", "BODY", "POST_FORM").
+		Where("host_code = ? AND unix_add_time >= ? AND action = ? AND (rule = '' OR rule IS NULL)", req.HostCode, cutoff, "放行")
+	if req.PathPrefix != "" {
+		query = query.Where("url like ?", req.PathPrefix+"%")
+	}
+	var rows []innerbean.WebLog
+	if err := query.Order("unix_add_time desc").Limit(req.Limit).Find(&rows).Error; err != nil {
+		return "", 0, err
+	}
+	if len(rows) == 0 {
+		return "", 0, errors.New("所选时间范围内没有可供学习的正常请求日志")
+	}
+	samples := make([]wafapispec.Sample, 0, len(rows))
+	for _, row := range rows {
+		path := row.URL
+		if idx := strings.IndexByte(path, '?'); idx >= 0 {
+			path = path[:idx]
+		}
+		samples = append(samples, wafapispec.Sample{
+			Method:   row.METHOD,
+			Path:     path,
+			RawQuery: row.RawQuery,
+			Body:     row.BODY,
+			PostForm: row.POST_FORM,
+		})
+	}
+	doc := wafapispec.Learn(samples, req.HostCode+" 自动学习草稿")
+	content, err := wafapispec.Marshal(doc)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(content), len(samples), nil
+}
@@ -24,11 +24,12 @@ func (receiver *WafBlockIpService) AddApi(req request.WafBlockIpAddReq) error {
 			CREATE_TIME: customtype.JsonTime(time.Now()),
 			UPDATE_TIME: customtype.JsonTime(time.Now()),
 		},
-		HostCode:  req.HostCode,
-		Ip:        req.Ip,
-		Remarks:   req.Remarks,
-		IpType:    req.IpType,
-		GroupCode: req.GroupCode,
+		HostCode:   req.HostCode,
+		Ip:         req.Ip,
+		Remarks:    req.Remarks,
+		ExpireTime: model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix()),
+		IpType:     req.IpType,
+		GroupCode:  req.GroupCode,
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
 	return nil
@@ -63,6 +64,7 @@ func (receiver *WafBlockIpService) ModifyApi(req request.WafBlockIpEditReq) erro
 		"host_code":   req.HostCode,
 		"Ip":          req.Ip,
 		"Remarks":     req.Remarks,
+		"expire_time": model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix()),
 		"ip_type":     req.IpType,
 		"group_code":  req.GroupCode,
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
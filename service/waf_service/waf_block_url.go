@@ -28,6 +28,7 @@ func (receiver *WafBlockUrlService) AddApi(req request.WafBlockUrlAddReq) error
 		Url:         req.Url,
 		CompareType: req.CompareType,
 		Remarks:     req.Remarks,
+		ExpireTime:  model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix()),
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
 	return nil
@@ -48,6 +49,7 @@ func (receiver *WafBlockUrlService) ModifyApi(req request.WafBlockUrlEditReq) er
 		"host_code":   req.HostCode,
 		"Url":         req.Url,
 		"Remarks":     req.Remarks,
+		"expire_time": model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix()),
 		"CompareType": req.CompareType,
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
 	}
@@ -33,6 +33,7 @@ func (receiver *WafBlockingPageService) AddApi(req request.WafBlockingPageAddReq
 		ResponseHeader:   req.ResponseHeader,
 		ResponseContent:  req.ResponseContent,
 		ContentPriority:  req.ContentPriority,
+		ContentType:      req.ContentType,
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
 	return nil
@@ -69,6 +70,16 @@ func (receiver *WafBlockingPageService) CheckIsExistApi(req request.WafBlockingP
 		whereField = whereField + " response_code=? "
 	}
 
+	// 同一响应码可以按响应格式各配一份；html 兼容存量行的空值
+	if len(whereField) > 0 {
+		whereField = whereField + " and "
+	}
+	if model.NormalizeBlockingPageContentType(req.ContentType) == model.BlockingPageContentTypeHTML {
+		whereField = whereField + " (content_type is null or content_type in ('', 'html')) "
+	} else {
+		whereField = whereField + " content_type=? "
+	}
+
 	//where字段赋值
 
 	if len(req.BlockingType) > 0 {
@@ -89,6 +100,10 @@ func (receiver *WafBlockingPageService) CheckIsExistApi(req request.WafBlockingP
 		}
 	}
 
+	if model.NormalizeBlockingPageContentType(req.ContentType) != model.BlockingPageContentTypeHTML {
+		whereValues = append(whereValues, req.ContentType)
+	}
+
 	global.GWAF_LOCAL_DB.Model(&model.BlockingPage{}).Where(whereField, whereValues...).Count(&total)
 	return int(total)
 }
@@ -126,6 +141,16 @@ func (receiver *WafBlockingPageService) ModifyApi(req request.WafBlockingPageEdi
 		whereField = whereField + " response_code=? "
 	}
 
+	// 同一响应码可以按响应格式各配一份；html 兼容存量行的空值
+	if len(whereField) > 0 {
+		whereField = whereField + " and "
+	}
+	if model.NormalizeBlockingPageContentType(req.ContentType) == model.BlockingPageContentTypeHTML {
+		whereField = whereField + " (content_type is null or content_type in ('', 'html')) "
+	} else {
+		whereField = whereField + " content_type=? "
+	}
+
 	//where字段赋值
 
 	if len(req.BlockingType) > 0 {
@@ -140,6 +165,10 @@ func (receiver *WafBlockingPageService) ModifyApi(req request.WafBlockingPageEdi
 		whereValues = append(whereValues, req.ResponseCode)
 	}
 
+	if model.NormalizeBlockingPageContentType(req.ContentType) != model.BlockingPageContentTypeHTML {
+		whereValues = append(whereValues, req.ContentType)
+	}
+
 	global.GWAF_LOCAL_DB.Model(&model.BlockingPage{}).Where(whereField, whereValues...).Count(&total)
 	// 查询是否已存在记录
 	var bean model.BlockingPage
@@ -159,6 +188,7 @@ func (receiver *WafBlockingPageService) ModifyApi(req request.WafBlockingPageEdi
 		"ResponseHeader":   req.ResponseHeader,
 		"ResponseContent":  req.ResponseContent,
 		"ContentPriority":  req.ContentPriority,
+		"ContentType":      req.ContentType,
 
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
 	}
@@ -7,6 +7,8 @@ import (
 	"SamWaf/model"
 	"SamWaf/model/baseorm"
 	"SamWaf/model/request"
+	"SamWaf/wafenginecore/wafwebcache"
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -25,15 +27,19 @@ func (receiver *WafCacheRuleService) AddApi(req request.WafCacheRuleAddReq) erro
 			UPDATE_TIME: customtype.JsonTime(time.Now()),
 		},
 
-		HostCode:      req.HostCode,
-		RuleName:      req.RuleName,
-		RuleType:      req.RuleType,
-		RuleContent:   req.RuleContent,
-		ParamType:     req.ParamType,
-		CacheTime:     req.CacheTime,
-		Priority:      req.Priority,
-		RequestMethod: req.RequestMethod,
-		Remarks:       req.Remarks,
+		HostCode:             req.HostCode,
+		RuleName:             req.RuleName,
+		RuleType:             req.RuleType,
+		RuleContent:          req.RuleContent,
+		ParamType:            req.ParamType,
+		CacheTime:            req.CacheTime,
+		Priority:             req.Priority,
+		RequestMethod:        req.RequestMethod,
+		OverrideOrigin:       req.OverrideOrigin,
+		CacheSetCookie:       req.CacheSetCookie,
+		StaleWhileRevalidate: req.StaleWhileRevalidate,
+		StaleIfError:         req.StaleIfError,
+		Remarks:              req.Remarks,
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
 	return nil
@@ -124,16 +130,20 @@ func (receiver *WafCacheRuleService) ModifyApi(req request.WafCacheRuleEditReq)
 
 	beanMap := map[string]interface{}{
 
-		"HostCode":      req.HostCode,
-		"RuleName":      req.RuleName,
-		"RuleType":      req.RuleType,
-		"RuleContent":   req.RuleContent,
-		"ParamType":     req.ParamType,
-		"CacheTime":     req.CacheTime,
-		"Priority":      req.Priority,
-		"RequestMethod": req.RequestMethod,
-		"Remarks":       req.Remarks,
-		"UPDATE_TIME":   customtype.JsonTime(time.Now()),
+		"HostCode":             req.HostCode,
+		"RuleName":             req.RuleName,
+		"RuleType":             req.RuleType,
+		"RuleContent":          req.RuleContent,
+		"ParamType":            req.ParamType,
+		"CacheTime":            req.CacheTime,
+		"Priority":             req.Priority,
+		"RequestMethod":        req.RequestMethod,
+		"OverrideOrigin":       req.OverrideOrigin,
+		"CacheSetCookie":       req.CacheSetCookie,
+		"StaleWhileRevalidate": req.StaleWhileRevalidate,
+		"StaleIfError":         req.StaleIfError,
+		"Remarks":              req.Remarks,
+		"UPDATE_TIME":          customtype.JsonTime(time.Now()),
 	}
 	err := global.GWAF_LOCAL_DB.Model(model.CacheRule{}).Where("id = ?", req.Id).Updates(beanMap).Error
 
@@ -183,3 +193,19 @@ func (receiver *WafCacheRuleService) DelApi(req request.WafCacheRuleDelReq) erro
 	err = global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.CacheRule{}).Error
 	return err
 }
+
+// PurgeApi 清理网站缓存（内存与文件），返回清理的条目数
+func (receiver *WafCacheRuleService) PurgeApi(req request.WafCachePurgeReq) (int, error) {
+	var host model.Hosts
+	global.GWAF_LOCAL_DB.Where("code = ?", req.HostCode).Find(&host)
+	if host.Code == "" {
+		return 0, errors.New("网站不存在")
+	}
+	cacheConfig := model.CacheConfig{}
+	if host.CacheJSON != "" {
+		if err := json.Unmarshal([]byte(host.CacheJSON), &cacheConfig); err != nil {
+			return 0, errors.New("网站缓存配置解析失败")
+		}
+	}
+	return wafwebcache.Purge(host.Code, cacheConfig, req.PurgeType, req.Values)
+}
@@ -0,0 +1,175 @@
+package waf_service
+
+import (
+	"SamWaf/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// bundleKind 配置包里一类网站下属配置的描述。新增一类可导出的配置只需在 configBundleKinds 里登记一项。
+type bundleKind struct {
+	name      string                                   // 配置包里的类型名
+	newList   func() interface{}                       // 返回 *[]T
+	newItem   func() interface{}                       // 返回 *T
+	keyFields []string                                 // 组成业务键的字段(json 名)；为空表示每个网站只有一条
+	where     string                                   // 额外的查询条件（如排除已删除规则）
+	secrets   []string                                 // 敏感字段，导出为 ${private:key} 引用
+	volatile  []string                                 // 运行期字段，不导出也不比对
+	transient func(item map[string]interface{}) bool   // 临时条目：不导出，prune 时也不删
+	check     func(item map[string]interface{}) string // 目标环境校验，返回非空即为错误信息
+}
+
+// bundleBaseFields 每一类都不导出的公共字段：数据库主键、租户、时间戳、归属网站
+var bundleBaseFields = []string{"id", "user_code", "tenant_id", "create_time", "update_time", "host_code"}
+
+// temporaryListEntry 带到期时间的名单条目是运行期封禁，不属于声明式配置
+func temporaryListEntry(item map[string]interface{}) bool {
+	v, _ := item["expire_time"].(float64)
+	return v > 0
+}
+
+// checkIPGroupRef 引用IP组的名单条目要求目标环境已有该组（IP组是租户级资源，不随网站导出）
+func checkIPGroupRef(item map[string]interface{}) string {
+	if item["ip_type"] != model.IPEntryTypeGroup {
+		return ""
+	}
+	code, _ := item["group_code"].(string)
+	if code == "" || WafIPGroupServiceApp.GetDetailByCodeApi(code).GroupCode == "" {
+		return "引用的IP组在目标环境不存在: " + code
+	}
+	return ""
+}
+
+var configBundleKinds = []bundleKind{
+	{
+		name:      "rules",
+		newList:   func() interface{} { return &[]model.Rules{} },
+		newItem:   func() interface{} { return &model.Rules{} },
+		keyFields: []string{"rule_code"},
+		where:     "rule_status <> 999",
+		volatile:  []string{"salience"},
+	},
+	{
+		name:      "ip_allow",
+		newList:   func() interface{} { return &[]model.IPAllowList{} },
+		newItem:   func() interface{} { return &model.IPAllowList{} },
+		keyFields: []string{"ip_type", "ip", "group_code"},
+		transient: temporaryListEntry,
+		check:     checkIPGroupRef,
+	},
+	{
+		name:      "ip_block",
+		newList:   func() interface{} { return &[]model.IPBlockList{} },
+		newItem:   func() interface{} { return &model.IPBlockList{} },
+		keyFields: []string{"ip_type", "ip", "group_code"},
+		transient: temporaryListEntry,
+		check:     checkIPGroupRef,
+	},
+	{
+		name:      "url_allow",
+		newList:   func() interface{} { return &[]model.URLAllowList{} },
+		newItem:   func() interface{} { return &model.URLAllowList{} },
+		keyFields: []string{"compare_type", "url"},
+	},
+	{
+		name:      "url_block",
+		newList:   func() interface{} { return &[]model.URLBlockList{} },
+		newItem:   func() interface{} { return &model.URLBlockList{} },
+		keyFields: []string{"compare_type", "url"},
+		transient: temporaryListEntry,
+	},
+	{
+		name:      "ldp_url",
+		newList:   func() interface{} { return &[]model.LDPUrl{} },
+		newItem:   func() interface{} { return &model.LDPUrl{} },
+		keyFields: []string{"compare_type", "url"},
+	},
+	{
+		name:      "anti_cc",
+		newList:   func() interface{} { return &[]model.AntiCC{} },
+		newItem:   func() interface{} { return &model.AntiCC{} },
+		keyFields: []string{"limit_key"},
+	},
+	{
+		name:      "cache_rules",
+		newList:   func() interface{} { return &[]model.CacheRule{} },
+		newItem:   func() interface{} { return &model.CacheRule{} },
+		keyFields: []string{"rule_name"},
+	},
+	{
+		name:      "path_rules",
+		newList:   func() interface{} { return &[]model.HostPathRule{} },
+		newItem:   func() interface{} { return &model.HostPathRule{} },
+		keyFields: []string{"rule_name"},
+	},
+	{
+		name:      "blocking_pages",
+		newList:   func() interface{} { return &[]model.BlockingPage{} },
+		newItem:   func() interface{} { return &model.BlockingPage{} },
+		keyFields: []string{"blocking_type", "response_code", "content_type", "attack_type"},
+	},
+	{
+		name:      "load_balance",
+		newList:   func() interface{} { return &[]model.LoadBalance{} },
+		newItem:   func() interface{} { return &model.LoadBalance{} },
+		keyFields: []string{"remote_ip", "remote_port"},
+	},
+	{
+		name:      "http_auth",
+		newList:   func() interface{} { return &[]model.HttpAuthBase{} },
+		newItem:   func() interface{} { return &model.HttpAuthBase{} },
+		keyFields: []string{"user_name"},
+		secrets:   []string{"password"},
+	},
+	{
+		name:      "detect_exclusions",
+		newList:   func() interface{} { return &[]model.DetectExclusion{} },
+		newItem:   func() interface{} { return &model.DetectExclusion{} },
+		keyFields: []string{"detector", "compare_type", "path", "arg_source", "arg_name"},
+	},
+	{
+		name:      "api_specs",
+		newList:   func() interface{} { return &[]model.ApiSpec{} },
+		newItem:   func() interface{} { return &model.ApiSpec{} },
+		keyFields: []string{"path_prefix"},
+	},
+}
+
+// bundleItemKey 由业务字段拼出条目键。值先经过 JSON 归一化，YAML 的 int 和 JSON 的 float64 得到同一个键。
+func bundleItemKey(kind bundleKind, item map[string]interface{}) string {
+	if len(kind.keyFields) == 0 {
+		return "default"
+	}
+	parts := make([]string, 0, len(kind.keyFields))
+	for _, f := range kind.keyFields {
+		v := item[f]
+		if v == nil {
+			v = ""
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, "|")
+}
+
+// normalizeBundleValue JSON 往返一次：数字统一成 float64，结构体/自定义类型统一成 map/基础类型
+func normalizeBundleValue(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// stripBundleFields 删掉不导出的字段
+func stripBundleFields(item map[string]interface{}, fields ...[]string) {
+	for _, list := range fields {
+		for _, f := range list {
+			delete(item, f)
+		}
+	}
+}
@@ -0,0 +1,592 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+type WafConfigBundleService struct{}
+
+var WafConfigBundleServiceApp = new(WafConfigBundleService)
+
+// ConfigBundleHostChange apply 后需要通知引擎重新加载的网站。Created 为 true 时 OldHost 为空。
+type ConfigBundleHostChange struct {
+	HostCode string
+	Created  bool
+	OldHost  model.Hosts
+}
+
+// bundleOp plan 中的一项以及执行它所需的数据
+type bundleOp struct {
+	item     model.ConfigBundlePlanItem
+	kind     *bundleKind            // nil 表示网站本身
+	desired  map[string]interface{} // 已解析密钥/证书引用后的目标值
+	existing interface{}            // update 时为库里的行(*T)
+	id       string                 // delete 时的行主键
+}
+
+const bundleSecretPrefix = "${private:"
+
+var bundleSecretKeyCleaner = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ---------- 导出 ----------
+
+// ExportApi 导出单个网站(hostCode 非空)或全部网站的配置
+func (receiver *WafConfigBundleService) ExportApi(hostCode string) (model.ConfigBundle, error) {
+	bundle := model.ConfigBundle{
+		ApiVersion: model.ConfigBundleApiVersion,
+		Scope:      model.ConfigBundleScopeTenant,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Hosts:      []model.ConfigBundleHost{},
+	}
+	var hosts []model.Hosts
+	if hostCode != "" {
+		bundle.Scope = model.ConfigBundleScopeHost
+		global.GWAF_LOCAL_DB.Where("code = ?", hostCode).Find(&hosts)
+		if len(hosts) == 0 {
+			return bundle, errors.New("网站不存在: " + hostCode)
+		}
+	} else {
+		global.GWAF_LOCAL_DB.Order("create_time asc").Find(&hosts)
+	}
+
+	missing := map[string]struct{}{}
+	for i := range hosts {
+		hb, err := receiver.exportHost(hosts[i], missing)
+		if err != nil {
+			return bundle, err
+		}
+		bundle.Hosts = append(bundle.Hosts, hb)
+	}
+	for k := range missing {
+		bundle.MissingSecrets = append(bundle.MissingSecrets, k)
+	}
+	sort.Strings(bundle.MissingSecrets)
+	return bundle, nil
+}
+
+func (receiver *WafConfigBundleService) exportHost(h model.Hosts, missing map[string]struct{}) (model.ConfigBundleHost, error) {
+	hm, err := normalizeBundleValue(h)
+	if err != nil {
+		return model.ConfigBundleHost{}, err
+	}
+	stripBundleFields(hm, bundleBaseFields, []string{"code"})
+	// 证书按序列号引用，证书本身走证书夹自己的导入导出
+	if h.BindSslId != "" {
+		var ssl model.SslConfig
+		global.GWAF_LOCAL_DB.Where("id = ?", h.BindSslId).Limit(1).Find(&ssl)
+		hm["bind_ssl_serial"] = ssl.SerialNo
+	}
+	delete(hm, "bind_ssl_id")
+	if v, _ := hm["keyfile"].(string); v != "" {
+		hm["keyfile"] = receiver.secretRef(v, "samwaf."+h.Code+".host.keyfile", missing)
+	}
+
+	hb := model.ConfigBundleHost{
+		Code:      h.Code,
+		Host:      intifyBundleMap(hm),
+		Resources: map[string][]map[string]interface{}{},
+	}
+	for k := range configBundleKinds {
+		kind := &configBundleKinds[k]
+		rows, _, err := loadBundleRows(kind, h.Code)
+		if err != nil {
+			return hb, err
+		}
+		items := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if kind.transient != nil && kind.transient(row) {
+				continue
+			}
+			key := bundleItemKey(*kind, row)
+			stripBundleFields(row, bundleBaseFields, kind.volatile)
+			for _, f := range kind.secrets {
+				if v, _ := row[f].(string); v != "" {
+					row[f] = receiver.secretRef(v, "samwaf."+h.Code+"."+kind.name+"."+key+"."+f, missing)
+				}
+			}
+			items = append(items, intifyBundleMap(row))
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return bundleItemKey(*kind, items[i]) < bundleItemKey(*kind, items[j])
+		})
+		hb.Resources[kind.name] = items
+	}
+	return hb, nil
+}
+
+// secretRef 敏感值替换成密钥管理引用。密钥管理里已有相同值时直接引用该 key，
+// 否则按建议名引用并记入 missing，由使用者在目标环境补建。
+func (receiver *WafConfigBundleService) secretRef(value string, suggestKey string, missing map[string]struct{}) string {
+	var info model.PrivateInfo
+	global.GWAF_LOCAL_DB.Where("private_value = ?", value).Limit(1).Find(&info)
+	if info.PrivateKey != "" {
+		return bundleSecretPrefix + info.PrivateKey + "}"
+	}
+	key := bundleSecretKeyCleaner.ReplaceAllString(suggestKey, "_")
+	missing[key] = struct{}{}
+	return bundleSecretPrefix + key + "}"
+}
+
+// resolveSecret 把 ${private:key} 换成密钥管理里的值；不是引用的原样返回
+func (receiver *WafConfigBundleService) resolveSecret(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, bundleSecretPrefix) || !strings.HasSuffix(s, "}") {
+		return v, nil
+	}
+	key := strings.TrimSuffix(strings.TrimPrefix(s, bundleSecretPrefix), "}")
+	var info model.PrivateInfo
+	global.GWAF_LOCAL_DB.Where("private_key = ?", key).Limit(1).Find(&info)
+	if info.Id == "" {
+		return nil, errors.New("密钥管理中不存在: " + key)
+	}
+	return info.PrivateValue, nil
+}
+
+// ---------- 编解码 ----------
+
+// MarshalBundle format 为 json 时输出 JSON，其余输出 YAML
+func (receiver *WafConfigBundleService) MarshalBundle(bundle model.ConfigBundle, format string) ([]byte, error) {
+	if strings.EqualFold(format, "json") {
+		return json.MarshalIndent(bundle, "", "  ")
+	}
+	return yaml.Marshal(bundle)
+}
+
+// ParseBundle 自动识别 JSON/YAML（JSON 本身也是合法 YAML，这里只为给出更准确的报错）
+func (receiver *WafConfigBundleService) ParseBundle(content []byte) (model.ConfigBundle, error) {
+	var bundle model.ConfigBundle
+	trimmed := bytes.TrimSpace(content)
+	var err error
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		err = json.Unmarshal(trimmed, &bundle)
+	} else {
+		err = yaml.Unmarshal(trimmed, &bundle)
+	}
+	if err != nil {
+		return bundle, fmt.Errorf("配置文件解析失败: %w", err)
+	}
+	if bundle.ApiVersion != model.ConfigBundleApiVersion {
+		return bundle, fmt.Errorf("不支持的配置版本: %q，当前支持 %s", bundle.ApiVersion, model.ConfigBundleApiVersion)
+	}
+	return bundle, nil
+}
+
+// ---------- plan / apply ----------
+
+// PlanApi 计算把配置包应用到当前库需要做的变更，不落库。
+// prune 为 true 时，配置包里列出的类型中库里多出的条目计划删除；没列出的类型不受影响。
+func (receiver *WafConfigBundleService) PlanApi(bundle model.ConfigBundle, prune bool) model.ConfigBundlePlan {
+	ops := receiver.buildOps(bundle, prune)
+	return summarizeBundleOps(ops)
+}
+
+// ApplyApi 在一个事务里执行计划。计划中有错误项时整体拒绝，不做任何修改。
+func (receiver *WafConfigBundleService) ApplyApi(bundle model.ConfigBundle, prune bool) (model.ConfigBundlePlan, []ConfigBundleHostChange, error) {
+	ops := receiver.buildOps(bundle, prune)
+	plan := summarizeBundleOps(ops)
+	if plan.Errors > 0 {
+		return plan, nil, errors.New("计划中存在错误项，未做任何修改")
+	}
+	if len(ops) == 0 {
+		return plan, nil, nil
+	}
+
+	changed := map[string]*ConfigBundleHostChange{}
+	var order []string
+	markChanged := func(code string) *ConfigBundleHostChange {
+		if c, ok := changed[code]; ok {
+			return c
+		}
+		c := &ConfigBundleHostChange{HostCode: code}
+		changed[code] = c
+		order = append(order, code)
+		return c
+	}
+
+	err := global.GWAF_LOCAL_DB.Transaction(func(tx *gorm.DB) error {
+		now := customtype.JsonTime(time.Now())
+		for _, op := range ops {
+			c := markChanged(op.item.HostCode)
+			if op.kind == nil {
+				if err := applyBundleHostOp(tx, op, c, now); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := applyBundleResourceOp(tx, op, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return plan, nil, err
+	}
+
+	// 没有网站级变更的网站也要带上旧网站信息，引擎按"同域名同端口"走重新加载
+	list := make([]ConfigBundleHostChange, 0, len(order))
+	for _, code := range order {
+		c := changed[code]
+		if !c.Created && c.OldHost.Code == "" {
+			global.GWAF_LOCAL_DB.Where("code = ?", code).Limit(1).Find(&c.OldHost)
+		}
+		list = append(list, *c)
+	}
+	return plan, list, nil
+}
+
+func applyBundleHostOp(tx *gorm.DB, op bundleOp, c *ConfigBundleHostChange, now customtype.JsonTime) error {
+	switch op.item.Action {
+	case model.ConfigBundleActionCreate:
+		host := &model.Hosts{}
+		if err := fillBundleRow(host, op.desired); err != nil {
+			return err
+		}
+		host.BaseOrm = newBundleBase(now)
+		host.Code = op.item.HostCode
+		c.Created = true
+		return tx.Create(host).Error
+	case model.ConfigBundleActionUpdate:
+		host := op.existing.(*model.Hosts)
+		c.OldHost = *host
+		updated := *host
+		if err := fillBundleRow(&updated, op.desired); err != nil {
+			return err
+		}
+		updated.UPDATE_TIME = now
+		return tx.Save(&updated).Error
+	}
+	return nil
+}
+
+func applyBundleResourceOp(tx *gorm.DB, op bundleOp, now customtype.JsonTime) error {
+	switch op.item.Action {
+	case model.ConfigBundleActionCreate:
+		row := op.kind.newItem()
+		if err := fillBundleRow(row, op.desired); err != nil {
+			return err
+		}
+		v := reflect.ValueOf(row).Elem()
+		v.FieldByName("BaseOrm").Set(reflect.ValueOf(newBundleBase(now)))
+		v.FieldByName("HostCode").SetString(op.item.HostCode)
+		return tx.Create(row).Error
+	case model.ConfigBundleActionUpdate:
+		if err := fillBundleRow(op.existing, op.desired); err != nil {
+			return err
+		}
+		reflect.ValueOf(op.existing).Elem().FieldByName("BaseOrm").FieldByName("UPDATE_TIME").Set(reflect.ValueOf(now))
+		return tx.Save(op.existing).Error
+	case model.ConfigBundleActionDelete:
+		return tx.Where("id = ?", op.id).Delete(op.kind.newItem()).Error
+	}
+	return nil
+}
+
+func newBundleBase(now customtype.JsonTime) baseorm.BaseOrm {
+	return baseorm.BaseOrm{
+		Id:          uuid.GenUUID(),
+		USER_CODE:   global.GWAF_USER_CODE,
+		Tenant_ID:   global.GWAF_TENANT_ID,
+		CREATE_TIME: now,
+		UPDATE_TIME: now,
+	}
+}
+
+// fillBundleRow 用配置包里的字段覆盖行上的同名字段，配置包里没有的字段保持原值
+func fillBundleRow(row interface{}, desired map[string]interface{}) error {
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, row)
+}
+
+// buildOps 逐网站、逐类型比对配置包与库中现状
+func (receiver *WafConfigBundleService) buildOps(bundle model.ConfigBundle, prune bool) []bundleOp {
+	var ops []bundleOp
+	seenHost := map[string]struct{}{}
+	for _, hb := range bundle.Hosts {
+		if hb.Code == "" {
+			ops = append(ops, bundleErrorOp("", "host", "", "网站缺少 code"))
+			continue
+		}
+		if _, dup := seenHost[hb.Code]; dup {
+			ops = append(ops, bundleErrorOp(hb.Code, "host", hb.Code, "配置包中网站 code 重复"))
+			continue
+		}
+		seenHost[hb.Code] = struct{}{}
+		ops = append(ops, receiver.planHost(hb)...)
+		for k := range configBundleKinds {
+			kind := &configBundleKinds[k]
+			items, ok := hb.Resources[kind.name]
+			if !ok {
+				continue
+			}
+			ops = append(ops, receiver.planKind(hb.Code, kind, items, prune)...)
+		}
+	}
+	return ops
+}
+
+func bundleErrorOp(hostCode, kind, key, msg string) bundleOp {
+	return bundleOp{item: model.ConfigBundlePlanItem{HostCode: hostCode, Kind: kind, Key: key, Action: model.ConfigBundleActionError, Message: msg}}
+}
+
+func (receiver *WafConfigBundleService) planHost(hb model.ConfigBundleHost) []bundleOp {
+	desired, err := normalizeBundleValue(hb.Host)
+	if err != nil {
+		return []bundleOp{bundleErrorOp(hb.Code, "host", hb.Code, err.Error())}
+	}
+	stripBundleFields(desired, bundleBaseFields, []string{"code", "bind_ssl_id"})
+	if v, err := receiver.resolveSecret(desired["keyfile"]); err != nil {
+		return []bundleOp{bundleErrorOp(hb.Code, "host", hb.Code, err.Error())}
+	} else if v != nil {
+		desired["keyfile"] = v
+	}
+	if serial, ok := desired["bind_ssl_serial"]; ok {
+		delete(desired, "bind_ssl_serial")
+		desired["bind_ssl_id"] = ""
+		if s, _ := serial.(string); s != "" {
+			var ssl model.SslConfig
+			global.GWAF_LOCAL_DB.Where("serial_no = ?", s).Limit(1).Find(&ssl)
+			if ssl.Id == "" {
+				return []bundleOp{bundleErrorOp(hb.Code, "host", hb.Code, "证书夹中不存在序列号为 "+s+" 的证书")}
+			}
+			desired["bind_ssl_id"] = ssl.Id
+		}
+	}
+
+	var existing model.Hosts
+	global.GWAF_LOCAL_DB.Where("code = ?", hb.Code).Limit(1).Find(&existing)
+	if existing.Id == "" {
+		hostName, _ := desired["host"].(string)
+		port, _ := desired["port"].(float64)
+		var other model.Hosts
+		global.GWAF_LOCAL_DB.Where("host = ? and port = ?", hostName, int(port)).Limit(1).Find(&other)
+		if other.Id != "" {
+			return []bundleOp{bundleErrorOp(hb.Code, "host", hb.Code, fmt.Sprintf("%s:%d 已被网站 %s 使用", hostName, int(port), other.Code))}
+		}
+		return []bundleOp{{
+			item:    model.ConfigBundlePlanItem{HostCode: hb.Code, Kind: "host", Key: hb.Code, Action: model.ConfigBundleActionCreate},
+			desired: desired,
+		}}
+	}
+
+	current, err := normalizeBundleValue(existing)
+	if err != nil {
+		return []bundleOp{bundleErrorOp(hb.Code, "host", hb.Code, err.Error())}
+	}
+	fields := diffBundleFields(desired, current, nil)
+	if len(fields) == 0 {
+		return nil
+	}
+	return []bundleOp{{
+		item:     model.ConfigBundlePlanItem{HostCode: hb.Code, Kind: "host", Key: hb.Code, Action: model.ConfigBundleActionUpdate, Fields: fields},
+		desired:  desired,
+		existing: &existing,
+	}}
+}
+
+func (receiver *WafConfigBundleService) planKind(hostCode string, kind *bundleKind, items []map[string]interface{}, prune bool) []bundleOp {
+	var ops []bundleOp
+	rows, ptrs, err := loadBundleRows(kind, hostCode)
+	if err != nil {
+		return []bundleOp{bundleErrorOp(hostCode, kind.name, "", err.Error())}
+	}
+	existing := make(map[string]int, len(rows))
+	for i, row := range rows {
+		existing[bundleItemKey(*kind, row)] = i
+	}
+
+	wanted := map[string]struct{}{}
+	for _, raw := range items {
+		desired, err := normalizeBundleValue(raw)
+		if err != nil {
+			ops = append(ops, bundleErrorOp(hostCode, kind.name, "", err.Error()))
+			continue
+		}
+		stripBundleFields(desired, bundleBaseFields, kind.volatile)
+		key := bundleItemKey(*kind, desired)
+		if _, dup := wanted[key]; dup {
+			ops = append(ops, bundleErrorOp(hostCode, kind.name, key, "配置包中条目重复"))
+			continue
+		}
+		wanted[key] = struct{}{}
+		if len(kind.keyFields) == 0 && len(wanted) > 1 {
+			ops = append(ops, bundleErrorOp(hostCode, kind.name, key, "每个网站只能有一条"))
+			continue
+		}
+
+		failed := false
+		for _, f := range kind.secrets {
+			v, err := receiver.resolveSecret(desired[f])
+			if err != nil {
+				ops = append(ops, bundleErrorOp(hostCode, kind.name, key, err.Error()))
+				failed = true
+				break
+			}
+			if v != nil {
+				desired[f] = v
+			}
+		}
+		if failed {
+			continue
+		}
+		if kind.check != nil {
+			if msg := kind.check(desired); msg != "" {
+				ops = append(ops, bundleErrorOp(hostCode, kind.name, key, msg))
+				continue
+			}
+		}
+
+		idx, found := existing[key]
+		if len(kind.keyFields) == 0 && !found && len(rows) > 0 {
+			idx, found = 0, true
+		}
+		if !found {
+			ops = append(ops, bundleOp{
+				item:    model.ConfigBundlePlanItem{HostCode: hostCode, Kind: kind.name, Key: key, Action: model.ConfigBundleActionCreate},
+				kind:    kind,
+				desired: desired,
+			})
+			continue
+		}
+		delete(existing, bundleItemKey(*kind, rows[idx]))
+		fields := diffBundleFields(desired, rows[idx], kind.volatile)
+		if len(fields) > 0 {
+			ops = append(ops, bundleOp{
+				item:     model.ConfigBundlePlanItem{HostCode: hostCode, Kind: kind.name, Key: key, Action: model.ConfigBundleActionUpdate, Fields: fields},
+				kind:     kind,
+				desired:  desired,
+				existing: ptrs[idx],
+			})
+		}
+	}
+
+	if prune {
+		keys := make([]string, 0, len(existing))
+		for key := range existing {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			row := rows[existing[key]]
+			if kind.transient != nil && kind.transient(row) {
+				continue
+			}
+			id, _ := row["id"].(string)
+			ops = append(ops, bundleOp{
+				item: model.ConfigBundlePlanItem{HostCode: hostCode, Kind: kind.name, Key: key, Action: model.ConfigBundleActionDelete},
+				kind: kind,
+				id:   id,
+			})
+		}
+	}
+	return ops
+}
+
+// loadBundleRows 读出某网站某类配置，同时返回归一化后的 map 和可直接回写的行指针
+func loadBundleRows(kind *bundleKind, hostCode string) ([]map[string]interface{}, []interface{}, error) {
+	list := kind.newList()
+	db := global.GWAF_LOCAL_DB.Where("host_code = ?", hostCode)
+	if kind.where != "" {
+		db = db.Where(kind.where)
+	}
+	if err := db.Order("create_time asc").Find(list).Error; err != nil {
+		return nil, nil, err
+	}
+	slice := reflect.ValueOf(list).Elem()
+	rows := make([]map[string]interface{}, 0, slice.Len())
+	ptrs := make([]interface{}, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		ptr := slice.Index(i).Addr().Interface()
+		m, err := normalizeBundleValue(ptr)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, m)
+		ptrs = append(ptrs, ptr)
+	}
+	return rows, ptrs, nil
+}
+
+// diffBundleFields 只比对配置包里出现的字段：老版本导出的文件少了新字段时不会被当成"清空"
+func diffBundleFields(desired, current map[string]interface{}, ignore []string) []string {
+	var fields []string
+	for k, v := range desired {
+		skip := false
+		for _, f := range ignore {
+			if f == k {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		if !reflect.DeepEqual(v, current[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func summarizeBundleOps(ops []bundleOp) model.ConfigBundlePlan {
+	plan := model.ConfigBundlePlan{Items: make([]model.ConfigBundlePlanItem, 0, len(ops))}
+	for _, op := range ops {
+		plan.Items = append(plan.Items, op.item)
+		switch op.item.Action {
+		case model.ConfigBundleActionCreate:
+			plan.Create++
+		case model.ConfigBundleActionUpdate:
+			plan.Update++
+		case model.ConfigBundleActionDelete:
+			plan.Delete++
+		case model.ConfigBundleActionError:
+			plan.Errors++
+		}
+	}
+	return plan
+}
+
+// intifyBundleMap 整数值的 float64 转成 int64：YAML 编码 float64 会写成 1.7e+09 这种形式
+func intifyBundleMap(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		m[k] = intifyBundleValue(v)
+	}
+	return m
+}
+
+func intifyBundleValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return int64(t)
+		}
+	case map[string]interface{}:
+		return intifyBundleMap(t)
+	case []interface{}:
+		for i := range t {
+			t[i] = intifyBundleValue(t[i])
+		}
+	}
+	return v
+}
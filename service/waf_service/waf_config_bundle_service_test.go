@@ -0,0 +1,163 @@
+package waf_service
+
+import (
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sqlite "github.com/samwafgo/sqlitedriver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openConfigBundleTestDB 打开一个空库。配置包测试要在两套库之间来回切换，
+// 所以这里只建表，切换 global.GWAF_LOCAL_DB 由 useConfigBundleDB 负责。
+func openConfigBundleTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(
+		sqlite.Open(filepath.Join(t.TempDir(), name+".db")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)},
+	)
+	if err != nil {
+		t.Fatalf("打开测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Hosts{}, &model.PrivateInfo{}, &model.SslConfig{}, &model.IPGroup{}); err != nil {
+		t.Fatalf("AutoMigrate 失败: %v", err)
+	}
+	for _, kind := range configBundleKinds {
+		if err := db.AutoMigrate(kind.newItem()); err != nil {
+			t.Fatalf("AutoMigrate %s 失败: %v", kind.name, err)
+		}
+	}
+	t.Cleanup(func() {
+		if sqlDB, e := db.DB(); e == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func useConfigBundleDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	oldDB, oldTenant, oldUser := global.GWAF_LOCAL_DB, global.GWAF_TENANT_ID, global.GWAF_USER_CODE
+	global.GWAF_LOCAL_DB = db
+	global.GWAF_TENANT_ID, global.GWAF_USER_CODE = "SamWafCom", "user-uuid-bundle"
+	t.Cleanup(func() {
+		global.GWAF_LOCAL_DB = oldDB
+		global.GWAF_TENANT_ID, global.GWAF_USER_CODE = oldTenant, oldUser
+	})
+}
+
+func bundleTestBase(id string) baseorm.BaseOrm {
+	return baseorm.BaseOrm{Id: id, USER_CODE: "user-uuid-src", Tenant_ID: "SamWafCom"}
+}
+
+func seedConfigBundleSource(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	rows := []interface{}{
+		&model.Hosts{BaseOrm: bundleTestBase("h1"), Code: "host-a", Host: "a.com", Port: 80, Remote_host: "http://127.0.0.1", Remote_port: 8080, GUARD_STATUS: 1},
+		&model.Rules{BaseOrm: bundleTestBase("r1"), HostCode: "host-a", RuleCode: "rule-1", RuleName: "拦截admin", RuleContent: "rule R1 salience 10 {}", RuleStatus: 1},
+		&model.Rules{BaseOrm: bundleTestBase("r2"), HostCode: "host-a", RuleCode: "rule-del", RuleName: "已删除", RuleStatus: 999},
+		&model.IPBlockList{BaseOrm: bundleTestBase("b1"), HostCode: "host-a", Ip: "1.2.3.4", Remarks: "永久"},
+		&model.IPBlockList{BaseOrm: bundleTestBase("b2"), HostCode: "host-a", Ip: "5.6.7.8", ExpireTime: time.Now().Add(time.Hour).Unix()},
+		&model.AntiCC{BaseOrm: bundleTestBase("c1"), HostCode: "host-a", Rate: 1, Limit: 100, LockIPMinutes: 5, LimitMode: "rate"},
+		&model.HttpAuthBase{BaseOrm: bundleTestBase("a1"), HostCode: "host-a", UserName: "ops", Password: "s3cret"},
+		&model.PrivateInfo{BaseOrm: bundleTestBase("p1"), PrivateKey: "auth.ops", PrivateValue: "s3cret"},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("造数据失败: %v", err)
+		}
+	}
+}
+
+// 导出 → 应用到空库 → 再次 plan 无变更；敏感字段不出现在导出文件里
+func TestConfigBundle_RoundTrip(t *testing.T) {
+	src := openConfigBundleTestDB(t, "src")
+	seedConfigBundleSource(t, src)
+	useConfigBundleDB(t, src)
+
+	bundle, err := WafConfigBundleServiceApp.ExportApi("host-a")
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	content, err := WafConfigBundleServiceApp.MarshalBundle(bundle, "yaml")
+	if err != nil {
+		t.Fatalf("YAML 编码失败: %v", err)
+	}
+	text := string(content)
+	if strings.Contains(text, "s3cret") || !strings.Contains(text, "${private:auth.ops}") {
+		t.Fatalf("密码应导出为密钥引用:\n%s", text)
+	}
+	if strings.Contains(text, "5.6.7.8") || strings.Contains(text, "rule-del") {
+		t.Fatalf("临时封禁和已删除规则不应导出:\n%s", text)
+	}
+	if strings.Contains(text, "e+") {
+		t.Fatalf("整数不应写成科学计数法:\n%s", text)
+	}
+
+	dst := openConfigBundleTestDB(t, "dst")
+	dst.Create(&model.PrivateInfo{BaseOrm: bundleTestBase("p1"), PrivateKey: "auth.ops", PrivateValue: "s3cret"})
+	useConfigBundleDB(t, dst)
+
+	parsed, err := WafConfigBundleServiceApp.ParseBundle(content)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	plan, changes, err := WafConfigBundleServiceApp.ApplyApi(parsed, false)
+	if err != nil {
+		t.Fatalf("应用失败: %v %+v", err, plan.Items)
+	}
+	if plan.Create != 5 || len(changes) != 1 || !changes[0].Created {
+		t.Fatalf("应新建网站+4条配置，实际 %+v changes=%+v", plan, changes)
+	}
+	var auth model.HttpAuthBase
+	dst.Where("host_code = ?", "host-a").First(&auth)
+	if auth.Password != "s3cret" || auth.Id == "a1" {
+		t.Fatalf("密钥引用应在目标环境解析，主键应重新生成: %+v", auth)
+	}
+
+	again := WafConfigBundleServiceApp.PlanApi(parsed, true)
+	if len(again.Items) != 0 {
+		t.Fatalf("重复应用应无变更，实际 %+v", again.Items)
+	}
+}
+
+// 字段变更、prune 删除、缺失密钥
+func TestConfigBundle_PlanDiff(t *testing.T) {
+	db := openConfigBundleTestDB(t, "diff")
+	seedConfigBundleSource(t, db)
+	useConfigBundleDB(t, db)
+
+	bundle, err := WafConfigBundleServiceApp.ExportApi("host-a")
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	res := bundle.Hosts[0].Resources
+	res["rules"][0]["rule_name"] = "改名"
+	res["ip_block"] = nil
+
+	plan := WafConfigBundleServiceApp.PlanApi(bundle, false)
+	if plan.Update != 1 || plan.Delete != 0 || plan.Items[0].Fields[0] != "rule_name" {
+		t.Fatalf("不带 prune 只应更新规则: %+v", plan.Items)
+	}
+	plan = WafConfigBundleServiceApp.PlanApi(bundle, true)
+	if plan.Delete != 1 || plan.Items[len(plan.Items)-1].Key != "|1.2.3.4|" {
+		t.Fatalf("prune 只应删除永久封禁，临时封禁保留: %+v", plan.Items)
+	}
+
+	res["http_auth"][0]["password"] = "${private:not.exist}"
+	_, _, err = WafConfigBundleServiceApp.ApplyApi(bundle, true)
+	if err == nil {
+		t.Fatalf("缺少密钥时应拒绝应用")
+	}
+	var cnt int64
+	db.Model(&model.IPBlockList{}).Count(&cnt)
+	if cnt != 2 {
+		t.Fatalf("拒绝应用时不应有任何修改，名单条数 %d", cnt)
+	}
+}
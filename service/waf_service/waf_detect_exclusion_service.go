@@ -0,0 +1,197 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type WafDetectExclusionService struct{}
+
+var WafDetectExclusionServiceApp = new(WafDetectExclusionService)
+
+// CheckParam 检查检测项与路径判断类型是否合法
+func (s *WafDetectExclusionService) CheckParam(detector string, compareType string, path string) error {
+	valid := false
+	for _, d := range model.DetectExclusionDetectors() {
+		if d == detector {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return errors.New("不支持的检测项:" + detector)
+	}
+	switch compareType {
+	case "":
+	case "等于", "前缀匹配", "后缀匹配", "包含匹配":
+		if path == "" {
+			return errors.New("请填写路径")
+		}
+	default:
+		return errors.New("不支持的路径判断类型:" + compareType)
+	}
+	return nil
+}
+
+func (s *WafDetectExclusionService) AddApi(req request.WafDetectExclusionAddReq) error {
+	bean := &model.DetectExclusion{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		HostCode:    req.HostCode,
+		CompareType: req.CompareType,
+		Path:        req.Path,
+		ArgSource:   req.ArgSource,
+		ArgName:     req.ArgName,
+		Detector:    req.Detector,
+		Remarks:     req.Remarks,
+	}
+	return global.GWAF_LOCAL_DB.Create(bean).Error
+}
+
+func (s *WafDetectExclusionService) CheckIsExistApi(req request.WafDetectExclusionAddReq) int {
+	var total int64
+	global.GWAF_LOCAL_DB.Model(&model.DetectExclusion{}).
+		Where("host_code=? AND compare_type=? AND path=? AND arg_source=? AND arg_name=? AND detector=?",
+			req.HostCode, req.CompareType, req.Path, req.ArgSource, req.ArgName, req.Detector).
+		Count(&total)
+	return int(total)
+}
+
+func (s *WafDetectExclusionService) ModifyApi(req request.WafDetectExclusionEditReq) error {
+	var bean model.DetectExclusion
+	global.GWAF_LOCAL_DB.Model(&model.DetectExclusion{}).
+		Where("host_code=? AND compare_type=? AND path=? AND arg_source=? AND arg_name=? AND detector=?",
+			req.HostCode, req.CompareType, req.Path, req.ArgSource, req.ArgName, req.Detector).
+		Limit(1).Find(&bean)
+
+	if bean.Id != "" && bean.Id != req.Id {
+		return errors.New("当前记录已经存在")
+	}
+
+	beanMap := map[string]interface{}{
+		"HostCode":    req.HostCode,
+		"CompareType": req.CompareType,
+		"Path":        req.Path,
+		"ArgSource":   req.ArgSource,
+		"ArgName":     req.ArgName,
+		"Detector":    req.Detector,
+		"Remarks":     req.Remarks,
+		"UPDATE_TIME": customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.DetectExclusion{}).Where("id = ?", req.Id).Updates(beanMap).Error
+}
+
+func (s *WafDetectExclusionService) GetDetailApi(req request.WafDetectExclusionDetailReq) model.DetectExclusion {
+	var bean model.DetectExclusion
+	global.GWAF_LOCAL_DB.Where("id=?", req.Id).Find(&bean)
+	return bean
+}
+
+func (s *WafDetectExclusionService) GetDetailByIdApi(id string) model.DetectExclusion {
+	var bean model.DetectExclusion
+	global.GWAF_LOCAL_DB.Where("id=?", id).Find(&bean)
+	return bean
+}
+
+func (s *WafDetectExclusionService) GetListApi(req request.WafDetectExclusionSearchReq) ([]model.DetectExclusion, int64, error) {
+	var list []model.DetectExclusion
+	var total int64
+
+	query := global.GWAF_LOCAL_DB.Model(&model.DetectExclusion{})
+	if len(req.HostCode) > 0 {
+		query = query.Where("host_code=?", req.HostCode)
+	}
+	if len(req.Path) > 0 {
+		query = query.Where("path like ?", "%"+req.Path+"%")
+	}
+	if len(req.Detector) > 0 {
+		query = query.Where("detector=?", req.Detector)
+	}
+
+	query.Count(&total)
+	query.Order("create_time desc").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list)
+
+	return list, total, nil
+}
+
+func (s *WafDetectExclusionService) DelApi(req request.WafDetectExclusionDelReq) error {
+	var bean model.DetectExclusion
+	if err := global.GWAF_LOCAL_DB.Where("id = ?", req.Id).First(&bean).Error; err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.DetectExclusion{}).Error
+}
+
+func (s *WafDetectExclusionService) GetListByHostCode(hostCode string) []model.DetectExclusion {
+	var list []model.DetectExclusion
+	global.GWAF_LOCAL_DB.Where("host_code=?", hostCode).Order("create_time asc").Find(&list)
+	return list
+}
+
+// BuildFromWebLog 按攻击日志生成误报排除：网站取日志所属网站，路径精确等于本次请求路径，
+// 参数取日志里记录的命中参数(MATCH_ARG，来源:参数名，整体命中时只有来源)，检测项按命中的内置检测反推。
+func (s *WafDetectExclusionService) BuildFromWebLog(weblog innerbean.WebLog) (request.WafDetectExclusionAddReq, error) {
+	var req request.WafDetectExclusionAddReq
+	if weblog.REQ_UUID == "" {
+		return req, errors.New("未找到攻击日志")
+	}
+	detector := detectExclusionDetectorByRule(weblog.RULE)
+	if detector == "" {
+		return req, errors.New("该日志不是内置检测(SQL注入/XSS/RCE/目录穿越)拦截，无法生成参数排除")
+	}
+	if weblog.MATCH_ARG == "" {
+		return req, errors.New("该日志未记录命中参数，无法生成参数排除")
+	}
+	// 整个请求体命中时只记来源(如 body)，生成的排除参数名留空，即该路径下这一来源的全部参数
+	source, name, _ := strings.Cut(strings.TrimSuffix(weblog.MATCH_ARG, "(参数名)"), ":")
+	path := weblog.URL
+	if u, err := url.ParseRequestURI(weblog.URL); err == nil {
+		path = u.Path
+	} else if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		path = path[:idx]
+	}
+	req = request.WafDetectExclusionAddReq{
+		HostCode:    weblog.HOST_CODE,
+		CompareType: "等于",
+		Path:        path,
+		ArgSource:   source,
+		ArgName:     name,
+		Detector:    detector,
+		Remarks:     "由攻击日志 " + weblog.REQ_UUID + " 生成",
+	}
+	return req, nil
+}
+
+// detectExclusionDetectorByRule 命中规则名 -> 检测项，规则名见各内置检测的 Title
+func detectExclusionDetectorByRule(rule string) string {
+	switch {
+	case rule == "SQL注入":
+		return model.DetectExclusionSQLI
+	case rule == "XSS跨站注入":
+		return model.DetectExclusionXSS
+	case strings.HasPrefix(rule, "RCE"):
+		return model.DetectExclusionRCE
+	case rule == "目录穿越漏洞":
+		return model.DetectExclusionDIR
+	case strings.HasPrefix(rule, "SSRF"):
+		return model.DetectExclusionSSRF
+	}
+	return ""
+}
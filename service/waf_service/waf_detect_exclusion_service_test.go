@@ -0,0 +1,46 @@
+package waf_service
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"testing"
+)
+
+// 攻击日志 -> 误报排除：路径去掉查询串，参数名去掉(参数名)标记，检测项按规则名反推
+func TestDetectExclusion_BuildFromWebLog(t *testing.T) {
+	req, err := WafDetectExclusionServiceApp.BuildFromWebLog(innerbean.WebLog{
+		REQ_UUID:  "u1",
+		HOST_CODE: "host-a",
+		URL:       "/api/post?id=1",
+		RULE:      "XSS跨站注入",
+		MATCH_ARG: "json:post.content",
+	})
+	if err != nil {
+		t.Fatalf("生成失败: %v", err)
+	}
+	if req.HostCode != "host-a" || req.CompareType != "等于" || req.Path != "/api/post" ||
+		req.ArgSource != "json" || req.ArgName != "post.content" || req.Detector != model.DetectExclusionXSS {
+		t.Fatalf("生成结果不对: %+v", req)
+	}
+
+	req, err = WafDetectExclusionServiceApp.BuildFromWebLog(innerbean.WebLog{
+		REQ_UUID: "u2", URL: "/q", RULE: "RCE:命令执行", MATCH_ARG: "query:a;b(参数名)",
+	})
+	if err != nil || req.Detector != model.DetectExclusionRCE || req.ArgName != "a;b" {
+		t.Fatalf("参数名命中应去掉标记: %+v %v", req, err)
+	}
+
+	req, err = WafDetectExclusionServiceApp.BuildFromWebLog(innerbean.WebLog{
+		REQ_UUID: "u5", URL: "/upload", RULE: "SQL注入", MATCH_ARG: "body",
+	})
+	if err != nil || req.ArgSource != "body" || req.ArgName != "" || req.Detector != model.DetectExclusionSQLI {
+		t.Fatalf("请求体整体命中应生成参数名为空的排除: %+v %v", req, err)
+	}
+
+	if _, err = WafDetectExclusionServiceApp.BuildFromWebLog(innerbean.WebLog{REQ_UUID: "u3", RULE: "CC攻击", MATCH_ARG: "query:a"}); err == nil {
+		t.Fatalf("非内置检测日志应拒绝生成")
+	}
+	if _, err = WafDetectExclusionServiceApp.BuildFromWebLog(innerbean.WebLog{REQ_UUID: "u4", RULE: "SQL注入"}); err == nil {
+		t.Fatalf("没有命中参数的日志应拒绝生成")
+	}
+}
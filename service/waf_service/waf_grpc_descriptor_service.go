@@ -0,0 +1,108 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"SamWaf/wafenginecore/grpcinspect"
+	"errors"
+	"time"
+)
+
+type WafGrpcDescriptorService struct{}
+
+var WafGrpcDescriptorServiceApp = new(WafGrpcDescriptorService)
+
+// CheckParam 保存前先解析一遍，依赖不全、没有服务的描述文件直接报错
+func (s *WafGrpcDescriptorService) CheckParam(name string, content []byte) (*grpcinspect.Descriptor, error) {
+	if name == "" {
+		return nil, errors.New("描述文件名称不能为空")
+	}
+	return grpcinspect.Compile(content)
+}
+
+// UploadApi 同名描述文件存在时替换内容(保持启用状态)，否则新建并启用；replaced 表示是否替换
+func (s *WafGrpcDescriptorService) UploadApi(name string, remarks string, content []byte, desc *grpcinspect.Descriptor) (replaced bool, err error) {
+	exist := s.GetDetailByNameApi(name)
+	if exist.Id != "" {
+		if remarks == "" {
+			remarks = exist.Remarks
+		}
+		beanMap := map[string]interface{}{
+			"Content":     content,
+			"Services":    desc.ServicesText(),
+			"MethodCount": desc.MethodCount(),
+			"Remarks":     remarks,
+			"UPDATE_TIME": customtype.JsonTime(time.Now()),
+		}
+		return true, global.GWAF_LOCAL_DB.Model(model.GrpcDescriptorSet{}).Where("id = ?", exist.Id).Updates(beanMap).Error
+	}
+	bean := &model.GrpcDescriptorSet{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		Name:        name,
+		Content:     content,
+		Services:    desc.ServicesText(),
+		MethodCount: desc.MethodCount(),
+		Status:      1,
+		Remarks:     remarks,
+	}
+	return false, global.GWAF_LOCAL_DB.Create(bean).Error
+}
+
+func (s *WafGrpcDescriptorService) ModifyApi(req request.WafGrpcDescriptorEditReq) error {
+	beanMap := map[string]interface{}{
+		"Status":      req.Status,
+		"Remarks":     req.Remarks,
+		"UPDATE_TIME": customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.GrpcDescriptorSet{}).Where("id = ?", req.Id).Updates(beanMap).Error
+}
+
+func (s *WafGrpcDescriptorService) GetDetailApi(req request.WafGrpcDescriptorDetailReq) model.GrpcDescriptorSet {
+	var bean model.GrpcDescriptorSet
+	global.GWAF_LOCAL_DB.Omit("content").Where("id=?", req.Id).Find(&bean)
+	return bean
+}
+
+func (s *WafGrpcDescriptorService) GetDetailByNameApi(name string) model.GrpcDescriptorSet {
+	var bean model.GrpcDescriptorSet
+	global.GWAF_LOCAL_DB.Omit("content").Where("name=?", name).Limit(1).Find(&bean)
+	return bean
+}
+
+// GetListApi 描述文件内容是二进制，不返回给前端
+func (s *WafGrpcDescriptorService) GetListApi(req request.WafGrpcDescriptorSearchReq) ([]model.GrpcDescriptorSet, int64, error) {
+	var list []model.GrpcDescriptorSet
+	var total int64
+
+	query := global.GWAF_LOCAL_DB.Model(&model.GrpcDescriptorSet{})
+	if len(req.Name) > 0 {
+		query = query.Where("name like ?", "%"+req.Name+"%")
+	}
+
+	query.Count(&total)
+	query.Omit("content").
+		Order("create_time desc").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list)
+
+	return list, total, nil
+}
+
+func (s *WafGrpcDescriptorService) DelApi(req request.WafGrpcDescriptorDelReq) error {
+	var bean model.GrpcDescriptorSet
+	if err := global.GWAF_LOCAL_DB.Omit("content").Where("id = ?", req.Id).First(&bean).Error; err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.GrpcDescriptorSet{}).Error
+}
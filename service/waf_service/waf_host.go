@@ -114,6 +114,13 @@ func (receiver *WafHostService) AddApi(wafHostAddReq request.WafHostAddReq) (str
 		CsrfJSON:                  wafHostAddReq.CsrfJSON,
 		TamperJSON:                wafHostAddReq.TamperJSON,
 		UploadSecurityJSON:        wafHostAddReq.UploadSecurityJSON,
+		LoginProtectJSON:          wafHostAddReq.LoginProtectJSON,
+		SpiderPolicyJSON:          wafHostAddReq.SpiderPolicyJSON,
+		WebSocketJSON:             wafHostAddReq.WebSocketJSON,
+		GrpcJSON:                  wafHostAddReq.GrpcJSON,
+		GraphQLJSON:               wafHostAddReq.GraphQLJSON,
+		ProtocolJSON:              wafHostAddReq.ProtocolJSON,
+		SsrfJSON:                  wafHostAddReq.SsrfJSON,
 		IPMode:                    wafHostAddReq.IPMode,
 		DisableHTTP2:              wafHostAddReq.DisableHTTP2,
 		IsEnableResponseBuffering: normalizeIsEnableResponseBuffering(wafHostAddReq.IsEnableResponseBuffering),
@@ -202,6 +209,13 @@ func (receiver *WafHostService) ModifyApi(wafHostEditReq request.WafHostEditReq)
 		"CsrfJSON":                  wafHostEditReq.CsrfJSON,
 		"TamperJSON":                wafHostEditReq.TamperJSON,
 		"UploadSecurityJSON":        wafHostEditReq.UploadSecurityJSON,
+		"LoginProtectJSON":          wafHostEditReq.LoginProtectJSON,
+		"SpiderPolicyJSON":          wafHostEditReq.SpiderPolicyJSON,
+		"WebSocketJSON":             wafHostEditReq.WebSocketJSON,
+		"GrpcJSON":                  wafHostEditReq.GrpcJSON,
+		"GraphQLJSON":               wafHostEditReq.GraphQLJSON,
+		"ProtocolJSON":              wafHostEditReq.ProtocolJSON,
+		"SsrfJSON":                  wafHostEditReq.SsrfJSON,
 		"IPMode":                    wafHostEditReq.IPMode,
 		"DisableHTTP2":              wafHostEditReq.DisableHTTP2,
 		"IsEnableResponseBuffering": normalizeIsEnableResponseBuffering(wafHostEditReq.IsEnableResponseBuffering),
@@ -46,6 +46,7 @@ func (receiver *WafIPGroupItemService) AddApi(req request.WafIPGroupItemAddReq)
 		return errors.New("该IP已在组内: " + ip)
 	}
 	bean := newGroupItem(req.GroupCode, ip, req.Remarks)
+	bean.ExpireTime = model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix())
 	return global.GWAF_LOCAL_DB.Create(bean).Error
 }
 
@@ -67,6 +68,7 @@ func (receiver *WafIPGroupItemService) ModifyApi(req request.WafIPGroupItemEditR
 	updateMap := map[string]interface{}{
 		"ip":          ip,
 		"remarks":     req.Remarks,
+		"expire_time": model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix()),
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
 	}
 	err := global.GWAF_LOCAL_DB.Model(model.IPGroupItem{}).Where("id = ?", req.Id).Updates(updateMap).Error
@@ -95,6 +97,7 @@ func (receiver *WafIPGroupItemService) BatchAddApi(req request.WafIPGroupItemBat
 		remark = time.Now().Format("20060102") + "批量添加"
 	}
 
+	expireTime := model.ResolveListExpireTime(req.ExpireHours, req.ExpireTime, time.Now().Unix())
 	pending := make([]*model.IPGroupItem, 0, 64)
 	for idx, raw := range strings.Split(strings.ReplaceAll(req.Content, "\r\n", "\n"), "\n") {
 		line := strings.TrimSpace(raw)
@@ -114,7 +117,9 @@ func (receiver *WafIPGroupItemService) BatchAddApi(req request.WafIPGroupItemBat
 			continue
 		}
 		exist[line] = struct{}{}
-		pending = append(pending, newGroupItem(req.GroupCode, line, remark))
+		item := newGroupItem(req.GroupCode, line, remark)
+		item.ExpireTime = expireTime
+		pending = append(pending, item)
 	}
 
 	if len(pending) > 0 {
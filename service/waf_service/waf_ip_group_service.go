@@ -364,8 +364,12 @@ func (receiver *WafIPGroupService) RebuildAllGroupMatchers() {
 func (receiver *WafIPGroupService) buildMatcher(groupCode string) (*ipset.MatchSet, int) {
 	var items []model.IPGroupItem
 	global.GWAF_LOCAL_DB.Where("group_code = ?", groupCode).Find(&items)
+	now := time.Now().Unix()
 	ips := make([]string, 0, len(items))
 	for i := range items {
+		if model.ListEntryExpired(items[i].ExpireTime, now) {
+			continue
+		}
 		ips = append(ips, items[i].Ip)
 	}
 	m := ipset.BuildMatchSet(ips)
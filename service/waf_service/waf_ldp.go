@@ -7,6 +7,7 @@ import (
 	"SamWaf/model"
 	"SamWaf/model/baseorm"
 	"SamWaf/model/request"
+	"SamWaf/wafenginecore/ldpmask"
 	"errors"
 	"time"
 )
@@ -28,11 +29,21 @@ func (receiver *WafLdpUrlService) AddApi(req request.WafLdpUrlAddReq) error {
 		CompareType: req.CompareType,
 		Url:         req.Url,
 		Remarks:     req.Remarks,
+		MaskJSON:    req.MaskJSON,
 	}
 	global.GWAF_LOCAL_DB.Create(bean)
 	return nil
 }
 
+// CheckMaskJSON 校验字段级脱敏策略，为空表示整页脱敏
+func (receiver *WafLdpUrlService) CheckMaskJSON(maskJSON string) error {
+	if maskJSON == "" {
+		return nil
+	}
+	_, err := ldpmask.Compile(maskJSON)
+	return err
+}
+
 func (receiver *WafLdpUrlService) CheckIsExistApi(req request.WafLdpUrlAddReq) error {
 	return global.GWAF_LOCAL_DB.First(&model.LDPUrl{}, "host_code = ? and url= ?", req.HostCode,
 		req.Url).Error
@@ -49,6 +60,7 @@ func (receiver *WafLdpUrlService) ModifyApi(req request.WafLdpUrlEditReq) error
 		"Url":          req.Url,
 		"Remarks":      req.Remarks,
 		"compare_type": req.CompareType,
+		"mask_json":    req.MaskJSON,
 		"UPDATE_TIME":  customtype.JsonTime(time.Now()),
 	}
 	err := global.GWAF_LOCAL_DB.Model(model.LDPUrl{}).Where("id = ?", req.Id).Updates(ipWhiteMap).Error
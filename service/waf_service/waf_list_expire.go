@@ -0,0 +1,50 @@
+package waf_service
+
+import (
+	"SamWaf/global"
+	"SamWaf/model"
+)
+
+type WafListExpireService struct{}
+
+var WafListExpireServiceApp = new(WafListExpireService)
+
+// ListExpireResult 一轮到期清理涉及的站点与IP组，调用方据此重新下发名单
+type ListExpireResult struct {
+	BlockIpHosts  []string //IP黑名单有条目到期的站点
+	AllowIpHosts  []string //IP白名单有条目到期的站点
+	BlockUrlHosts []string //URL黑名单有条目到期的站点
+	GroupCodes    []string //有条目到期的IP组
+	Deleted       int64    //删除总行数
+}
+
+// ClearExpiredApi 删除 now(unix秒) 时已到期的临时名单条目（IP/URL 黑白名单、IP组条目）。
+// 先查出受影响的站点/组再删，删不掉的表不影响其余表。
+func (receiver *WafListExpireService) ClearExpiredApi(now int64) (ListExpireResult, error) {
+	var result ListExpireResult
+	var firstErr error
+	where := "expire_time > 0 and expire_time <= ?"
+
+	clear := func(bean interface{}, column string) []string {
+		var keys []string
+		global.GWAF_LOCAL_DB.Model(bean).Where(where, now).Distinct().Pluck(column, &keys)
+		if len(keys) == 0 {
+			return nil
+		}
+		tx := global.GWAF_LOCAL_DB.Where(where, now).Delete(bean)
+		if tx.Error != nil {
+			if firstErr == nil {
+				firstErr = tx.Error
+			}
+			return nil
+		}
+		result.Deleted += tx.RowsAffected
+		return keys
+	}
+
+	result.BlockIpHosts = clear(&model.IPBlockList{}, "host_code")
+	result.AllowIpHosts = clear(&model.IPAllowList{}, "host_code")
+	result.BlockUrlHosts = clear(&model.URLBlockList{}, "host_code")
+	result.GroupCodes = clear(&model.IPGroupItem{}, "group_code")
+	return result, firstErr
+}
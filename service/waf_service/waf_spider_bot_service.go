@@ -0,0 +1,159 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/common/zlog"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"SamWaf/wafbot"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type WafSpiderBotService struct{}
+
+var WafSpiderBotServiceApp = new(WafSpiderBotService)
+
+// CheckParam 校验类别并试编译，IP段写错时在保存前就报出来
+func (s *WafSpiderBotService) CheckParam(name, category, uaPatterns, ipRanges string) error {
+	if name == "" {
+		return errors.New("爬虫名称不能为空")
+	}
+	switch category {
+	case model.SpiderBotCategorySearch, model.SpiderBotCategoryAI, model.SpiderBotCategorySEO, model.SpiderBotCategoryMonitor, model.SpiderBotCategoryScraper:
+	default:
+		return errors.New("类别只能是 search/ai/seo/monitor/scraper")
+	}
+	if len(wafbot.SplitSpiderBotList(uaPatterns)) == 0 {
+		return errors.New("UA 特征不能为空")
+	}
+	_, errs := wafbot.BuildRegistry([]model.SpiderBot{{Name: name, UAPatterns: uaPatterns, IPRanges: ipRanges, Status: 1}}, "")
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (s *WafSpiderBotService) AddApi(req request.WafSpiderBotAddReq) error {
+	bean := &model.SpiderBot{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		Name:         req.Name,
+		Category:     req.Category,
+		UAPatterns:   req.UAPatterns,
+		RDNSSuffixes: req.RDNSSuffixes,
+		IPRanges:     req.IPRanges,
+		IPFiles:      req.IPFiles,
+		Sort:         req.Sort,
+		Builtin:      0,
+		Status:       req.Status,
+		Remarks:      req.Remarks,
+	}
+	return global.GWAF_LOCAL_DB.Create(bean).Error
+}
+
+func (s *WafSpiderBotService) CheckIsExistApi(name string) int {
+	var total int64
+	global.GWAF_LOCAL_DB.Model(&model.SpiderBot{}).Where("name = ?", name).Count(&total)
+	return int(total)
+}
+
+func (s *WafSpiderBotService) ModifyApi(req request.WafSpiderBotEditReq) error {
+	var bean model.SpiderBot
+	global.GWAF_LOCAL_DB.Model(&model.SpiderBot{}).Where("name = ?", req.Name).Limit(1).Find(&bean)
+	if bean.Id != "" && bean.Id != req.Id {
+		return errors.New("当前记录已经存在")
+	}
+
+	beanMap := map[string]interface{}{
+		"Name":         req.Name,
+		"Category":     req.Category,
+		"UAPatterns":   req.UAPatterns,
+		"RDNSSuffixes": req.RDNSSuffixes,
+		"IPRanges":     req.IPRanges,
+		"IPFiles":      req.IPFiles,
+		"Sort":         req.Sort,
+		"Status":       req.Status,
+		"Remarks":      req.Remarks,
+		"UPDATE_TIME":  customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.SpiderBot{}).Where("id = ?", req.Id).Updates(beanMap).Error
+}
+
+func (s *WafSpiderBotService) GetDetailApi(req request.WafSpiderBotDetailReq) model.SpiderBot {
+	var bean model.SpiderBot
+	global.GWAF_LOCAL_DB.Where("id=?", req.Id).Find(&bean)
+	return bean
+}
+
+func (s *WafSpiderBotService) GetDetailByIdApi(id string) model.SpiderBot {
+	var bean model.SpiderBot
+	global.GWAF_LOCAL_DB.Where("id=?", id).Find(&bean)
+	return bean
+}
+
+func (s *WafSpiderBotService) GetListApi(req request.WafSpiderBotSearchReq) ([]model.SpiderBot, int64, error) {
+	var list []model.SpiderBot
+	var total int64
+
+	query := global.GWAF_LOCAL_DB.Model(&model.SpiderBot{})
+	if len(req.Name) > 0 {
+		query = query.Where("name like ?", "%"+req.Name+"%")
+	}
+	if len(req.Category) > 0 {
+		query = query.Where("category = ?", req.Category)
+	}
+
+	query.Count(&total)
+	query.Order("sort asc").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list)
+
+	return list, total, nil
+}
+
+func (s *WafSpiderBotService) DelApi(req request.WafSpiderBotDelReq) error {
+	var bean model.SpiderBot
+	if err := global.GWAF_LOCAL_DB.Where("id = ?", req.Id).First(&bean).Error; err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.SpiderBot{}).Error
+}
+
+// SyncBuiltin 把内置爬虫库文件里数据库还没有的定义(按名称)加进去，返回新增条数。
+// 已有的不覆盖，用户改过的内置定义升级后保持原样（内置定义不允许删除，只能停用，否则下次启动又会被加回来）。
+func (s *WafSpiderBotService) SyncBuiltin(registryFile string) (int, error) {
+	list, err := wafbot.LoadRegistryFile(registryFile)
+	if err != nil {
+		return 0, fmt.Errorf("读取内置爬虫库失败: %w", err)
+	}
+	added := 0
+	for _, bot := range list {
+		if s.CheckIsExistApi(bot.Name) > 0 {
+			continue
+		}
+		bot.BaseOrm = baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		}
+		if err := global.GWAF_LOCAL_DB.Create(&bot).Error; err != nil {
+			zlog.Warn("内置爬虫同步失败", bot.Name, err.Error())
+			continue
+		}
+		added++
+	}
+	return added, nil
+}
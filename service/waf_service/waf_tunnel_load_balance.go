@@ -0,0 +1,91 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"errors"
+	"time"
+)
+
+type WafTunnelLoadBalanceService struct{}
+
+var WafTunnelLoadBalanceServiceApp = new(WafTunnelLoadBalanceService)
+
+func (receiver *WafTunnelLoadBalanceService) AddApi(req request.WafTunnelLoadBalanceAddReq) error {
+	var addBean = &model.TunnelLoadBalance{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		TunnelCode: req.TunnelCode,
+		RemoteIp:   req.RemoteIp,
+		RemotePort: req.RemotePort,
+		Weight:     req.Weight,
+		Remarks:    req.Remarks,
+	}
+	return global.GWAF_LOCAL_DB.Create(addBean).Error
+}
+
+func (receiver *WafTunnelLoadBalanceService) CheckIsExistApi(req request.WafTunnelLoadBalanceAddReq) error {
+	return global.GWAF_LOCAL_DB.First(&model.TunnelLoadBalance{}, "tunnel_code = ? and remote_ip= ? and remote_port= ?", req.TunnelCode,
+		req.RemoteIp, req.RemotePort).Error
+}
+
+func (receiver *WafTunnelLoadBalanceService) ModifyApi(req request.WafTunnelLoadBalanceEditReq) error {
+	var existBean model.TunnelLoadBalance
+	global.GWAF_LOCAL_DB.Where("tunnel_code = ? and remote_ip= ? and remote_port= ?", req.TunnelCode,
+		req.RemoteIp, req.RemotePort).Find(&existBean)
+	if existBean.Id != "" && existBean.Id != req.Id {
+		return errors.New("当前隧道下该目标IP+端口已经存在")
+	}
+	editMap := map[string]interface{}{
+		"TunnelCode":  req.TunnelCode,
+		"RemoteIp":    req.RemoteIp,
+		"RemotePort":  req.RemotePort,
+		"Weight":      req.Weight,
+		"Remarks":     req.Remarks,
+		"UPDATE_TIME": customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.TunnelLoadBalance{}).Where("id = ?", req.Id).Updates(editMap).Error
+}
+
+func (receiver *WafTunnelLoadBalanceService) GetDetailByIdApi(id string) model.TunnelLoadBalance {
+	var bean model.TunnelLoadBalance
+	global.GWAF_LOCAL_DB.Where("id=?", id).Find(&bean)
+	return bean
+}
+
+func (receiver *WafTunnelLoadBalanceService) GetListApi(req request.WafTunnelLoadBalanceSearchReq) ([]model.TunnelLoadBalance, int64, error) {
+	var list []model.TunnelLoadBalance
+	var total int64 = 0
+	query := global.GWAF_LOCAL_DB.Model(&model.TunnelLoadBalance{})
+	if len(req.TunnelCode) > 0 {
+		query = query.Where("tunnel_code = ?", req.TunnelCode)
+	}
+	query.Count(&total)
+	err := query.Order("create_time asc").Limit(req.PageSize).Offset(req.PageSize * (req.PageIndex - 1)).Find(&list).Error
+	return list, total, err
+}
+
+// GetListByTunnelCodeApi 取隧道全部目标，顺序固定（按创建时间），下标即运行时的目标编号
+func (receiver *WafTunnelLoadBalanceService) GetListByTunnelCodeApi(tunnelCode string) []model.TunnelLoadBalance {
+	var list []model.TunnelLoadBalance
+	global.GWAF_LOCAL_DB.Where("tunnel_code = ?", tunnelCode).Order("create_time asc").Find(&list)
+	return list
+}
+
+func (receiver *WafTunnelLoadBalanceService) DelApi(req request.WafTunnelLoadBalanceDelReq) error {
+	var bean model.TunnelLoadBalance
+	err := global.GWAF_LOCAL_DB.Where("id = ?", req.Id).First(&bean).Error
+	if err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.TunnelLoadBalance{}).Error
+}
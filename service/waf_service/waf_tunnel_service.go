@@ -46,6 +46,10 @@ func (receiver *WafTunnelService) AddApi(req request.WafTunnelAddReq) (*model.Tu
 		SSLCertificate:    req.SSLCertificate,
 		SSLCertificateKey: req.SSLCertificateKey,
 		SSLProtocols:      req.SSLProtocols,
+
+		IsEnableLoadBalance: req.IsEnableLoadBalance,
+		LoadBalanceStage:    req.LoadBalanceStage,
+		HealthyJSON:         req.HealthyJSON,
 	}
 	if bean.Code == "" {
 		bean.Code = bean.Id
@@ -141,6 +145,10 @@ func (receiver *WafTunnelService) ModifyApi(req request.WafTunnelEditReq) error
 		"SSLCertificateKey": req.SSLCertificateKey,
 		"SSLProtocols":      req.SSLProtocols,
 
+		"IsEnableLoadBalance": req.IsEnableLoadBalance,
+		"LoadBalanceStage":    req.LoadBalanceStage,
+		"HealthyJSON":         req.HealthyJSON,
+
 		"UPDATE_TIME": customtype.JsonTime(time.Now()),
 	}
 	err := global.GWAF_LOCAL_DB.Model(model.Tunnel{}).Where("id = ?", req.Id).Updates(beanMap).Error
@@ -185,3 +193,99 @@ func (receiver *WafTunnelService) GetTunnelConnections(id string) (model.Tunnel,
 
 	return tunnel, nil
 }
+
+// GetTunnelByCode 按唯一码取隧道
+func (receiver *WafTunnelService) GetTunnelByCode(code string) (model.Tunnel, error) {
+	var bean model.Tunnel
+	err := global.GWAF_LOCAL_DB.Where("code = ?", code).First(&bean).Error
+	return bean, err
+}
+
+// DeleteConnLogHistory 删除指定时间之前的隧道连接审计日志，保留期与访问日志一致
+func (receiver *WafTunnelService) DeleteConnLogHistory(day string) {
+	if global.GWAF_LOCAL_LOG_DB == nil {
+		return
+	}
+	global.GWAF_LOCAL_LOG_DB.Where("create_time < ?", day).Delete(&model.TunnelConnLog{})
+}
+
+// GetConnLogList 分页查询隧道连接审计日志
+func (receiver *WafTunnelService) GetConnLogList(req request.WafTunnelConnLogSearchReq) ([]model.TunnelConnLog, int64, error) {
+	var list []model.TunnelConnLog
+	var total int64
+	if global.GWAF_LOCAL_LOG_DB == nil {
+		return list, 0, nil
+	}
+
+	query := global.GWAF_LOCAL_LOG_DB.Model(&model.TunnelConnLog{})
+	if req.TunnelCode != "" {
+		query = query.Where("tunnel_code = ?", req.TunnelCode)
+	}
+	if req.ClientIP != "" {
+		query = query.Where("client_ip LIKE ?", "%"+req.ClientIP+"%")
+	}
+	if req.Protocol != "" {
+		query = query.Where("protocol = ?", req.Protocol)
+	}
+	if req.CloseReason != "" {
+		query = query.Where("close_reason = ?", req.CloseReason)
+	}
+	if req.DenyRule == "any" {
+		query = query.Where("deny_rule <> ''")
+	} else if req.DenyRule != "" {
+		query = query.Where("deny_rule = ?", req.DenyRule)
+	}
+	if req.StartTime > 0 {
+		query = query.Where("start_time >= ?", req.StartTime)
+	}
+	if req.EndTime > 0 {
+		query = query.Where("start_time <= ?", req.EndTime)
+	}
+
+	query.Count(&total)
+	err := query.Order("start_time DESC").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list).Error
+	return list, total, err
+}
+
+// GetTunnelDayStats 按天查询隧道流量
+func (receiver *WafTunnelService) GetTunnelDayStats(req request.WafTunnelStatsReq) ([]model.StatsTunnelDay, error) {
+	var list []model.StatsTunnelDay
+	if global.GWAF_LOCAL_STATS_DB == nil {
+		return list, nil
+	}
+	query := global.GWAF_LOCAL_STATS_DB.Model(&model.StatsTunnelDay{})
+	if req.TunnelCode != "" {
+		query = query.Where("tunnel_code = ?", req.TunnelCode)
+	}
+	if req.StartDay > 0 {
+		query = query.Where("day >= ?", req.StartDay)
+	}
+	if req.EndDay > 0 {
+		query = query.Where("day <= ?", req.EndDay)
+	}
+	err := query.Order("day ASC").Find(&list).Error
+	return list, err
+}
+
+// GetTunnelHourStats 按小时查询隧道流量（只保留最近3天）
+func (receiver *WafTunnelService) GetTunnelHourStats(req request.WafTunnelStatsReq) ([]model.StatsTunnelHour, error) {
+	var list []model.StatsTunnelHour
+	if global.GWAF_LOCAL_STATS_DB == nil {
+		return list, nil
+	}
+	query := global.GWAF_LOCAL_STATS_DB.Model(&model.StatsTunnelHour{})
+	if req.TunnelCode != "" {
+		query = query.Where("tunnel_code = ?", req.TunnelCode)
+	}
+	if req.StartTime > 0 {
+		query = query.Where("hour_time >= ?", req.StartTime)
+	}
+	if req.EndTime > 0 {
+		query = query.Where("hour_time <= ?", req.EndTime)
+	}
+	err := query.Order("hour_time ASC").Find(&list).Error
+	return list, err
+}
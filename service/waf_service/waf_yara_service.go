@@ -0,0 +1,122 @@
+package waf_service
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/request"
+	"SamWaf/wafenginecore/wafyara"
+	"errors"
+	"time"
+)
+
+type WafYaraService struct{}
+
+var WafYaraServiceApp = new(WafYaraService)
+
+// CheckParam 校验动作并试编译规则，返回规则条数；规则有错时在保存前就带行号报出来
+func (s *WafYaraService) CheckParam(name, action, content string) (int, error) {
+	if name == "" {
+		return 0, errors.New("规则集名称不能为空")
+	}
+	if action != model.YaraActionBlock && action != model.YaraActionLog {
+		return 0, errors.New("动作只能是 block 或 log")
+	}
+	set, err := wafyara.Compile(content)
+	if err != nil {
+		return 0, err
+	}
+	return set.Len(), nil
+}
+
+func (s *WafYaraService) AddApi(req request.WafYaraRuleSetAddReq, ruleCount int) error {
+	bean := &model.YaraRuleSet{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(time.Now()),
+			UPDATE_TIME: customtype.JsonTime(time.Now()),
+		},
+		Name:      req.Name,
+		Content:   req.Content,
+		RuleCount: ruleCount,
+		Action:    req.Action,
+		Status:    req.Status,
+		Remarks:   req.Remarks,
+	}
+	return global.GWAF_LOCAL_DB.Create(bean).Error
+}
+
+func (s *WafYaraService) CheckIsExistApi(name string) int {
+	var total int64
+	global.GWAF_LOCAL_DB.Model(&model.YaraRuleSet{}).Where("name = ?", name).Count(&total)
+	return int(total)
+}
+
+func (s *WafYaraService) ModifyApi(req request.WafYaraRuleSetEditReq, ruleCount int) error {
+	var bean model.YaraRuleSet
+	global.GWAF_LOCAL_DB.Model(&model.YaraRuleSet{}).Where("name = ?", req.Name).Limit(1).Find(&bean)
+	if bean.Id != "" && bean.Id != req.Id {
+		return errors.New("当前记录已经存在")
+	}
+
+	beanMap := map[string]interface{}{
+		"Name":        req.Name,
+		"Content":     req.Content,
+		"RuleCount":   ruleCount,
+		"Action":      req.Action,
+		"Status":      req.Status,
+		"Remarks":     req.Remarks,
+		"UPDATE_TIME": customtype.JsonTime(time.Now()),
+	}
+	return global.GWAF_LOCAL_DB.Model(model.YaraRuleSet{}).Where("id = ?", req.Id).Updates(beanMap).Error
+}
+
+func (s *WafYaraService) GetDetailApi(req request.WafYaraRuleSetDetailReq) model.YaraRuleSet {
+	var bean model.YaraRuleSet
+	global.GWAF_LOCAL_DB.Where("id=?", req.Id).Find(&bean)
+	return bean
+}
+
+func (s *WafYaraService) GetDetailByIdApi(id string) model.YaraRuleSet {
+	var bean model.YaraRuleSet
+	global.GWAF_LOCAL_DB.Where("id=?", id).Find(&bean)
+	return bean
+}
+
+func (s *WafYaraService) GetDetailByNameApi(name string) model.YaraRuleSet {
+	var bean model.YaraRuleSet
+	global.GWAF_LOCAL_DB.Where("name=?", name).Limit(1).Find(&bean)
+	return bean
+}
+
+// GetListApi 列表不返回规则文本，规则集可能很大，查看详情时再取
+func (s *WafYaraService) GetListApi(req request.WafYaraRuleSetSearchReq) ([]model.YaraRuleSet, int64, error) {
+	var list []model.YaraRuleSet
+	var total int64
+
+	query := global.GWAF_LOCAL_DB.Model(&model.YaraRuleSet{})
+	if len(req.Name) > 0 {
+		query = query.Where("name like ?", "%"+req.Name+"%")
+	}
+
+	query.Count(&total)
+	query.Omit("content").
+		Order("create_time desc").
+		Limit(req.PageSize).
+		Offset(req.PageSize * (req.PageIndex - 1)).
+		Find(&list)
+
+	return list, total, nil
+}
+
+func (s *WafYaraService) DelApi(req request.WafYaraRuleSetDelReq) error {
+	var bean model.YaraRuleSet
+	if err := global.GWAF_LOCAL_DB.Where("id = ?", req.Id).First(&bean).Error; err != nil {
+		return err
+	}
+	return global.GWAF_LOCAL_DB.Where("id = ?", req.Id).Delete(model.YaraRuleSet{}).Error
+}
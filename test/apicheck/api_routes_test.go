@@ -108,6 +108,7 @@ var registeredRoutes = []route{
 	{"POST", "/api/v1/wafhost/cacherule/list", "获取缓存规则列表"},
 	{"GET", "/api/v1/wafhost/cacherule/del", "删除缓存规则"},
 	{"POST", "/api/v1/wafhost/cacherule/edit", "编辑缓存规则"},
+	{"POST", "/api/v1/wafhost/cache/purge", "清理网站缓存"},
 
 	// ── 负载均衡 ───────────────────────────────────────────────────
 	{"POST", "/api/v1/wafhost/loadbalance/add", "新增负载均衡"},
@@ -192,6 +193,15 @@ var registeredRoutes = []route{
 	{"GET", "/api/v1/tunnel/tunnel/del", "删除隧道"},
 	{"POST", "/api/v1/tunnel/tunnel/edit", "编辑隧道"},
 	{"GET", "/api/v1/tunnel/tunnel/connections", "获取隧道连接数"},
+	{"POST", "/api/v1/tunnel/conn/kill", "断开隧道连接"},
+	{"POST", "/api/v1/tunnel/connlog/list", "隧道连接审计日志"},
+	{"POST", "/api/v1/tunnel/stats", "隧道流量统计"},
+	{"POST", "/api/v1/tunnel/loadbalance/add", "新增隧道负载目标"},
+	{"POST", "/api/v1/tunnel/loadbalance/list", "获取隧道负载目标列表"},
+	{"GET", "/api/v1/tunnel/loadbalance/detail", "获取隧道负载目标详情"},
+	{"POST", "/api/v1/tunnel/loadbalance/edit", "编辑隧道负载目标"},
+	{"GET", "/api/v1/tunnel/loadbalance/del", "删除隧道负载目标"},
+	{"GET", "/api/v1/tunnel/loadbalance/health", "隧道负载目标运行状态"},
 
 	// ── 通知渠道 ───────────────────────────────────────────────────
 	{"POST", "/api/v1/notify/channel/add", "新增通知渠道"},
@@ -282,6 +292,48 @@ var registeredRoutes = []route{
 	{"GET", "/api/v1/owasp/usage/doc", "获取OWASP规则管理使用说明"},
 	{"GET", "/api/v1/owasp/hit_stats", "获取OWASP规则命中统计"},
 	{"POST", "/api/v1/owasp/hit_stats/reset", "清空OWASP规则命中统计"},
+
+	// 配置即代码
+	{"POST", "/api/v1/configbundle/export", "导出网站配置包"},
+	{"POST", "/api/v1/configbundle/plan", "预览配置包变更"},
+	{"POST", "/api/v1/configbundle/apply", "应用配置包"},
+
+	// 内置检测误报排除
+	{"POST", "/api/v1/wafhost/detectexclusion/add", "添加误报排除"},
+	{"POST", "/api/v1/wafhost/detectexclusion/fromlog", "从攻击日志生成误报排除"},
+	{"POST", "/api/v1/wafhost/detectexclusion/list", "误报排除列表"},
+	{"GET", "/api/v1/wafhost/detectexclusion/detail", "误报排除详情"},
+	{"POST", "/api/v1/wafhost/detectexclusion/edit", "编辑误报排除"},
+	{"GET", "/api/v1/wafhost/detectexclusion/del", "删除误报排除"},
+
+	// 接口规范（OpenAPI 正向安全模型）
+	{"POST", "/api/v1/wafhost/apispec/add", "添加接口规范"},
+	{"POST", "/api/v1/wafhost/apispec/list", "接口规范列表"},
+	{"GET", "/api/v1/wafhost/apispec/detail", "接口规范详情"},
+	{"POST", "/api/v1/wafhost/apispec/edit", "编辑接口规范"},
+	{"GET", "/api/v1/wafhost/apispec/del", "删除接口规范"},
+	{"POST", "/api/v1/wafhost/apispec/learn", "从访问日志学习生成接口规范草稿"},
+
+	// 爬虫库
+	{"POST", "/api/v1/spiderbot/add", "添加爬虫定义"},
+	{"POST", "/api/v1/spiderbot/list", "爬虫库列表"},
+	{"GET", "/api/v1/spiderbot/detail", "爬虫定义详情"},
+	{"POST", "/api/v1/spiderbot/edit", "编辑爬虫定义"},
+	{"GET", "/api/v1/spiderbot/del", "删除爬虫定义"},
+
+	// YARA 规则
+	{"POST", "/api/v1/yara/add", "添加YARA规则集"},
+	{"POST", "/api/v1/yara/upload", "上传YARA规则文件"},
+	{"POST", "/api/v1/yara/list", "YARA规则集列表"},
+	{"GET", "/api/v1/yara/detail", "YARA规则集详情"},
+	{"POST", "/api/v1/yara/edit", "编辑YARA规则集"},
+	{"GET", "/api/v1/yara/del", "删除YARA规则集"},
+	// gRPC 描述文件
+	{"POST", "/api/v1/grpc_descriptor/upload", "上传gRPC描述文件"},
+	{"POST", "/api/v1/grpc_descriptor/list", "gRPC描述文件列表"},
+	{"GET", "/api/v1/grpc_descriptor/detail", "gRPC描述文件详情"},
+	{"POST", "/api/v1/grpc_descriptor/edit", "编辑gRPC描述文件"},
+	{"GET", "/api/v1/grpc_descriptor/del", "删除gRPC描述文件"},
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
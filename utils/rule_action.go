@@ -13,6 +13,8 @@ const (
 	RuleActionDeny  = "deny"  // 拦截（默认）
 	RuleActionAllow = "allow" // 放行
 	RuleActionLog   = "log"   // 仅记录
+	// 浏览器挑战：没有通过验证的访客先完成挑战(JS 挑战/验证码)，通过后放行
+	RuleActionChallenge = "challenge"
 )
 
 // 可跳过的检测模块名（Allow 的参数只接受这些值，大小写不敏感）
@@ -26,12 +28,16 @@ const (
 // 两者的区别只在于放行之后跳过多大范围的后续检测
 var ruleSkipModules = []string{
 	"BOT",       // 爬虫检测
+	"APISPEC",   // 接口规范校验
+	"GRAPHQL",   // GraphQL 防护
 	"SQLI",      // SQL注入
 	"XSS",       // XSS
 	"SCAN",      // 扫描工具
 	"RCE",       // 远程命令执行
 	"DIR",       // 目录穿越
+	"SSRF",      // SSRF
 	"CC",        // CC防护
+	"LOGIN",     // 登录接口防撞库
 	"AI",        // AI智能检测
 	"SENSITIVE", // 敏感词
 	"OWASP",     // OWASP规则集
@@ -59,7 +65,7 @@ func RuleSkipModules() []string {
 
 // RuleActionInfo 一条规则的动作信息
 type RuleActionInfo struct {
-	Action      string   // deny / allow / log
+	Action      string   // deny / challenge / allow / log
 	SkipModules []string // 仅 allow 有效，元素为大写模块名；含 "ALL" 表示跳过全部
 }
 
@@ -78,8 +84,8 @@ var (
 	ruleBlockRegex = regexp.MustCompile(`(?m)\brule\s+([A-Za-z0-9_]+)`)
 	// then 关键字
 	ruleThenRegex = regexp.MustCompile(`\bthen\b`)
-	// 动作标记：RF.Allow(...) / RF.AllowAll() / RF.Deny() / RF.Log()
-	ruleActionRegex = regexp.MustCompile(`RF\s*\.\s*(AllowAll|Allow|Deny|Log)\s*\(([^)]*)\)`)
+	// 动作标记：RF.Allow(...) / RF.AllowAll() / RF.Deny() / RF.Log() / RF.Challenge()
+	ruleActionRegex = regexp.MustCompile(`RF\s*\.\s*(AllowAll|Allow|Deny|Log|Challenge)\s*\(([^)]*)\)`)
 	// 优先级：rule Rxxx "描述" salience 10 {
 	ruleSalienceRegex = regexp.MustCompile(`\bsalience\s+(\d+)`)
 )
@@ -283,6 +289,8 @@ func extractBlockAction(skeletonBlock, rawBlock string) (info RuleActionInfo, co
 			cur = RuleActionInfo{Action: RuleActionDeny}
 		case "Log":
 			cur = RuleActionInfo{Action: RuleActionLog}
+		case "Challenge":
+			cur = RuleActionInfo{Action: RuleActionChallenge}
 		case "AllowAll":
 			cur = RuleActionInfo{Action: RuleActionAllow, SkipModules: []string{RuleSkipAll}}
 		case "Allow":
@@ -336,7 +344,7 @@ func ExtractRuleActionForCheck(ruleText string) (RuleActionInfo, error) {
 		if count > 1 {
 			// 多个标记：只要动作语义不完全一致就报错
 			if !hasSingleAction(skeletonBlock) {
-				return info, fmt.Errorf("规则 %s 中声明了多个不同的动作，一条规则只能有一个动作(RF.Deny/RF.Allow/RF.Log)", block.Name)
+				return info, fmt.Errorf("规则 %s 中声明了多个不同的动作，一条规则只能有一个动作(RF.Deny/RF.Allow/RF.Log/RF.Challenge)", block.Name)
 			}
 		}
 		info = blockInfo
@@ -34,6 +34,16 @@ func TestExtractRuleActions_Basic(t *testing.T) {
 }`,
 			wantAction: RuleActionDeny,
 		},
+		{
+			name: "Challenge",
+			ruleText: `rule Rabc123 "挑战" salience 10 {
+    when
+        MF.URL.Contains("/login") == true
+    then
+        RF.Challenge();
+}`,
+			wantAction: RuleActionChallenge,
+		},
 		{
 			name: "Deny和Retract共存",
 			ruleText: `rule Rabc123 "拦截" salience 10 {
@@ -1,7 +1,6 @@
 package wafbot
 
 import (
-	"SamWaf/utils"
 	"errors"
 	"net"
 	"strings"
@@ -12,404 +11,89 @@ type BotResult struct {
 	IsBot       bool   //是否是爬虫
 	IsNormalBot bool   //是否是正常爬虫 false 会拦截
 	BotName     string //爬虫名称
+	Category    string //爬虫类别 search/ai/seo/monitor/scraper
+	UAOnly      bool   //定义里没有IP段和反向DNS，只按 UA 认定；这种结果不能按IP缓存，否则同一出口IP的浏览器也会被当成爬虫
 }
 
+// DNS 查询入口，测试时替换
+var (
+	reverseLookup = ReverseDNSLookup
+	forwardLookup = ForwardDNSLookup
+)
+
 /*
 *
 判断是否正确的搜索引擎 返回值： 是否是爬虫，是否是正常爬虫， 爬虫名称
 */
 func DetermineNormalSearch(userAgent, ip string) BotResult {
-	if strings.Contains(userAgent, "Baiduspider") {
-		return baiduSpider(ip)
-	} else if strings.Contains(userAgent, "google") {
-		return googleSpider(ip)
-	} else if strings.Contains(userAgent, "bingbot") || strings.Contains(userAgent, "msn.com") {
-		return bingSpider(ip)
-	} else if strings.Contains(userAgent, "sogou") {
-		return sogouSpider(ip)
-	} else if strings.Contains(userAgent, "360Spider") {
-		return spider360(ip)
-	} else if strings.Contains(userAgent, "YisouSpider") {
-		return yisouSpider(ip)
-	} else if strings.Contains(userAgent, "Bytespider") {
-		return byteSpider(ip)
+	def := CurrentRegistry().Match(userAgent)
+	if def == nil {
+		return BotResult{}
 	}
-	return BotResult{false, false, ""}
+	return def.Verify(ip)
 }
 
-/*
-*
-百度的蜘蛛
-*/
-func baiduSpider(ip string) BotResult {
-	//先查询本地库
-	//然后远端查询
-	fakeSpiderResult := BotResult{
-		IsBot:       true,
-		IsNormalBot: false,
-		BotName:     "伪装百度爬虫",
-	}
-	lookup, err := ReverseDNSLookup(ip)
-	if err == nil {
-		if len(lookup) > 0 {
-			if strings.HasSuffix(lookup[0], ".baidu.com.") || strings.HasSuffix(lookup[0], ".baidu.jp.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "百度爬虫",
-				}
-			} else {
-				return fakeSpiderResult
-			}
-		} else {
-			return fakeSpiderResult
-		}
-	} else {
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			if dnsErr.IsTimeout {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询超时",
-				}
-			} else if dnsErr.IsNotFound {
-				return fakeSpiderResult
-			} else {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询失败",
-				}
-			}
-		} else {
-			return BotResult{
-				IsBot:       true,
-				IsNormalBot: true,
-				BotName:     "查询失败",
+// Verify 核验 IP 是否真是该爬虫：先查公开IP段，再做反向DNS + 正向确认；
+// 两者都没配置的爬虫无法核验，只按 UA 认定
+func (d *CrawlerDef) Verify(ip string) BotResult {
+	normal := BotResult{IsBot: true, IsNormalBot: true, BotName: d.Name, Category: d.Category}
+	fake := BotResult{IsBot: true, IsNormalBot: false, BotName: "伪装" + d.Name, Category: d.Category}
+	if len(d.ipNets) == 0 && len(d.rdnsSuffixes) == 0 {
+		normal.UAOnly = true
+		return normal
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, ipNet := range d.ipNets {
+			if ipNet.Contains(parsed) {
+				return normal
 			}
 		}
 	}
-}
-
-/*
-*
-谷歌的蜘蛛
-*/
-func googleSpider(ip string) BotResult {
-	//先查询本地库
-	//然后远端查询
-	fakeSpiderResult := BotResult{
-		IsBot:       true,
-		IsNormalBot: false,
-		BotName:     "伪装Google爬虫",
-	}
-	lookup, err := ReverseDNSLookup(ip)
-	if err == nil {
-		if len(lookup) > 0 {
-			if strings.HasSuffix(lookup[0], ".googlebot.com.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "Google爬虫",
-				}
-			} else if strings.HasSuffix(lookup[0], ".google.com.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "Google爬虫(特殊)",
-				}
-			} else if strings.HasSuffix(lookup[0], ".googleusercontent.com.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "Google爬虫(用户触发)",
-				}
-			} else {
-				return fakeSpiderResult
-			}
-		} else {
-			return fakeSpiderResult
-		}
-	} else {
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			if dnsErr.IsTimeout {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询超时",
-				}
-			} else if dnsErr.IsNotFound {
-				return fakeSpiderResult
-			} else {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询失败",
-				}
-			}
-		} else {
-			return BotResult{
-				IsBot:       true,
-				IsNormalBot: true,
-				BotName:     "查询失败",
-			}
-		}
+	if len(d.rdnsSuffixes) == 0 {
+		return fake
 	}
-}
 
-/*
-*
-bing的蜘蛛
-*/
-func bingSpider(ip string) BotResult {
-	//先查询本地库
-	//然后远端查询
-	fakeSpiderResult := BotResult{
-		IsBot:       true,
-		IsNormalBot: false,
-		BotName:     "伪装Bing爬虫",
+	names, err := reverseLookup(ip)
+	if err != nil {
+		return d.dnsErrorResult(err, fake)
 	}
-	lookup, err := ReverseDNSLookup(ip)
-	if err == nil {
-		if len(lookup) > 0 {
-			if strings.HasSuffix(lookup[0], ".msn.com.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "Bing爬虫",
-				}
-			} else {
-				return fakeSpiderResult
-			}
-		} else {
-			return fakeSpiderResult
+	for _, name := range names {
+		if !d.matchRDNS(name) {
+			continue
 		}
-	} else {
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			if dnsErr.IsTimeout {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询超时",
-				}
-			} else if dnsErr.IsNotFound {
-				return fakeSpiderResult
-			} else {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询失败",
-				}
-			}
-		} else {
-			return BotResult{
-				IsBot:       true,
-				IsNormalBot: true,
-				BotName:     "查询失败",
-			}
+		// 正向确认：PTR 记录谁都能给自己的IP设，解析回来包含该IP才算数
+		addrs, err := forwardLookup(name)
+		if err != nil {
+			return d.dnsErrorResult(err, fake)
 		}
-	}
-}
-
-/*
-*
-sogou蜘蛛
-*/
-func sogouSpider(ip string) BotResult {
-	//先查询本地库
-	//然后远端查询
-	fakeSpiderResult := BotResult{
-		IsBot:       true,
-		IsNormalBot: false,
-		BotName:     "伪装搜狗爬虫",
-	}
-	lookup, err := ReverseDNSLookup(ip)
-	if err == nil {
-		if len(lookup) > 0 {
-			if strings.HasSuffix(lookup[0], ".sogou.com.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "搜狗爬虫",
-				}
-			} else {
-				return fakeSpiderResult
-			}
-		} else {
-			return fakeSpiderResult
-		}
-	} else {
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			if dnsErr.IsTimeout {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询超时",
-				}
-			} else if dnsErr.IsNotFound {
-				return fakeSpiderResult
-			} else {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询失败",
-				}
-			}
-		} else {
-			return BotResult{
-				IsBot:       true,
-				IsNormalBot: true,
-				BotName:     "查询失败",
+		for _, addr := range addrs {
+			if addr.String() == ip || addr.Equal(net.ParseIP(ip)) {
+				return normal
 			}
 		}
 	}
+	return fake
 }
 
-/*
-*
-360 搜索引擎
-*/
-func spider360(ip string) BotResult {
-	// 将要检查的 IP 地址段转换成数组
-	ipRanges := []string{
-		"180.153.232.",
-		"180.153.234.",
-		"180.153.236.",
-		"180.163.220.",
-		"42.236.101.",
-		"42.236.102.",
-		"42.236.103.",
-		"42.236.10.",
-		"42.236.12.",
-		"42.236.13.",
-		"42.236.14.",
-		"42.236.15.",
-		"42.236.16.",
-		"42.236.17.",
-		"42.236.46.",
-		"42.236.48.",
-		"42.236.49.",
-		"42.236.50.",
-		"42.236.51.",
-		"42.236.52.",
-		"42.236.53.",
-		"42.236.54.",
-		"42.236.55.",
-		"42.236.99.",
-	}
-	// 判断指定 IP 是否在数组中的 IP 地址段范围内
-	isInRange := false
-	for _, ipRange := range ipRanges {
-		if strings.HasPrefix(ip, ipRange) {
-			isInRange = true
-			break
-		}
-	}
-	if isInRange {
-		return BotResult{
-			IsBot:       true,
-			IsNormalBot: true,
-			BotName:     "360爬虫",
-		}
-	} else {
-		return BotResult{
-			IsBot:       true,
-			IsNormalBot: false,
-			BotName:     "伪装360爬虫",
+func (d *CrawlerDef) matchRDNS(name string) bool {
+	name = strings.Trim(strings.ToLower(name), ".")
+	for _, s := range d.rdnsSuffixes {
+		if name == s || strings.HasSuffix(name, "."+s) {
+			return true
 		}
 	}
+	return false
 }
 
-/*
-*
-UC 搜索
-*/
-func yisouSpider(ip string) BotResult {
-	//先查询本地库
-	//然后远端查询
-
-	fakeSpiderResult := BotResult{
-		IsBot:       true,
-		IsNormalBot: false,
-		BotName:     "伪装神马搜索爬虫",
-	}
-	lookup, err := ReverseDNSLookup(ip)
-	if err == nil {
-		if len(lookup) > 0 {
-			if strings.HasSuffix(lookup[0], ".sm.cn.") {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "神马搜索爬虫",
-				}
-			} else {
-				return fakeSpiderResult
-			}
-		} else {
-			return fakeSpiderResult
-		}
-	} else {
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			if dnsErr.IsTimeout {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询超时",
-				}
-			} else if dnsErr.IsNotFound {
-				return fakeSpiderResult
-			} else {
-				return BotResult{
-					IsBot:       true,
-					IsNormalBot: true,
-					BotName:     "查询失败",
-				}
-			}
-		} else {
-			return BotResult{
-				IsBot:       true,
-				IsNormalBot: true,
-				BotName:     "查询失败",
-			}
-		}
-	}
-}
-
-/*
-*
-字节跳动的爬虫
-*/
-func byteSpider(ip string) BotResult {
-	ipRanges := []string{
-		"110.249.201.0/24",
-		"110.249.202.0/24",
-		"111.225.148.0/24",
-		"111.225.149.0/24",
-		"220.243.135.0/24",
-		"220.243.136.0/24",
-		"220.243.188.0/24",
-		"220.243.189.0/24",
-		"60.8.123.0/24",
-		"60.8.151.0/24",
-	}
-
-	isInRanges := utils.CheckIPInRanges(ip, ipRanges)
-	if isInRanges {
-		return BotResult{
-			IsBot:       true,
-			IsNormalBot: true,
-			BotName:     "字节跳动爬虫",
-		}
-	} else {
-		return BotResult{
-			IsBot:       true,
-			IsNormalBot: false,
-			BotName:     "伪装字节跳动爬虫",
+// dnsErrorResult 查询超时/失败时先按正常爬虫放过(不缓存)，查不到记录才算伪装
+func (d *CrawlerDef) dnsErrorResult(err error, fake BotResult) BotResult {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return BotResult{IsBot: true, IsNormalBot: true, BotName: "查询超时", Category: d.Category}
+		} else if dnsErr.IsNotFound {
+			return fake
 		}
 	}
+	return BotResult{IsBot: true, IsNormalBot: true, BotName: "查询失败", Category: d.Category}
 }
@@ -7,20 +7,23 @@ import (
 	"time"
 )
 
-func ReverseDNSLookup(ipAddress string) ([]string, error) {
-	//startTime := time.Now()
-
-	ctx := context.Background()
-	d := net.Dialer{Resolver: &net.Resolver{
+// dnsResolver 使用配置的DNS服务器查询，不走系统解析
+func dnsResolver() *net.Resolver {
+	return &net.Resolver{
 		PreferGo: true,
 		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 			return net.Dial("udp", global.GWAF_RUNTIME_DNS_SERVER+":53")
 		},
-	}}
+	}
+}
 
+func ReverseDNSLookup(ipAddress string) ([]string, error) {
+	//startTime := time.Now()
+
+	ctx := context.Background()
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(global.GWAF_RUNTIME_DNS_TIMEOUT)*time.Millisecond)
 	defer cancel()
-	names, err := d.Resolver.LookupAddr(ctxWithTimeout, ipAddress)
+	names, err := dnsResolver().LookupAddr(ctxWithTimeout, ipAddress)
 
 	//elapsed := time.Since(startTime)
 
@@ -30,3 +33,10 @@ func ReverseDNSLookup(ipAddress string) ([]string, error) {
 	}
 	return names, nil
 }
+
+// ForwardDNSLookup 正向解析，用于反向DNS结果的正向确认
+func ForwardDNSLookup(host string) ([]net.IP, error) {
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), time.Duration(global.GWAF_RUNTIME_DNS_TIMEOUT)*time.Millisecond)
+	defer cancel()
+	return dnsResolver().LookupIP(ctxWithTimeout, "ip", host)
+}
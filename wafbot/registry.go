@@ -0,0 +1,217 @@
+package wafbot
+
+import (
+	"SamWaf/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// 爬虫库：每个爬虫是一条数据(UA 特征 + 反向DNS后缀 + 公开IP段)，不再一个爬虫写一个函数。
+// 数据库里的定义编译成 Registry 后整体替换，检测时无锁读取。
+
+// CrawlerDef 编译后的爬虫定义
+type CrawlerDef struct {
+	Name         string
+	Category     string
+	uaPatterns   []string     //已转小写
+	rdnsSuffixes []string     //已转小写、去掉首尾的点
+	ipNets       []*net.IPNet //IP段与公开IP列表文件合并后的结果
+}
+
+// Registry 编译后的爬虫库，按 Sort 排好序
+type Registry struct {
+	defs []*CrawlerDef
+}
+
+var currentRegistry atomic.Pointer[Registry]
+
+// SetRegistry 发布新的爬虫库
+func SetRegistry(r *Registry) {
+	currentRegistry.Store(r)
+}
+
+// CurrentRegistry 当前生效的爬虫库，未加载时为 nil
+func CurrentRegistry() *Registry {
+	return currentRegistry.Load()
+}
+
+// Len 爬虫定义数
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.defs)
+}
+
+// Match 按 UA 找爬虫定义，未命中返回 nil
+func (r *Registry) Match(userAgent string) *CrawlerDef {
+	if r == nil || userAgent == "" {
+		return nil
+	}
+	ua := strings.ToLower(userAgent)
+	for _, d := range r.defs {
+		for _, p := range d.uaPatterns {
+			if strings.Contains(ua, p) {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// BuildRegistry 把数据库里启用的爬虫定义编译成 Registry。ipFileDir 是公开IP列表文件所在目录(data/spiderbot)。
+// 单条定义出错不影响其它定义，错误一并返回供调用方记日志。
+func BuildRegistry(list []model.SpiderBot, ipFileDir string) (*Registry, []error) {
+	var errs []error
+	sorted := make([]model.SpiderBot, 0, len(list))
+	for _, bot := range list {
+		if bot.Status == 1 {
+			sorted = append(sorted, bot)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Sort < sorted[j].Sort })
+
+	fileCache := map[string][]*net.IPNet{}
+	r := &Registry{}
+	for _, bot := range sorted {
+		d := &CrawlerDef{Name: bot.Name, Category: bot.Category}
+		for _, p := range SplitSpiderBotList(bot.UAPatterns) {
+			d.uaPatterns = append(d.uaPatterns, strings.ToLower(p))
+		}
+		if len(d.uaPatterns) == 0 {
+			errs = append(errs, fmt.Errorf("爬虫 %s 没有 UA 特征，已忽略", bot.Name))
+			continue
+		}
+		for _, s := range SplitSpiderBotList(bot.RDNSSuffixes) {
+			if s = strings.Trim(strings.ToLower(s), "."); s != "" {
+				d.rdnsSuffixes = append(d.rdnsSuffixes, s)
+			}
+		}
+		for _, s := range SplitSpiderBotList(bot.IPRanges) {
+			ipNet, err := parseIPOrCIDR(s)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("爬虫 %s 的IP段 %s 无效", bot.Name, s))
+				continue
+			}
+			d.ipNets = append(d.ipNets, ipNet)
+		}
+		for _, f := range SplitSpiderBotList(bot.IPFiles) {
+			nets, ok := fileCache[f]
+			if !ok {
+				var err error
+				if nets, err = loadIPListFile(filepath.Join(ipFileDir, filepath.Base(f))); err != nil {
+					errs = append(errs, fmt.Errorf("爬虫 %s 的IP列表文件 %s 读取失败: %w", bot.Name, f, err))
+				}
+				fileCache[f] = nets
+			}
+			d.ipNets = append(d.ipNets, nets...)
+		}
+		r.defs = append(r.defs, d)
+	}
+	return r, errs
+}
+
+// SplitSpiderBotList 拆分多值字段：换行或逗号分隔，去掉空白与空项
+func SplitSpiderBotList(s string) []string {
+	fields := strings.FieldsFunc(s, func(c rune) bool { return c == '\n' || c == '\r' || c == ',' })
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// spiderIPListFile 公开IP列表文件格式(data/spiderbot/*.json)
+type spiderIPListFile struct {
+	BotList []struct {
+		IP string `json:"ip"`
+	} `json:"BotList"`
+}
+
+func loadIPListFile(path string) ([]*net.IPNet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f spiderIPListFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	nets := make([]*net.IPNet, 0, len(f.BotList))
+	for _, item := range f.BotList {
+		if ipNet, err := parseIPOrCIDR(strings.TrimSpace(item.IP)); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets, nil
+}
+
+// RegistryFile 随发布包内置的爬虫库文件(data/spiderbot/registry.json)
+type RegistryFile struct {
+	Desc string            `json:"desc"`
+	Bots []RegistryFileBot `json:"bots"`
+}
+
+// RegistryFileBot 内置爬虫库文件中的一条定义
+type RegistryFileBot struct {
+	Name         string   `json:"name"`
+	Category     string   `json:"category"`
+	UAPatterns   []string `json:"ua_patterns"`
+	RDNSSuffixes []string `json:"rdns_suffixes"`
+	IPRanges     []string `json:"ip_ranges"`
+	IPFiles      []string `json:"ip_files"`
+	Sort         int      `json:"sort"`
+	Remarks      string   `json:"remarks"`
+}
+
+// LoadRegistryFile 读取内置爬虫库文件，转换成数据库模型(未填主键等公共字段)
+func LoadRegistryFile(path string) ([]model.SpiderBot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f RegistryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	list := make([]model.SpiderBot, 0, len(f.Bots))
+	for _, b := range f.Bots {
+		list = append(list, model.SpiderBot{
+			Name:         b.Name,
+			Category:     b.Category,
+			UAPatterns:   strings.Join(b.UAPatterns, "\n"),
+			RDNSSuffixes: strings.Join(b.RDNSSuffixes, "\n"),
+			IPRanges:     strings.Join(b.IPRanges, "\n"),
+			IPFiles:      strings.Join(b.IPFiles, ","),
+			Sort:         b.Sort,
+			Builtin:      1,
+			Status:       1,
+			Remarks:      b.Remarks,
+		})
+	}
+	return list, nil
+}
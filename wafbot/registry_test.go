@@ -0,0 +1,116 @@
+package wafbot
+
+import (
+	"SamWaf/model"
+	"net"
+	"testing"
+)
+
+const bundledSpiderBotDir = "../cmd/samwaf/exedata/spiderbot"
+
+func loadBundledRegistry(t *testing.T) *Registry {
+	t.Helper()
+	list, err := LoadRegistryFile(bundledSpiderBotDir + "/registry.json")
+	if err != nil {
+		t.Fatalf("读取内置爬虫库失败: %v", err)
+	}
+	r, errs := BuildRegistry(list, bundledSpiderBotDir)
+	if len(errs) > 0 {
+		t.Fatalf("内置爬虫库编译出错: %v", errs)
+	}
+	return r
+}
+
+// stubDNS 替换 DNS 查询，返回恢复函数
+func stubDNS(ptr map[string][]string, a map[string][]net.IP) func() {
+	oldReverse, oldForward := reverseLookup, forwardLookup
+	reverseLookup = func(ip string) ([]string, error) {
+		if names, ok := ptr[ip]; ok {
+			return names, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: ip, IsNotFound: true}
+	}
+	forwardLookup = func(host string) ([]net.IP, error) {
+		if ips, ok := a[host]; ok {
+			return ips, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return func() { reverseLookup, forwardLookup = oldReverse, oldForward }
+}
+
+func TestBundledRegistryIPRanges(t *testing.T) {
+	SetRegistry(loadBundledRegistry(t))
+	defer SetRegistry(nil)
+	defer stubDNS(nil, nil)()
+
+	res := DetermineNormalSearch("Mozilla/5.0 (compatible; Bytespider; spider-feedback@bytedance.com)", "110.249.201.8")
+	if !res.IsNormalBot || res.BotName != "字节跳动爬虫" || res.Category != model.SpiderBotCategoryAI {
+		t.Fatalf("公开IP段内应核验通过: %+v", res)
+	}
+	res = DetermineNormalSearch("Mozilla/5.0 (compatible; Bytespider)", "8.8.8.8")
+	if !res.IsBot || res.IsNormalBot || res.BotName != "伪装字节跳动爬虫" {
+		t.Fatalf("公开IP段外且无反向DNS配置应判为伪装: %+v", res)
+	}
+	if res := DetermineNormalSearch("Mozilla/5.0 (compatible; 360Spider)", "42.236.10.5"); !res.IsNormalBot {
+		t.Fatalf("360 爬虫IP段应核验通过: %+v", res)
+	}
+	if res := DetermineNormalSearch("Mozilla/5.0 Chrome/120", "1.2.3.4"); res.IsBot {
+		t.Fatalf("普通浏览器不应识别为爬虫: %+v", res)
+	}
+}
+
+func TestRegistryUAOnly(t *testing.T) {
+	SetRegistry(loadBundledRegistry(t))
+	defer SetRegistry(nil)
+
+	res := DetermineNormalSearch("Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.1; +https://openai.com/gptbot)", "5.6.7.8")
+	if !res.IsNormalBot || !res.UAOnly || res.Category != model.SpiderBotCategoryAI {
+		t.Fatalf("只按 UA 识别的爬虫应直接认定: %+v", res)
+	}
+	res = DetermineNormalSearch("python-requests/2.31.0", "5.6.7.8")
+	if !res.IsNormalBot || !res.UAOnly || res.Category != model.SpiderBotCategoryScraper {
+		t.Fatalf("采集脚本应归入 scraper 类别: %+v", res)
+	}
+}
+
+func TestRegistryReverseDNSForwardConfirm(t *testing.T) {
+	SetRegistry(loadBundledRegistry(t))
+	defer SetRegistry(nil)
+	defer stubDNS(map[string][]string{
+		"116.179.32.1": {"baiduspider-116-179-32-1.crawl.baidu.com."},
+		"9.9.9.9":      {"baiduspider.crawl.baidu.com."}, //伪造的 PTR，正向解析不回到该IP
+	}, map[string][]net.IP{
+		"baiduspider-116-179-32-1.crawl.baidu.com.": {net.ParseIP("116.179.32.1")},
+		"baiduspider.crawl.baidu.com.":              {net.ParseIP("116.179.32.2")},
+	})()
+
+	ua := "Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)"
+	if res := DetermineNormalSearch(ua, "116.179.32.1"); !res.IsNormalBot || res.BotName != "百度爬虫" {
+		t.Fatalf("反向DNS+正向确认应核验通过: %+v", res)
+	}
+	if res := DetermineNormalSearch(ua, "9.9.9.9"); res.IsNormalBot || res.BotName != "伪装百度爬虫" {
+		t.Fatalf("正向确认不通过应判为伪装: %+v", res)
+	}
+	if res := DetermineNormalSearch(ua, "10.0.0.1"); res.IsNormalBot {
+		t.Fatalf("查不到反向记录应判为伪装: %+v", res)
+	}
+}
+
+func TestBuildRegistrySkipsInvalid(t *testing.T) {
+	r, errs := BuildRegistry([]model.SpiderBot{
+		{Name: "b", UAPatterns: "BBot", Sort: 20, Status: 1},
+		{Name: "a", UAPatterns: "ABot\nBBot", IPRanges: "1.2.3.0/24, bad", Sort: 10, Status: 1},
+		{Name: "empty", Status: 1},
+		{Name: "off", UAPatterns: "OffBot", Status: 0},
+	}, "")
+	if len(errs) != 2 || r.Len() != 2 {
+		t.Fatalf("应编译 2 条并报告 2 个错误: len=%d errs=%v", r.Len(), errs)
+	}
+	if d := r.Match("xx bbot/1.0"); d == nil || d.Name != "a" {
+		t.Fatalf("应按 sort 先匹配到 a: %+v", d)
+	}
+	if r.Match("OffBot") != nil {
+		t.Fatalf("停用的定义不应生效")
+	}
+}
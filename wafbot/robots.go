@@ -0,0 +1,143 @@
+package wafbot
+
+import (
+	"strings"
+)
+
+// robots.txt 解析与匹配（RFC 9309）：
+// 按 User-agent 分组，爬虫取 UA 中能匹配到的最长产品名分组，都匹配不到用 * 分组；
+// 组内 Allow/Disallow 取匹配长度最长的一条，等长时 Allow 优先；支持 * 通配与结尾 $ 锚定。
+
+// RobotsMaxBytes robots.txt 最多解析的大小，超出部分忽略(与主流搜索引擎一致取 500KB)
+const RobotsMaxBytes = 500 * 1024
+
+// RobotsRule 一条 Allow/Disallow 规则
+type RobotsRule struct {
+	Allow bool
+	Path  string
+}
+
+// RobotsGroup 一个 User-agent 分组
+type RobotsGroup struct {
+	Agents []string //已转小写
+	Rules  []RobotsRule
+}
+
+// Robots 解析后的 robots.txt
+type Robots struct {
+	Groups []RobotsGroup
+}
+
+// ParseRobots 解析 robots.txt 内容，无法识别的行忽略
+func ParseRobots(content string) *Robots {
+	if len(content) > RobotsMaxBytes {
+		content = content[:RobotsMaxBytes]
+	}
+	r := &Robots{}
+	var cur *RobotsGroup
+	inRules := false
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			// 连续的 User-agent 行属于同一组，规则之后再出现的开始新组
+			if cur == nil || inRules {
+				r.Groups = append(r.Groups, RobotsGroup{})
+				cur = &r.Groups[len(r.Groups)-1]
+				inRules = false
+			}
+			if value != "" {
+				cur.Agents = append(cur.Agents, strings.ToLower(value))
+			}
+		case "allow", "disallow":
+			if cur == nil {
+				continue
+			}
+			inRules = true
+			// 空的 Disallow 表示全部允许，不产生规则
+			if value == "" {
+				continue
+			}
+			cur.Rules = append(cur.Rules, RobotsRule{Allow: key == "allow", Path: value})
+		}
+	}
+	return r
+}
+
+// Allowed 判断该 UA 是否允许访问 path(含查询串)；没有适用的分组或规则时允许
+func (r *Robots) Allowed(userAgent, path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	best := -1
+	allow := true
+	for _, rule := range r.rulesFor(strings.ToLower(userAgent)) {
+		if !robotsMatch(rule.Path, path) {
+			continue
+		}
+		if n := len(rule.Path); n > best || (n == best && rule.Allow) {
+			best, allow = n, rule.Allow
+		}
+	}
+	return allow
+}
+
+// rulesFor 取适用于该 UA 的规则：产品名最长匹配的分组(同名分组合并)，都不匹配用 * 分组
+func (r *Robots) rulesFor(ua string) []RobotsRule {
+	bestAgent := ""
+	for _, g := range r.Groups {
+		for _, a := range g.Agents {
+			if a != "*" && len(a) > len(bestAgent) && strings.Contains(ua, a) {
+				bestAgent = a
+			}
+		}
+	}
+	if bestAgent == "" {
+		bestAgent = "*"
+	}
+	var rules []RobotsRule
+	for _, g := range r.Groups {
+		for _, a := range g.Agents {
+			if a == bestAgent {
+				rules = append(rules, g.Rules...)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// robotsMatch 前缀匹配，* 匹配任意字符，结尾的 $ 表示必须匹配到路径末尾
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if anchored && i == len(parts)-1 {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		idx := strings.Index(path[pos:], parts[i])
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(parts[i])
+	}
+	return !anchored || pos == len(path)
+}
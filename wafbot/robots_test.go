@@ -0,0 +1,67 @@
+package wafbot
+
+import "testing"
+
+const testRobots = `# 示例
+User-agent: GPTBot
+User-agent: CCBot
+Disallow: /
+
+User-agent: Googlebot
+Disallow: /search
+Allow: /search/about
+Disallow: /*.pdf$
+
+User-agent: *
+Disallow: /admin/
+Disallow:
+`
+
+func TestRobotsAllowed(t *testing.T) {
+	r := ParseRobots(testRobots)
+	cases := []struct {
+		ua, path string
+		want     bool
+	}{
+		{"Mozilla/5.0 AppleWebKit/537.36 (compatible; GPTBot/1.2)", "/index.html", false},
+		{"CCBot/2.0 (https://commoncrawl.org/faq/)", "/", false},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/search?q=1", false},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/search/about", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/files/a.pdf", false},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/files/a.pdf?x=1", true},
+		// Googlebot 有自己的分组，不受 * 分组限制
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/admin/", true},
+		{"Mozilla/5.0 (compatible; bingbot/2.0)", "/admin/login", false},
+		{"Mozilla/5.0 (compatible; bingbot/2.0)", "/", true},
+	}
+	for _, c := range cases {
+		if got := r.Allowed(c.ua, c.path); got != c.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", c.ua, c.path, got, c.want)
+		}
+	}
+	var empty *Robots
+	if !empty.Allowed("GPTBot", "/") {
+		t.Fatalf("没有 robots.txt 时应全部允许")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/a", "/abc", true},
+		{"/a$", "/abc", false},
+		{"/a$", "/a", true},
+		{"/*/b", "/x/y/b/c", true},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php5", false},
+		{"/p*$", "/p", true},
+		{"/x", "/", false},
+	}
+	for _, c := range cases {
+		if got := robotsMatch(c.pattern, c.path); got != c.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
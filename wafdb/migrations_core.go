@@ -1940,6 +1940,493 @@ func RunCoreDBMigrations(db *gorm.DB) error {
 				return tx.Migrator().DropTable(&model.UpgradeNoticeRecord{})
 			},
 		},
+		// 迁移: 隧道多目标负载均衡与健康检测
+		{
+			ID: "202610180004_add_tunnel_load_balance",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180004: 创建隧道负载目标表并为隧道增加负载/健康检测字段")
+				if err := tx.AutoMigrate(&model.TunnelLoadBalance{}); err != nil {
+					return fmt.Errorf("创建隧道负载目标表失败: %w", err)
+				}
+				if err := safeCreateIndex(tx, "tunnel_load_balance", "idx_tunnel_lb_code",
+					"CREATE INDEX IF NOT EXISTS idx_tunnel_lb_code ON tunnel_load_balance(tunnel_code)"); err != nil {
+					zlog.Warn("创建索引 idx_tunnel_lb_code 失败", "error", err.Error())
+				}
+				// 存量隧道新增列默认 0 / 空，即不启用负载，行为与升级前一致
+				for _, c := range []struct{ column, field string }{
+					{"is_enable_load_balance", "IsEnableLoadBalance"},
+					{"load_balance_stage", "LoadBalanceStage"},
+					{"healthy_json", "HealthyJSON"},
+				} {
+					if tx.Migrator().HasColumn(&model.Tunnel{}, c.column) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(&model.Tunnel{}, c.field); err != nil {
+						return fmt.Errorf("隧道表新增字段 %s 失败: %w", c.column, err)
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180004: 删除隧道负载目标表及新增字段")
+				for _, c := range []string{"is_enable_load_balance", "load_balance_stage", "healthy_json"} {
+					if tx.Migrator().HasColumn(&model.Tunnel{}, c) {
+						if err := tx.Migrator().DropColumn(&model.Tunnel{}, c); err != nil {
+							return err
+						}
+					}
+				}
+				return tx.Migrator().DropTable(&model.TunnelLoadBalance{})
+			},
+		},
+		// 迁移: IP/URL 黑白名单与 IP 组条目支持到期时间（临时封禁到期自动失效）
+		{
+			ID: "202610180005_add_list_entry_expire_time",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180005: 为 IP/URL 名单与 IP 组条目添加 expire_time 字段")
+				targets := []struct {
+					model interface{}
+					name  string
+					table string
+				}{
+					{&model.IPBlockList{}, "IP黑名单", "ip_block_lists"},
+					{&model.IPAllowList{}, "IP白名单", "ip_allow_lists"},
+					{&model.URLBlockList{}, "URL黑名单", "url_block_lists"},
+					{&model.IPGroupItem{}, "IP组条目", "ip_group_item"},
+				}
+				for _, t := range targets {
+					if !tx.Migrator().HasColumn(t.model, "expire_time") {
+						// 存量行默认 0 = 永久，行为与升级前一致
+						if err := tx.Migrator().AddColumn(t.model, "ExpireTime"); err != nil {
+							return fmt.Errorf("添加 %s.expire_time 字段失败: %w", t.name, err)
+						}
+					}
+					// 清理任务按 expire_time > 0 扫描，绝大多数行是 0，索引能把扫描压到只看临时条目
+					idx := "idx_" + t.table + "_expire_time"
+					if err := safeCreateIndex(tx, t.table, idx,
+						"CREATE INDEX IF NOT EXISTS "+idx+" ON "+t.table+" (expire_time)"); err != nil {
+						zlog.Warn("创建索引 "+idx+" 失败", "error", err.Error())
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180005: 删除名单 expire_time 字段")
+				for _, m := range []interface{}{&model.IPBlockList{}, &model.IPAllowList{}, &model.URLBlockList{}, &model.IPGroupItem{}} {
+					if tx.Migrator().HasColumn(m, "expire_time") {
+						if err := tx.Migrator().DropColumn(m, "ExpireTime"); err != nil {
+							zlog.Warn("删除字段失败", "error", err.Error())
+						}
+					}
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 blocking_page 表添加 content_type 字段（按 Accept/Content-Type 协商的响应格式）
+		//
+		// 背景：移动端/XHR/gRPC 客户端拿到 HTML 拦截页无法解析，需要按格式分别配置拦截内容。
+		// 空值等同 html，老数据无需回填。
+		{
+			ID: "202610180007_add_blocking_page_content_type",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180007: 为 blocking_page 表添加 content_type 字段")
+				if tx.Migrator().HasColumn(&model.BlockingPage{}, "content_type") {
+					zlog.Info("content_type 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.BlockingPage{}, "content_type"); err != nil {
+					return fmt.Errorf("添加 content_type 字段失败: %w", err)
+				}
+				zlog.Info("content_type 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180007: 删除 blocking_page 表的 content_type 字段")
+				if tx.Migrator().HasColumn(&model.BlockingPage{}, "content_type") {
+					return tx.Migrator().DropColumn(&model.BlockingPage{}, "content_type")
+				}
+				return nil
+			},
+		},
+		// 迁移: 创建内置检测误报排除表（按网站+路径+参数+检测项排除，其余参数照常检测）
+		{
+			ID: "202610180009_add_detect_exclusion_table",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180009: 创建内置检测误报排除表")
+				if err := tx.AutoMigrate(&model.DetectExclusion{}); err != nil {
+					return fmt.Errorf("创建 detect_exclusion 表失败: %w", err)
+				}
+				if err := safeCreateIndex(tx, "detect_exclusions", "idx_detect_exclusion_host",
+					"CREATE INDEX IF NOT EXISTS idx_detect_exclusion_host ON detect_exclusions(host_code)"); err != nil {
+					zlog.Warn("创建索引 idx_detect_exclusion_host 失败", "error", err.Error())
+				}
+				zlog.Info("内置检测误报排除表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180009: 删除内置检测误报排除表")
+				return tx.Migrator().DropTable(&model.DetectExclusion{})
+			},
+		},
+		// 迁移: 创建接口规范表（OpenAPI 3 正向安全模型）
+		{
+			ID: "202610180010_add_api_spec_table",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180010: 创建接口规范表")
+				if err := tx.AutoMigrate(&model.ApiSpec{}); err != nil {
+					return fmt.Errorf("创建 api_spec 表失败: %w", err)
+				}
+				if err := safeCreateIndex(tx, "api_specs", "idx_api_spec_host",
+					"CREATE INDEX IF NOT EXISTS idx_api_spec_host ON api_specs(host_code)"); err != nil {
+					zlog.Warn("创建索引 idx_api_spec_host 失败", "error", err.Error())
+				}
+				zlog.Info("接口规范表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180010: 删除接口规范表")
+				return tx.Migrator().DropTable(&model.ApiSpec{})
+			},
+		},
+		// 迁移: 缓存规则增加源站指令处理选项（忽略源站缓存指令、带 Set-Cookie 的响应是否缓存）
+		{
+			ID: "202610180012_add_cache_rule_origin_options",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180012: 为 cache_rules 表添加 override_origin、cache_set_cookie 字段")
+				for _, field := range []string{"OverrideOrigin", "CacheSetCookie"} {
+					if tx.Migrator().HasColumn(&model.CacheRule{}, field) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(&model.CacheRule{}, field); err != nil {
+						return fmt.Errorf("添加 %s 字段失败: %w", field, err)
+					}
+				}
+				zlog.Info("缓存规则源站指令选项字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180012: 删除 cache_rules 表的 override_origin、cache_set_cookie 字段")
+				for _, field := range []string{"OverrideOrigin", "CacheSetCookie"} {
+					if tx.Migrator().HasColumn(&model.CacheRule{}, field) {
+						if err := tx.Migrator().DropColumn(&model.CacheRule{}, field); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		},
+		// 迁移: 缓存规则增加过期宽限期（stale-while-revalidate、stale-if-error）
+		{
+			ID: "202610180013_add_cache_rule_stale_windows",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180013: 为 cache_rules 表添加 stale_while_revalidate、stale_if_error 字段")
+				for _, field := range []string{"StaleWhileRevalidate", "StaleIfError"} {
+					if tx.Migrator().HasColumn(&model.CacheRule{}, field) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(&model.CacheRule{}, field); err != nil {
+						return fmt.Errorf("添加 %s 字段失败: %w", field, err)
+					}
+				}
+				zlog.Info("缓存规则过期宽限期字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180013: 删除 cache_rules 表的 stale_while_revalidate、stale_if_error 字段")
+				for _, field := range []string{"StaleWhileRevalidate", "StaleIfError"} {
+					if tx.Migrator().HasColumn(&model.CacheRule{}, field) {
+						if err := tx.Migrator().DropColumn(&model.CacheRule{}, field); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		},
+		// 迁移: CC 防护增加超限动作（封禁 / 浏览器挑战）
+		{
+			ID: "202610180014_add_anticc_action",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180014: 为 anti_ccs 表添加 action 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "action") {
+					zlog.Info("action 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.AntiCC{}, "action"); err != nil {
+					return fmt.Errorf("添加 action 字段失败: %w", err)
+				}
+				zlog.Info("CC 超限动作字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180014: 删除 anti_ccs 表的 action 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "action") {
+					return tx.Migrator().DropColumn(&model.AntiCC{}, "action")
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 anti_ccs 表添加逐级处置配置(空=关闭，沿用超限动作)
+		{
+			ID: "202610180015_add_anticc_escalation",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180015: 为 anti_ccs 表添加 escalation 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "escalation") {
+					zlog.Info("escalation 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.AntiCC{}, "escalation"); err != nil {
+					return fmt.Errorf("添加 escalation 字段失败: %w", err)
+				}
+				zlog.Info("CC 逐级处置字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180015: 删除 anti_ccs 表的 escalation 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "escalation") {
+					return tx.Migrator().DropColumn(&model.AntiCC{}, "escalation")
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 anti_ccs 表添加限流键(空=按IP限流，与旧版一致)
+		{
+			ID: "202610180016_add_anticc_limit_key",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180016: 为 anti_ccs 表添加 limit_key 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "limit_key") {
+					zlog.Info("limit_key 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.AntiCC{}, "limit_key"); err != nil {
+					return fmt.Errorf("添加 limit_key 字段失败: %w", err)
+				}
+				// 旧记录都是按IP限流，统一成空串，避免 NULL 在 <> '' 的比较里被漏掉或误判
+				if err := tx.Exec("UPDATE anti_ccs SET limit_key = '' WHERE limit_key IS NULL").Error; err != nil {
+					zlog.Warn("设置 limit_key 默认值失败", "error", err.Error())
+				}
+				zlog.Info("CC 限流键字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180016: 删除 anti_ccs 表的 limit_key 字段")
+				if tx.Migrator().HasColumn(&model.AntiCC{}, "limit_key") {
+					return tx.Migrator().DropColumn(&model.AntiCC{}, "limit_key")
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 hosts 表添加登录接口防撞库配置(空=关闭)
+		{
+			ID: "202610180017_add_hosts_login_protect_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180017: 为 hosts 表添加 login_protect_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "login_protect_json") {
+					zlog.Info("login_protect_json 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.Hosts{}, "login_protect_json"); err != nil {
+					return fmt.Errorf("添加 login_protect_json 字段失败: %w", err)
+				}
+				zlog.Info("login_protect_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180017: 删除 hosts 表的 login_protect_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "login_protect_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "login_protect_json")
+				}
+				return nil
+			},
+		},
+		// 迁移: 网站增加爬虫策略配置（按爬虫类别放行/拦截/限速）
+		{
+			ID: "202610180018_add_hosts_spider_policy_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180018: 为 hosts 表添加 spider_policy_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "spider_policy_json") {
+					zlog.Info("spider_policy_json 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.Hosts{}, "spider_policy_json"); err != nil {
+					return fmt.Errorf("添加 spider_policy_json 字段失败: %w", err)
+				}
+				zlog.Info("spider_policy_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180018: 删除 hosts 表的 spider_policy_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "spider_policy_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "spider_policy_json")
+				}
+				return nil
+			},
+		},
+		// 迁移: 创建爬虫库表（内置定义启动时从 data/spiderbot/registry.json 同步）
+		{
+			ID: "202610180019_add_spider_bot_table",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180019: 创建爬虫库表")
+				if err := tx.AutoMigrate(&model.SpiderBot{}); err != nil {
+					return fmt.Errorf("创建 spider_bot 表失败: %w", err)
+				}
+				zlog.Info("爬虫库表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180019: 删除爬虫库表")
+				return tx.Migrator().DropTable(&model.SpiderBot{})
+			},
+		},
+		// 迁移: 为 ldp_urls 表添加 mask_json 字段（字段级脱敏策略）
+		{
+			ID: "202610180021_add_ldp_url_mask_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180021: 为 ldp_urls 表添加 mask_json 字段")
+				if tx.Migrator().HasColumn(&model.LDPUrl{}, "mask_json") {
+					zlog.Info("mask_json 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.LDPUrl{}, "mask_json"); err != nil {
+					return fmt.Errorf("添加 mask_json 字段失败: %w", err)
+				}
+				zlog.Info("mask_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180021: 删除 ldp_urls 表的 mask_json 字段")
+				if tx.Migrator().HasColumn(&model.LDPUrl{}, "mask_json") {
+					return tx.Migrator().DropColumn(&model.LDPUrl{}, "mask_json")
+				}
+				return nil
+			},
+		},
+		// 迁移: 创建 YARA 规则集表（上传文件/请求体检测）
+		{
+			ID: "202610180024_add_yara_rule_set_table",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180024: 创建 YARA 规则集表")
+				if err := tx.AutoMigrate(&model.YaraRuleSet{}); err != nil {
+					return fmt.Errorf("创建 yara_rule_set 表失败: %w", err)
+				}
+				zlog.Info("YARA 规则集表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180024: 删除 YARA 规则集表")
+				return tx.Migrator().DropTable(&model.YaraRuleSet{})
+			},
+		},
+		// 迁移: 网站增加 WebSocket 消息检测配置（帧大小/消息频率/内容检测）
+		{
+			ID: "202610180025_add_hosts_websocket_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180025: 为 hosts 表添加 websocket_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "websocket_json") {
+					zlog.Info("websocket_json 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&model.Hosts{}, "websocket_json"); err != nil {
+					return fmt.Errorf("添加 websocket_json 字段失败: %w", err)
+				}
+				zlog.Info("websocket_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180025: 删除 hosts 表的 websocket_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "websocket_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "websocket_json")
+				}
+				return nil
+			},
+		},
+		// 迁移: 网站增加 gRPC 检测配置，新增 gRPC 描述文件表
+		{
+			ID: "202610180027_add_hosts_grpc_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180027: 为 hosts 表添加 grpc_json 字段，创建 gRPC 描述文件表")
+				if !tx.Migrator().HasColumn(&model.Hosts{}, "grpc_json") {
+					if err := tx.Migrator().AddColumn(&model.Hosts{}, "grpc_json"); err != nil {
+						return fmt.Errorf("添加 grpc_json 字段失败: %w", err)
+					}
+				}
+				if err := tx.AutoMigrate(&model.GrpcDescriptorSet{}); err != nil {
+					return fmt.Errorf("创建 grpc_descriptor_set 表失败: %w", err)
+				}
+				zlog.Info("grpc_json 字段、gRPC 描述文件表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180027: 删除 hosts 表的 grpc_json 字段和 gRPC 描述文件表")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "grpc_json") {
+					if err := tx.Migrator().DropColumn(&model.Hosts{}, "grpc_json"); err != nil {
+						return err
+					}
+				}
+				return tx.Migrator().DropTable(&model.GrpcDescriptorSet{})
+			},
+		},
+		{
+			ID: "202610180029_add_hosts_graphql_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180029: 为 hosts 表添加 graphql_json 字段")
+				if !tx.Migrator().HasColumn(&model.Hosts{}, "graphql_json") {
+					if err := tx.Migrator().AddColumn(&model.Hosts{}, "graphql_json"); err != nil {
+						return fmt.Errorf("添加 graphql_json 字段失败: %w", err)
+					}
+				}
+				zlog.Info("graphql_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180029: 删除 hosts 表的 graphql_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "graphql_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "graphql_json")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180031_add_hosts_protocol_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180031: 为 hosts 表添加 protocol_json 字段")
+				if !tx.Migrator().HasColumn(&model.Hosts{}, "protocol_json") {
+					if err := tx.Migrator().AddColumn(&model.Hosts{}, "protocol_json"); err != nil {
+						return fmt.Errorf("添加 protocol_json 字段失败: %w", err)
+					}
+				}
+				zlog.Info("protocol_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180031: 删除 hosts 表的 protocol_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "protocol_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "protocol_json")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180032_add_hosts_ssrf_json",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180032: 为 hosts 表添加 ssrf_json 字段")
+				if !tx.Migrator().HasColumn(&model.Hosts{}, "ssrf_json") {
+					if err := tx.Migrator().AddColumn(&model.Hosts{}, "ssrf_json"); err != nil {
+						return fmt.Errorf("添加 ssrf_json 字段失败: %w", err)
+					}
+				}
+				zlog.Info("ssrf_json 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180032: 删除 hosts 表的 ssrf_json 字段")
+				if tx.Migrator().HasColumn(&model.Hosts{}, "ssrf_json") {
+					return tx.Migrator().DropColumn(&model.Hosts{}, "ssrf_json")
+				}
+				return nil
+			},
+		},
 	})
 
 	// 执行迁移
@@ -415,6 +415,243 @@ func RunLogDBMigrations(db *gorm.DB) error {
 				return nil
 			},
 		},
+		// 迁移: 创建隧道连接审计日志表（谁连了、连了多久、进出多少字节、为什么断开）
+		{
+			ID: "202610180002_add_tunnel_conn_log_table",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180002: 创建隧道连接审计日志表")
+				if err := tx.AutoMigrate(&model.TunnelConnLog{}); err != nil {
+					return fmt.Errorf("创建隧道连接审计日志表失败: %w", err)
+				}
+				// (tunnel_code, start_time)：按隧道分页 + 时间范围
+				if err := safeCreateIndex(tx, "tunnel_conn_log", "idx_tcl_tunnel_time",
+					"CREATE INDEX IF NOT EXISTS idx_tcl_tunnel_time ON tunnel_conn_log(tunnel_code, start_time)"); err != nil {
+					zlog.Warn("创建索引 idx_tcl_tunnel_time 失败", "error", err.Error())
+				}
+				// (client_ip, start_time)：单IP连接历史下钻
+				if err := safeCreateIndex(tx, "tunnel_conn_log", "idx_tcl_ip_time",
+					"CREATE INDEX IF NOT EXISTS idx_tcl_ip_time ON tunnel_conn_log(client_ip, start_time)"); err != nil {
+					zlog.Warn("创建索引 idx_tcl_ip_time 失败", "error", err.Error())
+				}
+				zlog.Info("隧道连接审计日志表创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180002: 删除隧道连接审计日志表")
+				return tx.Migrator().DropTable(&model.TunnelConnLog{})
+			},
+		},
+		// 迁移: 为 web_logs 表添加 match_arg 字段（内置检测命中的请求参数，如 json:user.name）
+		{
+			ID: "202610180008_add_web_logs_match_arg",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180008: 为 web_logs 表添加 match_arg 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "match_arg") {
+					zlog.Info("match_arg 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "MATCH_ARG"); err != nil {
+					return fmt.Errorf("添加 match_arg 字段失败: %w", err)
+				}
+				zlog.Info("match_arg 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180008: 删除 web_logs 表的 match_arg 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "match_arg") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "MATCH_ARG")
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 web_logs 表添加 spec_violation 字段（不符合接口规范的明细）
+		{
+			ID: "202610180011_add_web_logs_spec_violation",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180011: 为 web_logs 表添加 spec_violation 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "spec_violation") {
+					zlog.Info("spec_violation 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "SPEC_VIOLATION"); err != nil {
+					return fmt.Errorf("添加 spec_violation 字段失败: %w", err)
+				}
+				zlog.Info("spec_violation 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180011: 删除 web_logs 表的 spec_violation 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "spec_violation") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "SPEC_VIOLATION")
+				}
+				return nil
+			},
+		},
+		// 迁移: 为 web_logs 表添加 mask_hits 字段（隐私保护字段级脱敏命中明细）
+		{
+			ID: "202610180020_add_web_logs_mask_hits",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180020: 为 web_logs 表添加 mask_hits 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "mask_hits") {
+					zlog.Info("mask_hits 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "MASK_HITS"); err != nil {
+					return fmt.Errorf("添加 mask_hits 字段失败: %w", err)
+				}
+				zlog.Info("mask_hits 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180020: 删除 web_logs 表的 mask_hits 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "mask_hits") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "MASK_HITS")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180022_add_web_logs_upload_quarantine",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180022: 为 web_logs 表添加 upload_quarantine 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "upload_quarantine") {
+					zlog.Info("upload_quarantine 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "UPLOAD_QUARANTINE"); err != nil {
+					return fmt.Errorf("添加 upload_quarantine 字段失败: %w", err)
+				}
+				zlog.Info("upload_quarantine 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180022: 删除 web_logs 表的 upload_quarantine 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "upload_quarantine") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "UPLOAD_QUARANTINE")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180023_add_web_logs_yara_match",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180023: 为 web_logs 表添加 yara_match 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "yara_match") {
+					zlog.Info("yara_match 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "YARA_MATCH"); err != nil {
+					return fmt.Errorf("添加 yara_match 字段失败: %w", err)
+				}
+				zlog.Info("yara_match 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180023: 删除 web_logs 表的 yara_match 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "yara_match") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "YARA_MATCH")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180026_add_web_logs_ws_summary",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180026: 为 web_logs 表添加 ws_summary 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "ws_summary") {
+					zlog.Info("ws_summary 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "WS_SUMMARY"); err != nil {
+					return fmt.Errorf("添加 ws_summary 字段失败: %w", err)
+				}
+				zlog.Info("ws_summary 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180026: 删除 web_logs 表的 ws_summary 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "ws_summary") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "WS_SUMMARY")
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180028_add_web_logs_grpc_method",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180028: 为 web_logs 表添加 grpc_service/grpc_method 字段")
+				for _, col := range []string{"GRPC_SERVICE", "GRPC_METHOD"} {
+					if tx.Migrator().HasColumn(&innerbean.WebLog{}, col) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, col); err != nil {
+						return fmt.Errorf("添加 %s 字段失败: %w", col, err)
+					}
+				}
+				zlog.Info("grpc_service/grpc_method 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180028: 删除 web_logs 表的 grpc_service/grpc_method 字段")
+				for _, col := range []string{"GRPC_SERVICE", "GRPC_METHOD"} {
+					if tx.Migrator().HasColumn(&innerbean.WebLog{}, col) {
+						if err := tx.Migrator().DropColumn(&innerbean.WebLog{}, col); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180030_add_web_logs_graphql_operation",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180030: 为 web_logs 表添加 graphql_operation/graphql_cost 字段")
+				for _, col := range []string{"GRAPHQL_OPERATION", "GRAPHQL_COST"} {
+					if tx.Migrator().HasColumn(&innerbean.WebLog{}, col) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, col); err != nil {
+						return fmt.Errorf("添加 %s 字段失败: %w", col, err)
+					}
+				}
+				zlog.Info("graphql_operation/graphql_cost 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180030: 删除 web_logs 表的 graphql_operation/graphql_cost 字段")
+				for _, col := range []string{"GRAPHQL_OPERATION", "GRAPHQL_COST"} {
+					if tx.Migrator().HasColumn(&innerbean.WebLog{}, col) {
+						if err := tx.Migrator().DropColumn(&innerbean.WebLog{}, col); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202610180033_add_web_logs_grpc_skip",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180033: 为 web_logs 表添加 grpc_skip 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "grpc_skip") {
+					zlog.Info("grpc_skip 字段已存在，跳过添加")
+					return nil
+				}
+				if err := tx.Migrator().AddColumn(&innerbean.WebLog{}, "GRPC_SKIP"); err != nil {
+					return fmt.Errorf("添加 grpc_skip 字段失败: %w", err)
+				}
+				zlog.Info("grpc_skip 字段添加成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180033: 删除 web_logs 表的 grpc_skip 字段")
+				if tx.Migrator().HasColumn(&innerbean.WebLog{}, "grpc_skip") {
+					return tx.Migrator().DropColumn(&innerbean.WebLog{}, "GRPC_SKIP")
+				}
+				return nil
+			},
+		},
 	})
 
 	// 执行迁移
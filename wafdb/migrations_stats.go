@@ -235,6 +235,42 @@ func RunStatsDBMigrations(db *gorm.DB) error {
 				return nil
 			},
 		},
+		// 迁移6: 创建隧道流量统计表（天级+小时级）
+		{
+			ID: "202610180003_create_tunnel_stats_tables",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180003: 创建隧道流量统计表")
+				if err := tx.AutoMigrate(
+					&model.StatsTunnelDay{},
+					&model.StatsTunnelHour{},
+				); err != nil {
+					return fmt.Errorf("创建隧道统计表失败: %w", err)
+				}
+				tunnelIdxs := []struct{ name, table, sql string }{
+					{
+						"idx_stats_tunnel_days_lookup", "stats_tunnel_days",
+						"CREATE INDEX IF NOT EXISTS idx_stats_tunnel_days_lookup ON stats_tunnel_days (tunnel_code, day)",
+					},
+					{
+						"idx_stats_tunnel_hours_lookup", "stats_tunnel_hours",
+						"CREATE INDEX IF NOT EXISTS idx_stats_tunnel_hours_lookup ON stats_tunnel_hours (tunnel_code, hour_time)",
+					},
+				}
+				for _, idx := range tunnelIdxs {
+					if err := safeCreateIndex(tx, idx.table, idx.name, idx.sql); err != nil {
+						return fmt.Errorf("创建隧道统计索引失败: %w", err)
+					}
+				}
+				zlog.Info("迁移 202610180003: 完成")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180003: 删除隧道统计表")
+				_ = tx.Exec("DROP INDEX IF EXISTS idx_stats_tunnel_days_lookup").Error
+				_ = tx.Exec("DROP INDEX IF EXISTS idx_stats_tunnel_hours_lookup").Error
+				return tx.Migrator().DropTable(&model.StatsTunnelDay{}, &model.StatsTunnelHour{})
+			},
+		},
 	})
 
 	// 执行迁移
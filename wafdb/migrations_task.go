@@ -623,6 +623,81 @@ func RunTaskInitMigrations(db *gorm.DB) error {
 				return tx.Where("task_method = ?", enums.TASK_HOSTGUARD_CLEAN_EXPIRED).Delete(&model.Task{}).Error
 			},
 		},
+		// 迁移: 隧道流量统计落库任务（与站点流量落库同频，30 秒一次）
+		{
+			ID: "202610180001_add_tunnel_traffic_flush_task",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180001: 创建隧道流量落库任务")
+
+				var count int64
+				tx.Model(&model.Task{}).Where("task_method = ?", enums.TASK_TUNNEL_TRAFFIC_FLUSH).Count(&count)
+				if count > 0 {
+					zlog.Info("隧道流量落库任务已存在，跳过", "task_method", enums.TASK_TUNNEL_TRAFFIC_FLUSH)
+					return nil
+				}
+
+				task := model.Task{
+					BaseOrm: baseorm.BaseOrm{
+						Id:          uuid.GenUUID(),
+						USER_CODE:   global.GWAF_USER_CODE,
+						Tenant_ID:   global.GWAF_TENANT_ID,
+						CREATE_TIME: customtype.JsonTime(time.Now()),
+						UPDATE_TIME: customtype.JsonTime(time.Now()),
+					},
+					TaskName:   "每30秒把隧道流量统计落库",
+					TaskUnit:   enums.TASK_SECOND,
+					TaskValue:  30,
+					TaskAt:     "",
+					TaskMethod: enums.TASK_TUNNEL_TRAFFIC_FLUSH,
+				}
+				if err := tx.Create(&task).Error; err != nil {
+					return fmt.Errorf("创建隧道流量落库任务失败: %w", err)
+				}
+				zlog.Info("隧道流量落库任务创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180001: 删除隧道流量落库任务")
+				return tx.Where("task_method = ?", enums.TASK_TUNNEL_TRAFFIC_FLUSH).Delete(&model.Task{}).Error
+			},
+		},
+		{
+			ID: "202610180006_add_list_expire_sweep_task",
+			Migrate: func(tx *gorm.DB) error {
+				zlog.Info("迁移 202610180006: 创建临时名单到期清理任务")
+
+				var count int64
+				tx.Model(&model.Task{}).Where("task_method = ?", enums.TASK_LIST_EXPIRE_SWEEP).Count(&count)
+				if count > 0 {
+					zlog.Info("临时名单到期清理任务已存在，跳过", "task_method", enums.TASK_LIST_EXPIRE_SWEEP)
+					return nil
+				}
+
+				task := model.Task{
+					BaseOrm: baseorm.BaseOrm{
+						Id:          uuid.GenUUID(),
+						USER_CODE:   global.GWAF_USER_CODE,
+						Tenant_ID:   global.GWAF_TENANT_ID,
+						CREATE_TIME: customtype.JsonTime(time.Now()),
+						UPDATE_TIME: customtype.JsonTime(time.Now()),
+					},
+					TaskName:   "每分钟清理到期的临时黑白名单",
+					TaskUnit:   enums.TASK_MIN,
+					TaskValue:  1,
+					TaskAt:     "",
+					TaskMethod: enums.TASK_LIST_EXPIRE_SWEEP,
+				}
+				if err := tx.Create(&task).Error; err != nil {
+					return fmt.Errorf("创建临时名单到期清理任务失败: %w", err)
+				}
+				zlog.Info("临时名单到期清理任务创建成功")
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				zlog.Info("回滚 202610180006: 删除临时名单到期清理任务")
+				return tx.Where("task_method = ?", enums.TASK_LIST_EXPIRE_SWEEP).Delete(&model.Task{}).Error
+			},
+		},
 	})
 
 	// 执行迁移
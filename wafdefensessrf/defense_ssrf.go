@@ -0,0 +1,253 @@
+package wafdefensessrf
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SSRF 检测：只看以地址开头的参数值(scheme:// 或 //)，文本里顺带提到的地址不算。
+// 命中条件：危险协议、云元数据地址、内网/回环地址、非常规写法的 IP(十进制/八进制/十六进制/省略段，
+// 常用来绕过按字符串匹配的内网黑名单)、把任意 IP 解析回来的通配 DNS 域名(DNS 重绑定常用)
+
+// 命中原因，拦截标题用
+const (
+	ReasonScheme     = "危险协议"
+	ReasonMetadata   = "云元数据地址"
+	ReasonInternal   = "内网地址"
+	ReasonObfuscated = "IP混淆写法"
+	ReasonRebinding  = "DNS重绑定域名"
+)
+
+// dangerousSchemes 服务端请求库常支持、能读本地文件或打内网任意 TCP 服务的协议
+var dangerousSchemes = map[string]bool{
+	"file": true, "gopher": true, "dict": true, "ldap": true, "ldaps": true,
+	"tftp": true, "netdoc": true, "jar": true, "sftp": true,
+}
+
+// webSchemes 需要进一步看主机的协议
+var webSchemes = map[string]bool{"http": true, "https": true, "ftp": true, "ws": true, "wss": true, "": true}
+
+// metadataHosts 各云厂商实例元数据服务
+var metadataHosts = map[string]bool{
+	"169.254.169.254":             true, // AWS / Azure / GCP / 华为云 / OpenStack
+	"100.100.100.200":             true, // 阿里云
+	"fd00:ec2::254":               true, // AWS IPv6
+	"metadata.google.internal":    true,
+	"metadata.goog":               true,
+	"metadata":                    true,
+	"instance-data":               true,
+	"instance-data.ec2.internal":  true,
+	"metadata.tencentyun.com":     true,
+	"metadata.azure.internal.net": true,
+}
+
+// rebindingSuffixes 把子域名里写的 IP 原样解析回来的通配 DNS 服务
+var rebindingSuffixes = []string{".nip.io", ".xip.io", ".sslip.io", ".localtest.me", ".lvh.me", ".rbndr.us", ".1u.ms", ".traefik.me"}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// DetermineSSRF 参数值是否指向不该由服务端访问的地址；allow 为放行的主机(域名、*.example.com、IP 或网段)
+func DetermineSSRF(value string, allow []string) (bool, string) {
+	v := strings.TrimSpace(value)
+	// 多编码了一层的地址(http%3A%2F%2F…)再解一次
+	if !strings.Contains(v, "://") && strings.Contains(strings.ToLower(v), "%3a") {
+		if dec, err := url.QueryUnescape(v); err == nil {
+			v = strings.TrimSpace(dec)
+		}
+	}
+	if !strings.Contains(v, "//") && !strings.Contains(v, `\\`) && !strings.Contains(v, ":") {
+		return false, ""
+	}
+	scheme, rest, ok := splitScheme(v)
+	if !ok {
+		return false, ""
+	}
+	if dangerousSchemes[scheme] {
+		return true, ReasonScheme + " " + scheme
+	}
+	if !webSchemes[scheme] {
+		return false, ""
+	}
+	host := extractHost(rest)
+	if host == "" || hostAllowed(host, allow) {
+		return false, ""
+	}
+	return classifyHost(host)
+}
+
+// splitScheme 拆出协议(小写)和 // 之后的部分；scheme 为空表示 //host 这种省略协议的写法。
+// file: 和 jar: 不带 // 也能用
+func splitScheme(v string) (scheme string, rest string, ok bool) {
+	if strings.HasPrefix(v, "//") || strings.HasPrefix(v, `\\`) {
+		return "", v[2:], true
+	}
+	i := strings.IndexByte(v, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	scheme = strings.ToLower(v[:i])
+	for j, c := range scheme {
+		if !(c >= 'a' && c <= 'z' || j > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return "", "", false
+		}
+	}
+	rest = v[i+1:]
+	if len(rest) >= 2 && (rest[0] == '/' || rest[0] == '\\') && (rest[1] == '/' || rest[1] == '\\') {
+		return scheme, rest[2:], true
+	}
+	if scheme == "file" || scheme == "jar" || scheme == "netdoc" {
+		return scheme, rest, true
+	}
+	return "", "", false
+}
+
+// extractHost 从 // 之后取主机：去掉路径、用户信息、端口、IPv6 方括号，小写并去掉末尾的点。
+// 反斜杠按浏览器的习惯当作路径分隔符；主机里的百分号编码(127.0.0.%31、%6c%6f%63%61%6c%68%6f%73%74)
+// 不少请求库会先解码再解析，这里同样解码后再判断
+func extractHost(authority string) string {
+	authority = trimAuthority(authority)
+	// 解码后可能又冒出路径分隔符或 @(127.0.0.1%2Fx、evil.com%40127.0.0.1)，再取一次
+	if strings.Contains(authority, "%") {
+		if dec, err := url.PathUnescape(authority); err == nil {
+			authority = trimAuthority(dec)
+		}
+	}
+	host := authority
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			host = host[1:i]
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 && strings.Contains(host, ":") {
+		host = host[:i] //IPv6 zone
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// trimAuthority 去掉路径和用户信息
+func trimAuthority(authority string) string {
+	if i := strings.IndexAny(authority, `/?#\`); i >= 0 {
+		authority = authority[:i]
+	}
+	if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+		authority = authority[i+1:]
+	}
+	return authority
+}
+
+func classifyHost(host string) (bool, string) {
+	if metadataHosts[host] {
+		return true, ReasonMetadata + " " + host
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return true, ReasonInternal + " " + host
+	}
+	for _, suffix := range rebindingSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true, ReasonRebinding + " " + host
+		}
+	}
+	ip, canonical := ParseIP(host)
+	if ip == nil {
+		return false, ""
+	}
+	if metadataHosts[ip.String()] {
+		return true, ReasonMetadata + " " + host
+	}
+	if !canonical {
+		return true, ReasonObfuscated + " " + host + "(" + ip.String() + ")"
+	}
+	if IsInternalIP(ip) {
+		return true, ReasonInternal + " " + host
+	}
+	return false, ""
+}
+
+// IsInternalIP 回环、私有、链路本地、未指定地址及运营商级 NAT 段
+func IsInternalIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || cgnat.Contains(ip)
+}
+
+// ParseIP 按 inet_aton 的宽松规则解析主机里的 IP：IPv4 可以是 1~4 段，每段可写成十进制、0 开头的八进制、
+// 0x 开头的十六进制，最后一段补满剩余字节(127.1、2130706433、0x7f000001 都是 127.0.0.1)。
+// canonical 为 false 表示不是常规的点分十进制写法；不是 IP 时返回 nil
+func ParseIP(host string) (ip net.IP, canonical bool) {
+	if strings.Contains(host, ":") {
+		if ip = net.ParseIP(host); ip != nil {
+			return ip, true
+		}
+		return nil, false
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil, false
+	}
+	canonical = len(parts) == 4
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		base := 10
+		digits := p
+		switch {
+		case len(p) > 2 && (p[:2] == "0x" || p[:2] == "0X"):
+			base, digits = 16, p[2:]
+		case len(p) > 1 && p[0] == '0':
+			base, digits = 8, p[1:]
+		}
+		if base != 10 {
+			canonical = false
+		}
+		n, err := strconv.ParseUint(digits, base, 32)
+		if err != nil || digits == "" {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	var addr uint64
+	for i, n := range nums {
+		if i < len(nums)-1 {
+			if n > 0xff {
+				return nil, false
+			}
+			addr |= n << (8 * uint(3-i))
+			continue
+		}
+		// 最后一段补满剩余字节
+		if n >= 1<<(8*uint(4-i)) {
+			return nil, false
+		}
+		addr |= n
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)), canonical
+}
+
+// hostAllowed 主机是否在放行列表里：精确域名、*.example.com、IP 或网段
+func hostAllowed(host string, allow []string) bool {
+	ip, _ := ParseIP(host)
+	for _, a := range allow {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch {
+		case a == "":
+		case strings.HasPrefix(a, "*."):
+			if host == a[2:] || strings.HasSuffix(host, a[1:]) {
+				return true
+			}
+		case strings.Contains(a, "/"):
+			if _, n, err := net.ParseCIDR(a); err == nil && ip != nil && n.Contains(ip) {
+				return true
+			}
+		default:
+			if host == a || (ip != nil && ip.Equal(net.ParseIP(a))) {
+				return true
+			}
+		}
+	}
+	return false
+}
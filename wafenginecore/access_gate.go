@@ -173,6 +173,7 @@ func (waf *WafEngine) DoAccessGate(w http.ResponseWriter, r *http.Request,
 	if tokenCookie != "" {
 		fingerprint := utils.GenerateFingerprint(r)
 		if st := accessSessionService.ValidateToken(tokenCookie, r.Host, clientIP, fingerprint, cfg); st != nil {
+			weblogbean.AccessUser = st.AccountName
 			if cfg.PassIdentityHeader {
 				// 顺序要紧：⓪ 已经删过客户端可能伪造的同名头，这里才是可信写入。
 				// 反过来先 Set 再 Del 等于把身份头的控制权交给客户端。
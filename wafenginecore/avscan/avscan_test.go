@@ -0,0 +1,187 @@
+package avscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// EICAR 标准杀毒测试串
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// serve 起一个 TCP 桩服务，每条连接交给 handle 处理，返回监听地址
+func serve(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// clamdStub 按 INSTREAM 协议收完数据，含 EICAR 报毒
+func clamdStub(t *testing.T) string {
+	return serve(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		cmd, err := br.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			return
+		}
+		var data []byte
+		var size [4]byte
+		for {
+			if _, err := io.ReadFull(br, size[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size[:])
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(br, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		if bytes.Contains(data, []byte(eicar)) {
+			conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+			return
+		}
+		conn.Write([]byte("stream: OK\x00"))
+	})
+}
+
+// icapStub 解析 REQMOD 的封装请求与分块 body，含 EICAR 返回 200 + X-Infection-Found
+func icapStub(t *testing.T) string {
+	return serve(t, func(conn net.Conn) {
+		tp := textproto.NewReader(bufio.NewReader(conn))
+		line, _ := tp.ReadLine()
+		if !strings.HasPrefix(line, "REQMOD icap://") {
+			conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		h, _ := tp.ReadMIMEHeader()
+		if h.Get("Encapsulated") == "" {
+			conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		// 封装的 HTTP 请求行与请求头
+		if reqLine, _ := tp.ReadLine(); !strings.HasPrefix(reqLine, "PUT /") {
+			return
+		}
+		if _, err := tp.ReadMIMEHeader(); err != nil {
+			return
+		}
+		var data []byte
+		for {
+			sizeLine, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			n, _ := strconv.ParseInt(sizeLine, 16, 64)
+			if n == 0 {
+				tp.ReadLine()
+				break
+			}
+			chunk := make([]byte, n+2)
+			if _, err := io.ReadFull(tp.R, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk[:n]...)
+		}
+		if bytes.Contains(data, []byte(eicar)) {
+			conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: null-body=0\r\n\r\n"))
+			return
+		}
+		conn.Write([]byte("ICAP/1.0 204 No Content\r\nEncapsulated: null-body=0\r\n\r\n"))
+	})
+}
+
+func scan(t *testing.T, engine, address string, data []byte) (Result, error) {
+	t.Helper()
+	s, err := New(engine, address)
+	if err != nil {
+		t.Fatalf("New(%s, %s): %v", engine, address, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.Scan(ctx, "测试 文件.bin", data)
+}
+
+func TestClamd(t *testing.T) {
+	addr := clamdStub(t)
+	res, err := scan(t, EngineClamd, addr, []byte("hello"))
+	if err != nil || res.Infected {
+		t.Fatalf("干净文件应通过: %+v %v", res, err)
+	}
+	// 超过单块大小，验证分块发送
+	big := append(bytes.Repeat([]byte("a"), clamdChunkSize*2+10), eicar...)
+	res, err = scan(t, EngineClamd, addr, big)
+	if err != nil || !res.Infected || res.Signature != "Eicar-Signature" {
+		t.Fatalf("EICAR 应报毒: %+v %v", res, err)
+	}
+}
+
+func TestICAP(t *testing.T) {
+	addr := "icap://" + icapStub(t) + "/avscan"
+	res, err := scan(t, EngineICAP, addr, []byte("hello"))
+	if err != nil || res.Infected {
+		t.Fatalf("干净文件应通过: %+v %v", res, err)
+	}
+	res, err = scan(t, EngineICAP, addr, []byte(eicar))
+	if err != nil || !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("EICAR 应报毒: %+v %v", res, err)
+	}
+	res, err = scan(t, EngineICAP, addr, nil)
+	if err != nil || res.Infected {
+		t.Fatalf("空文件应通过: %+v %v", res, err)
+	}
+}
+
+func TestTimeoutAndErrors(t *testing.T) {
+	// 收下连接但一直不应答
+	addr := serve(t, func(conn net.Conn) { time.Sleep(time.Second) })
+	s, _ := New(EngineClamd, addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.Scan(ctx, "a", []byte("x")); err == nil {
+		t.Fatal("无应答应超时报错")
+	}
+	if time.Since(start) > 800*time.Millisecond {
+		t.Fatal("超时未生效")
+	}
+
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("clamd ERROR 应报错")
+	}
+	for _, c := range []struct{ engine, addr string }{
+		{EngineClamd, ""}, {EngineICAP, "http://127.0.0.1:1344/x"}, {"sophos", "127.0.0.1:1"},
+	} {
+		if _, err := New(c.engine, c.addr); err == nil {
+			t.Errorf("New(%q, %q) 应报错", c.engine, c.addr)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 拦截响应按客户端协商格式：
+//   - 浏览器拿 HTML 拦截页（历史行为）；
+//   - 接口/XHR/移动端拿结构化 JSON（或 XML），App 的错误弹窗里不再出现整页 HTML；
+//   - gRPC 客户端拿 grpc-status/grpc-message（Trailers-Only 响应），HTTP 状态码固定 200，
+//     否则客户端只会报一个笼统的 "Unavailable/Unknown"。
+// 自定义拦截页面可按格式分别配置（BlockingPage.ContentType），没配的格式用内置的默认结构。
+
+// negotiateBlockFormat 根据请求头决定拦截响应的格式
+func negotiateBlockFormat(r *http.Request) string {
+	if r == nil {
+		return model.BlockingPageContentTypeHTML
+	}
+	if strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "application/grpc") {
+		return model.BlockingPageContentTypeGRPC
+	}
+	if f := formatFromAccept(r.Header.Get("Accept")); f != "" {
+		return f
+	}
+	// Accept 缺省或只有 */*：fetch/axios/OkHttp 之类的客户端大多如此，再看一眼请求本身
+	if strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest") {
+		return model.BlockingPageContentTypeJSON
+	}
+	reqType := strings.ToLower(r.Header.Get("Content-Type"))
+	if strings.Contains(reqType, "json") {
+		return model.BlockingPageContentTypeJSON
+	}
+	if strings.Contains(reqType, "xml") {
+		return model.BlockingPageContentTypeXML
+	}
+	return model.BlockingPageContentTypeHTML
+}
+
+// formatFromAccept 按 q 值挑出 Accept 中优先级最高的 html/json/xml，同分时 html 优先。
+// 只有 */* 或无法识别时返回空串。
+func formatFromAccept(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	best := ""
+	bestQ := 0.0
+	rank := map[string]int{
+		model.BlockingPageContentTypeHTML: 3,
+		model.BlockingPageContentTypeJSON: 2,
+		model.BlockingPageContentTypeXML:  1,
+	}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		var f string
+		switch {
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			f = model.BlockingPageContentTypeHTML
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			f = model.BlockingPageContentTypeJSON
+		case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+			f = model.BlockingPageContentTypeXML
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && rank[f] > rank[best]) {
+			best, bestQ = f, q
+		}
+	}
+	return best
+}
+
+// blockSupportCode 给用户报障用的短码：请求UUID去掉横线后的前8位大写，
+// 读电话、截图都方便，管理员在日志里按请求UUID前缀即可找到
+func blockSupportCode(reqUUID string) string {
+	code := strings.ToUpper(strings.ReplaceAll(reqUUID, "-", ""))
+	if len(code) > 8 {
+		code = code[:8]
+	}
+	return code
+}
+
+// findBlockingPage 按 网站攻击类型专属 → 网站403 → 全局攻击类型专属 → 全局403 的顺序查找指定格式的拦截页面。
+// gRPC 页面的 ResponseCode 填的是 grpc-status（如 "7@grpc"），没有 403 这个键，按格式找该站点的通用 gRPC 页面
+func findBlockingPage(hostsafe *wafenginmodel.HostSafe, globalHostSafe *wafenginmodel.HostSafe, attackType string, format string) (model.BlockingPage, bool) {
+	for _, hs := range []*wafenginmodel.HostSafe{hostsafe, globalHostSafe} {
+		if hs == nil {
+			continue
+		}
+		if attackType != "" {
+			for _, page := range hs.BlockingPage {
+				if page.AttackType == attackType && page.NormalizedContentType() == format {
+					return page, true
+				}
+			}
+		}
+		if page, ok := hs.BlockingPage[model.BlockingPageKey("403", format)]; ok {
+			return page, true
+		}
+		if format == model.BlockingPageContentTypeGRPC {
+			if page, ok := findGrpcBlockingPage(hs); ok {
+				return page, true
+			}
+		}
+	}
+	return model.BlockingPage{}, false
+}
+
+// findGrpcBlockingPage 站点的通用(不限攻击类型) gRPC 拦截页面；配了多条时取键最小的一条，保证每次结果一致
+func findGrpcBlockingPage(hs *wafenginmodel.HostSafe) (model.BlockingPage, bool) {
+	bestKey := ""
+	var best model.BlockingPage
+	for key, page := range hs.BlockingPage {
+		if page.AttackType != "" || page.NormalizedContentType() != model.BlockingPageContentTypeGRPC || key == "not_match_website" {
+			continue
+		}
+		if bestKey == "" || key < bestKey {
+			bestKey, best = key, page
+		}
+	}
+	return best, bestKey != ""
+}
+
+// blockResponse 协商后的拦截响应
+type blockResponse struct {
+	format      string
+	code        int         // HTTP 状态码；gRPC 固定 200
+	header      http.Header // 需要写入的响应头（含自定义页面配置的头）
+	body        []byte
+	grpcStatus  int
+	grpcMessage string
+}
+
+// logBody 记录到 weblog 的响应内容
+func (b *blockResponse) logBody() string {
+	if b.format == model.BlockingPageContentTypeGRPC {
+		return fmt.Sprintf("grpc-status: %d grpc-message: %s", b.grpcStatus, b.grpcMessage)
+	}
+	return string(b.body)
+}
+
+// blockJSONBody 默认的 JSON 拦截内容
+type blockJSONBody struct {
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	RequestId   string `json:"request_id"`
+	AttackType  string `json:"attack_type"`
+	SupportCode string `json:"support_code"`
+}
+
+// blockXMLBody 默认的 XML 拦截内容
+type blockXMLBody struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code"`
+	Message     string   `xml:"message"`
+	RequestId   string   `xml:"request_id"`
+	AttackType  string   `xml:"attack_type"`
+	SupportCode string   `xml:"support_code"`
+}
+
+// buildBlockResponse 按请求协商格式、查找拦截页面并渲染。defaultCode 为没有任何页面配置时的状态码。
+func buildBlockResponse(r *http.Request, weblogbean *innerbean.WebLog, blockInfo string, hostsafe *wafenginmodel.HostSafe, globalHostSafe *wafenginmodel.HostSafe, attackType string, defaultCode int) blockResponse {
+	format := negotiateBlockFormat(r)
+	res := blockResponse{format: format, code: defaultCode, header: http.Header{}}
+	supportCode := blockSupportCode(weblogbean.REQ_UUID)
+
+	renderData := map[string]interface{}{
+		"SAMWAF_REQ_UUID":     escapeBlockValue(format, weblogbean.REQ_UUID),
+		"SAMWAF_BLOCK_INFO":   escapeBlockValue(format, blockInfo),
+		"SAMWAF_ATTACK_TYPE":  escapeBlockValue(format, attackType),
+		"SAMWAF_SUPPORT_CODE": supportCode,
+	}
+
+	page, ok := findBlockingPage(hostsafe, globalHostSafe, attackType, format)
+	if ok {
+		var headers []map[string]string
+		if err := json.Unmarshal([]byte(page.ResponseHeader), &headers); err == nil {
+			for _, header := range headers {
+				if name, ok := header["name"]; ok {
+					if value, ok := header["value"]; ok && value != "" {
+						res.header.Set(name, value)
+					}
+				}
+			}
+		}
+		if code, err := strconv.Atoi(page.ResponseCode); err == nil {
+			res.code = code
+		}
+	} else if format != model.BlockingPageContentTypeHTML {
+		// 该格式没有专门配置时沿用 HTML 页面配置的状态码（例如 451），内容用默认结构
+		if htmlPage, found := findBlockingPage(hostsafe, globalHostSafe, attackType, model.BlockingPageContentTypeHTML); found {
+			if code, err := strconv.Atoi(htmlPage.ResponseCode); err == nil {
+				res.code = code
+			}
+		}
+	}
+
+	switch format {
+	case model.BlockingPageContentTypeGRPC:
+		res.grpcStatus = grpcStatusFromHTTP(res.code)
+		if attackType == "cc_attack" || attackType == "crawler_throttle" {
+			// 限流对 gRPC 客户端是 RESOURCE_EXHAUSTED，客户端据此退避重试
+			res.grpcStatus = 8
+		}
+		res.grpcMessage = blockInfo
+		if ok {
+			// gRPC 页面的 ResponseCode 就是 grpc-status
+			if code, err := strconv.Atoi(page.ResponseCode); err == nil && code >= 0 && code <= 16 {
+				res.grpcStatus = code
+			}
+			if rendered, err := renderTemplate(page.ResponseContent, renderData); err == nil && len(rendered) > 0 {
+				res.grpcMessage = string(rendered)
+			}
+		}
+		res.code = http.StatusOK
+		requestContentType := weblogbean.GrpcContentType
+		if requestContentType == "" {
+			requestContentType = r.Header.Get("Content-Type")
+		}
+		// gRPC-Web 客户端按 Content-Type 认响应，跨域时还要暴露 grpc-status 才读得到
+		res.header.Set("Content-Type", grpcResponseContentType(requestContentType))
+		setGrpcWebCORS(res.header, r.Header.Get("Origin"), hostsafe)
+		res.header.Set("Grpc-Status", strconv.Itoa(res.grpcStatus))
+		res.header.Set("Grpc-Message", grpcEncodeMessage(res.grpcMessage))
+		res.header.Set("Samwaf-Request-Id", weblogbean.REQ_UUID)
+		return res
+	case model.BlockingPageContentTypeJSON, model.BlockingPageContentTypeXML:
+		if ok {
+			res.body = renderBlockTemplate(page.ResponseContent, renderData)
+		} else if format == model.BlockingPageContentTypeJSON {
+			res.body, _ = json.Marshal(blockJSONBody{Code: res.code, Message: blockInfo, RequestId: weblogbean.REQ_UUID, AttackType: attackType, SupportCode: supportCode})
+		} else {
+			out, _ := xml.Marshal(blockXMLBody{Code: res.code, Message: blockInfo, RequestId: weblogbean.REQ_UUID, AttackType: attackType, SupportCode: supportCode})
+			res.body = append([]byte(xml.Header), out...)
+		}
+		if res.header.Get("Content-Type") == "" {
+			res.header.Set("Content-Type", "application/"+format+"; charset=utf-8")
+		}
+		return res
+	}
+
+	if ok {
+		res.body = renderBlockTemplate(page.ResponseContent, renderData)
+	} else {
+		res.body = renderBlockTemplate(global.GLOBAL_DEFAULT_BLOCK_INFO, renderData)
+	}
+	return res
+}
+
+// renderBlockTemplate 渲染失败时原样返回模板内容（与历史行为一致）
+func renderBlockTemplate(content string, data map[string]interface{}) []byte {
+	if rendered, err := renderTemplate(content, data); err == nil {
+		return rendered
+	}
+	return []byte(content)
+}
+
+// escapeBlockValue 模板是 text/template，不做转义：JSON/XML 模板里插入的值先按格式转义，
+// 拦截提示里带引号或尖括号时不至于把结构弄坏
+func escapeBlockValue(format string, v string) string {
+	switch format {
+	case model.BlockingPageContentTypeJSON:
+		b, _ := json.Marshal(v)
+		return string(b[1 : len(b)-1])
+	case model.BlockingPageContentTypeXML:
+		var sb strings.Builder
+		_ = xml.EscapeText(&sb, []byte(v))
+		return sb.String()
+	}
+	return v
+}
+
+// grpcStatusFromHTTP 把拦截状态码映射为 gRPC 状态码
+func grpcStatusFromHTTP(code int) int {
+	switch code {
+	case http.StatusUnauthorized:
+		return 16 // UNAUTHENTICATED
+	case http.StatusNotFound:
+		return 12 // UNIMPLEMENTED
+	case http.StatusTooManyRequests:
+		return 8 // RESOURCE_EXHAUSTED
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return 14 // UNAVAILABLE
+	}
+	return 7 // PERMISSION_DENIED
+}
+
+// grpcEncodeMessage grpc-message 按 gRPC 规范做百分号编码：可打印 ASCII 之外的字节以及 % 本身
+func grpcEncodeMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7E && c != '%' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
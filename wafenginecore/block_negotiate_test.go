@@ -0,0 +1,146 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateBlockFormat(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"浏览器", map[string]string{"Accept": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, model.BlockingPageContentTypeHTML},
+		{"接口", map[string]string{"Accept": "application/json"}, model.BlockingPageContentTypeJSON},
+		{"problem+json", map[string]string{"Accept": "application/problem+json, */*;q=0.1"}, model.BlockingPageContentTypeJSON},
+		{"q值优先", map[string]string{"Accept": "text/html;q=0.5, application/json"}, model.BlockingPageContentTypeJSON},
+		{"XML接口", map[string]string{"Accept": "application/xml"}, model.BlockingPageContentTypeXML},
+		{"XHR只带*/*", map[string]string{"Accept": "*/*", "X-Requested-With": "XMLHttpRequest"}, model.BlockingPageContentTypeJSON},
+		{"App提交JSON", map[string]string{"Content-Type": "application/json; charset=utf-8"}, model.BlockingPageContentTypeJSON},
+		{"gRPC", map[string]string{"Content-Type": "application/grpc+proto", "Accept": "text/html"}, model.BlockingPageContentTypeGRPC},
+		{"什么都没带", map[string]string{}, model.BlockingPageContentTypeHTML},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "http://a.com/api", nil)
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		if got := negotiateBlockFormat(r); got != c.want {
+			t.Errorf("%s: 期望 %s，实际 %s", c.name, c.want, got)
+		}
+	}
+}
+
+func newBlockTestHosts(pages ...model.BlockingPage) (*wafenginmodel.HostSafe, *wafenginmodel.HostSafe) {
+	m := map[string]model.BlockingPage{}
+	for _, p := range pages {
+		m[model.BlockingPageKey(p.ResponseCode, p.ContentType)] = p
+	}
+	return &wafenginmodel.HostSafe{BlockingPage: m}, &wafenginmodel.HostSafe{BlockingPage: map[string]model.BlockingPage{}}
+}
+
+// API 客户端没有专门配置时拿默认 JSON，状态码沿用该攻击类型 HTML 页面的配置
+func TestEchoErrorInfo_JSONDefault(t *testing.T) {
+	host, global := newBlockTestHosts(model.BlockingPage{BlockingType: "other_block", AttackType: "sqli", ResponseCode: "451", ResponseContent: "<html>[[.SAMWAF_BLOCK_INFO]]</html>"})
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/api", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	weblog := &innerbean.WebLog{REQ_UUID: "abcd-1234-ef56"}
+
+	code := EchoErrorInfo(w, r, weblog, "规则", `含"引号"的提示`, host, global, false, "sqli")
+	if code != 451 || w.Code != 451 {
+		t.Fatalf("应沿用 HTML 页面的 451，实际 %d", code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("Content-Type 不对: %s", w.Header().Get("Content-Type"))
+	}
+	var body blockJSONBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("不是合法 JSON: %v %s", err, w.Body.String())
+	}
+	if body.RequestId != "abcd-1234-ef56" || body.AttackType != "sqli" || body.SupportCode != "ABCD1234" || body.Message != `含"引号"的提示` {
+		t.Fatalf("JSON 内容不对: %+v", body)
+	}
+}
+
+// 按格式配置的模板：插入值按 JSON 转义
+func TestEchoErrorInfo_JSONTemplate(t *testing.T) {
+	host, global := newBlockTestHosts(
+		model.BlockingPage{BlockingType: "other_block", ResponseCode: "403", ResponseContent: "<html/>"},
+		model.BlockingPage{BlockingType: "other_block", ResponseCode: "403", ContentType: model.BlockingPageContentTypeJSON,
+			ResponseContent: `{"err":"[[.SAMWAF_BLOCK_INFO]]","id":"[[.SAMWAF_SUPPORT_CODE]]"}`},
+	)
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/api", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	EchoErrorInfo(w, r, &innerbean.WebLog{REQ_UUID: "1111"}, "规则", `a"b`, host, global, false, "")
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("模板渲染后不是合法 JSON: %v %s", err, w.Body.String())
+	}
+	if body["err"] != `a"b` || body["id"] != "1111" {
+		t.Fatalf("模板内容不对: %+v", body)
+	}
+}
+
+// 浏览器仍然拿 HTML 模板
+func TestEchoErrorInfo_HTMLUnchanged(t *testing.T) {
+	host, global := newBlockTestHosts(
+		model.BlockingPage{BlockingType: "other_block", ResponseCode: "403", ResponseContent: "<p>[[.SAMWAF_BLOCK_INFO]]</p>"},
+		model.BlockingPage{BlockingType: "other_block", ResponseCode: "403", ContentType: model.BlockingPageContentTypeJSON, ResponseContent: "{}"},
+	)
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	EchoErrorInfo(w, r, &innerbean.WebLog{}, "规则", "拦截", host, global, false, "")
+	if w.Code != 403 || w.Body.String() != "<p>拦截</p>" {
+		t.Fatalf("HTML 拦截页不对: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// gRPC 客户端拿 Trailers-Only 响应
+func TestEchoErrorInfo_GRPC(t *testing.T) {
+	host, global := newBlockTestHosts()
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/pkg.Svc/Call", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	code := EchoErrorInfo(w, r, &innerbean.WebLog{REQ_UUID: "u1"}, "规则", "拦截 100%", host, global, false, "")
+	if code != http.StatusOK {
+		t.Fatalf("gRPC 拦截 HTTP 状态码应为 200，实际 %d", code)
+	}
+	if w.Header().Get("Grpc-Status") != "7" {
+		t.Fatalf("grpc-status 应为 PERMISSION_DENIED(7)，实际 %s", w.Header().Get("Grpc-Status"))
+	}
+	if got := w.Header().Get("Grpc-Message"); got != "%E6%8B%A6%E6%88%AA 100%25" {
+		t.Fatalf("grpc-message 编码不对: %s", got)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("gRPC 拦截不应带响应体: %q", w.Body.String())
+	}
+}
+
+// gRPC 页面的 ResponseCode 是 grpc-status（键如 "7@grpc"），全局/网站的通用 gRPC 页面也要能找到
+func TestEchoErrorInfo_GRPCPageByContentType(t *testing.T) {
+	page := model.BlockingPage{BlockingType: "other_block", ResponseCode: "7", ContentType: model.BlockingPageContentTypeGRPC,
+		ResponseContent: "blocked [[.SAMWAF_SUPPORT_CODE]]"}
+	globalHost, _ := newBlockTestHosts(page)
+	host := &wafenginmodel.HostSafe{BlockingPage: map[string]model.BlockingPage{}}
+	if _, ok := globalHost.BlockingPage["7@grpc"]; !ok {
+		t.Fatalf("gRPC 页面的键应为 7@grpc: %v", globalHost.BlockingPage)
+	}
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/pkg.Svc/Call", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	EchoErrorInfo(w, r, &innerbean.WebLog{REQ_UUID: "abcd-1234-ef56"}, "规则", "拦截", host, globalHost, false, "sqli")
+	if w.Header().Get("Grpc-Status") != "7" || w.Header().Get("Grpc-Message") != "blocked ABCD1234" {
+		t.Fatalf("应使用全局的 gRPC 页面，实际 status=%s message=%s", w.Header().Get("Grpc-Status"), w.Header().Get("Grpc-Message"))
+	}
+}
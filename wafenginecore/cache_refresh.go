@@ -0,0 +1,74 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wafwebcache"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// refreshCacheInBackground 返回过期缓存(stale-while-revalidate)后，在后台回源刷新该缓存条目
+func (waf *WafEngine) refreshCacheInBackground(r *http.Request, host string, hostCode string, clientIP string, weblog *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	req, refreshLog, done := wafwebcache.RefreshRequest(r, weblog)
+	if req == nil {
+		return
+	}
+	go func() {
+		defer func() {
+			done()
+			wafwebcache.ReleaseFlight(refreshLog)
+			if e := recover(); e != nil && e != http.ErrAbortHandler {
+				zlog.Warn("缓存后台刷新 recover ", e)
+			}
+		}()
+		zlog.Debug("缓存后台刷新", zap.String("host", host), zap.String("url", req.RequestURI))
+		waf.forwardToBackend(&discardResponseWriter{header: http.Header{}}, req, host, hostCode, clientIP, refreshLog, hostTarget)
+	}()
+}
+
+// writeStaleResponse 回源失败时用旧的缓存内容应答(stale-if-error)
+func (waf *WafEngine) writeStaleResponse(w http.ResponseWriter, req *http.Request, staleResp *http.Response, weblog *innerbean.WebLog, proxyErr error) {
+	for k, v := range staleResp.Header {
+		for _, val := range v {
+			w.Header().Add(k, val)
+		}
+	}
+	w.WriteHeader(staleResp.StatusCode)
+	if staleResp.Body != nil {
+		if _, err := io.Copy(w, staleResp.Body); err != nil {
+			zlog.Debug("write fail:", zap.Any("err", err))
+		}
+		staleResp.Body.Close()
+	}
+
+	weblog.ResHeader = joinHeader(staleResp.Header)
+	weblog.ACTION = "放行"
+	weblog.STATUS = staleResp.Status
+	weblog.STATUS_CODE = staleResp.StatusCode
+	weblog.RES_BODY = fmt.Sprintf("回源失败，返回过期缓存 \r\nURL:%v \r\n 错误信息:%v \r\n", req.URL.String(), proxyErr)
+	weblog.TASK_FLAG = 1
+	if global.GQEQUE_LOG_DB != nil {
+		global.GQEQUE_LOG_DB.Enqueue(weblog)
+	}
+}
+
+// discardResponseWriter 后台刷新没有访客在等，响应只用于写缓存
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(int) {}
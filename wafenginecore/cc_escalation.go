@@ -0,0 +1,203 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/utils"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// CC 逐级处置的阶段
+const (
+	ccStageChallenge = "挑战"
+	ccStageSlow      = "减速"
+	ccStageBan       = "封禁"
+)
+
+// ccEscalationState 某IP在某条CC规则下的超限记录，存在缓存里，ResetMinutes 内没有新的超限就过期
+type ccEscalationState struct {
+	Strikes    int   `json:"strikes"`
+	LastStrike int64 `json:"last_strike"` //最近一次计数的时间(unix秒)
+}
+
+// ccEscalationMu 超限计数是读-改-写，串行化避免并发请求把同一次超限算成多次
+var ccEscalationMu sync.Mutex
+
+// ccEscalationKey 逐级处置记录的缓存键；subject 是被限流的对象(IP或限流键值)，scope 区分规则(网站码或按键限流规则ID)
+func ccEscalationKey(scope string, subject string) string {
+	return enums.CACHE_CCESCALATE_PRE + subject + "|" + scope
+}
+
+// ccEscalationStrike 记一次超限并返回累计次数。
+// 限流器一旦超限，后续请求会连续超限，距上次计数不足 StrikeSeconds 的只算同一次，counted 返回 false
+func ccEscalationStrike(key string, cfg model.CCEscalationConfig, now time.Time) (strikes int, counted bool) {
+	ccEscalationMu.Lock()
+	defer ccEscalationMu.Unlock()
+	var state ccEscalationState
+	_ = global.GCACHE_WAFCACHE.GetAs(key, &state)
+	if state.Strikes > 0 && now.Unix()-state.LastStrike < int64(cfg.StrikeSeconds) {
+		return state.Strikes, false
+	}
+	state.Strikes++
+	state.LastStrike = now.Unix()
+	global.GCACHE_WAFCACHE.SetWithTTl(key, state, time.Duration(cfg.ResetMinutes)*time.Minute)
+	return state.Strikes, true
+}
+
+// ccEscalationStage 按累计超限次数确定处置阶段
+func ccEscalationStage(cfg model.CCEscalationConfig, strikes int) string {
+	switch {
+	case strikes <= 0:
+		return ""
+	case strikes <= cfg.ChallengeTimes:
+		return ccStageChallenge
+	case strikes <= cfg.ChallengeTimes+cfg.SlowTimes:
+		return ccStageSlow
+	default:
+		return ccStageBan
+	}
+}
+
+// ccEscalate 逐级处置：第一次超限出挑战，反复超限减速，持续超限调用 ban 封禁
+func ccEscalate(result *detection.Result, weblog *innerbean.WebLog, clientIP string, subject string, scope string, cfg model.CCEscalationConfig, ban func()) {
+	strikes, counted := ccEscalationStrike(ccEscalationKey(scope, subject), cfg, time.Now())
+	stage := ccEscalationStage(cfg, strikes)
+	result.Title = fmt.Sprintf("%s(逐级处置:%s 第%d次超限)", result.Title, stage, strikes)
+	switch stage {
+	case ccStageChallenge:
+		result.IsChallenge = true
+		result.Content = "请先完成浏览器验证"
+	case ccStageSlow:
+		if cfg.SlowMode == model.CCSlowModeThrottle {
+			result.ThrottleKbps = cfg.ThrottleKbps
+		} else {
+			result.SlowDelay = time.Duration(cfg.TarpitMs) * time.Millisecond
+		}
+	default:
+		ban()
+	}
+	if counted && stage != ccEscalationStage(cfg, strikes-1) {
+		zlog.Info("CC逐级处置升级", zap.String("ip", clientIP), zap.String("host", weblog.HOST),
+			zap.String("stage", stage), zap.Int("strikes", strikes))
+		if global.GQEQUE_MESSAGE_DB != nil {
+			global.GQEQUE_MESSAGE_DB.Enqueue(innerbean.RuleMessageInfo{
+				BaseMessageInfo: innerbean.BaseMessageInfo{OperaType: "CC逐级处置升级", Server: global.GWAF_CUSTOM_SERVER_NAME},
+				Domain:          weblog.HOST,
+				RuleInfo:        result.Title,
+				Ip:              fmt.Sprintf("%s (%s)", clientIP, utils.GetCountry(clientIP)),
+			})
+		}
+	}
+}
+
+// clearCCEscalation 清掉某IP在所有网站下的逐级处置记录(手动解封时回到第一级)
+func clearCCEscalation(ip string) {
+	prefix := enums.CACHE_CCESCALATE_PRE + ip + "|"
+	for key := range global.GCACHE_WAFCACHE.ListAvailableKeysWithPrefix(prefix) {
+		if strings.HasPrefix(key, prefix) {
+			global.GCACHE_WAFCACHE.Remove(key)
+		}
+	}
+}
+
+// ccTarpit 延迟应答，访客提前断开返回 false
+func ccTarpit(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// throttledResponseWriter 按令牌桶限制响应写出速度
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func newThrottledResponseWriter(w http.ResponseWriter, ctx context.Context, kbps int) *throttledResponseWriter {
+	bytesPerSecond := kbps * 1024
+	return &throttledResponseWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		limiter:        rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond),
+	}
+}
+
+func (t *throttledResponseWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > t.limiter.Burst() {
+			n = t.limiter.Burst()
+		}
+		if err := t.limiter.WaitN(t.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := t.ResponseWriter.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (t *throttledResponseWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 找到底层 ResponseWriter（SetWriteDeadline 等）
+func (t *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// ReadFrom 逐块走限速的 Write，不能委托给底层，否则 sendfile 快路径会绕过限速
+func (t *throttledResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{t}, src)
+}
+
+func (t *throttledResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := t.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify 透传，说明同 countingResponseWriter.CloseNotify
+func (t *throttledResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := t.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool, 1)
+}
+
+// Hijack 透传：WebSocket 升级和 444 断连都靠它。劫持后的隧道不再限速
+func (t *throttledResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := t.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
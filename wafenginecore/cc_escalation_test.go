@@ -0,0 +1,139 @@
+package wafenginecore
+
+import (
+	"SamWaf/cache"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCCEscalationLadder(t *testing.T) {
+	global.GCACHE_WAFCACHE = cache.InitWafCache()
+	antiCC := model.AntiCC{
+		HostCode:      "ladder-host",
+		LockIPMinutes: 5,
+		Escalation:    `{"is_enable":1,"challenge_times":1,"slow_times":2,"slow_mode":"tarpit","tarpit_ms":1500,"strike_seconds":0}`,
+	}
+	weblog := &innerbean.WebLog{HOST: "ladder.example.com"}
+	const ip = "9.9.9.9"
+	over := func() detection.Result {
+		result := detection.Result{Title: "【局部】触发IP频次访问限制"}
+		ccOverLimit(&result, weblog, ip, antiCC)
+		return result
+	}
+
+	if r := over(); !r.IsChallenge || r.IsBlock {
+		t.Fatalf("第一次超限应出挑战: %+v", r)
+	}
+	for i := 0; i < 2; i++ {
+		if r := over(); r.SlowDelay != 1500*time.Millisecond || r.IsBlock || r.IsChallenge {
+			t.Fatalf("反复超限应减速: %+v", r)
+		}
+	}
+	if global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CCVISITBAN_PRE + ip) {
+		t.Fatalf("减速阶段不应封禁IP")
+	}
+	if r := over(); !r.IsBlock {
+		t.Fatalf("持续超限应封禁: %+v", r)
+	}
+	if !global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CCVISITBAN_PRE + ip) {
+		t.Fatalf("封禁阶段应写入CC封禁")
+	}
+
+	clearCCEscalation(ip)
+	if r := over(); !r.IsChallenge {
+		t.Fatalf("解封后应回到第一级: %+v", r)
+	}
+}
+
+func TestCCEscalationStrikeDebounce(t *testing.T) {
+	global.GCACHE_WAFCACHE = cache.InitWafCache()
+	cfg := model.ParseCCEscalationConfig(`{"is_enable":1,"strike_seconds":10}`)
+	key := ccEscalationKey("debounce-host", "8.8.8.8")
+	now := time.Now()
+	if n, counted := ccEscalationStrike(key, cfg, now); n != 1 || !counted {
+		t.Fatalf("首次超限应计数: %d %v", n, counted)
+	}
+	if n, counted := ccEscalationStrike(key, cfg, now.Add(3*time.Second)); n != 1 || counted {
+		t.Fatalf("间隔内的连续超限只算一次: %d %v", n, counted)
+	}
+	if n, counted := ccEscalationStrike(key, cfg, now.Add(11*time.Second)); n != 2 || !counted {
+		t.Fatalf("超过间隔应再计一次: %d %v", n, counted)
+	}
+}
+
+func TestCCEscalationDisabledKeepsAction(t *testing.T) {
+	global.GCACHE_WAFCACHE = cache.InitWafCache()
+	result := detection.Result{}
+	ccOverLimit(&result, &innerbean.WebLog{}, "7.7.7.7", model.AntiCC{Action: model.CCActionChallenge})
+	if !result.IsChallenge || result.IsBlock {
+		t.Fatalf("未开启逐级处置时应沿用超限动作: %+v", result)
+	}
+}
+
+func TestThrottledResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newThrottledResponseWriter(rec, context.Background(), 1)
+	body := make([]byte, 1024+512)
+	start := time.Now()
+	n, err := w.Write(body)
+	if err != nil || n != len(body) {
+		t.Fatalf("写出失败: %d %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("超出桶容量的部分应被限速, 实际耗时 %v", elapsed)
+	}
+	if rec.Body.Len() != len(body) {
+		t.Fatalf("内容不完整: %d", rec.Body.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = newThrottledResponseWriter(httptest.NewRecorder(), ctx, 1)
+	if _, err := w.Write(body); err == nil {
+		t.Fatalf("访客断开后应停止写出")
+	}
+}
+
+func TestThrottledResponseWriterHijack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var w http.ResponseWriter = newThrottledResponseWriter(rw, r.Context(), 1)
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("限速包装应实现 io.ReaderFrom")
+		}
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Errorf("限速包装应实现 http.Hijacker")
+			return
+		}
+		conn, brw, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("劫持失败: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("经过限速包装后协议升级应成功, 实际 %d", resp.StatusCode)
+	}
+}
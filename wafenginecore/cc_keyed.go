@@ -0,0 +1,229 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/utils"
+	"SamWaf/wafenginecore/grpcinspect"
+	"SamWaf/webplugin"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// newCCRateLimiter 按CC规则的模式创建计数器：window 为 Rate 秒内最多 Limit 次，否则按 Limit/Rate 的平均速率
+func newCCRateLimiter(antiCC model.AntiCC) *webplugin.IPRateLimiter {
+	var limiter *webplugin.IPRateLimiter
+	if antiCC.LimitMode == "window" {
+		limiter = webplugin.NewWindowIPRateLimiter(antiCC.Rate, antiCC.Limit)
+	} else {
+		ratePerSecond := rate.Limit(0)
+		if antiCC.Rate > 0 {
+			ratePerSecond = rate.Limit(float64(antiCC.Limit) / float64(antiCC.Rate))
+		}
+		limiter = webplugin.NewIPRateLimiter(ratePerSecond, antiCC.Limit)
+	}
+	if antiCC.IsEnableRule {
+		limiter.Rule = &utils.RuleHelper{}
+		limiter.Rule.InitRuleEngine()
+		limiter.Rule.LoadRuleString(antiCC.RuleContent)
+	}
+	return limiter
+}
+
+// BuildCCKeyedLimiters 把按键限流的CC规则编译成计数器，限流键非法的规则跳过并记录日志
+func BuildCCKeyedLimiters(list []model.AntiCC) []*wafenginmodel.CCKeyedLimiter {
+	var limiters []*wafenginmodel.CCKeyedLimiter
+	for _, antiCC := range list {
+		if antiCC.LimitKey == "" {
+			continue
+		}
+		parts, err := model.ParseCCLimitKey(antiCC.LimitKey)
+		if err != nil {
+			zlog.Warn("按键限流规则无效，已跳过", zap.String("id", antiCC.Id), zap.String("limit_key", antiCC.LimitKey), zap.Error(err))
+			continue
+		}
+		limiters = append(limiters, &wafenginmodel.CCKeyedLimiter{
+			AntiCC:  antiCC,
+			Key:     parts,
+			Limiter: newCCRateLimiter(antiCC),
+		})
+	}
+	return limiters
+}
+
+// ApplyAntiCCKeyed 热更新某网站的按键限流规则
+func (waf *WafEngine) ApplyAntiCCKeyed(hostCode string, list []model.AntiCC) {
+	limiters := BuildCCKeyedLimiters(list)
+	waf.UpdateHost(hostCode, func(hostSafe *wafenginmodel.HostSafe) {
+		hostSafe.CCKeyedLimiters = limiters
+	})
+	zlog.Debug("远程配置", zap.String("hostCode", hostCode), zap.Int("AnticcKeyed", len(limiters)))
+}
+
+// checkCCKeyed 依次检测按键限流规则，命中任一条返回 true
+func checkCCKeyed(result *detection.Result, r *http.Request, weblog *innerbean.WebLog, clientIP string, limiters []*wafenginmodel.CCKeyedLimiter, scope string) bool {
+	for _, keyed := range limiters {
+		if keyed.AntiCC.IsEnableRule && keyed.Limiter.Rule != nil && keyed.Limiter.Rule.KnowledgeBase != nil {
+			ruleMatchs, err := keyed.Limiter.Rule.Match("MF", weblog)
+			if err != nil || len(ruleMatchs) == 0 {
+				continue
+			}
+		}
+		key, ok := ccLimitKey(r, weblog, clientIP, keyed.Key)
+		if !ok {
+			continue
+		}
+		if global.GCACHE_WAFCACHE.IsKeyExist(ccKeyBanKey(keyed.AntiCC, key)) {
+			weblog.RISK_LEVEL = 1
+			result.IsBlock = true
+			result.Title = scope + "限流键已被封禁 " + key
+			result.Content = "当前访问由于频次太高暂时无法访问"
+			return true
+		}
+		if !keyed.Limiter.Allow(key) {
+			weblog.RISK_LEVEL = 1
+			result.Title = scope + "触发按键频次访问限制 " + key
+			antiCC := keyed.AntiCC
+			ccHandleOverLimit(result, weblog, clientIP, antiCC, key, antiCC.Id, func() {
+				result.IsBlock = true
+				result.Content = "您的访问被阻止超量了"
+				global.GCACHE_WAFCACHE.SetWithTTl(ccKeyBanKey(antiCC, key), antiCC.LockIPMinutes, time.Duration(antiCC.LockIPMinutes)*time.Minute)
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// ccKeyBanKey 按键限流封禁的缓存键：封的是键值(如 API 令牌)而不是IP，换代理IP也绕不过去
+func ccKeyBanKey(antiCC model.AntiCC, key string) string {
+	return enums.CACHE_CCKEYBAN_PRE + antiCC.Id + "|" + key
+}
+
+// ccLimitKey 拼出本次请求的限流键值；缺少任一部分(没带该请求头、路径不匹配模板、不是 gRPC 调用等)时本规则不参与。
+// 请求头/Cookie/参数/JWT 的原值可能是令牌，只取摘要，避免明文出现在缓存键和日志里
+func ccLimitKey(r *http.Request, weblog *innerbean.WebLog, clientIP string, parts []model.CCKeyPart) (string, bool) {
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		var value string
+		switch part.Kind {
+		case model.CCKeyIP:
+			value = clientIP
+		case model.CCKeyPath:
+			if part.Name == "" {
+				value = r.URL.Path
+			} else if matchCCPathTemplate(part.Name, r.URL.Path) {
+				value = part.Name
+			}
+		case model.CCKeyHeader:
+			value = ccKeyDigest(r.Header.Get(part.Name))
+		case model.CCKeyCookie:
+			if cookie, err := r.Cookie(part.Name); err == nil {
+				value = ccKeyDigest(cookie.Value)
+			}
+		case model.CCKeyQuery:
+			value = ccKeyDigest(r.URL.Query().Get(part.Name))
+		case model.CCKeyJwt:
+			value = ccKeyDigest(bearerJwtClaim(r, part.Name))
+		case model.CCKeyGrpc:
+			if grpcinspect.KindOf(r.Header.Get("Content-Type")) == grpcinspect.None {
+				break
+			}
+			if service, method, ok := grpcinspect.SplitMethod(r.URL.Path); ok {
+				if part.Name == "" {
+					value = service + "/" + method
+				} else if grpcinspect.MatchMethod(part.Name, service, method) {
+					value = part.Name
+				}
+			}
+		case model.CCKeyGraphQL:
+			// 操作名在请求进入检测前已由 GraphQL 防护解析好
+			if part.Name == "" {
+				value = weblog.GRAPHQL_OPERATION
+			} else if slices.Contains(strings.Split(weblog.GRAPHQL_OPERATION, ","), part.Name) {
+				value = part.Name
+			}
+		}
+		if value == "" {
+			return "", false
+		}
+		values = append(values, part.String()+"="+value)
+	}
+	return strings.Join(values, ","), len(values) > 0
+}
+
+func ccKeyDigest(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// matchCCPathTemplate 路径模板匹配：{name} 或 * 匹配一段，结尾的 ** 匹配余下任意段
+func matchCCPathTemplate(template string, path string) bool {
+	tpl := strings.Split(strings.Trim(template, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, t := range tpl {
+		if t == "**" && i == len(tpl)-1 {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if t == "*" || (strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}")) {
+			if segs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if t != segs[i] {
+			return false
+		}
+	}
+	return len(tpl) == len(segs)
+}
+
+// bearerJwtClaim 从 Authorization: Bearer 里取 JWT 的声明。
+// 不验签：只用来给请求分组计数，伪造声明就能换计数桶，需要防绕过时应与 ip 组合使用
+func bearerJwtClaim(r *http.Request, claim string) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	segs := strings.Split(strings.TrimSpace(auth[7:]), ".")
+	if len(segs) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segs[1], "="))
+	if err != nil {
+		return ""
+	}
+	claims := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return ""
+	}
+	value, ok := claims[claim]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,143 @@
+package wafenginecore
+
+import (
+	"SamWaf/cache"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCCLimitKey(t *testing.T) {
+	parts, err := model.ParseCCLimitKey("ip + path:/api/users/{id} + header:X-Api-Key")
+	if err != nil || len(parts) != 3 || parts[1].Name != "/api/users/{id}" || parts[2].String() != "header:X-Api-Key" {
+		t.Fatalf("解析结果不正确: %+v %v", parts, err)
+	}
+	if parts, err := model.ParseCCLimitKey("ip+grpc:pkg.UserService/*"); err != nil || parts[1].Kind != model.CCKeyGrpc {
+		t.Fatalf("gRPC 方法模式应能解析: %+v %v", parts, err)
+	}
+	for _, bad := range []string{"", "ip+", "header", "ip:x", "path:api", "body:x", "grpc:pkg.Svc", "grpc:a/b/c", "graphql:a-b"} {
+		if _, err := model.ParseCCLimitKey(bad); err == nil {
+			t.Fatalf("%q 应解析失败", bad)
+		}
+	}
+}
+
+func TestMatchCCPathTemplate(t *testing.T) {
+	cases := []struct {
+		tpl, path string
+		want      bool
+	}{
+		{"/api/users/{id}", "/api/users/42", true},
+		{"/api/users/{id}", "/api/users/42/orders", false},
+		{"/api/users/{id}", "/api/users/", false},
+		{"/api/*/orders", "/api/7/orders", true},
+		{"/api/**", "/api/a/b/c", true},
+		{"/login", "/login", true},
+		{"/login", "/logout", false},
+	}
+	for _, c := range cases {
+		if got := matchCCPathTemplate(c.tpl, c.path); got != c.want {
+			t.Errorf("matchCCPathTemplate(%q,%q)=%v 期望 %v", c.tpl, c.path, got, c.want)
+		}
+	}
+}
+
+func TestCCLimitKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/users/42?token=abc", nil)
+	r.Header.Set("X-Api-Key", "secret-key")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","uid":1234567890}`))
+	r.Header.Set("Authorization", "Bearer e30."+payload+".sig")
+
+	parts, _ := model.ParseCCLimitKey("ip+path:/api/users/{id}+header:X-Api-Key")
+	key, ok := ccLimitKey(r, &innerbean.WebLog{}, "1.2.3.4", parts)
+	if !ok || !strings.HasPrefix(key, "ip=1.2.3.4,path:/api/users/{id}=/api/users/{id},header:X-Api-Key=") {
+		t.Fatalf("限流键不正确: %q", key)
+	}
+	if strings.Contains(key, "secret-key") {
+		t.Fatalf("限流键不应包含请求头原值: %q", key)
+	}
+
+	parts, _ = model.ParseCCLimitKey("jwt:uid")
+	k1, ok := ccLimitKey(r, &innerbean.WebLog{}, "1.2.3.4", parts)
+	if !ok || k1 != "jwt:uid="+ccKeyDigest("1234567890") {
+		t.Fatalf("JWT 数字声明应按原样取值: %q", k1)
+	}
+
+	parts, _ = model.ParseCCLimitKey("cookie:sid")
+	if _, ok := ccLimitKey(r, &innerbean.WebLog{}, "1.2.3.4", parts); ok {
+		t.Fatalf("缺少 Cookie 时规则不应参与")
+	}
+	parts, _ = model.ParseCCLimitKey("path:/login")
+	if _, ok := ccLimitKey(r, &innerbean.WebLog{}, "1.2.3.4", parts); ok {
+		t.Fatalf("路径不匹配模板时规则不应参与")
+	}
+
+	g := httptest.NewRequest(http.MethodPost, "/pkg.UserService/Login", nil)
+	g.Header.Set("Content-Type", "application/grpc")
+	parts, _ = model.ParseCCLimitKey("grpc")
+	if key, ok := ccLimitKey(g, &innerbean.WebLog{}, "1.2.3.4", parts); !ok || key != "grpc=pkg.UserService/Login" {
+		t.Fatalf("gRPC 限流键不正确: %q", key)
+	}
+	parts, _ = model.ParseCCLimitKey("ip+grpc:pkg.UserService/*")
+	if key, ok := ccLimitKey(g, &innerbean.WebLog{}, "1.2.3.4", parts); !ok || key != "ip=1.2.3.4,grpc:pkg.UserService/*=pkg.UserService/*" {
+		t.Fatalf("同一服务的方法应共用一个键: %q", key)
+	}
+	parts, _ = model.ParseCCLimitKey("grpc:pkg.OrderService/*")
+	if _, ok := ccLimitKey(g, &innerbean.WebLog{}, "1.2.3.4", parts); ok {
+		t.Fatalf("方法不匹配模式时规则不应参与")
+	}
+	if _, ok := ccLimitKey(r, &innerbean.WebLog{}, "1.2.3.4", parts); ok {
+		t.Fatalf("非 gRPC 请求不应参与 gRPC 限流")
+	}
+
+	gql := &innerbean.WebLog{GRAPHQL_OPERATION: "Login,Me"}
+	parts, _ = model.ParseCCLimitKey("ip+graphql:Login")
+	if key, ok := ccLimitKey(r, gql, "1.2.3.4", parts); !ok || key != "ip=1.2.3.4,graphql:Login=Login" {
+		t.Fatalf("GraphQL 限流键不正确: %q", key)
+	}
+	parts, _ = model.ParseCCLimitKey("graphql")
+	if key, ok := ccLimitKey(r, gql, "1.2.3.4", parts); !ok || key != "graphql=Login,Me" {
+		t.Fatalf("GraphQL 限流键不正确: %q", key)
+	}
+	parts, _ = model.ParseCCLimitKey("graphql:Logout")
+	if _, ok := ccLimitKey(r, gql, "1.2.3.4", parts); ok {
+		t.Fatalf("不含该操作的请求不应参与限流")
+	}
+}
+
+func TestCheckCCKeyedBansKeyAcrossIPs(t *testing.T) {
+	global.GCACHE_WAFCACHE = cache.InitWafCache()
+	limiters := BuildCCKeyedLimiters([]model.AntiCC{
+		{LimitKey: "ip"}, // 只按IP也可以写成按键规则
+		{LimitKey: "body:x"},
+		{LimitKey: "header:X-Api-Key", Rate: 60, Limit: 2, LimitMode: "window", LockIPMinutes: 5},
+	})
+	if len(limiters) != 2 {
+		t.Fatalf("非法限流键应被跳过, 实际 %d 条", len(limiters))
+	}
+	limiters[1].AntiCC.Id = "keyed-rule"
+	check := func(ip string) detection.Result {
+		r := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+		r.Header.Set("X-Api-Key", "rotating-proxy-token")
+		result := detection.Result{}
+		checkCCKeyed(&result, r, &innerbean.WebLog{}, ip, limiters[1:], "【局部】")
+		return result
+	}
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if r := check(ip); r.IsBlock {
+			t.Fatalf("第%d次请求不应超限: %+v", i+1, r)
+		}
+	}
+	if r := check("10.0.0.3"); !r.IsBlock {
+		t.Fatalf("同一令牌换IP也应被限流: %+v", r)
+	}
+	if r := check("10.0.0.4"); !r.IsBlock || !strings.Contains(r.Title, "已被封禁") {
+		t.Fatalf("封禁的是令牌，换IP仍应拦截: %+v", r)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"SamWaf/global"
 	"SamWaf/innerbean"
 	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
 	"SamWaf/wafenginecore/wafcaptcha"
 	"net/http"
 	"strings"
@@ -12,25 +13,8 @@ import (
 
 // checkCaptchaToken 返回false 要验证信息 ，true 不验证信息
 func (waf *WafEngine) checkCaptchaToken(r *http.Request, webLog innerbean.WebLog, captchaConfig model.CaptchaConfig, ipMode string) bool {
-	// 根据IP模式选择使用的IP（从 Host 级别传入）
-	clientIP := model.GetClientIPByMode(ipMode, webLog.NetSrcIp, webLog.SRC_IP)
-
-	// 首先从Cookie中获取验证标识
-	cookie, err := r.Cookie("samwaf_captcha_token")
-	if err == nil && cookie.Value != "" {
-		// 检查缓存中是否存在该标识
-		if global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CAPTCHA_PASS + cookie.Value + clientIP) {
-			return true
-		}
-	}
-
-	// 如果Cookie中没有或无效，则检查请求头
-	token := r.Header.Get("X-SamWaf-Captcha-Token")
-	if token != "" {
-		// 检查缓存中是否存在该标识
-		if global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CAPTCHA_PASS + token + clientIP) {
-			return true
-		}
+	if hasCaptchaClearance(r, webLog, captchaConfig, ipMode) {
+		return true
 	}
 	//是bot而且危险程度是0，那么不用进行验证码挑战
 	if webLog.IsBot == 1 {
@@ -59,3 +43,68 @@ func (waf *WafEngine) handleCaptchaRequest(w http.ResponseWriter, r *http.Reques
 	captchaService := wafcaptcha.GetService()
 	captchaService.HandleCaptchaRequest(w, r, log, captchaConfig, pathPrefix, ipMode)
 }
+
+// hasCaptchaClearance 是否持有有效的验证通过凭证（Cookie 或请求头）
+func hasCaptchaClearance(r *http.Request, webLog innerbean.WebLog, captchaConfig model.CaptchaConfig, ipMode string) bool {
+	// 根据IP模式选择使用的IP（从 Host 级别传入）
+	clientIP := model.GetClientIPByMode(ipMode, webLog.NetSrcIp, webLog.SRC_IP)
+	binding := wafcaptcha.ClearanceBinding(r, captchaConfig, clientIP)
+
+	// 首先从Cookie中获取验证标识
+	cookie, err := r.Cookie("samwaf_captcha_token")
+	if err == nil && cookie.Value != "" {
+		// 检查缓存中是否存在该标识
+		if global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CAPTCHA_PASS + cookie.Value + binding) {
+			return true
+		}
+	}
+
+	// 如果Cookie中没有或无效，则检查请求头
+	token := r.Header.Get("X-SamWaf-Captcha-Token")
+	if token != "" {
+		// 检查缓存中是否存在该标识
+		if global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_CAPTCHA_PASS + token + binding) {
+			return true
+		}
+	}
+	return false
+}
+
+// challengeCaptchaConfig 规则/CC 的"挑战"动作使用的验证配置：
+// 站点开启了验证码就用站点配置的引擎，否则用无交互的 JS 挑战
+func challengeCaptchaConfig(hostTarget *wafenginmodel.HostSafe) (model.CaptchaConfig, string) {
+	captchaConfig := model.ParseCaptchaConfig(hostTarget.Host.CaptchaJSON)
+	if captchaConfig.IsEnableCaptcha != 1 {
+		captchaConfig.EngineType = wafcaptcha.EngineJsChallenge
+	}
+	pathPrefix := captchaConfig.PathPrefix
+	if pathPrefix == "" {
+		pathPrefix = "/samwaf_captcha"
+	}
+	return captchaConfig, pathPrefix
+}
+
+// serveChallenge 执行"挑战"动作：已通过验证的放行(返回 false)，否则出示挑战页(返回 true)
+func (waf *WafEngine) serveChallenge(w http.ResponseWriter, r *http.Request, weblog *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe, title string) bool {
+	captchaConfig, pathPrefix := challengeCaptchaConfig(hostTarget)
+	if hasCaptchaClearance(r, *weblog, captchaConfig, hostTarget.Host.IPMode) {
+		return false
+	}
+	if negotiateBlockFormat(r) == model.BlockingPageContentTypeGRPC {
+		// gRPC 客户端没法做验证码/JS 挑战，直接按拦截回 grpc-status
+		EchoErrorInfo(w, r, weblog, title, title, hostTarget, waf.rt().HostTarget[waf.rt().HostCode[global.GWAF_GLOBAL_HOST_CODE]], true, inferAttackType(title))
+		return true
+	}
+	weblog.RULE = title
+	waf.handleCaptchaRequest(w, r, weblog, captchaConfig, pathPrefix, hostTarget.Host.IPMode)
+	return true
+}
+
+// isJsChallengeVerifyPath 是否是 JS 挑战提交答案的路径
+func isJsChallengeVerifyPath(path string, captchaConfig model.CaptchaConfig) bool {
+	pathPrefix := captchaConfig.PathPrefix
+	if pathPrefix == "" {
+		pathPrefix = "/samwaf_captcha"
+	}
+	return path == strings.TrimSuffix(pathPrefix, "/")+wafcaptcha.JsChallengeVerifyPath
+}
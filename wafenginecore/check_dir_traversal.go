@@ -3,6 +3,7 @@ package wafenginecore
 import (
 	"SamWaf/innerbean"
 	"SamWaf/libinjection-go"
+	"SamWaf/model"
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"net/http"
@@ -17,22 +18,8 @@ func (waf *WafEngine) CheckDirTraversal(r *http.Request, weblogbean *innerbean.W
 		Title:           "",
 		Content:         "",
 	}
-	var flag = false
-	//检测sql注入
-	if libinjection.HasDirTraversal(weblogbean.RawQuery) ||
-		libinjection.HasDirTraversal(weblogbean.BODY) {
-		flag = true
-	}
-	if flag == false {
-		for _, value := range formValue {
-			for _, v := range value {
-				if libinjection.HasDirTraversal(v) {
-					flag = true
-				}
-			}
-		}
-	}
-	if flag == true {
+	if arg, flag := matchReqArg(detectArgs(r, weblogbean, hostTarget, globalHostTarget, model.DetectExclusionDIR), true, libinjection.HasDirTraversal); flag {
+		weblogbean.MATCH_ARG = arg.Label()
 		weblogbean.RISK_LEVEL = 2
 		result.IsBlock = true
 		result.Title = "目录穿越漏洞"
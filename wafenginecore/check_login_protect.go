@@ -0,0 +1,269 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/utils"
+	"SamWaf/wafipban"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 登录接口防撞库/账号接管
+//
+// 检测阶段：命中登录端点的请求按 IP、用户名、IP网段 三个维度查窗口内的失败统计，
+// 算出 0-100 的风险分转发给源站；任一维度达到上限即挑战或拦截。
+// 响应阶段：按端点配置的失败信号判定本次登录成败，失败时三个维度各记一笔，成功时清掉该用户名的计数。
+// 检测阶段只读不写，计数完全取决于源站的真实响应，不会因为 WAF 自己拦截而重复累加。
+
+// loginUsernameMaxLen 用户名最长保留长度，防止超长字段撑大计数键
+const loginUsernameMaxLen = 128
+
+// loginBodyMarkMaxBytes 按正文标记判定失败时最多读取的响应大小，登录接口的响应通常很小
+const loginBodyMarkMaxBytes = 1 << 20
+
+// stripLoginRiskHeader 风险分头只能由 WAF 写入，访客自带的一律去掉，否则源站会信任伪造的低风险分。
+// 必须在白名单、关闭防御、自定义规则跳过等分支之前调用，这些分支都不会走到 CheckLoginProtect
+func stripLoginRiskHeader(r *http.Request, hostTarget *wafenginmodel.HostSafe) {
+	if hostTarget.Host.LoginProtectJSON == "" {
+		return
+	}
+	cfg := model.ParseLoginProtectConfig(hostTarget.Host.LoginProtectJSON)
+	if cfg.IsEnable == 1 && cfg.RiskHeader != "" {
+		r.Header.Del(cfg.RiskHeader)
+	}
+}
+
+// CheckLoginProtect 登录接口防护检测
+func (waf *WafEngine) CheckLoginProtect(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values,
+	hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{JumpGuardResult: false, IsBlock: false, Title: "", Content: ""}
+
+	cfg := model.ParseLoginProtectConfig(hostTarget.Host.LoginProtectJSON)
+	if cfg.IsEnable != 1 {
+		return result
+	}
+	idx := matchLoginEndpoint(cfg.Endpoints, r.Method, r.URL.Path)
+	if idx < 0 {
+		return result
+	}
+	ep := cfg.Endpoints[idx]
+
+	clientIP := model.GetClientIPByMode(hostTarget.Host.IPMode, weblogbean.NetSrcIp, weblogbean.SRC_IP)
+	attempt := &innerbean.LoginAttempt{
+		HostCode: hostTarget.Host.Code,
+		Endpoint: idx,
+		Username: loginUsername(r, weblogbean, formValue, ep.UsernameField),
+		ClientIP: clientIP,
+		Subnet:   loginSubnet(clientIP),
+	}
+	weblogbean.LoginAttempt = attempt
+
+	score, reason := loginRiskScore(wafipban.GetSiteLoginFailureManager(), attempt, cfg)
+	if cfg.RiskHeader != "" {
+		r.Header.Set(cfg.RiskHeader, strconv.Itoa(min(score, 100)))
+	}
+	if score < 100 {
+		return result
+	}
+
+	weblogbean.RISK_LEVEL = 2
+	result.Title = "登录防护:" + reason
+	// 挑战模式下失败次数达到上限两倍(通过挑战后仍在继续试密码)直接拦截
+	if cfg.Action == model.LoginProtectActionBlock || score >= 200 {
+		result.IsBlock = true
+		result.Content = "登录尝试过于频繁，请稍后再试"
+		return result
+	}
+	result.IsChallenge = true
+	result.Content = "请先完成浏览器验证"
+	return result
+}
+
+// matchLoginEndpoint 按路径与方法匹配登录端点，未命中返回 -1。
+// 路径两边都先归一化，/login/、//login、/Login、/login;x 这类后端通常同样路由到登录接口的写法不能绕过防护
+func matchLoginEndpoint(endpoints []model.LoginEndpoint, method, reqPath string) int {
+	reqPath = normalizeLoginPath(reqPath)
+	for i, ep := range endpoints {
+		if ep.Path == "" || normalizeLoginPath(ep.Path) != reqPath {
+			continue
+		}
+		if strings.EqualFold(ep.Method, method) {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeLoginPath 去掉每段的 ;参数(Java 容器的 ;jsessionid 等)，合并多余斜杠与 ./..，去掉末尾斜杠，转小写
+func normalizeLoginPath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if j := strings.IndexByte(seg, ';'); j >= 0 {
+			segs[i] = seg[:j]
+		}
+	}
+	return strings.ToLower(path.Clean("/" + strings.Join(segs, "/")))
+}
+
+// loginUsername 取用户名：表单字段 > 查询参数 > JSON 正文(支持 a.b 点路径)
+func loginUsername(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, field string) string {
+	if field == "" {
+		return ""
+	}
+	v := formValue.Get(field)
+	if v == "" {
+		v = r.URL.Query().Get(field)
+	}
+	if v == "" && strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "json") && weblogbean.BODY != "" {
+		v = jsonDotPath(weblogbean.BODY, field)
+	}
+	v = strings.ToLower(strings.TrimSpace(v))
+	if len(v) > loginUsernameMaxLen {
+		v = v[:loginUsernameMaxLen]
+	}
+	return v
+}
+
+// jsonDotPath 按 a.b 点路径取 JSON 里的字符串/数字值
+func jsonDotPath(body, path string) string {
+	var cur interface{}
+	if err := json.Unmarshal([]byte(body), &cur); err != nil {
+		return ""
+	}
+	for _, seg := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if cur, ok = obj[seg]; !ok {
+			return ""
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// loginSubnet IPv4 取 /24，IPv6 取 /64
+func loginSubnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// loginRiskScore 各维度"窗口内统计/上限"取最大值换算成分数(100 即达到上限，可超过 100)，并返回主要原因
+func loginRiskScore(m *wafipban.SiteLoginFailureManager, attempt *innerbean.LoginAttempt, cfg model.LoginProtectConfig) (int, string) {
+	if m == nil {
+		return 0, ""
+	}
+	window := int64(cfg.WindowMinutes)
+	ipStat := m.GetStat(attempt.HostCode, wafipban.SiteLoginDimIP, attempt.ClientIP, window)
+	userStat := m.GetStat(attempt.HostCode, wafipban.SiteLoginDimUser, attempt.Username, window)
+	subnetStat := m.GetStat(attempt.HostCode, wafipban.SiteLoginDimSubnet, attempt.Subnet, window)
+
+	score, reason := 0, ""
+	check := func(value int64, limit int, why string) {
+		if limit <= 0 {
+			return
+		}
+		if s := int(value * 100 / int64(limit)); s > score {
+			score, reason = s, why
+		}
+	}
+	check(ipStat.Count, cfg.IPLimit, "IP登录失败过多")
+	check(ipStat.Peers, cfg.IPUsersLimit, "同一IP尝试多个账号(撞库)")
+	check(userStat.Count, cfg.UserLimit, "账号登录失败过多")
+	check(userStat.Peers, cfg.UserIPsLimit, "同一账号被多个IP尝试(分布式爆破)")
+	check(subnetStat.Count, cfg.SubnetLimit, "网段登录失败过多")
+	return score, reason
+}
+
+// recordLoginResult 响应阶段：判定登录成败并更新计数
+func (waf *WafEngine) recordLoginResult(resp *http.Response, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	attempt := weblogbean.LoginAttempt
+	if attempt == nil || hostTarget == nil {
+		return
+	}
+	cfg := model.ParseLoginProtectConfig(hostTarget.Host.LoginProtectJSON)
+	if cfg.IsEnable != 1 || attempt.Endpoint >= len(cfg.Endpoints) {
+		return
+	}
+	m := wafipban.GetSiteLoginFailureManager()
+	if m == nil {
+		return
+	}
+	if !isLoginFailure(resp, cfg.Endpoints[attempt.Endpoint]) {
+		if cfg.ClearOnSuccess == 1 {
+			m.Clear(attempt.HostCode, wafipban.SiteLoginDimUser, attempt.Username)
+		}
+		return
+	}
+
+	before, _ := loginRiskScore(m, attempt, cfg)
+	window := int64(cfg.WindowMinutes)
+	m.Record(attempt.HostCode, wafipban.SiteLoginDimIP, attempt.ClientIP, attempt.Username, window, max(cfg.IPLimit, cfg.IPUsersLimit))
+	m.Record(attempt.HostCode, wafipban.SiteLoginDimUser, attempt.Username, attempt.ClientIP, window, max(cfg.UserLimit, cfg.UserIPsLimit))
+	m.Record(attempt.HostCode, wafipban.SiteLoginDimSubnet, attempt.Subnet, attempt.ClientIP, window, cfg.SubnetLimit)
+
+	// 只在本次失败让风险分越过上限时通知一次，之后的失败不重复通知
+	after, reason := loginRiskScore(m, attempt, cfg)
+	if before >= 100 || after < 100 {
+		return
+	}
+	zlog.Info("登录防护达到上限", zap.String("host", attempt.HostCode), zap.String("ip", attempt.ClientIP),
+		zap.String("user", attempt.Username), zap.String("reason", reason))
+	if global.GQEQUE_MESSAGE_DB != nil {
+		global.GQEQUE_MESSAGE_DB.Enqueue(innerbean.RuleMessageInfo{
+			BaseMessageInfo: innerbean.BaseMessageInfo{OperaType: "登录防护告警", Server: global.GWAF_CUSTOM_SERVER_NAME},
+			Domain:          weblogbean.HOST,
+			RuleInfo:        fmt.Sprintf("%s 账号:%s", reason, attempt.Username),
+			Ip:              fmt.Sprintf("%s (%s)", attempt.ClientIP, utils.GetCountry(attempt.ClientIP)),
+		})
+	}
+}
+
+// isLoginFailure 失败信号任一命中即失败；端点没配置任何信号时 401/403 算失败
+func isLoginFailure(resp *http.Response, ep model.LoginEndpoint) bool {
+	if ep.FailStatus == "" && ep.FailRedirect == "" && ep.FailBodyMark == "" {
+		return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+	}
+	for _, s := range strings.Split(ep.FailStatus, ",") {
+		if code, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && code == resp.StatusCode {
+			return true
+		}
+	}
+	if ep.FailRedirect != "" {
+		if loc := resp.Header.Get("Location"); loc != "" && strings.Contains(loc, ep.FailRedirect) {
+			return true
+		}
+	}
+	if ep.FailBodyMark != "" && resp.Body != nil && resp.ContentLength <= loginBodyMarkMaxBytes {
+		body, err := readDecompressedBodyLimit(resp, loginBodyMarkMaxBytes)
+		if err == nil && strings.Contains(string(body), ep.FailBodyMark) {
+			return true
+		}
+	}
+	return false
+}
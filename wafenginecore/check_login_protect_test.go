@@ -0,0 +1,211 @@
+package wafenginecore
+
+import (
+	"SamWaf/cache"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafipban"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const loginProtectJSON = `{"is_enable":1,"endpoints":[{"path":"/login","username_field":"user.name","fail_status":"401"}],
+"ip_limit":3,"user_limit":3,"ip_users_limit":2,"user_ips_limit":2,"subnet_limit":10}`
+
+func loginHost(code string) *wafenginmodel.HostSafe {
+	return &wafenginmodel.HostSafe{Host: model.Hosts{Code: code, LoginProtectJSON: loginProtectJSON}}
+}
+
+// loginOnce 走一遍检测阶段 + 响应阶段，返回检测结果与转发给源站的风险分头
+func loginOnce(t *testing.T, waf *WafEngine, host *wafenginmodel.HostSafe, ip, user string, status int) (bool, bool, string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"user":{"name":%q},"password":"x"}`, user)
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-SamWaf-Login-Risk", "0")
+	weblog := &innerbean.WebLog{SRC_IP: ip, NetSrcIp: ip, BODY: body}
+	res := waf.CheckLoginProtect(r, weblog, url.Values{}, host, host)
+	if weblog.LoginAttempt == nil {
+		t.Fatalf("命中登录端点应记录登录尝试")
+	}
+	if !res.IsBlock && !res.IsChallenge {
+		waf.recordLoginResult(&http.Response{StatusCode: status, Header: http.Header{}}, weblog, host)
+	}
+	return res.IsBlock, res.IsChallenge, r.Header.Get("X-SamWaf-Login-Risk")
+}
+
+func TestLoginProtectUserFailures(t *testing.T) {
+	wafipban.InitSiteLoginFailureManager(cache.InitWafCache())
+	waf := &WafEngine{}
+	host := loginHost("login-user")
+
+	for i := 0; i < 3; i++ {
+		if block, challenge, _ := loginOnce(t, waf, host, "1.1.1.1", "Alice", http.StatusUnauthorized); block || challenge {
+			t.Fatalf("第 %d 次尝试不应被处置", i+1)
+		}
+	}
+	_, challenge, risk := loginOnce(t, waf, host, "1.1.1.1", "alice", http.StatusUnauthorized)
+	if !challenge || risk != "100" {
+		t.Fatalf("达到上限应挑战且风险分为100: challenge=%v risk=%s", challenge, risk)
+	}
+}
+
+// 路径写法不同但后端同样路由到登录接口的请求都要算作登录端点
+func TestMatchLoginEndpointPathVariants(t *testing.T) {
+	endpoints := []model.LoginEndpoint{{Path: "/login", Method: "POST"}, {Path: "/api/Auth/", Method: "POST"}}
+	for _, p := range []string{"/login", "/login/", "//login", "/Login", "/login;x", "/login;jsessionid=1/", "/a/../login"} {
+		if idx := matchLoginEndpoint(endpoints, "POST", p); idx != 0 {
+			t.Errorf("%s 应命中 /login，实际 %d", p, idx)
+		}
+	}
+	if idx := matchLoginEndpoint(endpoints, "post", "/api/auth"); idx != 1 {
+		t.Errorf("配置路径同样归一化后比较，实际 %d", idx)
+	}
+	for _, p := range []string{"/login2", "/loginx;", "/user/login"} {
+		if idx := matchLoginEndpoint(endpoints, "POST", p); idx != -1 {
+			t.Errorf("%s 不应命中，实际 %d", p, idx)
+		}
+	}
+	if idx := matchLoginEndpoint(endpoints, "GET", "/login"); idx != -1 {
+		t.Errorf("方法不符不应命中，实际 %d", idx)
+	}
+}
+
+// 维度上限为 0 不记录；持续失败时单个键的事件数有上限，但仍能达到挑战转拦截的两倍上限
+func TestSiteLoginFailureRecordBounded(t *testing.T) {
+	wafipban.InitSiteLoginFailureManager(cache.InitWafCache())
+	m := wafipban.GetSiteLoginFailureManager()
+	for i := 0; i < 20; i++ {
+		m.Record("login-bounded", wafipban.SiteLoginDimSubnet, "1.1.1.0/24", "1.1.1.1", 10, 0)
+		m.Record("login-bounded", wafipban.SiteLoginDimIP, "1.1.1.1", fmt.Sprintf("u%d", i), 10, 3)
+	}
+	if stat := m.GetStat("login-bounded", wafipban.SiteLoginDimSubnet, "1.1.1.0/24", 10); stat.Count != 0 {
+		t.Fatalf("上限为 0 的维度不应记录: %+v", stat)
+	}
+	if stat := m.GetStat("login-bounded", wafipban.SiteLoginDimIP, "1.1.1.1", 10); stat.Count != 6 || stat.Peers != 6 {
+		t.Fatalf("单个键应只保留 2*limit 条事件: %+v", stat)
+	}
+}
+
+func TestLoginProtectSuccessClearsUser(t *testing.T) {
+	wafipban.InitSiteLoginFailureManager(cache.InitWafCache())
+	waf := &WafEngine{}
+	host := loginHost("login-clear")
+
+	loginOnce(t, waf, host, "2.2.2.2", "bob", http.StatusUnauthorized)
+	loginOnce(t, waf, host, "2.2.2.2", "bob", http.StatusUnauthorized)
+	if _, _, risk := loginOnce(t, waf, host, "2.2.2.2", "bob", http.StatusOK); risk != "66" {
+		t.Fatalf("两次失败后风险分应为66，实际 %s", risk)
+	}
+	// 登录成功清掉用户名计数，IP 维度仍保留(2/3)
+	if _, _, risk := loginOnce(t, waf, host, "2.2.2.2", "bob", http.StatusOK); risk != "66" {
+		t.Fatalf("成功后只剩IP维度计数，风险分应为66，实际 %s", risk)
+	}
+	stat := wafipban.GetSiteLoginFailureManager().GetStat("login-clear", wafipban.SiteLoginDimUser, "bob", 10)
+	if stat.Count != 0 {
+		t.Fatalf("登录成功后用户名计数应被清除: %+v", stat)
+	}
+}
+
+func TestLoginProtectCredentialStuffing(t *testing.T) {
+	wafipban.InitSiteLoginFailureManager(cache.InitWafCache())
+	waf := &WafEngine{}
+	host := loginHost("login-stuffing")
+
+	// 同一IP换账号试：第二个不同账号失败后达到 ip_users_limit
+	loginOnce(t, waf, host, "3.3.3.3", "u1", http.StatusUnauthorized)
+	loginOnce(t, waf, host, "3.3.3.3", "u2", http.StatusUnauthorized)
+	if _, challenge, _ := loginOnce(t, waf, host, "3.3.3.3", "u3", http.StatusUnauthorized); !challenge {
+		t.Fatalf("同一IP尝试多个账号应被挑战")
+	}
+
+	// 同一账号从多个IP试(分布式爆破)，换IP也会被挑战
+	loginOnce(t, waf, host, "4.4.4.4", "victim", http.StatusUnauthorized)
+	loginOnce(t, waf, host, "5.5.5.5", "victim", http.StatusUnauthorized)
+	if _, challenge, _ := loginOnce(t, waf, host, "6.6.6.6", "victim", http.StatusUnauthorized); !challenge {
+		t.Fatalf("同一账号被多个IP尝试应被挑战")
+	}
+}
+
+func TestLoginProtectNonEndpointStripsRiskHeader(t *testing.T) {
+	waf := &WafEngine{}
+	host := loginHost("login-strip")
+	r := httptest.NewRequest(http.MethodGet, "/home", nil)
+	r.Header.Set("X-SamWaf-Login-Risk", "0")
+	weblog := &innerbean.WebLog{SRC_IP: "7.7.7.7", NetSrcIp: "7.7.7.7"}
+	// 引擎在白名单/关闭防御等分支之前就去掉了风险分头，不依赖检测是否执行
+	stripLoginRiskHeader(r, host)
+	waf.CheckLoginProtect(r, weblog, url.Values{}, host, host)
+	if r.Header.Get("X-SamWaf-Login-Risk") != "" || weblog.LoginAttempt != nil {
+		t.Fatalf("非登录端点应去掉访客自带的风险分头且不记录尝试")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/home", nil)
+	r.Header.Set("X-SamWaf-Login-Risk", "0")
+	stripLoginRiskHeader(r, &wafenginmodel.HostSafe{Host: model.Hosts{Code: "login-off"}})
+	if r.Header.Get("X-SamWaf-Login-Risk") != "0" {
+		t.Fatalf("未开启登录防护时不应改动请求头")
+	}
+}
+
+func TestIsLoginFailure(t *testing.T) {
+	resp := func(status int, loc string) *http.Response {
+		h := http.Header{}
+		if loc != "" {
+			h.Set("Location", loc)
+		}
+		return &http.Response{StatusCode: status, Header: h}
+	}
+	if !isLoginFailure(resp(403, ""), model.LoginEndpoint{}) || isLoginFailure(resp(302, ""), model.LoginEndpoint{}) {
+		t.Fatalf("未配置失败信号时应按 401/403 判定")
+	}
+	ep := model.LoginEndpoint{FailRedirect: "/login?error"}
+	if !isLoginFailure(resp(302, "/login?error=1"), ep) || isLoginFailure(resp(302, "/home"), ep) {
+		t.Fatalf("跳转地址判定不正确")
+	}
+	ep = model.LoginEndpoint{FailBodyMark: "密码错误"}
+	r := resp(200, "")
+	r.Body = http.NoBody
+	if isLoginFailure(r, ep) {
+		t.Fatalf("空正文不应判为失败")
+	}
+	r = resp(200, "")
+	r.ContentLength = -1
+	r.Body = io.NopCloser(strings.NewReader("密码错误"))
+	if !isLoginFailure(r, ep) {
+		t.Fatalf("chunked 小响应应按正文标记判定")
+	}
+	// chunked 大响应和解压后超限的响应只读到上限为止，正文原样留给下游
+	big := "密码错误" + strings.Repeat("x", loginBodyMarkMaxBytes)
+	r = resp(200, "")
+	r.ContentLength = -1
+	r.Body = io.NopCloser(strings.NewReader(big))
+	if isLoginFailure(r, ep) {
+		t.Fatalf("超出读取上限的正文不应判定")
+	}
+	if rest, _ := io.ReadAll(r.Body); string(rest) != big {
+		t.Fatalf("超限时正文应完整保留: %d", len(rest))
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(big))
+	zw.Close()
+	r = resp(200, "")
+	r.Header.Set("Content-Encoding", "gzip")
+	r.ContentLength = int64(gz.Len())
+	r.Body = io.NopCloser(bytes.NewReader(gz.Bytes()))
+	if isLoginFailure(r, ep) {
+		t.Fatalf("解压后超出读取上限的正文不应判定")
+	}
+	if loginSubnet("10.1.2.3") != "10.1.2.0/24" || loginSubnet("2001:db8::1") != "2001:db8::/64" {
+		t.Fatalf("网段计算不正确")
+	}
+}
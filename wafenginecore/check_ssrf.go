@@ -0,0 +1,86 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafdefensessrf"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckSsrf SSRF 检测：参数值是指向内网、云元数据、危险协议的地址
+func (waf *WafEngine) CheckSsrf(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{
+		JumpGuardResult: false,
+		IsBlock:         false,
+		Title:           "",
+		Content:         "",
+	}
+	allow := strings.Split(model.ParseSsrfConfig(hostTarget.Host.SsrfJSON).AllowHosts, "\n")
+	reason := ""
+	if arg, ok := matchReqArg(detectArgs(r, weblogbean, hostTarget, globalHostTarget, model.DetectExclusionSSRF), false, func(v string) bool {
+		hit, why := wafdefensessrf.DetermineSSRF(v, allow)
+		reason = why
+		return hit
+	}); ok {
+		weblogbean.MATCH_ARG = arg.Label()
+		weblogbean.RISK_LEVEL = 3
+		result.IsBlock = true
+		result.Title = "SSRF:" + reason
+		result.Content = "请正确访问"
+	}
+	return result
+}
+
+// checkOpenRedirect 开放重定向检测：源站 3xx 跳到站外，跳转目标来自请求参数，且不在允许跳转的域名里。
+// 命中时返回拦截标题，否则返回空串
+func checkOpenRedirect(resp *http.Response, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) string {
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return ""
+	}
+	location := strings.TrimSpace(resp.Header.Get("Location"))
+	if location == "" {
+		return ""
+	}
+	// 浏览器把 \ 当 / 处理，/\evil.com 也是跳站外
+	target := extractRedirectHost(location)
+	if target == "" {
+		return ""
+	}
+	cfg := model.ParseSsrfConfig(hostTarget.Host.SsrfJSON)
+	allowed := buildCsrfAllowedHosts(extractHostFromOrigin(weblogbean.HOST), hostTarget.Host.Host+"\n"+hostTarget.Host.BindMoreHost, cfg.RedirectAllowDomains)
+	if isCsrfOriginAllowed(target, allowed) {
+		return ""
+	}
+	// 跳转目标要出现在请求参数里才算开放重定向，源站自己写死的站外跳转不管
+	for _, arg := range requestArgs(nil, weblogbean) {
+		if arg.IsName {
+			continue
+		}
+		v := strings.TrimSpace(arg.Value)
+		if extractRedirectHost(v) == target || strings.EqualFold(strings.TrimSuffix(v, "."), target) {
+			weblogbean.MATCH_ARG = arg.Label()
+			return "开放重定向:" + target
+		}
+	}
+	return ""
+}
+
+// extractRedirectHost 跳转地址里的主机(小写、去端口)；站内相对地址返回空串
+func extractRedirectHost(location string) string {
+	normalized := strings.ReplaceAll(location, `\`, "/")
+	if !strings.HasPrefix(normalized, "//") && !strings.Contains(normalized, "://") {
+		return ""
+	}
+	if strings.HasPrefix(normalized, "//") {
+		normalized = "http:" + normalized
+	}
+	u, err := url.Parse(normalized)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
@@ -0,0 +1,64 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckSsrf(t *testing.T) {
+	waf := &WafEngine{}
+	host := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "ssrf-host", SsrfJSON: `{"allow_hosts":"10.8.0.0/16"}`}}
+
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/fetch?url=http%3A%2F%2F169.254.169.254%2Flatest%2Fmeta-data%2F", nil)
+	weblog := &innerbean.WebLog{}
+	res := waf.CheckSsrf(r, weblog, nil, host, nil)
+	if !res.IsBlock || res.Title != "SSRF:云元数据地址 169.254.169.254" || weblog.MATCH_ARG != "query:url" {
+		t.Fatalf("元数据地址应拦截: %+v %q", res, weblog.MATCH_ARG)
+	}
+	if inferAttackType(res.Title) != "ssrf_attack" {
+		t.Fatalf("攻击类型不对: %s", inferAttackType(res.Title))
+	}
+
+	for _, target := range []string{"http%3A%2F%2F10.8.1.2%2Fcb", "https%3A%2F%2Fwww.example.com%2F"} {
+		r = httptest.NewRequest(http.MethodGet, "http://a.com/fetch?url="+target, nil)
+		if res = waf.CheckSsrf(r, &innerbean.WebLog{}, nil, host, nil); res.IsBlock {
+			t.Fatalf("%s 不应拦截: %+v", target, res)
+		}
+	}
+}
+
+func TestCheckOpenRedirect(t *testing.T) {
+	host := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "redir-host", Host: "a.com", BindMoreHost: "b.com", SsrfJSON: `{"redirect_allow_domains":"*.partner.com"}`}}
+	redirect := func(query string, location string) (string, *innerbean.WebLog) {
+		weblog := &innerbean.WebLog{HOST: "https://a.com", RawQuery: query}
+		resp := &http.Response{StatusCode: http.StatusFound, Header: http.Header{"Location": {location}}}
+		return checkOpenRedirect(resp, weblog, host), weblog
+	}
+
+	title, weblog := redirect("next=https://evil.com/x", "https://evil.com/x")
+	if title != "开放重定向:evil.com" || weblog.MATCH_ARG != "query:next" || inferAttackType(title) != "open_redirect" {
+		t.Fatalf("跳到参数给的站外地址应拦截: %q %q", title, weblog.MATCH_ARG)
+	}
+	if title, _ = redirect("next=//evil.com", "/\\evil.com"); title != "开放重定向:evil.com" {
+		t.Fatalf("反斜杠写法也算站外: %q", title)
+	}
+	if title, _ = redirect("to=evil.com", "https://evil.com/"); title != "开放重定向:evil.com" {
+		t.Fatalf("参数只给域名也算: %q", title)
+	}
+
+	cases := []struct{ query, location string }{
+		{"next=/home", "/home"},                                       // 站内
+		{"next=https://b.com/x", "https://b.com/x"},                   // 绑定的多域名
+		{"next=https://sso.partner.com/", "https://sso.partner.com/"}, // 允许的域名
+		{"a=1", "https://evil.com/"},                                  // 源站写死的跳转
+	}
+	for _, c := range cases {
+		if title, _ = redirect(c.query, c.location); title != "" {
+			t.Fatalf("%s -> %s 不应拦截: %q", c.query, c.location, title)
+		}
+	}
+}
@@ -261,7 +261,7 @@ func uploadBlock(weblog *innerbean.WebLog, title, content string) detection.Resu
 	return detection.Result{IsBlock: true, Title: title, Content: content}
 }
 
-// CheckUpload 文件上传内容检测：对 multipart 上传做 扩展名/大小/类型不符/Webshell 四维检测。
+// CheckUpload 文件上传内容检测：对 multipart 上传做 扩展名/大小/类型不符/Webshell 四维检测，可选再做 YARA 规则与杀毒引擎扫描。
 // 关键：禁用 r.ParseMultipartForm（会清空 body 致后端丢包）；读整份 body 到内存解析副本并复位 r.Body。
 func (waf *WafEngine) CheckUpload(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values,
 	hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
@@ -276,15 +276,6 @@ func (waf *WafEngine) CheckUpload(r *http.Request, weblogbean *innerbean.WebLog,
 	if m != http.MethodPost && m != http.MethodPut && m != http.MethodPatch {
 		return result
 	}
-	// 必须是 multipart/form-data 且能取到 boundary
-	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
-	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		return result
-	}
-	boundary := params["boundary"]
-	if boundary == "" || r.Body == nil {
-		return result
-	}
 	// 路径门：IncludePaths 非空则只检测命中的；ExcludePaths 命中则跳过（优先）
 	if strings.TrimSpace(cfg.IncludePaths) != "" && !matchUploadPathPrefix(r.URL.Path, cfg.IncludePaths) {
 		return result
@@ -292,6 +283,15 @@ func (waf *WafEngine) CheckUpload(r *http.Request, weblogbean *innerbean.WebLog,
 	if matchUploadPathPrefix(r.URL.Path, cfg.ExcludePaths) {
 		return result
 	}
+	// 必须是 multipart/form-data 且能取到 boundary；其余请求体只做可选的 YARA 检测
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return waf.checkYaraBody(r, weblogbean, cfg)
+	}
+	boundary := params["boundary"]
+	if boundary == "" || r.Body == nil {
+		return result
+	}
 
 	// 读 body（限检测缓冲上限）并复位 r.Body，保证后端能收到完整上传
 	limit := int64(cfg.MaxSizeKB)*1024 + uploadBufferSlack
@@ -306,6 +306,9 @@ func (waf *WafEngine) CheckUpload(r *http.Request, weblogbean *innerbean.WebLog,
 		return uploadBlock(weblogbean, "文件上传检测-上传体过大", "上传体超过可检测上限，已拦截")
 	}
 
+	av := newUploadAVScan(r.Context(), cfg)
+	defer av.Close()
+
 	mr := multipart.NewReader(bytes.NewReader(raw), boundary)
 	for {
 		// NextRawPart：不做 quoted-printable 解码，扫到的字节与后端收到的一致
@@ -353,6 +356,15 @@ func (waf *WafEngine) CheckUpload(r *http.Request, weblogbean *innerbean.WebLog,
 				return uploadBlock(weblogbean, "文件上传检测-Webshell", "检测到Webshell特征("+sig+")，已拦截")
 			}
 		}
+		if cfg.YaraScan == 1 {
+			if res, blocked := checkYara(weblogbean, "文件上传检测-YARA", fileContent); blocked {
+				return res
+			}
+		}
+		// 杀毒扫描最贵(走网络)，放在最后
+		if res, blocked := av.Check(weblogbean, fn, fileContent); blocked {
+			return res
+		}
 	}
 	return result
 }
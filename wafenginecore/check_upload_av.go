@@ -0,0 +1,89 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/wafenginecore/avscan"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// uploadAVScan 上传文件杀毒扫描，一次请求内的所有文件共用同一个超时。
+// 扫描器在第一次用到时创建，没有文件要扫的请求不连接杀毒服务
+type uploadAVScan struct {
+	cfg     model.UploadSecurityConfig
+	ctx     context.Context
+	cancel  context.CancelFunc
+	scanner avscan.Scanner
+	err     error //创建扫描器失败的原因(地址/引擎配置错误)，之后每个文件都按扫描失败处理
+}
+
+func newUploadAVScan(parent context.Context, cfg model.UploadSecurityConfig) *uploadAVScan {
+	if cfg.AVScan != 1 {
+		return nil
+	}
+	return &uploadAVScan{cfg: cfg, ctx: parent}
+}
+
+// Close 释放超时计时器
+func (s *uploadAVScan) Close() {
+	if s != nil && s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Check 扫描一个文件；感染或按 fail-closed 处理时返回拦截结果，并把文件名与哈希记入隔离记录
+func (s *uploadAVScan) Check(weblog *innerbean.WebLog, fileName string, data []byte) (detection.Result, bool) {
+	if s == nil {
+		return detection.Result{}, false
+	}
+	if s.scanner == nil && s.err == nil {
+		s.ctx, s.cancel = context.WithTimeout(s.ctx, time.Duration(s.cfg.AVTimeoutMs)*time.Millisecond)
+		s.scanner, s.err = avscan.New(s.cfg.AVEngine, s.cfg.AVAddress)
+	}
+
+	var scanErr error
+	var res avscan.Result
+	switch {
+	case s.err != nil:
+		scanErr = s.err
+	case overUploadSize(len(data), s.cfg.AVMaxSizeKB):
+		scanErr = fmt.Errorf("文件大小 %d 字节超过送扫上限 %dKB", len(data), s.cfg.AVMaxSizeKB)
+	default:
+		res, scanErr = s.scanner.Scan(s.ctx, fileName, data)
+	}
+
+	if scanErr != nil {
+		if !strings.EqualFold(s.cfg.AVFailAction, "block") {
+			zlog.Warn("上传文件杀毒扫描失败，按配置放行", "host", weblog.HOST, "file", fileName, "error", scanErr.Error())
+			return detection.Result{}, false
+		}
+		// 失败原因(引擎地址、超时等)只进隔离记录与日志，返回给客户端的提示不带细节
+		recordUploadQuarantine(weblog, s.cfg.AVEngine, fileName, data, "扫描失败: "+scanErr.Error())
+		return uploadBlock(weblog, "文件上传检测-病毒扫描失败", "文件未能完成杀毒扫描，已拦截"), true
+	}
+	if !res.Infected {
+		return detection.Result{}, false
+	}
+	recordUploadQuarantine(weblog, s.cfg.AVEngine, fileName, data, res.Signature)
+	return uploadBlock(weblog, "文件上传检测-病毒", "检测到恶意文件("+res.Signature+")，已拦截"), true
+}
+
+// recordUploadQuarantine 被拦截文件的隔离记录：只记文件名、大小与 SHA-256，不落文件内容，
+// 需要取样时可按哈希到威胁情报平台检索
+func recordUploadQuarantine(weblog *innerbean.WebLog, engine, fileName string, data []byte, reason string) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	line := fmt.Sprintf("file=%s sha256=%s size=%d engine=%s reason=%s", fileName, hash, len(data), engine, reason)
+	if weblog.UPLOAD_QUARANTINE != "" {
+		weblog.UPLOAD_QUARANTINE += "\n"
+	}
+	weblog.UPLOAD_QUARANTINE += line
+	zlog.Warn("上传文件已隔离", "host", weblog.HOST, "src_ip", weblog.SRC_IP, "file", fileName, "sha256", hash, "reason", reason)
+}
@@ -4,11 +4,16 @@ import (
 	"SamWaf/innerbean"
 	"SamWaf/model"
 	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wafyara"
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -158,3 +163,137 @@ func TestCheckUploadDisabledSkips(t *testing.T) {
 		t.Errorf("未开启文件上传检测不应拦截")
 	}
 }
+
+// clamdStubForUpload 最简 clamd 桩：收完 INSTREAM 分块，内容含 EICAR 即报毒
+func clamdStubForUpload(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			br := bufio.NewReader(conn)
+			br.ReadString(0)
+			var data []byte
+			size := make([]byte, 4)
+			for {
+				if _, err := io.ReadFull(br, size); err != nil {
+					break
+				}
+				n := binary.BigEndian.Uint32(size)
+				if n == 0 {
+					break
+				}
+				chunk := make([]byte, n)
+				io.ReadFull(br, chunk)
+				data = append(data, chunk...)
+			}
+			if bytes.Contains(data, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+				conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckUploadAVScan(t *testing.T) {
+	waf := &WafEngine{}
+	addr := clamdStubForUpload(t)
+	eicar := []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+	var lastContent string
+	check := func(cfgJSON string, content []byte) (bool, *innerbean.WebLog) {
+		buf, ct := buildMultipart(t, "file", "report.pdf", "application/pdf", content)
+		r := httptest.NewRequest("POST", "/upload", bytes.NewReader(buf.Bytes()))
+		r.Header.Set("Content-Type", ct)
+		weblog := &innerbean.WebLog{}
+		hostTarget := &wafenginmodel.HostSafe{Host: model.Hosts{UploadSecurityJSON: cfgJSON}}
+		res := waf.CheckUpload(r, weblog, url.Values{}, hostTarget, hostTarget)
+		lastContent = res.Content
+		return res.IsBlock, weblog
+	}
+
+	cfg := `{"is_enable":1,"av_scan":1,"av_engine":"clamd","av_address":"` + addr + `"}`
+	if blocked, weblog := check(cfg, eicar); !blocked || !strings.Contains(weblog.UPLOAD_QUARANTINE, "file=report.pdf sha256=") ||
+		!strings.Contains(weblog.UPLOAD_QUARANTINE, "Eicar-Signature") {
+		t.Errorf("EICAR 应拦截并记录隔离信息，实际 blocked=%v quarantine=%q", blocked, weblog.UPLOAD_QUARANTINE)
+	}
+	if blocked, weblog := check(cfg, []byte("%PDF-1.4 clean")); blocked || weblog.UPLOAD_QUARANTINE != "" {
+		t.Errorf("干净文件不应拦截")
+	}
+
+	// 杀毒服务不可用：默认 fail-open 放行，fail-closed 拦截
+	down := `{"is_enable":1,"av_scan":1,"av_address":"127.0.0.1:1","av_timeout_ms":500`
+	if blocked, _ := check(down+`}`, eicar); blocked {
+		t.Errorf("默认 fail-open，杀毒服务不可用应放行")
+	}
+	if blocked, weblog := check(down+`,"av_fail_action":"block"}`, eicar); !blocked || !strings.Contains(weblog.UPLOAD_QUARANTINE, "127.0.0.1:1") {
+		t.Errorf("fail-closed 时杀毒服务不可用应拦截，隔离记录里保留失败原因: %q", weblog.UPLOAD_QUARANTINE)
+	}
+	if strings.Contains(lastContent, "127.0.0.1") {
+		t.Errorf("扫描失败的细节不应返回给客户端: %q", lastContent)
+	}
+	// 超过送扫上限不送扫，按失败处理
+	if blocked, _ := check(`{"is_enable":1,"av_scan":1,"av_address":"`+addr+`","av_max_size_kb":1,"av_fail_action":"block"}`,
+		bytes.Repeat([]byte("a"), 2048)); !blocked {
+		t.Errorf("超过送扫上限且 fail-closed 应拦截")
+	}
+	if got := inferAttackType("文件上传检测-病毒扫描失败"); got != "upload_attack" {
+		t.Errorf("病毒扫描失败的拦截应归为 upload_attack，实际 %s", got)
+	}
+}
+
+func TestCheckUploadYara(t *testing.T) {
+	rules, errs := wafyara.Build([]model.YaraRuleSet{
+		{Name: "webshell", Status: 1, Action: model.YaraActionBlock, Content: `
+rule jsp_cmd { strings: $a = "Runtime.getRuntime" $b = "getParameter" condition: all of them }`},
+		{Name: "observe", Status: 1, Action: model.YaraActionLog, Content: `
+rule macro_doc { strings: $m = "AutoOpen" nocase condition: $m }`},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("编译规则失败: %v", errs)
+	}
+	wafyara.SetRules(rules)
+	defer wafyara.SetRules(nil)
+
+	waf := &WafEngine{}
+	hostTarget := &wafenginmodel.HostSafe{Host: model.Hosts{UploadSecurityJSON: `{"is_enable":1,"yara_scan":1,"yara_body_scan":1,"yara_body_min_kb":1}`}}
+	upload := func(content []byte) (bool, *innerbean.WebLog) {
+		buf, ct := buildMultipart(t, "file", "a.txt", "text/plain", content)
+		r := httptest.NewRequest("POST", "/upload", bytes.NewReader(buf.Bytes()))
+		r.Header.Set("Content-Type", ct)
+		weblog := &innerbean.WebLog{}
+		return waf.CheckUpload(r, weblog, url.Values{}, hostTarget, hostTarget).IsBlock, weblog
+	}
+
+	if blocked, weblog := upload([]byte(`x Runtime.getRuntime().exec(request.getParameter("c"))`)); !blocked || weblog.YARA_MATCH != "webshell/jsp_cmd" {
+		t.Errorf("命中拦截规则集应拦截并记录规则名，实际 blocked=%v match=%q", blocked, weblog.YARA_MATCH)
+	}
+	if blocked, weblog := upload([]byte("Sub autoopen()")); blocked || weblog.YARA_MATCH != "observe/macro_doc" {
+		t.Errorf("仅记录的规则集只记日志不拦截，实际 blocked=%v match=%q", blocked, weblog.YARA_MATCH)
+	}
+
+	// 非 multipart 的大请求体：达到下限才扫，扫完 r.Body 仍是完整原文
+	big := append(bytes.Repeat([]byte("A"), 2048), []byte("Runtime.getRuntime getParameter")...)
+	r := httptest.NewRequest("PUT", "/files/x.jsp", bytes.NewReader(big))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	weblog := &innerbean.WebLog{}
+	res := waf.CheckUpload(r, weblog, url.Values{}, hostTarget, hostTarget)
+	if !res.IsBlock || inferAttackType(res.Title) != "upload_attack" {
+		t.Errorf("大请求体命中应拦截，实际 %+v", res)
+	}
+	if after, _ := io.ReadAll(r.Body); !bytes.Equal(after, big) {
+		t.Errorf("请求体扫描后 r.Body 应完整复位")
+	}
+	small := httptest.NewRequest("PUT", "/files/x.jsp", bytes.NewReader([]byte("Runtime.getRuntime getParameter")))
+	if waf.CheckUpload(small, &innerbean.WebLog{}, url.Values{}, hostTarget, hostTarget).IsBlock {
+		t.Errorf("小于 yara_body_min_kb 的请求体不扫描")
+	}
+}
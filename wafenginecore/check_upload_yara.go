@@ -0,0 +1,72 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/wafenginecore/wafyara"
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// checkYara 用当前 YARA 规则扫描一份数据，命中的规则都记入日志；
+// 只有命中动作为拦截的规则集时才返回拦截结果，仅记录的规则集用来观察新规则的误报
+func checkYara(weblog *innerbean.WebLog, title string, data []byte) (detection.Result, bool) {
+	rules := wafyara.CurrentRules()
+	matches, err := rules.Scan(data)
+	if len(matches) > 0 {
+		if weblog.YARA_MATCH != "" {
+			weblog.YARA_MATCH += "\n"
+		}
+		weblog.YARA_MATCH += wafyara.Names(matches)
+		for _, m := range matches {
+			if m.Action == model.YaraActionBlock {
+				return uploadBlock(weblog, title, "命中YARA规则("+m.String()+")，已拦截"), true
+			}
+		}
+	}
+	// 没扫完按扫描失败处理：堆砌前缀耗光回溯步数就能让规则失效，有拦截动作的规则集时拦截
+	if err != nil {
+		if weblog.YARA_MATCH != "" {
+			weblog.YARA_MATCH += "\n"
+		}
+		weblog.YARA_MATCH += "扫描未完成"
+		if rules.HasBlock() {
+			return uploadBlock(weblog, title+"扫描未完成", "内容未能完成YARA扫描，已拦截"), true
+		}
+	}
+	return detection.Result{}, false
+}
+
+// checkYaraBody 非 multipart 请求体的 YARA 检测：达到 yara_body_min_kb 才扫，最多扫前 max_size_kb。
+// 引擎入口已读出的请求体直接用；没读的(超过记录上限)只读扫描所需的前段，剩余部分原样接回 r.Body 继续流给后端
+func (waf *WafEngine) checkYaraBody(r *http.Request, weblogbean *innerbean.WebLog, cfg model.UploadSecurityConfig) detection.Result {
+	result := detection.Result{}
+	if cfg.YaraBodyScan != 1 || r.Body == nil || r.Body == http.NoBody || wafyara.CurrentRules().Len() == 0 {
+		return result
+	}
+	limit := cfg.MaxSizeKB * 1024
+	data := weblogbean.SrcByteBody
+	if len(data) == 0 {
+		head, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)))
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+		data = head
+	}
+	if len(data) < cfg.YaraBodyMinKB*1024 {
+		return result
+	}
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	if res, blocked := checkYara(weblogbean, "请求体检测-YARA", data); blocked {
+		return res
+	}
+	return result
+}
+
+// readCloser 把读过一段的请求体拼回去，Close 仍关闭原始连接上的 body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 /*
@@ -55,8 +56,9 @@ func matchAllowIP(clientIp string, parsedIp net.IP, index *ipset.MatchSet, group
 		}
 	} else {
 		// 旧路径回退。用 MatchIPPattern 而非 CheckIPInCIDR，否则通配符与区间在这条路径上会失效。
+		now := time.Now().Unix()
 		for i := 0; i < len(list); i++ {
-			if list[i].IpType == model.IPEntryTypeGroup {
+			if list[i].IpType == model.IPEntryTypeGroup || model.ListEntryExpired(list[i].ExpireTime, now) {
 				continue
 			}
 			if utils.MatchIPPattern(clientIp, list[i].Ip) {
@@ -0,0 +1,58 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wafapispec"
+	"SamWaf/wafenginecore/wafargs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+*
+接口规范校验（正向安全模型）
+
+按网站上传的 OpenAPI 3 规范校验请求：未定义的路径/方法、必填参数、参数类型与格式、
+请求体 Schema、长度上限、请求体类型。违规明细写入 weblogbean.SPEC_VIOLATION。
+规范为 log 模式时只记录不拦截（同站点仅记录模式），enforce 模式时拦截。
+*/
+func (waf *WafEngine) CheckApiSpec(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{
+		JumpGuardResult: false,
+		IsBlock:         false,
+		Title:           "",
+		Content:         "",
+	}
+	spec := wafapispec.Select(hostTarget.ApiSpecs, r.URL.Path)
+	if spec == nil {
+		return result
+	}
+	body := weblogbean.SrcByteBody
+	if len(body) == 0 {
+		body = wafargs.ReadBody(r)
+	}
+	hasBody := r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+	violations := spec.Validate(r, body, hasBody)
+	if len(violations) == 0 {
+		return result
+	}
+	lines := make([]string, 0, len(violations))
+	for _, v := range violations {
+		lines = append(lines, v.String())
+	}
+	weblogbean.SPEC_VIOLATION = strings.Join(lines, "\n")
+	title := "API规范校验:" + violations[0].Kind
+	if spec.Mode == model.ApiSpecModeEnforce {
+		result.IsBlock = true
+		result.Title = title
+		result.Content = "请求不符合接口规范"
+		return result
+	}
+	weblogbean.RULE = title
+	weblogbean.LogOnlyMode = 1
+	return result
+}
@@ -0,0 +1,54 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/wafenginecore/wafapispec"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// log 模式只记录违规明细，enforce 模式拦截
+func TestCheckApiSpec_Mode(t *testing.T) {
+	waf, hostSafe := newTestWafForXSS()
+	globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
+	content := "openapi: 3.0.0\ninfo: {title: t, version: '1'}\npaths:\n  /api/items/{id}:\n    get:\n      parameters:\n        - {name: id, in: path, required: true, schema: {type: integer}}\n"
+
+	for _, mode := range []string{model.ApiSpecModeLog, model.ApiSpecModeEnforce} {
+		specs, errs := wafapispec.CompileList([]model.ApiSpec{{PathPrefix: "/api", SpecContent: content, Mode: mode, Status: 1}})
+		if len(errs) != 0 {
+			t.Fatalf("编译失败: %v", errs)
+		}
+		hostSafe.ApiSpecs = specs
+
+		weblog := &innerbean.WebLog{}
+		res := waf.CheckApiSpec(httptest.NewRequest(http.MethodGet, "/api/items/1", nil), weblog, url.Values{}, hostSafe, globalHost)
+		if res.IsBlock || weblog.SPEC_VIOLATION != "" {
+			t.Fatalf("[%s] 合法请求不应记录: %+v %q", mode, res, weblog.SPEC_VIOLATION)
+		}
+
+		weblog = &innerbean.WebLog{}
+		res = waf.CheckApiSpec(httptest.NewRequest(http.MethodGet, "/api/items/x", nil), weblog, url.Values{}, hostSafe, globalHost)
+		if !strings.Contains(weblog.SPEC_VIOLATION, "path:id") {
+			t.Fatalf("[%s] 应记录违规参数: %q", mode, weblog.SPEC_VIOLATION)
+		}
+		if mode == model.ApiSpecModeEnforce {
+			if !res.IsBlock || inferAttackType(res.Title) != "api_spec_violation" {
+				t.Fatalf("enforce 模式应拦截: %+v", res)
+			}
+		} else if res.IsBlock || weblog.LogOnlyMode != 1 || weblog.RULE == "" {
+			t.Fatalf("log 模式应仅记录: %+v %+v", res, weblog)
+		}
+
+		// 前缀外的请求不校验
+		weblog = &innerbean.WebLog{}
+		res = waf.CheckApiSpec(httptest.NewRequest(http.MethodGet, "/static/a.js", nil), weblog, url.Values{}, hostSafe, globalHost)
+		if res.IsBlock || weblog.SPEC_VIOLATION != "" {
+			t.Fatalf("[%s] 前缀外的请求不应校验", mode)
+		}
+	}
+}
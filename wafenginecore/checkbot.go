@@ -4,12 +4,17 @@ import (
 	"SamWaf/enums"
 	"SamWaf/global"
 	"SamWaf/innerbean"
+	"SamWaf/model"
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/wafbot"
+	"SamWaf/webplugin"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 /*
@@ -23,10 +28,10 @@ func (waf *WafEngine) CheckBot(r *http.Request, weblogbean *innerbean.WebLog, fo
 		Title:           "",
 		Content:         "",
 	}
-	//检查是否是正常IP已经cache
+	//检查是否是正常IP已经cache；UA 命中爬虫库的仍要识别，否则同一出口IP先用浏览器访问过，之后的采集脚本就识别不到了
 	isNormalCacheExist := global.GCACHE_WAFCACHE.IsKeyExist(enums.CACHE_DNS_NORMAL_IP + weblogbean.SRC_IP)
 
-	if isNormalCacheExist {
+	if isNormalCacheExist && wafbot.CurrentRegistry().Match(weblogbean.USER_AGENT) == nil {
 		return result
 	}
 	//检查是否是bot已经cache
@@ -62,10 +67,12 @@ func (waf *WafEngine) CheckBot(r *http.Request, weblogbean *innerbean.WebLog, fo
 			return result
 		}
 
-		if !isBotCacheExist && botResult.BotName != "查询超时" && botResult.BotName != "查询失败" {
-			//如果是正常爬虫，也保存结果（排除查询超时和查询失败的情况）
+		if !isBotCacheExist && !botResult.UAOnly && botResult.BotName != "查询超时" && botResult.BotName != "查询失败" {
+			//如果是正常爬虫，也保存结果（排除只按 UA 识别、查询超时和查询失败的情况）
 			global.GCACHE_WAFCACHE.SetWithTTl(enums.CACHE_DNS_BOT_IP+weblogbean.SRC_IP, botResult, time.Duration(global.GCONFIG_RECORD_DNS_BOT_EXPIRE_HOURS)*time.Hour)
 		}
+		//正常爬虫按网站的爬虫策略放行/拦截/限速
+		result = applySpiderPolicy(result, botResult, r, hostTarget, globalHostTarget)
 
 	} else {
 		//如果不是bot 加入到正常cache里面
@@ -75,3 +82,111 @@ func (waf *WafEngine) CheckBot(r *http.Request, weblogbean *innerbean.WebLog, fo
 
 	return result
 }
+
+// buildSpiderLimiter 网站加载时按爬虫策略的每分钟上限建限速计数器，配置变更随网站重新加载整体替换
+func buildSpiderLimiter(spiderPolicyJSON string) *webplugin.IPRateLimiter {
+	cfg := model.ParseSpiderPolicyConfig(spiderPolicyJSON)
+	if cfg.IsEnable != 1 {
+		return nil
+	}
+	return webplugin.NewIPRateLimiter(rate.Limit(float64(cfg.LimitPerMinute)/60), cfg.LimitPerMinute)
+}
+
+// resolveSpiderPolicy 取生效的爬虫策略：网站未开启时用全局网站的策略，同时返回策略所属的网站(限速计数挂在它上面)
+func resolveSpiderPolicy(hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) (model.SpiderPolicyConfig, *wafenginmodel.HostSafe) {
+	cfg := model.ParseSpiderPolicyConfig(hostTarget.Host.SpiderPolicyJSON)
+	owner := hostTarget
+	if cfg.IsEnable != 1 && globalHostTarget != nil {
+		cfg = model.ParseSpiderPolicyConfig(globalHostTarget.Host.SpiderPolicyJSON)
+		owner = globalHostTarget
+	}
+	return cfg, owner
+}
+
+// applySpiderPolicy 按爬虫类别执行网站的爬虫策略；放行的爬虫再按源站 robots.txt 的 Disallow 检查
+func applySpiderPolicy(result detection.Result, botResult wafbot.BotResult, r *http.Request, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	cfg, owner := resolveSpiderPolicy(hostTarget, globalHostTarget)
+	if cfg.IsEnable != 1 {
+		return result
+	}
+	switch cfg.Categories[botResult.Category] {
+	case model.SpiderPolicyDeny:
+		return spiderPolicyBlock(result, cfg, false, botResult.BotName)
+	case model.SpiderPolicyLimit:
+		if owner.SpiderLimiter != nil && !owner.SpiderLimiter.Allow(botResult.BotName) {
+			return spiderPolicyBlock(result, cfg, true, botResult.BotName)
+		}
+	}
+	// robots.txt 本身总是放行，源站还没返回过 robots.txt 时不限制
+	if cfg.EnforceRobots == 1 && r.URL.Path != "/robots.txt" {
+		if !hostRobots(hostTarget.Host.Code).Allowed(r.UserAgent(), r.URL.RequestURI()) {
+			return spiderPolicyBlock(result, cfg, false, botResult.BotName+"(robots.txt禁止)")
+		}
+	}
+	return result
+}
+
+// spiderPolicyBlock 拦截默认 403(crawler_policy)；限速超限或配置了 deny_status=429 时返回 429 + Retry-After(crawler_throttle)
+func spiderPolicyBlock(result detection.Result, cfg model.SpiderPolicyConfig, throttle bool, name string) detection.Result {
+	result.IsBlock = true
+	if throttle || cfg.DenyStatus == http.StatusTooManyRequests {
+		result.Title = "爬虫策略限流:" + name
+		result.Content = "访问过于频繁，请稍后再试"
+		result.RetryAfter = cfg.RetryAfter
+		return result
+	}
+	result.Title = "爬虫策略拦截:" + name
+	result.Content = "请正确访问"
+	return result
+}
+
+// robotsEntry 解析过的 robots.txt。原文放在全局缓存里(带过期时间，Redis 模式下多节点共享)，
+// 解析结果按原文在本进程复用，原文变了才重新解析
+type robotsEntry struct {
+	content string
+	robots  *wafbot.Robots
+}
+
+var robotsParsed sync.Map
+
+// hostRobots 网站当前缓存的 robots.txt，没有时返回 nil(全部允许)
+func hostRobots(hostCode string) *wafbot.Robots {
+	content, err := global.GCACHE_WAFCACHE.GetString(enums.CACHE_ROBOTS_PRE + hostCode)
+	if err != nil {
+		return nil
+	}
+	if v, ok := robotsParsed.Load(hostCode); ok && v.(*robotsEntry).content == content {
+		return v.(*robotsEntry).robots
+	}
+	robots := wafbot.ParseRobots(content)
+	robotsParsed.Store(hostCode, &robotsEntry{content: content, robots: robots})
+	return robots
+}
+
+// captureRobots 响应阶段：源站返回的 robots.txt 缓存下来。
+// 不主动回源抓取，访客或爬虫请求 /robots.txt 时顺带记录；4xx 视为没有限制，5xx 等保留原缓存
+func captureRobots(r *http.Request, resp *http.Response, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) {
+	if hostTarget == nil || r.Method != http.MethodGet || r.URL.Path != "/robots.txt" {
+		return
+	}
+	cfg, _ := resolveSpiderPolicy(hostTarget, globalHostTarget)
+	if cfg.IsEnable != 1 || cfg.EnforceRobots != 1 {
+		return
+	}
+	ttl := time.Duration(cfg.RobotsCacheMinutes) * time.Minute
+	key := enums.CACHE_ROBOTS_PRE + hostTarget.Host.Code
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if resp.ContentLength > wafbot.RobotsMaxBytes {
+			return
+		}
+		// chunked 响应 ContentLength 为 -1，仍要限量读取，压缩前后都不超过上限
+		body, err := readDecompressedBodyLimit(resp, wafbot.RobotsMaxBytes)
+		if err != nil {
+			return
+		}
+		global.GCACHE_WAFCACHE.SetWithTTl(key, string(body), ttl)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		global.GCACHE_WAFCACHE.SetWithTTl(key, "", ttl)
+	}
+}
@@ -0,0 +1,99 @@
+package wafenginecore
+
+import (
+	"SamWaf/cache"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafbot"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplySpiderPolicy(t *testing.T) {
+	host := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "spider-policy",
+		SpiderPolicyJSON: `{"is_enable":1,"categories":{"ai":"deny","seo":"limit"},"limit_per_minute":2}`}}
+	host.SpiderLimiter = buildSpiderLimiter(host.Host.SpiderPolicyJSON)
+	globalHost := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "spider-global"}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	ai := wafbot.BotResult{IsBot: true, IsNormalBot: true, BotName: "OpenAI爬虫", Category: model.SpiderBotCategoryAI}
+	if res := applySpiderPolicy(detection.Result{}, ai, req, host, globalHost); !res.IsBlock {
+		t.Fatalf("ai 类别配置为拦截")
+	}
+	search := wafbot.BotResult{IsBot: true, IsNormalBot: true, BotName: "百度爬虫", Category: model.SpiderBotCategorySearch}
+	if res := applySpiderPolicy(detection.Result{}, search, req, host, globalHost); res.IsBlock {
+		t.Fatalf("未配置的类别应放行")
+	}
+	seo := wafbot.BotResult{IsBot: true, IsNormalBot: true, BotName: "Ahrefs爬虫", Category: model.SpiderBotCategorySEO}
+	for i := 0; i < 2; i++ {
+		if res := applySpiderPolicy(detection.Result{}, seo, req, host, globalHost); res.IsBlock {
+			t.Fatalf("第 %d 次未超过限速", i+1)
+		}
+	}
+	if res := applySpiderPolicy(detection.Result{}, seo, req, host, globalHost); !res.IsBlock || res.RetryAfter != 60 ||
+		inferAttackType(res.Title) != "crawler_throttle" {
+		t.Fatalf("超过每分钟上限应按 429 限流拦截: %+v", res)
+	}
+	// 重新加载网站时计数器随之重建，旧计数不再保留
+	host.SpiderLimiter = buildSpiderLimiter(host.Host.SpiderPolicyJSON)
+	if res := applySpiderPolicy(detection.Result{}, seo, req, host, globalHost); res.IsBlock {
+		t.Fatalf("重新加载后应重新计数: %+v", res)
+	}
+
+	// 网站未开启时沿用全局网站的策略
+	globalHost.Host.SpiderPolicyJSON = `{"is_enable":1,"categories":{"search":"deny"}}`
+	other := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "spider-other"}}
+	if res := applySpiderPolicy(detection.Result{}, search, req, other, globalHost); !res.IsBlock {
+		t.Fatalf("应沿用全局网站的爬虫策略")
+	}
+}
+
+func TestSpiderPolicyRobots(t *testing.T) {
+	global.GCACHE_WAFCACHE = cache.InitWafCache()
+	host := &wafenginmodel.HostSafe{Host: model.Hosts{Code: "spider-robots",
+		SpiderPolicyJSON: `{"is_enable":1,"categories":{"search":"allow"},"enforce_robots":1}`}}
+	bot := wafbot.BotResult{IsBot: true, IsNormalBot: true, BotName: "百度爬虫", Category: model.SpiderBotCategorySearch}
+	get := func(path string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Baiduspider/2.0)")
+		return r
+	}
+
+	// 还没抓到 robots.txt 时不限制
+	if res := applySpiderPolicy(detection.Result{}, bot, get("/private/a"), host, nil); res.IsBlock {
+		t.Fatalf("没有 robots.txt 缓存时应放行")
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{},
+		Body: io.NopCloser(strings.NewReader("User-agent: *\nDisallow: /private/\n"))}
+	captureRobots(get("/robots.txt"), resp, host, nil)
+
+	res := applySpiderPolicy(detection.Result{}, bot, get("/private/a"), host, nil)
+	if !res.IsBlock || inferAttackType(res.Title) != "crawler_policy" {
+		t.Fatalf("robots.txt 禁止的路径应按 403 拦截: %+v", res)
+	}
+	if res := applySpiderPolicy(detection.Result{}, bot, get("/public"), host, nil); res.IsBlock {
+		t.Fatalf("robots.txt 未禁止的路径应放行")
+	}
+
+	// 源站 robots.txt 不存在视为全部允许
+	captureRobots(get("/robots.txt"), &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: http.NoBody}, host, nil)
+	if res := applySpiderPolicy(detection.Result{}, bot, get("/private/a"), host, nil); res.IsBlock {
+		t.Fatalf("robots.txt 404 后应全部放行")
+	}
+	// chunked 超大响应不缓存(沿用 404 时的放行)，正文原样留给下游
+	big := "User-agent: *\nDisallow: /\n" + strings.Repeat("#", wafbot.RobotsMaxBytes)
+	resp = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, ContentLength: -1,
+		Body: io.NopCloser(strings.NewReader(big))}
+	captureRobots(get("/robots.txt"), resp, host, nil)
+	if res := applySpiderPolicy(detection.Result{}, bot, get("/private/a"), host, nil); res.IsBlock {
+		t.Fatalf("超出大小上限的 robots.txt 不应缓存")
+	}
+	if rest, _ := io.ReadAll(resp.Body); len(rest) != len(big) {
+		t.Fatalf("超限时正文应完整保留: %d", len(rest))
+	}
+}
@@ -26,6 +26,10 @@ func (waf *WafEngine) CheckCC(r *http.Request, weblogbean *innerbean.WebLog, for
 	}
 	// 根据IP模式选择使用的IP（从 Host 级别读取）
 	clientIP := model.GetClientIPByMode(hostTarget.Host.IPMode, weblogbean.NetSrcIp, weblogbean.SRC_IP)
+	// 按自定义键限流 (局部检测)
+	if checkCCKeyed(&result, r, weblogbean, clientIP, hostTarget.CCKeyedLimiters, "【局部】") {
+		return result
+	}
 	// cc 防护 (局部检测)
 	if hostTarget.PluginIpRateLimiter != nil {
 		isCheckCC := false
@@ -47,12 +51,8 @@ func (waf *WafEngine) CheckCC(r *http.Request, weblogbean *innerbean.WebLog, for
 		if isCheckCC {
 			if !hostTarget.PluginIpRateLimiter.Allow(clientIP) {
 				weblogbean.RISK_LEVEL = 1
-				result.IsBlock = true
 				result.Title = "【局部】触发IP频次访问限制"
-				result.Content = "您的访问被阻止超量了"
-				cacheKey := enums.CACHE_CCVISITBAN_PRE + clientIP
-				//将该IP添加到封禁里
-				global.GCACHE_WAFCACHE.SetWithTTl(cacheKey, hostTarget.AntiCCBean.LockIPMinutes, time.Duration(hostTarget.AntiCCBean.LockIPMinutes)*time.Minute)
+				ccOverLimit(&result, weblogbean, clientIP, hostTarget.AntiCCBean)
 				return result
 			}
 			// 局部CC已检测且未封禁，若配置了跳过全局CC则直接返回
@@ -70,14 +70,45 @@ func (waf *WafEngine) CheckCC(r *http.Request, weblogbean *innerbean.WebLog, for
 	if globalHost != nil && globalHost.Host.GUARD_STATUS == 1 && globalHost.PluginIpRateLimiter != nil {
 		if !globalHost.PluginIpRateLimiter.Allow(clientIP) {
 			weblogbean.RISK_LEVEL = 1
-			result.IsBlock = true
 			result.Title = "【全局】触发IP频次访问限制"
-			result.Content = "您的访问被阻止超量了"
-			cacheKey := enums.CACHE_CCVISITBAN_PRE + clientIP
-			//将该IP添加到封禁里
-			global.GCACHE_WAFCACHE.SetWithTTl(cacheKey, globalHost.AntiCCBean.LockIPMinutes, time.Duration(globalHost.AntiCCBean.LockIPMinutes)*time.Minute)
+			ccOverLimit(&result, weblogbean, clientIP, globalHost.AntiCCBean)
 			return result
 		}
 	}
+	if globalHost != nil && globalHost != hostTarget && globalHost.Host.GUARD_STATUS == 1 &&
+		checkCCKeyed(&result, r, weblogbean, clientIP, globalHost.CCKeyedLimiters, "【全局】") {
+		return result
+	}
 	return result
 }
+
+// ccOverLimit IP限流超限处理
+func ccOverLimit(result *detection.Result, weblog *innerbean.WebLog, clientIP string, antiCC model.AntiCC) {
+	ccHandleOverLimit(result, weblog, clientIP, antiCC, clientIP, antiCC.HostCode, func() {
+		ccBanIP(result, clientIP, antiCC)
+	})
+}
+
+// ccHandleOverLimit 超限处理：开启逐级处置时按超限次数挑战/减速/封禁；
+// 否则挑战动作只要求访客通过浏览器挑战，不封禁；默认调用 ban 封禁
+func ccHandleOverLimit(result *detection.Result, weblog *innerbean.WebLog, clientIP string, antiCC model.AntiCC, subject string, scope string, ban func()) {
+	if escalation := model.ParseCCEscalationConfig(antiCC.Escalation); escalation.IsEnable == 1 {
+		ccEscalate(result, weblog, clientIP, subject, scope, escalation, ban)
+		return
+	}
+	if antiCC.Action == model.CCActionChallenge {
+		result.IsChallenge = true
+		result.Content = "请先完成浏览器验证"
+		return
+	}
+	ban()
+}
+
+// ccBanIP 封禁IP LockIPMinutes 分钟
+func ccBanIP(result *detection.Result, clientIP string, antiCC model.AntiCC) {
+	result.IsBlock = true
+	result.Content = "您的访问被阻止超量了"
+	cacheKey := enums.CACHE_CCVISITBAN_PRE + clientIP
+	//将该IP添加到封禁里
+	global.GCACHE_WAFCACHE.SetWithTTl(cacheKey, antiCC.LockIPMinutes, time.Duration(antiCC.LockIPMinutes)*time.Minute)
+}
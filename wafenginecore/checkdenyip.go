@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 /*
@@ -76,8 +77,9 @@ func matchDenyIP(clientIp string, parsedIp net.IP, index *ipset.MatchSet, groupC
 	} else {
 		// 旧路径回退。用 MatchIPPattern 而非 CheckIPInCIDR，否则通配符与区间在这条路径上会失效。
 		// 组引用行的 Ip 字段为空，跳过，交由下面的组快照统一判定。
+		now := time.Now().Unix()
 		for i := 0; i < len(list); i++ {
-			if list[i].IpType == model.IPEntryTypeGroup {
+			if list[i].IpType == model.IPEntryTypeGroup || model.ListEntryExpired(list[i].ExpireTime, now) {
 				continue
 			}
 			if utils.MatchIPPattern(clientIp, list[i].Ip) {
@@ -3,11 +3,13 @@ package wafenginecore
 import (
 	"SamWaf/global"
 	"SamWaf/innerbean"
+	"SamWaf/model"
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 /*
@@ -25,10 +27,15 @@ func (waf *WafEngine) CheckDenyURL(r *http.Request, weblogbean *innerbean.WebLog
 
 	// 将请求URL转为小写，用于不区分大小写的比较
 	lowerURL := strings.ToLower(weblogbean.URL)
+	// 临时条目到期后到定时任务清理前的这段时间里，直接跳过
+	now := time.Now().Unix()
 
 	//url黑名单策略-(局部)
 	if hostTarget.UrlBlockLists != nil {
 		for i := 0; i < len(hostTarget.UrlBlockLists); i++ {
+			if model.ListEntryExpired(hostTarget.UrlBlockLists[i].ExpireTime, now) {
+				continue
+			}
 			// 将规则URL也转为小写
 			lowerRuleURL := strings.ToLower(hostTarget.UrlBlockLists[i].Url)
 
@@ -50,6 +57,9 @@ func (waf *WafEngine) CheckDenyURL(r *http.Request, weblogbean *innerbean.WebLog
 	globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
 	if globalHost != nil && globalHost.Host.GUARD_STATUS == 1 && globalHost.UrlBlockLists != nil {
 		for i := 0; i < len(globalHost.UrlBlockLists); i++ {
+			if model.ListEntryExpired(globalHost.UrlBlockLists[i].ExpireTime, now) {
+				continue
+			}
 			// 将全局规则URL也转为小写
 			lowerGlobalRuleURL := strings.ToLower(globalHost.UrlBlockLists[i].Url)
 
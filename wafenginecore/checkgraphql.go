@@ -0,0 +1,111 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wafargs"
+	"SamWaf/wafenginecore/wafgraphql"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+*
+GraphQL 防护
+
+GraphQL 接口只有一个地址，URL 黑名单、CC 和内置检测分不清便宜的查询和拖垮后端的查询。
+对站点配置的 GraphQL 路径解析查询，限制深度、别名数、批量条数和复杂度预算，可禁止自省、只放行持久化查询白名单。
+解析在请求进入检测前完成(prepareGraphQL)，操作名和复杂度记入日志，自定义规则和 CC 按键限流都能用；
+检测阶段(CheckGraphQL)只按解析结果拦截。
+*/
+
+// prepareGraphQL 解析 GraphQL 请求，记下操作名和复杂度；不通过的原因留给检测阶段
+func prepareGraphQL(r *http.Request, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	cfg := model.ParseGraphQLConfig(hostTarget.Host.GraphQLJSON)
+	if cfg.IsEnable != 1 || !cfg.MatchPath(r.URL.Path) {
+		return
+	}
+	if strings.ToLower(r.Header.Get("Upgrade")) == "websocket" {
+		return
+	}
+	body := weblogbean.SrcByteBody
+	if len(body) == 0 && r.Method != http.MethodGet {
+		var tooLarge bool
+		body, tooLarge = readGraphQLBody(r)
+		if tooLarge {
+			// 读不全就判断不了，按无法解析处理，不给超大请求体绕过的机会
+			weblogbean.GraphQLViolation = wafgraphql.ViolationParse + ":请求体超过检查上限"
+			return
+		}
+	}
+	reqs, _, err := wafgraphql.ParseRequest(r.Method, r.Header.Get("Content-Type"), r.URL.Query(), body)
+	if err != nil {
+		weblogbean.GraphQLViolation = wafgraphql.ViolationParse + ":" + err.Error()
+		return
+	}
+	if len(reqs) == 0 {
+		return
+	}
+	limits := wafgraphql.Limits{
+		MaxDepth:             cfg.MaxDepth,
+		MaxAliases:           cfg.MaxAliases,
+		MaxBatch:             cfg.MaxBatch,
+		MaxCost:              cfg.MaxCost,
+		DisableIntrospection: cfg.DisableIntrospection == 1,
+	}
+	if cfg.PersistedOnly == 1 {
+		limits.Allowlist = wafgraphql.ParseAllowlist(cfg.PersistedHashes)
+	}
+	res := wafgraphql.Inspect(reqs, limits)
+	weblogbean.GRAPHQL_OPERATION = strings.Join(res.Operations, ",")
+	weblogbean.GRAPHQL_COST = res.Cost
+	if res.Violation != "" {
+		weblogbean.GraphQLViolation = res.Violation + ":" + res.Detail
+	}
+}
+
+// readGraphQLBody 日志没记录请求体(chunked、超过记录上限、压缩)时单独读取，读完原样接回去
+func readGraphQLBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	if r.Header.Get("Content-Encoding") != "" {
+		return nil, true
+	}
+	raw, _ := io.ReadAll(io.LimitReader(r.Body, wafargs.MaxInspectBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(raw), r.Body))
+	if len(raw) > wafargs.MaxInspectBody {
+		return nil, true
+	}
+	return raw, false
+}
+
+// CheckGraphQL 按 prepareGraphQL 的结果拦截；站点配置为只记录时不拦截
+func (waf *WafEngine) CheckGraphQL(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{
+		JumpGuardResult: false,
+		IsBlock:         false,
+		Title:           "",
+		Content:         "",
+	}
+	if weblogbean.GraphQLViolation == "" {
+		return result
+	}
+	kind, detail, _ := strings.Cut(weblogbean.GraphQLViolation, ":")
+	title := "GraphQL防护:" + kind
+	if model.ParseGraphQLConfig(hostTarget.Host.GraphQLJSON).LogOnly == 1 {
+		weblogbean.RULE = title
+		weblogbean.LogOnlyMode = 1
+		return result
+	}
+	weblogbean.RISK_LEVEL = 1
+	result.IsBlock = true
+	result.Title = title
+	result.Content = detail
+	return result
+}
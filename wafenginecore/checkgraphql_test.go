@@ -0,0 +1,75 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newGraphQLTestHost(cfg string) *wafenginmodel.HostSafe {
+	return &wafenginmodel.HostSafe{Host: model.Hosts{Code: "gql-host", GraphQLJSON: cfg}}
+}
+
+func graphQLRequest(body string) (*http.Request, *innerbean.WebLog) {
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r, &innerbean.WebLog{SrcByteBody: []byte(body)}
+}
+
+func TestCheckGraphQL(t *testing.T) {
+	waf := &WafEngine{}
+	host := newGraphQLTestHost(`{"is_enable":1,"max_depth":3,"disable_introspection":1}`)
+
+	r, weblog := graphQLRequest(`{"query":"query GetUser { user { name } }","operationName":"GetUser"}`)
+	prepareGraphQL(r, weblog, host)
+	if weblog.GRAPHQL_OPERATION != "GetUser" || weblog.GRAPHQL_COST != 2 {
+		t.Fatalf("操作名/复杂度不对: %q %d", weblog.GRAPHQL_OPERATION, weblog.GRAPHQL_COST)
+	}
+	if res := waf.CheckGraphQL(r, weblog, nil, host, nil); res.IsBlock {
+		t.Fatalf("正常查询不应拦截: %+v", res)
+	}
+
+	r, weblog = graphQLRequest(`{"query":"{ a { b { c { d } } } }"}`)
+	prepareGraphQL(r, weblog, host)
+	res := waf.CheckGraphQL(r, weblog, nil, host, nil)
+	if !res.IsBlock || res.Title != "GraphQL防护:深度超限" || inferAttackType(res.Title) != "graphql_abuse" {
+		t.Fatalf("超深查询应拦截: %+v", res)
+	}
+
+	// 只记录模式
+	logHost := newGraphQLTestHost(`{"is_enable":1,"disable_introspection":1,"log_only":1}`)
+	r, weblog = graphQLRequest(`{"query":"{ __schema { types { name } } }"}`)
+	prepareGraphQL(r, weblog, logHost)
+	if res := waf.CheckGraphQL(r, weblog, nil, logHost, nil); res.IsBlock || weblog.LogOnlyMode != 1 || weblog.RULE != "GraphQL防护:禁止自省" {
+		t.Fatalf("只记录模式不应拦截: %+v %q", res, weblog.RULE)
+	}
+
+	// 不是配置的路径不处理
+	r = httptest.NewRequest(http.MethodPost, "http://g.com/api", strings.NewReader(`{"query":"{ a { b { c { d } } } }"}`))
+	weblog = &innerbean.WebLog{}
+	prepareGraphQL(r, weblog, host)
+	if weblog.GraphQLViolation != "" {
+		t.Fatal("非 GraphQL 路径不应检查")
+	}
+}
+
+// 日志没记录的请求体(chunked)单独读取检查，读完原样转发
+func TestPrepareGraphQLChunkedBody(t *testing.T) {
+	host := newGraphQLTestHost(`{"is_enable":1,"max_batch":1,"paths":"/api/graphql/"}`)
+	body := `[{"query":"{ a }"},{"query":"{ b }"}]`
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/api/graphql", io.NopCloser(strings.NewReader(body)))
+	r.ContentLength = -1
+	weblog := &innerbean.WebLog{}
+	prepareGraphQL(r, weblog, host)
+	if !strings.HasPrefix(weblog.GraphQLViolation, "批量超限") {
+		t.Fatalf("批量超限应检出: %q", weblog.GraphQLViolation)
+	}
+	if forwarded, _ := io.ReadAll(r.Body); string(forwarded) != body {
+		t.Fatalf("转发的请求体被改动: %q", forwarded)
+	}
+}
@@ -0,0 +1,153 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wafprotocol"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+/*
+*
+协议合规检测
+
+排在所有检测(含白名单)之前：请求头个数/大小、URI 长度、参数个数超限的一律拦截；
+请求走私和畸形请求按站点配置拦截，或归一后放行并记录。
+转发时请求由 net/http 重新组装，CL/TE 冲突、折行、裸换行在解析阶段已被抹平，不会原样到达后端，
+归一只需去掉 Handler 里仍看得见的违规头部。原始请求头只在明文 HTTP/1.x 端口上截取，见 wafprotocol。
+*/
+
+// h2ConnHeaders HTTP/2、HTTP/3 里不允许出现的连接级头部
+var h2ConnHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade"}
+
+// protocolIssue 一项协议异常；fix 为归一时要删掉的头部
+type protocolIssue struct {
+	kind   string
+	detail string
+	fix    []string
+}
+
+// CheckProtocol 协议合规检测
+func (waf *WafEngine) CheckProtocol(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{
+		JumpGuardResult: false,
+		IsBlock:         false,
+		Title:           "",
+		Content:         "",
+	}
+	cfg := model.ParseProtocolConfig(hostTarget.Host.ProtocolJSON)
+	if issue := checkProtocolLimits(r, formValue, cfg); issue != nil {
+		weblogbean.RISK_LEVEL = 1
+		result.IsBlock = true
+		result.Title = "协议异常:" + issue.kind
+		result.Content = issue.detail
+		return result
+	}
+	issues := checkProtocolAnomalies(r, wafprotocol.HeadFor(r))
+	if len(issues) == 0 {
+		return result
+	}
+	title := "协议异常:" + issues[0].kind
+	details := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		details = append(details, issue.detail)
+	}
+	if cfg.Mode == model.ProtocolModeNormalize {
+		for _, issue := range issues {
+			for _, name := range issue.fix {
+				delete(r.Header, name)
+			}
+		}
+		weblogbean.RULE = title
+		return result
+	}
+	weblogbean.RISK_LEVEL = 2
+	if wafprotocol.IsSmuggling(issues[0].kind) {
+		weblogbean.RISK_LEVEL = 3
+	}
+	result.IsBlock = true
+	result.Title = title
+	result.Content = strings.Join(details, "；")
+	return result
+}
+
+// checkProtocolLimits 请求头个数/大小、URI 长度、参数个数
+func checkProtocolLimits(r *http.Request, formValue url.Values, cfg model.ProtocolConfig) *protocolIssue {
+	if n := len(r.RequestURI); n > cfg.MaxURILength {
+		return &protocolIssue{kind: wafprotocol.AnomalyURILength, detail: fmt.Sprintf("请求地址 %d 字节，上限 %d", n, cfg.MaxURILength)}
+	}
+	// HTTP/1.x 的 Host 头被 net/http 挪到了 r.Host，这里补算上
+	count, size := 1, len("Host: \r\n")+len(r.Host)
+	for name, values := range r.Header {
+		count += len(values)
+		for _, v := range values {
+			size += len(name) + len(v) + len(": \r\n")
+		}
+	}
+	if count > cfg.MaxHeaderCount {
+		return &protocolIssue{kind: wafprotocol.AnomalyHeaderCount, detail: fmt.Sprintf("请求头 %d 个，上限 %d", count, cfg.MaxHeaderCount)}
+	}
+	if size > cfg.MaxHeaderSize {
+		return &protocolIssue{kind: wafprotocol.AnomalyHeaderSize, detail: fmt.Sprintf("请求头 %d 字节，上限 %d", size, cfg.MaxHeaderSize)}
+	}
+	args := strings.Count(r.URL.RawQuery, "&")
+	if r.URL.RawQuery != "" {
+		args++
+	}
+	for _, values := range formValue {
+		args += len(values)
+	}
+	if args > cfg.MaxArgCount {
+		return &protocolIssue{kind: wafprotocol.AnomalyArgCount, detail: fmt.Sprintf("参数 %d 个，上限 %d", args, cfg.MaxArgCount)}
+	}
+	return nil
+}
+
+// checkProtocolAnomalies 原始请求头里的走私痕迹、头部非法字符、HTTP/2 头部违规
+func checkProtocolAnomalies(r *http.Request, head *wafprotocol.Head) []protocolIssue {
+	var issues []protocolIssue
+	if head != nil {
+		for _, a := range head.Anomalies {
+			issues = append(issues, protocolIssue{kind: a, detail: "原始请求头" + a})
+		}
+	}
+	if r.ProtoMajor >= 2 {
+		if hosts := r.Header.Values("Host"); len(hosts) > 1 {
+			issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyDupHost, detail: fmt.Sprintf("%d 个 Host 头", len(hosts)), fix: []string{"Host"}})
+		} else if len(hosts) == 1 && !strings.EqualFold(hosts[0], r.Host) {
+			issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyH2Header, detail: "Host 头与 :authority 不一致", fix: []string{"Host"}})
+		}
+		for _, name := range h2ConnHeaders {
+			if _, ok := r.Header[name]; ok {
+				issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyH2Header, detail: "出现连接级头部 " + name, fix: []string{name}})
+			}
+		}
+		if te := r.Header.Values("Te"); len(te) > 0 && (len(te) > 1 || !strings.EqualFold(te[0], "trailers")) {
+			issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyH2Header, detail: "TE 头只能是 trailers", fix: []string{"Te"}})
+		}
+	}
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, ":") {
+			issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyH2Header, detail: "普通头部里出现伪头部 " + name, fix: []string{name}})
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(name) {
+			issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyBadChar, detail: fmt.Sprintf("头名 %q 含非法字符", name), fix: []string{name}})
+			continue
+		}
+		for _, v := range values {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				issues = append(issues, protocolIssue{kind: wafprotocol.AnomalyBadChar, detail: "头部 " + name + " 的值含控制字符", fix: []string{name}})
+				break
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,111 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newProtocolTestHost(cfg string) *wafenginmodel.HostSafe {
+	return &wafenginmodel.HostSafe{Host: model.Hosts{Code: "proto-host", ProtocolJSON: cfg}}
+}
+
+func TestCheckProtocolLimits(t *testing.T) {
+	waf := &WafEngine{}
+	host := newProtocolTestHost(`{"max_header_count":5,"max_uri_length":64,"max_arg_count":3}`)
+
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/x?a=1&b=2", nil)
+	if res := waf.CheckProtocol(r, &innerbean.WebLog{}, nil, host, nil); res.IsBlock {
+		t.Fatalf("正常请求不应拦截: %+v", res)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://a.com/"+strings.Repeat("a", 64), nil)
+	res := waf.CheckProtocol(r, &innerbean.WebLog{}, nil, host, nil)
+	if !res.IsBlock || res.Title != "协议异常:URI过长" || inferAttackType(res.Title) != "protocol_anomaly" {
+		t.Fatalf("超长地址应拦截: %+v", res)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://a.com/x", nil)
+	for i := 0; i < 5; i++ {
+		r.Header.Set("X-H"+strconv.Itoa(i), "1")
+	}
+	if res = waf.CheckProtocol(r, &innerbean.WebLog{}, nil, host, nil); res.Title != "协议异常:头部数量超限" {
+		t.Fatalf("头部过多应拦截: %+v", res)
+	}
+
+	// 查询串与表单参数合计
+	r = httptest.NewRequest(http.MethodPost, "http://a.com/x?a=1&b=2", nil)
+	if res = waf.CheckProtocol(r, &innerbean.WebLog{}, url.Values{"c": {"1", "2"}}, host, nil); res.Title != "协议异常:参数数量超限" {
+		t.Fatalf("参数过多应拦截: %+v", res)
+	}
+
+	// 超限在归一模式下也拦截
+	host = newProtocolTestHost(`{"mode":"normalize","max_header_size":100}`)
+	r = httptest.NewRequest(http.MethodGet, "http://a.com/x", nil)
+	r.Header.Set("Cookie", strings.Repeat("c", 100))
+	if res = waf.CheckProtocol(r, &innerbean.WebLog{}, nil, host, nil); res.Title != "协议异常:头部过大" {
+		t.Fatalf("头部过大应拦截: %+v", res)
+	}
+}
+
+func TestCheckProtocolHTTP2(t *testing.T) {
+	waf := &WafEngine{}
+	h2Request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "https://a.com/x", nil)
+		r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+		r.Header.Set("Host", "b.com")
+		r.Header.Set("Connection", "keep-alive")
+		return r
+	}
+
+	res := waf.CheckProtocol(h2Request(), &innerbean.WebLog{}, nil, newProtocolTestHost(""), nil)
+	if !res.IsBlock || res.Title != "协议异常:HTTP/2头部违规" || !strings.Contains(res.Content, ":authority") || !strings.Contains(res.Content, "Connection") {
+		t.Fatalf("HTTP/2 头部违规应拦截: %+v", res)
+	}
+
+	// 归一：删掉违规头部后放行，命中记入日志
+	r := h2Request()
+	weblog := &innerbean.WebLog{}
+	res = waf.CheckProtocol(r, weblog, nil, newProtocolTestHost(`{"mode":"normalize"}`), nil)
+	if res.IsBlock || weblog.RULE != "协议异常:HTTP/2头部违规" {
+		t.Fatalf("归一模式应放行并记录: %+v %q", res, weblog.RULE)
+	}
+	if r.Header.Get("Host") != "" || r.Header.Get("Connection") != "" {
+		t.Fatalf("违规头部应被删掉: %v", r.Header)
+	}
+
+	// HTTP/1.x 里这些头部是正常的
+	r = httptest.NewRequest(http.MethodGet, "http://a.com/x", nil)
+	r.Header.Set("Connection", "keep-alive")
+	if res = waf.CheckProtocol(r, &innerbean.WebLog{}, nil, newProtocolTestHost(""), nil); res.IsBlock {
+		t.Fatalf("HTTP/1.1 不应拦截: %+v", res)
+	}
+}
+
+func TestCheckProtocolBadChar(t *testing.T) {
+	waf := &WafEngine{}
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/x", nil)
+	r.Header["X-Bad"] = []string{"a\x00b"}
+	res := waf.CheckProtocol(r, &innerbean.WebLog{}, nil, newProtocolTestHost(""), nil)
+	if !res.IsBlock || res.Title != "协议异常:头部非法字符" {
+		t.Fatalf("控制字符应拦截: %+v", res)
+	}
+}
+
+func TestInferAttackTypeProtocol(t *testing.T) {
+	if got := inferAttackType("协议异常:CL与TE并存"); got != "request_smuggling" {
+		t.Fatalf("CL/TE 冲突应归为请求走私: %s", got)
+	}
+	if got := inferAttackType("协议异常:HTTP/1.0携带Transfer-Encoding"); got != "request_smuggling" {
+		t.Fatalf("HTTP/1.0 带 TE 应归为请求走私: %s", got)
+	}
+	if got := inferAttackType("协议异常:头部非法字符"); got != "protocol_anomaly" {
+		t.Fatalf("非法字符应归为协议异常: %s", got)
+	}
+}
@@ -2,6 +2,7 @@ package wafenginecore
 
 import (
 	"SamWaf/innerbean"
+	"SamWaf/model"
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/wafdefenserce"
@@ -20,19 +21,19 @@ func (waf *WafEngine) CheckRce(r *http.Request, weblogbean *innerbean.WebLog, fo
 		Title:           "",
 		Content:         "",
 	}
-	// 查询串已多轮解码；再逐个查已解码的表单值
-	isRce, RceName := wafdefenserce.DetermineRCE(weblogbean.RawQuery, weblogbean.URL, weblogbean.COOKIES, weblogbean.BODY)
+	// 先查路径，再逐个查已解码的参数值
+	isRce, RceName := false, ""
+	if r != nil && r.URL != nil {
+		isRce, RceName = wafdefenserce.DetermineRCE(r.URL.Path)
+	}
 	if isRce == false {
-		for _, values := range formValue {
-			for _, v := range values {
-				if ok, name := wafdefenserce.DetermineRCE(v); ok {
-					isRce, RceName = ok, name
-					break
-				}
-			}
-			if isRce {
-				break
-			}
+		if arg, ok := matchReqArg(detectArgs(r, weblogbean, hostTarget, globalHostTarget, model.DetectExclusionRCE), true, func(v string) bool {
+			hit, name := wafdefenserce.DetermineRCE(v)
+			RceName = name
+			return hit
+		}); ok {
+			isRce = true
+			weblogbean.MATCH_ARG = arg.Label()
 		}
 	}
 	if isRce == true {
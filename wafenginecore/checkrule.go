@@ -34,10 +34,18 @@ func parseIPFailureThreshold(ruleText string) (int64, int64, bool) {
 	return 0, 0, false
 }
 
+// ruleActionRank 同优先级规则之间动作的强弱
+var ruleActionRank = map[string]int{
+	utils.RuleActionDeny:      4,
+	utils.RuleActionChallenge: 3,
+	utils.RuleActionAllow:     2,
+	utils.RuleActionLog:       1,
+}
+
 // pickRuleAction 从命中的规则里挑出最终生效的动作
 // grule 的 FetchMatchingRules 已按 salience 降序返回，所以优先级最高的就是第一条。
 // 但同 salience 的规则之间顺序是不确定的（来自 map 遍历），所以在最高优先级这一档里
-// 按 拦截 > 放行 > 仅记录 取，保证结果稳定且偏安全。
+// 按 拦截 > 挑战 > 放行 > 仅记录 取，保证结果稳定且偏安全。
 // 多条放行规则的跳过模块取并集。
 func pickRuleAction(ruleHelper *utils.RuleHelper, ruleMatchs []*ast.RuleEntry) utils.RuleActionInfo {
 	if len(ruleMatchs) == 0 {
@@ -48,11 +56,7 @@ func pickRuleAction(ruleHelper *utils.RuleHelper, ruleMatchs []*ast.RuleEntry) u
 	final := utils.RuleActionInfo{Action: ""}
 	skipSet := make(map[string]bool)
 
-	rank := map[string]int{
-		utils.RuleActionDeny:  3,
-		utils.RuleActionAllow: 2,
-		utils.RuleActionLog:   1,
-	}
+	rank := ruleActionRank
 
 	for _, v := range ruleMatchs {
 		if v.Salience != topSalience {
@@ -123,6 +127,11 @@ type ruleMatchResult struct {
 
 // matchRules 执行一组规则并解析出动作
 func matchRules(ruleHelper *utils.RuleHelper, weblogbean *innerbean.WebLog, titlePrefix string) ruleMatchResult {
+	return matchRulesWith(ruleHelper, weblogbean, titlePrefix, nil)
+}
+
+// matchRulesWith 同 matchRules，keep 不为空时只保留它认可的命中规则参与判定
+func matchRulesWith(ruleHelper *utils.RuleHelper, weblogbean *innerbean.WebLog, titlePrefix string, keep func(*ast.RuleEntry) bool) ruleMatchResult {
 	out := ruleMatchResult{}
 	if ruleHelper == nil || ruleHelper.KnowledgeBase == nil {
 		return out
@@ -135,6 +144,15 @@ func matchRules(ruleHelper *utils.RuleHelper, weblogbean *innerbean.WebLog, titl
 	if weblogbean.GeoUnresolved {
 		ruleMatchs = dropGeoRules(ruleMatchs)
 	}
+	if keep != nil {
+		kept := ruleMatchs[:0:0]
+		for _, v := range ruleMatchs {
+			if keep(v) {
+				kept = append(kept, v)
+			}
+		}
+		ruleMatchs = kept
+	}
 	if len(ruleMatchs) == 0 {
 		return out
 	}
@@ -165,7 +183,7 @@ func matchRules(ruleHelper *utils.RuleHelper, weblogbean *innerbean.WebLog, titl
 //
 //	1. 只有一侧命中 → 用那一侧
 //	2. 两侧都命中 → salience 高的一侧胜出
-//	3. salience 相同 → 按 拦截 > 放行 > 仅记录 取，保证偏安全，也和历史行为一致
+//	3. salience 相同 → 按 拦截 > 挑战 > 放行 > 仅记录 取，保证偏安全，也和历史行为一致
 //	   （老配置站点和全局默认都是 salience 10，此时全局拦截依旧压过站点放行）
 //
 // 两侧同为放行且同优先级时，跳过模块取并集、Title 拼接。
@@ -185,11 +203,7 @@ func arbitrate(local, globalR ruleMatchResult) ruleMatchResult {
 	}
 
 	// 同优先级：按动作强弱兜底
-	rank := map[string]int{
-		utils.RuleActionDeny:  3,
-		utils.RuleActionAllow: 2,
-		utils.RuleActionLog:   1,
-	}
+	rank := ruleActionRank
 	if rank[local.Action.Action] > rank[globalR.Action.Action] {
 		return local
 	}
@@ -267,6 +281,11 @@ func (waf *WafEngine) CheckRule(r *http.Request, weblogbean *innerbean.WebLog, f
 		} else {
 			result.SkipModules = final.Action.SkipModules
 		}
+	case utils.RuleActionChallenge:
+		weblogbean.RISK_LEVEL = 1
+		result.IsChallenge = true
+		result.Title = final.Title
+		result.Content = "请先完成浏览器验证"
 	case utils.RuleActionLog:
 		weblogbean.RISK_LEVEL = 1
 		result.IsLogOnly = true
@@ -107,6 +107,31 @@ rule Rdeny "拦截" salience 10 {
 	}
 }
 
+// TestPickRuleAction_ChallengeRank 同级时挑战压过放行，但不压过拦截
+func TestPickRuleAction_ChallengeRank(t *testing.T) {
+	rh := buildRuleHelper(t, `
+rule Rallow "放行" salience 10 {
+    when MF.URL == "/x"
+    then RF.Allow();
+}
+rule Rchallenge "挑战" salience 10 {
+    when MF.URL == "/x" || MF.URL == "/y"
+    then RF.Challenge();
+}
+rule Rdeny "拦截" salience 10 {
+    when MF.URL == "/y"
+    then RF.Deny();
+}`)
+	matchs, _ := rh.Match("MF", &innerbean.WebLog{URL: "/x"})
+	if info := pickRuleAction(rh, matchs); info.Action != utils.RuleActionChallenge {
+		t.Fatalf("挑战与放行同级应取挑战, 实际 %s", info.Action)
+	}
+	matchs, _ = rh.Match("MF", &innerbean.WebLog{URL: "/y"})
+	if info := pickRuleAction(rh, matchs); info.Action != utils.RuleActionDeny {
+		t.Fatalf("挑战与拦截同级应取拦截, 实际 %s", info.Action)
+	}
+}
+
 // TestParseIPFailureThreshold_NotFooledByString 阈值解析不被字符串字面量干扰
 func TestParseIPFailureThreshold_NotFooledByString(t *testing.T) {
 	// 真实条件
@@ -51,13 +51,21 @@ func (waf *WafEngine) CheckSensitive(r *http.Request, weblogbean *innerbean.WebL
 
 		return result
 	}
-	matchBodyResult := waf.SensitiveManager.MultiPatternSearch([]rune(weblogbean.BODY), false)
-	if len(matchBodyResult) > 0 {
+	//逐个参数值检测（查询参数已随 URL 检测过）
+	for _, arg := range requestArgs(r, weblogbean) {
+		if arg.Source == innerbean.ReqArgSourceQuery || arg.IsName {
+			continue
+		}
+		matchBodyResult := waf.SensitiveManager.MultiPatternSearch([]rune(arg.Value), false)
+		if len(matchBodyResult) == 0 {
+			continue
+		}
 		sensitive := matchBodyResult[0].CustomData.(model.Sensitive)
 		if sensitive.CheckDirection == "out" {
 			return result
 		}
 		weblogbean.RISK_LEVEL = 1
+		weblogbean.MATCH_ARG = arg.Label()
 		if sensitive.Action == "deny" {
 			result.IsBlock = true
 			result.Title = "敏感词检测：" + string(matchBodyResult[0].Word)
@@ -67,7 +75,10 @@ func (waf *WafEngine) CheckSensitive(r *http.Request, weblogbean *innerbean.WebL
 			result.IsBlock = false
 			weblogbean.GUEST_IDENTIFICATION = "触发敏感词"
 			weblogbean.RULE = "敏感词检测：" + strings.Join(words, ",")
-			waf.ReplaceBodyContent(r, words, global.GWAF_HTTP_SENSITIVE_REPLACE_STRING)
+			//Cookie/请求头里的命中只记录，替换只作用于请求体
+			if arg.Source != innerbean.ReqArgSourceCookie && arg.Source != innerbean.ReqArgSourceHeader {
+				waf.ReplaceBodyContent(r, words, global.GWAF_HTTP_SENSITIVE_REPLACE_STRING)
+			}
 		}
 		return result
 	}
@@ -3,6 +3,7 @@ package wafenginecore
 import (
 	"SamWaf/innerbean"
 	"SamWaf/libinjection-go"
+	"SamWaf/model"
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"net/http"
@@ -20,23 +21,9 @@ func (waf *WafEngine) CheckSql(r *http.Request, weblogbean *innerbean.WebLog, fo
 		Title:           "",
 		Content:         "",
 	}
-	var sqlFlag = false
-	//检测sql注入
-	if libinjection.IsSQLiNotReturnPrint(weblogbean.RawQuery) ||
-		libinjection.IsSQLiNotReturnPrint(weblogbean.BODY) ||
-		libinjection.IsSQLiNotReturnPrint(weblogbean.POST_FORM) {
-		sqlFlag = true
-	}
-	if sqlFlag == false {
-		for _, value := range formValue {
-			for _, v := range value {
-				if libinjection.IsSQLiNotReturnPrint(v) {
-					sqlFlag = true
-				}
-			}
-		}
-	}
-	if sqlFlag == true {
+	//检测sql注入：逐个参数值（含查询/表单/JSON/XML/Cookie/部分请求头）
+	if arg, sqlFlag := matchReqArg(detectArgs(r, weblogbean, hostTarget, globalHostTarget, model.DetectExclusionSQLI), true, libinjection.IsSQLiNotReturnPrint); sqlFlag {
+		weblogbean.MATCH_ARG = arg.Label()
 		weblogbean.RISK_LEVEL = 2
 		result.IsBlock = true
 		result.Title = "SQL注入"
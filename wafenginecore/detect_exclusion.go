@@ -0,0 +1,107 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"net/http"
+	"strings"
+)
+
+// detectArgs 取给某个内置检测用的参数：去掉本网站和全局网站误报排除命中的参数，
+// 其余参数照常交给检测，不会因为一个参数误报就放过整条请求。
+func detectArgs(r *http.Request, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe, detector string) []innerbean.ReqArg {
+	args := requestArgs(r, weblogbean)
+	var exclusions []model.DetectExclusion
+	path := strings.ToLower(requestPath(r, weblogbean))
+	if hostTarget != nil {
+		exclusions = appendDetectExclusions(exclusions, hostTarget.DetectExclusions, path, detector)
+	}
+	if globalHostTarget != nil && globalHostTarget != hostTarget && globalHostTarget.Host.GUARD_STATUS == 1 {
+		exclusions = appendDetectExclusions(exclusions, globalHostTarget.DetectExclusions, path, detector)
+	}
+	if len(exclusions) == 0 {
+		return args
+	}
+	kept := make([]innerbean.ReqArg, 0, len(args))
+	for _, arg := range args {
+		if !detectExclusionsHitArg(exclusions, arg) {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// requestPath 误报排除按路径匹配，不带查询串
+func requestPath(r *http.Request, weblogbean *innerbean.WebLog) string {
+	if r != nil && r.URL != nil {
+		return r.URL.Path
+	}
+	if idx := strings.IndexByte(weblogbean.URL, '?'); idx >= 0 {
+		return weblogbean.URL[:idx]
+	}
+	return weblogbean.URL
+}
+
+// appendDetectExclusions 挑出作用于该检测项且路径命中的排除项
+func appendDetectExclusions(dst []model.DetectExclusion, list []model.DetectExclusion, lowerPath string, detector string) []model.DetectExclusion {
+	for _, item := range list {
+		if item.Detector != detector && item.Detector != model.DetectExclusionAll {
+			continue
+		}
+		if detectExclusionPathMatch(item.CompareType, strings.ToLower(item.Path), lowerPath) {
+			dst = append(dst, item)
+		}
+	}
+	return dst
+}
+
+func detectExclusionPathMatch(compareType string, lowerRulePath string, lowerPath string) bool {
+	switch compareType {
+	case "":
+		return true
+	case "等于":
+		return lowerRulePath == lowerPath
+	case "前缀匹配":
+		return strings.HasPrefix(lowerPath, lowerRulePath)
+	case "后缀匹配":
+		return strings.HasSuffix(lowerPath, lowerRulePath)
+	case "包含匹配":
+		return strings.Contains(lowerPath, lowerRulePath)
+	}
+	return false
+}
+
+func detectExclusionsHitArg(exclusions []model.DetectExclusion, arg innerbean.ReqArg) bool {
+	for _, item := range exclusions {
+		if item.ArgSource != "" && item.ArgSource != arg.Source {
+			continue
+		}
+		if item.ArgName == "" || wildcardMatchFold(item.ArgName, arg.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatchFold 不区分大小写的通配匹配，只认 *（JSON 路径里的 [ ] 按普通字符处理）
+func wildcardMatchFold(pattern string, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	if !strings.Contains(pattern, "*") {
+		return pattern == s
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
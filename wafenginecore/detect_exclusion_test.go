@@ -0,0 +1,76 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 误报排除只跳过被排除的参数，同一请求里的其它参数照常检测
+func TestDetectExclusion_SkipOnlyExcludedArg(t *testing.T) {
+	waf, hostSafe := newTestWafForXSS()
+	globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
+	hostSafe.DetectExclusions = []model.DetectExclusion{
+		{CompareType: "等于", Path: "/API/Post", ArgSource: innerbean.ReqArgSourceJSON, ArgName: "post.content", Detector: model.DetectExclusionXSS},
+	}
+	globalHost.DetectExclusions = []model.DetectExclusion{
+		{CompareType: "前缀匹配", Path: "/api/", ArgName: "items[*].html", Detector: model.DetectExclusionAll},
+	}
+
+	cases := []struct {
+		name      string
+		path      string
+		body      string
+		wantBlock bool
+		wantArg   string
+	}{
+		{"排除参数里的XSS放行", "/api/post", `{"post":{"content":"<script>alert(1)</script>"}}`, false, ""},
+		{"其它参数仍然检测", "/api/post", `{"post":{"content":"<script>alert(1)</script>","title":"<img src=x onerror=alert(1)>"}}`, true, "json:post.title"},
+		{"路径不符不排除", "/api/comment", `{"post":{"content":"<script>alert(1)</script>"}}`, true, "json:post.content"},
+		{"全局通配排除", "/api/page", `{"items":[{"html":"<script>alert(1)</script>"}]}`, false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://a.com"+c.path+"?id=1", strings.NewReader(c.body))
+			r.Header.Set("Content-Type", "application/json")
+			weblog := &innerbean.WebLog{SrcByteBody: []byte(c.body), BODY: c.body}
+			res := waf.CheckXss(r, weblog, url.Values{}, hostSafe, globalHost)
+			if res.IsBlock != c.wantBlock || weblog.MATCH_ARG != c.wantArg {
+				t.Fatalf("IsBlock=%v MATCH_ARG=%q，期望 %v %q", res.IsBlock, weblog.MATCH_ARG, c.wantBlock, c.wantArg)
+			}
+		})
+	}
+
+	// 排除项只作用于指定检测：XSS 排除不影响 SQL 注入检测
+	body := `{"post":{"content":"1' or '1'='1"}}`
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/api/post", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	weblog := &innerbean.WebLog{SrcByteBody: []byte(body), BODY: body}
+	if !waf.CheckSql(r, weblog, url.Values{}, hostSafe, globalHost).IsBlock {
+		t.Fatalf("XSS 排除不应放过 SQL 注入")
+	}
+}
+
+func TestWildcardMatchFold(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"content", "Content", true},
+		{"items[*].html", "items[3].html", true},
+		{"items[*].html", "items[3].title", false},
+		{"*token", "csrf_token", true},
+		{"a*a", "a", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if got := wildcardMatchFold(c.pattern, c.s); got != c.want {
+			t.Errorf("wildcardMatchFold(%q, %q)=%v，期望 %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/utils"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
@@ -36,89 +35,26 @@ func renderTemplate(templateContent string, data map[string]interface{}) ([]byte
 // EchoErrorInfo  ruleName 对内记录  blockInfo 对外展示  attackType 攻击类型
 // 返回值：实际下发的 HTTP 状态码（供调用方记录 weblog）
 func EchoErrorInfo(w http.ResponseWriter, r *http.Request, weblogbean *innerbean.WebLog, ruleName string, blockInfo string, hostsafe *wafenginmodel.HostSafe, globalHostSafe *wafenginmodel.HostSafe, isLog bool, attackType string) int {
-	resBytes := []byte("")
 	var responseCode int = 403
 	// 反向代理环路：未配置专属拦截页时，默认按标准 508 Loop Detected 返回（仿 444 的按类型特判）；
-	// 用户若给 proxy_loop 配了拦截页则以页面配置的响应码为准（见下方 blockingPage.ResponseCode 覆盖）
+	// 用户若给 proxy_loop 配了拦截页则以页面配置的响应码为准
 	if attackType == "proxy_loop" {
 		responseCode = 508
 	}
-
-	renderData := map[string]interface{}{
-		"SAMWAF_REQ_UUID":   weblogbean.REQ_UUID,
-		"SAMWAF_BLOCK_INFO": blockInfo,
-	}
-
-	// 优先根据攻击类型查找对应的拦截页面
-	var blockingPage model.BlockingPage
-	var ok bool
-
-	// 1. 优先查找网站级别的攻击类型专属拦截页面
-	if attackType != "" {
-		for _, page := range hostsafe.BlockingPage {
-			if page.AttackType == attackType {
-				blockingPage = page
-				ok = true
-				break
-			}
-		}
-	}
-
-	// 2. 如果没找到攻击类型专属页面，尝试使用响应码为403的通用拦截页面
-	if !ok {
-		blockingPage, ok = hostsafe.BlockingPage["403"]
-	}
-
-	// 3. 如果网站级别没找到，查找全局级别的攻击类型专属页面
-	if !ok && attackType != "" {
-		for _, page := range globalHostSafe.BlockingPage {
-			if page.AttackType == attackType {
-				blockingPage = page
-				ok = true
-				break
-			}
-		}
+	// 爬虫策略限流默认 429，Retry-After 由调用方按策略配置写入
+	if attackType == "crawler_throttle" {
+		responseCode = 429
 	}
 
-	// 4. 如果还没找到，使用全局的403拦截页面
-	if !ok {
-		blockingPage, ok = globalHostSafe.BlockingPage["403"]
-	}
-
-	if ok {
-		// 设置 HTTP header
-		var headers []map[string]string
-		if err := json.Unmarshal([]byte(blockingPage.ResponseHeader), &headers); err == nil {
-			for _, header := range headers {
-				if name, ok := header["name"]; ok {
-					if value, ok := header["value"]; ok && value != "" {
-						w.Header().Set(name, value)
-					}
-				}
-			}
-		}
-
-		// 渲染模板
-		renderedBytes, err := renderTemplate(blockingPage.ResponseContent, renderData)
-		if err == nil {
-			resBytes = renderedBytes
-		} else {
-			resBytes = []byte(blockingPage.ResponseContent)
-		}
-
-		// 设置响应码
-		if code, err := strconv.Atoi(blockingPage.ResponseCode); err == nil {
-			responseCode = code
-		}
-	} else {
-		// 默认的阻止页面
-		renderedBytes, err := renderTemplate(global.GLOBAL_DEFAULT_BLOCK_INFO, renderData)
-		if err == nil {
-			resBytes = renderedBytes
-		} else {
-			resBytes = []byte(global.GLOBAL_DEFAULT_BLOCK_INFO)
+	// 按 Accept/Content-Type 协商格式（HTML/JSON/XML/gRPC），查找对应格式的拦截页面并渲染
+	blockRes := buildBlockResponse(r, weblogbean, blockInfo, hostsafe, globalHostSafe, attackType, responseCode)
+	for name, values := range blockRes.header {
+		for _, value := range values {
+			w.Header().Set(name, value)
 		}
 	}
+	resBytes := blockRes.body
+	responseCode = blockRes.code
 
 	// 特殊处理444状态码：直接关闭连接，不返回任何内容
 	if responseCode == 444 {
@@ -178,7 +114,7 @@ func EchoErrorInfo(w http.ResponseWriter, r *http.Request, weblogbean *innerbean
 		datetimeNow := time.Now()
 		weblogbean.TimeSpent = datetimeNow.UnixNano()/1e6 - weblogbean.UNIX_ADD_TIME
 		// 记录响应body
-		weblogbean.RES_BODY = string(resBytes)
+		weblogbean.RES_BODY = blockRes.logBody()
 		weblogbean.RULE = ruleName
 		weblogbean.ACTION = "阻止"
 		weblogbean.STATUS = "阻止访问"
@@ -192,84 +128,15 @@ func EchoErrorInfo(w http.ResponseWriter, r *http.Request, weblogbean *innerbean
 
 // EchoResponseErrorInfo  ruleName 对内记录  blockInfo 对外展示  attackType 攻击类型
 func EchoResponseErrorInfo(resp *http.Response, weblogbean *innerbean.WebLog, ruleName string, blockInfo string, hostsafe *wafenginmodel.HostSafe, globalHostSafe *wafenginmodel.HostSafe, isLog bool, attackType string) {
-	resBytes := []byte("")
-	var responseCode int = 403
-
-	renderData := map[string]interface{}{
-		"SAMWAF_REQ_UUID":   weblogbean.REQ_UUID,
-		"SAMWAF_BLOCK_INFO": blockInfo,
-	}
-
-	// 优先根据攻击类型查找对应的拦截页面
-	var blockingPage model.BlockingPage
-	var ok bool
-
-	// 1. 优先查找网站级别的攻击类型专属拦截页面
-	if attackType != "" {
-		for _, page := range hostsafe.BlockingPage {
-			if page.AttackType == attackType {
-				blockingPage = page
-				ok = true
-				break
-			}
-		}
-	}
-
-	// 2. 如果没找到攻击类型专属页面，尝试使用响应码为403的通用拦截页面
-	if !ok {
-		blockingPage, ok = hostsafe.BlockingPage["403"]
-	}
-
-	// 3. 如果网站级别没找到，查找全局级别的攻击类型专属页面
-	if !ok && attackType != "" {
-		for _, page := range globalHostSafe.BlockingPage {
-			if page.AttackType == attackType {
-				blockingPage = page
-				ok = true
-				break
-			}
-		}
-	}
-
-	// 4. 如果还没找到，使用全局的403拦截页面
-	if !ok {
-		blockingPage, ok = globalHostSafe.BlockingPage["403"]
-	}
-
-	if ok {
-		// 设置 HTTP header
-		var headers []map[string]string
-		if err := json.Unmarshal([]byte(blockingPage.ResponseHeader), &headers); err == nil {
-			for _, header := range headers {
-				if name, ok := header["name"]; ok {
-					if value, ok := header["value"]; ok && value != "" {
-						resp.Header.Set(name, value)
-					}
-				}
-			}
-		}
-
-		// 渲染模板
-		renderedBytes, err := renderTemplate(blockingPage.ResponseContent, renderData)
-		if err == nil {
-			resBytes = renderedBytes
-		} else {
-			resBytes = []byte(blockingPage.ResponseContent)
-		}
-
-		// 设置响应码
-		if code, err := strconv.Atoi(blockingPage.ResponseCode); err == nil {
-			responseCode = code
-		}
-	} else {
-		// 默认的阻止页面
-		renderedBytes, err := renderTemplate(global.GLOBAL_DEFAULT_BLOCK_INFO, renderData)
-		if err == nil {
-			resBytes = renderedBytes
-		} else {
-			resBytes = []byte(global.GLOBAL_DEFAULT_BLOCK_INFO)
+	// 响应阶段拦截同样按原始请求协商格式
+	blockRes := buildBlockResponse(resp.Request, weblogbean, blockInfo, hostsafe, globalHostSafe, attackType, 403)
+	for name, values := range blockRes.header {
+		for _, value := range values {
+			resp.Header.Set(name, value)
 		}
 	}
+	resBytes := blockRes.body
+	responseCode := blockRes.code
 
 	// 特殊处理444状态码：直接关闭连接
 	if responseCode == 444 {
@@ -313,7 +180,13 @@ func EchoResponseErrorInfo(resp *http.Response, weblogbean *innerbean.WebLog, ru
 	// head 修改追加内容
 	resp.ContentLength = int64(len(resBytes))
 	resp.Header.Set("Content-Length", strconv.FormatInt(int64(len(resBytes)), 10))
-	resp.Header.Set("Content-Type", "text/html;")
+	if blockRes.format == model.BlockingPageContentTypeHTML {
+		resp.Header.Set("Content-Type", "text/html;")
+	}
+	if blockRes.format == model.BlockingPageContentTypeGRPC {
+		// Trailers-Only：状态都在响应头里，后端原有的 trailer 不能再带出去
+		resp.Trailer = nil
+	}
 	if isLog {
 		go func() {
 			// 发送推送消息
@@ -328,7 +201,7 @@ func EchoResponseErrorInfo(resp *http.Response, weblogbean *innerbean.WebLog, ru
 		datetimeNow := time.Now()
 		weblogbean.TimeSpent = datetimeNow.UnixNano()/1e6 - weblogbean.UNIX_ADD_TIME
 		// 记录响应body
-		weblogbean.RES_BODY = string(resBytes)
+		weblogbean.RES_BODY = blockRes.logBody()
 		weblogbean.RULE = ruleName
 		weblogbean.ACTION = "阻止"
 		weblogbean.STATUS = "阻止访问"
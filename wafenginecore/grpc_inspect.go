@@ -0,0 +1,268 @@
+package wafenginecore
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/detection"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/grpcinspect"
+	"SamWaf/wafenginecore/wafargs"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// prepareGrpc gRPC/gRPC-Web 请求：记下服务名和方法名(所有 gRPC 请求都记，供规则和按键限流使用)；
+// 站点开启 gRPC 检测时再预读首条消息解成 JSON，作为请求体和参数交给后续检测。
+// 流式调用只检测首条消息；首条消息超过上限、压缩算法不支持、等待超时、解不出来的记下原因(GRPC_SKIP)，
+// 由 CheckGrpcSkip 按站点配置决定照常转发还是拦截
+func prepareGrpc(r *http.Request, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	contentType := r.Header.Get("Content-Type")
+	kind := grpcinspect.KindOf(contentType)
+	if kind == grpcinspect.None {
+		return
+	}
+	weblogbean.GrpcContentType = contentType
+	weblogbean.GRPC_SERVICE, weblogbean.GRPC_METHOD, _ = grpcinspect.SplitMethod(r.URL.Path)
+
+	cfg := model.ParseGrpcConfig(hostTarget.Host.GrpcJSON)
+	if cfg.IsEnable != 1 || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	maxBytes := cfg.MaxMessageKB * 1024
+	msg, err := prefetchGrpcMessage(r, kind, maxBytes, time.Duration(cfg.FirstMsgWaitMs)*time.Millisecond)
+	if err != nil {
+		// 一条消息都没有(客户端流发了 0 条)或访客已断开，没有要检测的内容
+		if err == io.EOF || r.Context().Err() != nil {
+			return
+		}
+		weblogbean.GRPC_SKIP = grpcSkipReason(err)
+		zlog.Debug("gRPC 首条消息未检测", zap.String("url", weblogbean.URL), zap.Error(err))
+		return
+	}
+	data, err := msg.Payload(r.Header.Get("Grpc-Encoding"), maxBytes)
+	if err != nil {
+		weblogbean.GRPC_SKIP = grpcSkipReason(err)
+		zlog.Debug("gRPC 消息解压失败", zap.String("url", weblogbean.URL), zap.Error(err))
+		return
+	}
+	text, _, ok := grpcinspect.CurrentRegistry().Decode(r.URL.Path, data)
+	if !ok {
+		weblogbean.GRPC_SKIP = "消息解码失败"
+		return
+	}
+	weblogbean.BODY = text
+	// 查询参数/Cookie/请求头照常拆，请求体换成解码后的消息
+	weblogbean.ReqArgs = append(wafargs.Extract(r, nil), wafargs.ExtractText(innerbean.ReqArgSourceGrpc, text)...)
+}
+
+// grpcSkipReason 首条消息未能检测的原因，记入日志和拦截标题
+func grpcSkipReason(err error) string {
+	switch {
+	case errors.Is(err, errGrpcWaitTimeout):
+		return "等待首条消息超时"
+	case errors.Is(err, grpcinspect.ErrTooLarge):
+		return "首条消息超过检测上限"
+	case errors.Is(err, grpcinspect.ErrUnsupportedEncoding):
+		return "压缩算法不支持"
+	default:
+		return "消息格式错误"
+	}
+}
+
+// CheckGrpcSkip 开启 gRPC 检测的站点，首条消息未能检测时按 SkipAction 处理：block 拦截(fail-closed)，pass 照常转发
+func (waf *WafEngine) CheckGrpcSkip(r *http.Request, weblogbean *innerbean.WebLog, formValue url.Values, hostTarget *wafenginmodel.HostSafe, globalHostTarget *wafenginmodel.HostSafe) detection.Result {
+	result := detection.Result{
+		JumpGuardResult: false,
+		IsBlock:         false,
+		Title:           "",
+		Content:         "",
+	}
+	if weblogbean.GRPC_SKIP == "" || model.ParseGrpcConfig(hostTarget.Host.GrpcJSON).SkipAction != "block" {
+		return result
+	}
+	weblogbean.RISK_LEVEL = 1
+	result.IsBlock = true
+	result.Title = "gRPC检测:" + weblogbean.GRPC_SKIP
+	result.Content = "请求消息无法检测，已拦截"
+	return result
+}
+
+// errGrpcWaitTimeout 在配置的时长内没等到首条消息
+var errGrpcWaitTimeout = errors.New("等待首条消息超时")
+
+// grpcPrefetchBody 预读首条消息后接回去的请求体：先吐预读到的原始字节，再接着读原请求体。
+// 预读在单独的 goroutine 里进行，等待超时后照常转发；转发读请求体时先等预读结束，保证字节顺序不乱
+type grpcPrefetchBody struct {
+	done chan struct{}
+	raw  bytes.Buffer
+	src  io.ReadCloser
+}
+
+func (b *grpcPrefetchBody) Read(p []byte) (int, error) {
+	<-b.done
+	if b.raw.Len() > 0 {
+		return b.raw.Read(p)
+	}
+	return b.src.Read(p)
+}
+
+func (b *grpcPrefetchBody) Close() error {
+	return b.src.Close()
+}
+
+// prefetchGrpcMessage 读首条消息。不能像普通请求一样整个读完：客户端流/双向流的请求体要到调用结束才结束，
+// 有的双向流还要等服务端先发言，所以只等 wait 这么久
+func prefetchGrpcMessage(r *http.Request, kind grpcinspect.Kind, maxBytes int, wait time.Duration) (grpcinspect.Message, error) {
+	body := &grpcPrefetchBody{done: make(chan struct{}), src: r.Body}
+	var msg grpcinspect.Message
+	var readErr error
+	go func() {
+		defer close(body.done)
+		var src io.Reader = io.TeeReader(body.src, &body.raw)
+		if kind == grpcinspect.WebText {
+			src = grpcinspect.NewWebTextReader(src)
+		}
+		msg, readErr = grpcinspect.ReadMessage(src, maxBytes)
+	}()
+	r.Body = body
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-body.done:
+		return msg, readErr
+	case <-timer.C:
+		return grpcinspect.Message{}, errGrpcWaitTimeout
+	case <-r.Context().Done():
+		return grpcinspect.Message{}, r.Context().Err()
+	}
+}
+
+// isGrpcWebPreflight gRPC-Web 跨域预检：OPTIONS + 声明要带 x-grpc-web 头的 /包名.服务/方法 请求
+func isGrpcWebPreflight(r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	if _, _, ok := grpcinspect.SplitMethod(r.URL.Path); !ok {
+		return false
+	}
+	return strings.Contains(strings.ToLower(r.Header.Get("Access-Control-Request-Headers")), "x-grpc-web")
+}
+
+// translateGrpcWeb 转发前把 gRPC-Web 请求转成 gRPC 发给后端(后端只需实现原生 gRPC)。
+// 后端不认识跨域预检，配置了允许的来源时由 WAF 直接应答；answered 为 true 表示已应答，不再转发
+func translateGrpcWeb(w http.ResponseWriter, r *http.Request, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) (answered bool) {
+	cfg := model.ParseGrpcConfig(hostTarget.Host.GrpcJSON)
+	if cfg.IsEnable != 1 || cfg.WebTranslate != 1 {
+		return false
+	}
+	if isGrpcWebPreflight(r) {
+		origin, ok := grpcinspect.AllowOrigin(cfg.WebCorsOrigins, r.Header.Get("Origin"))
+		if !ok {
+			return false
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		h.Set("Access-Control-Max-Age", "86400")
+		h.Add("Vary", "Origin")
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	kind := grpcinspect.KindOf(weblogbean.GrpcContentType)
+	if kind != grpcinspect.Web && kind != grpcinspect.WebText {
+		return false
+	}
+	if kind == grpcinspect.WebText {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{grpcinspect.NewWebTextReader(r.Body), r.Body}
+		r.ContentLength = -1
+		r.Header.Del("Content-Length")
+	}
+	r.Header.Set("Content-Type", grpcinspect.NativeContentType(weblogbean.GrpcContentType))
+	r.Header.Set("Te", "trailers")
+	r.Header.Del("X-Grpc-Web")
+	weblogbean.GrpcWebTranslated = true
+	return false
+}
+
+// setGrpcWebCORS gRPC-Web 响应(含拦截、出错)补跨域头，浏览器脚本才读得到 grpc-status
+func setGrpcWebCORS(h http.Header, origin string, hostTarget *wafenginmodel.HostSafe) {
+	if hostTarget == nil {
+		return
+	}
+	cfg := model.ParseGrpcConfig(hostTarget.Host.GrpcJSON)
+	if cfg.IsEnable != 1 {
+		return
+	}
+	if allowed, ok := grpcinspect.AllowOrigin(cfg.WebCorsOrigins, origin); ok {
+		h.Set("Access-Control-Allow-Origin", allowed)
+		h.Set("Access-Control-Expose-Headers", grpcinspect.ExposeHeaders)
+		h.Add("Vary", "Origin")
+	}
+}
+
+// grpcResponseContentType WAF 自己回给 gRPC 客户端(拦截、出错)的 Content-Type：gRPC-Web 客户端要按它识别响应
+func grpcResponseContentType(requestContentType string) string {
+	switch kind := grpcinspect.KindOf(requestContentType); kind {
+	case grpcinspect.Web, grpcinspect.WebText:
+		return grpcinspect.WebContentType(kind, "")
+	}
+	return "application/grpc"
+}
+
+// translateGrpcResponse 已转成 gRPC 转发的 gRPC-Web 请求，把后端的 gRPC 响应转回 gRPC-Web
+func translateGrpcResponse(resp *http.Response, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	if !weblogbean.GrpcWebTranslated || grpcinspect.KindOf(resp.Header.Get("Content-Type")) != grpcinspect.Native {
+		return
+	}
+	grpcinspect.TranslateResponse(resp, grpcinspect.KindOf(weblogbean.GrpcContentType))
+	setGrpcWebCORS(resp.Header, resp.Request.Header.Get("Origin"), hostTarget)
+}
+
+// grpcSplitTransport 按请求选 Transport：gRPC 只能跑在 HTTP/2 上，明文后端用 h2c；其余请求照旧走原 Transport
+type grpcSplitTransport struct {
+	plain   *http.Transport
+	newGrpc func() *http.Transport
+	once    sync.Once
+	grpc    *http.Transport
+}
+
+func newGrpcSplitTransport(plain *http.Transport, newGrpc func() *http.Transport) *grpcSplitTransport {
+	return &grpcSplitTransport{plain: plain, newGrpc: newGrpc}
+}
+
+func (t *grpcSplitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if grpcinspect.KindOf(req.Header.Get("Content-Type")) != grpcinspect.Native {
+		return t.plain.RoundTrip(req)
+	}
+	t.once.Do(func() {
+		t.grpc = t.newGrpc()
+	})
+	return t.grpc.RoundTrip(req)
+}
+
+// grpcTransport 在原 Transport 配置基础上只开 HTTP/2
+func grpcTransport(plain *http.Transport, backendScheme string) *http.Transport {
+	t := plain.Clone()
+	protocols := new(http.Protocols)
+	if strings.EqualFold(backendScheme, "https") {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	t.Protocols = protocols
+	return t
+}
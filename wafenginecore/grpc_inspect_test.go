@@ -0,0 +1,236 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/grpcinspect"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func newGrpcTestHost(grpcJSON string) *wafenginmodel.HostSafe {
+	return &wafenginmodel.HostSafe{Host: model.Hosts{
+		Code:         "grpc-host",
+		DEFENSE_JSON: `{"sqli":1,"xss":1}`,
+		GrpcJSON:     grpcJSON,
+	}, BlockingPage: map[string]model.BlockingPage{}}
+}
+
+func grpcTestFrame(orderNo string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, orderNo)
+	return grpcinspect.EncodeMessage(b)
+}
+
+func TestPrepareGrpcDetectsFirstMessage(t *testing.T) {
+	waf := &WafEngine{}
+	host := newGrpcTestHost(`{"is_enable":1}`)
+	frame := grpcTestFrame("1' or '1'='1")
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", bytes.NewReader(frame))
+	r.Header.Set("Content-Type", "application/grpc")
+	weblog := &innerbean.WebLog{URL: r.URL.Path}
+	prepareGrpc(r, weblog, host)
+
+	if weblog.GRPC_SERVICE != "shop.v1.OrderService" || weblog.GRPC_METHOD != "Get" {
+		t.Fatalf("服务名/方法名不对: %s %s", weblog.GRPC_SERVICE, weblog.GRPC_METHOD)
+	}
+	if !strings.Contains(weblog.BODY, "1' or '1'='1") {
+		t.Fatalf("请求体应换成解码后的消息: %q", weblog.BODY)
+	}
+	if res := waf.CheckSql(r, weblog, nil, host, nil); !res.IsBlock {
+		t.Fatal("消息里的 SQL 注入应被检出")
+	}
+	// 预读过的字节要原样转发给后端
+	if forwarded, _ := io.ReadAll(r.Body); !bytes.Equal(forwarded, frame) {
+		t.Fatalf("转发的请求体被改动: % x", forwarded)
+	}
+
+	// 没开检测只记方法，不动请求体
+	r = httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", bytes.NewReader(frame))
+	r.Header.Set("Content-Type", "application/grpc")
+	weblog = &innerbean.WebLog{}
+	body := r.Body
+	prepareGrpc(r, weblog, newGrpcTestHost(""))
+	if weblog.GRPC_METHOD != "Get" || weblog.BODY != "" || r.Body != body {
+		t.Fatal("未开启检测时不应预读请求体")
+	}
+}
+
+// 双向流客户端迟迟不发首条消息：超时后照常转发，之后的字节顺序不乱
+func TestPrepareGrpcWaitTimeout(t *testing.T) {
+	host := newGrpcTestHost(`{"is_enable":1,"first_msg_wait_ms":50}`)
+	pr, pw := io.Pipe()
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/chat.v1.Chat/Stream", pr)
+	r.Header.Set("Content-Type", "application/grpc")
+	weblog := &innerbean.WebLog{}
+	prepareGrpc(r, weblog, host)
+	if weblog.BODY != "" || weblog.GRPC_METHOD != "Stream" || weblog.GRPC_SKIP != "等待首条消息超时" {
+		t.Fatalf("超时不应检测且要记下原因: %q %q", weblog.BODY, weblog.GRPC_SKIP)
+	}
+	if res := (&WafEngine{}).CheckGrpcSkip(r, weblog, nil, host, nil); res.IsBlock {
+		t.Fatal("默认照常转发未检测的消息")
+	}
+	frame := grpcTestFrame("hello")
+	go func() {
+		pw.Write(frame)
+		pw.Close()
+	}()
+	if forwarded, _ := io.ReadAll(r.Body); !bytes.Equal(forwarded, frame) {
+		t.Fatalf("超时后转发的请求体不对: % x", forwarded)
+	}
+}
+
+// 未能检测的首条消息：记下原因，配置了 fail-closed 时拦截
+func TestCheckGrpcSkip(t *testing.T) {
+	waf := &WafEngine{}
+	host := newGrpcTestHost(`{"is_enable":1,"max_message_kb":1,"skip_action":"block"}`)
+	prepare := func(frame []byte, encoding string) *innerbean.WebLog {
+		r := httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", bytes.NewReader(frame))
+		r.Header.Set("Content-Type", "application/grpc")
+		if encoding != "" {
+			r.Header.Set("Grpc-Encoding", encoding)
+		}
+		weblog := &innerbean.WebLog{}
+		prepareGrpc(r, weblog, host)
+		return weblog
+	}
+
+	weblog := prepare(grpcTestFrame(strings.Repeat("a", 2048)), "")
+	res := waf.CheckGrpcSkip(nil, weblog, nil, host, nil)
+	if weblog.GRPC_SKIP != "首条消息超过检测上限" || !res.IsBlock || res.Title != "gRPC检测:首条消息超过检测上限" {
+		t.Fatalf("超过上限的消息应拦截: %q %+v", weblog.GRPC_SKIP, res)
+	}
+	if inferAttackType(res.Title) != "protocol_anomaly" {
+		t.Fatalf("攻击类型不对: %s", inferAttackType(res.Title))
+	}
+
+	compressed := grpcTestFrame("x")
+	compressed[0] = 1
+	if weblog = prepare(compressed, "snappy"); weblog.GRPC_SKIP != "压缩算法不支持" {
+		t.Fatalf("不支持的压缩算法应记下原因: %q", weblog.GRPC_SKIP)
+	}
+	if weblog = prepare(grpcTestFrame("ok"), ""); weblog.GRPC_SKIP != "" || waf.CheckGrpcSkip(nil, weblog, nil, host, nil).IsBlock {
+		t.Fatalf("正常检测的消息不应拦截: %q", weblog.GRPC_SKIP)
+	}
+}
+
+func TestTranslateGrpcWebRequest(t *testing.T) {
+	host := newGrpcTestHost(`{"is_enable":1,"web_translate":1,"web_cors_origins":"https://app.com"}`)
+
+	pre := httptest.NewRequest(http.MethodOptions, "http://g.com/shop.v1.OrderService/Get", nil)
+	pre.Header.Set("Origin", "https://app.com")
+	pre.Header.Set("Access-Control-Request-Method", "POST")
+	pre.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+	w := httptest.NewRecorder()
+	if !translateGrpcWeb(w, pre, &innerbean.WebLog{}, host) || w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.com" {
+		t.Fatalf("允许的来源应由 WAF 应答预检: %d %v", w.Code, w.Header())
+	}
+	pre.Header.Set("Origin", "https://evil.com")
+	if translateGrpcWeb(httptest.NewRecorder(), pre, &innerbean.WebLog{}, host) {
+		t.Fatal("不在允许列表的来源不应应答预检")
+	}
+
+	frame := grpcTestFrame("<script>alert(1)</script>")
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", strings.NewReader(base64.StdEncoding.EncodeToString(frame)))
+	r.Header.Set("Content-Type", "application/grpc-web-text+proto")
+	r.Header.Set("X-Grpc-Web", "1")
+	weblog := &innerbean.WebLog{}
+	prepareGrpc(r, weblog, host)
+	if res := (&WafEngine{}).CheckXss(r, weblog, nil, host, nil); !res.IsBlock {
+		t.Fatal("-text 请求解码后的消息应参与检测")
+	}
+	if translateGrpcWeb(httptest.NewRecorder(), r, weblog, host) {
+		t.Fatal("普通调用应继续转发")
+	}
+	if r.Header.Get("Content-Type") != "application/grpc+proto" || r.Header.Get("Te") != "trailers" || r.Header.Get("X-Grpc-Web") != "" || !weblog.GrpcWebTranslated {
+		t.Fatalf("请求头未转成 gRPC: %v", r.Header)
+	}
+	if forwarded, _ := io.ReadAll(r.Body); !bytes.Equal(forwarded, frame) {
+		t.Fatalf("-text 请求体应还原成二进制转发: % x", forwarded)
+	}
+}
+
+func TestGrpcBlockResponse(t *testing.T) {
+	host := newGrpcTestHost(`{"is_enable":1,"web_cors_origins":"*"}`)
+	global := &wafenginmodel.HostSafe{BlockingPage: map[string]model.BlockingPage{}}
+
+	r := httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	EchoErrorInfo(w, r, &innerbean.WebLog{REQ_UUID: "u1"}, "CC", "请求过于频繁", host, global, false, "cc_attack")
+	if w.Header().Get("Grpc-Status") != "8" {
+		t.Fatalf("限流应回 RESOURCE_EXHAUSTED(8)，实际 %s", w.Header().Get("Grpc-Status"))
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "http://g.com/shop.v1.OrderService/Get", nil)
+	r.Header.Set("Content-Type", "application/grpc-web-text")
+	r.Header.Set("Origin", "https://app.com")
+	w = httptest.NewRecorder()
+	EchoErrorInfo(w, r, &innerbean.WebLog{REQ_UUID: "u2"}, "SQL注入", "请正确访问", host, global, false, "sqli")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/grpc-web-text" || w.Header().Get("Grpc-Status") != "7" {
+		t.Fatalf("gRPC-Web 拦截响应不对: %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.com" || !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "grpc-status") {
+		t.Fatalf("浏览器要能读到 grpc-status: %v", w.Header())
+	}
+}
+
+// 明文后端用 h2c 转发 gRPC，trailer 能带回来并转成 gRPC-Web 的 trailer 帧；普通请求仍走 HTTP/1.1
+func TestGrpcSplitTransportH2C(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.Write([]byte("http1"))
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(grpcinspect.EncodeMessage([]byte("ok")))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetHTTP1(true)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	plain := &http.Transport{}
+	transport := newGrpcSplitTransport(plain, func() *http.Transport { return grpcTransport(plain, "http") })
+
+	req, _ := http.NewRequest(http.MethodPost, backend.URL+"/shop.v1.OrderService/Get", bytes.NewReader(grpcTestFrame("x")))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Origin", "https://app.com")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("gRPC 应走 HTTP/2，实际 %s", resp.Proto)
+	}
+	weblog := &innerbean.WebLog{GrpcContentType: "application/grpc-web", GrpcWebTranslated: true}
+	translateGrpcResponse(resp, weblog, newGrpcTestHost(`{"is_enable":1,"web_cors_origins":"*"}`))
+	out, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/grpc-web" || !bytes.HasSuffix(out, []byte("grpc-status:0\r\n")) {
+		t.Fatalf("响应未转成 gRPC-Web: %v %q", resp.Header, out)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, backend.URL+"/", nil)
+	resp, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "http1" {
+		t.Fatalf("普通请求应走原 Transport: %s", body)
+	}
+}
@@ -0,0 +1,224 @@
+// Package grpcinspect 解析 gRPC / gRPC-Web 请求：识别内容类型、拆出服务名和方法名、读取长度前缀的消息帧、
+// 把 protobuf 消息解成 JSON 供检测，以及 gRPC-Web 与 gRPC 之间的报文转换。
+//
+// 消息帧格式：1 字节标志(bit0 压缩，gRPC-Web 的 0x80 表示 trailer 帧) + 4 字节大端长度 + 载荷。
+// gRPC-Web 的 -text 变体把整个报文做 base64，分块发送时每块可各自带填充。
+package grpcinspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Kind 请求的 gRPC 协议形态
+type Kind int
+
+const (
+	None    Kind = iota //不是 gRPC
+	Native              //application/grpc
+	Web                 //application/grpc-web
+	WebText             //application/grpc-web-text，报文整体 base64
+)
+
+const (
+	headerLen      = 5
+	flagCompressed = 0x01
+	flagTrailer    = 0x80
+)
+
+var (
+	// ErrTooLarge 消息长度超过检测上限，载荷没有读取
+	ErrTooLarge = errors.New("gRPC 消息超过检测上限")
+	// ErrUnsupportedEncoding 压缩算法不支持，只支持 gzip
+	ErrUnsupportedEncoding = errors.New("不支持的 gRPC 消息压缩算法")
+)
+
+// KindOf 按 Content-Type 判断协议形态，application/grpc+proto 之类带子类型的也算
+func KindOf(contentType string) Kind {
+	base, _ := splitContentType(contentType)
+	switch base {
+	case "application/grpc":
+		return Native
+	case "application/grpc-web":
+		return Web
+	case "application/grpc-web-text":
+		return WebText
+	}
+	return None
+}
+
+// splitContentType 拆成基础类型和 + 后面的子类型(proto/json…)
+func splitContentType(contentType string) (string, string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if i := strings.IndexByte(mediaType, '+'); i >= 0 {
+		return mediaType[:i], mediaType[i+1:]
+	}
+	return mediaType, ""
+}
+
+// NativeContentType gRPC-Web 请求转成 gRPC 时的 Content-Type，保留子类型
+func NativeContentType(contentType string) string {
+	if _, sub := splitContentType(contentType); sub != "" {
+		return "application/grpc+" + sub
+	}
+	return "application/grpc"
+}
+
+// WebContentType 回给 gRPC-Web 客户端的 Content-Type：与请求同一形态，子类型取后端响应的
+func WebContentType(kind Kind, nativeContentType string) string {
+	base := "application/grpc-web"
+	if kind == WebText {
+		base = "application/grpc-web-text"
+	}
+	if _, sub := splitContentType(nativeContentType); sub != "" {
+		return base + "+" + sub
+	}
+	return base
+}
+
+// SplitMethod 拆请求路径 /包名.服务/方法，格式不对时 ok 为 false
+func SplitMethod(path string) (service string, method string, ok bool) {
+	if !strings.HasPrefix(path, "/") {
+		return "", "", false
+	}
+	parts := strings.Split(path[1:], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// MatchMethod 方法模式匹配：服务全名/方法名，方法名写 * 匹配该服务的所有方法
+func MatchMethod(pattern string, service string, method string) bool {
+	svc, m, ok := strings.Cut(pattern, "/")
+	if !ok || svc != service {
+		return false
+	}
+	return m == "*" || m == method
+}
+
+// Message 一条消息帧
+type Message struct {
+	Compressed bool
+	Data       []byte
+}
+
+// ReadMessage 读一条消息帧。长度超过 max 时只读帧头，返回 ErrTooLarge；
+// 没有任何数据就结束返回 io.EOF，帧不完整返回 io.ErrUnexpectedEOF
+func ReadMessage(r io.Reader, max int) (Message, error) {
+	var head [headerLen]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return Message{}, err
+	}
+	if head[0]&flagTrailer != 0 {
+		return Message{}, fmt.Errorf("请求里出现了 trailer 帧")
+	}
+	n := binary.BigEndian.Uint32(head[1:])
+	if max > 0 && uint64(n) > uint64(max) {
+		return Message{}, ErrTooLarge
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Message{}, err
+	}
+	return Message{Compressed: head[0]&flagCompressed != 0, Data: data}, nil
+}
+
+// Payload 取出消息载荷，压缩过的按 grpc-encoding 解压，解压后同样受 max 限制
+func (m Message) Payload(encoding string, max int) ([]byte, error) {
+	if !m.Compressed {
+		return m.Data, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip":
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(m.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	limit := int64(max)
+	if limit <= 0 {
+		limit = 1 << 30
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// EncodeMessage 组一条未压缩的消息帧
+func EncodeMessage(data []byte) []byte {
+	out := make([]byte, headerLen, headerLen+len(data))
+	binary.BigEndian.PutUint32(out[1:], uint32(len(data)))
+	return append(out, data...)
+}
+
+// textReader 解 gRPC-Web -text 请求体：按 4 字符一组各自解码，分块各带填充的报文也能连续解出；忽略空白
+type textReader struct {
+	src io.Reader
+	buf []byte
+	in  []byte //还不够一组的字符
+	out []byte
+	err error
+}
+
+// NewWebTextReader 把 grpc-web-text 报文还原成二进制
+func NewWebTextReader(src io.Reader) io.Reader {
+	return &textReader{src: src, buf: make([]byte, 4096)}
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		if t.err != nil {
+			if t.err == io.EOF && len(t.in) > 0 {
+				t.in = nil
+				t.err = io.ErrUnexpectedEOF
+			}
+			return 0, t.err
+		}
+		n, err := t.src.Read(t.buf)
+		for _, c := range t.buf[:n] {
+			if c != ' ' && c != '\r' && c != '\n' && c != '\t' {
+				t.in = append(t.in, c)
+			}
+		}
+		t.err = err
+		var group [3]byte
+		i := 0
+		for ; i+4 <= len(t.in); i += 4 {
+			m, decErr := base64.StdEncoding.Decode(group[:], t.in[i:i+4])
+			if decErr != nil {
+				t.err = decErr
+				t.in = nil
+				break
+			}
+			t.out = append(t.out, group[:m]...)
+		}
+		if t.in != nil {
+			t.in = append(t.in[:0], t.in[i:]...)
+		}
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
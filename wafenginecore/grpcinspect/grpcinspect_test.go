@@ -0,0 +1,270 @@
+package grpcinspect
+
+import (
+	"SamWaf/model"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestKindOfAndSplitMethod(t *testing.T) {
+	cases := map[string]Kind{
+		"application/grpc":                Native,
+		"application/grpc+proto":          Native,
+		"application/grpc-web":            Web,
+		"application/grpc-web-text+proto": WebText,
+		"Application/GRPC; charset=utf-8": Native,
+		"application/json":                None,
+		"":                                None,
+	}
+	for ct, want := range cases {
+		if got := KindOf(ct); got != want {
+			t.Errorf("KindOf(%q)=%v 期望 %v", ct, got, want)
+		}
+	}
+	if got := NativeContentType("application/grpc-web-text+proto"); got != "application/grpc+proto" {
+		t.Errorf("转换后的 Content-Type 不对: %s", got)
+	}
+	if got := WebContentType(WebText, "application/grpc+proto"); got != "application/grpc-web-text+proto" {
+		t.Errorf("回给 gRPC-Web 的 Content-Type 不对: %s", got)
+	}
+
+	svc, method, ok := SplitMethod("/shop.v1.OrderService/Get")
+	if !ok || svc != "shop.v1.OrderService" || method != "Get" {
+		t.Fatalf("拆分结果不对: %s %s %v", svc, method, ok)
+	}
+	for _, bad := range []string{"/", "/a", "/a/b/c", "a/b", "//b"} {
+		if _, _, ok := SplitMethod(bad); ok {
+			t.Errorf("%q 不是 gRPC 路径", bad)
+		}
+	}
+	if !MatchMethod("shop.v1.OrderService/*", svc, method) || !MatchMethod("shop.v1.OrderService/Get", svc, method) ||
+		MatchMethod("shop.v1.OrderService/List", svc, method) || MatchMethod("shop.v1.Other/*", svc, method) {
+		t.Fatal("方法模式匹配不对")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	frame := EncodeMessage([]byte("hello"))
+	msg, err := ReadMessage(bytes.NewReader(append(frame, EncodeMessage([]byte("next"))...)), 1024)
+	if err != nil || msg.Compressed || string(msg.Data) != "hello" {
+		t.Fatalf("读取结果不对: %+v %v", msg, err)
+	}
+	if _, err := ReadMessage(bytes.NewReader(frame), 4); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("超过上限应返回 ErrTooLarge，实际 %v", err)
+	}
+	if _, err := ReadMessage(bytes.NewReader(frame[:7]), 1024); err != io.ErrUnexpectedEOF {
+		t.Fatalf("不完整的帧应返回 ErrUnexpectedEOF，实际 %v", err)
+	}
+	if _, err := ReadMessage(bytes.NewReader(nil), 1024); err != io.EOF {
+		t.Fatalf("空请求体应返回 EOF，实际 %v", err)
+	}
+
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write([]byte(strings.Repeat("a", 100)))
+	zw.Close()
+	compressed := Message{Compressed: true, Data: zipped.Bytes()}
+	if data, err := compressed.Payload("gzip", 1024); err != nil || len(data) != 100 {
+		t.Fatalf("gzip 解压不对: %d %v", len(data), err)
+	}
+	if _, err := compressed.Payload("gzip", 50); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("解压后超过上限应返回 ErrTooLarge，实际 %v", err)
+	}
+	if _, err := compressed.Payload("snappy", 1024); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Fatalf("不支持的压缩算法应报错，实际 %v", err)
+	}
+}
+
+// 分块发送时每块各自 base64(带填充)，中间还可能夹换行
+func TestWebTextReader(t *testing.T) {
+	first, second := EncodeMessage([]byte("ab")), EncodeMessage([]byte("xyz1"))
+	text := base64.StdEncoding.EncodeToString(first) + "\r\n" + base64.StdEncoding.EncodeToString(second)
+	out, err := io.ReadAll(NewWebTextReader(&oneByteReader{strings.NewReader(text)}))
+	if err != nil || !bytes.Equal(out, append(first, second...)) {
+		t.Fatalf("解码结果不对: % x %v", out, err)
+	}
+	if _, err := io.ReadAll(NewWebTextReader(strings.NewReader("QUJD$"))); err == nil {
+		t.Fatal("非法 base64 应报错")
+	}
+}
+
+type oneByteReader struct{ r io.Reader }
+
+func (o *oneByteReader) Read(p []byte) (int, error) { return o.r.Read(p[:1]) }
+
+func testMessage() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "1' or '1'='1")
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	var inner []byte
+	inner = protowire.AppendTag(inner, 1, protowire.BytesType)
+	inner = protowire.AppendString(inner, "<script>")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, inner)
+	return b
+}
+
+func TestDecodeRaw(t *testing.T) {
+	out, ok := DecodeRaw(testMessage())
+	if !ok || out["1"] != "1' or '1'='1" || out["2"].(interface{ String() string }).String() != "42" {
+		t.Fatalf("按字段编号解码不对: %v %v", out, ok)
+	}
+	if nested, _ := out["3"].(map[string]interface{}); nested["1"] != "<script>" {
+		t.Fatalf("嵌套消息应展开: %v", out["3"])
+	}
+	if _, ok := DecodeRaw([]byte{0xff, 0xff}); ok {
+		t.Fatal("非法数据不应解码成功")
+	}
+}
+
+func testDescriptorSet(t *testing.T) []byte {
+	str, i32, msgType := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:       proto.String("shop.proto"),
+		Package:    proto.String("shop.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/empty.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Inner"), Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("note"), Number: proto.Int32(1), Type: &str, Label: &optional, JsonName: proto.String("note")},
+			}},
+			{Name: proto.String("GetReq"), Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("order_no"), Number: proto.Int32(1), Type: &str, Label: &optional, JsonName: proto.String("orderNo")},
+				{Name: proto.String("id"), Number: proto.Int32(2), Type: &i32, Label: &optional, JsonName: proto.String("id")},
+				{Name: proto.String("inner"), Number: proto.Int32(3), Type: &msgType, TypeName: proto.String(".shop.v1.Inner"), Label: &optional, JsonName: proto.String("inner")},
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("OrderService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Get"), InputType: proto.String(".shop.v1.GetReq"), OutputType: proto.String(".shop.v1.GetReq")},
+				{Name: proto.String("Ping"), InputType: proto.String(".google.protobuf.Empty"), OutputType: proto.String(".google.protobuf.Empty")},
+			},
+		}},
+	}}}
+	content, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestRegistryDecode(t *testing.T) {
+	content := testDescriptorSet(t)
+	d, err := Compile(content)
+	if err != nil {
+		t.Fatalf("没带 empty.proto 也应从内置的公共 proto 补上依赖: %v", err)
+	}
+	if d.MethodCount() != 2 || d.ServicesText() != "shop.v1.OrderService" {
+		t.Fatalf("解析结果不对: %d %s", d.MethodCount(), d.ServicesText())
+	}
+	if _, err := Compile([]byte("not a descriptor")); err == nil {
+		t.Fatal("非法内容应报错")
+	}
+
+	registry, errs := Build([]model.GrpcDescriptorSet{
+		{Name: "shop", Content: content, Status: 1},
+		{Name: "broken", Content: []byte{0x0a, 0x01}, Status: 1},
+		{Name: "off", Content: []byte("x"), Status: 0},
+	})
+	if len(errs) != 1 || registry.Len() != 2 {
+		t.Fatalf("坏文件应跳过、停用的不加载: %v %d", errs, registry.Len())
+	}
+	text, schema, ok := registry.Decode("/shop.v1.OrderService/Get", testMessage())
+	if !ok || !schema || !strings.Contains(text, `"order_no":"1' or '1'='1"`) || !strings.Contains(text, `"note":"<script>"`) {
+		t.Fatalf("按定义解码不对: %s %v %v", text, schema, ok)
+	}
+	text, schema, ok = registry.Decode("/shop.v1.Unknown/Get", testMessage())
+	if !ok || schema || !strings.Contains(text, `"1":"1' or '1'='1"`) {
+		t.Fatalf("没有定义时应按字段编号解码: %s %v %v", text, schema, ok)
+	}
+	var nilRegistry *Registry
+	if _, _, ok := nilRegistry.Decode("/a.B/C", testMessage()); !ok {
+		t.Fatal("未加载描述文件时也应能按字段编号解码")
+	}
+}
+
+type trailerBody struct {
+	r       io.Reader
+	resp    *http.Response
+	trailer http.Header
+}
+
+// 模拟 HTTP/2：trailer 在 body 读到结尾时才填进 resp.Trailer
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.resp.Trailer = b.trailer
+	}
+	return n, err
+}
+
+func (b *trailerBody) Close() error { return nil }
+
+func translatedBody(t *testing.T, kind Kind, payload []byte) (*http.Response, []byte) {
+	resp := &http.Response{Header: http.Header{}, ContentLength: 100}
+	resp.Header.Set("Content-Type", "application/grpc+proto")
+	resp.Header.Set("Content-Length", "100")
+	resp.Header.Set("Trailer", "Grpc-Status")
+	resp.Trailer = http.Header{"Grpc-Status": nil}
+	resp.Body = &trailerBody{r: &oneByteReader{bytes.NewReader(payload)}, resp: resp, trailer: http.Header{"Grpc-Status": {"0"}, "Grpc-Message": {"OK"}}}
+	TranslateResponse(resp, kind)
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, out
+}
+
+func TestTranslateResponse(t *testing.T) {
+	payload := EncodeMessage([]byte("reply"))
+	resp, out := translatedBody(t, Web, payload)
+	if resp.Header.Get("Content-Type") != "application/grpc-web+proto" || resp.Header.Get("Content-Length") != "" || resp.ContentLength != -1 {
+		t.Fatalf("响应头不对: %v %d", resp.Header, resp.ContentLength)
+	}
+	if resp.Trailer != nil || resp.Header.Get("Trailer") != "" {
+		t.Fatal("trailer 应转进报文，不再作为 HTTP trailer 下发")
+	}
+	if !bytes.HasPrefix(out, payload) {
+		t.Fatalf("数据帧应原样透传: % x", out)
+	}
+	tail := out[len(payload):]
+	if tail[0] != 0x80 || int(binary.BigEndian.Uint32(tail[1:5])) != len(tail)-5 || string(tail[5:]) != "grpc-message:OK\r\ngrpc-status:0\r\n" {
+		t.Fatalf("trailer 帧不对: %q", tail)
+	}
+
+	_, textOut := translatedBody(t, WebText, payload)
+	decoded, err := base64.StdEncoding.DecodeString(string(textOut))
+	if err != nil || !bytes.Equal(decoded, out) {
+		t.Fatalf("-text 形态应是整个报文的 base64: %q %v", textOut, err)
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	if o, ok := AllowOrigin("https://a.com, https://b.com", "https://b.com"); !ok || o != "https://b.com" {
+		t.Fatal("列表内的来源应允许")
+	}
+	if _, ok := AllowOrigin("https://a.com", "https://evil.com"); ok {
+		t.Fatal("列表外的来源不应允许")
+	}
+	if o, ok := AllowOrigin("*", "https://x.com"); !ok || o != "https://x.com" {
+		t.Fatal("* 应允许任意来源并回写具体来源")
+	}
+	if _, ok := AllowOrigin("*", ""); ok {
+		t.Fatal("没有 Origin 的请求不需要跨域头")
+	}
+}
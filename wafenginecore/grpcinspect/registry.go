@@ -0,0 +1,167 @@
+package grpcinspect
+
+import (
+	"SamWaf/model"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// 常用的公共 proto：描述文件没带 --include_imports 时从这里补依赖
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Descriptor 解析后的一个描述文件
+type Descriptor struct {
+	Name     string
+	Services []string
+	methods  map[string]protoreflect.MethodDescriptor //键为请求路径 /包名.服务/方法
+}
+
+// MethodCount 方法数
+func (d *Descriptor) MethodCount() int { return len(d.methods) }
+
+// Compile 解析 FileDescriptorSet 二进制内容
+func Compile(content []byte) (*Descriptor, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("不是有效的 FileDescriptorSet: %w", err)
+	}
+	if len(set.File) == 0 {
+		return nil, fmt.Errorf("描述文件里没有任何 proto 文件")
+	}
+	addWellKnownDeps(set)
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("解析失败(生成时请加 --include_imports): %w", err)
+	}
+	d := &Descriptor{methods: map[string]protoreflect.MethodDescriptor{}}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			svc := fd.Services().Get(i)
+			d.Services = append(d.Services, string(svc.FullName()))
+			for j := 0; j < svc.Methods().Len(); j++ {
+				m := svc.Methods().Get(j)
+				d.methods["/"+string(svc.FullName())+"/"+string(m.Name())] = m
+			}
+		}
+		return true
+	})
+	if len(d.methods) == 0 {
+		return nil, fmt.Errorf("描述文件里没有定义任何服务")
+	}
+	sort.Strings(d.Services)
+	return d, nil
+}
+
+// addWellKnownDeps 补上集合里缺少、但本程序内置了的依赖文件(google/protobuf/*.proto)
+func addWellKnownDeps(set *descriptorpb.FileDescriptorSet) {
+	have := map[string]bool{}
+	for _, f := range set.File {
+		have[f.GetName()] = true
+	}
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].Dependency {
+			if have[dep] {
+				continue
+			}
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				continue
+			}
+			have[dep] = true
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+		}
+	}
+}
+
+// Registry 已启用的描述文件合集
+type Registry struct {
+	methods map[string]protoreflect.MethodDescriptor
+}
+
+// Len 可按定义解码的方法数
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.methods)
+}
+
+// Build 解析已启用的描述文件；解析失败的跳过并返回错误，其余照常生效。同一方法在多个文件里出现时先上传的优先
+func Build(list []model.GrpcDescriptorSet) (*Registry, []error) {
+	r := &Registry{methods: map[string]protoreflect.MethodDescriptor{}}
+	var errs []error
+	for _, item := range list {
+		if item.Status != 1 {
+			continue
+		}
+		d, err := Compile(item.Content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gRPC 描述文件 %s: %w", item.Name, err))
+			continue
+		}
+		for path, m := range d.methods {
+			if _, ok := r.methods[path]; !ok {
+				r.methods[path] = m
+			}
+		}
+	}
+	return r, errs
+}
+
+// Decode 把请求消息解成 JSON 文本。有该方法的定义时按字段名解码(schema 为 true)，
+// 否则按字段编号解码；都解不出时 ok 为 false
+func (r *Registry) Decode(path string, data []byte) (text string, schema bool, ok bool) {
+	if r != nil {
+		if m, found := r.methods[path]; found {
+			msg := dynamicpb.NewMessage(m.Input())
+			if err := proto.Unmarshal(data, msg); err == nil {
+				if out, err := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(msg); err == nil {
+					return string(out), true, true
+				}
+			}
+		}
+	}
+	raw, decoded := DecodeRaw(data)
+	if !decoded {
+		return "", false, false
+	}
+	out, err := json.Marshal(raw)
+	if err != nil {
+		return "", false, false
+	}
+	return string(out), false, true
+}
+
+// ServicesText 服务名列表存库用
+func (d *Descriptor) ServicesText() string {
+	return strings.Join(d.Services, ",")
+}
+
+var current atomic.Pointer[Registry]
+
+// CurrentRegistry 当前生效的描述文件合集，未加载时为 nil(Decode 对 nil 安全，按字段编号解码)
+func CurrentRegistry() *Registry {
+	return current.Load()
+}
+
+// SetRegistry 热替换描述文件合集，正在解码的请求继续用旧的
+func SetRegistry(r *Registry) {
+	current.Store(r)
+}
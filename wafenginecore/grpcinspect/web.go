@@ -0,0 +1,125 @@
+package grpcinspect
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TranslateResponse 把后端的 gRPC 响应改写成 gRPC-Web：改 Content-Type，数据帧原样透传，
+// 读到结尾时把 HTTP/2 trailer 编成 0x80 帧追加在报文末尾(浏览器拿不到 trailer)；-text 形态整体 base64。
+// Trailers-Only 响应的 grpc-status 本来就在响应头里，不用再补帧
+func TranslateResponse(resp *http.Response, kind Kind) {
+	resp.Header.Set("Content-Type", WebContentType(kind, resp.Header.Get("Content-Type")))
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	// 后端声明的 trailer 改成报文里的 trailer 帧，不再作为 HTTP trailer 下发
+	resp.Trailer = nil
+	resp.Header.Del("Trailer")
+	resp.Body = &webBody{resp: resp, src: resp.Body, text: kind == WebText, buf: make([]byte, 32<<10)}
+}
+
+type webBody struct {
+	resp  *http.Response
+	src   io.ReadCloser
+	text  bool
+	buf   []byte
+	carry []byte //text 形态下不足 3 字节、留到下一块一起编码的部分
+	out   []byte
+	eof   bool
+	err   error
+}
+
+func (b *webBody) Read(p []byte) (int, error) {
+	for len(b.out) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.eof {
+			return 0, io.EOF
+		}
+		b.fill()
+	}
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+func (b *webBody) fill() {
+	n, err := b.src.Read(b.buf)
+	data := b.buf[:n]
+	if err == io.EOF {
+		b.eof = true
+		// HTTP/2 的 trailer 在 body 读完时才填进 resp.Trailer；取走后清空，免得反向代理再按 HTTP trailer 下发
+		data = append(data, trailerFrame(b.resp.Trailer)...)
+		b.resp.Trailer = nil
+	} else if err != nil {
+		b.err = err
+	}
+	b.emit(data)
+}
+
+func (b *webBody) emit(data []byte) {
+	if !b.text {
+		b.out = append(b.out, data...)
+		return
+	}
+	data = append(b.carry, data...)
+	keep := len(data) % 3
+	if b.eof {
+		keep = 0
+	}
+	full := data[:len(data)-keep]
+	if len(full) > 0 {
+		enc := make([]byte, base64.StdEncoding.EncodedLen(len(full)))
+		base64.StdEncoding.Encode(enc, full)
+		b.out = append(b.out, enc...)
+	}
+	b.carry = append([]byte(nil), data[len(data)-keep:]...)
+}
+
+func (b *webBody) Close() error {
+	return b.src.Close()
+}
+
+// trailerFrame 把 trailer 编成 gRPC-Web 的 trailer 帧，没有 trailer 时返回空
+func trailerFrame(trailer http.Header) []byte {
+	if len(trailer) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			sb.WriteString(strings.ToLower(k) + ":" + v + "\r\n")
+		}
+	}
+	out := make([]byte, headerLen, headerLen+sb.Len())
+	out[0] = flagTrailer
+	binary.BigEndian.PutUint32(out[1:], uint32(sb.Len()))
+	return append(out, sb.String()...)
+}
+
+// ExposeHeaders 跨域时需要暴露给浏览器脚本的响应头，gRPC-Web 客户端靠它们拿调用结果
+const ExposeHeaders = "grpc-status, grpc-message, grpc-status-details-bin"
+
+// AllowOrigin 请求来源是否在允许列表(逗号分隔，* 任意)里，允许时返回要回写的 Access-Control-Allow-Origin
+func AllowOrigin(origins string, origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+	for _, o := range strings.Split(origins, ",") {
+		o = strings.TrimSpace(o)
+		if o == "*" || strings.EqualFold(o, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,105 @@
+package grpcinspect
+
+import (
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxWireDepth 按字段编号解码时嵌套消息的最大展开深度
+const maxWireDepth = 16
+
+// DecodeRaw 没有描述文件时按 protobuf 线格式解码：键为字段编号，重复字段成数组，嵌套消息成对象。
+// 长度前缀字段有歧义(字符串/字节/嵌套消息)：可打印的 UTF-8 当字符串，能完整解析的当嵌套消息，其余丢弃。
+// 字符串是检测的重点，数值只为日志可读
+func DecodeRaw(data []byte) (map[string]interface{}, bool) {
+	return decodeRaw(data, 0)
+}
+
+func decodeRaw(data []byte, depth int) (map[string]interface{}, bool) {
+	out := map[string]interface{}{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, false
+		}
+		data = data[n:]
+		var value interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, false
+			}
+			value, data = json.Number(strconv.FormatUint(v, 10)), data[n:]
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return nil, false
+			}
+			value, data = json.Number(strconv.FormatUint(uint64(v), 10)), data[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return nil, false
+			}
+			value, data = json.Number(strconv.FormatUint(v, 10)), data[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, false
+			}
+			data = data[n:]
+			value = decodeBytesField(v, depth)
+		case protowire.StartGroupType:
+			// 已废弃的 group，整段跳过
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, false
+			}
+			data = data[n:]
+		default:
+			return nil, false
+		}
+		if value == nil {
+			continue
+		}
+		key := strconv.Itoa(int(num))
+		switch prev := out[key].(type) {
+		case nil:
+			out[key] = value
+		case []interface{}:
+			out[key] = append(prev, value)
+		default:
+			out[key] = []interface{}{prev, value}
+		}
+	}
+	return out, true
+}
+
+func decodeBytesField(v []byte, depth int) interface{} {
+	if printableText(v) {
+		return string(v)
+	}
+	if depth < maxWireDepth {
+		if nested, ok := decodeRaw(v, depth+1); ok && len(nested) > 0 {
+			return nested
+		}
+	}
+	return nil
+}
+
+// printableText 合法 UTF-8 且没有换行制表以外的控制字符
+func printableText(v []byte) bool {
+	if len(v) == 0 || !utf8.Valid(v) {
+		return false
+	}
+	for _, c := range v {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
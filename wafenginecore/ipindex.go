@@ -4,6 +4,7 @@ import (
 	"SamWaf/model"
 	"SamWaf/wafenginecore/ipset"
 	"net"
+	"time"
 )
 
 // BuildIPBlockIndex 由手工 IP 黑名单编译快速匹配索引(MatchSet)，供请求热路径 O(1)/常数级判定。
@@ -12,13 +13,17 @@ import (
 // 引用 IP 组的行(IpType==group)不进本索引：组内容由 ipset 全局原子快照实时提供，
 // 这样改组时无需重建任何站点的索引，所有引用站点同时生效。
 // 判定条件写 == IPEntryTypeGroup 而非 != IPEntryTypeIP —— 存量行的 ip_type 是空串。
+//
+// 已到期的临时条目不进索引。索引只在名单变更时重建，到期的那一刻并不会自动剔除，
+// 由定时任务(TaskListExpireSweep)删除到期行并重新下发名单，误差不超过任务周期。
 func BuildIPBlockIndex(list []model.IPBlockList) *ipset.MatchSet {
 	if len(list) == 0 {
 		return nil
 	}
+	now := time.Now().Unix()
 	ips := make([]string, 0, len(list))
 	for i := 0; i < len(list); i++ {
-		if list[i].IpType == model.IPEntryTypeGroup {
+		if list[i].IpType == model.IPEntryTypeGroup || model.ListEntryExpired(list[i].ExpireTime, now) {
 			continue
 		}
 		ips = append(ips, list[i].Ip)
@@ -31,9 +36,10 @@ func BuildIPAllowIndex(list []model.IPAllowList) *ipset.MatchSet {
 	if len(list) == 0 {
 		return nil
 	}
+	now := time.Now().Unix()
 	ips := make([]string, 0, len(list))
 	for i := 0; i < len(list); i++ {
-		if list[i].IpType == model.IPEntryTypeGroup {
+		if list[i].IpType == model.IPEntryTypeGroup || model.ListEntryExpired(list[i].ExpireTime, now) {
 			continue
 		}
 		ips = append(ips, list[i].Ip)
@@ -50,10 +56,11 @@ func ExtractBlockGroupCodes(list []model.IPBlockList) []string {
 	if len(list) == 0 {
 		return nil
 	}
+	now := time.Now().Unix()
 	seen := make(map[string]struct{})
 	var codes []string
 	for i := 0; i < len(list); i++ {
-		if list[i].IpType != model.IPEntryTypeGroup || list[i].GroupCode == "" {
+		if list[i].IpType != model.IPEntryTypeGroup || list[i].GroupCode == "" || model.ListEntryExpired(list[i].ExpireTime, now) {
 			continue
 		}
 		if _, ok := seen[list[i].GroupCode]; ok {
@@ -70,10 +77,11 @@ func ExtractAllowGroupCodes(list []model.IPAllowList) []string {
 	if len(list) == 0 {
 		return nil
 	}
+	now := time.Now().Unix()
 	seen := make(map[string]struct{})
 	var codes []string
 	for i := 0; i < len(list); i++ {
-		if list[i].IpType != model.IPEntryTypeGroup || list[i].GroupCode == "" {
+		if list[i].IpType != model.IPEntryTypeGroup || list[i].GroupCode == "" || model.ListEntryExpired(list[i].ExpireTime, now) {
 			continue
 		}
 		if _, ok := seen[list[i].GroupCode]; ok {
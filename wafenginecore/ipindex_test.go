@@ -0,0 +1,59 @@
+package wafenginecore
+
+import (
+	"SamWaf/model"
+	"testing"
+	"time"
+)
+
+// 到期的临时条目不进索引；永久条目和未到期条目照常生效
+func TestBuildIPIndex_SkipsExpiredEntries(t *testing.T) {
+	now := time.Now().Unix()
+	block := BuildIPBlockIndex([]model.IPBlockList{
+		{Ip: "1.1.1.1"},
+		{Ip: "2.2.2.2", ExpireTime: now - 10},
+		{Ip: "3.3.3.0/24", ExpireTime: now + 3600},
+	})
+	if block == nil {
+		t.Fatalf("索引不应为空")
+	}
+	if !block.ContainsStr("1.1.1.1") {
+		t.Fatalf("永久条目应命中")
+	}
+	if block.ContainsStr("2.2.2.2") {
+		t.Fatalf("已到期条目不应命中")
+	}
+	if !block.ContainsStr("3.3.3.8") {
+		t.Fatalf("未到期条目应命中")
+	}
+
+	allow := BuildIPAllowIndex([]model.IPAllowList{{Ip: "4.4.4.4", ExpireTime: now}})
+	if allow != nil && allow.ContainsStr("4.4.4.4") {
+		t.Fatalf("到期时刻当秒即视为到期")
+	}
+}
+
+// 引用IP组的条目到期后，组短码也不再下发给引擎
+func TestExtractGroupCodes_SkipsExpiredEntries(t *testing.T) {
+	now := time.Now().Unix()
+	codes := ExtractBlockGroupCodes([]model.IPBlockList{
+		{IpType: model.IPEntryTypeGroup, GroupCode: "g1"},
+		{IpType: model.IPEntryTypeGroup, GroupCode: "g2", ExpireTime: now - 1},
+	})
+	if len(codes) != 1 || codes[0] != "g1" {
+		t.Fatalf("期望只剩 g1，实际 %v", codes)
+	}
+}
+
+func TestResolveListExpireTime(t *testing.T) {
+	now := int64(1_000_000)
+	if got := model.ResolveListExpireTime(2, 123, now); got != now+7200 {
+		t.Fatalf("按小时换算错误: %d", got)
+	}
+	if got := model.ResolveListExpireTime(0, 123, now); got != 123 {
+		t.Fatalf("未传小时数应沿用到期时间: %d", got)
+	}
+	if got := model.ResolveListExpireTime(0, -5, now); got != 0 {
+		t.Fatalf("非法到期时间应视为永久: %d", got)
+	}
+}
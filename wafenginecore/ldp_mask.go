@@ -0,0 +1,87 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/ldpmask"
+	"strings"
+)
+
+// 隐私保护
+//
+// 命中的 URL 规则分两类：没有配置脱敏策略(mask_json 为空)的沿用旧行为，整个响应体按 godlp 默认规则脱敏；
+// 配置了策略的只处理指定的 JSON 字段、正文里识别器命中的内容或指定响应头，且可按客户端IP/访问认证账号豁免。
+
+// ldpUrlMatch 隐私保护URL规则是否命中，请求地址需已转小写
+func ldpUrlMatch(rule model.LDPUrl, lowerRequestURI string) bool {
+	lowerRuleURL := strings.ToLower(rule.Url)
+	return (rule.CompareType == "等于" && lowerRuleURL == lowerRequestURI) ||
+		(rule.CompareType == "前缀匹配" && strings.HasPrefix(lowerRequestURI, lowerRuleURL)) ||
+		(rule.CompareType == "后缀匹配" && strings.HasSuffix(lowerRequestURI, lowerRuleURL)) ||
+		(rule.CompareType == "包含匹配" && strings.Contains(lowerRequestURI, lowerRuleURL))
+}
+
+// matchLdpPolicies 按请求地址匹配网站与全局的隐私保护规则，
+// 返回是否需要整页脱敏、对该访客生效(未豁免)的字段级脱敏策略，以及是否有策略因豁免被跳过。
+// 有豁免时响应是未脱敏的原文，不能写进缓存给其他访客用
+func (waf *WafEngine) matchLdpPolicies(host string, requestURI string, clientIP string, accessUser string) (bool, []*ldpmask.Policy, bool) {
+	lowerRequestURI := strings.ToLower(requestURI)
+	wholeBody := false
+	exempted := false
+	var policies []*ldpmask.Policy
+
+	//注意：host 解析不到或全局网站还没登记进路由快照时为 nil，必须判空
+	localHost := waf.rt().HostTarget[host]
+	globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
+	hosts := []*wafenginmodel.HostSafe{localHost}
+	if globalHost != localHost {
+		hosts = append(hosts, globalHost)
+	}
+	for _, hostSafe := range hosts {
+		if hostSafe == nil {
+			continue
+		}
+		for _, rule := range hostSafe.LdpUrlLists {
+			if !ldpUrlMatch(rule, lowerRequestURI) {
+				continue
+			}
+			if rule.MaskJSON == "" {
+				wholeBody = true
+				continue
+			}
+			policy, err := ldpmask.Get(rule.MaskJSON)
+			if err != nil {
+				continue
+			}
+			if policy.Exempt(clientIP, accessUser) {
+				exempted = true
+				continue
+			}
+			policies = append(policies, policy)
+		}
+	}
+	return wholeBody, policies, exempted
+}
+
+// ldpClientIP 豁免判断用的客户端IP，按网站的IP获取模式取值；
+// 网卡模式下 SRC_IP 可被 X-Forwarded-For 伪造，不能拿来判豁免
+func (waf *WafEngine) ldpClientIP(host string, weblog *innerbean.WebLog) string {
+	ipMode := ""
+	if hostSafe := waf.rt().HostTarget[host]; hostSafe != nil {
+		ipMode = hostSafe.Host.IPMode
+	}
+	return model.GetClientIPByMode(ipMode, weblog.NetSrcIp, weblog.SRC_IP)
+}
+
+// recordMaskHits 命中明细追加到 weblog
+func recordMaskHits(weblogbean *innerbean.WebLog, hits ldpmask.Hits) {
+	if len(hits) == 0 {
+		return
+	}
+	if weblogbean.MASK_HITS != "" {
+		weblogbean.MASK_HITS += "\n"
+	}
+	weblogbean.MASK_HITS += hits.String()
+}
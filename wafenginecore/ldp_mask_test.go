@@ -0,0 +1,110 @@
+package wafenginecore
+
+import (
+	"SamWaf/cache"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/wafenginecore/wafwebcache"
+	"SamWaf/wafproxy"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 豁免访客先访问时拿到的是未脱敏原文，不能写进缓存，否则后来的普通访客会从缓存拿到原文
+func TestLdpExemptResponseNotCached(t *testing.T) {
+	if global.GCACHE_WAFCACHE == nil {
+		global.GCACHE_WAFCACHE = cache.InitWafCache()
+	}
+	const hostCode, hostKey = "ldp-cache-host", "ldp-cache.test:80"
+	waf := newBufferingTestEngine(hostCode, hostKey, bufferingOn)
+	hostSafe := waf.rt().HostTarget[hostKey]
+	hostSafe.Host.CacheJSON = `{"is_enable_cache":1,"cache_location":"memory"}`
+	hostSafe.CacheRule = []model.CacheRule{{HostCode: hostCode, RuleType: 2, RuleContent: "/", ParamType: 2, CacheTime: 60}}
+	hostSafe.LdpUrlLists = []model.LDPUrl{{HostCode: hostCode, CompareType: "前缀匹配", Url: "/profile",
+		MaskJSON: `{"rules":[{"target":"header","path":"x-user-phone","detector":"phone"}],"exempt_ips":"10.0.0.0/8"}`}}
+	cacheConfig := model.CacheConfig{IsEnableCache: 1, CacheLocation: "memory"}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-User-Phone", "13812345678")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+	proxy := wafproxy.NewSingleHostReverseProxyCustomHeader(target, map[string]string{}, map[string]string{})
+	proxy.ModifyResponse = waf.modifyResponse()
+
+	visit := func(clientIP string) http.Header {
+		r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		weblog := &innerbean.WebLog{URL: r.URL.Path, HOST_CODE: hostCode, NetSrcIp: clientIP, SRC_IP: clientIP, UNIX_ADD_TIME: time.Now().UnixNano() / 1e6}
+		ctx := context.WithValue(r.Context(), "waf_context", innerbean.WafHttpContextData{HostCode: hostCode, Weblog: weblog})
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, r.WithContext(ctx))
+		return rec.Header()
+	}
+	loadCache := func() *http.Response {
+		weblog := &innerbean.WebLog{}
+		r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		resp := wafwebcache.LoadWebDataFormCache(httptest.NewRecorder(), r, hostSafe, cacheConfig, weblog)
+		wafwebcache.ReleaseFlight(weblog)
+		return resp
+	}
+
+	if h := visit("10.1.2.3"); h.Get("X-User-Phone") != "13812345678" {
+		t.Fatalf("豁免访客应拿到原文: %s", h.Get("X-User-Phone"))
+	}
+	if resp := loadCache(); resp != nil {
+		t.Fatalf("豁免访客的响应不应写入缓存: %s", resp.Header.Get("X-User-Phone"))
+	}
+
+	if h := visit("1.1.1.1"); h.Get("X-User-Phone") != "138****5678" {
+		t.Fatalf("普通访客应拿到脱敏后的内容: %s", h.Get("X-User-Phone"))
+	}
+	resp := loadCache()
+	if resp == nil || resp.Header.Get("X-User-Phone") != "138****5678" {
+		t.Fatalf("缓存里应是脱敏后的内容: %v", resp)
+	}
+}
+
+// 网卡模式下 SRC_IP 来自 X-Forwarded-For，可被伪造；豁免只认真实连接IP，代理模式才认 SRC_IP
+func TestLdpExemptUsesClientIPByMode(t *testing.T) {
+	const hostCode, hostKey = "ldp-ipmode-host", "ldp-ipmode.test:80"
+	waf := newBufferingTestEngine(hostCode, hostKey, bufferingOn)
+	hostSafe := waf.rt().HostTarget[hostKey]
+	hostSafe.LdpUrlLists = []model.LDPUrl{{HostCode: hostCode, CompareType: "前缀匹配", Url: "/profile",
+		MaskJSON: `{"rules":[{"target":"header","path":"x-user-phone","detector":"phone"}],"exempt_ips":"10.0.0.0/8"}`}}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-Phone", "13812345678")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+	proxy := wafproxy.NewSingleHostReverseProxyCustomHeader(target, map[string]string{}, map[string]string{})
+	proxy.ModifyResponse = waf.modifyResponse()
+
+	// 真实连接来自公网，X-Forwarded-For 伪造成豁免网段
+	visit := func() string {
+		r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		r.Header.Set("X-Forwarded-For", "10.1.2.3")
+		weblog := &innerbean.WebLog{URL: r.URL.Path, HOST_CODE: hostCode, NetSrcIp: "1.1.1.1", SRC_IP: "10.1.2.3", UNIX_ADD_TIME: time.Now().UnixNano() / 1e6}
+		ctx := context.WithValue(r.Context(), "waf_context", innerbean.WafHttpContextData{HostCode: hostCode, Weblog: weblog})
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, r.WithContext(ctx))
+		return rec.Header().Get("X-User-Phone")
+	}
+
+	hostSafe.Host.IPMode = "nic"
+	if got := visit(); got != "138****5678" {
+		t.Fatalf("网卡模式下伪造 X-Forwarded-For 不应获得豁免: %s", got)
+	}
+	hostSafe.Host.IPMode = "proxy"
+	if got := visit(); got != "13812345678" {
+		t.Fatalf("代理模式下应按 X-Forwarded-For 判豁免: %s", got)
+	}
+}
@@ -0,0 +1,462 @@
+// Package ldpmask 隐私保护的字段级脱敏：按 JSON 路径、正文识别器或响应头名，选择性地给响应打码。
+//
+// 单独成包的原因与 accessgate 相同：管理端保存规则时要用同一份编译逻辑做校验(service/waf_service)，
+// 而 wafenginecore 已经 import 了 service/waf_service，放在 wafenginecore 里会形成 import cycle。
+//
+// 策略按 mask_json 原文编译后缓存。规则改动后原文随之变化，旧的编译结果自然不再被命中，
+// 不需要额外的失效通知。
+package ldpmask
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/model"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 内置识别器。\b 保证不会从更长的数字串里截一段出来
+var (
+	phoneRe    = regexp.MustCompile(`\b1[3-9]\d{9}\b`)
+	idCardRe   = regexp.MustCompile(`\b(\d{17}[\dXx]|\d{15})\b`)
+	bankCardRe = regexp.MustCompile(`\b\d{16,19}\b`)
+	emailRe    = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// Policy 编译后的脱敏策略，一经编译即只读
+type Policy struct {
+	rules       []rule
+	salt        []byte
+	exemptNets  []*net.IPNet
+	exemptUsers map[string]bool
+}
+
+type rule struct {
+	name     string
+	target   string
+	path     []string //json 路径段
+	header   string   //规范化后的响应头名
+	detector string
+	re       *regexp.Regexp //识别器正则，nil 表示整个字段值
+	style    string
+}
+
+// Hits 每条规则的命中次数，键是规则名
+type Hits map[string]int
+
+// String 按规则名排序输出，多条以换行分隔，写入 weblog.MASK_HITS
+func (h Hits) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s ×%d", name, h[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type cacheEntry struct {
+	policy *Policy
+	err    error
+}
+
+var policyCache sync.Map
+
+// Get 取编译后的策略，按原文缓存；编译失败的结果同样缓存，只在第一次记日志
+func Get(maskJSON string) (*Policy, error) {
+	if v, ok := policyCache.Load(maskJSON); ok {
+		e := v.(*cacheEntry)
+		return e.policy, e.err
+	}
+	p, err := Compile(maskJSON)
+	if err != nil {
+		zlog.Warn("隐私保护脱敏策略无效，已跳过", "error", err.Error())
+	}
+	policyCache.Store(maskJSON, &cacheEntry{policy: p, err: err})
+	return p, err
+}
+
+// Compile 校验并编译脱敏策略，错误信息直接给管理端展示
+func Compile(maskJSON string) (*Policy, error) {
+	cfg, err := model.ParseLDPMaskPolicy(maskJSON)
+	if err != nil {
+		return nil, fmt.Errorf("脱敏策略不是合法的 JSON: %w", err)
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("脱敏策略至少需要一条规则")
+	}
+	p := &Policy{salt: []byte(cfg.HashSalt), exemptUsers: map[string]bool{}}
+	for i, rc := range cfg.Rules {
+		r := rule{name: strings.TrimSpace(rc.Name), target: rc.Target, detector: rc.Detector, style: rc.Style}
+		if r.style == "" {
+			r.style = model.LDPMaskStylePartial
+		}
+		switch r.style {
+		case model.LDPMaskStylePartial, model.LDPMaskStyleHash, model.LDPMaskStyleFull:
+		default:
+			return nil, fmt.Errorf("第 %d 条规则的掩码方式 %s 无效", i+1, rc.Style)
+		}
+		switch rc.Detector {
+		case model.LDPDetectorAll:
+		case model.LDPDetectorPhone:
+			r.re = phoneRe
+		case model.LDPDetectorIDCard:
+			r.re = idCardRe
+		case model.LDPDetectorBankCard:
+			r.re = bankCardRe
+		case model.LDPDetectorEmail:
+			r.re = emailRe
+		case model.LDPDetectorCustom:
+			if rc.Pattern == "" {
+				return nil, fmt.Errorf("第 %d 条规则选择了自定义识别器但没有填写正则", i+1)
+			}
+			if r.re, err = regexp.Compile(rc.Pattern); err != nil {
+				return nil, fmt.Errorf("第 %d 条规则的正则无效: %w", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("第 %d 条规则的识别器 %s 无效", i+1, rc.Detector)
+		}
+		path := strings.TrimSpace(rc.Path)
+		switch rc.Target {
+		case model.LDPMaskTargetJSON:
+			path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+			if path == "" {
+				return nil, fmt.Errorf("第 %d 条规则没有填写 JSON 路径", i+1)
+			}
+			r.path = strings.Split(path, ".")
+		case model.LDPMaskTargetBody:
+			if r.re == nil {
+				return nil, fmt.Errorf("第 %d 条规则作用于整个响应体，必须选择识别器", i+1)
+			}
+			path = rc.Detector
+		case model.LDPMaskTargetHeader:
+			if path == "" {
+				return nil, fmt.Errorf("第 %d 条规则没有填写响应头名", i+1)
+			}
+			r.header = http.CanonicalHeaderKey(path)
+		default:
+			return nil, fmt.Errorf("第 %d 条规则的脱敏目标 %s 无效", i+1, rc.Target)
+		}
+		if r.name == "" {
+			r.name = rc.Target + ":" + path
+		}
+		p.rules = append(p.rules, r)
+	}
+	for _, s := range splitList(cfg.ExemptIPs) {
+		ipNet, err := parseIPOrCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("豁免IP %s 无效", s)
+		}
+		p.exemptNets = append(p.exemptNets, ipNet)
+	}
+	for _, s := range splitList(cfg.ExemptAccessUsers) {
+		p.exemptUsers[strings.ToLower(s)] = true
+	}
+	return p, nil
+}
+
+// Exempt 访客是否豁免：客户端IP在豁免网段内，或是豁免的统一访问认证账号
+func (p *Policy) Exempt(clientIP, accessUser string) bool {
+	if accessUser != "" && p.exemptUsers[strings.ToLower(accessUser)] {
+		return true
+	}
+	if len(p.exemptNets) == 0 {
+		return false
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.exemptNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskHeaders 按 header 规则脱敏响应头
+func (p *Policy) MaskHeaders(h http.Header, hits Hits) {
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.target != model.LDPMaskTargetHeader {
+			continue
+		}
+		values := h[r.header]
+		for j, v := range values {
+			if nv, n := p.maskValue(r, v); n > 0 {
+				values[j] = nv
+				hits[r.name] += n
+			}
+		}
+	}
+}
+
+// MaskBody 先按 json 规则处理(响应体是 JSON 时)，再按 body 规则在整个文本里查找替换。
+// 没有任何命中时原样返回，不会重新序列化 JSON
+func (p *Policy) MaskBody(body []byte, hits Hits) []byte {
+	if doc, ok := decodeJSON(body); ok {
+		changed := false
+		for i := range p.rules {
+			r := &p.rules[i]
+			if r.target != model.LDPMaskTargetJSON {
+				continue
+			}
+			var ok bool
+			doc, ok = walk(doc, r.path, func(s string) (string, bool) {
+				nv, n := p.maskValue(r, s)
+				if n == 0 {
+					return s, false
+				}
+				hits[r.name] += n
+				return nv, true
+			})
+			changed = changed || ok
+		}
+		if changed {
+			if out, err := encodeJSON(doc); err == nil {
+				body = out
+			}
+		}
+	}
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.target != model.LDPMaskTargetBody {
+			continue
+		}
+		n := 0
+		masked := r.re.ReplaceAllStringFunc(string(body), func(m string) string {
+			if !validDetected(r.detector, m) {
+				return m
+			}
+			n++
+			return p.mask(r, m)
+		})
+		if n > 0 {
+			body = []byte(masked)
+			hits[r.name] += n
+		}
+	}
+	return body
+}
+
+// maskValue 识别器为空时整个值打码，否则只替换识别器命中的部分；返回新值与命中次数
+func (p *Policy) maskValue(r *rule, v string) (string, int) {
+	if v == "" {
+		return v, 0
+	}
+	if r.re == nil {
+		return p.mask(r, v), 1
+	}
+	n := 0
+	out := r.re.ReplaceAllStringFunc(v, func(m string) string {
+		if !validDetected(r.detector, m) {
+			return m
+		}
+		n++
+		return p.mask(r, m)
+	})
+	return out, n
+}
+
+func (p *Policy) mask(r *rule, s string) string {
+	switch r.style {
+	case model.LDPMaskStyleFull:
+		return strings.Repeat("*", utf8.RuneCountInString(s))
+	case model.LDPMaskStyleHash:
+		mac := hmac.New(sha256.New, p.salt)
+		mac.Write([]byte(s))
+		return "#" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	switch r.detector {
+	case model.LDPDetectorPhone, model.LDPDetectorIDCard:
+		return keepEnds(s, 3, 4)
+	case model.LDPDetectorBankCard:
+		return keepEnds(s, 4, 4)
+	case model.LDPDetectorEmail:
+		if at := strings.LastIndexByte(s, '@'); at > 0 {
+			first, _ := utf8.DecodeRuneInString(s)
+			return string(first) + "***" + s[at:]
+		}
+	}
+	n := utf8.RuneCountInString(s)
+	return keepEnds(s, n/4, n/4)
+}
+
+// keepEnds 保留首 head 个、尾 tail 个字符，中间打码；太短时全部打码
+func keepEnds(s string, head, tail int) string {
+	runes := []rune(s)
+	if len(runes) <= head+tail {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:head]) + strings.Repeat("*", len(runes)-head-tail) + string(runes[len(runes)-tail:])
+}
+
+// validDetected 身份证号校验 18 位校验码，银行卡号做 Luhn 校验，减少把订单号之类的数字误当成证件号
+func validDetected(detector, s string) bool {
+	switch detector {
+	case model.LDPDetectorIDCard:
+		if len(s) == 18 {
+			return idCardChecksum(s)
+		}
+	case model.LDPDetectorBankCard:
+		return luhn(s)
+	}
+	return true
+}
+
+func idCardChecksum(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(s[i]-'0') * weights[i]
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(s[17:])[0]
+}
+
+func luhn(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// walk 按路径找到叶子值交给 fn 处理。* 匹配任意键或数组元素；路径遇到数组时自动展开到每个元素；
+// 落在字符串数组上时逐个处理。只处理字符串与数字，数字脱敏后变为字符串
+func walk(node interface{}, path []string, fn func(string) (string, bool)) (interface{}, bool) {
+	if len(path) == 0 {
+		switch v := node.(type) {
+		case string:
+			return fn(v)
+		case json.Number:
+			if nv, ok := fn(v.String()); ok {
+				return nv, true
+			}
+		case []interface{}:
+			changed := false
+			for i := range v {
+				if nv, ok := walk(v[i], nil, fn); ok {
+					v[i], changed = nv, true
+				}
+			}
+			return v, changed
+		}
+		return node, false
+	}
+	seg := path[0]
+	switch v := node.(type) {
+	case map[string]interface{}:
+		changed := false
+		for k, child := range v {
+			if seg != "*" && k != seg {
+				continue
+			}
+			if nv, ok := walk(child, path[1:], fn); ok {
+				v[k], changed = nv, true
+			}
+		}
+		return v, changed
+	case []interface{}:
+		if idx, err := strconv.Atoi(seg); err == nil {
+			if idx >= 0 && idx < len(v) {
+				if nv, ok := walk(v[idx], path[1:], fn); ok {
+					v[idx] = nv
+					return v, true
+				}
+			}
+			return v, false
+		}
+		rest := path
+		if seg == "*" {
+			rest = path[1:]
+		}
+		changed := false
+		for i := range v {
+			if nv, ok := walk(v[i], rest, fn); ok {
+				v[i], changed = nv, true
+			}
+		}
+		return v, changed
+	}
+	return node, false
+}
+
+// decodeJSON 只接受完整的 JSON 对象/数组，数字保留原文
+func decodeJSON(body []byte) (interface{}, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return doc, true
+}
+
+// encodeJSON 不转义 HTML 字符，尽量保持与源站输出一致
+func encodeJSON(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func splitList(s string) []string {
+	fields := strings.FieldsFunc(s, func(c rune) bool { return c == '\n' || c == '\r' || c == ',' })
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
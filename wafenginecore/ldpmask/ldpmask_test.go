@@ -0,0 +1,99 @@
+package ldpmask
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func mustCompile(t *testing.T, maskJSON string) *Policy {
+	t.Helper()
+	p, err := Compile(maskJSON)
+	if err != nil {
+		t.Fatalf("编译脱敏策略失败: %v", err)
+	}
+	return p
+}
+
+func TestMaskBodyJSONPath(t *testing.T) {
+	p := mustCompile(t, `{"rules":[
+		{"name":"手机号","target":"json","path":"data.list.phone","detector":"phone"},
+		{"name":"工号","target":"json","path":"data.list.*.emp_no","style":"full"},
+		{"target":"json","path":"data.owner.email","detector":"email"}
+	]}`)
+	body := `{"data":{"list":[{"phone":"13812345678","name":"<a>","emp_no":"E1001"},{"phone":13912345678}],"owner":{"email":"alice@example.com"}}}`
+	hits := Hits{}
+	out := string(p.MaskBody([]byte(body), hits))
+	for _, want := range []string{`"phone":"138****5678"`, `"phone":"139****5678"`, `"emp_no":"*****"`, `"email":"a***@example.com"`, `"name":"<a>"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("脱敏结果缺少 %s: %s", want, out)
+		}
+	}
+	if hits["手机号"] != 2 || hits["工号"] != 1 || hits["json:data.owner.email"] != 1 {
+		t.Fatalf("命中统计不正确: %v", hits)
+	}
+
+	// 没有命中时原样返回，不重新序列化
+	untouched := `{"b":1, "a":2}`
+	if got := string(p.MaskBody([]byte(untouched), Hits{})); got != untouched {
+		t.Fatalf("未命中时不应改动响应体: %s", got)
+	}
+}
+
+func TestMaskBodyDetectors(t *testing.T) {
+	p := mustCompile(t, `{"rules":[
+		{"target":"body","detector":"idcard"},
+		{"target":"body","detector":"bankcard","style":"hash"},
+		{"target":"body","detector":"custom","pattern":"EMP-\\d{4}"}
+	],"hash_salt":"s1"}`)
+	hits := Hits{}
+	out := string(p.MaskBody([]byte("身份证11010519491231002X，订单号110105194912310021，卡号4111111111111111，工号EMP-1234"), hits))
+	if !strings.Contains(out, "110***********002X") || !strings.Contains(out, "110105194912310021") {
+		t.Fatalf("身份证应按校验码识别: %s", out)
+	}
+	if strings.Contains(out, "4111111111111111") || !strings.Contains(out, "卡号#") {
+		t.Fatalf("银行卡应替换为哈希: %s", out)
+	}
+	if !strings.Contains(out, "EM****34") {
+		t.Fatalf("自定义正则应部分打码: %s", out)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("命中统计不正确: %v", hits)
+	}
+
+	other := mustCompile(t, `{"rules":[{"target":"body","detector":"bankcard","style":"hash"}],"hash_salt":"s2"}`)
+	if string(other.MaskBody([]byte("4111111111111111"), Hits{})) == string(p.MaskBody([]byte("4111111111111111"), Hits{})) {
+		t.Fatalf("不同盐值的哈希结果应不同")
+	}
+}
+
+func TestMaskHeadersAndExempt(t *testing.T) {
+	p := mustCompile(t, `{"rules":[{"target":"header","path":"x-user-phone","detector":"phone"}],
+		"exempt_ips":"10.0.0.0/8, 192.168.1.5","exempt_access_users":"Auditor"}`)
+	h := http.Header{}
+	h.Set("X-User-Phone", "13812345678")
+	hits := Hits{}
+	p.MaskHeaders(h, hits)
+	if h.Get("X-User-Phone") != "138****5678" || hits["header:x-user-phone"] != 1 {
+		t.Fatalf("响应头脱敏不正确: %s %v", h.Get("X-User-Phone"), hits)
+	}
+	if !p.Exempt("10.1.2.3", "") || !p.Exempt("192.168.1.5", "") || !p.Exempt("1.1.1.1", "auditor") || p.Exempt("1.1.1.1", "bob") {
+		t.Fatalf("豁免判定不正确")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, bad := range []string{
+		`not json`,
+		`{"rules":[]}`,
+		`{"rules":[{"target":"body"}]}`,
+		`{"rules":[{"target":"json","path":""}]}`,
+		`{"rules":[{"target":"json","path":"a","detector":"custom","pattern":"("}]}`,
+		`{"rules":[{"target":"json","path":"a","style":"blur"}]}`,
+		`{"rules":[{"target":"json","path":"a"}],"exempt_ips":"bad-ip"}`,
+	} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("应拒绝无效策略: %s", bad)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"SamWaf/innerbean"
 	"SamWaf/model"
 	"SamWaf/utils"
+	"SamWaf/wafenginecore/ldpmask"
 	"io"
 	"strings"
 	"time"
@@ -167,47 +168,20 @@ func (sp *StreamProcessor) processLine(line string) string {
 func (sp *StreamProcessor) processPrivacyProtection(data string) string {
 	// 检查是否需要进行隐私保护
 	host := sp.wafEngine.rt().HostCode[sp.wafContext.HostCode]
-	lowerRequestURI := strings.ToLower(sp.wafContext.Weblog.URL)
-
-	ldpFlag := false
-
-	// 检查局部隐私保护规则
-	//注意：host 解析不到时 HostTarget[host] 为 nil，必须判空，否则解引用 panic
-	localHost := sp.wafEngine.rt().HostTarget[host]
-	if localHost != nil {
-		for i := 0; i < len(localHost.LdpUrlLists); i++ {
-			lowerRuleURL := strings.ToLower(localHost.LdpUrlLists[i].Url)
-
-			if (localHost.LdpUrlLists[i].CompareType == "等于" && lowerRuleURL == lowerRequestURI) ||
-				(localHost.LdpUrlLists[i].CompareType == "前缀匹配" && strings.HasPrefix(lowerRequestURI, lowerRuleURL)) ||
-				(localHost.LdpUrlLists[i].CompareType == "后缀匹配" && strings.HasSuffix(lowerRequestURI, lowerRuleURL)) ||
-				(localHost.LdpUrlLists[i].CompareType == "包含匹配" && strings.Contains(lowerRequestURI, lowerRuleURL)) {
-				ldpFlag = true
-				break
-			}
-		}
-	}
-
-	// 检查全局隐私保护规则
-	//注意：全局网站可能还没登记进路由快照（未初始化/正在重载），必须判空，否则解引用 panic
-	globalHost := sp.wafEngine.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
-	if !ldpFlag && globalHost != nil {
-		for i := 0; i < len(globalHost.LdpUrlLists); i++ {
-			lowerGlobalRuleURL := strings.ToLower(globalHost.LdpUrlLists[i].Url)
-
-			if (globalHost.LdpUrlLists[i].CompareType == "等于" && lowerGlobalRuleURL == lowerRequestURI) ||
-				(globalHost.LdpUrlLists[i].CompareType == "前缀匹配" && strings.HasPrefix(lowerRequestURI, lowerGlobalRuleURL)) ||
-				(globalHost.LdpUrlLists[i].CompareType == "后缀匹配" && strings.HasSuffix(lowerRequestURI, lowerGlobalRuleURL)) ||
-				(globalHost.LdpUrlLists[i].CompareType == "包含匹配" && strings.Contains(lowerRequestURI, lowerGlobalRuleURL)) {
-				ldpFlag = true
-				break
-			}
-		}
-	}
+	weblog := sp.wafContext.Weblog
+	ldpFlag, maskPolicies, _ := sp.wafEngine.matchLdpPolicies(host, weblog.URL, sp.wafEngine.ldpClientIP(host, weblog), weblog.AccessUser)
 
 	// 如果需要隐私保护，进行脱敏处理
 	if ldpFlag {
-		return utils.DeSenText(data)
+		data = utils.DeSenText(data)
+	}
+	// 字段级脱敏逐条处理数据行(SSE 的 data 行通常是一段 JSON)。
+	// 流式日志在开始推送时就已入队，命中明细不再回写 weblog
+	if len(maskPolicies) > 0 {
+		hits := ldpmask.Hits{}
+		for _, policy := range maskPolicies {
+			data = string(policy.MaskBody([]byte(data), hits))
+		}
 	}
 
 	return data
@@ -46,7 +46,7 @@ func (waf *WafEngine) ProxyHTTP(w http.ResponseWriter, r *http.Request, host str
 		}
 		proxy.ServeHTTP(w, r.WithContext(ctx))
 	} else {
-		transport := waf.getOrCreateTransport(r, host, 0, model.LoadBalance{}, hostTarget, remoteUrl.Scheme) // 使用缓存的Transport
+		transport := waf.backendTransport(r, host, 0, model.LoadBalance{}, hostTarget, remoteUrl.Scheme)
 		customHeaders := waf.getCustomHeaders(r, host, 0, model.LoadBalance{}, hostTarget)
 		customConfig := map[string]string{}
 		customConfig["IsTransBackDomain"] = strconv.Itoa(hostTarget.Host.IsTransBackDomain)
@@ -55,6 +55,7 @@ func (waf *WafEngine) ProxyHTTP(w http.ResponseWriter, r *http.Request, host str
 		proxy.Transport = transport
 		proxy.ModifyResponse = waf.modifyResponse()
 		proxy.ErrorHandler = waf.errorResponse()
+		proxy.UpgradeHandler = waf.websocketUpgrade()
 
 		// 添加转发耗时记录
 		if wafCtx, ok := ctx.Value("waf_context").(innerbean.WafHttpContextData); ok && wafCtx.Weblog != nil {
@@ -83,7 +84,7 @@ func (waf *WafEngine) pickLoadBalanceProxy(w http.ResponseWriter, r *http.Reques
 		for addrIndex, loadBalance := range hostTarget.LoadBalanceLists {
 			//初始化后端负载
 			zlog.Debug("HTTP REQUEST", weblog.REQ_UUID, weblog.URL, "未初始化")
-			transport := waf.getOrCreateTransport(r, host, 1, loadBalance, hostTarget, remoteUrl.Scheme) // 使用缓存的Transport
+			transport := waf.backendTransport(r, host, 1, loadBalance, hostTarget, remoteUrl.Scheme)
 			customHeaders := waf.getCustomHeaders(r, host, 1, loadBalance, hostTarget)
 			customConfig := map[string]string{}
 			customConfig["IsTransBackDomain"] = strconv.Itoa(hostTarget.Host.IsTransBackDomain)
@@ -92,6 +93,7 @@ func (waf *WafEngine) pickLoadBalanceProxy(w http.ResponseWriter, r *http.Reques
 			proxy.Transport = transport
 			proxy.ModifyResponse = waf.modifyResponse()
 			proxy.ErrorHandler = waf.errorResponse()
+			proxy.UpgradeHandler = waf.websocketUpgrade()
 			hostTarget.LoadBalanceRuntime.RevProxies = append(hostTarget.LoadBalanceRuntime.RevProxies, proxy)
 
 			// 初始化策略相关信息
@@ -188,9 +190,12 @@ func (waf *WafEngine) ProxyHTTPWithPathRule(w http.ResponseWriter, r *http.Reque
 
 	proxy := wafproxy.NewSingleHostReverseProxyCustomHeader(remoteUrl, customHeaders, customConfig)
 	waf.applyResponseBuffering(proxy, hostTarget)
-	proxy.Transport = transport
+	proxy.Transport = newGrpcSplitTransport(transport, func() *http.Transport {
+		return grpcTransport(transport, scheme)
+	})
 	proxy.ModifyResponse = waf.modifyResponse()
 	proxy.ErrorHandler = waf.errorResponse()
+	proxy.UpgradeHandler = waf.websocketUpgrade()
 
 	if wafCtx, ok := ctx.Value("waf_context").(innerbean.WafHttpContextData); ok && wafCtx.Weblog != nil {
 		forwardStart := time.Now().UnixNano() / 1e6
@@ -378,7 +383,33 @@ func (waf *WafEngine) createTransport(r *http.Request, host string, isEnableLoad
 func (waf *WafEngine) getOrCreateTransport(r *http.Request, host string, isEnableLoadBalance int, loadBalance model.LoadBalance, hostTarget *wafenginmodel.HostSafe, backendScheme string) *http.Transport {
 	// 生成Transport的唯一键
 	transportKey := waf.generateTransportKey(host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme)
+	return waf.cachedTransport(transportKey, func() *http.Transport {
+		transport, _ := waf.createTransport(r, host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme)
+		return transport
+	})
+}
+
+// getOrCreateGrpcTransport 获取或创建转发 gRPC 用的 HTTP/2 Transport，与同一后端的普通 Transport 分开缓存
+func (waf *WafEngine) getOrCreateGrpcTransport(r *http.Request, host string, isEnableLoadBalance int, loadBalance model.LoadBalance, hostTarget *wafenginmodel.HostSafe, backendScheme string) *http.Transport {
+	transportKey := waf.generateTransportKey(host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme) + "_h2"
+	return waf.cachedTransport(transportKey, func() *http.Transport {
+		transport, _ := waf.createTransport(r, host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme)
+		return grpcTransport(transport, backendScheme)
+	})
+}
+
+// backendTransport 代理用的 Transport：普通请求走缓存的 Transport，gRPC 请求首次出现时再建 HTTP/2 的
+func (waf *WafEngine) backendTransport(r *http.Request, host string, isEnableLoadBalance int, loadBalance model.LoadBalance, hostTarget *wafenginmodel.HostSafe, backendScheme string) http.RoundTripper {
+	transport := waf.getOrCreateTransport(r, host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme) // 使用缓存的Transport
+	// 负载均衡的代理会长期保留，闭包里不留整个请求，createTransport 只看 r.TLS
+	stub := &http.Request{TLS: r.TLS}
+	return newGrpcSplitTransport(transport, func() *http.Transport {
+		return waf.getOrCreateGrpcTransport(stub, host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme)
+	})
+}
 
+// cachedTransport 按键从 TransportPool 取 Transport，没有时用 create 创建并缓存
+func (waf *WafEngine) cachedTransport(transportKey string, create func() *http.Transport) *http.Transport {
 	waf.TransportMux.RLock()
 	if transport, exists := waf.TransportPool[transportKey]; exists {
 		waf.TransportMux.RUnlock()
@@ -395,7 +426,7 @@ func (waf *WafEngine) getOrCreateTransport(r *http.Request, host string, isEnabl
 		return transport
 	}
 
-	transport, _ := waf.createTransport(r, host, isEnableLoadBalance, loadBalance, hostTarget, backendScheme)
+	transport := create()
 
 	// 优化Transport配置
 	/*transport.MaxIdleConns = 1000
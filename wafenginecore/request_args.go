@@ -0,0 +1,47 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/wafenginecore/wafargs"
+	"net/http"
+)
+
+// requestArgs 取本次请求按结构拆出的参数。首个需要的检测项解析一次，结果缓存在 weblogbean 上。
+func requestArgs(r *http.Request, weblogbean *innerbean.WebLog) []innerbean.ReqArg {
+	if weblogbean.ReqArgs != nil {
+		return weblogbean.ReqArgs
+	}
+	var args []innerbean.ReqArg
+	body := weblogbean.SrcByteBody
+	if r != nil {
+		if len(body) == 0 {
+			body = wafargs.ReadBody(r)
+		}
+		args = wafargs.Extract(r, body)
+	} else {
+		args = wafargs.ExtractForm(innerbean.ReqArgSourceQuery, weblogbean.RawQuery)
+	}
+	// 前面已经解析过表单时 r.Body 可能已被读空，POST_FORM 里还留着
+	if len(body) == 0 && weblogbean.POST_FORM != "" {
+		args = append(args, wafargs.ExtractForm(innerbean.ReqArgSourceForm, weblogbean.POST_FORM)...)
+	}
+	if args == nil {
+		args = []innerbean.ReqArg{}
+	}
+	weblogbean.ReqArgs = args
+	return args
+}
+
+// matchReqArg 返回第一个命中的参数。withNames 为 false 时跳过参数名整段(IsName)，
+// 用于 XSS 这类参数名本身（style、href）就容易误报的检测。
+func matchReqArg(args []innerbean.ReqArg, withNames bool, match func(string) bool) (innerbean.ReqArg, bool) {
+	for _, arg := range args {
+		if arg.IsName && !withNames {
+			continue
+		}
+		if match(arg.Value) {
+			return arg, true
+		}
+	}
+	return innerbean.ReqArg{}, false
+}
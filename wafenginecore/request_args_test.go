@@ -0,0 +1,67 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 内置检测逐参数判定，并在日志里记下命中的参数
+func TestBuiltinChecks_ReqArgs(t *testing.T) {
+	waf, hostSafe := newTestWafForXSS()
+	globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]
+
+	bigJSON := `{"items":[` + strings.Repeat(`{"title":"Tom's (new) \"book\" -- 2nd ed.","desc":"a/b; c=d"},`, 200) + `{"title":"end"}]}`
+	cases := []struct {
+		name      string
+		check     string
+		query     string
+		ct        string
+		body      string
+		cookie    string
+		wantBlock bool
+		wantArg   string
+	}{
+		{"JSON嵌套值SQL注入", "sql", "", "application/json", `{"filter":{"name":"1' or '1'='1"}}`, "", true, "json:filter.name"},
+		{"Cookie SQL注入", "sql", "", "", "", "uid=1' union select password from users--", true, "cookie:uid"},
+		{"参数名里的SQL注入", "sql", "1'or'1'='1", "", "", "", true, "query:1'or'1'(参数名)"},
+		{"大JSON正常内容", "sql", "", "application/json", bigJSON, "", false, ""},
+		{"JSON值XSS", "xss", "", "application/json", `{"comment":"<script>alert(1)</script>"}`, "", true, "json:comment"},
+		{"XML值目录穿越", "dir", "", "application/xml", `<req><file>../../etc/passwd</file></req>`, "", true, "xml:req.file"},
+		{"GraphQL变量RCE", "rce", "", "application/json", `{"query":"mutation($h: String) { ping(host: $h) }","variables":{"h":"127.0.0.1; cat /etc/passwd"}}`, "", true, "graphql:variables.h"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://a.com/api", strings.NewReader(c.body))
+			r.URL.RawQuery = c.query
+			if c.ct != "" {
+				r.Header.Set("Content-Type", c.ct)
+			}
+			if c.cookie != "" {
+				r.Header.Set("Cookie", c.cookie)
+			}
+			weblog := &innerbean.WebLog{SrcByteBody: []byte(c.body), BODY: c.body}
+			var blocked bool
+			switch c.check {
+			case "sql":
+				blocked = waf.CheckSql(r, weblog, url.Values{}, hostSafe, globalHost).IsBlock
+			case "xss":
+				blocked = waf.CheckXss(r, weblog, url.Values{}, hostSafe, globalHost).IsBlock
+			case "dir":
+				blocked = waf.CheckDirTraversal(r, weblog, url.Values{}, hostSafe, globalHost).IsBlock
+			case "rce":
+				blocked = waf.CheckRce(r, weblog, url.Values{}, hostSafe, globalHost).IsBlock
+			}
+			if blocked != c.wantBlock {
+				t.Fatalf("IsBlock=%v，期望 %v（MATCH_ARG=%q）", blocked, c.wantBlock, weblog.MATCH_ARG)
+			}
+			if weblog.MATCH_ARG != c.wantArg {
+				t.Fatalf("MATCH_ARG=%q，期望 %q", weblog.MATCH_ARG, c.wantArg)
+			}
+		})
+	}
+}
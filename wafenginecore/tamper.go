@@ -12,6 +12,7 @@ import (
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -101,31 +102,66 @@ func readDecompressedBody(resp *http.Response) ([]byte, error) {
 	}
 	// 复位原始 body 供下游再次读取
 	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	return decompressBody(raw, resp.Header.Get("Content-Encoding"), 0)
+}
+
+// errBodyTooLarge 正文(或解压后的正文)超出读取上限
+var errBodyTooLarge = errors.New("响应正文超出读取上限")
+
+// readDecompressedBodyLimit 同 readDecompressedBody，但压缩前后都最多读 limit 字节，
+// 用于访客能随意触发的路径(chunked 响应 ContentLength 为 -1，不能只看它)。
+// 超限返回 errBodyTooLarge，已读出的部分拼回 resp.Body，下游照常转发完整正文
+func readDecompressedBodyLimit(resp *http.Response, limit int64) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(raw), resp.Body), Closer: resp.Body}
+		return nil, errBodyTooLarge
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	return decompressBody(raw, resp.Header.Get("Content-Encoding"), limit)
+}
 
-	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+// decompressBody 按 Content-Encoding 解压；limit > 0 时解压结果超过 limit 返回 errBodyTooLarge，防解压炸弹
+func decompressBody(raw []byte, encoding string, limit int64) ([]byte, error) {
+	var zr io.Reader
+	switch strings.ToLower(encoding) {
 	case "gzip":
-		zr, e := gzip.NewReader(bytes.NewReader(raw))
+		gr, e := gzip.NewReader(bytes.NewReader(raw))
 		if e != nil {
 			return nil, e
 		}
-		defer zr.Close()
-		return io.ReadAll(zr)
+		defer gr.Close()
+		zr = gr
 	case "deflate":
 		fr := flate.NewReader(bytes.NewReader(raw))
 		defer fr.Close()
-		return io.ReadAll(fr)
+		zr = fr
 	case "br":
-		return io.ReadAll(brotli.NewReader(bytes.NewReader(raw)))
+		zr = brotli.NewReader(bytes.NewReader(raw))
 	case "zstd":
-		zr, e := zstd.NewReader(bytes.NewReader(raw))
+		dr, e := zstd.NewReader(bytes.NewReader(raw))
 		if e != nil {
 			return nil, e
 		}
-		defer zr.Close()
-		return io.ReadAll(zr)
+		defer dr.Close()
+		zr = dr
 	default:
 		return raw, nil
 	}
+	if limit <= 0 {
+		return io.ReadAll(zr)
+	}
+	body, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
 }
 
 // checkAndHandleTamper 网页防篡改主流程。返回 true 表示已完整处理（回吐基线并记日志），
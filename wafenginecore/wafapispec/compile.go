@@ -0,0 +1,289 @@
+package wafapispec
+
+import (
+	"SamWaf/model"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Spec 编译后的接口规范，挂在 HostSafe 上，发布后只读
+type Spec struct {
+	Id          string
+	Prefix      string //作用的路径前缀，空表示整个网站
+	StripPrefix bool   //规范里的路径不含前缀（后端收到的是去掉前缀后的路径）
+	Mode        string
+	basePath    string
+	routes      []*route
+}
+
+type route struct {
+	template string
+	segments []string
+	ops      map[string]*operation
+}
+
+type operation struct {
+	params []*Parameter
+	body   *RequestBody
+}
+
+// Compile 解析并编译一条接口规范配置
+func Compile(item model.ApiSpec) (*Spec, error) {
+	doc, err := Parse([]byte(item.SpecContent))
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{
+		Id:          item.Id,
+		Prefix:      strings.TrimSuffix(item.PathPrefix, "/"),
+		StripPrefix: item.StripPrefix == 1,
+		Mode:        item.Mode,
+	}
+	if len(doc.Servers) > 0 {
+		// 只取 servers[0] 的路径部分作为基础路径，带变量的忽略
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil && !strings.Contains(u.Path, "{") {
+			spec.basePath = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+	r := &resolver{doc: doc, seen: map[*Schema]bool{}}
+	for template, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		if !strings.HasPrefix(template, "/") {
+			return nil, fmt.Errorf("路径 %s 必须以 / 开头", template)
+		}
+		rt := &route{template: template, segments: splitPath(template), ops: map[string]*operation{}}
+		for method, op := range item.operations() {
+			compiled := &operation{}
+			// 操作级参数覆盖路径级同名参数
+			merged := map[string]*Parameter{}
+			var order []string
+			for _, list := range [][]*Parameter{item.Parameters, op.Parameters} {
+				for _, p := range list {
+					p, err := r.parameter(p)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s: %w", method, template, err)
+					}
+					key := p.In + ":" + p.Name
+					if _, ok := merged[key]; !ok {
+						order = append(order, key)
+					}
+					merged[key] = p
+				}
+			}
+			for _, key := range order {
+				compiled.params = append(compiled.params, merged[key])
+			}
+			if compiled.body, err = r.requestBody(op.RequestBody); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, template, err)
+			}
+			rt.ops[method] = compiled
+		}
+		spec.routes = append(spec.routes, rt)
+	}
+	// 字面量段多的排前面：/users/me 优先于 /users/{id}
+	sort.SliceStable(spec.routes, func(i, j int) bool {
+		li, lj := literalCount(spec.routes[i].segments), literalCount(spec.routes[j].segments)
+		if li != lj {
+			return li > lj
+		}
+		return spec.routes[i].template < spec.routes[j].template
+	})
+	return spec, nil
+}
+
+// CompileList 编译一个网站的全部启用中的规范，前缀长的排前面；单条编译失败不影响其它条目
+func CompileList(list []model.ApiSpec) ([]*Spec, []error) {
+	var specs []*Spec
+	var errs []error
+	for _, item := range list {
+		if item.Status != 1 {
+			continue
+		}
+		spec, err := Compile(item)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("接口规范[%s]编译失败: %w", item.PathPrefix, err))
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	sort.SliceStable(specs, func(i, j int) bool { return len(specs[i].Prefix) > len(specs[j].Prefix) })
+	return specs, errs
+}
+
+// Select 按请求路径挑出生效的规范（前缀最长者）
+func Select(specs []*Spec, path string) *Spec {
+	for _, s := range specs {
+		if s.Prefix == "" || path == s.Prefix || strings.HasPrefix(path, s.Prefix+"/") {
+			return s
+		}
+	}
+	return nil
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+func literalCount(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if !strings.Contains(s, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// match 路径模板匹配，返回路径参数
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, tpl := range rt.segments {
+		open := strings.IndexByte(tpl, '{')
+		if open < 0 {
+			if tpl != segments[i] {
+				return nil, false
+			}
+			continue
+		}
+		end := strings.IndexByte(tpl, '}')
+		if end < open {
+			return nil, false
+		}
+		prefix, name, suffix := tpl[:open], tpl[open+1:end], tpl[end+1:]
+		seg := segments[i]
+		if len(seg) <= len(prefix)+len(suffix) || !strings.HasPrefix(seg, prefix) || !strings.HasSuffix(seg, suffix) {
+			return nil, false
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = seg[len(prefix) : len(seg)-len(suffix)]
+	}
+	return params, true
+}
+
+// resolver 把 $ref 换成 components 里的对象，循环引用靠 seen 截断
+type resolver struct {
+	doc  *Document
+	seen map[*Schema]bool
+}
+
+func refName(ref, kind string) (string, error) {
+	prefix := "#/components/" + kind + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("不支持的引用 %s（只支持文档内 %s）", ref, prefix)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+func (r *resolver) parameter(p *Parameter) (*Parameter, error) {
+	if p == nil {
+		return nil, fmt.Errorf("参数定义为空")
+	}
+	if p.Ref != "" {
+		name, err := refName(p.Ref, "parameters")
+		if err != nil {
+			return nil, err
+		}
+		if r.doc.Components == nil || r.doc.Components.Parameters[name] == nil {
+			return nil, fmt.Errorf("引用的参数 %s 不存在", p.Ref)
+		}
+		p = r.doc.Components.Parameters[name]
+	}
+	switch p.In {
+	case "path", "query", "header", "cookie":
+	default:
+		return nil, fmt.Errorf("参数 %s 的位置 in=%q 不正确", p.Name, p.In)
+	}
+	schema, err := r.schema(p.Schema)
+	if err != nil {
+		return nil, err
+	}
+	p.Schema = schema
+	return p, nil
+}
+
+func (r *resolver) requestBody(b *RequestBody) (*RequestBody, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if b.Ref != "" {
+		name, err := refName(b.Ref, "requestBodies")
+		if err != nil {
+			return nil, err
+		}
+		if r.doc.Components == nil || r.doc.Components.RequestBodies[name] == nil {
+			return nil, fmt.Errorf("引用的请求体 %s 不存在", b.Ref)
+		}
+		b = r.doc.Components.RequestBodies[name]
+	}
+	for _, media := range b.Content {
+		if media == nil {
+			continue
+		}
+		schema, err := r.schema(media.Schema)
+		if err != nil {
+			return nil, err
+		}
+		media.Schema = schema
+	}
+	return b, nil
+}
+
+func (r *resolver) schema(s *Schema) (*Schema, error) {
+	if s == nil {
+		return nil, nil
+	}
+	for depth := 0; s.Ref != ""; depth++ {
+		if depth >= MaxDepth {
+			return nil, fmt.Errorf("引用层级过深 %s", s.Ref)
+		}
+		name, err := refName(s.Ref, "schemas")
+		if err != nil {
+			return nil, err
+		}
+		if r.doc.Components == nil || r.doc.Components.Schemas[name] == nil {
+			return nil, fmt.Errorf("引用的模型 %s 不存在", s.Ref)
+		}
+		s = r.doc.Components.Schemas[name]
+	}
+	if r.seen[s] {
+		return s, nil
+	}
+	r.seen[s] = true
+	var err error
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return nil, fmt.Errorf("pattern %q 不是合法的正则: %w", s.Pattern, err)
+		}
+	}
+	if s.Items, err = r.schema(s.Items); err != nil {
+		return nil, err
+	}
+	for name, p := range s.Properties {
+		if s.Properties[name], err = r.schema(p); err != nil {
+			return nil, err
+		}
+	}
+	if s.AdditionalProperties != nil {
+		if s.AdditionalProperties.Schema, err = r.schema(s.AdditionalProperties.Schema); err != nil {
+			return nil, err
+		}
+	}
+	for _, list := range [][]*Schema{s.AllOf, s.AnyOf, s.OneOf} {
+		for i := range list {
+			if list[i], err = r.schema(list[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,57 @@
+package wafapispec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// formatMatch 字符串 format 校验，不认识的 format 一律放过
+func formatMatch(format, val string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse("2006-01-02", val)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, val)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(val)
+		return err == nil && addr.Address == val
+	case "uuid":
+		return uuidRegexp.MatchString(val)
+	case "ipv4":
+		ip := net.ParseIP(val)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(val)
+		return ip != nil && ip.To4() == nil
+	case "uri":
+		u, err := url.Parse(val)
+		return err == nil && u.Scheme != ""
+	case "byte":
+		_, err := base64.StdEncoding.DecodeString(val)
+		return err == nil
+	}
+	return true
+}
+
+// numberFormatMatch int32/int64 取值范围
+func numberFormatMatch(format string, val json.Number) bool {
+	switch format {
+	case "int32":
+		n, err := val.Int64()
+		return err == nil && n >= math.MinInt32 && n <= math.MaxInt32
+	case "int64":
+		_, err := val.Int64()
+		return err == nil
+	}
+	return true
+}
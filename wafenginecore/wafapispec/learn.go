@@ -0,0 +1,354 @@
+package wafapispec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample 学习用的一条正常请求（取自访问日志）
+type Sample struct {
+	Method   string
+	Path     string
+	RawQuery string
+	Body     string
+	PostForm string
+}
+
+const (
+	learnMaxBodies = 200 //每个操作最多取多少个请求体推断 Schema
+	learnMinLength = 32  //推断出的字符串最大长度下限
+)
+
+var (
+	learnHexRegexp  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	learnNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+type learnOp struct {
+	count      int
+	pathParams map[string][]string
+	query      map[string][]string
+	queryHits  map[string]int
+	jsonBodies []interface{}
+	forms      []url.Values
+	bodies     int
+}
+
+// Learn 根据正常流量生成规范草稿：数字/UUID/长十六进制段归纳成路径参数，
+// 参数与请求体类型取观察到的值里最窄的那种，每次都出现的参数记为必填。
+// 生成结果只是草稿，需要人工检查后再启用。
+func Learn(samples []Sample, title string) *Document {
+	paths := map[string]map[string]*learnOp{}
+	for _, sm := range samples {
+		method := strings.ToUpper(sm.Method)
+		if method == "" || sm.Path == "" {
+			continue
+		}
+		template, params := learnTemplate(sm.Path)
+		ops := paths[template]
+		if ops == nil {
+			ops = map[string]*learnOp{}
+			paths[template] = ops
+		}
+		op := ops[method]
+		if op == nil {
+			op = &learnOp{pathParams: map[string][]string{}, query: map[string][]string{}, queryHits: map[string]int{}}
+			ops[method] = op
+		}
+		op.count++
+		for name, val := range params {
+			op.pathParams[name] = append(op.pathParams[name], val)
+		}
+		if query, err := url.ParseQuery(sm.RawQuery); err == nil {
+			for name, vals := range query {
+				op.query[name] = append(op.query[name], vals...)
+				op.queryHits[name]++
+			}
+		}
+		op.learnBody(sm)
+	}
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: "draft"},
+		Paths:   map[string]*PathItem{},
+	}
+	for template, ops := range paths {
+		item := &PathItem{}
+		for method, op := range ops {
+			operation := op.build()
+			switch method {
+			case "GET":
+				item.Get = operation
+			case "PUT":
+				item.Put = operation
+			case "POST":
+				item.Post = operation
+			case "DELETE":
+				item.Delete = operation
+			case "OPTIONS":
+				item.Options = operation
+			case "HEAD":
+				item.Head = operation
+			case "PATCH":
+				item.Patch = operation
+			case "TRACE":
+				item.Trace = operation
+			}
+		}
+		doc.Paths[template] = item
+	}
+	return doc
+}
+
+func (op *learnOp) learnBody(sm Sample) {
+	body := strings.TrimSpace(sm.Body)
+	if body == "" && sm.PostForm == "" {
+		return
+	}
+	op.bodies++
+	if body != "" && (body[0] == '{' || body[0] == '[') {
+		if len(op.jsonBodies) >= learnMaxBodies {
+			return
+		}
+		dec := json.NewDecoder(bytes.NewReader([]byte(body)))
+		dec.UseNumber()
+		var val interface{}
+		if dec.Decode(&val) == nil {
+			op.jsonBodies = append(op.jsonBodies, val)
+		}
+		return
+	}
+	form := sm.PostForm
+	if form == "" {
+		form = body
+	}
+	if values, err := url.ParseQuery(form); err == nil && len(op.forms) < learnMaxBodies {
+		op.forms = append(op.forms, values)
+	}
+}
+
+func (op *learnOp) build() *Operation {
+	operation := &Operation{
+		Responses: map[string]interface{}{"default": map[string]interface{}{"description": "自动学习生成"}},
+	}
+	for _, name := range sortedKeys(op.pathParams) {
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name: name, In: "path", Required: true, Schema: inferStrings(op.pathParams[name]),
+		})
+	}
+	for _, name := range sortedKeys(op.query) {
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name: name, In: "query", Required: op.queryHits[name] == op.count, Schema: inferStrings(op.query[name]),
+		})
+	}
+	if op.bodies == 0 {
+		return operation
+	}
+	rb := &RequestBody{Required: op.bodies == op.count, Content: map[string]*MediaType{}}
+	if len(op.jsonBodies) > 0 {
+		rb.Content["application/json"] = &MediaType{Schema: inferValues(op.jsonBodies, 0)}
+	}
+	if len(op.forms) > 0 {
+		obj := &Schema{Type: SchemaType{"object"}, Properties: map[string]*Schema{}}
+		fields := map[string][]string{}
+		hits := map[string]int{}
+		for _, form := range op.forms {
+			for name, vals := range form {
+				fields[name] = append(fields[name], vals...)
+				hits[name]++
+			}
+		}
+		for _, name := range sortedKeys(fields) {
+			obj.Properties[name] = inferStrings(fields[name])
+			if hits[name] == len(op.forms) {
+				obj.Required = append(obj.Required, name)
+			}
+		}
+		rb.Content["application/x-www-form-urlencoded"] = &MediaType{Schema: obj}
+	}
+	operation.RequestBody = rb
+	return operation
+}
+
+// learnTemplate 把看起来像 ID 的路径段换成 {xxx_id}
+func learnTemplate(path string) (string, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	params := map[string]string{}
+	for i, seg := range segments {
+		if !learnIsID(seg) {
+			continue
+		}
+		name := "id"
+		if i > 0 && !strings.HasPrefix(segments[i-1], "{") {
+			name = learnNameRegexp.ReplaceAllString(strings.TrimSuffix(segments[i-1], "s"), "_") + "_id"
+		}
+		for n := 2; params[name] != ""; n++ {
+			name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), n)
+		}
+		params[name] = seg
+		segments[i] = "{" + name + "}"
+	}
+	return "/" + strings.Join(segments, "/"), params
+}
+
+func learnIsID(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	if _, err := strconv.ParseInt(seg, 10, 64); err == nil {
+		return true
+	}
+	return uuidRegexp.MatchString(seg) || learnHexRegexp.MatchString(seg)
+}
+
+// inferStrings 查询参数等字符串值：全是整数/数字/布尔时用对应类型，否则为字符串并给出长度上限
+func inferStrings(vals []string) *Schema {
+	allInt, allNum, allBool, allUUID := true, true, true, true
+	maxLen := 0
+	for _, v := range vals {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			allInt = false
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			allNum = false
+		}
+		if v != "true" && v != "false" {
+			allBool = false
+		}
+		if !uuidRegexp.MatchString(v) {
+			allUUID = false
+		}
+		if n := len([]rune(v)); n > maxLen {
+			maxLen = n
+		}
+	}
+	switch {
+	case len(vals) == 0:
+		return &Schema{Type: SchemaType{"string"}}
+	case allInt:
+		return &Schema{Type: SchemaType{"integer"}}
+	case allNum:
+		return &Schema{Type: SchemaType{"number"}}
+	case allBool:
+		return &Schema{Type: SchemaType{"boolean"}}
+	case allUUID:
+		return &Schema{Type: SchemaType{"string"}, Format: "uuid"}
+	}
+	return &Schema{Type: SchemaType{"string"}, MaxLength: learnMaxLength(maxLen)}
+}
+
+// learnMaxLength 观察到的最大长度放宽一倍，避免草稿过严
+func learnMaxLength(n int) *int {
+	n *= 2
+	if n < learnMinLength {
+		n = learnMinLength
+	}
+	return &n
+}
+
+// inferValues 由若干 JSON 值推断 Schema：对象取字段并集、每次都出现的字段为必填
+func inferValues(vals []interface{}, depth int) *Schema {
+	if depth > MaxDepth {
+		return &Schema{}
+	}
+	var objects []map[string]interface{}
+	var items []interface{}
+	var strs []string
+	types := map[string]bool{}
+	allInt := true
+	nullable := false
+	for _, v := range vals {
+		switch x := v.(type) {
+		case nil:
+			nullable = true
+		case map[string]interface{}:
+			types["object"] = true
+			objects = append(objects, x)
+		case []interface{}:
+			types["array"] = true
+			items = append(items, x...)
+		case string:
+			types["string"] = true
+			strs = append(strs, x)
+		case bool:
+			types["boolean"] = true
+		case json.Number:
+			types["number"] = true
+			if _, err := x.Int64(); err != nil {
+				allInt = false
+			}
+		}
+	}
+	if len(types) != 1 {
+		// 混合类型不做约束
+		return &Schema{Nullable: nullable}
+	}
+	s := &Schema{Nullable: nullable}
+	switch {
+	case types["object"]:
+		s.Type = SchemaType{"object"}
+		s.Properties = map[string]*Schema{}
+		fields := map[string][]interface{}{}
+		hits := map[string]int{}
+		for _, obj := range objects {
+			for k, v := range obj {
+				fields[k] = append(fields[k], v)
+				hits[k]++
+			}
+		}
+		for _, k := range sortedKeys(fields) {
+			s.Properties[k] = inferValues(fields[k], depth+1)
+			if hits[k] == len(objects) {
+				s.Required = append(s.Required, k)
+			}
+		}
+	case types["array"]:
+		s.Type = SchemaType{"array"}
+		if len(items) > 0 {
+			s.Items = inferValues(items, depth+1)
+		}
+	case types["string"]:
+		s = inferStrings(strs)
+		if s.Type.has("string") {
+			s.Nullable = nullable
+		} else {
+			// JSON 里是字符串，不能因为内容像数字就改成数字类型
+			s = &Schema{Type: SchemaType{"string"}, Nullable: nullable, MaxLength: learnMaxLength(maxRuneLen(strs))}
+		}
+	case types["boolean"]:
+		s.Type = SchemaType{"boolean"}
+	case types["number"]:
+		if allInt {
+			s.Type = SchemaType{"integer"}
+		} else {
+			s.Type = SchemaType{"number"}
+		}
+	}
+	return s
+}
+
+func maxRuneLen(vals []string) int {
+	n := 0
+	for _, v := range vals {
+		if l := len([]rune(v)); l > n {
+			n = l
+		}
+	}
+	return n
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,185 @@
+package wafapispec
+
+import (
+	"errors"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document OpenAPI 3 文档里校验用得到的部分；responses、examples、security 等解析时忽略。
+// JSON 是 YAML 的子集，两种格式都用 yaml.v3 解析。
+type Document struct {
+	OpenAPI    string               `yaml:"openapi" json:"openapi"`
+	Info       Info                 `yaml:"info" json:"info"`
+	Servers    []Server             `yaml:"servers,omitempty" json:"servers,omitempty"`
+	Paths      map[string]*PathItem `yaml:"paths" json:"paths"`
+	Components *Components          `yaml:"components,omitempty" json:"components,omitempty"`
+}
+
+type Info struct {
+	Title   string `yaml:"title" json:"title"`
+	Version string `yaml:"version" json:"version"`
+}
+
+type Server struct {
+	URL string `yaml:"url" json:"url"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas,omitempty" json:"schemas,omitempty"`
+	Parameters    map[string]*Parameter   `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies,omitempty" json:"requestBodies,omitempty"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	Get        *Operation   `yaml:"get,omitempty" json:"get,omitempty"`
+	Put        *Operation   `yaml:"put,omitempty" json:"put,omitempty"`
+	Post       *Operation   `yaml:"post,omitempty" json:"post,omitempty"`
+	Delete     *Operation   `yaml:"delete,omitempty" json:"delete,omitempty"`
+	Options    *Operation   `yaml:"options,omitempty" json:"options,omitempty"`
+	Head       *Operation   `yaml:"head,omitempty" json:"head,omitempty"`
+	Patch      *Operation   `yaml:"patch,omitempty" json:"patch,omitempty"`
+	Trace      *Operation   `yaml:"trace,omitempty" json:"trace,omitempty"`
+}
+
+// operations 方法名（大写）-> 操作
+func (p *PathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		"GET": p.Get, "PUT": p.Put, "POST": p.Post, "DELETE": p.Delete,
+		"OPTIONS": p.Options, "HEAD": p.Head, "PATCH": p.Patch, "TRACE": p.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+type Operation struct {
+	OperationID string                 `yaml:"operationId,omitempty" json:"operationId,omitempty"`
+	Parameters  []*Parameter           `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	RequestBody *RequestBody           `yaml:"requestBody,omitempty" json:"requestBody,omitempty"`
+	Responses   map[string]interface{} `yaml:"responses,omitempty" json:"responses,omitempty"`
+}
+
+type Parameter struct {
+	Ref      string  `yaml:"$ref,omitempty" json:"$ref,omitempty"`
+	Name     string  `yaml:"name,omitempty" json:"name,omitempty"`
+	In       string  `yaml:"in,omitempty" json:"in,omitempty"` //path/query/header/cookie
+	Required bool    `yaml:"required,omitempty" json:"required,omitempty"`
+	Schema   *Schema `yaml:"schema,omitempty" json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Ref      string                `yaml:"$ref,omitempty" json:"$ref,omitempty"`
+	Required bool                  `yaml:"required,omitempty" json:"required,omitempty"`
+	Content  map[string]*MediaType `yaml:"content,omitempty" json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema,omitempty" json:"schema,omitempty"`
+}
+
+// Schema JSON Schema 里用于请求校验的关键字
+type Schema struct {
+	Ref                  string                `yaml:"$ref,omitempty" json:"$ref,omitempty"`
+	Type                 SchemaType            `yaml:"type,omitempty" json:"type,omitempty"`
+	Format               string                `yaml:"format,omitempty" json:"format,omitempty"`
+	Nullable             bool                  `yaml:"nullable,omitempty" json:"nullable,omitempty"`
+	Enum                 []interface{}         `yaml:"enum,omitempty" json:"enum,omitempty"`
+	Pattern              string                `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	MinLength            *int                  `yaml:"minLength,omitempty" json:"minLength,omitempty"`
+	MaxLength            *int                  `yaml:"maxLength,omitempty" json:"maxLength,omitempty"`
+	Minimum              *float64              `yaml:"minimum,omitempty" json:"minimum,omitempty"`
+	Maximum              *float64              `yaml:"maximum,omitempty" json:"maximum,omitempty"`
+	MinItems             *int                  `yaml:"minItems,omitempty" json:"minItems,omitempty"`
+	MaxItems             *int                  `yaml:"maxItems,omitempty" json:"maxItems,omitempty"`
+	Items                *Schema               `yaml:"items,omitempty" json:"items,omitempty"`
+	Required             []string              `yaml:"required,omitempty" json:"required,omitempty"`
+	Properties           map[string]*Schema    `yaml:"properties,omitempty" json:"properties,omitempty"`
+	AdditionalProperties *AdditionalProperties `yaml:"additionalProperties,omitempty" json:"additionalProperties,omitempty"`
+	MaxProperties        *int                  `yaml:"maxProperties,omitempty" json:"maxProperties,omitempty"`
+	AllOf                []*Schema             `yaml:"allOf,omitempty" json:"allOf,omitempty"`
+	AnyOf                []*Schema             `yaml:"anyOf,omitempty" json:"anyOf,omitempty"`
+	OneOf                []*Schema             `yaml:"oneOf,omitempty" json:"oneOf,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// SchemaType OpenAPI 3.0 的 type 是单个字符串，3.1 允许 ["string","null"] 这样的数组
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = SchemaType{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (t SchemaType) MarshalYAML() (interface{}, error) {
+	if len(t) == 1 {
+		return t[0], nil
+	}
+	return []string(t), nil
+}
+
+func (t SchemaType) has(name string) bool {
+	for _, v := range t {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AdditionalProperties 取值可以是布尔，也可以是一个 Schema
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		a.Schema = nil
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return node.Decode(a.Schema)
+}
+
+func (a AdditionalProperties) MarshalYAML() (interface{}, error) {
+	if a.Schema != nil {
+		return a.Schema, nil
+	}
+	return a.Allowed, nil
+}
+
+// Parse 解析 OpenAPI 3 文档（YAML 或 JSON）
+func Parse(content []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.OpenAPI) == 0 || doc.OpenAPI[0] != '3' {
+		return nil, errors.New("仅支持 OpenAPI 3.x 文档（openapi: 3.x）")
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("文档中没有定义任何路径(paths)")
+	}
+	return &doc, nil
+}
+
+// Marshal 输出为 YAML
+func Marshal(doc *Document) ([]byte, error) {
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,444 @@
+package wafapispec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxDepth      = 32 //Schema 嵌套/引用的最大深度
+	MaxViolations = 10 //单个请求最多记录的违规条数
+)
+
+// 违规类型
+const (
+	ViolationUnknownPath    = "unknown_path"    //规范里没有这个路径
+	ViolationUnknownMethod  = "unknown_method"  //路径存在但不允许该方法
+	ViolationMissingParam   = "missing_param"   //缺少必填参数
+	ViolationInvalidParam   = "invalid_param"   //参数类型/格式/取值不符
+	ViolationTooLong        = "too_long"        //超过 maxLength/maxItems/maxProperties
+	ViolationContentType    = "content_type"    //请求体类型不在规范允许的范围
+	ViolationMissingBody    = "missing_body"    //缺少必填请求体
+	ViolationUnexpectedBody = "unexpected_body" //规范没有定义请求体却带了请求体
+	ViolationInvalidBody    = "invalid_body"    //请求体不符合 Schema
+)
+
+// Violation 一条违规
+type Violation struct {
+	Kind     string
+	Location string //如 query:page、body:user.email
+	Message  string
+}
+
+func (v Violation) String() string {
+	if v.Location == "" {
+		return v.Kind + ": " + v.Message
+	}
+	return v.Kind + " " + v.Location + ": " + v.Message
+}
+
+// Validate 校验请求。body 为已读出的请求体；hasBody 表示请求带了请求体
+// （请求体过大或被压缩时 body 可能为空，这时只校验请求体类型，不做内容校验）。
+func (s *Spec) Validate(r *http.Request, body []byte, hasBody bool) []Violation {
+	path := r.URL.Path
+	if s.StripPrefix && s.Prefix != "" {
+		path = strings.TrimPrefix(path, s.Prefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	if s.basePath != "" {
+		if path != s.basePath && !strings.HasPrefix(path, s.basePath+"/") {
+			return []Violation{{Kind: ViolationUnknownPath, Location: r.URL.Path, Message: "路径不在规范定义范围内"}}
+		}
+		path = strings.TrimPrefix(path, s.basePath)
+	}
+	segments := splitPath(path)
+	var rt *route
+	var pathParams map[string]string
+	for _, candidate := range s.routes {
+		if params, ok := candidate.match(segments); ok {
+			rt, pathParams = candidate, params
+			break
+		}
+	}
+	if rt == nil {
+		return []Violation{{Kind: ViolationUnknownPath, Location: r.URL.Path, Message: "路径不在规范定义范围内"}}
+	}
+	op := rt.ops[r.Method]
+	if op == nil && r.Method == http.MethodHead {
+		op = rt.ops[http.MethodGet]
+	}
+	if op == nil {
+		return []Violation{{Kind: ViolationUnknownMethod, Location: rt.template, Message: "规范不允许 " + r.Method + " 方法"}}
+	}
+
+	v := &validator{}
+	query := r.URL.Query()
+	for _, p := range op.params {
+		var values []string
+		switch p.In {
+		case "path":
+			if val, ok := pathParams[p.Name]; ok {
+				if unescaped, err := url.PathUnescape(val); err == nil {
+					val = unescaped
+				}
+				values = []string{val}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+		loc := p.In + ":" + p.Name
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				v.add(ViolationMissingParam, loc, "缺少必填参数")
+			}
+			continue
+		}
+		if p.Schema != nil {
+			v.kind = ViolationInvalidParam
+			v.value(p.Schema, coerceParam(p.Schema, values), loc, 0)
+		}
+	}
+	v.body(op.body, r, body, hasBody)
+	return v.violations
+}
+
+type validator struct {
+	violations []Violation
+	kind       string //当前校验对象的违规类型：参数或请求体
+}
+
+func (v *validator) add(kind, loc, msg string) {
+	if len(v.violations) < MaxViolations {
+		v.violations = append(v.violations, Violation{Kind: kind, Location: loc, Message: msg})
+	}
+}
+
+func (v *validator) full() bool {
+	return len(v.violations) >= MaxViolations
+}
+
+func (v *validator) body(rb *RequestBody, r *http.Request, body []byte, hasBody bool) {
+	hasBody = hasBody || len(body) > 0
+	if rb == nil {
+		if hasBody {
+			v.add(ViolationUnexpectedBody, "body", "该接口不接受请求体")
+		}
+		return
+	}
+	if !hasBody {
+		if rb.Required {
+			v.add(ViolationMissingBody, "body", "缺少必填请求体")
+		}
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+	media, ok := matchMediaType(rb.Content, mediaType)
+	if !ok {
+		v.add(ViolationContentType, "body", "不允许的请求体类型 "+mediaType)
+		return
+	}
+	if media == nil || media.Schema == nil || len(body) == 0 {
+		return
+	}
+	v.kind = ViolationInvalidBody
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			v.add(ViolationInvalidBody, "body", "JSON 格式错误")
+			return
+		}
+		v.value(media.Schema, val, "body", 0)
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			v.add(ViolationInvalidBody, "body", "表单格式错误")
+			return
+		}
+		v.value(media.Schema, coerceForm(media.Schema, values), "body", 0)
+	case mediaType == "multipart/form-data":
+		values, err := multipartValues(body, params["boundary"])
+		if err != nil {
+			v.add(ViolationInvalidBody, "body", "multipart 格式错误")
+			return
+		}
+		v.value(media.Schema, coerceForm(media.Schema, values), "body", 0)
+	}
+}
+
+// matchMediaType 先精确匹配，再匹配 type/*，最后 */*
+func matchMediaType(content map[string]*MediaType, mediaType string) (*MediaType, bool) {
+	if len(content) == 0 {
+		return nil, true
+	}
+	if m, ok := content[mediaType]; ok {
+		return m, true
+	}
+	for key, m := range content {
+		if strings.EqualFold(key, mediaType) {
+			return m, true
+		}
+	}
+	if i := strings.IndexByte(mediaType, '/'); i > 0 {
+		if m, ok := content[mediaType[:i]+"/*"]; ok {
+			return m, true
+		}
+	}
+	m, ok := content["*/*"]
+	return m, ok
+}
+
+func multipartValues(body []byte, boundary string) (url.Values, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("缺少 boundary")
+	}
+	values := url.Values{}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if part.FileName() != "" {
+			// 文件字段只关心有没有，内容交给文件上传检测
+			values.Add(name, part.FileName())
+			continue
+		}
+		raw, _ := io.ReadAll(io.LimitReader(part, 1<<20))
+		values.Add(name, string(raw))
+	}
+}
+
+// coerceParam 查询串/请求头里的值都是字符串，按 Schema 声明的类型转换后再校验
+func coerceParam(s *Schema, values []string) interface{} {
+	if s.Type.has("array") {
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]interface{}, 0, len(values))
+		for _, val := range values {
+			if s.Items != nil {
+				items = append(items, coerceScalar(s.Items, val))
+			} else {
+				items = append(items, val)
+			}
+		}
+		return items
+	}
+	return coerceScalar(s, values[0])
+}
+
+func coerceScalar(s *Schema, val string) interface{} {
+	switch {
+	case s.Type.has("integer"), s.Type.has("number"):
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return json.Number(val)
+		}
+	case s.Type.has("boolean"):
+		if b, err := strconv.ParseBool(val); err == nil && (val == "true" || val == "false") {
+			return b
+		}
+	}
+	return val
+}
+
+// coerceForm 表单按 object 校验，字段值按属性 Schema 转换
+func coerceForm(s *Schema, values url.Values) interface{} {
+	obj := make(map[string]interface{}, len(values))
+	for name, vals := range values {
+		prop := s.Properties[name]
+		if prop == nil {
+			obj[name] = vals[0]
+			continue
+		}
+		obj[name] = coerceParam(prop, vals)
+	}
+	return obj
+}
+
+// value 按 Schema 校验一个值
+func (v *validator) value(s *Schema, val interface{}, loc string, depth int) {
+	if s == nil || v.full() || depth > MaxDepth {
+		return
+	}
+	if len(s.Type) > 0 && !typeMatch(s, val) {
+		v.add(v.kind, loc, "类型应为 "+strings.Join(s.Type, "|"))
+		return
+	}
+	if val == nil {
+		return
+	}
+	if len(s.Enum) > 0 && !enumContains(s.Enum, val) {
+		v.add(v.kind, loc, "取值不在允许范围内")
+	}
+	switch x := val.(type) {
+	case string:
+		n := len([]rune(x))
+		if s.MaxLength != nil && n > *s.MaxLength {
+			v.add(ViolationTooLong, loc, fmt.Sprintf("长度 %d 超过 %d", n, *s.MaxLength))
+		}
+		if s.MinLength != nil && n < *s.MinLength {
+			v.add(v.kind, loc, fmt.Sprintf("长度 %d 小于 %d", n, *s.MinLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(x) {
+			v.add(v.kind, loc, "不匹配 pattern")
+		}
+		if s.Format != "" && !formatMatch(s.Format, x) {
+			v.add(v.kind, loc, "格式应为 "+s.Format)
+		}
+	case json.Number:
+		f, _ := x.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			v.add(v.kind, loc, fmt.Sprintf("不能小于 %v", *s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.add(v.kind, loc, fmt.Sprintf("不能大于 %v", *s.Maximum))
+		}
+		if !numberFormatMatch(s.Format, x) {
+			v.add(v.kind, loc, "超出 "+s.Format+" 范围")
+		}
+	case []interface{}:
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			v.add(ViolationTooLong, loc, fmt.Sprintf("元素个数 %d 超过 %d", len(x), *s.MaxItems))
+		}
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			v.add(v.kind, loc, fmt.Sprintf("元素个数 %d 小于 %d", len(x), *s.MinItems))
+		}
+		for i, item := range x {
+			v.value(s.Items, item, fmt.Sprintf("%s[%d]", loc, i), depth+1)
+		}
+	case map[string]interface{}:
+		if s.MaxProperties != nil && len(x) > *s.MaxProperties {
+			v.add(ViolationTooLong, loc, fmt.Sprintf("字段个数 %d 超过 %d", len(x), *s.MaxProperties))
+		}
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				v.add(v.kind, loc+"."+name, "缺少必填字段")
+			}
+		}
+		for name, item := range x {
+			if prop, ok := s.Properties[name]; ok {
+				v.value(prop, item, loc+"."+name, depth+1)
+				continue
+			}
+			if s.AdditionalProperties != nil {
+				if !s.AdditionalProperties.Allowed {
+					v.add(v.kind, loc+"."+name, "不允许的字段")
+				} else {
+					v.value(s.AdditionalProperties.Schema, item, loc+"."+name, depth+1)
+				}
+			}
+		}
+	}
+	for _, sub := range s.AllOf {
+		v.value(sub, val, loc, depth+1)
+	}
+	if len(s.AnyOf) > 0 && v.countMatches(s.AnyOf, val, depth) == 0 {
+		v.add(v.kind, loc, "不符合 anyOf 中任何一个")
+	}
+	if len(s.OneOf) > 0 && v.countMatches(s.OneOf, val, depth) != 1 {
+		v.add(v.kind, loc, "应当恰好符合 oneOf 中的一个")
+	}
+}
+
+func (v *validator) countMatches(list []*Schema, val interface{}, depth int) int {
+	n := 0
+	for _, sub := range list {
+		probe := &validator{kind: v.kind}
+		probe.value(sub, val, "", depth+1)
+		if len(probe.violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func typeMatch(s *Schema, val interface{}) bool {
+	if val == nil {
+		return s.Nullable || s.Type.has("null")
+	}
+	for _, t := range s.Type {
+		switch x := val.(type) {
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if t == "integer" {
+				if _, err := x.Int64(); err == nil {
+					return true
+				}
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func enumContains(enum []interface{}, val interface{}) bool {
+	for _, e := range enum {
+		if n, ok := val.(json.Number); ok {
+			f, _ := n.Float64()
+			switch x := e.(type) {
+			case int:
+				if float64(x) == f {
+					return true
+				}
+			case float64:
+				if x == f {
+					return true
+				}
+			}
+			continue
+		}
+		switch val.(type) {
+		case string, bool:
+			if e == val {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package wafapispec
+
+import (
+	"SamWaf/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info: {title: shop, version: "1"}
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: integer, format: int32}}
+    get:
+      parameters:
+        - {name: fields, in: query, schema: {type: string, enum: [basic, full]}}
+    put:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/User'}
+  /users/me:
+    get: {}
+  /search:
+    get:
+      parameters:
+        - {name: q, in: query, required: true, schema: {type: string, maxLength: 10}}
+        - {name: tags, in: query, schema: {type: array, maxItems: 2, items: {type: string}}}
+        - {name: X-Tenant, in: header, required: true, schema: {type: string, format: uuid}}
+components:
+  schemas:
+    User:
+      type: object
+      required: [email]
+      additionalProperties: false
+      properties:
+        email: {type: string, format: email}
+        age: {type: integer, minimum: 0}
+        tags: {type: array, items: {type: string, maxLength: 5}}
+`
+
+func mustCompile(t *testing.T, content string) *Spec {
+	t.Helper()
+	spec, err := Compile(model.ApiSpec{SpecContent: content, Mode: model.ApiSpecModeEnforce, Status: 1})
+	if err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	return spec
+}
+
+func TestValidate(t *testing.T) {
+	spec := mustCompile(t, testSpec)
+	const tenant = "0b7e4c52-8d8f-4c36-9d1a-0f5a6b7c8d9e"
+	cases := []struct {
+		name     string
+		method   string
+		target   string
+		ct       string
+		body     string
+		header   string
+		wantKind string
+	}{
+		{"合法GET", "GET", "/v1/users/12?fields=full", "", "", "", ""},
+		{"字面量路径优先", "GET", "/v1/users/me", "", "", "", ""},
+		{"HEAD按GET校验", "HEAD", "/v1/users/12", "", "", "", ""},
+		{"未知路径", "GET", "/v1/orders", "", "", "", ViolationUnknownPath},
+		{"不在基础路径下", "GET", "/users/12", "", "", "", ViolationUnknownPath},
+		{"未知方法", "DELETE", "/v1/users/12", "", "", "", ViolationUnknownMethod},
+		{"路径参数类型", "GET", "/v1/users/abc", "", "", "", ViolationInvalidParam},
+		{"int32越界", "GET", "/v1/users/99999999999", "", "", "", ViolationInvalidParam},
+		{"枚举", "GET", "/v1/users/1?fields=all", "", "", "", ViolationInvalidParam},
+		{"缺少必填查询参数", "GET", "/v1/search", "", "", tenant, ViolationMissingParam},
+		{"查询参数超长", "GET", "/v1/search?q=0123456789abc", "", "", tenant, ViolationTooLong},
+		{"数组元素过多", "GET", "/v1/search?q=a&tags=x,y,z", "", "", tenant, ViolationTooLong},
+		{"请求头格式", "GET", "/v1/search?q=a", "", "", "not-a-uuid", ViolationInvalidParam},
+		{"合法JSON", "PUT", "/v1/users/1", "application/json", `{"email":"a@b.com","age":3,"tags":["x"]}`, "", ""},
+		{"缺少请求体", "PUT", "/v1/users/1", "application/json", "", "", ViolationMissingBody},
+		{"请求体类型", "PUT", "/v1/users/1", "text/plain", `{"email":"a@b.com"}`, "", ViolationContentType},
+		{"缺少必填字段", "PUT", "/v1/users/1", "application/json", `{"age":3}`, "", ViolationInvalidBody},
+		{"多余字段", "PUT", "/v1/users/1", "application/json", `{"email":"a@b.com","admin":true}`, "", ViolationInvalidBody},
+		{"嵌套字段超长", "PUT", "/v1/users/1", "application/json", `{"email":"a@b.com","tags":["toolong"]}`, "", ViolationTooLong},
+		{"JSON格式错误", "PUT", "/v1/users/1", "application/json", `{"email":`, "", ViolationInvalidBody},
+		{"不接受请求体", "GET", "/v1/users/me", "application/json", `{}`, "", ViolationUnexpectedBody},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, "http://a.com"+c.target, strings.NewReader(c.body))
+			if c.ct != "" {
+				r.Header.Set("Content-Type", c.ct)
+			}
+			if c.header != "" {
+				r.Header.Set("X-Tenant", c.header)
+			}
+			got := spec.Validate(r, []byte(c.body), c.body != "")
+			if c.wantKind == "" {
+				if len(got) != 0 {
+					t.Fatalf("不应有违规: %v", got)
+				}
+				return
+			}
+			if len(got) == 0 || got[0].Kind != c.wantKind {
+				t.Fatalf("期望 %s，实际 %v", c.wantKind, got)
+			}
+		})
+	}
+}
+
+// 路径前缀：只有前缀下的请求用这份规范；StripPrefix 时规范里的路径不含前缀
+func TestSelectAndStripPrefix(t *testing.T) {
+	content := "openapi: 3.1.0\ninfo: {title: t, version: '1'}\npaths:\n  /ping:\n    get: {}\n"
+	specs, errs := CompileList([]model.ApiSpec{
+		{PathPrefix: "/api/", StripPrefix: 1, SpecContent: content, Status: 1},
+		{PathPrefix: "", SpecContent: content, Status: 1},
+		{PathPrefix: "/off", SpecContent: "not a spec", Status: 0},
+	})
+	if len(errs) != 0 || len(specs) != 2 {
+		t.Fatalf("停用的规范不编译: specs=%d errs=%v", len(specs), errs)
+	}
+	s := Select(specs, "/api/ping")
+	if s == nil || s.Prefix != "/api" {
+		t.Fatalf("应选中前缀最长的规范")
+	}
+	if v := s.Validate(httptest.NewRequest(http.MethodGet, "/api/ping", nil), nil, false); len(v) != 0 {
+		t.Fatalf("去掉前缀后应匹配 /ping: %v", v)
+	}
+	if s := Select(specs, "/apiv2/ping"); s == nil || s.Prefix != "" {
+		t.Fatalf("/apiv2 不属于 /api 前缀")
+	}
+	if _, err := Compile(model.ApiSpec{SpecContent: "swagger: '2.0'\npaths: {/a: {}}"}); err == nil {
+		t.Fatalf("Swagger 2.0 应报错")
+	}
+	if _, err := Compile(model.ApiSpec{SpecContent: "openapi: 3.0.0\npaths:\n  /a:\n    get:\n      parameters: [{$ref: '#/components/parameters/x'}]\n"}); err == nil {
+		t.Fatalf("引用不存在时应报错")
+	}
+}
+
+// 学习生成的草稿能通过编译，并能放行学习时用到的流量
+func TestLearn(t *testing.T) {
+	samples := []Sample{
+		{Method: "GET", Path: "/users/12", RawQuery: "page=1&sort=name"},
+		{Method: "GET", Path: "/users/34", RawQuery: "page=2"},
+		{Method: "POST", Path: "/users", Body: `{"name":"tom","age":3,"tags":["a"]}`},
+		{Method: "POST", Path: "/users", Body: `{"name":"jerry","age":4}`},
+		{Method: "POST", Path: "/login", PostForm: "user=a&remember=true"},
+	}
+	doc := Learn(samples, "draft")
+	content, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("输出失败: %v", err)
+	}
+	text := string(content)
+	if !strings.Contains(text, "/users/{user_id}") {
+		t.Fatalf("数字路径段应归纳为参数:\n%s", text)
+	}
+	spec := mustCompile(t, text)
+
+	get := spec.routes[0]
+	for _, rt := range spec.routes {
+		if rt.template == "/users/{user_id}" {
+			get = rt
+		}
+	}
+	params := map[string]*Parameter{}
+	for _, p := range get.ops["GET"].params {
+		params[p.Name] = p
+	}
+	if !params["page"].Required || params["sort"].Required || !params["page"].Schema.Type.has("integer") {
+		t.Fatalf("page 每次都出现且为整数，sort 可选: %+v %+v", params["page"], params["sort"])
+	}
+
+	ok := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"x","age":5}`))
+	ok.Header.Set("Content-Type", "application/json")
+	if v := spec.Validate(ok, []byte(`{"name":"x","age":5}`), true); len(v) != 0 {
+		t.Fatalf("学习过的请求形态应通过: %v", v)
+	}
+	bad := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"age":"x"}`))
+	bad.Header.Set("Content-Type", "application/json")
+	if v := spec.Validate(bad, []byte(`{"age":"x"}`), true); len(v) == 0 {
+		t.Fatalf("缺少 name、age 类型不对应违规")
+	}
+	form := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("user=b&remember=false"))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if v := spec.Validate(form, []byte("user=b&remember=false"), true); len(v) != 0 {
+		t.Fatalf("表单请求应通过: %v", v)
+	}
+}
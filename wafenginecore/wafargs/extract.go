@@ -0,0 +1,425 @@
+// Package wafargs 把请求拆成一组具名参数值（查询参数、表单、JSON 嵌套路径、XML、multipart 字段、
+// GraphQL 变量、Cookie、部分请求头），供内置检测逐个判定。
+//
+// 对整段 RawQuery/BODY 跑 libinjection 有两个问题：大 JSON 里的普通标点会拼出误报，
+// 而真正的载荷夹在结构里又可能被上下文冲掉漏报；同时 Cookie 和请求头里的值根本没人看。
+// 逐值检测既更准，也能在日志里指明是哪个参数命中。
+package wafargs
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/wafenginecore/wafhttpcore"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxArgs        = 2048     // 单个请求最多拆出的参数数，超出时原始查询串与请求体整体补检一次
+	MaxDepth       = 32       // JSON/XML 最大展开深度，更深的子树整体作为一个值
+	MaxInspectBody = 1 << 20  // 日志没记录请求体时（超过记录上限），为检测单独读取的上限
+	maxPartBytes   = 64 << 10 // multipart 单个文本字段读取上限
+	urlDecodeDepth = 10       // 与 RawQuery 的多轮解码保持一致，防双重编码绕过
+)
+
+// InspectHeaders 逐值检测的请求头：常被后端拼进 SQL/日志/跳转地址的那几个
+var InspectHeaders = []string{"Referer", "User-Agent", "X-Forwarded-Host", "X-Original-URL", "X-Rewrite-URL"}
+
+type extractor struct {
+	args      []innerbean.ReqArg
+	truncated bool //参数数到了上限，后面的没再拆
+}
+
+func (e *extractor) full() bool {
+	if len(e.args) >= MaxArgs {
+		e.truncated = true
+		return true
+	}
+	return false
+}
+
+// catchAll 参数被截断时把原始内容整体作为一个值补上，不受 MaxArgs 限制。
+// 否则在前面塞满无害参数就能把载荷挤出检测范围
+func (e *extractor) catchAll(source, value string) {
+	if e.truncated && value != "" {
+		e.args = append(e.args, innerbean.ReqArg{Source: source, Value: value})
+	}
+}
+
+func (e *extractor) add(source, name, value string, isName bool) {
+	if value == "" || e.full() {
+		return
+	}
+	e.args = append(e.args, innerbean.ReqArg{Source: source, Name: name, Value: value, IsName: isName})
+}
+
+// Extract 拆出请求的全部参数。body 为已读出的请求体（可为空）。
+func Extract(r *http.Request, body []byte) []innerbean.ReqArg {
+	e := &extractor{}
+	if r.URL != nil {
+		e.urlEncoded(innerbean.ReqArgSourceQuery, r.URL.RawQuery)
+	}
+	if len(body) > 0 {
+		e.body(r.Header.Get("Content-Type"), body)
+	}
+	for _, c := range r.Cookies() {
+		e.add(innerbean.ReqArgSourceCookie, c.Name, decode(c.Value), false)
+	}
+	for _, h := range InspectHeaders {
+		for _, v := range r.Header.Values(h) {
+			e.add(innerbean.ReqArgSourceHeader, h, v, false)
+		}
+	}
+	if r.URL != nil {
+		e.catchAll(innerbean.ReqArgSourceQuery, decode(r.URL.RawQuery))
+	}
+	e.catchAll(innerbean.ReqArgSourceBody, string(body))
+	return e.args
+}
+
+// ExtractForm 拆 x-www-form-urlencoded 格式的字符串
+func ExtractForm(source, encoded string) []innerbean.ReqArg {
+	e := &extractor{}
+	e.urlEncoded(source, encoded)
+	e.catchAll(source, decode(encoded))
+	return e.args
+}
+
+// ExtractText 拆一段独立的文本消息（如 WebSocket 文本消息）：JSON 按嵌套路径展开，其余整体作为一个值
+func ExtractText(source, text string) []innerbean.ReqArg {
+	e := &extractor{}
+	if t := strings.TrimSpace(text); strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+		if v, err := decodeSingleJSON([]byte(t)); err == nil {
+			e.walkJSON(source, "", v, 0)
+			e.catchAll(source, text)
+			return e.args
+		}
+	}
+	e.add(source, "", text, false)
+	return e.args
+}
+
+// ReadBody 日志没有记录请求体时（超过记录上限或未读取），为检测单独读出请求体，并复位 r.Body。
+// 压缩过的、分块传输的、超过 MaxInspectBody 的请求不读。
+func ReadBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength <= 0 || r.ContentLength > MaxInspectBody {
+		return nil
+	}
+	if r.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	raw, _ := io.ReadAll(io.LimitReader(r.Body, MaxInspectBody))
+	// ContentLength 与实际不符时后面可能还有数据，原样接回去
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(raw), r.Body))
+	return raw
+}
+
+func decode(v string) string {
+	return wafhttpcore.WafHttpCoreUrlEncode(v, urlDecodeDepth)
+}
+
+// plainArgName 常规参数名。参数名里出现其他字符时把整段 k=v 也作为一个值检测
+func plainArgName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_-.[]", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *extractor) urlEncoded(source, encoded string) {
+	for _, seg := range strings.Split(encoded, "&") {
+		if seg == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(seg, "=")
+		key := decode(rawKey)
+		e.add(source, key, decode(rawValue), false)
+		if !plainArgName(key) {
+			e.add(source, key, decode(seg), true)
+		}
+	}
+}
+
+func (e *extractor) body(contentType string, body []byte) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		e.urlEncoded(innerbean.ReqArgSourceForm, string(body))
+		return
+	case mediaType == "application/graphql":
+		e.graphQLLiterals("", string(body))
+		return
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if e.multipart(body, params["boundary"]) == nil {
+			return
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if e.json(body) == nil {
+			return
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if e.xml(body) == nil {
+			return
+		}
+	case binaryMediaType(mediaType):
+		return
+	}
+	// 无法按结构解析（类型未知或报文畸形）：整体作为一个值，保持原先对 BODY 的覆盖
+	e.add(innerbean.ReqArgSourceBody, "", string(body), false)
+}
+
+// binaryMediaType 二进制内容不做文本检测（文件上传内容由上传检测负责）
+func binaryMediaType(mediaType string) bool {
+	for _, p := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(mediaType, p) {
+			return true
+		}
+	}
+	switch mediaType {
+	case "application/octet-stream", "application/zip", "application/gzip", "application/pdf",
+		"application/grpc", "application/grpc+proto", "application/protobuf", "application/x-protobuf":
+		return true
+	}
+	return false
+}
+
+func (e *extractor) multipart(body []byte, boundary string) error {
+	if boundary == "" {
+		return errors.New("multipart 缺少 boundary")
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for !e.full() {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() != "" {
+			part.Close()
+			continue
+		}
+		value, _ := io.ReadAll(io.LimitReader(part, maxPartBytes))
+		part.Close()
+		e.add(innerbean.ReqArgSourceMultipart, part.FormName(), string(value), false)
+	}
+	return nil
+}
+
+// decodeSingleJSON 解码一个完整的 JSON 值。后面还跟着别的内容（第二个值、多余的括号、任意文本）时报错，
+// 由调用方按整体检测，免得载荷藏在第一个值后面
+func decodeSingleJSON(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("JSON 值后还有多余内容")
+	}
+	return v, nil
+}
+
+func (e *extractor) json(body []byte) error {
+	v, err := decodeSingleJSON(body)
+	if err != nil {
+		return err
+	}
+	if e.graphQL(v) {
+		return nil
+	}
+	e.walkJSON(innerbean.ReqArgSourceJSON, "", v, 0)
+	return nil
+}
+
+func (e *extractor) walkJSON(source, path string, v interface{}, depth int) {
+	if e.full() {
+		return
+	}
+	if depth > MaxDepth {
+		raw, _ := json.Marshal(v)
+		e.add(source, path, string(raw), false)
+		return
+	}
+	switch t := v.(type) {
+	case string:
+		e.add(source, path, t, false)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			// 键名同样可能被后端拼进 SQL/模板，与查询参数一样，键名里有常规字符以外的内容时单独检测
+			if !plainArgName(k) {
+				e.add(source, child, k, true)
+			}
+			e.walkJSON(source, child, t[k], depth+1)
+		}
+	case []interface{}:
+		for i, item := range t {
+			e.walkJSON(source, path+"["+strconv.Itoa(i)+"]", item, depth+1)
+		}
+	}
+	// 数字、布尔、null 不携带载荷，不拆
+}
+
+// graphQL 识别 GraphQL over HTTP 的 JSON 请求（单个操作或批量数组）。
+// 变量按路径拆；查询文档本身是大量括号花括号，整体检测必然误报，只取其中的字符串字面量。
+func (e *extractor) graphQL(v interface{}) bool {
+	if ops, ok := v.([]interface{}); ok && len(ops) > 0 {
+		for _, op := range ops {
+			if !isGraphQLOperation(op) {
+				return false
+			}
+		}
+		for i, op := range ops {
+			e.graphQLOperation("["+strconv.Itoa(i)+"].", op.(map[string]interface{}))
+		}
+		return true
+	}
+	if !isGraphQLOperation(v) {
+		return false
+	}
+	e.graphQLOperation("", v.(map[string]interface{}))
+	return true
+}
+
+func isGraphQLOperation(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	query, ok := m["query"].(string)
+	if !ok || !strings.Contains(query, "{") {
+		return false
+	}
+	if _, ok := m["variables"]; ok {
+		return true
+	}
+	if _, ok := m["operationName"]; ok {
+		return true
+	}
+	q := strings.TrimSpace(query)
+	return strings.HasPrefix(q, "{") || strings.HasPrefix(q, "query") || strings.HasPrefix(q, "mutation") || strings.HasPrefix(q, "subscription")
+}
+
+func (e *extractor) graphQLOperation(prefix string, op map[string]interface{}) {
+	query, _ := op["query"].(string)
+	e.graphQLLiterals(prefix, query)
+	if vars, ok := op["variables"]; ok {
+		// variables 偶尔被客户端序列化成字符串再放进来
+		if s, isStr := vars.(string); isStr {
+			d := json.NewDecoder(strings.NewReader(s))
+			d.UseNumber()
+			var parsed interface{}
+			if d.Decode(&parsed) == nil {
+				vars = parsed
+			}
+		}
+		e.walkJSON(innerbean.ReqArgSourceGraphQL, strings.TrimSuffix(prefix+"variables", "."), vars, 1)
+	}
+}
+
+// graphQLLiterals 取 GraphQL 文档中的字符串字面量（"..." 与 """...""" 块字符串）
+func (e *extractor) graphQLLiterals(prefix, doc string) {
+	n := 0
+	for i := 0; i < len(doc) && !e.full(); i++ {
+		switch doc[i] {
+		case '#': // 注释到行尾
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case '"':
+			var lit strings.Builder
+			if strings.HasPrefix(doc[i:], `"""`) {
+				end := strings.Index(doc[i+3:], `"""`)
+				if end < 0 {
+					end = len(doc) - i - 3
+				}
+				lit.WriteString(doc[i+3 : i+3+end])
+				i += 3 + end + 2
+			} else {
+				for i++; i < len(doc) && doc[i] != '"'; i++ {
+					if doc[i] == '\\' && i+1 < len(doc) {
+						i++
+						switch doc[i] {
+						case 'n':
+							lit.WriteByte('\n')
+						case 't':
+							lit.WriteByte('\t')
+						default:
+							lit.WriteByte(doc[i])
+						}
+						continue
+					}
+					lit.WriteByte(doc[i])
+				}
+			}
+			e.add(innerbean.ReqArgSourceGraphQL, prefix+"literal["+strconv.Itoa(n)+"]", lit.String(), false)
+			n++
+		}
+	}
+}
+
+func (e *extractor) xml(body []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	var stack []string
+	for !e.full() {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			path := xmlPath(stack)
+			for _, attr := range t.Attr {
+				e.add(innerbean.ReqArgSourceXML, path+"@"+attr.Name.Local, attr.Value, false)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			if text := strings.TrimSpace(string(t)); text != "" {
+				e.add(innerbean.ReqArgSourceXML, xmlPath(stack), text, false)
+			}
+		}
+	}
+	return nil
+}
+
+func xmlPath(stack []string) string {
+	if len(stack) > MaxDepth {
+		stack = stack[len(stack)-MaxDepth:]
+	}
+	return strings.Join(stack, ".")
+}
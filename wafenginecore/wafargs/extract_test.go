@@ -0,0 +1,140 @@
+package wafargs
+
+import (
+	"SamWaf/innerbean"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func argMap(args []innerbean.ReqArg) map[string]string {
+	m := map[string]string{}
+	for _, a := range args {
+		m[a.Label()] = a.Value
+	}
+	return m
+}
+
+func TestExtract_Sources(t *testing.T) {
+	cases := []struct {
+		name  string
+		ct    string
+		body  string
+		query string
+		want  map[string]string
+	}{
+		{"查询参数多轮解码", "", "", "id=1%2527&name=a", map[string]string{"query:id": "1'", "query:name": "a"}},
+		{"参数名携带载荷", "", "", "1'or'1'='1", map[string]string{"query:1'or'1'": "'1", "query:1'or'1'(参数名)": "1'or'1'='1"}},
+		{"表单", "application/x-www-form-urlencoded", "a=1&b=%3Cx%3E", "", map[string]string{"form:a": "1", "form:b": "<x>"}},
+		{"JSON嵌套", "application/json; charset=utf-8", `{"user":{"name":"tom","tags":["x","y"],"age":3}}`, "",
+			map[string]string{"json:user.name": "tom", "json:user.tags[0]": "x", "json:user.tags[1]": "y"}},
+		{"XML", "application/xml", `<a><b id="7">hi</b><c> </c></a>`, "", map[string]string{"xml:a.b@id": "7", "xml:a.b": "hi"}},
+		{"GraphQL", "application/json", `{"query":"query Q($id: ID!) { user(id: $id, note: \"n1\") { name } }","variables":{"id":"42"}}`, "",
+			map[string]string{"graphql:variables.id": "42", "graphql:literal[0]": "n1"}},
+		{"畸形JSON整体检测", "application/json", `{"a":`, "", map[string]string{"body": `{"a":`}},
+		{"JSON后有多余内容整体检测", "application/json", `{"a":"1"}{"b":"' or 1=1--"}`, "", map[string]string{"body": `{"a":"1"}{"b":"' or 1=1--"}`}},
+		{"JSON后有多余括号整体检测", "application/json", `{"a":"1"}]' or 1=1--`, "", map[string]string{"body": `{"a":"1"}]' or 1=1--`}},
+		{"JSON键名携带载荷", "application/json", `{"user":{"1' or '1'='1":"x","name":"tom"}}`, "",
+			map[string]string{"json:user.1' or '1'='1": "x", "json:user.1' or '1'='1(参数名)": "1' or '1'='1", "json:user.name": "tom"}},
+		{"未知类型整体检测", "text/plain", "hello", "", map[string]string{"body": "hello"}},
+		{"二进制不检测", "application/octet-stream", "\x00\x01", "", map[string]string{}},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "http://a.com/p", nil)
+		r.URL.RawQuery = c.query
+		if c.ct != "" {
+			r.Header.Set("Content-Type", c.ct)
+		}
+		got := argMap(Extract(r, []byte(c.body)))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: 期望 %v，实际 %v", c.name, c.want, got)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("%s: %s 期望 %q，实际 %q（全部 %v）", c.name, k, v, got[k], got)
+			}
+		}
+	}
+}
+
+// 参数数超过上限时，原始查询串与请求体整体各补一个值，排在后面的载荷不能被挤掉
+func TestExtract_TruncatedCatchAll(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"pad":[`)
+	for i := 0; i < MaxArgs; i++ {
+		sb.WriteString(`"x",`)
+	}
+	sb.WriteString(`"y"],"z":"' or 1=1--"}`)
+	body := sb.String()
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/p?id=1", nil)
+	r.Header.Set("Content-Type", "application/json")
+	args := Extract(r, []byte(body))
+	if len(args) != MaxArgs+2 {
+		t.Fatalf("期望 %d 个参数，实际 %d", MaxArgs+2, len(args))
+	}
+	got := argMap(args[MaxArgs:])
+	if got["body"] != body || got["query"] != "id=1" {
+		t.Fatalf("截断后应整体补检查询串与请求体: %v", got)
+	}
+
+	if args := Extract(httptest.NewRequest(http.MethodGet, "http://a.com/p?id=1", nil), nil); len(args) != 1 {
+		t.Fatalf("未截断时不应补整体值: %v", args)
+	}
+}
+
+func TestExtract_MultipartCookieHeader(t *testing.T) {
+	body := "--XX\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nhello\r\n" +
+		"--XX\r\nContent-Disposition: form-data; name=\"f\"; filename=\"a.txt\"\r\n\r\nfile content\r\n--XX--\r\n"
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/up", strings.NewReader(body))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=XX")
+	r.Header.Set("Cookie", "sid=abc%27; lang=zh")
+	r.Header.Set("X-Forwarded-Host", "evil.com")
+	got := argMap(Extract(r, []byte(body)))
+	want := map[string]string{"multipart:title": "hello", "cookie:sid": "abc'", "cookie:lang": "zh", "header:X-Forwarded-Host": "evil.com"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s 期望 %q，实际 %q（全部 %v）", k, v, got[k], got)
+		}
+	}
+	if _, ok := got["multipart:f"]; ok {
+		t.Errorf("文件字段应交给上传检测，不作为参数: %v", got)
+	}
+}
+
+func TestReadBody_RestoresBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://a.com/", strings.NewReader(`{"a":"b"}`))
+	raw := ReadBody(r)
+	if string(raw) != `{"a":"b"}` {
+		t.Fatalf("读取内容不对: %q", raw)
+	}
+	rest := make([]byte, 64)
+	n, _ := r.Body.Read(rest)
+	if string(rest[:n]) != `{"a":"b"}` {
+		t.Fatalf("读取后应复位请求体，实际 %q", rest[:n])
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	src := innerbean.ReqArgSourceWebSocket
+	cases := map[string]map[string]string{
+		`{"op":"chat","data":{"msg":"1' or '1'='1","n":3}}`: {"websocket:data.msg": "1' or '1'='1", "websocket:op": "chat"},
+		` ["a",{"b":"c"}] `:         {"websocket:[0]": "a", "websocket:[1].b": "c"},
+		`{"a":1} trailing`:          {"websocket": `{"a":1} trailing`},
+		`{"a":1}]"b"`:               {"websocket": `{"a":1}]"b"`},
+		"<script>alert(1)</script>": {"websocket": "<script>alert(1)</script>"},
+	}
+	for text, want := range cases {
+		got := argMap(ExtractText(src, text))
+		if len(got) != len(want) {
+			t.Errorf("%s: 期望 %v，实际 %v", text, want, got)
+			continue
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: %s 期望 %q，实际 %q", text, k, v, got[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package wafcaptcha
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// JS 挑战（EngineType "jschallenge"）：不需要访客操作的"正在检查浏览器"页面。
+// 页面里是一段混淆过的计算，能执行 JS、支持 Cookie 的浏览器自动算出结果提交，
+// 服务端校验签名令牌与答案后发放和其它验证码一样的通过凭证。令牌本身不落缓存，
+// 只把用过的 nonce 记下来防止重放。
+
+const (
+	EngineJsChallenge = "jschallenge"
+
+	jsChallengeTTL        = 5 * time.Minute   //挑战页有效期
+	jsChallengeModulus    = 1000007           //答案取模，保证 JS 里整数运算不溢出
+	jsChallengeProbeName  = "samwaf_js_probe" //JS 写入的探测 Cookie，校验浏览器支持 Cookie
+	JsChallengeVerifyPath = "/js_verify"      //提交答案的路径(挂在验证码路径前缀下)
+	clearanceCookieName   = "samwaf_captcha_token"
+	bindModeFingerprint   = "fingerprint"
+	clearanceHeaderName   = "X-SamWaf-Captcha-Token"
+)
+
+// jsChallengeSecret 签名密钥，进程启动时随机生成；重启只会让未完成的挑战失效，已发放的通过凭证不受影响
+var jsChallengeSecret = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// headlessUAMarkers 无头浏览器/自动化工具常见的 UA 特征
+var headlessUAMarkers = []string{"headlesschrome", "phantomjs", "slimerjs", "puppeteer", "playwright"}
+
+// ClearanceBinding 通过凭证绑定的对象：默认是客户端IP，JS 挑战可配置为绑定浏览器特征
+func ClearanceBinding(r *http.Request, captchaConfig model.CaptchaConfig, clientIP string) string {
+	if captchaConfig.EngineType == EngineJsChallenge && captchaConfig.JsChallengeConfig.BindMode == bindModeFingerprint {
+		sum := sha256.Sum256([]byte(r.UserAgent() + "|" + r.Header.Get("Accept-Language")))
+		return "fp:" + hex.EncodeToString(sum[:8])
+	}
+	return clientIP
+}
+
+// jsChallenge 一次挑战的参数
+type jsChallenge struct {
+	a, b, c int64
+	nonce   string
+	expire  int64
+}
+
+func (c jsChallenge) answer() int64 {
+	return ((c.a^c.b)*3 + c.c) % jsChallengeModulus
+}
+
+// sign 令牌把 nonce、截止时间、绑定对象和答案签在一起，服务端不用存挑战本身
+func (c jsChallenge) sign(binding string, answer int64) string {
+	mac := hmac.New(sha256.New, jsChallengeSecret)
+	mac.Write([]byte(fmt.Sprintf("%s|%d|%s|%d", c.nonce, c.expire, binding, answer)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c jsChallenge) token(binding string) string {
+	return c.nonce + "." + strconv.FormatInt(c.expire, 10) + "." + c.sign(binding, c.answer())
+}
+
+func newJsChallenge(now time.Time) jsChallenge {
+	return jsChallenge{
+		a:      randInt(1<<20, 1<<24),
+		b:      randInt(1<<20, 1<<24),
+		c:      randInt(1000, 1000000),
+		nonce:  strings.ReplaceAll(uuid.GenUUID(), "-", ""),
+		expire: now.Add(jsChallengeTTL).Unix(),
+	}
+}
+
+// verifyJsChallengeToken 校验令牌与答案，返回 nonce 或失败原因
+func verifyJsChallengeToken(token string, answer int64, binding string, now time.Time) (string, string) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "令牌格式错误"
+	}
+	expire, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", "令牌格式错误"
+	}
+	if now.Unix() > expire {
+		return "", "挑战已过期"
+	}
+	c := jsChallenge{nonce: parts[0], expire: expire}
+	if !hmac.Equal([]byte(c.sign(binding, answer)), []byte(parts[2])) {
+		return "", "答案或令牌不正确"
+	}
+	return c.nonce, ""
+}
+
+func randInt(min, max int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(max-min))
+	if err != nil {
+		return min
+	}
+	return min + n.Int64()
+}
+
+// randIdent 随机的 JS 变量名，每次出页面都不一样
+func randIdent() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, 6)
+	for i := range b {
+		b[i] = letters[randInt(0, int64(len(letters)))]
+	}
+	return "_" + string(b)
+}
+
+// obfuscateInt 十六进制后倒序，页面里看不到原始数字
+func obfuscateInt(v int64) string {
+	s := []byte(strconv.FormatInt(v, 16))
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return string(s)
+}
+
+// ShowJsChallengePage 输出 JS 挑战页
+func (s *CaptchaService) ShowJsChallengePage(w http.ResponseWriter, r *http.Request, captchaConfig model.CaptchaConfig, pathPrefix string, webLog *innerbean.WebLog, ipMode string) {
+	binding := ClearanceBinding(r, captchaConfig, model.GetClientIPByMode(ipMode, webLog.NetSrcIp, webLog.SRC_IP))
+	c := newJsChallenge(time.Now())
+	verifyURL, _ := json.Marshal(strings.TrimSuffix(pathPrefix, "/") + JsChallengeVerifyPath)
+	token, _ := json.Marshal(c.token(binding))
+
+	data, decode, va, vb, vc := randIdent(), randIdent(), randIdent(), randIdent(), randIdent()
+	script := fmt.Sprintf(`(function(){var %[1]s=["%[6]s","%[7]s","%[8]s"];function %[2]s(s){return parseInt(s.split("").reverse().join(""),16)}`+
+		`var %[3]s=%[2]s(%[1]s[0]),%[4]s=%[2]s(%[1]s[1]),%[5]s=%[2]s(%[1]s[2]);`+
+		`var n=navigator;document.cookie="%[9]s=1; path=/; SameSite=Lax";`+
+		`var sg={wd:n.webdriver===true?1:0,ck:(n.cookieEnabled&&document.cookie.indexOf("%[9]s=")>=0)?1:0,lg:(n.languages||[]).length};`+
+		`setTimeout(function(){var x=new XMLHttpRequest();x.open("POST",%[10]s,true);x.setRequestHeader("Content-Type","application/json");`+
+		`x.onload=function(){try{if(JSON.parse(x.responseText).success){location.reload();return}}catch(e){}document.getElementById("m").style.display="block"};`+
+		`x.send(JSON.stringify({token:%[11]s,answer:((%[3]s^%[4]s)*3+%[5]s)%%%[12]d,signals:sg}))},600)})();`,
+		data, decode, va, vb, vc, obfuscateInt(c.a), obfuscateInt(c.b), obfuscateInt(c.c),
+		jsChallengeProbeName, verifyURL, token, jsChallengeModulus)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "0")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><meta name="robots" content="noindex,nofollow"><title>正在检查浏览器 / Checking your browser</title>` +
+		`<style>body{font-family:sans-serif;text-align:center;padding-top:15vh;color:#333}#m{display:none;color:#c00}</style></head><body>` +
+		`<h2>正在检查您的浏览器，请稍候…</h2><p>Checking your browser before accessing the site…</p>` +
+		`<p id="m">验证未通过，请刷新页面重试 / Verification failed, please reload the page.</p>` +
+		`<noscript><p>请启用 JavaScript 与 Cookie 后刷新 / Please enable JavaScript and cookies, then reload.</p></noscript>` +
+		`<script>` + script + `</script></body></html>`))
+}
+
+// VerifyJsChallenge 校验 JS 挑战提交的答案，通过后发放通过凭证
+func (s *CaptchaService) VerifyJsChallenge(w http.ResponseWriter, r *http.Request, captchaConfig model.CaptchaConfig, webLog *innerbean.WebLog, ipMode string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Token   string `json:"token"`
+		Answer  int64  `json:"answer"`
+		Signals struct {
+			WebDriver     int `json:"wd"`
+			CookieEnabled int `json:"ck"`
+			Languages     int `json:"lg"`
+		} `json:"signals"`
+	}
+	reason := ""
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		reason = "提交内容格式错误"
+	}
+	clientIP := model.GetClientIPByMode(ipMode, webLog.NetSrcIp, webLog.SRC_IP)
+	binding := ClearanceBinding(r, captchaConfig, clientIP)
+	if reason == "" {
+		reason = checkJsChallengeSignals(r, req.Signals.WebDriver, req.Signals.CookieEnabled, req.Signals.Languages)
+	}
+	nonce := ""
+	if reason == "" {
+		nonce, reason = verifyJsChallengeToken(req.Token, req.Answer, binding, time.Now())
+	}
+	if reason == "" && s.cache != nil {
+		// 一个挑战只能兑换一次
+		usedKey := enums.CACHE_CAPTCHA_TRY + "js" + nonce
+		if s.cache.IsKeyExist(usedKey) {
+			reason = "挑战已使用"
+		} else {
+			s.cache.SetWithTTl(usedKey, "1", jsChallengeTTL)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if reason != "" {
+		zlog.Debug("JS挑战验证失败", zap.String("reason", reason), zap.String("binding", binding))
+		webLog.ACTION = "禁止"
+		webLog.RULE = "JS挑战验证失败:" + reason
+		global.GQEQUE_LOG_DB.Enqueue(webLog)
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": false})
+		return
+	}
+
+	s.issueClearance(w, r, captchaConfig, binding)
+	http.SetCookie(w, &http.Cookie{Name: jsChallengeProbeName, Value: "", Path: "/", MaxAge: -1})
+	webLog.ACTION = "放行"
+	webLog.RULE = "JS挑战验证通过"
+	global.GQEQUE_LOG_DB.Enqueue(webLog)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// checkJsChallengeSignals 无头浏览器与不支持 Cookie 的客户端直接判失败
+func checkJsChallengeSignals(r *http.Request, webDriver, cookieEnabled, languages int) string {
+	ua := strings.ToLower(r.UserAgent())
+	for _, marker := range headlessUAMarkers {
+		if strings.Contains(ua, marker) {
+			return "无头浏览器"
+		}
+	}
+	if webDriver != 0 {
+		return "自动化浏览器(webdriver)"
+	}
+	if cookieEnabled == 0 {
+		return "浏览器不支持Cookie"
+	}
+	if _, err := r.Cookie(jsChallengeProbeName); err != nil {
+		return "浏览器不支持Cookie"
+	}
+	if languages == 0 {
+		return "浏览器语言列表为空"
+	}
+	return ""
+}
+
+// issueClearance 发放通过凭证：缓存里登记，Cookie 与响应头各带一份
+func (s *CaptchaService) issueClearance(w http.ResponseWriter, r *http.Request, captchaConfig model.CaptchaConfig, binding string) {
+	if s.cache == nil {
+		// 缓存未初始化时登记不了凭证，下发的 Cookie 也校验不过，不如不发
+		return
+	}
+	captchaPassToken := uuid.GenUUID()
+	s.cache.SetWithTTl(enums.CACHE_CAPTCHA_PASS+captchaPassToken+binding, "ok", time.Duration(captchaConfig.ExpireTime)*time.Hour)
+	http.SetCookie(w, &http.Cookie{
+		Name:     clearanceCookieName,
+		Value:    captchaPassToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		MaxAge:   captchaConfig.ExpireTime * 3600,
+	})
+	w.Header().Set(clearanceHeaderName, captchaPassToken)
+}
@@ -0,0 +1,135 @@
+package wafcaptcha
+
+import (
+	"SamWaf/cache"
+	"SamWaf/common/queue"
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	pageNumbersRe = regexp.MustCompile(`=\["([0-9a-f]+)","([0-9a-f]+)","([0-9a-f]+)"\]`)
+	pageTokenRe   = regexp.MustCompile(`token:"([^"]+)"`)
+)
+
+func newJsChallengeTestService() *CaptchaService {
+	zlog.InitZLog(false, "console")
+	if global.GQEQUE_LOG_DB == nil {
+		global.GQEQUE_LOG_DB = queue.NewQueue()
+	}
+	return &CaptchaService{cache: cache.InitWafCache()}
+}
+
+// solvePage 按浏览器的算法从挑战页里算出令牌和答案
+func solvePage(t *testing.T, html string) (string, int64) {
+	t.Helper()
+	nums := pageNumbersRe.FindStringSubmatch(html)
+	token := pageTokenRe.FindStringSubmatch(html)
+	if nums == nil || token == nil {
+		t.Fatalf("挑战页里找不到挑战参数: %s", html)
+	}
+	var v [3]int64
+	for i := range v {
+		s := []byte(nums[i+1])
+		for l, r := 0, len(s)-1; l < r; l, r = l+1, r-1 {
+			s[l], s[r] = s[r], s[l]
+		}
+		v[i], _ = strconv.ParseInt(string(s), 16, 64)
+	}
+	return token[1], ((v[0]^v[1])*3 + v[2]) % jsChallengeModulus
+}
+
+func jsVerifyRequest(token string, answer int64, webdriver int, ua string) *http.Request {
+	body := fmt.Sprintf(`{"token":%q,"answer":%d,"signals":{"wd":%d,"ck":1,"lg":2}}`, token, answer, webdriver)
+	r := httptest.NewRequest(http.MethodPost, "/samwaf_captcha/js_verify", strings.NewReader(body))
+	r.Header.Set("User-Agent", ua)
+	r.AddCookie(&http.Cookie{Name: jsChallengeProbeName, Value: "1"})
+	return r
+}
+
+func TestJsChallengeFlow(t *testing.T) {
+	s := newJsChallengeTestService()
+	cfg := model.ParseCaptchaConfig(`{"engine_type":"jschallenge"}`)
+	const ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0"
+	newPage := func() (string, int64) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/login", nil)
+		r.Header.Set("User-Agent", ua)
+		s.ShowJsChallengePage(w, r, cfg, "/samwaf_captcha", &innerbean.WebLog{NetSrcIp: "1.2.3.4"}, "nic")
+		if w.Code != http.StatusForbidden || w.Header().Get("Cache-Control") == "" {
+			t.Fatalf("挑战页状态或缓存头不正确: %d", w.Code)
+		}
+		return solvePage(t, w.Body.String())
+	}
+	verify := func(r *http.Request, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.VerifyJsChallenge(w, r, cfg, &innerbean.WebLog{NetSrcIp: ip}, "nic")
+		return w
+	}
+
+	token, answer := newPage()
+	if w := verify(jsVerifyRequest(token, answer+1, 0, ua), "1.2.3.4"); w.Code != http.StatusForbidden {
+		t.Fatalf("答案错误应失败")
+	}
+	if w := verify(jsVerifyRequest(token, answer, 0, ua), "5.6.7.8"); w.Code != http.StatusForbidden {
+		t.Fatalf("换了IP提交应失败")
+	}
+	if w := verify(jsVerifyRequest(token, answer, 1, ua), "1.2.3.4"); w.Code != http.StatusForbidden {
+		t.Fatalf("webdriver 应失败")
+	}
+	if w := verify(jsVerifyRequest(token, answer, 0, "Mozilla/5.0 HeadlessChrome/120.0"), "1.2.3.4"); w.Code != http.StatusForbidden {
+		t.Fatalf("无头浏览器应失败")
+	}
+
+	w := verify(jsVerifyRequest(token, answer, 0, ua), "1.2.3.4")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":true`) {
+		t.Fatalf("正确答案应通过, 实际 %d %s", w.Code, w.Body.String())
+	}
+	pass := w.Header().Get(clearanceHeaderName)
+	if pass == "" || !s.cache.IsKeyExist(enums.CACHE_CAPTCHA_PASS+pass+"1.2.3.4") {
+		t.Fatalf("通过后应发放绑定IP的凭证")
+	}
+	if w := verify(jsVerifyRequest(token, answer, 0, ua), "1.2.3.4"); w.Code != http.StatusForbidden {
+		t.Fatalf("同一个挑战不能重复兑换")
+	}
+}
+
+func TestJsChallengeTokenExpired(t *testing.T) {
+	now := time.Now()
+	c := newJsChallenge(now)
+	if _, reason := verifyJsChallengeToken(c.token("ip"), c.answer(), "ip", now); reason != "" {
+		t.Fatalf("有效期内应通过: %s", reason)
+	}
+	if _, reason := verifyJsChallengeToken(c.token("ip"), c.answer(), "ip", now.Add(jsChallengeTTL+time.Minute)); reason == "" {
+		t.Fatalf("过期令牌应失败")
+	}
+}
+
+func TestClearanceBinding(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "ua-1")
+	cfg := model.ParseCaptchaConfig(`{"engine_type":"jschallenge","js_challenge_config":{"bind_mode":"fingerprint"}}`)
+	fp := ClearanceBinding(r, cfg, "1.2.3.4")
+	if !strings.HasPrefix(fp, "fp:") {
+		t.Fatalf("指纹绑定应不含IP, 实际 %s", fp)
+	}
+	r.Header.Set("User-Agent", "ua-2")
+	if ClearanceBinding(r, cfg, "1.2.3.4") == fp {
+		t.Fatalf("浏览器特征变化后绑定值应不同")
+	}
+	cfg.EngineType = "traditional"
+	if ClearanceBinding(r, cfg, "1.2.3.4") != "1.2.3.4" {
+		t.Fatalf("其它引擎始终绑定IP")
+	}
+}
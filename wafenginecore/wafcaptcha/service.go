@@ -208,6 +208,21 @@ func (s *CaptchaService) HandleCaptchaRequest(w http.ResponseWriter, r *http.Req
 			// 默认显示验证码选择页面
 			s.ShowCaptchaHomePage(w, r, captchaConfig, pathPrefix)
 		}
+	} else if captchaConfig.EngineType == EngineJsChallenge {
+		//无交互的浏览器挑战
+		if path == captchaPath+JsChallengeVerifyPath {
+			s.VerifyJsChallenge(w, r, captchaConfig, weblog, ipMode)
+		} else {
+			// 记录日志信息，由规则/CC 触发时保留触发原因
+			weblog.ACTION = "禁止"
+			if weblog.RULE != "" {
+				weblog.RULE = weblog.RULE + "(显示JS挑战)"
+			} else {
+				weblog.RULE = "显示JS挑战"
+			}
+			global.GQEQUE_LOG_DB.Enqueue(weblog)
+			s.ShowJsChallengePage(w, r, captchaConfig, pathPrefix, weblog, ipMode)
+		}
 	}
 
 }
@@ -366,7 +381,7 @@ func (s *CaptchaService) GetClickBasicCaptData(w http.ResponseWriter, r *http.Re
 			"code":    1,
 			"message": "gen captcha data failed",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 
@@ -377,7 +392,7 @@ func (s *CaptchaService) GetClickBasicCaptData(w http.ResponseWriter, r *http.Re
 			"code":    1,
 			"message": "base64 data failed",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 
@@ -387,7 +402,7 @@ func (s *CaptchaService) GetClickBasicCaptData(w http.ResponseWriter, r *http.Re
 			"code":    1,
 			"message": "base64 data failed",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 
@@ -403,7 +418,7 @@ func (s *CaptchaService) GetClickBasicCaptData(w http.ResponseWriter, r *http.Re
 		"thumb_base64": thumbImageBase64,
 	})
 
-	_, _ = fmt.Fprintf(w, string(bt))
+	_, _ = fmt.Fprint(w, string(bt))
 }
 
 // VerifyCaptcha 验证验证码
@@ -419,7 +434,7 @@ func (s *CaptchaService) VerifyCaptcha(w http.ResponseWriter, r *http.Request, c
 			"code":    code,
 			"message": "dots or key param is empty",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 
@@ -429,7 +444,7 @@ func (s *CaptchaService) VerifyCaptcha(w http.ResponseWriter, r *http.Request, c
 			"code":    code,
 			"message": "illegal key",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 	s.cache.Remove(enums.CACHE_CAPTCHA_TRY + key)
@@ -438,7 +453,7 @@ func (s *CaptchaService) VerifyCaptcha(w http.ResponseWriter, r *http.Request, c
 			"code":    code,
 			"message": "illegal key",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 	src := strings.Split(dots, ",")
@@ -449,7 +464,7 @@ func (s *CaptchaService) VerifyCaptcha(w http.ResponseWriter, r *http.Request, c
 			"code":    code,
 			"message": "illegal key",
 		})
-		_, _ = fmt.Fprintf(w, string(bt))
+		_, _ = fmt.Fprint(w, string(bt))
 		return
 	}
 
@@ -501,7 +516,7 @@ func (s *CaptchaService) VerifyCaptcha(w http.ResponseWriter, r *http.Request, c
 	bt, _ := json.Marshal(map[string]interface{}{
 		"code": code,
 	})
-	_, _ = fmt.Fprintf(w, string(bt))
+	_, _ = fmt.Fprint(w, string(bt))
 	return
 }
 
@@ -13,13 +13,14 @@ import (
 	"SamWaf/model/detection"
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/utils"
+	"SamWaf/wafenginecore/ldpmask"
 	"SamWaf/wafenginecore/loadbalance"
 	"SamWaf/wafenginecore/wafhttpcore"
 	"SamWaf/wafenginecore/wafhttpserver"
+	"SamWaf/wafenginecore/wafprotocol"
 	"SamWaf/wafenginecore/wafwebcache"
 	"SamWaf/wafnet"
 	"SamWaf/wafproxy"
-	"SamWaf/webplugin"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -42,7 +43,6 @@ import (
 	"github.com/pires/go-proxyproto"
 	goahocorasick "github.com/samwafgo/ahocorasick"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 type WafEngine struct {
@@ -86,11 +86,55 @@ func inferAttackType(ruleTitle string) string {
 		return "owasp_attack"
 	}
 
+	// 接口规范校验：Title 格式为 "API规范校验:<违规类型>"，违规类型里的英文单词不能再被后面的关键词误判
+	if strings.HasPrefix(ruleTitle, "api规范校验") {
+		return "api_spec_violation"
+	}
+
+	// 协议合规检测：Title 格式为 "协议异常:<异常类型>"，走私类(CL/TE 冲突、折行等)单独归类
+	if strings.HasPrefix(ruleTitle, "协议异常") {
+		if wafprotocol.IsSmuggling(strings.TrimPrefix(ruleTitle, "协议异常:")) {
+			return "request_smuggling"
+		}
+		return "protocol_anomaly"
+	}
+
+	// SSRF / 开放重定向：Title 格式为 "SSRF:<原因> <主机>" / "开放重定向:<域名>"，主机名里的字母不能再被后面的关键词误判
+	if strings.HasPrefix(ruleTitle, "ssrf:") {
+		return "ssrf_attack"
+	}
+	if strings.HasPrefix(ruleTitle, "开放重定向") {
+		return "open_redirect"
+	}
+
+	// gRPC 检测：Title 格式为 "gRPC检测:<未能检测的原因>"，请求消息无法检测按协议异常归类
+	if strings.HasPrefix(ruleTitle, "grpc检测") {
+		return "protocol_anomaly"
+	}
+
+	// GraphQL 防护：Title 格式为 "GraphQL防护:<违规类型>"，"复杂度超限" 之类的类型名不能再被后面的关键词误判
+	if strings.HasPrefix(ruleTitle, "graphql防护") {
+		return "graphql_abuse"
+	}
+
 	// AI 智能检测：Title 格式为 "AI检测:score=x.xx"，需在 SQL/RCE 等关键词匹配之前优先处理
 	if strings.HasPrefix(ruleTitle, "ai检测") {
 		return "ai_attack"
 	}
 
+	// 爬虫策略：Title 格式为 "爬虫策略拦截:<爬虫名>" / "爬虫策略限流:<爬虫名>"，爬虫名里可能带 bot 等关键词
+	if strings.HasPrefix(ruleTitle, "爬虫策略限流") {
+		return "crawler_throttle"
+	}
+	if strings.HasPrefix(ruleTitle, "爬虫策略拦截") {
+		return "crawler_policy"
+	}
+
+	// 文件上传/请求体检测：Title 格式为 "文件上传检测-<类型>" / "请求体检测-YARA"，"病毒扫描失败" 之类的类型名会被后面的"扫描"误判
+	if strings.HasPrefix(ruleTitle, "文件上传检测") || strings.HasPrefix(ruleTitle, "请求体检测") {
+		return "upload_attack"
+	}
+
 	// CC攻击
 	if strings.Contains(ruleTitle, "cc") || strings.Contains(ruleTitle, "频次") || strings.Contains(ruleTitle, "rate limit") {
 		return "cc_attack"
@@ -416,12 +460,18 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			} else {
 				weblogbean.HOST = "ws://" + weblogbean.HOST
 			}
+			prepareWebSocketInspect(r, &weblogbean, hostTarget)
 		} else if r.TLS != nil {
 			weblogbean.HOST = "https://" + weblogbean.HOST
 		} else {
 			weblogbean.HOST = "http://" + weblogbean.HOST
 		}
 
+		// gRPC：记下服务名/方法名，开启检测时解出首条消息
+		prepareGrpc(r, &weblogbean, hostTarget)
+		// GraphQL：解析操作名与复杂度，供规则、CC 和 GraphQL 防护使用
+		prepareGraphQL(r, &weblogbean, hostTarget)
+
 		// ── ACME(HTTP-01) 证书校验快速通道 ──
 		if waf.tryServeACMEChallenge(w, r, &weblogbean) {
 			return
@@ -536,6 +586,7 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		r.Header.Set("waf_req_uuid", weblogbean.REQ_UUID) // Set 替换，保证每请求恒为单值，避免入站累积
+		stripLoginRiskHeader(r, hostTarget)
 
 		if hostTarget.Host.GUARD_STATUS == 1 {
 			//自定义规则放行动作的结果：ruleSkipAll 跳过后续所有检测，ruleSkipModules 跳过指定检测
@@ -563,6 +614,36 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					weblogbean.RULE = "自定义规则放行:" + detectionResult.Title
 					return false
 				}
+				//挑战：没通过浏览器挑战的先出挑战页，已通过的继续走后续检测
+				if detectionResult.IsChallenge {
+					if hostTarget.Host.LogOnlyMode == 1 {
+						weblogbean.LogOnlyMode = 1
+						weblogbean.RULE = detectionResult.Title
+						return false
+					}
+					if waf.serveChallenge(w, r, &weblogbean, hostTarget, detectionResult.Title) {
+						decrementMonitor(hostCode)
+						return true
+					}
+					return false
+				}
+				//减速：延迟应答或限制响应带宽，不拦截，继续走后续检测
+				if detectionResult.SlowDelay > 0 || detectionResult.ThrottleKbps > 0 {
+					weblogbean.RULE = detectionResult.Title
+					if hostTarget.Host.LogOnlyMode == 1 {
+						weblogbean.LogOnlyMode = 1
+						return false
+					}
+					if detectionResult.ThrottleKbps > 0 {
+						w = newThrottledResponseWriter(w, r.Context(), detectionResult.ThrottleKbps)
+					}
+					if detectionResult.SlowDelay > 0 && !ccTarpit(r.Context(), detectionResult.SlowDelay) {
+						//延迟期间访客已断开，不必再回源
+						decrementMonitor(hostCode)
+						return true
+					}
+					return false
+				}
 				//自定义规则仅记录：记录命中信息，继续走后续检测
 				if detectionResult.IsLogOnly {
 					weblogbean.RULE = "自定义规则记录:" + detectionResult.Title
@@ -578,6 +659,9 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 						decrementMonitor(hostCode)
 						// 根据检测结果的标题推断攻击类型
 						attackType := inferAttackType(detectionResult.Title)
+						if detectionResult.RetryAfter > 0 {
+							w.Header().Set("Retry-After", strconv.Itoa(detectionResult.RetryAfter))
+						}
 						EchoErrorInfo(w, r, &weblogbean, detectionResult.Title, detectionResult.Content, hostTarget, waf.rt().HostTarget[waf.rt().HostCode[global.GWAF_GLOBAL_HOST_CODE]], true, attackType)
 						return true
 					}
@@ -585,6 +669,14 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return false
 			}
 			globalHostSafe := waf.rt().HostTarget[waf.rt().HostCode[global.GWAF_GLOBAL_HOST_CODE]]
+			hostDefense := model.ParseHostsDefense(hostTarget.Host.DEFENSE_JSON)
+
+			// 协议合规检测：请求走私、畸形头部、超长请求，白名单也不放过
+			if hostDefense.DEFENSE_PROTOCOL == 1 {
+				if handleBlock(waf.CheckProtocol) {
+					return
+				}
+			}
 
 			// 插件预检查（在所有检测之前）
 			if handleBlock(func(r *http.Request, weblogbean *innerbean.WebLog, formValues url.Values, hostTarget *wafenginmodel.HostSafe, globalHost *wafenginmodel.HostSafe) detection.Result {
@@ -617,8 +709,6 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
-				hostDefense := model.ParseHostsDefense(hostTarget.Host.DEFENSE_JSON)
-
 				//规则判断（规则优先编排：排在黑名单之后、其余检测之前，此时规则的放行动作才能跳过后面的检测）
 				ranRuleCheck := false
 				if global.GCONFIG_RULE_CHAIN_MODE == 1 {
@@ -634,6 +724,24 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 				}
+				//接口规范校验（站点上传了 OpenAPI 规范时生效）
+				if len(hostTarget.ApiSpecs) > 0 && !ruleSkip("APISPEC") {
+					if handleBlock(waf.CheckApiSpec) {
+						return
+					}
+				}
+				//GraphQL 防护（站点开启且请求的是配置的 GraphQL 路径时才有结果）
+				if weblogbean.GraphQLViolation != "" && !ruleSkip("GRAPHQL") {
+					if handleBlock(waf.CheckGraphQL) {
+						return
+					}
+				}
+				//gRPC 首条消息未能检测（站点配置了 fail-closed 时拦截）
+				if weblogbean.GRPC_SKIP != "" {
+					if handleBlock(waf.CheckGrpcSkip) {
+						return
+					}
+				}
 				//检测sqli
 				if hostDefense.DEFENSE_SQLI == 1 && !ruleSkip("SQLI") {
 					if handleBlock(waf.CheckSql) {
@@ -664,12 +772,24 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 				}
+				//检测SSRF
+				if hostDefense.DEFENSE_SSRF == 1 && !ruleSkip("SSRF") {
+					if handleBlock(waf.CheckSsrf) {
+						return
+					}
+				}
 				//检测CC
 				if !ruleSkip("CC") {
 					if handleBlock(waf.CheckCC) {
 						return
 					}
 				}
+				//登录接口防撞库
+				if !ruleSkip("LOGIN") {
+					if handleBlock(waf.CheckLoginProtect) {
+						return
+					}
+				}
 				//规则判断（默认编排：排在CC之后）
 				if !ranRuleCheck {
 					if handleBlock(waf.CheckRule) {
@@ -719,6 +839,12 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				// 验证码检测
 				captchaConfig := model.ParseCaptchaConfig(hostTarget.Host.CaptchaJSON)
 
+				if captchaConfig.IsEnableCaptcha != 1 && isJsChallengeVerifyPath(r.URL.Path, captchaConfig) {
+					// 站点没开验证码时，规则/CC 的挑战动作用的是 JS 挑战，提交答案的请求在这里接住
+					challengeConfig, challengePathPrefix := challengeCaptchaConfig(hostTarget)
+					waf.handleCaptchaRequest(w, r, &weblogbean, challengeConfig, challengePathPrefix, hostTarget.Host.IPMode)
+					return
+				}
 				if captchaConfig.IsEnableCaptcha == 1 && !ruleSkip("CAPTCHA") {
 					if !waf.checkCaptchaToken(r, weblogbean, captchaConfig, hostTarget.Host.IPMode) {
 						// 检查当前URL是否在排除列表中
@@ -781,7 +907,10 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 
-				w.Header().Add("X-Cache", "HIT")
+				// 过期内容(STALE)已经带了自己的标记
+				if cacheResp.Header.Get("X-Cache") == "" {
+					w.Header().Add("X-Cache", "HIT")
+				}
 				w.WriteHeader(cacheResp.StatusCode)
 				// 读取并写入响应体
 				if cacheResp.Body != nil {
@@ -795,8 +924,11 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 				// 设置响应并返回
 				r.Response = cacheResp
+				waf.refreshCacheInBackground(r, host, hostCode, clientIP, &weblogbean, hostTarget)
 				return
 			}
+			// 本请求成为同键回源者时，不论后面是被拦截还是回源失败都要放行等待的请求
+			defer wafwebcache.ReleaseFlight(&weblogbean)
 		}
 		// 如果开启了静态站点服务且请求路径匹配前缀
 		if staticSiteConfig.IsEnableStaticSite == 1 {
@@ -842,44 +974,7 @@ func (waf *WafEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if global.GCONFIG_RECORD_LOG_DESENSITIZE == 1 && weblogbean.BODY != "" {
 			weblogbean.BODY = utils.DeSenTextByCustomMark(enums.DLP_MARK_RULE_LoginSensitiveInfoMaskRule, weblogbean.BODY)
 		}
-		remoteUrl, err := url.Parse(hostTarget.TargetHost)
-		if err != nil {
-			zlog.Debug("target parse fail:", zap.Any("", err))
-			return
-		}
-
-		// 记录前置校验耗时
-		weblogbean.PreCheckCost = time.Now().UnixNano()/1e6 - weblogbean.UNIX_ADD_TIME
-
-		// 在请求上下文中存储自定义数据
-		ctx := context.WithValue(r.Context(), "waf_context", innerbean.WafHttpContextData{
-			Weblog:   &weblogbean,
-			HostCode: hostCode,
-		})
-
-		// 路径规则匹配（类 nginx location）
-		if len(hostTarget.PathRules) > 0 {
-			if pathRule := MatchPathRule(hostTarget.PathRules, r.URL.Path); pathRule != nil {
-				switch pathRule.TargetType {
-				case 2: // 静态文件
-					waf.ServeStaticFiles(w, r, pathRule, &weblogbean, hostTarget)
-					return
-				case 3: // 重定向
-					code := pathRule.RedirectCode
-					if code != 301 && code != 302 {
-						code = 302
-					}
-					http.Redirect(w, r, pathRule.RedirectURL, code)
-					return
-				default: // case 1: 后端代理
-					waf.ProxyHTTPWithPathRule(w, r, host, pathRule, clientIP, ctx, &weblogbean, hostTarget)
-					return
-				}
-			}
-		}
-
-		// 代理请求
-		waf.ProxyHTTP(w, r, host, remoteUrl, clientIP, ctx, &weblogbean, hostTarget)
+		waf.forwardToBackend(w, r, host, hostCode, clientIP, &weblogbean, hostTarget)
 
 		return
 	} else {
@@ -1023,6 +1118,53 @@ func classifyProxyError(err error, ctxErr error) (category string, statusCode in
 	return "backend_error", 503, "Service Unavailable", false
 }
 
+// forwardToBackend 按路径规则或默认后端转发请求；缓存后台刷新也走这里
+func (waf *WafEngine) forwardToBackend(w http.ResponseWriter, r *http.Request, host string, hostCode string, clientIP string, weblog *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	remoteUrl, err := url.Parse(hostTarget.TargetHost)
+	if err != nil {
+		zlog.Debug("target parse fail:", zap.Any("", err))
+		return
+	}
+
+	// 记录前置校验耗时
+	weblog.PreCheckCost = time.Now().UnixNano()/1e6 - weblog.UNIX_ADD_TIME
+
+	// 在请求上下文中存储自定义数据
+	ctx := context.WithValue(r.Context(), "waf_context", innerbean.WafHttpContextData{
+		Weblog:   weblog,
+		HostCode: hostCode,
+	})
+
+	// gRPC-Web 转 gRPC（含跨域预检应答）
+	if translateGrpcWeb(w, r, weblog, hostTarget) {
+		return
+	}
+
+	// 路径规则匹配（类 nginx location）
+	if len(hostTarget.PathRules) > 0 {
+		if pathRule := MatchPathRule(hostTarget.PathRules, r.URL.Path); pathRule != nil {
+			switch pathRule.TargetType {
+			case 2: // 静态文件
+				waf.ServeStaticFiles(w, r, pathRule, weblog, hostTarget)
+				return
+			case 3: // 重定向
+				code := pathRule.RedirectCode
+				if code != 301 && code != 302 {
+					code = 302
+				}
+				http.Redirect(w, r, pathRule.RedirectURL, code)
+				return
+			default: // case 1: 后端代理
+				waf.ProxyHTTPWithPathRule(w, r, host, pathRule, clientIP, ctx, weblog, hostTarget)
+				return
+			}
+		}
+	}
+
+	// 代理请求
+	waf.ProxyHTTP(w, r, host, remoteUrl, clientIP, ctx, weblog, hostTarget)
+}
+
 func (waf *WafEngine) errorResponse() func(http.ResponseWriter, *http.Request, error) {
 	return func(w http.ResponseWriter, req *http.Request, err error) {
 
@@ -1066,7 +1208,25 @@ func (waf *WafEngine) errorResponse() func(http.ResponseWriter, *http.Request, e
 				)
 			}
 
+			// stale-if-error：回源失败但缓存里还有可用的旧内容
+			if !isClient {
+				if staleResp := wafwebcache.StaleResponseOnError(weblogReq); staleResp != nil {
+					waf.writeStaleResponse(w, req, staleResp, weblogReq, err)
+					return
+				}
+			}
+
 			resBytes := []byte("<html><head><title>服务不可用</title></head><body><center><h1>服务不可用</h1> <br><h3></h3></center></body> </html>")
+			// gRPC 客户端：按 UNAVAILABLE 回 Trailers-Only 响应，HTML 它读不懂
+			if weblogReq.GrpcContentType != "" {
+				hostTarget := waf.rt().HostTarget[waf.rt().HostCode[wafHttpContext.HostCode]]
+				w.Header().Set("Content-Type", grpcResponseContentType(weblogReq.GrpcContentType))
+				w.Header().Set("Grpc-Status", "14")
+				w.Header().Set("Grpc-Message", grpcEncodeMessage(statusText))
+				setGrpcWebCORS(w.Header(), req.Header.Get("Origin"), hostTarget)
+				statusCode = http.StatusOK
+				resBytes = nil
+			}
 
 			//记录响应Header信息
 			resHeader := ""
@@ -1084,7 +1244,7 @@ func (waf *WafEngine) errorResponse() func(http.ResponseWriter, *http.Request, e
 			weblogReq.STATUS_CODE = statusCode
 			weblogReq.RES_BODY = fmt.Sprintf("类型:%s \r\n请求相关信息:%v \r\n 错误信息:%v \r\n ctxErr:%v \r\n", category, requestInfo, err.Error(), ctxErr)
 			weblogReq.TASK_FLAG = 1
-			if global.GQEQUE_LOG_DB != nil {
+			if global.GQEQUE_LOG_DB != nil && !weblogReq.CacheBackground {
 				global.GQEQUE_LOG_DB.Enqueue(weblogReq)
 			}
 
@@ -1165,8 +1325,8 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 				weblogfrist.TimeSpent = datetimeNow.UnixNano()/1e6 - weblogfrist.UNIX_ADD_TIME
 				weblogfrist.TASK_FLAG = 1
 
-				// 记录日志
-				if shouldRecordWebLog(weblogfrist, waf.rt().HostTarget[host].Host.EXCLUDE_URL_LOG) {
+				// 记录日志（开启了 WebSocket 消息检测的连接在结束时连同会话摘要一起记录）
+				if !weblogfrist.WsInspect && shouldRecordWebLog(weblogfrist, waf.rt().HostTarget[host].Host.EXCLUDE_URL_LOG) {
 					global.GQEQUE_LOG_DB.Enqueue(weblogfrist)
 				}
 			}
@@ -1181,6 +1341,12 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 
 			host := waf.rt().HostCode[wafHttpContext.HostCode]
 
+			// 登录接口防护：按源站响应判定登录成败并计数（放在响应缓冲开关之前，关闭缓冲也要计数）
+			waf.recordLoginResult(resp, weblogfrist, waf.rt().HostTarget[host])
+
+			// 爬虫策略：顺带缓存源站返回的 robots.txt，供按 robots 规则限制爬虫
+			captureRobots(r, resp, waf.rt().HostTarget[host], waf.rt().HostTarget[waf.rt().HostCode[global.GWAF_GLOBAL_HOST_CODE]])
+
 			// 记录后端真实返回的状态码
 			backendStatusCode := resp.StatusCode
 			backendStatus := resp.Status
@@ -1191,6 +1357,40 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 			// 上游 chunked 传输时 resp.ContentLength 为 -1，先按 0 计；非静态资源后续会用真实落盘字节数回填
 			weblogfrist.RES_CONTENT_LENGTH = sanitizeContentLength(resp.ContentLength)
 
+			// gRPC 响应是流，结果(grpc-status)在报文结束的 trailer 里，不能整包缓冲改写；gRPC-Web 转换过的再转回去
+			if weblogfrist.GrpcContentType != "" {
+				hostTarget := waf.rt().HostTarget[host]
+				translateGrpcResponse(resp, weblogfrist, hostTarget)
+				weblogfrist.TASK_FLAG = 1
+				weblogfrist.ResHeader = joinHeader(resp.Header)
+				datetimeNow := time.Now()
+				weblogfrist.TimeSpent = datetimeNow.UnixNano()/1e6 - weblogfrist.UNIX_ADD_TIME
+				weblogfrist.BackendCheckCost = datetimeNow.UnixNano()/1e6 - backendCheckStart
+				if hostTarget != nil && shouldRecordWebLog(weblogfrist, hostTarget.Host.EXCLUDE_URL_LOG) {
+					global.GQEQUE_LOG_DB.Enqueue(weblogfrist)
+				}
+				return nil
+			}
+
+			// 开放重定向：只看响应头，放在响应缓冲开关之前，关闭缓冲也生效
+			if hostTarget, exists := waf.rt().HostTarget[host]; exists && model.ParseHostsDefense(hostTarget.Host.DEFENSE_JSON).DEFENSE_OPEN_REDIRECT == 1 {
+				if title := checkOpenRedirect(resp, weblogfrist, hostTarget); title != "" {
+					weblogfrist.RISK_LEVEL = 2
+					if hostTarget.Host.LogOnlyMode == 1 {
+						weblogfrist.LogOnlyMode = 1
+						weblogfrist.RULE = title
+					} else {
+						if resp.Body != nil {
+							resp.Body.Close()
+						}
+						resp.Header.Del("Location")
+						EchoResponseErrorInfo(resp, weblogfrist, title, "跳转地址不在允许范围内", hostTarget, waf.rt().HostTarget[waf.rt().HostCode[global.GWAF_GLOBAL_HOST_CODE]], true, "open_redirect")
+						weblogfrist.BackendCheckCost = time.Now().UnixNano()/1e6 - backendCheckStart
+						return nil
+					}
+				}
+			}
+
 			// 响应缓冲关闭（IsEnableResponseBuffering==0，类似 nginx proxy_buffering off）：不读响应体，避免整包缓冲，配合 FlushInterval=-1 边收边推。
 			// 因此关闭缓冲时，依赖读体的能力（敏感词/响应压缩/防篡改/响应缓存等）对本请求不生效。
 			// ACME 证书校验路径除外，避免签发/续期被短路干扰（与缓存等逻辑一致）。
@@ -1230,6 +1430,16 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 
 			compressCfg := model.ParseResponseCompressConfig(waf.rt().HostTarget[host].Host.ResponseCompressJSON)
 
+			//隐私保护：整页脱敏的旧规则只处理响应体；字段级脱敏策略还会处理响应头，不依赖响应体
+			ldpFlag, maskPolicies, ldpExempted := waf.matchLdpPolicies(host, resp.Request.RequestURI, waf.ldpClientIP(host, weblogfrist), weblogfrist.AccessUser)
+			if len(maskPolicies) > 0 {
+				hits := ldpmask.Hits{}
+				for _, policy := range maskPolicies {
+					policy.MaskHeaders(resp.Header, hits)
+				}
+				recordMaskHits(weblogfrist, hits)
+			}
+
 			//记录响应body
 			if !isStaticAssist && resp.Body != nil && resp.Body != http.NoBody {
 
@@ -1261,38 +1471,6 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 					return nil
 				}
 
-				ldpFlag := false
-				// 将请求URL转为小写，用于不区分大小写的比较
-				lowerRequestURI := strings.ToLower(resp.Request.RequestURI)
-
-				//隐私保护（局部）
-				for i := 0; i < len(waf.rt().HostTarget[host].LdpUrlLists); i++ {
-					// 将规则URL也转为小写
-					lowerRuleURL := strings.ToLower(waf.rt().HostTarget[host].LdpUrlLists[i].Url)
-
-					if (waf.rt().HostTarget[host].LdpUrlLists[i].CompareType == "等于" && lowerRuleURL == lowerRequestURI) ||
-						(waf.rt().HostTarget[host].LdpUrlLists[i].CompareType == "前缀匹配" && strings.HasPrefix(lowerRequestURI, lowerRuleURL)) ||
-						(waf.rt().HostTarget[host].LdpUrlLists[i].CompareType == "后缀匹配" && strings.HasSuffix(lowerRequestURI, lowerRuleURL)) ||
-						(waf.rt().HostTarget[host].LdpUrlLists[i].CompareType == "包含匹配" && strings.Contains(lowerRequestURI, lowerRuleURL)) {
-
-						ldpFlag = true
-						break
-					}
-				}
-				//隐私保护（全局）
-				for i := 0; i < len(waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists); i++ {
-					// 将全局规则URL也转为小写
-					lowerGlobalRuleURL := strings.ToLower(waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists[i].Url)
-
-					if (waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists[i].CompareType == "等于" && lowerGlobalRuleURL == lowerRequestURI) ||
-						(waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists[i].CompareType == "前缀匹配" && strings.HasPrefix(lowerRequestURI, lowerGlobalRuleURL)) ||
-						(waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists[i].CompareType == "后缀匹配" && strings.HasSuffix(lowerRequestURI, lowerGlobalRuleURL)) ||
-						(waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME].LdpUrlLists[i].CompareType == "包含匹配" && strings.Contains(lowerRequestURI, lowerGlobalRuleURL)) {
-
-						ldpFlag = true
-						break
-					}
-				}
 				if ldpFlag == true {
 					orgContentBytes, charsetName, responseEncodingError := waf.getOrgContent(resp, isStaticAssist, waf.rt().HostTarget[host].Host.DefaultEncoding)
 					if responseEncodingError == nil {
@@ -1313,6 +1491,14 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 				//编码转换，自动检测网页编码   resp *http.Response
 				orgContentBytes, charsetName, responseEncodingError := waf.getOrgContent(resp, isStaticAssist, waf.rt().HostTarget[host].Host.DefaultEncoding)
 				if responseEncodingError == nil {
+					//字段级脱敏放在记录响应日志之前，日志里保存的也是脱敏后的内容
+					if len(maskPolicies) > 0 {
+						hits := ldpmask.Hits{}
+						for _, policy := range maskPolicies {
+							orgContentBytes = policy.MaskBody(orgContentBytes, hits)
+						}
+						recordMaskHits(weblogfrist, hits)
+					}
 					if global.GCONFIG_RECORD_RESP == 1 {
 						if resp.ContentLength < global.GCONFIG_RECORD_MAX_RES_BODY_LENGTH {
 							weblogfrist.RES_BODY = string(orgContentBytes)
@@ -1380,7 +1566,8 @@ func (waf *WafEngine) modifyResponse() func(*http.Response) error {
 			if err != nil {
 				zlog.Debug("解析cache json失败")
 			}
-			if cacheConfig.IsEnableCache == 1 && !strings.HasPrefix(weblogfrist.URL, global.GSSL_HTTP_CHANGLE_PATH) {
+			//豁免访客拿到的是未脱敏的原文，缓存命中时不会再走脱敏，不能存
+			if cacheConfig.IsEnableCache == 1 && !ldpExempted && !strings.HasPrefix(weblogfrist.URL, global.GSSL_HTTP_CHANGLE_PATH) {
 				wafwebcache.StoreWebDataCache(resp, waf.rt().HostTarget[host], cacheConfig, weblogfrist)
 			}
 
@@ -1507,6 +1694,9 @@ func (waf *WafEngine) StartWaf() {
 	}
 	global.GQEQUE_LOG_DB.Enqueue(&wafSysLog)
 
+	waf.ReLoadSpiderBot()
+	waf.ReLoadYara()
+	waf.ReLoadGrpcDescriptors()
 	waf.StartAllProxyServer()
 }
 
@@ -1814,6 +2004,7 @@ func (waf *WafEngine) StartProxyServer(innruntime innerbean.ServerRunTime) {
 			serclone, _ := waf.ServerOnline.Get(innruntime.Port)
 			serclone.Svr = svr
 			serclone.Conns = attachConnCounter(svr)
+			wafprotocol.Attach(svr)
 			serclone.Status = 0
 
 			waf.ServerOnline.Set(innruntime.Port, serclone)
@@ -1828,6 +2019,8 @@ func (waf *WafEngine) StartProxyServer(innruntime innerbean.ServerRunTime) {
 				ln = &proxyproto.Listener{Listener: ln}
 
 			}
+			// 截取原始请求头，供协议合规检测发现 net/http 解析时抹掉的走私痕迹
+			ln = wafprotocol.Listen(ln)
 			err = svr.Serve(ln)
 			if err == http.ErrServerClosed {
 				zlog.Warn("[HTTPServer] http server has been close, cause:[%v]", err)
@@ -1976,11 +2169,16 @@ func (waf *WafEngine) ClearCcWindows() {
 		if hostSafe.PluginIpRateLimiter != nil {
 			hostSafe.PluginIpRateLimiter.CleanupOldRecords()
 		}
+		for _, keyed := range hostSafe.CCKeyedLimiters {
+			keyed.Limiter.CleanupOldRecords()
+		}
 	}
 }
 
 // ClearCcWindowsForIP 清理特定IP的CC限流记录
 func (waf *WafEngine) ClearCcWindowsForIP(ip string) {
+	// 手动解封后逐级处置也回到第一级，否则再次超限会直接封禁
+	clearCCEscalation(ip)
 	// 遍历所有主机，清理指定IP的限流记录
 	hostCount := 0
 	for hostKey, hostSafe := range waf.rt().HostTarget {
@@ -2032,16 +2230,7 @@ func (waf *WafEngine) ApplyAntiCCConfig(hostCode string, antiCC model.AntiCC) {
 		}
 
 		// 与初始化逻辑保持一致：支持滑动窗口/平均速率
-		if antiCC.LimitMode == "window" {
-			hostSafe.PluginIpRateLimiter = webplugin.NewWindowIPRateLimiter(antiCC.Rate, antiCC.Limit)
-		} else {
-			hostSafe.PluginIpRateLimiter = webplugin.NewIPRateLimiter(rate.Limit(antiCC.Rate), antiCC.Limit)
-		}
-		if antiCC.IsEnableRule {
-			hostSafe.PluginIpRateLimiter.Rule = &utils.RuleHelper{}
-			hostSafe.PluginIpRateLimiter.Rule.InitRuleEngine()
-			hostSafe.PluginIpRateLimiter.Rule.LoadRuleString(antiCC.RuleContent)
-		}
+		hostSafe.PluginIpRateLimiter = newCCRateLimiter(antiCC)
 		hostSafe.AntiCCBean = antiCC
 
 		zlog.Debug("远程配置", zap.Any("Anticc", antiCC))
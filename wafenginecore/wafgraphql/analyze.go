@@ -0,0 +1,189 @@
+package wafgraphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// costCap 复杂度累计上限，防止乘数叠乘溢出；超过它的查询一律按超预算处理
+const costCap = 1 << 40
+
+// paginationArgs 视为列表长度的分页参数，其下子查询的复杂度按它放大
+var paginationArgs = []string{"first", "last", "limit", "pageSize", "page_size", "perPage", "per_page", "take", "top"}
+
+// Metrics 一个操作的统计结果
+type Metrics struct {
+	Depth         int
+	Aliases       int
+	Cost          int64
+	Introspection bool //用到了 __schema / __type
+}
+
+type fragMetrics struct {
+	Metrics
+	busy bool
+	done bool
+}
+
+type analyzer struct {
+	doc       *Document
+	variables map[string]interface{}
+	frags     map[string]*fragMetrics
+}
+
+// Analyze 统计要执行的操作：指定了 operationName 时只算该操作，否则算全部操作(取最大深度，别名与复杂度累加)。
+// 片段展开按引用次数计入，每个片段只遍历一次；片段循环引用、引用未定义片段、找不到操作时报错
+func Analyze(doc *Document, operationName string, variables map[string]interface{}) (Metrics, []*Operation, error) {
+	ops := doc.Operations
+	if operationName != "" {
+		ops = nil
+		for _, op := range doc.Operations {
+			if op.Name == operationName {
+				ops = append(ops, op)
+			}
+		}
+		if len(ops) == 0 {
+			return Metrics{}, nil, fmt.Errorf("文档里没有名为 %s 的操作", operationName)
+		}
+	}
+	a := &analyzer{doc: doc, variables: variables, frags: map[string]*fragMetrics{}}
+	var total Metrics
+	for _, op := range ops {
+		m, err := a.selections(op.Selections)
+		if err != nil {
+			return Metrics{}, nil, err
+		}
+		total = total.merge(m)
+	}
+	return total, ops, nil
+}
+
+// merge 同层并列的两部分合并：深度取大，其余累加
+func (m Metrics) merge(o Metrics) Metrics {
+	if o.Depth > m.Depth {
+		m.Depth = o.Depth
+	}
+	m.Aliases = int(capCost(int64(m.Aliases) + int64(o.Aliases)))
+	m.Cost = capCost(m.Cost + o.Cost)
+	m.Introspection = m.Introspection || o.Introspection
+	return m
+}
+
+func capCost(c int64) int64 {
+	if c > costCap || c < 0 {
+		return costCap
+	}
+	return c
+}
+
+func mulCost(n, c int64) int64 {
+	if c > 0 && n > costCap/c {
+		return costCap
+	}
+	return n * c
+}
+
+func (a *analyzer) selections(sels []*Selection) (Metrics, error) {
+	var total Metrics
+	for _, sel := range sels {
+		var m Metrics
+		var err error
+		switch {
+		case sel.Spread != "":
+			m, err = a.fragment(sel.Spread)
+		case sel.Name == "":
+			m, err = a.selections(sel.Selections)
+		default:
+			m, err = a.field(sel)
+		}
+		if err != nil {
+			return Metrics{}, err
+		}
+		total = total.merge(m)
+	}
+	return total, nil
+}
+
+func (a *analyzer) field(sel *Selection) (Metrics, error) {
+	children, err := a.selections(sel.Selections)
+	if err != nil {
+		return Metrics{}, err
+	}
+	m := Metrics{
+		Depth:         children.Depth + 1,
+		Aliases:       children.Aliases,
+		Cost:          capCost(1 + mulCost(a.multiplier(sel), children.Cost)),
+		Introspection: children.Introspection || sel.Name == "__schema" || sel.Name == "__type",
+	}
+	if sel.Alias != "" && sel.Alias != sel.Name {
+		m.Aliases++
+	}
+	return m, nil
+}
+
+func (a *analyzer) fragment(name string) (Metrics, error) {
+	f := a.frags[name]
+	if f == nil {
+		f = &fragMetrics{}
+		a.frags[name] = f
+	}
+	if f.done {
+		return f.Metrics, nil
+	}
+	if f.busy {
+		return Metrics{}, fmt.Errorf("片段 %s 循环引用", name)
+	}
+	frag, ok := a.doc.Fragments[name]
+	if !ok {
+		return Metrics{}, fmt.Errorf("片段 %s 未定义", name)
+	}
+	f.busy = true
+	m, err := a.selections(frag.Selections)
+	if err != nil {
+		return Metrics{}, err
+	}
+	f.Metrics, f.done, f.busy = m, true, false
+	return m, nil
+}
+
+// multiplier 分页参数给出的列表长度，取不到(没带、不是整数)时为 1
+func (a *analyzer) multiplier(sel *Selection) int64 {
+	if len(sel.Selections) == 0 {
+		return 1
+	}
+	for _, name := range paginationArgs {
+		v, ok := sel.Args[name]
+		if !ok {
+			continue
+		}
+		n, ok := a.intValue(v)
+		if ok && n > 1 {
+			if n > costCap {
+				return costCap
+			}
+			return n
+		}
+	}
+	return 1
+}
+
+func (a *analyzer) intValue(v Value) (int64, bool) {
+	if v.IsInt {
+		return v.Int, true
+	}
+	if v.Variable == "" {
+		return 0, false
+	}
+	switch x := a.variables[v.Variable].(type) {
+	case json.Number:
+		n, err := strconv.ParseInt(string(x), 10, 64)
+		return n, err == nil
+	case float64:
+		return int64(x), true
+	case string:
+		n, err := strconv.ParseInt(x, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,541 @@
+// Package wafgraphql 解析 GraphQL 请求并按站点配置做资源限制：查询深度、别名数、批量条数、复杂度预算、
+// 禁止自省，以及持久化查询白名单。
+//
+// 只解析可执行文档(查询/变更/订阅与片段)，不需要 schema：复杂度按字段数估算，
+// 分页参数(first/last/limit…)按乘数放大其下的子查询。
+package wafgraphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 解析器自身的防护：超过这些上限直接按无法解析处理，避免一个请求把 WAF 拖慢
+const (
+	maxTokens       = 20000
+	maxParseNesting = 128
+)
+
+// Document 解析后的可执行文档
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation 一个操作
+type Operation struct {
+	Type       string //query/mutation/subscription
+	Name       string
+	Selections []*Selection
+}
+
+// Fragment 具名片段
+type Fragment struct {
+	Name       string
+	Selections []*Selection
+}
+
+// Selection 选择集中的一项：字段、片段展开或内联片段
+type Selection struct {
+	Spread     string //片段展开的片段名；非空时其余字段无意义
+	Alias      string
+	Name       string //字段名；内联片段为空
+	Args       map[string]Value
+	Selections []*Selection
+}
+
+// Value 参数值，复杂度估算只关心整数和变量
+type Value struct {
+	Int      int64
+	IsInt    bool
+	Variable string
+}
+
+type token struct {
+	kind  byte //'n' 名称 'i' 整数 'f' 浮点 's' 字符串 'p' 标点 'v' 变量($name) 0 结束
+	value string
+	pos   int
+}
+
+// lex 按 GraphQL 规范切词：逗号、空白、注释忽略
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	if strings.HasPrefix(src, "\uFEFF") {
+		i = len("\uFEFF")
+	}
+	for i < len(src) {
+		if len(toks) > maxTokens {
+			return nil, fmt.Errorf("查询过长(超过 %d 个词)", maxTokens)
+		}
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, token{kind: 'p', value: "...", pos: i})
+			i += 3
+		case strings.IndexByte("!&():=@[]{}|", c) >= 0:
+			toks = append(toks, token{kind: 'p', value: string(c), pos: i})
+			i++
+		case c == '$':
+			j := i + 1
+			for j < len(src) && isNameChar(src[j], j == i+1) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("位置 %d: $ 后缺少变量名", i)
+			}
+			toks = append(toks, token{kind: 'v', value: src[i+1 : j], pos: i})
+			i = j
+		case isNameChar(c, true):
+			j := i
+			for j < len(src) && isNameChar(src[j], j == i) {
+				j++
+			}
+			toks = append(toks, token{kind: 'n', value: src[i:j], pos: i})
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j, isFloat := scanNumber(src, i)
+			if j == i {
+				return nil, fmt.Errorf("位置 %d: 非法数字", i)
+			}
+			kind := byte('i')
+			if isFloat {
+				kind = 'f'
+			}
+			toks = append(toks, token{kind: kind, value: src[i:j], pos: i})
+			i = j
+		case c == '"':
+			j, err := scanString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: 's', pos: i})
+			i = j
+		default:
+			return nil, fmt.Errorf("位置 %d: 非法字符 %q", i, c)
+		}
+	}
+	return append(toks, token{pos: len(src)}), nil
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+func scanNumber(src string, i int) (int, bool) {
+	j := i
+	if j < len(src) && src[j] == '-' {
+		j++
+	}
+	digits := func() int {
+		start := j
+		for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+			j++
+		}
+		return j - start
+	}
+	if digits() == 0 {
+		return i, false
+	}
+	isFloat := false
+	if j < len(src) && src[j] == '.' {
+		j++
+		if digits() == 0 {
+			return i, false
+		}
+		isFloat = true
+	}
+	if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+		j++
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if digits() == 0 {
+			return i, false
+		}
+		isFloat = true
+	}
+	return j, isFloat
+}
+
+// scanString 跳过字符串(含 """块字符串""")，内容不参与限制判断
+func scanString(src string, i int) (int, error) {
+	if strings.HasPrefix(src[i:], `"""`) {
+		for j := i + 3; j < len(src); j++ {
+			if strings.HasPrefix(src[j:], `\"""`) {
+				j += 3
+				continue
+			}
+			if strings.HasPrefix(src[j:], `"""`) {
+				return j + 3, nil
+			}
+		}
+		return 0, fmt.Errorf("位置 %d: 块字符串未结束", i)
+	}
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		case '\n', '\r':
+			return 0, fmt.Errorf("位置 %d: 字符串未结束", i)
+		}
+	}
+	return 0, fmt.Errorf("位置 %d: 字符串未结束", i)
+}
+
+type parser struct {
+	toks    []token
+	i       int
+	nesting int
+}
+
+// Parse 解析查询文本。文档里出现类型定义(SDL)等非可执行内容时报错
+func Parse(query string) (*Document, error) {
+	toks, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	for p.peek().kind != 0 {
+		t := p.peek()
+		switch {
+		case t.kind == 'p' && t.value == "{":
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: sels})
+		case t.kind == 'n' && (t.value == "query" || t.value == "mutation" || t.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case t.kind == 'n' && t.value == "fragment":
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.Fragments[frag.Name]; dup {
+				return nil, fmt.Errorf("片段 %s 重复定义", frag.Name)
+			}
+			doc.Fragments[frag.Name] = frag
+		default:
+			return nil, p.errorf("应为查询、变更、订阅或片段定义")
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("文档里没有任何操作")
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != 0 {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("位置 %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isPunct(v string) bool {
+	t := p.peek()
+	return t.kind == 'p' && t.value == v
+}
+
+func (p *parser) expect(v string) error {
+	if !p.isPunct(v) {
+		return p.errorf("应为 %s", v)
+	}
+	p.i++
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.kind != 'n' {
+		return "", p.errorf("应为名称")
+	}
+	p.i++
+	return t.value, nil
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.next().value}
+	if p.peek().kind == 'n' {
+		op.Name = p.next().value
+	}
+	if p.isPunct("(") {
+		if err := p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = sels
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() error {
+	p.next()
+	for !p.isPunct(")") {
+		if p.peek().kind != 'v' {
+			return p.errorf("应为变量定义")
+		}
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.typeRef(0); err != nil {
+			return err
+		}
+		if p.isPunct("=") {
+			p.next()
+			if _, err := p.value(true); err != nil {
+				return err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) typeRef(depth int) error {
+	if depth > maxParseNesting {
+		return p.errorf("类型嵌套过深")
+	}
+	if p.isPunct("[") {
+		p.next()
+		if err := p.typeRef(depth + 1); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.isPunct("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	p.next()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.errorf("片段名不能是 on")
+	}
+	if t := p.next(); t.kind != 'n' || t.value != "on" {
+		return nil, p.errorf("片段定义缺少 on 类型条件")
+	}
+	if _, err := p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &Fragment{Name: name, Selections: sels}, nil
+}
+
+func (p *parser) directives() error {
+	for p.isPunct("@") {
+		p.next()
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if p.isPunct("(") {
+			if _, err := p.arguments(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) selectionSet() ([]*Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+	if p.nesting > maxParseNesting {
+		return nil, p.errorf("选择集嵌套过深")
+	}
+	var sels []*Selection
+	for !p.isPunct("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	p.next()
+	if len(sels) == 0 {
+		return nil, p.errorf("选择集不能为空")
+	}
+	return sels, nil
+}
+
+func (p *parser) selection() (*Selection, error) {
+	if p.isPunct("...") {
+		p.next()
+		if t := p.peek(); t.kind == 'n' && t.value != "on" {
+			p.next()
+			return &Selection{Spread: t.value}, p.directives()
+		}
+		if t := p.peek(); t.kind == 'n' && t.value == "on" {
+			p.next()
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return nil, err
+		}
+		sels, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		return &Selection{Selections: sels}, nil
+	}
+	sel := &Selection{}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		p.next()
+		sel.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	sel.Name = name
+	if p.isPunct("(") {
+		if sel.Args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if sel.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) arguments() (map[string]Value, error) {
+	p.next()
+	args := map[string]Value{}
+	for !p.isPunct(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+	p.next()
+	if len(args) == 0 {
+		return nil, p.errorf("参数列表不能为空")
+	}
+	return args, nil
+}
+
+// value 解析参数值；const 为 true 时(变量默认值)不允许出现变量
+func (p *parser) value(isConst bool) (Value, error) {
+	p.nesting++
+	defer func() { p.nesting-- }()
+	if p.nesting > maxParseNesting {
+		return Value{}, p.errorf("参数值嵌套过深")
+	}
+	t := p.next()
+	switch t.kind {
+	case 'v':
+		if isConst {
+			return Value{}, p.errorf("默认值里不能引用变量")
+		}
+		return Value{Variable: t.value}, nil
+	case 'i':
+		var n int64
+		if _, err := fmt.Sscan(t.value, &n); err != nil {
+			return Value{}, nil
+		}
+		return Value{Int: n, IsInt: true}, nil
+	case 'f', 's', 'n':
+		return Value{}, nil
+	case 'p':
+		switch t.value {
+		case "[":
+			for !p.isPunct("]") {
+				if p.peek().kind == 0 {
+					return Value{}, p.errorf("列表未结束")
+				}
+				if _, err := p.value(isConst); err != nil {
+					return Value{}, err
+				}
+			}
+			p.next()
+			return Value{}, nil
+		case "{":
+			for !p.isPunct("}") {
+				if _, err := p.name(); err != nil {
+					return Value{}, err
+				}
+				if err := p.expect(":"); err != nil {
+					return Value{}, err
+				}
+				if _, err := p.value(isConst); err != nil {
+					return Value{}, err
+				}
+			}
+			p.next()
+			return Value{}, nil
+		}
+	}
+	if t.kind != 0 {
+		p.i--
+	}
+	return Value{}, p.errorf("非法的参数值")
+}
@@ -0,0 +1,301 @@
+package wafgraphql
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Request 一次调用：批量请求里的每一项各是一个 Request
+type Request struct {
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+	Hash          string //持久化查询的 sha256(extensions.persistedQuery.sha256Hash 或 documentId)
+}
+
+type rawRequest struct {
+	Query         *string
+	OperationName *string
+	Variables     map[string]interface{}
+	DocumentId    string
+	Extensions    rawExtensions
+}
+
+type rawExtensions struct {
+	PersistedQuery rawPersistedQuery
+}
+
+type rawPersistedQuery struct {
+	Sha256Hash string
+}
+
+// 标准库按字段名解码时不区分大小写且后出现的覆盖先出现的，{"query":"...","QUERY":"{ok}"} 会让
+// 检查的文本和后端执行的不是同一份。这里只认大小写完全一致的字段名，大小写变体一律按解析失败处理
+
+func (raw *rawRequest) UnmarshalJSON(data []byte) error {
+	return decodeExactFields(data, map[string]interface{}{
+		"query":         &raw.Query,
+		"operationName": &raw.OperationName,
+		"variables":     &raw.Variables,
+		"documentId":    &raw.DocumentId,
+		"extensions":    &raw.Extensions,
+	})
+}
+
+func (ext *rawExtensions) UnmarshalJSON(data []byte) error {
+	return decodeExactFields(data, map[string]interface{}{
+		"persistedQuery": &ext.PersistedQuery,
+	})
+}
+
+func (pq *rawPersistedQuery) UnmarshalJSON(data []byte) error {
+	return decodeExactFields(data, map[string]interface{}{
+		"sha256Hash": &pq.Sha256Hash,
+	})
+}
+
+// caseVariantError 字段名与约定字段只有大小写不同
+type caseVariantError struct {
+	key, field string
+}
+
+func (e *caseVariantError) Error() string {
+	return fmt.Sprintf("字段 %s 与 %s 仅大小写不同", e.key, e.field)
+}
+
+// decodeExactFields 按字段名原样匹配解码 JSON 对象，不认识的字段忽略
+func decodeExactFields(data []byte, fields map[string]interface{}) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	for key, value := range obj {
+		if target, ok := fields[key]; ok {
+			if err := decodeJSON(value, target); err != nil {
+				return err
+			}
+			continue
+		}
+		for field := range fields {
+			if strings.EqualFold(key, field) {
+				return &caseVariantError{key: key, field: field}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonError 大小写变体的错误原样返回，便于看出绕过意图；其它解码错误用统一的提示
+func jsonError(err error, msg string) error {
+	var cv *caseVariantError
+	if errors.As(err, &cv) {
+		return cv
+	}
+	return errors.New(msg)
+}
+
+func (raw rawRequest) request() Request {
+	r := Request{Variables: raw.Variables, Hash: normalizeHash(raw.Extensions.PersistedQuery.Sha256Hash)}
+	if raw.Query != nil {
+		r.Query = *raw.Query
+	}
+	if raw.OperationName != nil {
+		r.OperationName = *raw.OperationName
+	}
+	if r.Hash == "" {
+		r.Hash = normalizeHash(raw.DocumentId)
+	}
+	return r
+}
+
+// ParseRequest 按 GraphQL over HTTP 的约定取出调用：GET 的查询参数、POST 的 JSON(单个对象或批量数组)、
+// application/graphql 请求体。返回的 batch 为 true 表示是批量数组
+func ParseRequest(method string, contentType string, query url.Values, body []byte) (reqs []Request, batch bool, err error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	body = bytes.TrimSpace(body)
+	switch {
+	case method == "GET" || len(body) == 0:
+		if query.Get("query") == "" && query.Get("extensions") == "" && query.Get("documentId") == "" {
+			return nil, false, nil
+		}
+		raw := rawRequest{DocumentId: query.Get("documentId")}
+		if q, ok := query["query"]; ok {
+			raw.Query = &q[0]
+		}
+		if name := query.Get("operationName"); name != "" {
+			raw.OperationName = &name
+		}
+		if v := query.Get("variables"); v != "" {
+			if err := decodeJSON([]byte(v), &raw.Variables); err != nil {
+				return nil, false, fmt.Errorf("variables 不是合法的 JSON")
+			}
+		}
+		if v := query.Get("extensions"); v != "" {
+			if err := decodeJSON([]byte(v), &raw.Extensions); err != nil {
+				return nil, false, jsonError(err, "extensions 不是合法的 JSON")
+			}
+		}
+		return []Request{raw.request()}, false, nil
+	case mediaType == "application/graphql":
+		return []Request{{Query: string(body), OperationName: query.Get("operationName")}}, false, nil
+	case body[0] == '[':
+		var list []rawRequest
+		if err := decodeJSON(body, &list); err != nil {
+			return nil, true, jsonError(err, "批量请求不是合法的 JSON")
+		}
+		for _, raw := range list {
+			reqs = append(reqs, raw.request())
+		}
+		return reqs, true, nil
+	default:
+		var raw rawRequest
+		if err := decodeJSON(body, &raw); err != nil {
+			return nil, false, jsonError(err, "请求体不是合法的 GraphQL JSON")
+		}
+		return []Request{raw.request()}, false, nil
+	}
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func normalizeHash(h string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(h), "sha256:"))
+}
+
+// Hash 查询文本的 sha256，与 Apollo 持久化查询(APQ)的算法一致
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Limits 检查上限，为 0 的项不检查
+type Limits struct {
+	MaxDepth             int
+	MaxAliases           int
+	MaxBatch             int
+	MaxCost              int64
+	DisableIntrospection bool
+	Allowlist            map[string]bool //非 nil 时只放行白名单里的查询(按 sha256)
+}
+
+// 违规类型，拦截标题用
+const (
+	ViolationParse         = "查询无法解析"
+	ViolationBatch         = "批量超限"
+	ViolationDepth         = "深度超限"
+	ViolationAliases       = "别名超限"
+	ViolationCost          = "复杂度超限"
+	ViolationIntrospection = "禁止自省"
+	ViolationNotAllowed    = "查询不在白名单"
+)
+
+// Result 检查结果
+type Result struct {
+	Operations []string //操作名(去重)，匿名操作不计
+	Depth      int
+	Aliases    int
+	Cost       int64 //批量请求为各项之和
+	Violation  string
+	Detail     string
+}
+
+// Inspect 逐项检查。只带哈希不带查询文本的持久化查询只能按白名单判定，无法统计深度与复杂度
+func Inspect(reqs []Request, limits Limits) Result {
+	res := Result{}
+	violate := func(kind string, format string, args ...interface{}) Result {
+		res.Violation = kind
+		res.Detail = fmt.Sprintf(format, args...)
+		return res
+	}
+	seen := map[string]bool{}
+	addName := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			res.Operations = append(res.Operations, name)
+		}
+	}
+	if limits.MaxBatch > 0 && len(reqs) > limits.MaxBatch {
+		return violate(ViolationBatch, "批量 %d 条，上限 %d", len(reqs), limits.MaxBatch)
+	}
+	for _, req := range reqs {
+		addName(req.OperationName)
+		if req.Query == "" {
+			if req.Hash == "" {
+				return violate(ViolationParse, "缺少查询文本")
+			}
+			if limits.Allowlist != nil && !limits.Allowlist[req.Hash] {
+				return violate(ViolationNotAllowed, "持久化查询 %s 不在白名单", req.Hash)
+			}
+			continue
+		}
+		hash := Hash(req.Query)
+		if req.Hash != "" && req.Hash != hash {
+			return violate(ViolationNotAllowed, "持久化查询的哈希与查询文本不符")
+		}
+		if limits.Allowlist != nil && !limits.Allowlist[hash] {
+			return violate(ViolationNotAllowed, "查询 %s 不在白名单", hash)
+		}
+		doc, err := Parse(req.Query)
+		if err != nil {
+			return violate(ViolationParse, "%s", err.Error())
+		}
+		m, ops, err := Analyze(doc, req.OperationName, req.Variables)
+		if err != nil {
+			return violate(ViolationParse, "%s", err.Error())
+		}
+		for _, op := range ops {
+			addName(op.Name)
+		}
+		if m.Depth > res.Depth {
+			res.Depth = m.Depth
+		}
+		if m.Aliases > res.Aliases {
+			res.Aliases = m.Aliases
+		}
+		res.Cost = capCost(res.Cost + m.Cost)
+		if limits.DisableIntrospection && m.Introspection {
+			return violate(ViolationIntrospection, "已禁止 __schema/__type 自省查询")
+		}
+		if limits.MaxDepth > 0 && m.Depth > limits.MaxDepth {
+			return violate(ViolationDepth, "查询深度 %d，上限 %d", m.Depth, limits.MaxDepth)
+		}
+		if limits.MaxAliases > 0 && m.Aliases > limits.MaxAliases {
+			return violate(ViolationAliases, "别名 %d 个，上限 %d", m.Aliases, limits.MaxAliases)
+		}
+	}
+	if limits.MaxCost > 0 && res.Cost > limits.MaxCost {
+		return violate(ViolationCost, "复杂度 %d，上限 %d", res.Cost, limits.MaxCost)
+	}
+	return res
+}
+
+var allowlistCache sync.Map
+
+// ParseAllowlist 解析白名单文本(sha256，逗号或空白分隔，可带 sha256: 前缀)。同一文本只解析一次
+func ParseAllowlist(text string) map[string]bool {
+	if v, ok := allowlistCache.Load(text); ok {
+		return v.(map[string]bool)
+	}
+	m := map[string]bool{}
+	for _, h := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		if h = normalizeHash(h); h != "" {
+			m[h] = true
+		}
+	}
+	allowlistCache.Store(text, m)
+	return m
+}
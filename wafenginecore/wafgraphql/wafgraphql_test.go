@@ -0,0 +1,216 @@
+package wafgraphql
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		`{ me { id } }`,
+		`query GetUser($id: ID!, $tags: [String!] = ["a"]) @cached(ttl: 60) {
+			user(id: $id, filter: {name: "x", age: 1.5e3, ok: true, v: null, e: ENUM}) { ...F @include(if: true) ... on Admin { level } }
+		}
+		fragment F on User { name(fmt: """block \"""quoted\""" "" string"""), # 注释
+		}`,
+		"\uFEFFmutation { a: like(id: -1) }",
+		`subscription OnMsg { msg { text } }`,
+	}
+	for _, q := range valid {
+		if _, err := Parse(q); err != nil {
+			t.Errorf("应能解析 %q: %v", q, err)
+		}
+	}
+	invalid := []string{
+		``,
+		`{ }`,
+		`{ a(x:) }`,
+		`{ a`,
+		`type Query { a: Int }`,
+		`fragment F on T { a } fragment F on T { b } { a }`,
+		`{ a(s: "unterminated) }`,
+		`query ($v: Int = $w) { a }`,
+		strings.Repeat("{a", 200) + strings.Repeat("}", 200),
+	}
+	for _, q := range invalid {
+		if _, err := Parse(q); err == nil {
+			t.Errorf("%q 不应解析成功", q)
+		}
+	}
+}
+
+func analyze(t *testing.T, q string, op string, vars map[string]interface{}) Metrics {
+	t.Helper()
+	doc, err := Parse(q)
+	if err != nil {
+		t.Fatalf("解析失败 %q: %v", q, err)
+	}
+	m, _, err := Analyze(doc, op, vars)
+	if err != nil {
+		t.Fatalf("分析失败 %q: %v", q, err)
+	}
+	return m
+}
+
+func TestAnalyze(t *testing.T) {
+	m := analyze(t, `{ a { b { c } } d }`, "", nil)
+	if m.Depth != 3 || m.Cost != 4 || m.Aliases != 0 {
+		t.Fatalf("统计不对: %+v", m)
+	}
+	// 片段按引用展开计入深度
+	m = analyze(t, `{ a { ...F } } fragment F on T { b { c } }`, "", nil)
+	if m.Depth != 3 {
+		t.Fatalf("片段应展开计算深度: %+v", m)
+	}
+	// 同名别名不算别名
+	m = analyze(t, `{ x1: user(id: 1) { id } x2: user(id: 2) { id } user: user(id: 3) { id } }`, "", nil)
+	if m.Aliases != 2 {
+		t.Fatalf("别名数不对: %+v", m)
+	}
+	// 分页参数放大子查询，变量也能取到
+	m = analyze(t, `query Q($n: Int) { users(first: 100) { posts(limit: $n) { title } } }`, "", map[string]interface{}{"n": float64(50)})
+	if m.Cost != 1+100*(1+50*1) {
+		t.Fatalf("复杂度不对: %d", m.Cost)
+	}
+	m = analyze(t, `{ __schema { types { name } } }`, "", nil)
+	if !m.Introspection {
+		t.Fatal("__schema 应识别为自省")
+	}
+	if analyze(t, `{ me { __typename } }`, "", nil).Introspection {
+		t.Fatal("__typename 不算自省")
+	}
+	// 只算指定的操作
+	m = analyze(t, `query A { a } query B { b { c { d } } }`, "A", nil)
+	if m.Depth != 1 {
+		t.Fatalf("应只统计指定操作: %+v", m)
+	}
+
+	for _, q := range []string{
+		`{ ...A } fragment A on T { ...B } fragment B on T { ...A }`,
+		`{ ...Missing }`,
+	} {
+		doc, err := Parse(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Analyze(doc, "", nil); err == nil {
+			t.Errorf("%q 应报错", q)
+		}
+	}
+	doc, _ := Parse(`query A { a }`)
+	if _, _, err := Analyze(doc, "B", nil); err == nil {
+		t.Fatal("找不到指定的操作应报错")
+	}
+}
+
+// 片段层层翻倍引用(“片段炸弹”)：统计结果按引用次数封顶，分析时间不随展开规模增长
+func TestAnalyzeFragmentBomb(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{ ...F0 }`)
+	for i := 0; i < 60; i++ {
+		sb.WriteString(" fragment F" + strconv.Itoa(i) + " on T { a: f { ...F" + strconv.Itoa(i+1) + " } b: f { ...F" + strconv.Itoa(i+1) + " } }")
+	}
+	sb.WriteString(" fragment F60 on T { x }")
+	start := time.Now()
+	m := analyze(t, sb.String(), "", nil)
+	if time.Since(start) > time.Second {
+		t.Fatal("片段展开应只遍历一次")
+	}
+	if m.Cost < costCap || m.Aliases <= 1000 || m.Depth != 61 {
+		t.Fatalf("统计不对: %+v", m)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	reqs, batch, err := ParseRequest("POST", "application/json", url.Values{}, []byte(`{"query":"query Q { a }","operationName":"Q","variables":{"n":10}}`))
+	if err != nil || batch || len(reqs) != 1 || reqs[0].OperationName != "Q" || reqs[0].Variables["n"] == nil {
+		t.Fatalf("JSON 请求解析不对: %+v %v", reqs, err)
+	}
+	reqs, batch, err = ParseRequest("POST", "application/json", url.Values{}, []byte(`[{"query":"{a}"},{"query":"{b}"}]`))
+	if err != nil || !batch || len(reqs) != 2 {
+		t.Fatalf("批量请求解析不对: %+v %v", reqs, err)
+	}
+	reqs, _, err = ParseRequest("POST", "application/graphql; charset=utf-8", url.Values{"operationName": {"Q"}}, []byte(`query Q { a }`))
+	if err != nil || reqs[0].Query != "query Q { a }" || reqs[0].OperationName != "Q" {
+		t.Fatalf("application/graphql 解析不对: %+v %v", reqs, err)
+	}
+	q := url.Values{"operationName": {"Q"}, "extensions": {`{"persistedQuery":{"version":1,"sha256Hash":"ABC"}}`}}
+	reqs, _, err = ParseRequest("GET", "", q, nil)
+	if err != nil || reqs[0].Query != "" || reqs[0].Hash != "abc" {
+		t.Fatalf("GET 持久化查询解析不对: %+v %v", reqs, err)
+	}
+	if reqs, _, err := ParseRequest("GET", "", url.Values{"id": {"1"}}, nil); err != nil || len(reqs) != 0 {
+		t.Fatal("没有查询参数的 GET 不是 GraphQL 调用")
+	}
+	if _, _, err := ParseRequest("POST", "application/json", url.Values{}, []byte(`{"query":`)); err == nil {
+		t.Fatal("非法 JSON 应报错")
+	}
+}
+
+// 字段名大小写变体：标准库会不区分大小写地取最后一个，检查的和后端执行的可能不是同一份查询
+func TestParseRequestCaseVariantKeys(t *testing.T) {
+	for _, body := range []string{
+		`{"query":"{__schema{types{name}}}","QUERY":"{ok}"}`,
+		`{"Query":"{__schema{types{name}}}"}`,
+		`[{"query":"{a}"},{"query":"{a}","operationname":"Q"}]`,
+		`{"extensions":{"persistedQuery":{"sha256hash":"abc"}}}`,
+	} {
+		if _, _, err := ParseRequest("POST", "application/json", url.Values{}, []byte(body)); err == nil {
+			t.Fatalf("大小写变体字段应按解析失败处理: %s", body)
+		}
+	}
+	q := url.Values{"extensions": {`{"PersistedQuery":{"sha256Hash":"abc"}}`}}
+	if _, _, err := ParseRequest("GET", "", q, nil); err == nil {
+		t.Fatal("GET 的 extensions 里大小写变体字段也应报错")
+	}
+	reqs, _, err := ParseRequest("POST", "application/json", url.Values{}, []byte(`{"query":"{a}","Vars":1,"extra":{"QUERY":"x"}}`))
+	if err != nil || reqs[0].Query != "{a}" {
+		t.Fatalf("无关字段不应影响解析: %+v %v", reqs, err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxAliases: 2, MaxBatch: 2, MaxCost: 50, DisableIntrospection: true}
+	cases := []struct {
+		reqs []Request
+		want string
+	}{
+		{[]Request{{Query: `query Q { a { b } }`}}, ""},
+		{[]Request{{Query: `{ a { b { c { d } } } }`}}, ViolationDepth},
+		{[]Request{{Query: `{ x: a y: a z: a }`}}, ViolationAliases},
+		{[]Request{{Query: `{ a }`}, {Query: `{ a }`}, {Query: `{ a }`}}, ViolationBatch},
+		{[]Request{{Query: `{ list(first: 100) { id } }`}}, ViolationCost},
+		{[]Request{{Query: `{ list(first: 30) { id } }`}, {Query: `{ list(first: 30) { id } }`}}, ViolationCost},
+		{[]Request{{Query: `{ __type(name: "User") { name } }`}}, ViolationIntrospection},
+		{[]Request{{Query: `{ a(`}}, ViolationParse},
+		{[]Request{{}}, ViolationParse},
+		{[]Request{{Query: `{ a }`, Hash: "deadbeef"}}, ViolationNotAllowed},
+	}
+	for _, c := range cases {
+		if got := Inspect(c.reqs, limits).Violation; got != c.want {
+			t.Errorf("%+v: 结果 %q，期望 %q", c.reqs, got, c.want)
+		}
+	}
+	res := Inspect([]Request{{Query: `query GetUser { a } query Other { b }`, OperationName: "GetUser"}, {Query: `mutation Like { like }`}}, limits)
+	if res.Violation != "" || strings.Join(res.Operations, ",") != "GetUser,Like" || res.Cost != 2 {
+		t.Fatalf("操作名/复杂度不对: %+v", res)
+	}
+
+	allowed := `query Q { a }`
+	limits.Allowlist = ParseAllowlist("sha256:" + strings.ToUpper(Hash(allowed)) + ",\n ffff")
+	if res := Inspect([]Request{{Query: allowed}}, limits); res.Violation != "" {
+		t.Fatalf("白名单里的查询应放行: %+v", res)
+	}
+	if res := Inspect([]Request{{Query: `query Q { b }`}}, limits); res.Violation != ViolationNotAllowed {
+		t.Fatalf("白名单外的查询应拦截: %+v", res)
+	}
+	if res := Inspect([]Request{{Hash: "ffff", OperationName: "Q"}}, limits); res.Violation != "" || res.Operations[0] != "Q" {
+		t.Fatalf("只带哈希的白名单查询应放行: %+v", res)
+	}
+	if res := Inspect([]Request{{Hash: "eeee"}}, limits); res.Violation != ViolationNotAllowed {
+		t.Fatalf("只带哈希的非白名单查询应拦截: %+v", res)
+	}
+}
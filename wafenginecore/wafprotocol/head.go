@@ -0,0 +1,140 @@
+package wafprotocol
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 协议异常类型，拦截标题用
+const (
+	AnomalyCLTE         = "CL与TE并存"
+	AnomalyDupCL        = "重复Content-Length"
+	AnomalyTEOnHTTP10   = "HTTP/1.0携带Transfer-Encoding"
+	AnomalyObsFold      = "头部折行"
+	AnomalyBareLF       = "裸换行符"
+	AnomalyHostMismatch = "Host与请求地址不一致"
+	AnomalyDupHost      = "重复Host"
+	AnomalyBadChar      = "头部非法字符"
+	AnomalyH2Header     = "HTTP/2头部违规"
+	AnomalyHeaderCount  = "头部数量超限"
+	AnomalyHeaderSize   = "头部过大"
+	AnomalyURILength    = "URI过长"
+	AnomalyArgCount     = "参数数量超限"
+)
+
+// smugglingAnomalies 请求走私类异常：前后端对请求边界可能理解不一致
+var smugglingAnomalies = []string{AnomalyCLTE, AnomalyDupCL, AnomalyTEOnHTTP10, AnomalyObsFold, AnomalyBareLF}
+
+// IsSmuggling 是否属于请求走私类异常(不区分大小写，拦截标题分类时已转成小写)
+func IsSmuggling(anomaly string) bool {
+	for _, a := range smugglingAnomalies {
+		if strings.EqualFold(a, anomaly) {
+			return true
+		}
+	}
+	return false
+}
+
+// Head 连接上截下的一个原始请求头(HTTP/1.x)
+type Head struct {
+	Method    string
+	Target    string //请求行里的请求地址，与 http.Request.RequestURI 一致
+	Proto     string
+	Anomalies []string
+
+	chunked       bool
+	contentLength int64
+	upgrade       bool
+}
+
+// ParseHead 解析一段以空行结尾的原始请求头，找出 net/http 解析时会悄悄抹平的异常：
+// CL 与 TE 并存(TE 生效，CL 被丢弃)、重复的相同 CL、HTTP/1.0 带 TE(TE 被忽略)、
+// 折行(续行被拼进上一行)、只用 \n 分行、绝对地址请求行与 Host 头不一致(以请求行为准)。
+// 头名非法、多个 Host、多个不同 CL、非 chunked 的 TE 由 net/http 直接回 400/501，到不了这里
+func ParseHead(raw []byte) *Head {
+	h := &Head{}
+	lines := bytes.Split(raw, []byte("\n"))
+	// 末尾的空行和结尾换行产生的空串不算
+	for len(lines) > 0 && len(bytes.TrimRight(lines[len(lines)-1], "\r")) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return h
+	}
+	bareLF := !bytes.HasSuffix(raw, []byte("\r\n\r\n"))
+	for i, line := range lines {
+		if !bytes.HasSuffix(line, []byte("\r")) {
+			bareLF = true
+		}
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	if bareLF {
+		h.add(AnomalyBareLF)
+	}
+
+	parts := strings.SplitN(string(lines[0]), " ", 3)
+	if len(parts) == 3 {
+		h.Method, h.Target, h.Proto = parts[0], parts[1], parts[2]
+	}
+
+	var hosts, cls, tes []string
+	for _, line := range lines[1:] {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			h.add(AnomalyObsFold)
+			continue
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		v := strings.TrimSpace(string(value))
+		switch strings.ToLower(string(name)) {
+		case "host":
+			hosts = append(hosts, v)
+		case "content-length":
+			cls = append(cls, v)
+		case "transfer-encoding":
+			tes = append(tes, v)
+		case "upgrade":
+			h.upgrade = true
+		}
+	}
+
+	http11 := h.Proto != "HTTP/1.0"
+	if len(tes) > 0 && !http11 {
+		h.add(AnomalyTEOnHTTP10)
+	}
+	if len(tes) > 0 && len(cls) > 0 {
+		h.add(AnomalyCLTE)
+	}
+	if len(cls) > 1 {
+		h.add(AnomalyDupCL)
+	}
+	if len(hosts) > 1 {
+		h.add(AnomalyDupHost)
+	}
+	if len(hosts) > 0 && !strings.HasPrefix(h.Target, "/") && h.Target != "*" && h.Method != "CONNECT" {
+		if u, err := url.Parse(h.Target); err == nil && u.Host != "" && !strings.EqualFold(u.Host, hosts[0]) {
+			h.add(AnomalyHostMismatch)
+		}
+	}
+
+	// 按 net/http 的规则算出请求体边界：HTTP/1.1 的 chunked 优先，其次 Content-Length，都没有就没有请求体
+	if len(tes) == 1 && http11 && strings.EqualFold(tes[0], "chunked") {
+		h.chunked = true
+	} else if len(cls) > 0 {
+		h.contentLength, _ = strconv.ParseInt(cls[0], 10, 64)
+	}
+	return h
+}
+
+func (h *Head) add(anomaly string) {
+	for _, a := range h.Anomalies {
+		if a == anomaly {
+			return
+		}
+	}
+	h.Anomalies = append(h.Anomalies, anomaly)
+}
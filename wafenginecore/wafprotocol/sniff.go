@@ -0,0 +1,275 @@
+package wafprotocol
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+*
+协议合规检测：原始请求头截取
+
+net/http 解析请求时会把走私相关的痕迹抹掉：CL 与 TE 并存时丢掉 CL、把折行拼回上一行、接受只用 \n 分行，
+Handler 拿到的 http.Request 里已看不出来。这里在明文 HTTP/1.x 连接上按 net/http 同样的规则切分请求边界，
+把每个请求的原始请求头截下来，Handler 里按请求行取回对应的那一个。
+
+TLS 端口由 net/http 自己做握手和 ALPN，连接只能是 *tls.Conn，截不到明文，只做 Handler 层的检查。
+连接被劫持(WebSocket 等)后不再截取。
+*/
+
+const (
+	maxHeadBytes  = http.DefaultMaxHeaderBytes + 4096 //与 net/http 的请求头上限一致，超过的请求它也会拒绝
+	maxChunkLine  = 4096
+	maxQueuedHead = 16
+)
+
+const (
+	stHead = iota
+	stBody
+	stChunkSize
+	stChunkData
+	stChunkEnd
+	stTrailer
+	stDone //不再截取
+)
+
+type connKey struct{}
+
+// Listen 给监听包一层，Accept 出来的连接会截取原始请求头
+func Listen(ln net.Listener) net.Listener {
+	return &listener{Listener: ln}
+}
+
+type listener struct {
+	net.Listener
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c}, nil
+}
+
+// Attach 让 Handler 能从请求上下文里取回连接；连接被劫持后停止截取。需在设置完 ConnState 之后调用
+func Attach(svr *http.Server) {
+	connContext := svr.ConnContext
+	svr.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		if sc, ok := c.(*Conn); ok {
+			ctx = context.WithValue(ctx, connKey{}, sc)
+		}
+		return ctx
+	}
+	connState := svr.ConnState
+	svr.ConnState = func(c net.Conn, state http.ConnState) {
+		if connState != nil {
+			connState(c, state)
+		}
+		if sc, ok := c.(*Conn); ok && (state == http.StateHijacked || state == http.StateClosed) {
+			sc.stop()
+		}
+	}
+}
+
+// HeadFor 取回请求对应的原始请求头；不是截取的连接或没对上时返回 nil
+func HeadFor(r *http.Request) *Head {
+	sc, ok := r.Context().Value(connKey{}).(*Conn)
+	if !ok || r.ProtoMajor != 1 {
+		return nil
+	}
+	return sc.pop(r.Method, r.RequestURI)
+}
+
+// Conn 截取原始请求头的连接
+type Conn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	state  int
+	buf    []byte //请求头或分块长度行、尾部字段行的缓冲
+	scan   int    //请求头里已找过结束标记的位置
+	remain int64  //当前请求体或分块还剩的字节数
+	heads  []*Head
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		c.feed(p[:n])
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// CloseWrite 透传给底层连接，net/http 关连接前靠它半关闭
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// NetConn 底层连接
+func (c *Conn) NetConn() net.Conn { return c.Conn }
+
+func (c *Conn) stop() {
+	c.mu.Lock()
+	c.state = stDone
+	c.buf = nil
+	c.mu.Unlock()
+}
+
+// pop 按请求行取回原始请求头。net/http 自己应答的请求(OPTIONS * 等)不进 Handler，排在前面没被取走的一并丢掉
+func (c *Conn) pop(method, target string) *Head {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, h := range c.heads {
+		if h.Method == method && h.Target == target {
+			c.heads = c.heads[i+1:]
+			return h
+		}
+	}
+	return nil
+}
+
+func (c *Conn) feed(p []byte) {
+	for len(p) > 0 && c.state != stDone {
+		switch c.state {
+		case stHead:
+			p = c.feedHead(p)
+		case stBody, stChunkData:
+			n := int64(len(p))
+			if n > c.remain {
+				n = c.remain
+			}
+			c.remain -= n
+			p = p[n:]
+			if c.remain == 0 {
+				if c.state == stBody {
+					c.state = stHead
+				} else {
+					c.state = stChunkEnd
+				}
+			}
+		case stChunkSize, stChunkEnd, stTrailer:
+			var line []byte
+			var ok bool
+			line, p, ok = c.feedLine(p)
+			if !ok {
+				continue
+			}
+			c.endLine(line)
+		}
+	}
+}
+
+// feedHead 攒够一个完整请求头(到空行为止)后解析入队，返回剩下的字节
+func (c *Conn) feedHead(p []byte) []byte {
+	if len(c.buf) == 0 {
+		// 请求之间多出的空行 net/http 会跳过
+		p = bytes.TrimLeft(p, "\r\n")
+		if len(p) == 0 {
+			return nil
+		}
+	}
+	start := len(c.buf)
+	c.buf = append(c.buf, p...)
+	for {
+		k := bytes.IndexByte(c.buf[c.scan:], '\n')
+		if k < 0 {
+			c.scan = len(c.buf)
+			break
+		}
+		k += c.scan
+		rest := c.buf[k+1:]
+		end := 0
+		switch {
+		case len(rest) == 0 || (len(rest) == 1 && rest[0] == '\r'):
+			c.scan = k
+		case rest[0] == '\n':
+			end = k + 2
+		case rest[0] == '\r' && rest[1] == '\n':
+			end = k + 3
+		default:
+			c.scan = k + 1
+			continue
+		}
+		if end == 0 {
+			break
+		}
+		h := ParseHead(c.buf[:end])
+		left := p[end-start:]
+		c.buf, c.scan = nil, 0
+		c.push(h)
+		return left
+	}
+	if len(c.buf) > maxHeadBytes {
+		c.state, c.buf = stDone, nil
+	}
+	return nil
+}
+
+func (c *Conn) push(h *Head) {
+	if len(c.heads) >= maxQueuedHead {
+		c.heads = c.heads[1:]
+	}
+	c.heads = append(c.heads, h)
+	switch {
+	case h.Method == "PRI" || h.Method == "CONNECT":
+		// HTTP/2 明文前言、隧道：之后不再是 HTTP/1.x 请求
+		c.state = stDone
+	case h.chunked:
+		c.state = stChunkSize
+	case h.contentLength > 0:
+		c.state, c.remain = stBody, h.contentLength
+	}
+}
+
+// feedLine 攒一行(到 \n 为止)，行太长时放弃截取
+func (c *Conn) feedLine(p []byte) (line []byte, left []byte, ok bool) {
+	k := bytes.IndexByte(p, '\n')
+	if k < 0 {
+		c.buf = append(c.buf, p...)
+		if len(c.buf) > maxChunkLine {
+			c.state, c.buf = stDone, nil
+		}
+		return nil, nil, false
+	}
+	line = append(c.buf, p[:k]...)
+	c.buf = nil
+	return bytes.TrimSuffix(line, []byte("\r")), p[k+1:], true
+}
+
+// endLine 分块编码里的一行：长度行、数据后的换行、结尾的尾部字段
+func (c *Conn) endLine(line []byte) {
+	switch c.state {
+	case stChunkSize:
+		s, _, _ := strings.Cut(string(line), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(s), 16, 64)
+		switch {
+		case err != nil || size < 0:
+			// net/http 也会报错断开连接
+			c.state = stDone
+		case size == 0:
+			c.state = stTrailer
+		default:
+			c.state, c.remain = stChunkData, size
+		}
+	case stChunkEnd:
+		c.state = stChunkSize
+	case stTrailer:
+		if len(line) == 0 {
+			c.state = stHead
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package wafprotocol
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHead(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"正常请求", "GET /a?b=1 HTTP/1.1\r\nHost: a.com\r\nAccept: */*\r\n\r\n", nil},
+		{"CL与TE并存", "POST / HTTP/1.1\r\nHost: a.com\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n", []string{AnomalyCLTE}},
+		{"重复CL", "POST / HTTP/1.1\r\nHost: a.com\r\nContent-Length: 4\r\ncontent-length: 4\r\n\r\n", []string{AnomalyDupCL}},
+		{"HTTP/1.0带TE", "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n", []string{AnomalyTEOnHTTP10}},
+		{"折行", "GET / HTTP/1.1\r\nHost: a.com\r\nX-A: 1\r\n b\r\n\r\n", []string{AnomalyObsFold}},
+		{"裸换行", "GET / HTTP/1.1\nHost: a.com\n\n", []string{AnomalyBareLF}},
+		{"空行是裸换行", "GET / HTTP/1.1\r\nHost: a.com\r\n\n", []string{AnomalyBareLF}},
+		{"绝对地址与Host不一致", "GET http://b.com/x HTTP/1.1\r\nHost: a.com\r\n\r\n", []string{AnomalyHostMismatch}},
+		{"绝对地址与Host一致", "GET http://A.com/x HTTP/1.1\r\nHost: a.com\r\n\r\n", nil},
+	}
+	for _, c := range cases {
+		h := ParseHead([]byte(c.raw))
+		if !reflect.DeepEqual(h.Anomalies, c.want) {
+			t.Errorf("%s: 期望 %v，实际 %v", c.name, c.want, h.Anomalies)
+		}
+	}
+	h := ParseHead([]byte("GET http://b.com/x HTTP/1.1\r\nHost: a.com\r\n\r\n"))
+	if h.Method != "GET" || h.Target != "http://b.com/x" || h.Proto != "HTTP/1.1" {
+		t.Fatalf("请求行解析不对: %+v", h)
+	}
+}
+
+// TestConnFraming 请求体(定长、分块、带尾部字段)之后的请求头要能接着截到，按字节逐个喂也一样
+func TestConnFraming(t *testing.T) {
+	stream := "POST /a HTTP/1.1\r\nHost: a.com\r\nContent-Length: 27\r\n\r\nGET /fake HTTP/1.1\r\nX: 1\r\n\r\n" +
+		"POST /b HTTP/1.1\r\nHost: a.com\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"\r\nGET /c HTTP/1.1\nHost: a.com\n\n"
+	for _, step := range []int{len(stream), 1, 7} {
+		c := &Conn{}
+		for i := 0; i < len(stream); i += step {
+			end := i + step
+			if end > len(stream) {
+				end = len(stream)
+			}
+			c.feed([]byte(stream[i:end]))
+		}
+		var targets []string
+		for _, h := range c.heads {
+			targets = append(targets, h.Target)
+		}
+		if !reflect.DeepEqual(targets, []string{"/a", "/b", "/c"}) {
+			t.Fatalf("步长 %d: 截到的请求 %v", step, targets)
+		}
+		if c.pop("GET", "/c") == nil || len(c.heads) != 0 {
+			t.Fatalf("步长 %d: 按请求行取回后前面没取走的应一并丢掉", step)
+		}
+	}
+}
+
+// TestSniffServer 真实连接上：CL 与 TE 并存的请求经 net/http 解析后已看不出来，HeadFor 能取回原始请求头
+func TestSniffServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan []string, 4)
+	svr := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if h := HeadFor(r); h != nil {
+			got <- append([]string{r.URL.Path}, h.Anomalies...)
+		} else {
+			got <- []string{r.URL.Path, "nil"}
+		}
+	})}
+	Attach(svr)
+	go svr.Serve(Listen(ln))
+	defer svr.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "POST /smuggle HTTP/1.1\r\nHost: a.com\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"+
+		"OPTIONS * HTTP/1.1\r\nHost: a.com\r\n\r\n"+
+		"GET /next HTTP/1.1\r\nHost: a.com\r\n\r\n")
+	br := bufio.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	want := [][]string{{"/smuggle", AnomalyCLTE}, {"/next"}}
+	for _, w := range want {
+		if g := <-got; strings.Join(g, ",") != strings.Join(w, ",") {
+			t.Fatalf("期望 %v，实际 %v", w, g)
+		}
+	}
+}
@@ -8,14 +8,13 @@ import (
 	"SamWaf/model"
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/utils"
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -47,56 +46,143 @@ func LoadWebDataFormCache(w http.ResponseWriter, r *http.Request, hostSafe *wafe
 		requestURI, key, hostSafe.Host.Code, cacheConfig.CacheLocation))
 
 	//规则匹配查询
-	_, err2 := checkCacheRule(hostSafe, cacheConfig, r)
-	if err2 != nil {
+	if _, err2 := matchCacheRule(hostSafe, r); err2 != nil {
 		return nil
 	}
 
-	var data []byte = nil
-	if cacheConfig.CacheLocation == "memory" || cacheConfig.CacheLocation == "all" {
-		zlog.Debug(fmt.Sprintf("尝试从内存缓存加载 主机代码: %s, 缓存键: %s", hostSafe.Host.Code, key))
-		memoryData := loadFormMemory(hostSafe.Host.Code, key)
-		if memoryData == nil {
-			zlog.Debug(fmt.Sprintf("内存缓存未命中 主机代码: %s, 缓存键: %s", hostSafe.Host.Code, key))
-		} else {
-			zlog.Debug(fmt.Sprintf("内存缓存命中 主机代码: %s, 缓存键: %s, 数据大小: %d",
-				hostSafe.Host.Code, key, len(memoryData)))
-			data = memoryData
+	hostCode := hostSafe.Host.Code
+	found := lookupEntry(r, hostCode, key, cacheConfig)
+	now := time.Now().Unix()
+	if found != nil && found.isFresh(now) {
+		return serveEntry(r, found, now)
+	}
+	cacheable := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if found != nil && cacheable && now < found.entry.swrUntil {
+		// stale-while-revalidate：先返回旧内容，同一个键同时只安排一次后台刷新
+		if webCacheRefresh.start(hostCode + found.key) {
+			weblog.CacheRevalidate = &innerbean.WebCacheRevalidate{Key: found.key, Entry: found.data, Background: true, HostCode: hostCode}
+			zlog.Debug(fmt.Sprintf("缓存已过期，先返回旧内容并后台刷新 URL: %s, 缓存键: %s", r.RequestURI, found.key))
 		}
+		resp := serveEntry(r, found, now)
+		resp.Header.Set("X-Cache", "STALE")
+		return resp
 	}
 
-	if data == nil && (cacheConfig.CacheLocation == "file" || cacheConfig.CacheLocation == "all") {
-		zlog.Debug(fmt.Sprintf("尝试从文件缓存加载 主机代码: %s, 缓存键: %s, 缓存目录: %s",
-			hostSafe.Host.Code, key, cacheConfig.CacheDir))
-		fileData := loadFormFile(hostSafe.Host.Code, key, cacheConfig.CacheDir)
-		if fileData == nil {
-			zlog.Debug(fmt.Sprintf("文件缓存未命中 主机代码: %s, 缓存键: %s", hostSafe.Host.Code, key))
+	if cacheable {
+		// 同一个键的并发未命中只放一个请求回源，其余等它写完缓存再读
+		flightKey := hostCode + key
+		if wait, leader := webCacheFlight.join(flightKey); leader {
+			weblog.CacheFlightKey = flightKey
 		} else {
-			zlog.Debug(fmt.Sprintf("文件缓存命中 主机代码: %s, 缓存键: %s, 数据大小: %d",
-				hostSafe.Host.Code, key, len(fileData)))
-			data = fileData
+			select {
+			case <-wait:
+			case <-r.Context().Done():
+				return nil
+			case <-time.After(coalesceWait):
+				zlog.Debug(fmt.Sprintf("等待同键请求回源超时，自行回源 URL: %s", r.RequestURI))
+			}
+			found = lookupEntry(r, hostCode, key, cacheConfig)
+			now = time.Now().Unix()
+			if found != nil && found.isFresh(now) {
+				zlog.Debug(fmt.Sprintf("合并回源后命中缓存 URL: %s, 缓存键: %s", r.RequestURI, found.key))
+				return serveEntry(r, found, now)
+			}
 		}
 	}
 
-	if data == nil {
+	if found == nil {
 		zlog.Debug(fmt.Sprintf("缓存完全未命中 URL: %s, 缓存键: %s", r.RequestURI, key))
 		return nil
 	}
+	// 已过期：有校验值就带条件头回源，源站回 304 时在 StoreWebDataCache 里刷新并用缓存应答；
+	// 在 stale-if-error 宽限期内回源失败时返回旧内容
+	if hasValidator(found.entry.resp.Header) || now < found.entry.sieUntil {
+		weblog.CacheRevalidate = newRevalidate(r, found.key, found.data, found.entry, false)
+		zlog.Debug(fmt.Sprintf("缓存已过期，回源 URL: %s, 缓存键: %s, 条件请求: %v", r.RequestURI, found.key, weblog.CacheRevalidate.Conditional))
+	}
+	return nil
+}
+
+// foundEntry 查到的缓存条目
+type foundEntry struct {
+	key   string //实际存放的键（带 Vary 时是变体的键）
+	data  []byte
+	entry *cacheEntry
+}
 
-	buf := bufio.NewReader(bytes.NewReader(data))
-	resp, err := http.ReadResponse(buf, nil)
+func (f *foundEntry) isFresh(now int64) bool {
+	return f.entry.freshUntil == 0 || now < f.entry.freshUntil
+}
+
+// lookupEntry 按主键查缓存，带 Vary 时再按本次请求的头取值找到对应的变体
+func lookupEntry(r *http.Request, hostCode string, key string, cacheConfig model.CacheConfig) *foundEntry {
+	data := loadEntry(hostCode, key, cacheConfig)
+	if names, _, ok := parseVaryMarker(data); ok {
+		key = varyKey(key, names, r.Header)
+		zlog.Debug(fmt.Sprintf("缓存带 Vary: %v, 变体缓存键: %s", names, key))
+		data = loadEntry(hostCode, key, cacheConfig)
+	}
+	if data == nil {
+		return nil
+	}
+	entry, err := decodeEntry(data)
 	if err != nil {
 		zlog.Error(fmt.Sprintf("解析缓存响应失败 URL: %s, 缓存键: %s, 错误: %v", r.RequestURI, key, err))
 		return nil
 	}
+	return &foundEntry{key: key, data: data, entry: entry}
+}
 
+// serveEntry 用缓存条目应答：补 Age，客户端条件请求满足时回 304
+func serveEntry(r *http.Request, found *foundEntry, now int64) *http.Response {
+	resp := found.entry.resp
+	if found.entry.stored > 0 {
+		resp.Header.Set("Age", strconv.FormatInt(int64(atoiDefault(resp.Header.Get("Age"), 0))+now-found.entry.stored, 10))
+	}
+	if notModified(r.Method, r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since"), resp.Header) {
+		zlog.Debug(fmt.Sprintf("客户端缓存仍有效，返回304 URL: %s, 缓存键: %s", r.RequestURI, found.key))
+		return notModifiedResponse(resp)
+	}
 	zlog.Debug(fmt.Sprintf("成功从缓存加载响应 URL: %s, 缓存键: %s, 状态码: %d, 响应头数量: %d",
-		r.RequestURI, key, resp.StatusCode, len(resp.Header)))
+		r.RequestURI, found.key, resp.StatusCode, len(resp.Header)))
 	return resp
 }
 
 // StoreWebDataCache 缓存web数据到cache里面
 func StoreWebDataCache(resp *http.Response, hostSafe *wafenginmodel.HostSafe, cacheConfig model.CacheConfig, weblog *innerbean.WebLog) {
+	// 写完缓存(或确定不缓存)就唤醒等待同一个键的请求，不用等响应体发完
+	defer ReleaseFlight(weblog)
+	rule, ruleErr := matchCacheRule(hostSafe, resp.Request)
+
+	if rv := weblog.CacheRevalidate; rv != nil {
+		weblog.CacheRevalidate = nil
+		if resp.StatusCode == http.StatusNotModified && rv.Conditional {
+			if rule == nil {
+				rule = &model.CacheRule{}
+			}
+			data, entry, p, err := applyRevalidated(resp, rv, rule, time.Now())
+			if err != nil {
+				zlog.Error(fmt.Sprintf("回源验证后还原缓存响应失败 URL: %s, 错误: %v", resp.Request.RequestURI, err))
+				return
+			}
+			if ruleErr != nil || p.reason != "" {
+				zlog.Debug(fmt.Sprintf("回源验证后不再缓存 URL: %s, 原因: %s", resp.Request.RequestURI, p.reason))
+				return
+			}
+			writeEntry(hostSafe.Host.Code, rv.Key, data, p.keep, cacheConfig, entryMeta{url: entry.url, tags: entry.tags})
+			zlog.Debug(fmt.Sprintf("回源验证通过，已刷新缓存 URL: %s, 缓存键: %s", resp.Request.RequestURI, rv.Key))
+			return
+		}
+		if isStaleIfErrorStatus(resp.StatusCode) && !rv.Background && time.Now().Unix() < rv.StaleIfErrorUntil {
+			// stale-if-error：源站 5xx，返回旧内容
+			if entry, err := decodeEntry(rv.Entry); err == nil {
+				zlog.Debug(fmt.Sprintf("源站返回 %d，使用旧缓存应答 URL: %s", resp.StatusCode, resp.Request.RequestURI))
+				replaceResponse(resp, entry.resp, entry.body, "STALE")
+				return
+			}
+		}
+	}
+
 	// 检查HTTP响应状态码，只缓存2xx的响应
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		zlog.Debug(fmt.Sprintf("响应状态码 %d 不符合缓存条件 (2xx)，不进行缓存 URL: %s",
@@ -115,33 +201,78 @@ func StoreWebDataCache(resp *http.Response, hostSafe *wafenginmodel.HostSafe, ca
 	zlog.Debug(fmt.Sprintf("尝试存储响应到缓存 URL: %s, 缓存键: %s, 主机代码: %s, 缓存位置: %s",
 		requestURI, key, hostSafe.Host.Code, cacheConfig.CacheLocation))
 
-	//规则匹配查询 获取缓存时间
-	timeout, err2 := checkCacheRule(hostSafe, cacheConfig, resp.Request)
-	if err2 != nil {
+	if ruleErr != nil {
+		return
+	}
+	//按源站缓存指令与规则确定新鲜期
+	now := time.Now()
+	p := storePolicy(resp, rule, now)
+	if p.reason != "" {
+		zlog.Debug(fmt.Sprintf("响应不可缓存 URL: %s, 原因: %s", requestURI, p.reason))
 		return
 	}
 
-	data, err := httputil.DumpResponse(resp, true)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		zlog.Error(fmt.Sprintf("读取响应体失败 URL: %s, 错误: %v", requestURI, err))
+		return
+	}
+	meta := entryMeta{url: requestURI, tags: responseTags(resp.Header)}
+	if meta.url == "" {
+		meta.url = resp.Request.URL.RequestURI()
+	}
+	data, err := encodeEntry(resp, body, p, now, meta.url, meta.tags)
 	if err != nil {
 		zlog.Error(fmt.Sprintf("序列化响应失败 URL: %s, 错误: %v", requestURI, err))
 		return
 	}
 
-	zlog.Debug(fmt.Sprintf("响应序列化成功 URL: %s, 数据大小: %d", requestURI, len(data)))
+	zlog.Debug(fmt.Sprintf("响应序列化成功 URL: %s, 数据大小: %d, 新鲜期(秒): %d, 保留期(秒): %d", requestURI, len(data), p.fresh, p.keep))
+
+	if names, _ := varyNames(resp.Header); len(names) > 0 {
+		writeEntry(hostSafe.Host.Code, key, encodeVaryMarker(names, meta.url), p.keep, cacheConfig, entryMeta{url: meta.url, marker: true})
+		key = varyKey(key, names, resp.Request.Header)
+	}
+	writeEntry(hostSafe.Host.Code, key, data, p.keep, cacheConfig, meta)
 
+	zlog.Debug(fmt.Sprintf("响应缓存完成 URL: %s, 缓存键: %s", resp.Request.RequestURI, key))
+}
+
+// loadEntry 按缓存位置依次从内存、文件取缓存条目
+func loadEntry(hostCode string, key string, cacheConfig model.CacheConfig) []byte {
 	if cacheConfig.CacheLocation == "memory" || cacheConfig.CacheLocation == "all" {
-		zlog.Debug(fmt.Sprintf("存储到内存缓存 主机代码: %s, 缓存键: %s, 超时时间(秒): %d",
-			hostSafe.Host.Code, key, timeout))
-		storeMemory(hostSafe.Host.Code, key, data, timeout, cacheConfig.MaxMemorySizeMB)
+		zlog.Debug(fmt.Sprintf("尝试从内存缓存加载 主机代码: %s, 缓存键: %s", hostCode, key))
+		if data := loadFormMemory(hostCode, key); data != nil {
+			zlog.Debug(fmt.Sprintf("内存缓存命中 主机代码: %s, 缓存键: %s, 数据大小: %d", hostCode, key, len(data)))
+			return data
+		}
+		zlog.Debug(fmt.Sprintf("内存缓存未命中 主机代码: %s, 缓存键: %s", hostCode, key))
 	}
+	if cacheConfig.CacheLocation == "file" || cacheConfig.CacheLocation == "all" {
+		zlog.Debug(fmt.Sprintf("尝试从文件缓存加载 主机代码: %s, 缓存键: %s, 缓存目录: %s", hostCode, key, cacheConfig.CacheDir))
+		if data := loadFormFile(hostCode, key, cacheConfig.CacheDir); data != nil {
+			zlog.Debug(fmt.Sprintf("文件缓存命中 主机代码: %s, 缓存键: %s, 数据大小: %d", hostCode, key, len(data)))
+			return data
+		}
+		zlog.Debug(fmt.Sprintf("文件缓存未命中 主机代码: %s, 缓存键: %s", hostCode, key))
+	}
+	return nil
+}
 
+// writeEntry 按缓存位置写入内存和/或文件，并登记到清理索引
+func writeEntry(hostCode string, key string, data []byte, timeout int, cacheConfig model.CacheConfig, meta entryMeta) {
+	webCacheIndex.add(hostCode, key, meta, timeout)
+	if cacheConfig.CacheLocation == "memory" || cacheConfig.CacheLocation == "all" {
+		zlog.Debug(fmt.Sprintf("存储到内存缓存 主机代码: %s, 缓存键: %s, 超时时间(秒): %d", hostCode, key, timeout))
+		storeMemory(hostCode, key, data, timeout, cacheConfig.MaxMemorySizeMB)
+	}
 	if cacheConfig.CacheLocation == "file" || cacheConfig.CacheLocation == "all" {
 		zlog.Debug(fmt.Sprintf("存储到文件缓存 主机代码: %s, 缓存键: %s, 缓存目录: %s, 超时时间(秒): %d",
-			hostSafe.Host.Code, key, cacheConfig.CacheDir, timeout))
-		storeFile(hostSafe.Host.Code, key, data, cacheConfig.CacheDir, timeout, cacheConfig.MaxFileSizeMB)
+			hostCode, key, cacheConfig.CacheDir, timeout))
+		storeFile(hostCode, key, data, cacheConfig.CacheDir, timeout, cacheConfig.MaxFileSizeMB)
 	}
-
-	zlog.Debug(fmt.Sprintf("响应缓存完成 URL: %s, 缓存键: %s", resp.Request.RequestURI, key))
 }
 
 func loadFormMemory(hostCode string, key string) []byte {
@@ -282,6 +413,13 @@ func storeFile(hostCode string, key string, data []byte, path string, timeout in
 		return
 	}
 
+	// 同一个键只保留最新写入的文件，否则较早写入、过期时间更晚的旧文件会一直被读到
+	if olds, _ := filepath.Glob(filepath.Join(safePath, key+".*.cache")); len(olds) > 0 {
+		for _, old := range olds {
+			os.Remove(old)
+		}
+	}
+
 	err := ioutil.WriteFile(filename, data, 0644)
 	if err != nil {
 		zlog.Error(fmt.Sprintf("写入文件缓存失败 文件路径: %s, 错误: %v", filename, err))
@@ -292,22 +430,34 @@ func storeFile(hostCode string, key string, data []byte, path string, timeout in
 }
 
 func checkCacheRule(hostSafe *wafenginmodel.HostSafe, cacheConfig model.CacheConfig, r *http.Request) (int, error) {
+	rule, err := matchCacheRule(hostSafe, r)
+	if err != nil {
+		return 0, err
+	}
+	return rule.CacheTime, nil
+}
+
+// matchCacheRule 找到请求命中的缓存规则（优先级数字越大越优先）
+func matchCacheRule(hostSafe *wafenginmodel.HostSafe, r *http.Request) (*model.CacheRule, error) {
 	//规则匹配查询
 	if hostSafe.CacheRule == nil || len(hostSafe.CacheRule) == 0 {
-		return 0, fmt.Errorf("没有配置缓存规则")
+		return nil, fmt.Errorf("没有配置缓存规则")
 	}
 
 	requestURI := r.URL.RequestURI()
 	requestMethod := r.Method
 
-	// 按优先级排序规则（优先级数字越大越优先）
-	sort.Slice(hostSafe.CacheRule, func(i, j int) bool {
-		return hostSafe.CacheRule[i].Priority > hostSafe.CacheRule[j].Priority
+	// 按优先级排序规则，HostSafe 上的切片会被并发读取，排序用副本
+	rules := make([]model.CacheRule, len(hostSafe.CacheRule))
+	copy(rules, hostSafe.CacheRule)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
 	})
 
 	pureRequestUrl := r.URL.Path
 	// 循环检查每个规则
-	for _, rule := range hostSafe.CacheRule {
+	for i := range rules {
+		rule := &rules[i]
 		finalUrl := requestURI
 		if rule.ParamType == 1 {
 			finalUrl = pureRequestUrl
@@ -331,12 +481,12 @@ func checkCacheRule(hostSafe *wafenginmodel.HostSafe, cacheConfig model.CacheCon
 
 		if matched {
 			zlog.Debug(fmt.Sprintf("缓存规则匹配成功: %s, 缓存时间: %d秒", rule.RuleName, rule.CacheTime))
-			return rule.CacheTime, nil
+			return rule, nil
 		}
 	}
 
 	// 没有匹配的规则
-	return 0, fmt.Errorf("没有匹配的缓存规则")
+	return nil, fmt.Errorf("没有匹配的缓存规则")
 }
 
 // 检查请求方法是否匹配
@@ -0,0 +1,125 @@
+package wafwebcache
+
+import (
+	"SamWaf/innerbean"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// coalesceWait 未命中时等待同键请求回源的最长时间，超时后自行回源
+var coalesceWait = 10 * time.Second
+
+// cacheFlight 同一个缓存键的并发未命中只放第一个请求回源，其余请求等它写完缓存
+type cacheFlight struct {
+	mu    sync.Mutex
+	calls map[string]chan struct{}
+}
+
+var webCacheFlight = &cacheFlight{calls: map[string]chan struct{}{}}
+
+// join 第一个请求成为回源者(leader=true)，其余返回等待用的通道
+func (f *cacheFlight) join(key string) (wait <-chan struct{}, leader bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.calls[key]; ok {
+		return ch, false
+	}
+	f.calls[key] = make(chan struct{})
+	return nil, true
+}
+
+func (f *cacheFlight) done(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.calls[key]; ok {
+		close(ch)
+		delete(f.calls, key)
+	}
+}
+
+// ReleaseFlight 回源者结束（写完缓存、不缓存或回源失败）后唤醒等待的请求，可重复调用
+func ReleaseFlight(weblog *innerbean.WebLog) {
+	if weblog == nil || weblog.CacheFlightKey == "" {
+		return
+	}
+	webCacheFlight.done(weblog.CacheFlightKey)
+	weblog.CacheFlightKey = ""
+}
+
+// refreshGuard 记录正在后台刷新的缓存键，同一个键同时只刷新一次
+type refreshGuard struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+var webCacheRefresh = &refreshGuard{running: map[string]bool{}}
+
+func (g *refreshGuard) start(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[key] {
+		return false
+	}
+	g.running[key] = true
+	return true
+}
+
+func (g *refreshGuard) finish(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.running, key)
+}
+
+// RefreshRequest 返回过期内容后，生成用于后台刷新缓存的请求与日志。
+// 没有安排后台刷新时返回 nil；刷新结束(不论成败)须调用 done。
+func RefreshRequest(r *http.Request, weblog *innerbean.WebLog) (req *http.Request, refreshLog *innerbean.WebLog, done func()) {
+	rv := weblog.CacheRevalidate
+	if rv == nil || !rv.Background {
+		return nil, nil, nil
+	}
+	weblog.CacheRevalidate = nil
+	refreshKey := rv.HostCode + rv.Key
+	done = func() { webCacheRefresh.finish(refreshKey) }
+
+	entry, err := decodeEntry(rv.Entry)
+	if err != nil {
+		done()
+		return nil, nil, nil
+	}
+	// 客户端连接结束不应打断后台刷新
+	req = r.Clone(context.Background())
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	logCopy := *weblog
+	refreshLog = &logCopy
+	refreshLog.CacheFlightKey = ""
+	refreshLog.CacheBackground = true
+	refreshLog.CacheRevalidate = newRevalidate(req, rv.Key, rv.Entry, entry, true)
+	return req, refreshLog, done
+}
+
+// StaleResponseOnError 回源失败时，若仍在 stale-if-error 宽限期内，返回旧的缓存响应
+func StaleResponseOnError(weblog *innerbean.WebLog) *http.Response {
+	if weblog == nil {
+		return nil
+	}
+	rv := weblog.CacheRevalidate
+	if rv == nil || rv.Background || time.Now().Unix() >= rv.StaleIfErrorUntil {
+		return nil
+	}
+	entry, err := decodeEntry(rv.Entry)
+	if err != nil {
+		return nil
+	}
+	weblog.CacheRevalidate = nil
+	resp := entry.resp
+	resp.Header.Set("X-Cache", "STALE")
+	return resp
+}
+
+// isStaleIfErrorStatus 可以用旧内容替代的源站错误状态
+func isStaleIfErrorStatus(code int) bool {
+	return code >= http.StatusInternalServerError
+}
@@ -0,0 +1,441 @@
+package wafwebcache
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/utils"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerStored     = "X-Samwaf-Cache-Stored" //入缓存时间(unix)，只存在于缓存条目内部，下发前去掉
+	headerFreshUntil = "X-Samwaf-Cache-Fresh"  //新鲜期截止(unix)，0 表示一直新鲜
+	headerURL        = "X-Samwaf-Cache-Url"    //请求路径(含参数)，清理缓存和重建索引用
+	headerTags       = "X-Samwaf-Cache-Tags"   //源站给的缓存标签，逗号分隔
+	headerSwrUntil   = "X-Samwaf-Cache-Swr"    //可以先返回旧内容、后台刷新的截止时间(unix)
+	headerSieUntil   = "X-Samwaf-Cache-Sie"    //回源失败时可以返回旧内容的截止时间(unix)
+	varyMarker       = "SAMWAF-VARY:"          //主键上存的是 Vary 头名单而不是响应，真正的响应在按 Vary 值算出的子键上
+	maxStaleKeep     = 86400                   //过期后为了回源验证最多再保留多久(秒)
+)
+
+// cachePolicy 一次存缓存的时间安排（秒）
+type cachePolicy struct {
+	fresh  int    //新鲜期，-1 表示一直新鲜
+	keep   int    //保留期，0 表示长期
+	swr    int    //过期后先返回旧内容、后台刷新的宽限期
+	sie    int    //过期后回源失败时返回旧内容的宽限期
+	reason string //非空表示不能缓存
+}
+
+// storePolicy 根据源站响应指令和缓存规则算出新鲜期、宽限期与保留期
+func storePolicy(resp *http.Response, rule *model.CacheRule, now time.Time) cachePolicy {
+	if _, star := varyNames(resp.Header); star {
+		return cachePolicy{reason: "Vary: *"}
+	}
+	if len(resp.Header.Values("Set-Cookie")) > 0 && rule.CacheSetCookie != 1 {
+		return cachePolicy{reason: "响应带 Set-Cookie"}
+	}
+	if rule.OverrideOrigin == 1 {
+		return rulePolicy(rule, rule.StaleWhileRevalidate, rule.StaleIfError)
+	}
+	if resp.Request != nil {
+		if _, ok := parseCacheControl(resp.Request.Header.Values("Cache-Control"))["no-store"]; ok {
+			return cachePolicy{reason: "请求 Cache-Control: no-store"}
+		}
+	}
+	cc := parseCacheControl(resp.Header.Values("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return cachePolicy{reason: "Cache-Control: no-store"}
+	}
+	if _, ok := cc["private"]; ok {
+		return cachePolicy{reason: "Cache-Control: private"}
+	}
+	if resp.Request != nil && resp.Request.Header.Get("Authorization") != "" {
+		// 带认证的请求只有源站明确允许共享时才缓存（RFC 9111 3.5）
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		_, mustRevalidate := cc["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return cachePolicy{reason: "带 Authorization 的请求"}
+		}
+	}
+
+	// 宽限期：源站给了就用源站的（RFC 5861），must-revalidate/proxy-revalidate 不允许用旧内容
+	p := cachePolicy{swr: rule.StaleWhileRevalidate, sie: rule.StaleIfError}
+	if v, ok := cc["stale-while-revalidate"]; ok {
+		p.swr = atoiDefault(v, 0)
+	}
+	if v, ok := cc["stale-if-error"]; ok {
+		p.sie = atoiDefault(v, 0)
+	}
+	_, mustRevalidate := cc["must-revalidate"]
+	_, proxyRevalidate := cc["proxy-revalidate"]
+	if mustRevalidate || proxyRevalidate {
+		p.swr, p.sie = 0, 0
+	}
+
+	_, noCache := cc["no-cache"]
+	if len(cc) == 0 && strings.Contains(strings.ToLower(resp.Header.Get("Pragma")), "no-cache") {
+		noCache = true
+	}
+	if v, ok := cc["s-maxage"]; ok {
+		p.fresh = atoiDefault(v, 0)
+	} else if v, ok := cc["max-age"]; ok {
+		p.fresh = atoiDefault(v, 0)
+	} else if expires := resp.Header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			base := now
+			if d, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+				base = d
+			}
+			p.fresh = int(t.Sub(base) / time.Second)
+		}
+	} else if !noCache {
+		// 源站没给新鲜期，按规则的缓存时间
+		return rulePolicy(rule, p.swr, p.sie)
+	}
+	if noCache {
+		// no-cache 每次都要回源验证，旧内容不能直接用
+		p.fresh, p.swr = 0, 0
+	}
+	p.fresh -= atoiDefault(resp.Header.Get("Age"), 0)
+	if p.fresh < 0 {
+		p.fresh = 0
+	}
+
+	grace := p.swr
+	if p.sie > grace {
+		grace = p.sie
+	}
+	if hasValidator(resp.Header) {
+		// 有校验值时过期后多留一段，用来回源验证
+		extra := p.fresh
+		if extra < 60 {
+			extra = 60
+		}
+		if extra > maxStaleKeep {
+			extra = maxStaleKeep
+		}
+		if extra > grace {
+			grace = extra
+		}
+	} else if p.fresh <= 0 && grace == 0 {
+		return cachePolicy{reason: "已过期且没有 ETag/Last-Modified 可供回源验证"}
+	}
+	p.keep = p.fresh + grace
+	return p
+}
+
+// rulePolicy 按规则的缓存时间，CacheTime 为 0 表示长期有效
+func rulePolicy(rule *model.CacheRule, swr int, sie int) cachePolicy {
+	if rule.CacheTime <= 0 {
+		return cachePolicy{fresh: -1}
+	}
+	grace := swr
+	if sie > grace {
+		grace = sie
+	}
+	return cachePolicy{fresh: rule.CacheTime, keep: rule.CacheTime + grace, swr: swr, sie: sie}
+}
+
+// parseCacheControl 解析 Cache-Control，指令名转小写，值去掉引号
+func parseCacheControl(values []string) map[string]string {
+	cc := map[string]string{}
+	for _, line := range values {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, val, _ := strings.Cut(part, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return cc
+}
+
+func atoiDefault(s string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func hasValidator(h http.Header) bool {
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+// varyNames 响应 Vary 头里的请求头名，规范化、去重并排序
+func varyNames(h http.Header) (names []string, star bool) {
+	seen := map[string]bool{}
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, true
+			}
+			name = http.CanonicalHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, false
+}
+
+// encodeVaryMarker 主键上的 Vary 标记：第一行是头名单，第二行是请求路径（重建索引用）
+func encodeVaryMarker(names []string, url string) []byte {
+	return []byte(varyMarker + strings.Join(names, ",") + "\n" + url)
+}
+
+// parseVaryMarker 解析 Vary 标记，ok 为 false 表示不是标记而是普通缓存条目
+func parseVaryMarker(data []byte) (names []string, url string, ok bool) {
+	if !bytes.HasPrefix(data, []byte(varyMarker)) {
+		return nil, "", false
+	}
+	line, url, _ := strings.Cut(string(data[len(varyMarker):]), "\n")
+	return strings.Split(line, ","), url, true
+}
+
+// varyKey 主键 + Vary 头对应的请求头取值，得到实际存放响应的子键
+func varyKey(baseKey string, names []string, reqHeader http.Header) string {
+	var b strings.Builder
+	b.WriteString(baseKey)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(":")
+		vals := reqHeader.Values(name)
+		for i := range vals {
+			vals[i] = strings.TrimSpace(vals[i])
+		}
+		b.WriteString(strings.Join(vals, ","))
+	}
+	return utils.Md5String(b.String())
+}
+
+// cacheEntry 反序列化后的缓存条目
+type cacheEntry struct {
+	resp       *http.Response
+	body       []byte
+	stored     int64 //入缓存时间
+	freshUntil int64 //新鲜期截止，0 表示一直新鲜
+	swrUntil   int64
+	sieUntil   int64
+	url        string
+	tags       []string
+}
+
+// encodeEntry 序列化缓存条目。Set-Cookie 永远不进缓存；body 已由调用方读出
+func encodeEntry(resp *http.Response, body []byte, p cachePolicy, now time.Time, url string, tags []string) ([]byte, error) {
+	stored := *resp
+	stored.Header = resp.Header.Clone()
+	stored.Header.Del("Set-Cookie")
+	stored.Header.Set(headerStored, strconv.FormatInt(now.Unix(), 10))
+	freshUntil := int64(0)
+	if p.fresh >= 0 {
+		freshUntil = now.Unix() + int64(p.fresh)
+		if p.swr > 0 {
+			stored.Header.Set(headerSwrUntil, strconv.FormatInt(freshUntil+int64(p.swr), 10))
+		}
+		if p.sie > 0 {
+			stored.Header.Set(headerSieUntil, strconv.FormatInt(freshUntil+int64(p.sie), 10))
+		}
+	}
+	stored.Header.Set(headerFreshUntil, strconv.FormatInt(freshUntil, 10))
+	stored.Header.Set(headerURL, url)
+	if len(tags) > 0 {
+		stored.Header.Set(headerTags, strings.Join(tags, ","))
+	}
+	stored.Body = io.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	return httputil.DumpResponse(&stored, true)
+}
+
+// decodeEntry 反序列化缓存条目，内部元数据头取出后从响应里去掉
+func decodeEntry(data []byte) (*cacheEntry, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{resp: resp, body: body, url: resp.Header.Get(headerURL)}
+	entry.stored, _ = strconv.ParseInt(resp.Header.Get(headerStored), 10, 64)
+	entry.freshUntil, _ = strconv.ParseInt(resp.Header.Get(headerFreshUntil), 10, 64)
+	entry.swrUntil, _ = strconv.ParseInt(resp.Header.Get(headerSwrUntil), 10, 64)
+	entry.sieUntil, _ = strconv.ParseInt(resp.Header.Get(headerSieUntil), 10, 64)
+	if tags := resp.Header.Get(headerTags); tags != "" {
+		entry.tags = strings.Split(tags, ",")
+	}
+	for _, name := range []string{headerStored, headerFreshUntil, headerSwrUntil, headerSieUntil, headerURL, headerTags} {
+		resp.Header.Del(name)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return entry, nil
+}
+
+// responseTags 源站响应里的缓存标签：Cache-Tag 逗号分隔，Surrogate-Key 空格分隔
+func responseTags(h http.Header) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, name := range []string{"Cache-Tag", "Surrogate-Key"} {
+		for _, line := range h.Values(name) {
+			for _, tag := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// notModified 判断客户端的条件请求是否可以直接回 304：有 If-None-Match 时只看它，否则看 If-Modified-Since
+func notModified(method, ifNoneMatch, ifModifiedSince string, h http.Header) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch != "" {
+		etag := weakETag(h.Get("ETag"))
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakETag(tag) == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// weakETag 弱比较：去掉 W/ 前缀
+func weakETag(tag string) string {
+	return strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+}
+
+// notModifiedResponse 由缓存的响应构造 304，只带 RFC 9110 15.4.5 要求的头
+func notModifiedResponse(resp *http.Response) *http.Response {
+	header := http.Header{}
+	for _, name := range []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary", "Last-Modified", "Age"} {
+		if vals := resp.Header.Values(name); len(vals) > 0 {
+			header[http.CanonicalHeaderKey(name)] = vals
+		}
+	}
+	return &http.Response{
+		Status:     "304 Not Modified",
+		StatusCode: http.StatusNotModified,
+		Proto:      resp.Proto,
+		ProtoMajor: resp.ProtoMajor,
+		ProtoMinor: resp.ProtoMinor,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    resp.Request,
+	}
+}
+
+// newRevalidate 过期条目回源前的准备：有校验值时把客户端原本的条件头暂存起来，换成缓存条目的 ETag/Last-Modified
+func newRevalidate(r *http.Request, key string, data []byte, entry *cacheEntry, background bool) *innerbean.WebCacheRevalidate {
+	rv := &innerbean.WebCacheRevalidate{
+		Key:               key,
+		Entry:             data,
+		StaleIfErrorUntil: entry.sieUntil,
+		Background:        background,
+	}
+	if !hasValidator(entry.resp.Header) {
+		return rv
+	}
+	rv.Conditional = true
+	rv.IfNoneMatch = r.Header.Get("If-None-Match")
+	rv.IfModifiedSince = r.Header.Get("If-Modified-Since")
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	if etag := entry.resp.Header.Get("ETag"); etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.resp.Header.Get("Last-Modified"); lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+	return rv
+}
+
+// applyRevalidated 源站对回源验证回了 304：用 304 里的新头刷新缓存条目，并把响应还原成缓存里的完整响应
+// （客户端自己的条件请求仍满足时回 304）。p.reason 非空表示刷新后不能再缓存。
+func applyRevalidated(resp *http.Response, rv *innerbean.WebCacheRevalidate, rule *model.CacheRule, now time.Time) (data []byte, entry *cacheEntry, p cachePolicy, err error) {
+	entry, err = decodeEntry(rv.Entry)
+	if err != nil {
+		return nil, nil, p, fmt.Errorf("解析过期缓存条目失败: %w", err)
+	}
+	cached, body := entry.resp, entry.body
+	for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified", "Age"} {
+		if vals := resp.Header.Values(name); len(vals) > 0 {
+			cached.Header[http.CanonicalHeaderKey(name)] = vals
+		}
+	}
+	cached.Request = resp.Request
+	p = storePolicy(cached, rule, now)
+	if p.reason == "" {
+		if data, err = encodeEntry(cached, body, p, now, entry.url, entry.tags); err != nil {
+			return nil, nil, p, err
+		}
+	}
+
+	method := http.MethodGet
+	if resp.Request != nil {
+		method = resp.Request.Method
+	}
+	if notModified(method, rv.IfNoneMatch, rv.IfModifiedSince, cached.Header) {
+		resp.Header = notModifiedResponse(cached).Header
+		resp.Header.Set("X-Cache", "REVALIDATED")
+		return data, entry, p, nil
+	}
+	replaceResponse(resp, cached, body, "REVALIDATED")
+	return data, entry, p, nil
+}
+
+// replaceResponse 把源站响应整体换成缓存里的响应
+func replaceResponse(resp *http.Response, cached *http.Response, body []byte, xCache string) {
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	resp.StatusCode = cached.StatusCode
+	resp.Status = cached.Status
+	resp.Header = cached.Header
+	resp.Header.Set("X-Cache", xCache)
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Transfer-Encoding")
+	resp.TransferEncoding = nil
+	resp.ContentLength = int64(len(body))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+}
@@ -0,0 +1,346 @@
+package wafwebcache
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCacheTestRequest(uri string, header map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, uri, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func newOriginResponse(r *http.Request, status int, header map[string]string, body string) *http.Response {
+	resp := &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}
+	for k, v := range header {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func readCacheBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("读取响应体失败: %v", err)
+	}
+	return string(body)
+}
+
+// cacheHttpTestEnv 单条"整站"缓存规则、内存缓存；返回存缓存与取缓存两个函数
+func cacheHttpTestEnv(hostCode string, rule model.CacheRule) (func(*http.Response, *innerbean.WebLog), func(*http.Request) (*http.Response, *innerbean.WebLog)) {
+	setupTestEnv()
+	rule.RuleType = 2
+	rule.RuleContent = "/"
+	hostSafe := createTestHostSafe(hostCode, []model.CacheRule{rule})
+	cfg := createTestCacheConfig(1, "memory", "")
+	store := func(resp *http.Response, weblog *innerbean.WebLog) {
+		if weblog == nil {
+			weblog = &innerbean.WebLog{}
+		}
+		StoreWebDataCache(resp, hostSafe, cfg, weblog)
+	}
+	load := func(r *http.Request) (*http.Response, *innerbean.WebLog) {
+		weblog := &innerbean.WebLog{}
+		resp := LoadWebDataFormCache(httptest.NewRecorder(), r, hostSafe, cfg, weblog)
+		// 与引擎一致：未命中的请求结束后放行同键等待者
+		ReleaseFlight(weblog)
+		return resp, weblog
+	}
+	return store, load
+}
+
+func TestStorePolicyDirectives(t *testing.T) {
+	now := time.Now()
+	rule := &model.CacheRule{CacheTime: 300}
+	cases := []struct {
+		name      string
+		reqHeader map[string]string
+		header    map[string]string
+		rule      *model.CacheRule
+		fresh     int
+		cacheable bool
+	}{
+		{"无指令按规则", nil, nil, rule, 300, true},
+		{"no-store", nil, map[string]string{"Cache-Control": "no-store"}, rule, 0, false},
+		{"private", nil, map[string]string{"Cache-Control": "private, max-age=60"}, rule, 0, false},
+		{"max-age", nil, map[string]string{"Cache-Control": "public, max-age=60"}, rule, 60, true},
+		{"s-maxage 优先", nil, map[string]string{"Cache-Control": "max-age=60, s-maxage=120"}, rule, 120, true},
+		{"Age 扣减", nil, map[string]string{"Cache-Control": "max-age=60", "Age": "20"}, rule, 40, true},
+		{"no-cache 无校验值", nil, map[string]string{"Cache-Control": "no-cache"}, rule, 0, false},
+		{"no-cache 有 ETag", nil, map[string]string{"Cache-Control": "no-cache", "ETag": `"v1"`}, rule, 0, true},
+		{"Set-Cookie 默认不缓存", nil, map[string]string{"Set-Cookie": "sid=1"}, rule, 0, false},
+		{"Set-Cookie 允许", nil, map[string]string{"Set-Cookie": "sid=1"}, &model.CacheRule{CacheTime: 300, CacheSetCookie: 1}, 300, true},
+		{"Vary *", nil, map[string]string{"Vary": "*"}, rule, 0, false},
+		{"Authorization 不共享", map[string]string{"Authorization": "Bearer x"}, map[string]string{"Cache-Control": "max-age=60"}, rule, 0, false},
+		{"Authorization public", map[string]string{"Authorization": "Bearer x"}, map[string]string{"Cache-Control": "public, max-age=60"}, rule, 60, true},
+		{"覆盖源站指令", nil, map[string]string{"Cache-Control": "no-store"}, &model.CacheRule{CacheTime: 30, OverrideOrigin: 1}, 30, true},
+	}
+	for _, c := range cases {
+		r := newCacheTestRequest("/a.js", c.reqHeader)
+		resp := newOriginResponse(r, 200, c.header, "x")
+		p := storePolicy(resp, c.rule, now)
+		if (p.reason == "") != c.cacheable {
+			t.Errorf("%s: 期望可缓存=%v, 实际原因=%q", c.name, c.cacheable, p.reason)
+			continue
+		}
+		if c.cacheable && p.fresh != c.fresh {
+			t.Errorf("%s: 期望新鲜期 %d, 实际 %d", c.name, c.fresh, p.fresh)
+		}
+	}
+}
+
+func TestCacheStripsSetCookie(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_setcookie", model.CacheRule{CacheTime: 60, CacheSetCookie: 1})
+	r := newCacheTestRequest("/page.html", nil)
+	origin := newOriginResponse(r, 200, map[string]string{"Set-Cookie": "sid=secret"}, "hello")
+	store(origin, nil)
+	if origin.Header.Get("Set-Cookie") == "" {
+		t.Fatalf("不应修改下发给当前客户端的 Set-Cookie")
+	}
+	if readCacheBody(t, origin) != "hello" {
+		t.Fatalf("存缓存后原响应体应可再次读取")
+	}
+
+	cached, _ := load(newCacheTestRequest("/page.html", nil))
+	if cached == nil {
+		t.Fatalf("期望命中缓存")
+	}
+	if cached.Header.Get("Set-Cookie") != "" {
+		t.Fatalf("缓存里不应带 Set-Cookie")
+	}
+	if cached.Header.Get(headerStored) != "" || cached.Header.Get(headerFreshUntil) != "" {
+		t.Fatalf("内部元数据头不应下发")
+	}
+	if readCacheBody(t, cached) != "hello" {
+		t.Fatalf("缓存正文不正确")
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_vary", model.CacheRule{CacheTime: 60})
+	for _, lang := range []string{"zh", "en"} {
+		r := newCacheTestRequest("/i18n.json", map[string]string{"Accept-Language": lang})
+		store(newOriginResponse(r, 200, map[string]string{"Vary": "accept-language"}, "body-"+lang), nil)
+	}
+	for _, lang := range []string{"zh", "en"} {
+		cached, _ := load(newCacheTestRequest("/i18n.json", map[string]string{"Accept-Language": lang}))
+		if cached == nil {
+			t.Fatalf("%s: 期望命中缓存", lang)
+		}
+		if body := readCacheBody(t, cached); body != "body-"+lang {
+			t.Fatalf("%s: 命中了错误的变体 %q", lang, body)
+		}
+	}
+	if cached, _ := load(newCacheTestRequest("/i18n.json", map[string]string{"Accept-Language": "fr"})); cached != nil {
+		t.Fatalf("未缓存过的变体不应命中")
+	}
+}
+
+func TestCacheConditionalHit(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_conditional", model.CacheRule{CacheTime: 60})
+	r := newCacheTestRequest("/logo.png", nil)
+	store(newOriginResponse(r, 200, map[string]string{"ETag": `"abc"`, "Cache-Control": "max-age=60"}, "png"), nil)
+
+	cached, _ := load(newCacheTestRequest("/logo.png", map[string]string{"If-None-Match": `W/"abc"`}))
+	if cached == nil || cached.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-None-Match 匹配时期望 304, 实际 %v", cached)
+	}
+	if cached.Header.Get("ETag") != `"abc"` {
+		t.Fatalf("304 应带 ETag")
+	}
+	if body := readCacheBody(t, cached); body != "" {
+		t.Fatalf("304 不应有正文")
+	}
+
+	cached, _ = load(newCacheTestRequest("/logo.png", map[string]string{"If-None-Match": `"other"`}))
+	if cached == nil || cached.StatusCode != http.StatusOK {
+		t.Fatalf("If-None-Match 不匹配时期望 200")
+	}
+}
+
+func TestCacheStaleRevalidate(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_revalidate", model.CacheRule{CacheTime: 60})
+	r := newCacheTestRequest("/app.js", nil)
+	store(newOriginResponse(r, 200, map[string]string{"ETag": `"v1"`, "Cache-Control": "no-cache", "Content-Type": "text/javascript"}, "console.log(1)"), nil)
+
+	// no-cache：每次都要回源验证
+	client := newCacheTestRequest("/app.js", map[string]string{"If-None-Match": `"old"`})
+	cached, weblog := load(client)
+	if cached != nil {
+		t.Fatalf("过期条目不应直接命中")
+	}
+	if weblog.CacheRevalidate == nil {
+		t.Fatalf("期望准备回源验证")
+	}
+	if client.Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("回源请求应带缓存的 ETag, 实际 %q", client.Header.Get("If-None-Match"))
+	}
+
+	// 源站回 304
+	origin := newOriginResponse(client, http.StatusNotModified, map[string]string{"ETag": `"v1"`, "Cache-Control": "max-age=60"}, "")
+	store(origin, weblog)
+	if origin.StatusCode != http.StatusOK {
+		t.Fatalf("客户端条件不满足时应还原为 200, 实际 %d", origin.StatusCode)
+	}
+	if origin.Header.Get("X-Cache") != "REVALIDATED" || origin.Header.Get("Content-Type") != "text/javascript" {
+		t.Fatalf("还原的响应头不正确: %v", origin.Header)
+	}
+	if readCacheBody(t, origin) != "console.log(1)" {
+		t.Fatalf("还原的响应体不正确")
+	}
+	if weblog.CacheRevalidate != nil {
+		t.Fatalf("回源验证状态应清空")
+	}
+
+	// 304 带来了 max-age=60，条目重新变为新鲜
+	cached, _ = load(newCacheTestRequest("/app.js", nil))
+	if cached == nil || cached.StatusCode != http.StatusOK {
+		t.Fatalf("刷新后期望直接命中缓存")
+	}
+	if readCacheBody(t, cached) != "console.log(1)" {
+		t.Fatalf("刷新后缓存正文不正确")
+	}
+}
+
+func TestCacheNoStoreNotCached(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_nostore", model.CacheRule{CacheTime: 60})
+	r := newCacheTestRequest("/secret", nil)
+	store(newOriginResponse(r, 200, map[string]string{"Cache-Control": "no-store"}, "secret"), nil)
+	if cached, _ := load(newCacheTestRequest("/secret", nil)); cached != nil {
+		t.Fatalf("no-store 响应不应被缓存")
+	}
+}
+
+func TestStorePolicyStaleWindows(t *testing.T) {
+	now := time.Now()
+	rule := &model.CacheRule{CacheTime: 300, StaleWhileRevalidate: 30, StaleIfError: 120}
+	cases := []struct {
+		name   string
+		header map[string]string
+		swr    int
+		sie    int
+		keep   int
+	}{
+		{"按规则", nil, 30, 120, 420},
+		{"源站指令优先", map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=5, stale-if-error=600"}, 5, 600, 610},
+		{"must-revalidate 不用旧内容", map[string]string{"Cache-Control": "max-age=10, must-revalidate", "ETag": `"v"`}, 0, 0, 70},
+	}
+	for _, c := range cases {
+		r := newCacheTestRequest("/a.js", nil)
+		p := storePolicy(newOriginResponse(r, 200, c.header, "x"), rule, now)
+		if p.reason != "" || p.swr != c.swr || p.sie != c.sie || p.keep != c.keep {
+			t.Errorf("%s: 期望 swr=%d sie=%d keep=%d, 实际 %+v", c.name, c.swr, c.sie, c.keep, p)
+		}
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_swr", model.CacheRule{CacheTime: 60})
+	r := newCacheTestRequest("/feed.json", nil)
+	store(newOriginResponse(r, 200, map[string]string{"Cache-Control": "max-age=0, stale-while-revalidate=60"}, "old"), nil)
+
+	client := newCacheTestRequest("/feed.json", nil)
+	cached, weblog := load(client)
+	if cached == nil || cached.Header.Get("X-Cache") != "STALE" || readCacheBody(t, cached) != "old" {
+		t.Fatalf("宽限期内应先返回旧内容, 实际 %v", cached)
+	}
+	if weblog.CacheRevalidate == nil || !weblog.CacheRevalidate.Background {
+		t.Fatalf("应安排后台刷新")
+	}
+	if again, other := load(newCacheTestRequest("/feed.json", nil)); again == nil || other.CacheRevalidate != nil {
+		t.Fatalf("同一个键同时只应安排一次后台刷新")
+	}
+
+	req, refreshLog, done := RefreshRequest(client, weblog)
+	if req == nil || !refreshLog.CacheBackground || refreshLog.CacheRevalidate == nil || weblog.CacheRevalidate != nil {
+		t.Fatalf("后台刷新请求生成不正确")
+	}
+	if req.Context().Done() != nil {
+		t.Fatalf("后台刷新不应跟随客户端连接取消")
+	}
+	store(newOriginResponse(req, 200, map[string]string{"Cache-Control": "max-age=60"}, "new"), refreshLog)
+	done()
+
+	cached, _ = load(newCacheTestRequest("/feed.json", nil))
+	if cached == nil || readCacheBody(t, cached) != "new" {
+		t.Fatalf("后台刷新后应返回新内容")
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	store, load := cacheHttpTestEnv("http_sie", model.CacheRule{CacheTime: 60})
+	r := newCacheTestRequest("/index.html", nil)
+	store(newOriginResponse(r, 200, map[string]string{"Cache-Control": "max-age=0, stale-if-error=60"}, "old"), nil)
+
+	client := newCacheTestRequest("/index.html", nil)
+	cached, weblog := load(client)
+	if cached != nil || weblog.CacheRevalidate == nil {
+		t.Fatalf("过期条目应回源并保留旧内容备用")
+	}
+	origin := newOriginResponse(client, http.StatusBadGateway, nil, "bad gateway")
+	store(origin, weblog)
+	if origin.StatusCode != http.StatusOK || origin.Header.Get("X-Cache") != "STALE" || readCacheBody(t, origin) != "old" {
+		t.Fatalf("源站 5xx 时应返回旧内容, 实际 %d", origin.StatusCode)
+	}
+
+	// 连接失败时由引擎取旧内容
+	_, weblog = load(newCacheTestRequest("/index.html", nil))
+	if stale := StaleResponseOnError(weblog); stale == nil || readCacheBody(t, stale) != "old" {
+		t.Fatalf("回源失败时应返回旧内容")
+	}
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	setupTestEnv()
+	hostSafe := createTestHostSafe("http_coalesce", []model.CacheRule{{CacheTime: 60, RuleType: 2, RuleContent: "/"}})
+	cfg := createTestCacheConfig(1, "memory", "")
+
+	leaderReq := newCacheTestRequest("/hot.json", nil)
+	leader := &innerbean.WebLog{}
+	if LoadWebDataFormCache(httptest.NewRecorder(), leaderReq, hostSafe, cfg, leader) != nil || leader.CacheFlightKey == "" {
+		t.Fatalf("第一个未命中的请求应成为回源者")
+	}
+
+	result := make(chan *http.Response, 1)
+	go func() {
+		follower := &innerbean.WebLog{}
+		result <- LoadWebDataFormCache(httptest.NewRecorder(), newCacheTestRequest("/hot.json", nil), hostSafe, cfg, follower)
+	}()
+	select {
+	case <-result:
+		t.Fatalf("回源者写缓存前，同键请求应等待")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	StoreWebDataCache(newOriginResponse(leaderReq, 200, map[string]string{"Cache-Control": "max-age=60"}, "hot"), hostSafe, cfg, leader)
+	select {
+	case resp := <-result:
+		if resp == nil || readCacheBody(t, resp) != "hot" {
+			t.Fatalf("等待者应直接命中回源者写入的缓存")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("回源者写完缓存后等待者应被唤醒")
+	}
+	if leader.CacheFlightKey != "" {
+		t.Fatalf("回源结束后应释放")
+	}
+}
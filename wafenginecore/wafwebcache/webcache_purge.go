@@ -0,0 +1,276 @@
+package wafwebcache
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/model"
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存清理方式
+const (
+	PurgeTypeAll      = "all"      //整站
+	PurgeTypeURL      = "url"      //精确路径（含参数）
+	PurgeTypePrefix   = "prefix"   //路径前缀
+	PurgeTypeWildcard = "wildcard" //通配符，* 任意字符，? 单个字符
+	PurgeTypeTag      = "tag"      //源站 Cache-Tag / Surrogate-Key 标签
+)
+
+const indexPruneEvery = 1024 //每登记多少个键顺带清一次索引里已过期的项
+
+// entryMeta 缓存条目在索引里的信息
+type entryMeta struct {
+	url    string
+	tags   []string
+	marker bool //Vary 标记，不算作缓存条目
+}
+
+type indexItem struct {
+	entryMeta
+	expire int64 //0 表示长期
+}
+
+// cacheIndex 缓存键索引：按网站记录每个键对应的请求路径与标签，按前缀/标签清理时不用遍历缓存目录。
+// 进程重启后内存缓存为空，文件缓存在第一次清理该网站时扫描一遍目录补进索引。
+type cacheIndex struct {
+	mu      sync.Mutex
+	hosts   map[string]map[string]*indexItem
+	scanned map[string]bool
+	adds    int //登记次数，按次数而不是索引大小触发清理：同一个键反复登记时索引大小不变，永远到不了整数倍
+}
+
+var webCacheIndex = newCacheIndex()
+
+func newCacheIndex() *cacheIndex {
+	return &cacheIndex{hosts: map[string]map[string]*indexItem{}, scanned: map[string]bool{}}
+}
+
+func (idx *cacheIndex) add(hostCode string, key string, meta entryMeta, timeout int) {
+	now := time.Now().Unix()
+	expire := int64(0)
+	if timeout > 0 {
+		expire = now + int64(timeout)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	items := idx.hosts[hostCode]
+	if items == nil {
+		items = map[string]*indexItem{}
+		idx.hosts[hostCode] = items
+	}
+	items[key] = &indexItem{entryMeta: meta, expire: expire}
+	idx.adds++
+	if idx.adds%indexPruneEvery == 0 {
+		for _, hostItems := range idx.hosts {
+			for k, item := range hostItems {
+				if item.expire != 0 && item.expire <= now {
+					delete(hostItems, k)
+				}
+			}
+		}
+	}
+}
+
+// scanDir 把进程启动前就存在的文件缓存补进索引，每个目录只扫描一次
+func (idx *cacheIndex) scanDir(hostCode string, dir string) {
+	if dir == "" {
+		return
+	}
+	scanKey := dir + "|" + hostCode
+	idx.mu.Lock()
+	done := idx.scanned[scanKey]
+	idx.mu.Unlock()
+	if done {
+		return
+	}
+
+	found := map[string]*indexItem{}
+	matches, _ := filepath.Glob(filepath.Join(dir, hostCode, "*.cache"))
+	for _, file := range matches {
+		parts := strings.Split(filepath.Base(file), ".")
+		if len(parts) < 3 {
+			continue
+		}
+		expire, err := strconv.ParseInt(parts[len(parts)-2], 10, 64)
+		if err != nil {
+			continue
+		}
+		meta, err := readFileMeta(file)
+		if err != nil {
+			zlog.Debug(fmt.Sprintf("读取缓存文件信息失败 文件路径: %s, 错误: %v", file, err))
+			continue
+		}
+		found[parts[0]] = &indexItem{entryMeta: meta, expire: expire}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	items := idx.hosts[hostCode]
+	if items == nil {
+		items = map[string]*indexItem{}
+		idx.hosts[hostCode] = items
+	}
+	for key, item := range found {
+		// 进程内登记过的更新，以它为准
+		if _, ok := items[key]; !ok {
+			items[key] = item
+		}
+	}
+	idx.scanned[scanKey] = true
+}
+
+// readFileMeta 只读缓存文件的头部取出路径与标签
+func readFileMeta(file string) (entryMeta, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return entryMeta{}, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	head, err := reader.Peek(len(varyMarker))
+	if err == nil && string(head) == varyMarker {
+		// 标记只有两行，很短
+		data := make([]byte, 4096)
+		n, _ := reader.Read(data)
+		_, u, _ := parseVaryMarker(data[:n])
+		return entryMeta{url: u, marker: true}, nil
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return entryMeta{}, err
+	}
+	meta := entryMeta{url: resp.Header.Get(headerURL)}
+	if tags := resp.Header.Get(headerTags); tags != "" {
+		meta.tags = strings.Split(tags, ",")
+	}
+	return meta, nil
+}
+
+// take 取出并移出索引中符合条件的键
+func (idx *cacheIndex) take(hostCode string, match func(*indexItem) bool) map[string]*indexItem {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	taken := map[string]*indexItem{}
+	for key, item := range idx.hosts[hostCode] {
+		if match(item) {
+			taken[key] = item
+			delete(idx.hosts[hostCode], key)
+		}
+	}
+	return taken
+}
+
+// Purge 清理网站缓存，内存和文件两处都清，返回清掉的缓存条目数
+func Purge(hostCode string, cacheConfig model.CacheConfig, purgeType string, values []string) (int, error) {
+	match, err := purgeMatcher(purgeType, values)
+	if err != nil {
+		return 0, err
+	}
+	webCacheIndex.scanDir(hostCode, cacheConfig.CacheDir)
+
+	removed := 0
+	for key, item := range webCacheIndex.take(hostCode, match) {
+		hit := false
+		if global.GCACHE_WAFCACHE != nil {
+			cacheKey := enums.CACHE_WEBFILE + hostCode + key
+			if global.GCACHE_WAFCACHE.IsKeyExist(cacheKey) {
+				global.GCACHE_WAFCACHE.Remove(cacheKey)
+				hit = true
+			}
+		}
+		if cacheConfig.CacheDir != "" {
+			files, _ := filepath.Glob(filepath.Join(cacheConfig.CacheDir, hostCode, key+".*.cache"))
+			for _, file := range files {
+				if os.Remove(file) == nil {
+					hit = true
+				}
+			}
+		}
+		if hit && !item.marker {
+			removed++
+		}
+	}
+	zlog.Info(fmt.Sprintf("清理网站缓存 主机代码: %s, 方式: %s, 条件: %v, 清理条目数: %d", hostCode, purgeType, values, removed))
+	return removed, nil
+}
+
+// purgeMatcher 按清理方式生成匹配函数
+func purgeMatcher(purgeType string, values []string) (func(*indexItem) bool, error) {
+	var list []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	if purgeType == PurgeTypeAll {
+		return func(*indexItem) bool { return true }, nil
+	}
+	if len(list) == 0 {
+		return nil, errors.New("请填写要清理的路径或标签")
+	}
+	switch purgeType {
+	case PurgeTypeURL, PurgeTypePrefix:
+		for i, v := range list {
+			list[i] = purgePath(v)
+		}
+		exact := purgeType == PurgeTypeURL
+		return func(item *indexItem) bool {
+			for _, v := range list {
+				if item.url == v || (!exact && strings.HasPrefix(item.url, v)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case PurgeTypeWildcard:
+		var patterns []*regexp.Regexp
+		for _, v := range list {
+			expr := regexp.QuoteMeta(purgePath(v))
+			expr = strings.ReplaceAll(expr, `\*`, ".*")
+			expr = strings.ReplaceAll(expr, `\?`, ".")
+			patterns = append(patterns, regexp.MustCompile("^"+expr+"$"))
+		}
+		return func(item *indexItem) bool {
+			for _, p := range patterns {
+				if p.MatchString(item.url) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case PurgeTypeTag:
+		return func(item *indexItem) bool {
+			for _, tag := range item.tags {
+				for _, v := range list {
+					if strings.EqualFold(tag, v) {
+						return true
+					}
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的清理方式: %s", purgeType)
+}
+
+// purgePath 完整 URL 只取路径和参数部分，与缓存时记录的一致
+func purgePath(v string) string {
+	if strings.Contains(v, "://") {
+		if u, err := url.Parse(v); err == nil {
+			return u.RequestURI()
+		}
+	}
+	return v
+}
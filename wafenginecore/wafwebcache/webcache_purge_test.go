@@ -0,0 +1,130 @@
+package wafwebcache
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPurge(t *testing.T) {
+	setupTestEnv()
+	tempDir, err := os.MkdirTemp("", "webcache_purge_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer cleanupTestEnv(tempDir)
+
+	hostCode := "purge_host"
+	hostSafe := createTestHostSafe(hostCode, []model.CacheRule{{CacheTime: 60, RuleType: 2, RuleContent: "/"}})
+	cfg := createTestCacheConfig(1, "all", tempDir)
+	fill := func() {
+		for uri, tag := range map[string]string{
+			"/static/a.js":     "js, release-1",
+			"/static/b.css":    "css",
+			"/img/logo.png":    "img release-1",
+			"/api/list?page=1": "",
+		} {
+			r := newCacheTestRequest(uri, nil)
+			header := map[string]string{"Cache-Control": "max-age=60"}
+			if tag != "" {
+				header["Cache-Tag"] = tag
+			}
+			StoreWebDataCache(newOriginResponse(r, 200, header, "x"), hostSafe, cfg, &innerbean.WebLog{})
+		}
+	}
+	cached := func(uri string) bool {
+		r := httptest.NewRequest("GET", uri, nil)
+		weblog := &innerbean.WebLog{}
+		defer ReleaseFlight(weblog)
+		return LoadWebDataFormCache(httptest.NewRecorder(), r, hostSafe, cfg, weblog) != nil
+	}
+
+	cases := []struct {
+		purgeType string
+		values    []string
+		removed   int
+		gone      []string
+		kept      []string
+	}{
+		{PurgeTypeURL, []string{"http://example.com/api/list?page=1"}, 1, []string{"/api/list?page=1"}, []string{"/static/a.js"}},
+		{PurgeTypePrefix, []string{"/static/"}, 2, []string{"/static/a.js", "/static/b.css"}, []string{"/img/logo.png"}},
+		{PurgeTypeWildcard, []string{"/*.png"}, 1, []string{"/img/logo.png"}, []string{"/static/b.css"}},
+		{PurgeTypeTag, []string{"RELEASE-1"}, 2, []string{"/static/a.js", "/img/logo.png"}, []string{"/static/b.css"}},
+		{PurgeTypeAll, nil, 4, []string{"/static/b.css", "/api/list?page=1"}, nil},
+	}
+	for _, c := range cases {
+		fill()
+		removed, err := Purge(hostCode, cfg, c.purgeType, c.values)
+		if err != nil {
+			t.Fatalf("%s: 清理失败: %v", c.purgeType, err)
+		}
+		if removed != c.removed {
+			t.Errorf("%s: 期望清理 %d 条, 实际 %d", c.purgeType, c.removed, removed)
+		}
+		for _, uri := range c.gone {
+			if cached(uri) {
+				t.Errorf("%s: %s 应已被清理", c.purgeType, uri)
+			}
+		}
+		for _, uri := range c.kept {
+			if !cached(uri) {
+				t.Errorf("%s: %s 不应被清理", c.purgeType, uri)
+			}
+		}
+	}
+
+	if _, err := Purge(hostCode, cfg, PurgeTypePrefix, []string{" "}); err == nil {
+		t.Errorf("空条件应报错")
+	}
+	if _, err := Purge(hostCode, cfg, "regex", []string{"/a"}); err == nil {
+		t.Errorf("不支持的方式应报错")
+	}
+}
+
+func TestPurgeRebuildsIndexFromFiles(t *testing.T) {
+	setupTestEnv()
+	tempDir, err := os.MkdirTemp("", "webcache_purge_scan")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer cleanupTestEnv(tempDir)
+
+	hostCode := "purge_scan_host"
+	hostSafe := createTestHostSafe(hostCode, []model.CacheRule{{CacheTime: 60, RuleType: 2, RuleContent: "/"}})
+	cfg := createTestCacheConfig(1, "file", tempDir)
+	r := newCacheTestRequest("/doc/a.html", map[string]string{"Accept-Language": "zh"})
+	StoreWebDataCache(newOriginResponse(r, 200, map[string]string{"Vary": "Accept-Language", "Surrogate-Key": "docs"}, "x"), hostSafe, cfg, &innerbean.WebLog{})
+
+	// 模拟重启：索引清空，只剩磁盘上的文件
+	webCacheIndex = newCacheIndex()
+	removed, err := Purge(hostCode, cfg, PurgeTypeTag, []string{"docs"})
+	if err != nil || removed != 1 {
+		t.Fatalf("期望按标签清理 1 条, 实际 %d, 错误 %v", removed, err)
+	}
+	removed, _ = Purge(hostCode, cfg, PurgeTypePrefix, []string{"/doc/"})
+	if removed != 0 {
+		t.Fatalf("Vary 标记不应计入清理条目数, 实际 %d", removed)
+	}
+}
+
+// 同一个键反复登记时索引大小不变，清理要按登记次数触发
+func TestCacheIndexPruneByAddCount(t *testing.T) {
+	idx := newCacheIndex()
+	for i := 0; i < 10; i++ {
+		idx.add("h1", fmt.Sprintf("old%d", i), entryMeta{url: "/old"}, 60)
+		idx.hosts["h1"][fmt.Sprintf("old%d", i)].expire = time.Now().Unix() - 1
+	}
+	for i := 0; i < indexPruneEvery; i++ {
+		idx.add("h2", "hot", entryMeta{url: "/hot"}, 60)
+	}
+	if n := len(idx.hosts["h1"]); n != 0 {
+		t.Fatalf("已过期的索引项应被清理，剩余 %d", n)
+	}
+	if _, ok := idx.hosts["h2"]["hot"]; !ok {
+		t.Fatal("未过期的索引项不应被清理")
+	}
+}
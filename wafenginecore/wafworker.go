@@ -9,7 +9,11 @@ import (
 	"SamWaf/model/wafenginmodel"
 	"SamWaf/service/waf_service"
 	"SamWaf/utils"
+	"SamWaf/wafbot"
+	"SamWaf/wafenginecore/grpcinspect"
 	"SamWaf/wafenginecore/loadbalance"
+	"SamWaf/wafenginecore/wafapispec"
+	"SamWaf/wafenginecore/wafyara"
 	"SamWaf/wafproxy"
 	"SamWaf/webplugin"
 	"context"
@@ -18,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -153,7 +158,10 @@ func (waf *WafEngine) LoadHost(inHost model.Hosts) []innerbean.ServerRunTime {
 	//查询ip限流(应该针对一个网址只有一个)
 	var anticcBean model.AntiCC
 
-	global.GWAF_LOCAL_DB.Where("host_code=? ", inHost.Code).Limit(1).Find(&anticcBean)
+	global.GWAF_LOCAL_DB.Where("host_code=? and (limit_key='' or limit_key is null)", inHost.Code).Limit(1).Find(&anticcBean)
+	//查询按键限流(一个网址可以有多条)
+	var anticcKeyedList []model.AntiCC
+	global.GWAF_LOCAL_DB.Where("host_code=? and limit_key<>''", inHost.Code).Order("create_time").Find(&anticcKeyedList)
 
 	//初始化插件-ip计数器
 	var pluginIpRateLimiter *webplugin.IPRateLimiter
@@ -219,8 +227,9 @@ func (waf *WafEngine) LoadHost(inHost model.Hosts) []innerbean.ServerRunTime {
 			} else if blockingPageList[i].BlockingType == "other_block" {
 				// other_block 类型根据 response_code 区分不同的错误页面
 				// 例如: 403(WAF拦截), 404, 500, 502 等
+				// 非 html 格式的页面键为 "响应码@格式"，见 model.BlockingPageKey
 				if blockingPageList[i].ResponseCode != "" {
-					blockingPageMap[blockingPageList[i].ResponseCode] = blockingPageList[i]
+					blockingPageMap[model.BlockingPageKey(blockingPageList[i].ResponseCode, blockingPageList[i].ContentType)] = blockingPageList[i]
 				}
 			}
 		}
@@ -237,6 +246,18 @@ func (waf *WafEngine) LoadHost(inHost model.Hosts) []innerbean.ServerRunTime {
 	var pathRuleList []model.HostPathRule
 	global.GWAF_LOCAL_DB.Where("host_code=? ", inHost.Code).Order("priority asc, create_time asc").Find(&pathRuleList)
 
+	//查询内置检测误报排除
+	var detectExclusionList []model.DetectExclusion
+	global.GWAF_LOCAL_DB.Where("host_code=? ", inHost.Code).Find(&detectExclusionList)
+
+	//查询接口规范并编译
+	var apiSpecList []model.ApiSpec
+	global.GWAF_LOCAL_DB.Where("host_code=? ", inHost.Code).Find(&apiSpecList)
+	apiSpecs, apiSpecErrs := wafapispec.CompileList(apiSpecList)
+	for _, specErr := range apiSpecErrs {
+		zlog.Error("加载接口规范", zap.String("host", inHost.Host), zap.Error(specErr))
+	}
+
 	//解析静态站点安全配置（供路径规则静态文件服务共享使用）
 	var staticCfg model.StaticSiteConfig
 	if inHost.StaticSiteJSON != "" {
@@ -258,6 +279,7 @@ func (waf *WafEngine) LoadHost(inHost model.Hosts) []innerbean.ServerRunTime {
 		RuleVersionSum:      vcnt,
 		Host:                inHost,
 		PluginIpRateLimiter: pluginIpRateLimiter,
+		SpiderLimiter:       buildSpiderLimiter(inHost.SpiderPolicyJSON),
 		IPWhiteLists:        ipwhitelist,
 		IPWhiteIndex:        BuildIPAllowIndex(ipwhitelist),
 		IPWhiteGroupCodes:   ExtractAllowGroupCodes(ipwhitelist),
@@ -268,11 +290,14 @@ func (waf *WafEngine) LoadHost(inHost model.Hosts) []innerbean.ServerRunTime {
 		IPBlockGroupCodes:   ExtractBlockGroupCodes(ipblocklist),
 		UrlBlockLists:       urlblocklist,
 		AntiCCBean:          anticcBean,
+		CCKeyedLimiters:     BuildCCKeyedLimiters(anticcKeyedList),
 		HttpAuthBases:       httpAuthList,
 		BlockingPage:        blockingPageMap,
 		CacheRule:           cacheRuleList,
 		TamperRules:         tamperRuleList,
 		PathRules:           pathRuleList,
+		DetectExclusions:    detectExclusionList,
+		ApiSpecs:            apiSpecs,
 		StaticConfig:        staticCfg,
 	}
 	// 路由表(RCU)：在 writeMu 下克隆当前快照→在副本上登记本 host→原子发布。
@@ -466,6 +491,42 @@ func (waf *WafEngine) RemoveHost(host model.Hosts) {
 	waf.RemovePortServer()
 }
 
+// ReLoadSpiderBot 加载爬虫库
+func (waf *WafEngine) ReLoadSpiderBot() {
+	var list []model.SpiderBot
+	global.GWAF_LOCAL_DB.Where("status = ?", 1).Find(&list)
+	registry, errs := wafbot.BuildRegistry(list, filepath.Join(utils.GetCurrentDir(), "data", "spiderbot"))
+	for _, err := range errs {
+		zlog.Warn("爬虫库", err.Error())
+	}
+	wafbot.SetRegistry(registry)
+	zlog.Debug("爬虫库已加载", zap.Int("count", registry.Len()))
+}
+
+// ReLoadYara 编译已启用的 YARA 规则集并原子替换，进行中的扫描继续用旧规则
+func (waf *WafEngine) ReLoadYara() {
+	var list []model.YaraRuleSet
+	global.GWAF_LOCAL_DB.Where("status = ?", 1).Order("create_time asc").Find(&list)
+	rules, errs := wafyara.Build(list)
+	for _, err := range errs {
+		zlog.Error("加载 YARA 规则", zap.Error(err))
+	}
+	wafyara.SetRules(rules)
+	zlog.Debug("YARA 规则已加载", zap.Int("count", rules.Len()))
+}
+
+// ReLoadGrpcDescriptors 解析已启用的 gRPC 描述文件并原子替换
+func (waf *WafEngine) ReLoadGrpcDescriptors() {
+	var list []model.GrpcDescriptorSet
+	global.GWAF_LOCAL_DB.Where("status = ?", 1).Order("create_time asc").Find(&list)
+	registry, errs := grpcinspect.Build(list)
+	for _, err := range errs {
+		zlog.Error("加载 gRPC 描述文件", zap.Error(err))
+	}
+	grpcinspect.SetRegistry(registry)
+	zlog.Debug("gRPC 描述文件已加载", zap.Int("methods", registry.Len()))
+}
+
 // ReLoadSensitive 加载敏感词
 func (waf *WafEngine) ReLoadSensitive() {
 	//敏感词处理
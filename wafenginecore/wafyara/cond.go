@@ -0,0 +1,644 @@
+package wafyara
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// value 条件求值结果；undef 对应 YARA 的 undefined(如越界读取)，参与比较恒为假
+type value struct {
+	isInt bool
+	undef bool
+	b     bool
+	i     int64
+}
+
+func boolVal(b bool) value { return value{b: b} }
+func intVal(i int64) value { return value{isInt: true, i: i} }
+
+var undefVal = value{undef: true}
+
+func (v value) truthy() bool {
+	if v.undef {
+		return false
+	}
+	if v.isInt {
+		return v.i != 0
+	}
+	return v.b
+}
+
+type node interface {
+	eval(c *evalCtx) value
+}
+
+// evalCtx 一次扫描中一个规则集的求值上下文
+type evalCtx struct {
+	d       *scanData
+	rule    *rule
+	hits    map[*stringDef][]hit
+	results map[string]bool //同一规则集内已求值的规则，供条件里引用其它规则
+}
+
+func (c *evalCtx) hitsOf(s *stringDef) []hit {
+	h, ok := c.hits[s]
+	if !ok {
+		h = s.m.find(c.d)
+		c.hits[s] = h
+	}
+	return h
+}
+
+type (
+	boolNode  bool
+	intNode   int64
+	fileSize  struct{}
+	notNode   struct{ x node }
+	negNode   struct{ x node }
+	logicNode struct {
+		and  bool
+		l, r node
+	}
+	binNode struct {
+		op   string
+		l, r node
+	}
+	// $a / $a at N / $a in (lo..hi)
+	strNode struct {
+		s      *stringDef
+		at     node
+		lo, hi node
+	}
+	countNode  struct{ s *stringDef } // #a
+	offsetNode struct {               // @a[i]
+		s   *stringDef
+		idx node
+	}
+	lengthNode struct { // !a[i]
+		s   *stringDef
+		idx node
+	}
+	readIntNode struct { // uint8/16/32[be](off)
+		size int
+		be   bool
+		off  node
+	}
+	// any/all/none/N of (them | $a, $b*)
+	ofNode struct {
+		quant string
+		n     node
+		set   []*stringDef
+	}
+	ruleNode struct{ name string }
+)
+
+func (n boolNode) eval(*evalCtx) value { return boolVal(bool(n)) }
+func (n intNode) eval(*evalCtx) value  { return intVal(int64(n)) }
+func (fileSize) eval(c *evalCtx) value { return intVal(int64(len(c.d.data))) }
+
+func (n notNode) eval(c *evalCtx) value {
+	v := n.x.eval(c)
+	if v.undef {
+		return undefVal
+	}
+	return boolVal(!v.truthy())
+}
+
+func (n negNode) eval(c *evalCtx) value {
+	v := n.x.eval(c)
+	if v.undef || !v.isInt {
+		return undefVal
+	}
+	return intVal(-v.i)
+}
+
+func (n logicNode) eval(c *evalCtx) value {
+	l := n.l.eval(c).truthy()
+	if n.and && !l {
+		return boolVal(false)
+	}
+	if !n.and && l {
+		return boolVal(true)
+	}
+	return boolVal(n.r.eval(c).truthy())
+}
+
+func (n binNode) eval(c *evalCtx) value {
+	l, r := n.l.eval(c), n.r.eval(c)
+	if l.undef || r.undef {
+		if isCompare(n.op) {
+			return boolVal(false)
+		}
+		return undefVal
+	}
+	li, ri := l.i, r.i
+	if !l.isInt {
+		li = b2i(l.b)
+	}
+	if !r.isInt {
+		ri = b2i(r.b)
+	}
+	switch n.op {
+	case "==":
+		return boolVal(li == ri)
+	case "!=":
+		return boolVal(li != ri)
+	case "<":
+		return boolVal(li < ri)
+	case "<=":
+		return boolVal(li <= ri)
+	case ">":
+		return boolVal(li > ri)
+	case ">=":
+		return boolVal(li >= ri)
+	case "+":
+		return intVal(li + ri)
+	case "-":
+		return intVal(li - ri)
+	case "*":
+		return intVal(li * ri)
+	case "\\", "%":
+		if ri == 0 {
+			return undefVal
+		}
+		if n.op == "%" {
+			return intVal(li % ri)
+		}
+		return intVal(li / ri)
+	case "&":
+		return intVal(li & ri)
+	case "|":
+		return intVal(li | ri)
+	case "^":
+		return intVal(li ^ ri)
+	}
+	return undefVal
+}
+
+func isCompare(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (n strNode) eval(c *evalCtx) value {
+	hits := c.hitsOf(n.s)
+	switch {
+	case n.at != nil:
+		at := n.at.eval(c)
+		if at.undef {
+			return boolVal(false)
+		}
+		for _, h := range hits {
+			if int64(h.off) == at.i {
+				return boolVal(true)
+			}
+		}
+		return boolVal(false)
+	case n.lo != nil:
+		lo, hi := n.lo.eval(c), n.hi.eval(c)
+		if lo.undef || hi.undef {
+			return boolVal(false)
+		}
+		for _, h := range hits {
+			if int64(h.off) >= lo.i && int64(h.off) <= hi.i {
+				return boolVal(true)
+			}
+		}
+		return boolVal(false)
+	}
+	return boolVal(len(hits) > 0)
+}
+
+func (n countNode) eval(c *evalCtx) value { return intVal(int64(len(c.hitsOf(n.s)))) }
+
+// nthHit @a[i] / !a[i] 的 i 从 1 开始，省略时为 1
+func nthHit(c *evalCtx, s *stringDef, idx node) (hit, bool) {
+	i := int64(1)
+	if idx != nil {
+		v := idx.eval(c)
+		if v.undef {
+			return hit{}, false
+		}
+		i = v.i
+	}
+	hits := c.hitsOf(s)
+	if i < 1 || i > int64(len(hits)) {
+		return hit{}, false
+	}
+	return hits[i-1], true
+}
+
+func (n offsetNode) eval(c *evalCtx) value {
+	h, ok := nthHit(c, n.s, n.idx)
+	if !ok {
+		return undefVal
+	}
+	return intVal(int64(h.off))
+}
+
+func (n lengthNode) eval(c *evalCtx) value {
+	h, ok := nthHit(c, n.s, n.idx)
+	if !ok {
+		return undefVal
+	}
+	return intVal(int64(h.len))
+}
+
+func (n readIntNode) eval(c *evalCtx) value {
+	off := n.off.eval(c)
+	data := c.d.data
+	if off.undef || off.i < 0 || off.i+int64(n.size) > int64(len(data)) {
+		return undefVal
+	}
+	b := data[off.i : off.i+int64(n.size)]
+	switch n.size {
+	case 1:
+		return intVal(int64(b[0]))
+	case 2:
+		if n.be {
+			return intVal(int64(binary.BigEndian.Uint16(b)))
+		}
+		return intVal(int64(binary.LittleEndian.Uint16(b)))
+	default:
+		if n.be {
+			return intVal(int64(binary.BigEndian.Uint32(b)))
+		}
+		return intVal(int64(binary.LittleEndian.Uint32(b)))
+	}
+}
+
+func (n ofNode) eval(c *evalCtx) value {
+	need := int64(0)
+	switch n.quant {
+	case "all":
+		need = int64(len(n.set))
+	case "any":
+		need = 1
+	case "none":
+	default:
+		v := n.n.eval(c)
+		if v.undef {
+			return boolVal(false)
+		}
+		need = v.i
+	}
+	matched := int64(0)
+	for _, s := range n.set {
+		if len(c.hitsOf(s)) > 0 {
+			matched++
+			if n.quant == "none" {
+				return boolVal(false)
+			}
+			if n.quant != "all" && matched >= need {
+				return boolVal(true)
+			}
+		}
+	}
+	if n.quant == "none" {
+		return boolVal(true)
+	}
+	return boolVal(matched >= need)
+}
+
+func (n ruleNode) eval(c *evalCtx) value { return boolVal(c.results[n.name]) }
+
+// condParser 条件表达式，优先级从低到高：or、and、not、比较、位运算、加减、乘除、一元负号
+type condParser struct {
+	p     *parser
+	rule  *rule
+	rules map[string]*rule //之前定义过的规则，条件里可以按名字引用
+}
+
+func (cp *condParser) parseExpr() (node, error) {
+	l, err := cp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for cp.keyword("or") {
+		r, err := cp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (cp *condParser) parseAnd() (node, error) {
+	l, err := cp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for cp.keyword("and") {
+		r, err := cp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (cp *condParser) parseNot() (node, error) {
+	if cp.keyword("not") {
+		x, err := cp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return cp.parseCmp()
+}
+
+func (cp *condParser) parseCmp() (node, error) {
+	l, err := cp.parseBit()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if cp.p.accept(op) {
+			r, err := cp.parseBit()
+			if err != nil {
+				return nil, err
+			}
+			return binNode{op: op, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (cp *condParser) parseBit() (node, error) {
+	l, err := cp.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		switch cp.p.peek() {
+		case '&', '^':
+			op = string(cp.p.src[cp.p.pos])
+		case '|':
+			op = "|"
+		}
+		if op == "" {
+			return l, nil
+		}
+		cp.p.pos++
+		r, err := cp.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: op, l: l, r: r}
+	}
+}
+
+func (cp *condParser) parseAdd() (node, error) {
+	l, err := cp.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		c := cp.p.peek()
+		if c != '+' && c != '-' {
+			return l, nil
+		}
+		cp.p.pos++
+		r, err := cp.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: string(c), l: l, r: r}
+	}
+}
+
+func (cp *condParser) parseMul() (node, error) {
+	l, err := cp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		c := cp.p.peek()
+		if c != '*' && c != '\\' && c != '%' {
+			return l, nil
+		}
+		cp.p.pos++
+		r, err := cp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: string(c), l: l, r: r}
+	}
+}
+
+func (cp *condParser) parseUnary() (node, error) {
+	if cp.p.peek() == '-' {
+		cp.p.pos++
+		x, err := cp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x}, nil
+	}
+	return cp.parsePrimary()
+}
+
+// keyword 下一个标识符是 kw 则消费
+func (cp *condParser) keyword(kw string) bool {
+	if cp.p.peekIdent() == kw {
+		cp.p.ident()
+		return true
+	}
+	return false
+}
+
+func (cp *condParser) parsePrimary() (node, error) {
+	p := cp.p
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		x, err := cp.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case c == '$':
+		p.pos++
+		s, err := cp.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		n := strNode{s: s}
+		if cp.keyword("at") {
+			if n.at, err = cp.parseAdd(); err != nil {
+				return nil, err
+			}
+		} else if cp.keyword("in") {
+			if n.lo, n.hi, err = cp.parseRange(); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case c == '#':
+		p.pos++
+		s, err := cp.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		return countNode{s}, nil
+	case c == '@' || c == '!':
+		p.pos++
+		s, err := cp.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		var idx node
+		if p.accept("[") {
+			if idx, err = cp.parseAdd(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+		}
+		if c == '@' {
+			return offsetNode{s: s, idx: idx}, nil
+		}
+		return lengthNode{s: s, idx: idx}, nil
+	case c >= '0' && c <= '9':
+		v, ok := p.number()
+		if !ok {
+			return nil, p.errorf("数字格式错误")
+		}
+		if cp.keyword("of") {
+			return cp.parseOf("", intNode(v))
+		}
+		return intNode(v), nil
+	}
+
+	id := p.ident()
+	switch id {
+	case "":
+		return nil, p.errorf("规则 %s 的条件有无法识别的内容", cp.rule.name)
+	case "true":
+		return boolNode(true), nil
+	case "false":
+		return boolNode(false), nil
+	case "filesize":
+		return fileSize{}, nil
+	case "any", "all", "none":
+		if !cp.keyword("of") {
+			return nil, p.errorf("%s 之后应为 of", id)
+		}
+		return cp.parseOf(id, nil)
+	case "uint8", "uint16", "uint32", "uint16be", "uint32be":
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		off, err := cp.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		size := map[string]int{"uint8": 1, "uint16": 2, "uint32": 4, "uint16be": 2, "uint32be": 4}[id]
+		return readIntNode{size: size, be: strings.HasSuffix(id, "be"), off: off}, nil
+	case "for", "entrypoint", "matches", "contains":
+		return nil, p.errorf("不支持 %s 表达式", id)
+	}
+	if cp.rules[id] == nil {
+		return nil, p.errorf("规则 %s 引用了未定义(或定义在其后)的规则 %s", cp.rule.name, id)
+	}
+	return ruleNode{name: id}, nil
+}
+
+// stringRef $ # @ ! 之后的字符串名
+func (cp *condParser) stringRef() (*stringDef, error) {
+	id := cp.p.ident()
+	s := cp.rule.stringByID(id)
+	if s == nil {
+		return nil, cp.p.errorf("规则 %s 引用了未定义的字符串 $%s", cp.rule.name, id)
+	}
+	return s, nil
+}
+
+// parseRange (lo..hi)
+func (cp *condParser) parseRange() (node, node, error) {
+	if err := cp.p.expect('('); err != nil {
+		return nil, nil, err
+	}
+	lo, err := cp.parseAdd()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cp.p.accept("..") {
+		return nil, nil, cp.p.errorf("范围应写成 (起..止)")
+	}
+	hi, err := cp.parseAdd()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cp.p.expect(')'); err != nil {
+		return nil, nil, err
+	}
+	return lo, hi, nil
+}
+
+// parseOf of 之后的 them 或 ($a, $b*)
+func (cp *condParser) parseOf(quant string, n node) (node, error) {
+	of := ofNode{quant: quant, n: n}
+	if cp.keyword("them") {
+		of.set = cp.rule.strings
+	} else {
+		if err := cp.p.expect('('); err != nil {
+			return nil, err
+		}
+		for {
+			if err := cp.p.expect('$'); err != nil {
+				return nil, err
+			}
+			id := cp.p.ident()
+			if cp.p.accept("*") {
+				matched := false
+				for _, s := range cp.rule.strings {
+					if strings.HasPrefix(s.id, id) && (id == "" || !strings.HasPrefix(s.id, "\x00")) {
+						of.set = append(of.set, s)
+						matched = true
+					}
+				}
+				if !matched {
+					return nil, cp.p.errorf("规则 %s 中没有匹配 $%s* 的字符串", cp.rule.name, id)
+				}
+			} else {
+				s := cp.rule.stringByID(id)
+				if s == nil {
+					return nil, cp.p.errorf("规则 %s 引用了未定义的字符串 $%s", cp.rule.name, id)
+				}
+				of.set = append(of.set, s)
+			}
+			if !cp.p.accept(",") {
+				break
+			}
+		}
+		if err := cp.p.expect(')'); err != nil {
+			return nil, err
+		}
+	}
+	if len(of.set) == 0 {
+		return nil, cp.p.errorf("规则 %s 没有可供 of 使用的字符串", cp.rule.name)
+	}
+	return of, nil
+}
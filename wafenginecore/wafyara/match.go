@@ -0,0 +1,219 @@
+package wafyara
+
+import (
+	"bytes"
+	"regexp"
+)
+
+const (
+	maxMatchesPerString = 1000    // 每个字符串最多记录的命中数，#a 计数到此为止
+	maxHexSteps         = 1 << 22 // 单个十六进制串一次扫描的回溯步数上限，防止跳跃+分支组合退化成指数级；超过按扫描未完成处理
+)
+
+// hit 一次命中的偏移与长度
+type hit struct {
+	off int
+	len int
+}
+
+// scanData 一次扫描的输入，小写副本用到时才生成
+type scanData struct {
+	data  []byte
+	lower []byte
+	// incomplete 有十六进制串用完回溯步数没扫到结尾。不能当作没命中：
+	// 在真正的载荷前堆砌大量能部分匹配的前缀就能耗光步数，让规则静默失效
+	incomplete bool
+}
+
+// lowered ASCII 小写副本；不能用 bytes.ToLower，它按 UTF-8 处理，遇到非法字节会改变长度，偏移就对不上了
+func (d *scanData) lowered() []byte {
+	if d.lower == nil {
+		d.lower = asciiLower(d.data)
+	}
+	return d.lower
+}
+
+func asciiLower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// fullwordOK 命中前后不能紧挨字母数字；宽字符串跳过前后的 \x00 再看
+func fullwordOK(data []byte, off, end int, wide bool) bool {
+	before := off - 1
+	if wide && before >= 1 && data[before] == 0 {
+		before--
+	}
+	if before >= 0 && isWordByte(data[before]) {
+		return false
+	}
+	return end >= len(data) || !isWordByte(data[end])
+}
+
+type matcher interface {
+	find(d *scanData) []hit
+}
+
+// textMatcher 文本串；ascii/wide 都开时两种形式都找
+type textMatcher struct {
+	patterns [][]byte
+	wide     []bool
+	nocase   bool
+	fullword bool
+}
+
+func newTextMatcher(v []byte, nocase, wide, ascii, fullword bool) *textMatcher {
+	if nocase {
+		v = asciiLower(v)
+	}
+	m := &textMatcher{nocase: nocase, fullword: fullword}
+	if ascii {
+		m.patterns = append(m.patterns, v)
+		m.wide = append(m.wide, false)
+	}
+	if wide {
+		w := make([]byte, 0, len(v)*2)
+		for _, c := range v {
+			w = append(w, c, 0)
+		}
+		m.patterns = append(m.patterns, w)
+		m.wide = append(m.wide, true)
+	}
+	return m
+}
+
+func (m *textMatcher) find(d *scanData) []hit {
+	hay := d.data
+	if m.nocase {
+		hay = d.lowered()
+	}
+	var hits []hit
+	for i, pat := range m.patterns {
+		for off := 0; len(hits) < maxMatchesPerString; off++ {
+			idx := bytes.Index(hay[off:], pat)
+			if idx < 0 {
+				break
+			}
+			off += idx
+			if !m.fullword || fullwordOK(d.data, off, off+len(pat), m.wide[i]) {
+				hits = append(hits, hit{off: off, len: len(pat)})
+			}
+		}
+	}
+	return hits
+}
+
+// regexMatcher 正则串（RE2 语法），命中互不重叠
+type regexMatcher struct {
+	re       *regexp.Regexp
+	fullword bool
+}
+
+func (m *regexMatcher) find(d *scanData) []hit {
+	var hits []hit
+	for _, loc := range m.re.FindAllIndex(d.data, maxMatchesPerString) {
+		if loc[1] == loc[0] {
+			continue
+		}
+		if !m.fullword || fullwordOK(d.data, loc[0], loc[1], false) {
+			hits = append(hits, hit{off: loc[0], len: loc[1] - loc[0]})
+		}
+	}
+	return hits
+}
+
+// 十六进制串的元素
+const (
+	hexByte = iota // 按掩码比较一个字节，?? 的掩码为 0
+	hexJump        // 跳过 min..max 个任意字节，max=-1 表示不限
+	hexAlt         // 多个分支任一匹配
+)
+
+type hexTok struct {
+	kind      int
+	val, mask byte
+	min, max  int
+	alts      [][]hexTok
+}
+
+// hexMatcher 十六进制串，回溯匹配：Go 的 regexp 按 UTF-8 解码，\x80 以上的字节无法按原值匹配，所以不转正则
+type hexMatcher struct {
+	toks []hexTok
+}
+
+func (m *hexMatcher) find(d *scanData) []hit {
+	data := d.data
+	first := m.toks[0]
+	steps := 0
+	var hits []hit
+	for off := 0; off < len(data) && len(hits) < maxMatchesPerString && steps < maxHexSteps; off++ {
+		// 首字节确定时直接跳到下一个候选位置
+		if first.kind == hexByte && first.mask == 0xFF {
+			idx := bytes.IndexByte(data[off:], first.val)
+			if idx < 0 {
+				break
+			}
+			off += idx
+		}
+		if end, ok := matchHex(m.toks, data, off, &steps, func(end int) (int, bool) { return end, true }); ok {
+			hits = append(hits, hit{off: off, len: end - off})
+		}
+	}
+	if steps >= maxHexSteps {
+		d.incomplete = true
+	}
+	return hits
+}
+
+// matchHex 从 pos 开始匹配 toks，整段匹配完交给 k 继续(分支之后的部分)，用续延避免为每个分支拼接切片
+func matchHex(toks []hexTok, data []byte, pos int, steps *int, k func(int) (int, bool)) (int, bool) {
+	for len(toks) > 0 {
+		*steps++
+		if *steps > maxHexSteps {
+			return 0, false
+		}
+		t := toks[0]
+		switch t.kind {
+		case hexByte:
+			if pos >= len(data) || data[pos]&t.mask != t.val {
+				return 0, false
+			}
+			pos++
+			toks = toks[1:]
+		case hexJump:
+			rest := toks[1:]
+			max := t.max
+			if max < 0 || pos+max > len(data) {
+				max = len(data) - pos
+			}
+			for n := t.min; n <= max; n++ {
+				if end, ok := matchHex(rest, data, pos+n, steps, k); ok {
+					return end, true
+				}
+			}
+			return 0, false
+		case hexAlt:
+			rest := toks[1:]
+			for _, alt := range t.alts {
+				end, ok := matchHex(alt, data, pos, steps, func(p int) (int, bool) {
+					return matchHex(rest, data, p, steps, k)
+				})
+				if ok {
+					return end, true
+				}
+			}
+			return 0, false
+		}
+	}
+	return k(pos)
+}
@@ -0,0 +1,566 @@
+package wafyara
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parser 手写递归下降解析器，直接在源文本上按需取词：
+// 字符串段里 = 之后的 { 是十六进制串、/ 是正则，只有解析器知道上下文，所以不先整体分词
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("第%d行: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace 跳过空白与 // /* */ 注释
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+				return
+			}
+			p.line += strings.Count(p.src[p.pos:p.pos+2+end], "\n")
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) eof() bool {
+	p.skipSpace()
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// ident 读一个标识符，不是标识符时返回空
+func (p *parser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentByte(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// peekIdent 看下一个标识符但不消费
+func (p *parser) peekIdent() string {
+	save, line := p.pos, p.line
+	id := p.ident()
+	p.pos, p.line = save, line
+	return id
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("此处应为 %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// accept 下一个字符是 s 则消费
+func (p *parser) accept(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// quoted 读双引号字符串，支持 \" \\ \t \n \r \xHH 转义
+func (p *parser) quoted() (string, error) {
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\n':
+			return "", p.errorf("字符串未结束")
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("字符串未结束")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case '"', '\\':
+				b.WriteByte(e)
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					return "", p.errorf("\\x 转义不完整")
+				}
+				v, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					return "", p.errorf("\\x 转义不是十六进制")
+				}
+				b.WriteByte(byte(v))
+				p.pos += 2
+			default:
+				return "", p.errorf("不支持的转义 \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("字符串未结束")
+}
+
+// number 读十进制或 0x 十六进制整数，可带 KB/MB 后缀
+func (p *parser) number() (int64, bool) {
+	p.skipSpace()
+	start := p.pos
+	base := 10
+	if strings.HasPrefix(p.src[p.pos:], "0x") {
+		base = 16
+		p.pos += 2
+	}
+	digits := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if (c >= '0' && c <= '9') || (base == 16 && ((c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'))) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if p.pos == digits {
+		p.pos = start
+		return 0, false
+	}
+	v, err := strconv.ParseInt(p.src[digits:p.pos], base, 64)
+	if err != nil {
+		p.pos = start
+		return 0, false
+	}
+	if strings.HasPrefix(p.src[p.pos:], "KB") {
+		v *= 1024
+		p.pos += 2
+	} else if strings.HasPrefix(p.src[p.pos:], "MB") {
+		v *= 1024 * 1024
+		p.pos += 2
+	}
+	return v, true
+}
+
+// parseFile 解析整份规则文本
+func (p *parser) parseFile() ([]*rule, error) {
+	var rules []*rule
+	names := map[string]*rule{}
+	for !p.eof() {
+		kw := p.peekIdent()
+		switch kw {
+		case "import", "include":
+			p.ident()
+			return nil, p.errorf("不支持 %s（只支持字符串/十六进制/正则条件，不支持模块与文件包含）", kw)
+		case "rule", "private", "global":
+			r, err := p.parseRule(names)
+			if err != nil {
+				return nil, err
+			}
+			if names[r.name] != nil {
+				return nil, p.errorf("规则 %s 重复定义", r.name)
+			}
+			names[r.name] = r
+			rules = append(rules, r)
+		default:
+			return nil, p.errorf("此处应为 rule")
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("没有任何规则")
+	}
+	return rules, nil
+}
+
+func (p *parser) parseRule(defined map[string]*rule) (*rule, error) {
+	r := &rule{}
+	for {
+		kw := p.ident()
+		if kw == "private" {
+			r.private = true
+		} else if kw == "global" {
+			r.global = true
+		} else if kw == "rule" {
+			break
+		} else {
+			return nil, p.errorf("此处应为 rule")
+		}
+	}
+	r.name = p.ident()
+	if r.name == "" {
+		return nil, p.errorf("缺少规则名")
+	}
+	if p.accept(":") {
+		for p.peek() != '{' {
+			tag := p.ident()
+			if tag == "" {
+				return nil, p.errorf("规则 %s 的标签格式错误", r.name)
+			}
+			r.tags = append(r.tags, tag)
+		}
+	}
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	if p.peekIdent() == "meta" {
+		p.ident()
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if err := p.parseMeta(r); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekIdent() == "strings" {
+		p.ident()
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if err := p.parseStrings(r); err != nil {
+			return nil, err
+		}
+	}
+	if p.ident() != "condition" {
+		return nil, p.errorf("规则 %s 缺少 condition", r.name)
+	}
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+	cp := &condParser{p: p, rule: r, rules: defined}
+	cond, err := cp.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	r.cond = cond
+	if err := p.expect('}'); err != nil {
+		return nil, fmt.Errorf("%w（规则 %s 的条件有无法识别的内容）", err, r.name)
+	}
+	return r, nil
+}
+
+func (p *parser) parseMeta(r *rule) error {
+	r.meta = map[string]string{}
+	for {
+		kw := p.peekIdent()
+		if kw == "" || kw == "strings" || kw == "condition" {
+			return nil
+		}
+		p.ident()
+		if err := p.expect('='); err != nil {
+			return err
+		}
+		switch c := p.peek(); {
+		case c == '"':
+			v, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			r.meta[kw] = v
+		case c == '-' || (c >= '0' && c <= '9'):
+			neg := p.accept("-")
+			v, ok := p.number()
+			if !ok {
+				return p.errorf("meta %s 的值格式错误", kw)
+			}
+			if neg {
+				v = -v
+			}
+			r.meta[kw] = strconv.FormatInt(v, 10)
+		default:
+			v := p.ident()
+			if v != "true" && v != "false" {
+				return p.errorf("meta %s 的值格式错误", kw)
+			}
+			r.meta[kw] = v
+		}
+	}
+}
+
+func (p *parser) parseStrings(r *rule) error {
+	anon := 0
+	for p.peek() == '$' {
+		p.pos++
+		id := p.ident()
+		if id == "" {
+			anon++
+			id = fmt.Sprintf("\x00anon%d", anon) //匿名串只能通过 of them 引用，名字不会和用户写的冲突
+		} else if r.stringByID(id) != nil {
+			return p.errorf("规则 %s 的字符串 $%s 重复定义", r.name, id)
+		}
+		if err := p.expect('='); err != nil {
+			return err
+		}
+		s := &stringDef{id: id}
+		var err error
+		switch p.peek() {
+		case '"':
+			err = p.parseText(s)
+		case '{':
+			err = p.parseHex(s)
+		case '/':
+			err = p.parseRegex(s)
+		default:
+			err = p.errorf("$%s 的值应为 \"文本\"、{ 十六进制 } 或 /正则/", id)
+		}
+		if err != nil {
+			return err
+		}
+		r.strings = append(r.strings, s)
+	}
+	return nil
+}
+
+// modifiers 读字符串修饰符
+func (p *parser) modifiers(s *stringDef, allowed ...string) (map[string]bool, error) {
+	mods := map[string]bool{}
+	for {
+		kw := p.peekIdent()
+		switch kw {
+		case "nocase", "wide", "ascii", "fullword", "private":
+		case "xor", "base64", "base64wide":
+			return nil, p.errorf("$%s 不支持修饰符 %s", s.id, kw)
+		default:
+			return mods, nil
+		}
+		ok := false
+		for _, a := range allowed {
+			if a == kw {
+				ok = true
+			}
+		}
+		if !ok {
+			return nil, p.errorf("$%s 不能使用修饰符 %s", s.id, kw)
+		}
+		p.ident()
+		mods[kw] = true
+	}
+}
+
+func (p *parser) parseText(s *stringDef) error {
+	v, err := p.quoted()
+	if err != nil {
+		return err
+	}
+	if v == "" {
+		return p.errorf("$%s 不能为空串", s.id)
+	}
+	mods, err := p.modifiers(s, "nocase", "wide", "ascii", "fullword", "private")
+	if err != nil {
+		return err
+	}
+	s.private = mods["private"]
+	s.m = newTextMatcher([]byte(v), mods["nocase"], mods["wide"], mods["ascii"] || !mods["wide"], mods["fullword"])
+	return nil
+}
+
+func (p *parser) parseRegex(s *stringDef) error {
+	p.pos++ // 开头的 /
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return p.errorf("$%s 的正则未结束", s.id)
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.pos < len(p.src) && p.src[p.pos] == '/' {
+			c = '/'
+			p.pos++
+		}
+		b.WriteByte(c)
+	}
+	flags := ""
+	for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+		flags += string(p.src[p.pos])
+		p.pos++
+	}
+	mods, err := p.modifiers(s, "nocase", "ascii", "fullword", "private")
+	if err != nil {
+		return err
+	}
+	if mods["nocase"] && !strings.Contains(flags, "i") {
+		flags += "i"
+	}
+	expr := b.String()
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return p.errorf("$%s 的正则无法编译（语法为 RE2，不支持反向引用与环视）: %v", s.id, err)
+	}
+	s.private = mods["private"]
+	s.m = &regexMatcher{re: re, fullword: mods["fullword"]}
+	return nil
+}
+
+// parseHex 十六进制串：字节 4D、半字节通配 ?A/A?、整字节通配 ??、跳跃 [n] [n-m] [n-] [-]、分支 (AA|BB CC)
+func (p *parser) parseHex(s *stringDef) error {
+	p.pos++ // {
+	toks, err := p.hexSeq(s, false)
+	if err != nil {
+		return err
+	}
+	if len(toks) == 0 {
+		return p.errorf("$%s 的十六进制串为空", s.id)
+	}
+	if toks[0].kind == hexJump || toks[len(toks)-1].kind == hexJump {
+		return p.errorf("$%s 的十六进制串不能以跳跃开头或结尾", s.id)
+	}
+	mods, err := p.modifiers(s, "private")
+	if err != nil {
+		return err
+	}
+	s.private = mods["private"]
+	s.m = &hexMatcher{toks: toks}
+	return nil
+}
+
+// hexSeq 读到 }（顶层）或 | )（分支内）为止
+func (p *parser) hexSeq(s *stringDef, inAlt bool) ([]hexTok, error) {
+	var toks []hexTok
+	for {
+		c := p.peek()
+		switch {
+		case c == 0:
+			return nil, p.errorf("$%s 的十六进制串未结束", s.id)
+		case c == '}' && !inAlt:
+			p.pos++
+			return toks, nil
+		case (c == '|' || c == ')') && inAlt:
+			return toks, nil
+		case c == '[':
+			p.pos++
+			end := strings.IndexByte(p.src[p.pos:], ']')
+			if end < 0 {
+				return nil, p.errorf("$%s 的跳跃未结束", s.id)
+			}
+			jmp, err := parseJump(strings.TrimSpace(p.src[p.pos : p.pos+end]))
+			if err != nil {
+				return nil, p.errorf("$%s 的跳跃 [%s] %v", s.id, p.src[p.pos:p.pos+end], err)
+			}
+			p.pos += end + 1
+			toks = append(toks, jmp)
+		case c == '(':
+			p.pos++
+			alt := hexTok{kind: hexAlt}
+			for {
+				branch, err := p.hexSeq(s, true)
+				if err != nil {
+					return nil, err
+				}
+				if len(branch) == 0 {
+					return nil, p.errorf("$%s 的分支为空", s.id)
+				}
+				alt.alts = append(alt.alts, branch)
+				if p.peek() == ')' {
+					p.pos++
+					break
+				}
+				p.pos++ // |
+			}
+			toks = append(toks, alt)
+		default:
+			if p.pos+2 > len(p.src) {
+				return nil, p.errorf("$%s 的十六进制串未结束", s.id)
+			}
+			tok, ok := parseHexByte(p.src[p.pos], p.src[p.pos+1])
+			if !ok {
+				return nil, p.errorf("$%s 的十六进制串含无法识别的内容 %q", s.id, p.src[p.pos:p.pos+2])
+			}
+			p.pos += 2
+			toks = append(toks, tok)
+		}
+	}
+}
+
+func parseHexByte(hi, lo byte) (hexTok, bool) {
+	t := hexTok{kind: hexByte}
+	for i, c := range []byte{hi, lo} {
+		shift := uint(4 * (1 - i))
+		if c == '?' {
+			continue
+		}
+		v, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return t, false
+		}
+		t.val |= byte(v) << shift
+		t.mask |= 0xF << shift
+	}
+	return t, true
+}
+
+func parseJump(s string) (hexTok, error) {
+	t := hexTok{kind: hexJump, max: -1}
+	lo, hi, isRange := strings.Cut(s, "-")
+	lo, hi = strings.TrimSpace(lo), strings.TrimSpace(hi)
+	if lo != "" {
+		v, err := strconv.Atoi(lo)
+		if err != nil || v < 0 {
+			return t, fmt.Errorf("格式错误")
+		}
+		t.min = v
+	}
+	if !isRange {
+		if lo == "" {
+			return t, fmt.Errorf("格式错误")
+		}
+		t.max = t.min
+		return t, nil
+	}
+	if hi != "" {
+		v, err := strconv.Atoi(hi)
+		if err != nil || v < t.min {
+			return t, fmt.Errorf("格式错误")
+		}
+		t.max = v
+	}
+	return t, nil
+}
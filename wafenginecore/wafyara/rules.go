@@ -0,0 +1,202 @@
+// Package wafyara 纯 Go 实现的 YARA 规则子集，用于上传文件与请求体检测。
+//
+// 支持：文本串(nocase/wide/ascii/fullword/private)、十六进制串(?? 通配、半字节通配、[n-m] 跳跃、(a|b) 分支)、
+// 正则串(RE2 语法，i/s 标志)、meta、标签、private/global 规则；条件支持 and/or/not、比较与算术、
+// $a at N、$a in (a..b)、#a、@a[i]、!a[i]、filesize、uint8/16/32(be)、any/all/none/N of (them|$a,$b*)、引用前面定义的规则。
+// 不支持：import 模块(pe/elf/math…)、include、for 表达式、xor/base64 修饰符。
+package wafyara
+
+import (
+	"SamWaf/model"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+type rule struct {
+	name    string
+	tags    []string
+	meta    map[string]string
+	private bool //只供其它规则引用，命中不上报
+	global  bool //同一规则集内所有规则的前提，不满足时整个规则集都不命中
+	strings []*stringDef
+	cond    node
+}
+
+func (r *rule) stringByID(id string) *stringDef {
+	for _, s := range r.strings {
+		if s.id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+type stringDef struct {
+	id      string
+	private bool
+	m       matcher
+}
+
+// RuleSet 编译后的一个规则集
+type RuleSet struct {
+	Name   string
+	Action string
+	rules  []*rule
+}
+
+// Len 规则条数
+func (s *RuleSet) Len() int { return len(s.rules) }
+
+// Compile 编译规则文本，出错时返回带行号的错误
+func Compile(content string) (*RuleSet, error) {
+	p := &parser{src: content, line: 1}
+	rules, err := p.parseFile()
+	if err != nil {
+		return nil, err
+	}
+	return &RuleSet{rules: rules}, nil
+}
+
+// Match 一条命中
+type Match struct {
+	Set    string   //规则集名称
+	Rule   string   //规则名
+	Tags   []string //规则标签
+	Action string   //所属规则集的动作 block/log
+}
+
+// String 日志里的标识：规则集/规则名
+func (m Match) String() string {
+	return m.Set + "/" + m.Rule
+}
+
+// Scan 用一个规则集扫描数据，返回命中的非 private 规则
+func (s *RuleSet) Scan(data []byte) []Match {
+	return s.scan(&scanData{data: data})
+}
+
+func (s *RuleSet) scan(d *scanData) []Match {
+	ctx := &evalCtx{d: d, hits: map[*stringDef][]hit{}, results: map[string]bool{}}
+	// global 规则先求值，任何一条不满足则整个规则集不命中
+	for _, r := range s.rules {
+		if r.global {
+			ctx.rule = r
+			if !r.cond.eval(ctx).truthy() {
+				return nil
+			}
+			ctx.results[r.name] = true
+		}
+	}
+	var matches []Match
+	for _, r := range s.rules {
+		if r.global {
+			if !r.private {
+				matches = append(matches, Match{Set: s.Name, Rule: r.name, Tags: r.tags, Action: s.Action})
+			}
+			continue
+		}
+		ctx.rule = r
+		ok := r.cond.eval(ctx).truthy()
+		ctx.results[r.name] = ok
+		if ok && !r.private {
+			matches = append(matches, Match{Set: s.Name, Rule: r.name, Tags: r.tags, Action: s.Action})
+		}
+	}
+	return matches
+}
+
+// Rules 引擎当前生效的全部规则集
+type Rules struct {
+	sets []*RuleSet
+}
+
+// Len 规则总条数
+func (r *Rules) Len() int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, s := range r.sets {
+		n += s.Len()
+	}
+	return n
+}
+
+// ErrScanIncomplete 有十六进制串超过回溯步数上限，数据没有扫完，结果不能当作“没命中”
+var ErrScanIncomplete = errors.New("YARA 扫描超过回溯步数上限，未完成")
+
+// Scan 依次用每个规则集扫描，规则集之间互不引用；同一份数据的小写副本共用。
+// 没扫完时返回已得到的命中和 ErrScanIncomplete
+func (r *Rules) Scan(data []byte) ([]Match, error) {
+	if r == nil || len(data) == 0 {
+		return nil, nil
+	}
+	d := &scanData{data: data}
+	var matches []Match
+	for _, s := range r.sets {
+		matches = append(matches, s.scan(d)...)
+	}
+	if d.incomplete {
+		return matches, ErrScanIncomplete
+	}
+	return matches, nil
+}
+
+// HasBlock 是否有动作为拦截的规则集
+func (r *Rules) HasBlock() bool {
+	if r == nil {
+		return false
+	}
+	for _, s := range r.sets {
+		if s.Action == model.YaraActionBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// Build 编译已启用的规则集；编译失败的规则集跳过并返回错误，其余照常生效
+func Build(list []model.YaraRuleSet) (*Rules, []error) {
+	rules := &Rules{}
+	var errs []error
+	for _, item := range list {
+		if item.Status != 1 {
+			continue
+		}
+		set, err := Compile(item.Content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("YARA 规则集 %s: %w", item.Name, err))
+			continue
+		}
+		set.Name = item.Name
+		set.Action = item.Action
+		if set.Action != model.YaraActionLog {
+			set.Action = model.YaraActionBlock
+		}
+		rules.sets = append(rules.sets, set)
+	}
+	return rules, errs
+}
+
+var current atomic.Pointer[Rules]
+
+// CurrentRules 当前生效的规则，未加载时为 nil(Scan 对 nil 安全)
+func CurrentRules() *Rules {
+	return current.Load()
+}
+
+// SetRules 热替换规则，正在进行的扫描继续用旧规则
+func SetRules(r *Rules) {
+	current.Store(r)
+}
+
+// Names 命中列表拼成日志文本，一行一条
+func Names(matches []Match) string {
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.String())
+	}
+	return strings.Join(names, "\n")
+}
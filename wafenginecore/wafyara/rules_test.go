@@ -0,0 +1,213 @@
+package wafyara
+
+import (
+	"SamWaf/model"
+	"strings"
+	"testing"
+)
+
+const webshellRules = `
+/* 样例：安全团队维护的 webshell 规则 */
+rule php_eval_post : webshell php {
+    meta:
+        author = "sec"
+        score = 80
+    strings:
+        $php = "<?php" nocase
+        $eval = /(eval|assert)\s*\(\s*\$_(POST|GET|REQUEST)/ nocase
+    condition:
+        $php and $eval
+}
+
+rule pe_file {
+    condition:
+        uint16(0) == 0x5A4D and filesize < 1MB
+}
+
+rule hex_alt {
+    strings:
+        $h = { 4D 5A ?? [1-3] (90 | 91 92) ?F }
+    condition:
+        $h at 0
+}
+
+private rule has_cmd {
+    strings:
+        $a = "cmd.exe" wide ascii nocase
+    condition:
+        any of them
+}
+
+rule cmd_twice {
+    condition:
+        has_cmd
+}
+`
+
+func compileOK(t *testing.T, src string) *RuleSet {
+	t.Helper()
+	s, err := Compile(src)
+	if err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	return s
+}
+
+func names(ms []Match) string {
+	var out []string
+	for _, m := range ms {
+		out = append(out, m.Rule)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := map[string]string{
+		"模块":      `import "pe" rule a { condition: true }`,
+		"未定义字符串":  `rule a { strings: $a = "x" condition: $b }`,
+		"未定义规则":   `rule a { condition: b }`,
+		"跳跃开头":    `rule a { strings: $h = { [2] 4D } condition: $h }`,
+		"非法十六进制":  `rule a { strings: $h = { 4G } condition: $h }`,
+		"正则语法":    `rule a { strings: $r = /(?<=a)b/ condition: $r }`,
+		"缺少条件":    `rule a { strings: $a = "x" }`,
+		"重复规则":    `rule a { condition: true } rule a { condition: false }`,
+		"不支持for":  `rule a { strings: $a = "x" condition: for any i in (1..2): ($a) }`,
+		"不支持xor":  `rule a { strings: $a = "x" xor condition: $a }`,
+		"条件有多余内容": `rule a { condition: true true }`,
+		"空文本":     ``,
+	}
+	for name, src := range cases {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("%s: 应编译失败", name)
+		}
+	}
+	// 错误信息带行号
+	_, err := Compile("rule a {\n  strings:\n    $a = \"x\"\n  condition:\n    $b\n}")
+	if err == nil || !strings.Contains(err.Error(), "第5行") {
+		t.Errorf("错误信息应带行号，实际 %v", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := compileOK(t, webshellRules)
+	if s.Len() != 5 {
+		t.Fatalf("规则数 %d，期望 5", s.Len())
+	}
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"一句话木马", []byte("GIF89a<?PHP @EVAL($_POST['x']);?>"), "php_eval_post"},
+		{"正常php", []byte("<?php echo 'hi';"), ""},
+		{"PE头+十六进制分支", []byte{0x4D, 0x5A, 0x00, 0x01, 0x02, 0x91, 0x92, 0x3F}, "pe_file,hex_alt"},
+		{"PE头但十六进制不符", []byte{0x4D, 0x5A, 0x00, 0x01, 0x02, 0x93, 0x3F}, "pe_file"},
+		{"宽字符cmd，private不上报", []byte("c\x00m\x00d\x00.\x00e\x00x\x00e\x00"), "cmd_twice"},
+		{"大写cmd", []byte("run CMD.EXE /c"), "cmd_twice"},
+	}
+	for _, c := range cases {
+		if got := names(s.Scan(c.data)); got != c.want {
+			t.Errorf("%s: 命中 %q，期望 %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConditionOperators(t *testing.T) {
+	data := []byte("xx abc yy abc zz abcdef")
+	cases := map[string]bool{
+		`#a == 3`:                           true,
+		`#a > 3`:                            false,
+		`@a[2] == 10`:                       true,
+		`@a == 3`:                           true,
+		`!a[1] == 3`:                        true,
+		`@a[9] == 0`:                        false, // 越界 undefined
+		`not (@a[9] == 0)`:                  true,
+		`$a at 3`:                           true,
+		`$a at 4`:                           false,
+		`$a in (4..10)`:                     true,
+		`$a in (4..9)`:                      false,
+		`#w == 2`:                           true, // fullword：abcdef 里的 abc 不算
+		`$x`:                                false,
+		`2 of ($a, $b, $c)`:                 true,
+		`all of ($a, $b, $c)`:               false,
+		`none of ($c)`:                      true,
+		`any of ($a*)`:                      true,
+		`filesize == 23 and 1 + 2 * 3 == 7`: true,
+		`uint8(0) == 0x78 and uint16be(0) == 0x7878`: true,
+	}
+	for cond, want := range cases {
+		src := `rule r { strings: $a = "abc" $ab = "zz" $b = "yy" $c = "nope" $w = "abc" fullword condition: ` + cond + ` }`
+		if cond == "$x" { // 单词中间的片段不算 fullword 命中
+			src = `rule r { strings: $x = "bcd" fullword condition: $x }`
+		}
+		s := compileOK(t, src)
+		if got := len(s.Scan(data)) == 1; got != want {
+			t.Errorf("%s: %v，期望 %v", cond, got, want)
+		}
+	}
+}
+
+func TestGlobalRule(t *testing.T) {
+	s := compileOK(t, `
+global private rule small { condition: filesize < 10 }
+rule has_a { strings: $a = "a" condition: $a }`)
+	if got := names(s.Scan([]byte("aaa"))); got != "has_a" {
+		t.Errorf("满足 global 前提应命中 has_a，实际 %q", got)
+	}
+	if got := names(s.Scan([]byte("aaaaaaaaaaaa"))); got != "" {
+		t.Errorf("不满足 global 前提不应命中，实际 %q", got)
+	}
+}
+
+func TestHexBacktrackBounded(t *testing.T) {
+	// 多个不限长跳跃叠加在长输入上会退化，步数上限保证能返回
+	s := compileOK(t, `rule r { strings: $h = { 41 [-] 42 [-] 43 [-] 44 [-] 45 } condition: $h }`)
+	data := []byte(strings.Repeat("ABCD", 20000))
+	if len(s.Scan(data)) != 0 {
+		t.Errorf("没有 45 不应命中")
+	}
+}
+
+func TestHexBudgetExhaustedReported(t *testing.T) {
+	// 真正的载荷前堆满能部分匹配的前缀耗光步数：不能静默当作没命中
+	rules, errs := Build([]model.YaraRuleSet{{Name: "pe", Status: 1, Action: model.YaraActionBlock,
+		Content: `rule pe { strings: $h = { 4D 5A [0-1000] 50 45 00 00 } condition: $h }`}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	data := append([]byte(strings.Repeat("MZ", 5000)+strings.Repeat("x", 2000)), 'M', 'Z', 'P', 'E', 0, 0)
+	if _, err := rules.Scan(data); err != ErrScanIncomplete {
+		t.Fatalf("步数耗尽应报告扫描未完成，实际 %v", err)
+	}
+	if !rules.HasBlock() {
+		t.Fatal("拦截动作的规则集应被识别")
+	}
+	if ms, err := rules.Scan([]byte("MZ....PE\x00\x00")); err != nil || len(ms) != 1 {
+		t.Fatalf("载荷应命中: %v %v", ms, err)
+	}
+	if ms, err := rules.Scan([]byte("MZ....ZZ")); err != nil || len(ms) != 0 {
+		t.Fatalf("正常数据应扫完且不命中: %v %v", ms, err)
+	}
+}
+
+func TestBuildSkipsBrokenAndDisabled(t *testing.T) {
+	rules, errs := Build([]model.YaraRuleSet{
+		{Name: "ok", Status: 1, Content: `rule a { strings: $a = "evil" condition: $a }`, Action: "log"},
+		{Name: "broken", Status: 1, Content: `rule a {`},
+		{Name: "off", Status: 0, Content: `rule b { condition: true }`},
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken") {
+		t.Fatalf("应只报 broken 的错误，实际 %v", errs)
+	}
+	if rules.Len() != 1 {
+		t.Fatalf("应只加载 1 条规则，实际 %d", rules.Len())
+	}
+	ms, _ := rules.Scan([]byte("an evil file"))
+	if len(ms) != 1 || ms[0].String() != "ok/a" || ms[0].Action != model.YaraActionLog {
+		t.Errorf("命中结果不符: %+v", ms)
+	}
+	var nilRules *Rules
+	if ms, err := nilRules.Scan([]byte("x")); ms != nil || err != nil {
+		t.Errorf("nil 规则应安全返回")
+	}
+}
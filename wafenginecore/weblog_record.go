@@ -33,6 +33,10 @@ func shouldRecordWebLog(weblog *innerbean.WebLog, excludeURLLog string) bool {
 	if weblog == nil {
 		return false
 	}
+	// 缓存后台刷新不是访客请求，访客那次已经按缓存命中处理过
+	if weblog.CacheBackground {
+		return false
+	}
 	if isURLLogExcluded(weblog.URL, excludeURLLog) {
 		return false
 	}
@@ -0,0 +1,149 @@
+package wafenginecore
+
+import (
+	"SamWaf/global"
+	"SamWaf/innerbean"
+	"SamWaf/libinjection-go"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/utils"
+	"SamWaf/wafenginecore/wafargs"
+	"SamWaf/wafenginecore/wsinspect"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+)
+
+// prepareWebSocketInspect 站点开启 WebSocket 消息检测时，在握手转发前打上标记并去掉压缩扩展协商：
+// 压缩后的帧无法逐条检测，不让后端和客户端谈成 permessage-deflate
+func prepareWebSocketInspect(r *http.Request, weblogbean *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe) {
+	if model.ParseWebSocketConfig(hostTarget.Host.WebSocketJSON).IsEnable != 1 {
+		return
+	}
+	weblogbean.WsInspect = true
+	r.Header.Del("Sec-WebSocket-Extensions")
+}
+
+// websocketUpgrade 协议升级钩子：握手时打过检测标记的连接改由 wsinspect 逐帧检查转发，
+// 连接结束后把会话摘要写进握手日志再入库
+func (waf *WafEngine) websocketUpgrade() func(*http.Request) func(user, backend io.ReadWriter) {
+	return func(req *http.Request) func(user, backend io.ReadWriter) {
+		wafCtx, ok := req.Context().Value("waf_context").(innerbean.WafHttpContextData)
+		if !ok || wafCtx.Weblog == nil || !wafCtx.Weblog.WsInspect {
+			return nil
+		}
+		weblog := wafCtx.Weblog
+		hostTarget := waf.rt().HostTarget[waf.rt().HostCode[wafCtx.HostCode]]
+		if hostTarget == nil {
+			// 握手期间站点被删除：按原样转发，握手日志照常记录
+			if global.GQEQUE_LOG_DB != nil {
+				global.GQEQUE_LOG_DB.Enqueue(weblog)
+			}
+			return nil
+		}
+		cfg := model.ParseWebSocketConfig(hostTarget.Host.WebSocketJSON)
+		defense := model.ParseHostsDefense(hostTarget.Host.DEFENSE_JSON)
+		block := cfg.Action == "block" && hostTarget.Host.LogOnlyMode != 1
+		session := wsinspect.New(wsinspect.Config{
+			MaxFrameBytes: int64(cfg.MaxFrameKB) * 1024,
+			MaxMsgsPerSec: cfg.MaxMsgsPerSec,
+			Inspect: func(dir wsinspect.Direction, text string) wsinspect.Verdict {
+				if dir == wsinspect.ServerToClient && cfg.InspectServer != 1 {
+					return wsinspect.Verdict{}
+				}
+				hit := waf.inspectWebSocketText(weblog, hostTarget, defense, dir, text)
+				return wsinspect.Verdict{Hit: hit, Block: hit != "" && block}
+			},
+		})
+		return func(user, backend io.ReadWriter) {
+			session.Run(user, backend)
+			recordWebSocketSummary(weblog, hostTarget, session.Summary())
+		}
+	}
+}
+
+// wsBodyFieldRe 匹配规则里对请求体字段的引用，规则在骨架上匹配（同 geoFieldRe）
+var wsBodyFieldRe = regexp.MustCompile(`MF\s*\.\s*BODY\b`)
+
+// wsBodyRule 只有引用了 MF.BODY 的自定义规则参与消息检测。
+// 消息检测用的是握手日志的副本，URL/IP 之类的条件每条消息都一样，
+// 不筛的话一条只按路径出挑战的规则会让连接上的每条消息都命中
+func wsBodyRule(rule *ast.RuleEntry) bool {
+	return wsBodyFieldRe.MatchString(utils.BuildGrlSkeleton(rule.GrlText))
+}
+
+// inspectWebSocketText 检测一条文本消息，返回命中说明，空表示未命中。
+// 自定义规则先跑：放行规则可以豁免后续内置检测，拦截/挑战规则都按关闭连接处理(连接中途没法出挑战页)
+func (waf *WafEngine) inspectWebSocketText(weblog *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe, defense model.HostsDefense, dir wsinspect.Direction, text string) string {
+	msg := *weblog
+	msg.BODY = text
+	msg.ReqArgs = nil
+	localResult := ruleMatchResult{}
+	if hostTarget.Rule != nil {
+		localResult = matchRulesWith(hostTarget.Rule, &msg, "", wsBodyRule)
+	}
+	globalResult := ruleMatchResult{}
+	if globalHost := waf.rt().HostTarget[global.GWAF_GLOBAL_HOST_NAME]; globalHost != nil && globalHost.Host.GUARD_STATUS == 1 && globalHost.Rule != nil {
+		globalResult = matchRulesWith(globalHost.Rule, &msg, "【全局】", wsBodyRule)
+	}
+	if final := arbitrate(localResult, globalResult); final.Matched {
+		if final.Action.Action == utils.RuleActionAllow {
+			return ""
+		}
+		return "自定义规则:" + final.Title
+	}
+
+	args := wafargs.ExtractText(innerbean.ReqArgSourceWebSocket, text)
+	if defense.DEFENSE_SQLI == 1 {
+		if arg, ok := matchReqArg(args, true, libinjection.IsSQLiNotReturnPrint); ok {
+			return "SQL注入(" + arg.Label() + ")"
+		}
+	}
+	if defense.DEFENSE_XSS == 1 {
+		if arg, ok := matchReqArg(args, false, libinjection.IsXSSSingleValue); ok {
+			return "XSS跨站注入(" + arg.Label() + ")"
+		}
+	}
+	if defense.DEFENSE_SENSITIVE == 1 && len(waf.Sensitive) > 0 {
+		// 上行消息按请求方向(in)检测，下行消息按响应方向(out)检测；替换动作没法改写已定长的帧，只记录
+		except := "out"
+		if dir == wsinspect.ServerToClient {
+			except = "in"
+		}
+		for _, term := range waf.SensitiveManager.MultiPatternSearch([]rune(text), false) {
+			sensitive := term.CustomData.(model.Sensitive)
+			if sensitive.CheckDirection == except {
+				continue
+			}
+			if sensitive.Action == "deny" {
+				return "敏感词检测：" + string(term.Word)
+			}
+		}
+	}
+	return ""
+}
+
+// recordWebSocketSummary 连接结束后补全握手日志：摘要、WAF 关闭原因、命中的检测项
+func recordWebSocketSummary(weblog *innerbean.WebLog, hostTarget *wafenginmodel.HostSafe, sum wsinspect.Summary) {
+	weblog.WS_SUMMARY = sum.String()
+	if len(sum.Hits) > 0 {
+		weblog.RISK_LEVEL = 2
+		weblog.RULE = "WebSocket检测:" + strings.Join(sum.Hits, ";")
+		if hostTarget.Host.LogOnlyMode == 1 {
+			weblog.LogOnlyMode = 1
+		}
+	}
+	if sum.Blocked {
+		if weblog.RISK_LEVEL < 1 {
+			weblog.RISK_LEVEL = 1
+		}
+		weblog.ACTION = "阻止"
+		weblog.RULE = "WebSocket检测:" + sum.CloseReason
+	}
+	if global.GQEQUE_LOG_DB != nil && shouldRecordWebLog(weblog, hostTarget.Host.EXCLUDE_URL_LOG) {
+		global.GQEQUE_LOG_DB.Enqueue(weblog)
+	}
+}
@@ -0,0 +1,115 @@
+package wafenginecore
+
+import (
+	"SamWaf/innerbean"
+	"SamWaf/model"
+	"SamWaf/model/wafenginmodel"
+	"SamWaf/wafenginecore/wsinspect"
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newWebSocketTestHost(t *testing.T, rule string) *wafenginmodel.HostSafe {
+	host := &wafenginmodel.HostSafe{Host: model.Hosts{
+		Code:          "ws-host",
+		DEFENSE_JSON:  `{"sqli":1,"xss":1}`,
+		WebSocketJSON: `{"is_enable":1,"max_frame_kb":1}`,
+	}}
+	if rule != "" {
+		host.Rule = buildRuleHelper(t, rule)
+	}
+	return host
+}
+
+func TestInspectWebSocketText(t *testing.T) {
+	waf := &WafEngine{}
+	waf.InitRouting()
+	host := newWebSocketTestHost(t, `
+rule Rtest001 "禁止删表" salience 10 {
+    when MF.BODY.Contains("drop table") == true
+    then RF.Deny();
+}`)
+	defense := model.ParseHostsDefense(host.Host.DEFENSE_JSON)
+	weblog := &innerbean.WebLog{URL: "/ws"}
+	cases := map[string]string{
+		`{"op":"q","args":{"id":"1' or '1'='1"}}`: "SQL注入(websocket:args.id)",
+		`<script>alert(1)</script>`:               "XSS跨站注入(websocket)",
+		`{"msg":"drop table users"}`:              "自定义规则:禁止删表,",
+		`{"msg":"hello"}`:                         "",
+	}
+	for text, want := range cases {
+		if got := waf.inspectWebSocketText(weblog, host, defense, wsinspect.ClientToServer, text); got != want {
+			t.Errorf("%s: 命中 %q，期望 %q", text, got, want)
+		}
+	}
+
+	// 只按 URL 判定的规则在握手时已经判过，不能让连接上的每条消息都命中
+	urlHost := newWebSocketTestHost(t, `
+rule Rtest001 "按路径" salience 10 {
+    when MF.URL == "/ws"
+    then RF.Deny();
+}`)
+	if got := waf.inspectWebSocketText(weblog, urlHost, defense, wsinspect.ClientToServer, "hello"); got != "" {
+		t.Errorf("未引用 MF.BODY 的规则不应参与消息检测，实际命中 %q", got)
+	}
+}
+
+func TestWebSocketUpgradeHook(t *testing.T) {
+	waf := &WafEngine{}
+	waf.InitRouting()
+	host := newWebSocketTestHost(t, "")
+	waf.rt().HostCode[host.Host.Code] = "ws.example.com"
+	waf.rt().HostTarget["ws.example.com"] = host
+
+	r := httptest.NewRequest(http.MethodGet, "http://ws.example.com/ws", nil)
+	r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+	weblog := &innerbean.WebLog{URL: "/ws", ACTION: "放行"}
+	prepareWebSocketInspect(r, weblog, host)
+	if !weblog.WsInspect || r.Header.Get("Sec-WebSocket-Extensions") != "" {
+		t.Fatal("开启检测的握手应打标记并去掉压缩扩展")
+	}
+
+	ctx := context.WithValue(r.Context(), "waf_context", innerbean.WafHttpContextData{Weblog: weblog, HostCode: host.Host.Code})
+	handle := waf.websocketUpgrade()(r.WithContext(ctx))
+	if handle == nil {
+		t.Fatal("开启检测的连接应由钩子接管")
+	}
+	if waf.websocketUpgrade()(r) != nil {
+		t.Fatal("没有打标记的请求不应接管")
+	}
+
+	userClient, userProxy := net.Pipe()
+	backendProxy, backendServer := net.Pipe()
+	go io.Copy(io.Discard, backendServer)
+	done := make(chan struct{})
+	go func() {
+		handle(userProxy, backendProxy)
+		userProxy.Close()
+		backendProxy.Close()
+		close(done)
+	}()
+
+	payload := []byte(`{"id":"1' or '1'='1"}`)
+	frame := []byte{0x81, 0x80 | byte(len(payload)), 0, 0, 0, 0} //掩码全 0，载荷即明文
+	go userClient.Write(append(frame, payload...))
+	// 客户端应收到 1008 的 close 帧
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(bufio.NewReader(userClient), head); err != nil || head[0] != 0x88 || int(head[2])<<8|int(head[3]) != wsinspect.ClosePolicyViolation {
+		t.Fatalf("应收到 1008 关闭帧，实际 % x %v", head, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("违规后连接应结束")
+	}
+	if weblog.ACTION != "阻止" || !strings.Contains(weblog.RULE, "SQL注入") || !strings.Contains(weblog.WS_SUMMARY, "上行 1 条") {
+		t.Errorf("日志不符: action=%s rule=%s summary=%s", weblog.ACTION, weblog.RULE, weblog.WS_SUMMARY)
+	}
+}
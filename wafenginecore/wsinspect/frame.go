@@ -0,0 +1,166 @@
+// Package wsinspect 解析 WebSocket(RFC 6455) 帧并在代理两端之间转发，转发前对整条消息做大小、频率和内容检查。
+//
+// 数据帧按消息缓存，收齐(FIN)并检查通过后才把原始帧原样发出去，分片里拆开的载荷也能拼起来检测；
+// 控制帧(close/ping/pong)不缓存，收到即转发。违规时向两端各发一个带关闭码的 close 帧后结束转发。
+// 不支持压缩扩展(permessage-deflate)，调用方需在握手时去掉 Sec-WebSocket-Extensions。
+package wsinspect
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// 关闭码(RFC 6455 7.4.1)
+const (
+	CloseNormal          = 1000
+	CloseProtocolError   = 1002
+	CloseInvalidPayload  = 1007 //文本消息不是合法 UTF-8
+	ClosePolicyViolation = 1008 //内容检测命中、发送过快
+	CloseMessageTooBig   = 1009
+)
+
+// closeText 发给对端的关闭原因，只给通用描述，命中明细只进日志
+var closeText = map[int]string{
+	CloseProtocolError:   "protocol error",
+	CloseInvalidPayload:  "invalid payload",
+	ClosePolicyViolation: "policy violation",
+	CloseMessageTooBig:   "message too big",
+}
+
+// violation 违反协议或策略，需要按 code 关闭连接
+type violation struct {
+	code   int
+	reason string
+}
+
+func (v *violation) Error() string {
+	return fmt.Sprintf("%d %s", v.code, v.reason)
+}
+
+func protocolError(reason string) *violation {
+	return &violation{code: CloseProtocolError, reason: "协议错误: " + reason}
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	raw     []byte //帧的原始字节(含帧头)，检查通过后原样转发
+	payload []byte //解掩码后的载荷
+}
+
+func (f *frame) control() bool {
+	return f.opcode&0x8 != 0
+}
+
+// readFrame 读一帧。masked 为该方向要求的掩码状态：客户端发出的帧必须掩码，服务端发出的不能掩码。
+// 载荷超过 maxPayload 时不读载荷直接报 1009，避免按对端声明的长度分配内存
+func readFrame(br *bufio.Reader, masked bool, maxPayload int64) (*frame, error) {
+	var hdr [14]byte
+	if _, err := io.ReadFull(br, hdr[:2]); err != nil {
+		return nil, err
+	}
+	f := &frame{fin: hdr[0]&0x80 != 0, opcode: hdr[0] & 0x0F}
+	if hdr[0]&0x70 != 0 {
+		return nil, protocolError("RSV 位非零(未协商扩展)")
+	}
+	switch f.opcode {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return nil, protocolError(fmt.Sprintf("未知操作码 0x%X", f.opcode))
+	}
+	if (hdr[1]&0x80 != 0) != masked {
+		if masked {
+			return nil, protocolError("客户端帧未掩码")
+		}
+		return nil, protocolError("服务端帧带掩码")
+	}
+
+	n := 2
+	length := int64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(br, hdr[n:n+2]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(hdr[n:]))
+		n += 2
+	case 127:
+		if _, err := io.ReadFull(br, hdr[n:n+8]); err != nil {
+			return nil, err
+		}
+		l := binary.BigEndian.Uint64(hdr[n:])
+		if l>>63 != 0 {
+			return nil, protocolError("载荷长度最高位非零")
+		}
+		length = int64(l)
+		n += 8
+	}
+	if f.control() && (!f.fin || length > 125) {
+		return nil, protocolError("控制帧分片或超过 125 字节")
+	}
+	if maxPayload > 0 && length > maxPayload {
+		return nil, &violation{code: CloseMessageTooBig, reason: fmt.Sprintf("帧载荷 %d 字节超过上限 %d", length, maxPayload)}
+	}
+	var key []byte
+	if masked {
+		if _, err := io.ReadFull(br, hdr[n:n+4]); err != nil {
+			return nil, err
+		}
+		key = hdr[n : n+4]
+		n += 4
+	}
+
+	f.raw = make([]byte, int64(n)+length)
+	copy(f.raw, hdr[:n])
+	if _, err := io.ReadFull(br, f.raw[n:]); err != nil {
+		return nil, err
+	}
+	f.payload = f.raw[n:]
+	if masked {
+		f.payload = make([]byte, length)
+		for i, b := range f.raw[n:] {
+			f.payload[i] = b ^ key[i&3]
+		}
+	}
+	return f, nil
+}
+
+// closeFrame 组一个 close 帧。发往后端的帧扮演客户端，要掩码
+func closeFrame(code int, masked bool) []byte {
+	payload := make([]byte, 2, 2+len(closeText[code]))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, closeText[code]...)
+
+	out := []byte{0x80 | opClose, byte(len(payload))}
+	if !masked {
+		return append(out, payload...)
+	}
+	out[1] |= 0x80
+	var key [4]byte
+	rand.Read(key[:])
+	out = append(out, key[:]...)
+	for i, b := range payload {
+		out = append(out, b^key[i&3])
+	}
+	return out
+}
+
+// closeCode 解析 close 帧载荷里的关闭码，没带关闭码时按 1005(无状态码)处理
+func closeCode(payload []byte) int {
+	if len(payload) < 2 {
+		return 1005
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
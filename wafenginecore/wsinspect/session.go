@@ -0,0 +1,273 @@
+package wsinspect
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Direction 消息方向
+type Direction int
+
+const (
+	ClientToServer Direction = iota //上行：客户端发往后端
+	ServerToClient                  //下行：后端发往客户端
+)
+
+func (d Direction) String() string {
+	if d == ClientToServer {
+		return "上行"
+	}
+	return "下行"
+}
+
+// DefaultMaxFrameBytes 未配置上限时的单帧/单条消息上限；消息要整条缓存后检测，不能不设上限
+const DefaultMaxFrameBytes = 1 << 20
+
+// maxHits 一条连接最多记录的命中条数，仅记录动作下刷屏的命中不再往后记
+const maxHits = 20
+
+// Verdict 一条文本消息的检测结论
+type Verdict struct {
+	Hit   string //命中说明，空表示没命中
+	Block bool   //命中后是否关闭连接；为 false 时只记录
+}
+
+// Config 单条连接的检查策略
+type Config struct {
+	MaxFrameBytes int64 //单帧载荷、分片重组后单条消息的最大字节数，<=0 取 DefaultMaxFrameBytes
+	MaxMsgsPerSec int   //客户端每秒最多发送的消息数，<=0 不限
+	// Inspect 检测一条完整的文本消息，nil 不检测。两个方向的消息并发调用
+	Inspect func(dir Direction, text string) Verdict
+}
+
+// Summary 连接结束后的统计
+type Summary struct {
+	Messages    [2]int64 //按 Direction 下标：完整消息条数
+	Bytes       [2]int64 //按 Direction 下标：线上字节数(含帧头和控制帧)
+	Duration    time.Duration
+	CloseCode   int    //0 表示没有收到 close 帧(连接直接断开)
+	CloseBy     string //WAF / 客户端 / 后端
+	CloseReason string //WAF 关闭时的原因
+	Blocked     bool   //因策略被 WAF 关闭
+	Hits        []string
+}
+
+func (s Summary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "上行 %d 条/%d 字节，下行 %d 条/%d 字节，时长 %s",
+		s.Messages[ClientToServer], s.Bytes[ClientToServer], s.Messages[ServerToClient], s.Bytes[ServerToClient],
+		s.Duration.Round(time.Millisecond))
+	switch {
+	case s.CloseBy == "":
+		b.WriteString("，连接断开")
+	case s.CloseReason != "":
+		fmt.Fprintf(&b, "，%s关闭 %d(%s)", s.CloseBy, s.CloseCode, s.CloseReason)
+	default:
+		fmt.Fprintf(&b, "，%s关闭 %d", s.CloseBy, s.CloseCode)
+	}
+	for _, h := range s.Hits {
+		b.WriteString("\n命中: " + h)
+	}
+	return b.String()
+}
+
+// lockedWriter 两个方向都可能往同一端写(转发的帧、WAF 发的 close 帧)，按整帧加锁。
+// WAF 发过 close 帧之后不再转发
+type lockedWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func (l *lockedWriter) write(p []byte, final bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return io.ErrClosedPipe
+	}
+	l.closed = final
+	_, err := l.w.Write(p)
+	return err
+}
+
+// Session 一条 WebSocket 连接的检查转发
+type Session struct {
+	cfg     Config
+	start   time.Time
+	user    *lockedWriter
+	backend *lockedWriter
+
+	mu  sync.Mutex
+	sum Summary
+
+	// 上行限速窗口，只在上行 goroutine 里访问
+	winStart time.Time
+	winCount int
+}
+
+func New(cfg Config) *Session {
+	if cfg.MaxFrameBytes <= 0 {
+		cfg.MaxFrameBytes = DefaultMaxFrameBytes
+	}
+	return &Session{cfg: cfg}
+}
+
+// Run 在 user(客户端连接) 与 backend(后端连接) 之间检查转发，任一方向结束即返回；
+// 另一方向的 goroutine 在调用方关闭两端连接后退出
+func (s *Session) Run(user, backend io.ReadWriter) {
+	s.start = time.Now()
+	s.user = &lockedWriter{w: user}
+	s.backend = &lockedWriter{w: backend}
+	errc := make(chan error, 2)
+	go func() { errc <- s.pump(ClientToServer, user, s.backend) }()
+	go func() { errc <- s.pump(ServerToClient, backend, s.user) }()
+	<-errc
+	s.mu.Lock()
+	s.sum.Duration = time.Since(s.start)
+	s.mu.Unlock()
+}
+
+// Summary 返回统计快照
+func (s *Session) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := s.sum
+	sum.Hits = append([]string(nil), s.sum.Hits...)
+	return sum
+}
+
+func (s *Session) pump(dir Direction, src io.Reader, dst *lockedWriter) error {
+	br := bufio.NewReader(src)
+	var raw, payload []byte //当前消息已收到的原始帧与载荷
+	var msgOp byte
+	inMsg := false
+	for {
+		f, err := readFrame(br, dir == ClientToServer, s.cfg.MaxFrameBytes)
+		if err != nil {
+			return s.fail(err)
+		}
+		s.mu.Lock()
+		s.sum.Bytes[dir] += int64(len(f.raw))
+		s.mu.Unlock()
+
+		if f.control() {
+			if f.opcode == opClose {
+				s.peerClosed(dir, f.payload)
+			}
+			if err := dst.write(f.raw, false); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.opcode == opContinuation {
+			if !inMsg {
+				return s.fail(protocolError("没有起始帧的续帧"))
+			}
+		} else {
+			if inMsg {
+				return s.fail(protocolError("上一条消息未结束又开始新消息"))
+			}
+			inMsg, msgOp = true, f.opcode
+		}
+		if int64(len(payload)+len(f.payload)) > s.cfg.MaxFrameBytes {
+			return s.fail(&violation{code: CloseMessageTooBig, reason: fmt.Sprintf("消息超过上限 %d 字节", s.cfg.MaxFrameBytes)})
+		}
+		raw = append(raw, f.raw...)
+		payload = append(payload, f.payload...)
+		if !f.fin {
+			continue
+		}
+
+		inMsg = false
+		if v := s.message(dir, msgOp, payload); v != nil {
+			return s.fail(v)
+		}
+		if err := dst.write(raw, false); err != nil {
+			return err
+		}
+		raw, payload = raw[:0], payload[:0]
+	}
+}
+
+// message 一条完整消息：计数、上行限速、文本内容检测
+func (s *Session) message(dir Direction, op byte, payload []byte) *violation {
+	s.mu.Lock()
+	s.sum.Messages[dir]++
+	s.mu.Unlock()
+
+	if dir == ClientToServer && s.cfg.MaxMsgsPerSec > 0 {
+		now := time.Now()
+		if now.Sub(s.winStart) >= time.Second {
+			s.winStart, s.winCount = now, 0
+		}
+		s.winCount++
+		if s.winCount > s.cfg.MaxMsgsPerSec {
+			return &violation{code: ClosePolicyViolation, reason: fmt.Sprintf("发送过快，超过每秒 %d 条", s.cfg.MaxMsgsPerSec)}
+		}
+	}
+
+	if op != opText {
+		return nil
+	}
+	if !utf8.Valid(payload) {
+		return &violation{code: CloseInvalidPayload, reason: "文本消息不是合法 UTF-8"}
+	}
+	if s.cfg.Inspect == nil {
+		return nil
+	}
+	verdict := s.cfg.Inspect(dir, string(payload))
+	if verdict.Hit == "" {
+		return nil
+	}
+	hit := dir.String() + " " + verdict.Hit
+	s.mu.Lock()
+	if len(s.sum.Hits) < maxHits {
+		s.sum.Hits = append(s.sum.Hits, hit)
+	}
+	s.mu.Unlock()
+	if verdict.Block {
+		return &violation{code: ClosePolicyViolation, reason: hit}
+	}
+	return nil
+}
+
+// peerClosed 记下先发起关闭的一方
+func (s *Session) peerClosed(dir Direction, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sum.CloseBy != "" {
+		return
+	}
+	s.sum.CloseCode = closeCode(payload)
+	if dir == ClientToServer {
+		s.sum.CloseBy = "客户端"
+	} else {
+		s.sum.CloseBy = "后端"
+	}
+}
+
+// fail 处理读帧/检查的错误：违规时向两端发 close 帧并记录原因，其余错误(连接断开)原样返回
+func (s *Session) fail(err error) error {
+	var v *violation
+	if !errors.As(err, &v) {
+		return err
+	}
+	s.mu.Lock()
+	first := !s.sum.Blocked
+	if first {
+		s.sum.Blocked = true
+		s.sum.CloseCode, s.sum.CloseBy, s.sum.CloseReason = v.code, "WAF", v.reason
+	}
+	s.mu.Unlock()
+	if first {
+		s.user.write(closeFrame(v.code, false), true)
+		s.backend.write(closeFrame(v.code, true), true)
+	}
+	return err
+}
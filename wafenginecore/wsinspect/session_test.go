@@ -0,0 +1,226 @@
+package wsinspect
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encode 组帧；masked 为 true 时按客户端帧掩码
+func encode(op byte, fin bool, payload []byte, masked bool) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	out := []byte{b0}
+	var b1 byte
+	if masked {
+		b1 = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		out = append(out, b1|byte(n))
+	case n < 1<<16:
+		out = append(out, b1|126, byte(n>>8), byte(n))
+	default:
+		out = append(out, b1|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	if !masked {
+		return append(out, payload...)
+	}
+	key := []byte{0x12, 0x34, 0x56, 0x78}
+	out = append(out, key...)
+	for i, b := range payload {
+		out = append(out, b^key[i&3])
+	}
+	return out
+}
+
+type harness struct {
+	client, server     net.Conn //测试扮演的客户端、后端
+	toClient, toServer chan *frame
+	done               chan Summary
+}
+
+// start 起一个检查转发会话，两端收到的帧都收集到通道里，会话结束后两端连接关闭
+func start(cfg Config) *harness {
+	userClient, userProxy := net.Pipe()
+	backendProxy, backendServer := net.Pipe()
+	h := &harness{
+		client:   userClient,
+		server:   backendServer,
+		toClient: collect(userClient, false),
+		toServer: collect(backendServer, true),
+		done:     make(chan Summary, 1),
+	}
+	s := New(cfg)
+	go func() {
+		s.Run(userProxy, backendProxy)
+		userProxy.Close()
+		backendProxy.Close()
+		h.done <- s.Summary()
+	}()
+	return h
+}
+
+func collect(c net.Conn, masked bool) chan *frame {
+	ch := make(chan *frame, 64)
+	go func() {
+		defer close(ch)
+		br := bufio.NewReader(c)
+		for {
+			f, err := readFrame(br, masked, 0)
+			if err != nil {
+				return
+			}
+			ch <- f
+		}
+	}()
+	return ch
+}
+
+func (h *harness) wait(t *testing.T) Summary {
+	t.Helper()
+	select {
+	case sum := <-h.done:
+		return sum
+	case <-time.After(3 * time.Second):
+		t.Fatal("会话未结束")
+	}
+	return Summary{}
+}
+
+func drain(ch chan *frame) []*frame {
+	var out []*frame
+	for f := range ch {
+		out = append(out, f)
+	}
+	return out
+}
+
+// lastClose 收到的最后一帧应是 close 帧，返回其关闭码
+func lastClose(t *testing.T, name string, frames []*frame) int {
+	t.Helper()
+	if len(frames) == 0 || frames[len(frames)-1].opcode != opClose {
+		t.Fatalf("%s 应收到 close 帧，实际 %d 帧", name, len(frames))
+	}
+	return closeCode(frames[len(frames)-1].payload)
+}
+
+func TestForwardBothDirections(t *testing.T) {
+	var inspected []string
+	h := start(Config{Inspect: func(dir Direction, text string) Verdict {
+		inspected = append(inspected, dir.String()+":"+text)
+		return Verdict{}
+	}})
+	// 分片文本 + ping 插在分片之间
+	go h.client.Write(bytes.Join([][]byte{
+		encode(opText, false, []byte("hel"), true),
+		encode(opPing, true, []byte("p"), true),
+		encode(opContinuation, true, []byte("lo"), true),
+		encode(opBinary, true, []byte{0xff, 0x00}, true),
+	}, nil))
+
+	var got []*frame
+	for len(got) < 4 {
+		got = append(got, <-h.toServer)
+	}
+	if got[0].opcode != opPing || string(got[1].payload) != "hel" || string(got[2].payload) != "lo" || got[3].opcode != opBinary {
+		t.Fatalf("后端收到的帧顺序或内容不对")
+	}
+
+	go h.server.Write(encode(opText, true, []byte("world"), false))
+	if f := <-h.toClient; string(f.payload) != "world" {
+		t.Fatalf("客户端应收到 world，实际 %q", f.payload)
+	}
+
+	go h.client.Write(encode(opClose, true, []byte{0x03, 0xe8}, true))
+	if f := <-h.toServer; f.opcode != opClose {
+		t.Fatal("客户端的 close 帧应转发给后端")
+	}
+	h.client.Close()
+	sum := h.wait(t)
+	if sum.Messages != [2]int64{2, 1} || sum.Blocked || sum.CloseBy != "客户端" || sum.CloseCode != CloseNormal {
+		t.Errorf("统计不符: %+v", sum)
+	}
+	if strings.Join(inspected, ",") != "上行:hello,下行:world" {
+		t.Errorf("只应检测完整的文本消息，实际 %v", inspected)
+	}
+	if !strings.Contains(sum.String(), "上行 2 条") {
+		t.Errorf("摘要: %s", sum)
+	}
+}
+
+func TestBlockOnInspectHit(t *testing.T) {
+	h := start(Config{Inspect: func(dir Direction, text string) Verdict {
+		if strings.Contains(text, "union select") {
+			return Verdict{Hit: "SQL注入", Block: true}
+		}
+		if strings.Contains(text, "watch") {
+			return Verdict{Hit: "观察"}
+		}
+		return Verdict{}
+	}})
+	go h.client.Write(bytes.Join([][]byte{
+		encode(opText, true, []byte("watch me"), true),
+		encode(opText, false, []byte("1 union "), true),
+		encode(opContinuation, true, []byte("select 1"), true),
+	}, nil))
+	sum := h.wait(t)
+	toServer, toClient := drain(h.toServer), drain(h.toClient)
+
+	if len(toServer) != 2 || string(toServer[0].payload) != "watch me" {
+		t.Fatalf("只记录的消息应放行，命中拦截的分片一个都不能转发，后端收到 %d 帧", len(toServer))
+	}
+	if code := lastClose(t, "后端", toServer); code != ClosePolicyViolation {
+		t.Errorf("后端关闭码 %d", code)
+	}
+	if code := lastClose(t, "客户端", toClient); code != ClosePolicyViolation {
+		t.Errorf("客户端关闭码 %d", code)
+	}
+	if !sum.Blocked || sum.CloseBy != "WAF" || len(sum.Hits) != 2 || !strings.Contains(sum.CloseReason, "SQL注入") {
+		t.Errorf("统计不符: %+v", sum)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    Config
+		frames [][]byte
+		code   int
+	}{
+		{"单帧超限", Config{MaxFrameBytes: 10}, [][]byte{encode(opBinary, true, make([]byte, 11), true)}, CloseMessageTooBig},
+		{"分片累计超限", Config{MaxFrameBytes: 10},
+			[][]byte{encode(opText, false, []byte("123456"), true), encode(opContinuation, true, []byte("789012"), true)}, CloseMessageTooBig},
+		{"发送过快", Config{MaxMsgsPerSec: 2},
+			[][]byte{encode(opText, true, []byte("a"), true), encode(opText, true, []byte("b"), true), encode(opText, true, []byte("c"), true)}, ClosePolicyViolation},
+		{"未掩码", Config{}, [][]byte{encode(opText, true, []byte("a"), false)}, CloseProtocolError},
+		{"孤立续帧", Config{}, [][]byte{encode(opContinuation, true, []byte("a"), true)}, CloseProtocolError},
+		{"非法UTF-8", Config{}, [][]byte{encode(opText, true, []byte{0xff, 0xfe}, true)}, CloseInvalidPayload},
+		{"控制帧过长", Config{}, [][]byte{encode(opPing, true, make([]byte, 126), true)}, CloseProtocolError},
+	}
+	for _, c := range cases {
+		h := start(c.cfg)
+		go h.client.Write(bytes.Join(c.frames, nil))
+		sum := h.wait(t)
+		drain(h.toServer)
+		if code := lastClose(t, c.name, drain(h.toClient)); code != c.code || sum.CloseCode != c.code {
+			t.Errorf("%s: 关闭码 %d/%d，期望 %d", c.name, code, sum.CloseCode, c.code)
+		}
+	}
+}
+
+func TestServerFrameMustNotBeMasked(t *testing.T) {
+	h := start(Config{})
+	go h.server.Write(encode(opText, true, []byte("x"), true))
+	sum := h.wait(t)
+	drain(h.toServer)
+	drain(h.toClient)
+	if sum.CloseCode != CloseProtocolError {
+		t.Errorf("服务端帧带掩码应按协议错误关闭，实际 %+v", sum)
+	}
+}
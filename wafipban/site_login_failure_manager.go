@@ -0,0 +1,155 @@
+package wafipban
+
+import (
+	"SamWaf/cache"
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"sync"
+	"time"
+)
+
+// 受保护网站登录接口的失败计数器(防撞库/账号接管)。
+//
+// 与 HostLoginFailureManager 同样的滑动窗口算法，键前缀独立：
+// 这里统计的是网站业务登录失败，既不能混进主机 SSH/RDP 的计数，
+// 也不能混进 MF.GetIPFailureCount 读取的 HTTP 状态码失败计数。
+//
+// 同一次失败按三个维度各记一笔：IP、用户名、IP网段。每条事件带上"对端"
+// (IP 维度记用户名，用户名/网段维度记 IP)，用来识别"一个IP试很多账号"与
+// "很多IP试一个账号"两种分布式攻击。
+
+// 统计维度
+const (
+	SiteLoginDimIP     = "ip"
+	SiteLoginDimUser   = "user"
+	SiteLoginDimSubnet = "subnet"
+)
+
+// SiteLoginFailureEvent 一次登录失败
+type SiteLoginFailureEvent struct {
+	Time time.Time
+	Peer string //对端：IP 维度是用户名，用户名/网段维度是 IP
+}
+
+// SiteLoginFailureRecord 某个 (网站, 维度, 值) 的失败事件滑动窗口
+type SiteLoginFailureRecord struct {
+	Events   []SiteLoginFailureEvent
+	LastTime time.Time
+}
+
+// SiteLoginFailureStat 窗口内的统计结果
+type SiteLoginFailureStat struct {
+	Count int64 //失败次数
+	Peers int64 //不同对端数
+}
+
+// SiteLoginFailureManager 网站登录失败计数器
+type SiteLoginFailureManager struct {
+	cache cache.CacheStore
+	mu    sync.Mutex //同一账号的并发失败请求会同时读改写一条记录
+}
+
+var siteLoginFailureManagerInstance *SiteLoginFailureManager
+
+// InitSiteLoginFailureManager 初始化单例，复用与 InitIPBanManager 相同的 CacheStore
+func InitSiteLoginFailureManager(wafCache cache.CacheStore) {
+	if siteLoginFailureManagerInstance != nil {
+		return
+	}
+	siteLoginFailureManagerInstance = &SiteLoginFailureManager{cache: wafCache}
+}
+
+// GetSiteLoginFailureManager 获取单例，未初始化时返回 nil(调用方需判空)
+func GetSiteLoginFailureManager() *SiteLoginFailureManager {
+	if siteLoginFailureManagerInstance == nil {
+		zlog.Error("SiteLoginFailureManager 未初始化，请先调用 InitSiteLoginFailureManager")
+	}
+	return siteLoginFailureManagerInstance
+}
+
+// siteLoginKey 计数键：按网站隔离，同一个IP在A站的失败不影响B站
+func siteLoginKey(hostCode, dim, value string) string {
+	return enums.CACHE_SITE_LOGIN_FAIL_PRE + hostCode + ":" + dim + ":" + value
+}
+
+// Record 记录一次失败并返回窗口内统计，一次调用完成"读-改-写"。
+// limit 为该维度配置的上限(次数与对端数取大)，为 0 表示该维度不判定，不记录；
+// 每个键最多保留 2*limit 条事件(挑战模式下达到两倍上限才直接拦截)，再多也不会改变判定结果，
+// 避免被一个IP持续刷失败时单条记录无限增长
+func (m *SiteLoginFailureManager) Record(hostCode, dim, value, peer string, windowMinutes int64, limit int) SiteLoginFailureStat {
+	if m == nil || value == "" || limit <= 0 {
+		return SiteLoginFailureStat{}
+	}
+	if windowMinutes <= 0 {
+		windowMinutes = 10
+	}
+	key := siteLoginKey(hostCode, dim, value)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.getRecord(key)
+	if record == nil {
+		record = &SiteLoginFailureRecord{}
+	}
+	record.Events = append(record.Events, SiteLoginFailureEvent{Time: now, Peer: peer})
+	record.Events = trimSiteLoginEvents(record.Events, now.Add(-time.Duration(windowMinutes)*time.Minute))
+	if maxEvents := 2 * limit; len(record.Events) > maxEvents {
+		record.Events = record.Events[len(record.Events)-maxEvents:]
+	}
+	record.LastTime = now
+
+	m.cache.SetWithTTlRenewTime(key, record, time.Duration(windowMinutes)*time.Minute)
+	return statSiteLoginEvents(record.Events)
+}
+
+// GetStat 查询窗口内统计(不写入)
+func (m *SiteLoginFailureManager) GetStat(hostCode, dim, value string, windowMinutes int64) SiteLoginFailureStat {
+	if m == nil || value == "" {
+		return SiteLoginFailureStat{}
+	}
+	record := m.getRecord(siteLoginKey(hostCode, dim, value))
+	if record == nil {
+		return SiteLoginFailureStat{}
+	}
+	return statSiteLoginEvents(trimSiteLoginEvents(record.Events, time.Now().Add(-time.Duration(windowMinutes)*time.Minute)))
+}
+
+// Clear 清除计数，如登录成功后清掉该用户名的失败记录
+func (m *SiteLoginFailureManager) Clear(hostCode, dim, value string) {
+	if m == nil || value == "" {
+		return
+	}
+	m.cache.Remove(siteLoginKey(hostCode, dim, value))
+}
+
+func (m *SiteLoginFailureManager) getRecord(key string) *SiteLoginFailureRecord {
+	val := m.cache.Get(key)
+	if val == nil {
+		return nil
+	}
+	record, _ := val.(*SiteLoginFailureRecord)
+	return record
+}
+
+// trimSiteLoginEvents 只保留窗口内的事件(新切片，不改原记录，避免并发读到一半被截断)
+func trimSiteLoginEvents(events []SiteLoginFailureEvent, windowStart time.Time) []SiteLoginFailureEvent {
+	valid := make([]SiteLoginFailureEvent, 0, len(events))
+	for _, e := range events {
+		if e.Time.After(windowStart) {
+			valid = append(valid, e)
+		}
+	}
+	return valid
+}
+
+func statSiteLoginEvents(events []SiteLoginFailureEvent) SiteLoginFailureStat {
+	peers := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		if e.Peer != "" {
+			peers[e.Peer] = struct{}{}
+		}
+	}
+	return SiteLoginFailureStat{Count: int64(len(events)), Peers: int64(len(peers))}
+}
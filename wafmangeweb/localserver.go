@@ -200,11 +200,18 @@ func (web *WafWebManager) initRouter(r *gin.Engine) {
 			router.ApiGroupApp.InitBlockUrlRouter(securityAdminGroup)
 			router.ApiGroupApp.InitSensitiveRouter(securityAdminGroup)
 			router.ApiGroupApp.InitWafOwaspRouter(securityAdminGroup)
+			router.ApiGroupApp.InitWafDetectExclusionRouter(securityAdminGroup)
+			router.ApiGroupApp.InitWafApiSpecRouter(securityAdminGroup)
+			router.ApiGroupApp.InitWafSpiderBotRouter(securityAdminGroup)
+			router.ApiGroupApp.InitWafYaraRouter(securityAdminGroup)
+			router.ApiGroupApp.InitWafGrpcDescriptorRouter(securityAdminGroup)
 			// 统一访问认证：账号、策略配置、在线会话都是访问控制决策，属安全管理员域
 			// （它的审计日志归审计管理员，见下方 auditAdminGroup）
 			router.ApiGroupApp.InitAccessAccountRouter(securityAdminGroup)
 			router.ApiGroupApp.InitAccessConfigRouter(securityAdminGroup)
 			router.ApiGroupApp.InitAccessSessionRouter(securityAdminGroup)
+			// 配置包会整体改写网站的规则与名单，与逐项修改同属安全管理员域
+			router.ApiGroupApp.InitWafConfigBundleRouter(securityAdminGroup)
 		}
 
 		// === 审计管理员域：操作/账号审计日志（只读，独立审计其余两员）===
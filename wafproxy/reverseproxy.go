@@ -92,6 +92,11 @@ type ReverseProxy struct {
 	// If nil, the default is to log the provided error and return
 	// a 502 Status Bad Gateway response.
 	ErrorHandler func(http.ResponseWriter, *http.Request, error)
+
+	// UpgradeHandler 可选：协议升级(101)成功后按请求决定是否接管双向转发。
+	// 返回 nil 时按原样对拷；否则由返回的函数在 user(客户端连接) 与 backend(后端连接) 之间转发，
+	// 任一方向结束即返回，之后两端连接都会被关闭
+	UpgradeHandler func(req *http.Request) func(user, backend io.ReadWriter)
 }
 
 // A BufferPool is an interface for getting and returning temporary
@@ -709,6 +714,12 @@ func (p *ReverseProxy) handleUpgradeResponse(rw http.ResponseWriter, req *http.R
 		p.getErrorHandler()(rw, req, fmt.Errorf("response flush: %v", err))
 		return
 	}
+	if p.UpgradeHandler != nil {
+		if handle := p.UpgradeHandler(req); handle != nil {
+			handle(conn, backConn)
+			return
+		}
+	}
 	errc := make(chan error, 1)
 	spc := switchProtocolCopier{user: conn, backend: backConn}
 	go spc.copyToBackend(errc)
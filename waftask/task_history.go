@@ -15,6 +15,7 @@ func TaskDeleteHistoryInfo() {
 	zlog.Debug("TaskDeleteHistoryInfo")
 	deleteBeforeDay := time.Now().AddDate(0, 0, -int(global.GDATA_DELETE_INTERVAL)).Format("2006-01-02 15:04")
 	waf_service.WafLogServiceApp.DeleteHistory(deleteBeforeDay)
+	waf_service.WafTunnelServiceApp.DeleteConnLogHistory(deleteBeforeDay)
 
 	// 清理过期的归档分片文件（高频切库后 live 库只存最近数据，真正的保留期回收靠删归档文件）
 	CleanExpiredArchiveShard()
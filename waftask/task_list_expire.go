@@ -0,0 +1,55 @@
+package waftask
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/enums"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/spec"
+	"SamWaf/service/waf_service"
+	"time"
+)
+
+// TaskListExpireSweep 清理到期的临时名单条目（IP/URL 黑白名单、IP组条目），并把受影响站点的最新名单重新下发给引擎。
+// 引擎侧在重建索引和匹配时已经跳过到期条目，这里负责把它们真正删掉，并让已经建好的索引及时剔除。
+func TaskListExpireSweep() {
+	innerLogName := "TaskListExpireSweep"
+	if global.GWAF_LOCAL_DB == nil {
+		return
+	}
+
+	result, err := waf_service.WafListExpireServiceApp.ClearExpiredApi(time.Now().Unix())
+	if err != nil {
+		zlog.Error(innerLogName, "清理到期名单条目失败", "error", err.Error())
+	}
+	if result.Deleted == 0 {
+		return
+	}
+
+	for _, hostCode := range result.BlockIpHosts {
+		var list []model.IPBlockList
+		global.GWAF_LOCAL_DB.Where("host_code = ? ", hostCode).Find(&list)
+		global.GWAF_CHAN_MSG <- spec.ChanCommonHost{HostCode: hostCode, Type: enums.ChanTypeBlockIP, Content: list}
+	}
+	for _, hostCode := range result.AllowIpHosts {
+		var list []model.IPAllowList
+		global.GWAF_LOCAL_DB.Where("host_code = ? ", hostCode).Find(&list)
+		global.GWAF_CHAN_MSG <- spec.ChanCommonHost{HostCode: hostCode, Type: enums.ChanTypeAllowIP, Content: list}
+	}
+	for _, hostCode := range result.BlockUrlHosts {
+		var list []model.URLBlockList
+		global.GWAF_LOCAL_DB.Where("host_code = ? ", hostCode).Find(&list)
+		global.GWAF_CHAN_MSG <- spec.ChanCommonHost{HostCode: hostCode, Type: enums.ChanTypeBlockURL, Content: list}
+	}
+	// IP组是原子替换匹配集，不需要给引用站点下发消息
+	for _, groupCode := range result.GroupCodes {
+		waf_service.WafIPGroupServiceApp.RebuildGroupMatcher(groupCode)
+	}
+
+	zlog.Info(innerLogName, "清理到期名单条目完成",
+		"清理数量", result.Deleted,
+		"IP黑名单站点", len(result.BlockIpHosts),
+		"IP白名单站点", len(result.AllowIpHosts),
+		"URL黑名单站点", len(result.BlockUrlHosts),
+		"IP组", len(result.GroupCodes))
+}
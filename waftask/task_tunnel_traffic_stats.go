@@ -0,0 +1,198 @@
+package waftask
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/common/zlog"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 隧道流量落库：隧道引擎在每条连接(UDP 会话)结束时把字节数累加进内存，
+// 这里按天/小时增量写进统计库。写法和站点流量(task_traffic_stats.go)一致：
+// 先 Update 累加，影响 0 行再 Create，单事务，失败整批退回内存。
+
+// tunnelStatAgg 合并后的一条增量（天级时 HourTime 为 0，小时级时 Day 仅作参考）
+type tunnelStatAgg struct {
+	TunnelCode string
+	TunnelName string
+	Day        int
+	HourTime   int64
+	Conns      int64
+	Denies     int64
+	In         int64
+	Out        int64
+}
+
+func (a *tunnelStatAgg) add(s global.TunnelTrafficSnapshot) {
+	a.Conns += s.Conns
+	a.Denies += s.Denies
+	a.In += s.In
+	a.Out += s.Out
+}
+
+// planTunnelTrafficUpserts 把 Drain 出来的桶合并成天级/小时级两组增量。纯函数，便于测试。
+func planTunnelTrafficUpserts(list []global.TunnelTrafficSnapshot) ([]tunnelStatAgg, []tunnelStatAgg) {
+	type dayKey struct {
+		TunnelCode string
+		Day        int
+	}
+	type hourKey struct {
+		TunnelCode string
+		HourTime   int64
+	}
+	dayMap := make(map[dayKey]*tunnelStatAgg)
+	hourMap := make(map[hourKey]*tunnelStatAgg)
+	var days, hours []*tunnelStatAgg
+
+	for _, s := range list {
+		if s.TunnelCode == "" || (s.Conns <= 0 && s.Denies <= 0 && s.In <= 0 && s.Out <= 0) {
+			continue
+		}
+		dk := dayKey{TunnelCode: s.TunnelCode, Day: s.Day}
+		d := dayMap[dk]
+		if d == nil {
+			d = &tunnelStatAgg{TunnelCode: s.TunnelCode, TunnelName: s.TunnelName, Day: s.Day}
+			dayMap[dk] = d
+			days = append(days, d)
+		}
+		d.add(s)
+
+		hk := hourKey{TunnelCode: s.TunnelCode, HourTime: s.HourTime}
+		h := hourMap[hk]
+		if h == nil {
+			h = &tunnelStatAgg{TunnelCode: s.TunnelCode, TunnelName: s.TunnelName, Day: s.Day, HourTime: s.HourTime}
+			hourMap[hk] = h
+			hours = append(hours, h)
+		}
+		h.add(s)
+	}
+
+	dayList := make([]tunnelStatAgg, 0, len(days))
+	for _, d := range days {
+		dayList = append(dayList, *d)
+	}
+	hourList := make([]tunnelStatAgg, 0, len(hours))
+	for _, h := range hours {
+		hourList = append(hourList, *h)
+	}
+	return dayList, hourList
+}
+
+// TaskTunnelTrafficFlush 定时任务入口（默认 30s 一次）
+func TaskTunnelTrafficFlush() {
+	FlushTunnelTrafficStats()
+}
+
+// FlushTunnelTrafficStats 把内存里累计的隧道流量落库。切库窗口内不取走增量。
+func FlushTunnelTrafficStats() {
+	if global.GWAF_LOCAL_STATS_DB == nil {
+		return
+	}
+	if global.GDATA_CURRENT_CHANGE {
+		zlog.Debug("隧道流量落库", "正在切换数据库，本轮跳过")
+		return
+	}
+
+	list := global.DrainTunnelTraffic()
+	if len(list) == 0 {
+		return
+	}
+
+	if err := writeTunnelTrafficStats(global.GWAF_LOCAL_STATS_DB, list); err != nil {
+		global.RestoreTunnelTraffic(list)
+		zlog.Error("隧道流量落库失败，已退回内存等待重试", "错误", err.Error(), "桶数", len(list))
+		return
+	}
+
+	// 小时级只保留最近3天，与站点小时统计一致
+	expireTs := time.Now().Add(-72 * time.Hour).Unix()
+	if err := global.GWAF_LOCAL_STATS_DB.
+		Where("hour_time < ?", expireTs).
+		Delete(&model.StatsTunnelHour{}).Error; err != nil {
+		zlog.Debug("清理过期隧道小时统计失败", "错误", err.Error())
+	}
+	zlog.Debug("隧道流量落库完成", "桶数", len(list))
+}
+
+// writeTunnelTrafficStats 单事务写入：要么全成，要么全退
+func writeTunnelTrafficStats(db *gorm.DB, list []global.TunnelTrafficSnapshot) error {
+	days, hours := planTunnelTrafficUpserts(list)
+	if len(days) == 0 && len(hours) == 0 {
+		return nil
+	}
+	now := customtype.JsonTime(time.Now())
+	newBase := func() baseorm.BaseOrm {
+		return baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: now,
+			UPDATE_TIME: now,
+		}
+	}
+	incr := func(a tunnelStatAgg) map[string]interface{} {
+		return map[string]interface{}{
+			"conn_count":  gorm.Expr("conn_count + ?", a.Conns),
+			"deny_count":  gorm.Expr("deny_count + ?", a.Denies),
+			"traffic_in":  gorm.Expr("traffic_in + ?", a.In),
+			"traffic_out": gorm.Expr("traffic_out + ?", a.Out),
+			"update_time": now,
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, d := range days {
+			res := tx.Model(&model.StatsTunnelDay{}).
+				Where("tenant_id = ? and user_code = ? and tunnel_code = ? and day = ?",
+					global.GWAF_TENANT_ID, global.GWAF_USER_CODE, d.TunnelCode, d.Day).
+				Updates(incr(d))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if err := tx.Create(&model.StatsTunnelDay{
+					BaseOrm:    newBase(),
+					TunnelCode: d.TunnelCode,
+					Day:        d.Day,
+					TunnelName: d.TunnelName,
+					ConnCount:  d.Conns,
+					DenyCount:  d.Denies,
+					TrafficIn:  d.In,
+					TrafficOut: d.Out,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, h := range hours {
+			res := tx.Model(&model.StatsTunnelHour{}).
+				Where("tenant_id = ? and user_code = ? and tunnel_code = ? and hour_time = ?",
+					global.GWAF_TENANT_ID, global.GWAF_USER_CODE, h.TunnelCode, h.HourTime).
+				Updates(incr(h))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if err := tx.Create(&model.StatsTunnelHour{
+					BaseOrm:    newBase(),
+					TunnelCode: h.TunnelCode,
+					HourTime:   h.HourTime,
+					TunnelName: h.TunnelName,
+					ConnCount:  h.Conns,
+					DenyCount:  h.Denies,
+					TrafficIn:  h.In,
+					TrafficOut: h.Out,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package waftask
+
+import (
+	"SamWaf/global"
+	"sort"
+	"testing"
+)
+
+// 隧道流量同样是「天合并、小时分开」，另外连接数/拒绝数要跟着字节一起合并
+func TestPlanTunnelTrafficUpserts_MergesDayKeepsHours(t *testing.T) {
+	list := []global.TunnelTrafficSnapshot{
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "t1", TunnelName: "mysql", Day: 20261018, HourTime: 1000}, Conns: 2, In: 10, Out: 100},
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "t1", TunnelName: "mysql", Day: 20261018, HourTime: 4600}, Conns: 1, Denies: 3, In: 5, Out: 50},
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "t2", TunnelName: "redis", Day: 20261018, HourTime: 1000}, Conns: 1, In: 7, Out: 8},
+	}
+
+	days, hours := planTunnelTrafficUpserts(list)
+	if len(days) != 2 {
+		t.Fatalf("天级增量应为 2 条，实际 %d: %+v", len(days), days)
+	}
+	if len(hours) != 3 {
+		t.Fatalf("小时级增量应为 3 条，实际 %d: %+v", len(hours), hours)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].TunnelCode < days[j].TunnelCode })
+	d := days[0]
+	if d.TunnelCode != "t1" || d.Conns != 3 || d.Denies != 3 || d.In != 15 || d.Out != 150 {
+		t.Fatalf("同一天的多个整点没合并对: %+v", d)
+	}
+	if d.TunnelName != "mysql" {
+		t.Fatalf("隧道名称没带上: %+v", d)
+	}
+	if days[1].TunnelCode != "t2" || days[1].In != 7 || days[1].Out != 8 {
+		t.Fatalf("不同隧道串账: %+v", days[1])
+	}
+}
+
+// 只有拒绝没有字节的桶也要落库（被拦的连接同样是审计关心的数）
+func TestPlanTunnelTrafficUpserts_DenyOnly(t *testing.T) {
+	list := []global.TunnelTrafficSnapshot{
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "", Day: 20261018, HourTime: 1000}, Denies: 1},
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "t1", Day: 20261018, HourTime: 1000}},
+		{TunnelTrafficKey: global.TunnelTrafficKey{TunnelCode: "t1", Day: 20261018, HourTime: 1000}, Denies: 4},
+	}
+	days, hours := planTunnelTrafficUpserts(list)
+	if len(days) != 1 || len(hours) != 1 {
+		t.Fatalf("应只保留 t1 的拒绝桶，实际 days=%d hours=%d", len(days), len(hours))
+	}
+	if days[0].Denies != 4 {
+		t.Fatalf("拒绝数不对: %+v", days[0])
+	}
+}
+
+// 库没就绪时不能把内存里的增量取走
+func TestFlushTunnelTrafficStats_KeepsDataWhenDBNotReady(t *testing.T) {
+	global.DrainTunnelTraffic()
+	oldDB := global.GWAF_LOCAL_STATS_DB
+	global.GWAF_LOCAL_STATS_DB = nil
+	defer func() { global.GWAF_LOCAL_STATS_DB = oldDB }()
+
+	global.AddTunnelTraffic("t1", "mysql", 20261018, 1000, 1, 0, 123, 456)
+	FlushTunnelTrafficStats()
+
+	list := global.DrainTunnelTraffic()
+	if len(list) != 1 || list[0].In != 123 || list[0].Out != 456 {
+		t.Fatalf("库未就绪时增量被丢了: %+v", list)
+	}
+}
@@ -0,0 +1,145 @@
+package waftunnelengine
+
+import (
+	"SamWaf/common/uuid"
+	"SamWaf/customtype"
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/baseorm"
+	"SamWaf/model/waftunnelmodel"
+	"SamWaf/utils"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connAudit 一条隧道连接(UDP 为一个会话)的审计记录。
+// 连接结束时调用 finish：写一行 tunnel_conn_log 进日志队列，并把字节数累加到隧道流量统计。
+type connAudit struct {
+	tunnel     model.Tunnel
+	protocol   string
+	serverPort int
+	clientIP   string
+	clientPort int
+	targetAddr string
+	start      time.Time
+	counter    *waftunnelmodel.ConnCounter
+	connId     string
+
+	reasonMu sync.Mutex
+	reason   string
+	finished atomic.Bool
+}
+
+func newConnAudit(tunnel model.Tunnel, protocol string, serverPort int, clientIP string, clientPort string) *connAudit {
+	cp, _ := strconv.Atoi(clientPort)
+	return &connAudit{
+		tunnel:     tunnel,
+		protocol:   protocol,
+		serverPort: serverPort,
+		clientIP:   clientIP,
+		clientPort: cp,
+		start:      time.Now(),
+		counter:    &waftunnelmodel.ConnCounter{},
+		connId:     waftunnelmodel.NewConnId(),
+	}
+}
+
+// setReason 记下最先发生的关闭原因，后来的不覆盖（两个方向谁先断谁说了算）
+func (a *connAudit) setReason(reason string) {
+	a.reasonMu.Lock()
+	if a.reason == "" {
+		a.reason = reason
+	}
+	a.reasonMu.Unlock()
+}
+
+// forceReason 外部关闭（手工断开、服务停止）时覆盖转发协程推断出来的原因：
+// 连接是被我们关掉的，转发协程看到的只是"对端断了"
+func (a *connAudit) forceReason(reason string) {
+	a.reasonMu.Lock()
+	a.reason = reason
+	a.reasonMu.Unlock()
+}
+
+// reasonFromCopyErr 根据转发结束时的错误推断关闭原因
+func reasonFromCopyErr(err error, peerClose string) string {
+	var netErr net.Error
+	if err != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		return model.TunnelCloseTimeout
+	}
+	return peerClose
+}
+
+// finish 结束审计。denyRule 非空表示该连接是被规则拒绝的。重复调用只生效一次。
+func (a *connAudit) finish(reason string, denyRule string) {
+	if !a.finished.CompareAndSwap(false, true) {
+		return
+	}
+	if reason != "" {
+		a.setReason(reason)
+	}
+	a.reasonMu.Lock()
+	closeReason := a.reason
+	a.reasonMu.Unlock()
+	end := time.Now()
+	in := a.counter.In.Load()
+	out := a.counter.Out.Load()
+
+	day, hourTime := global.TrafficBucketOf(end)
+	var conns, denies int64 = 1, 0
+	if denyRule != model.TunnelDenyNone || closeReason == model.TunnelCloseLimit {
+		conns, denies = 0, 1
+	}
+	global.AddTunnelTraffic(a.tunnel.Code, a.tunnel.Name, day, hourTime, conns, denies, in, out)
+
+	if global.GQEQUE_LOG_DB == nil {
+		return
+	}
+	region := utils.GetCountry(a.clientIP)
+	global.GQEQUE_LOG_DB.Enqueue(&model.TunnelConnLog{
+		BaseOrm: baseorm.BaseOrm{
+			Id:          uuid.GenUUID(),
+			USER_CODE:   global.GWAF_USER_CODE,
+			Tenant_ID:   global.GWAF_TENANT_ID,
+			CREATE_TIME: customtype.JsonTime(end),
+			UPDATE_TIME: customtype.JsonTime(end),
+		},
+		TunnelCode:  a.tunnel.Code,
+		TunnelName:  a.tunnel.Name,
+		Protocol:    a.protocol,
+		ServerPort:  a.serverPort,
+		ClientIP:    a.clientIP,
+		ClientPort:  a.clientPort,
+		TargetAddr:  a.targetAddr,
+		Country:     region[0],
+		Province:    region[2],
+		City:        region[3],
+		StartTime:   a.start.UnixMilli(),
+		EndTime:     end.UnixMilli(),
+		Duration:    end.Sub(a.start).Milliseconds(),
+		BytesIn:     in,
+		BytesOut:    out,
+		CloseReason: closeReason,
+		DenyRule:    denyRule,
+		Day:         day,
+	})
+}
+
+// countingWriter 转发时顺带计数，控制台能看到存活连接的实时字节数
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if n > 0 {
+		c.n.Add(int64(n))
+	}
+	return n, err
+}
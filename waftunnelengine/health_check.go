@@ -0,0 +1,140 @@
+package waftunnelengine
+
+import (
+	"SamWaf/common/zlog"
+	"SamWaf/global"
+	"SamWaf/model/waftunnelmodel"
+	"fmt"
+	"net"
+	"time"
+)
+
+// startHealthCheck 启动目标健康检测协程。每秒看一次哪些隧道到了探测时间，各隧道的间隔独立配置。
+func (waf *WafTunnelEngine) startHealthCheck() {
+	waf.healthMu.Lock()
+	defer waf.healthMu.Unlock()
+	if waf.healthStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	waf.healthStop = stop
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				zlog.Warn("tunnel health check recover ", e)
+			}
+		}()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				if global.GWAF_SHUTDOWN_SIGNAL {
+					return
+				}
+				waf.balancers.Range(func(_, value any) bool {
+					b := value.(*tunnelBalancer)
+					if b.health.IsEnableHealthy != 1 {
+						return true
+					}
+					b.mu.Lock()
+					due := !now.Before(b.nextCheck)
+					if due {
+						b.nextCheck = now.Add(time.Duration(b.health.Interval) * time.Second)
+					}
+					b.mu.Unlock()
+					// 上一轮还没探完（目标超时较多）就跳过，不叠加
+					if due && b.probing.CompareAndSwap(false, true) {
+						go func() {
+							defer b.probing.Store(false)
+							b.probeAll()
+						}()
+					}
+					return true
+				})
+			}
+		}
+	}()
+}
+
+// stopHealthCheck 停止健康检测协程
+func (waf *WafTunnelEngine) stopHealthCheck() {
+	waf.healthMu.Lock()
+	defer waf.healthMu.Unlock()
+	if waf.healthStop != nil {
+		close(waf.healthStop)
+		waf.healthStop = nil
+	}
+}
+
+// probeAll 对隧道的每个目标做一次 TCP 建连探测
+func (b *tunnelBalancer) probeAll() {
+	b.mu.Lock()
+	nodes := append([]*tunnelTargetNode(nil), b.nodes...)
+	b.mu.Unlock()
+
+	timeout := time.Duration(b.health.Timeout) * time.Second
+	for _, n := range nodes {
+		conn, err := net.DialTimeout("tcp", n.probeAddr, timeout)
+		if err == nil {
+			conn.Close()
+		}
+		b.updateHealth(n, err)
+	}
+}
+
+// updateHealth 连续失败 FailCount 次摘除，连续成功 SuccessCount 次恢复
+func (b *tunnelBalancer) updateHealth(n *tunnelTargetNode, probeErr error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n.lastCheck = time.Now()
+	if probeErr == nil {
+		n.successCount++
+		n.failCount = 0
+		n.lastError = ""
+		if !n.healthy.Load() && n.successCount >= b.health.SuccessCount {
+			n.healthy.Store(true)
+			zlog.Info("隧道健康检测", "目标恢复健康", fmt.Sprintf("隧道:%s 目标:%s", b.tunnelCode, n.addr))
+		}
+		if n.successCount > 1000 {
+			n.successCount = b.health.SuccessCount
+		}
+		return
+	}
+	n.failCount++
+	n.successCount = 0
+	n.lastError = probeErr.Error()
+	if n.healthy.Load() && n.failCount >= b.health.FailCount {
+		n.healthy.Store(false)
+		zlog.Info("隧道健康检测", "目标不健康已摘除", fmt.Sprintf("隧道:%s 目标:%s 原因:%s", b.tunnelCode, n.addr, n.lastError))
+	}
+	if n.failCount > 1000 {
+		n.failCount = b.health.FailCount
+	}
+}
+
+// status 导出目标运行状态
+func (b *tunnelBalancer) status() []waftunnelmodel.TunnelTargetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]waftunnelmodel.TunnelTargetStatus, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		st := waftunnelmodel.TunnelTargetStatus{
+			Index:        n.index,
+			Addr:         n.addr,
+			Weight:       n.weight,
+			Healthy:      n.healthy.Load(),
+			ActiveConns:  n.active.Load(),
+			FailCount:    n.failCount,
+			SuccessCount: n.successCount,
+			LastError:    n.lastError,
+		}
+		if !n.lastCheck.IsZero() {
+			st.LastCheck = n.lastCheck.UnixMilli()
+		}
+		list = append(list, st)
+	}
+	return list
+}
@@ -0,0 +1,252 @@
+package waftunnelengine
+
+import (
+	"SamWaf/global"
+	"SamWaf/model"
+	"SamWaf/model/waftunnelmodel"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 隧道多目标负载。与站点负载(wafenginecore/loadbalance)的区别：
+//   - 隧道是长连接，最少连接数比请求级的轮询更有意义，所以多了一种策略；
+//   - 源地址哈希用加权最高随机权重(rendezvous)而不是一致性哈希环，
+//     某个目标被摘除时只有原本落在它上面的客户端会迁移；
+//   - UDP 会话在建立时选一次目标，之后整个会话都固定在该目标上。
+
+// tunnelTargetNode 运行时的一个目标
+type tunnelTargetNode struct {
+	index     int
+	addr      string // ip:port
+	probeAddr string // 健康探测地址
+	weight    int
+
+	currentWeight int // 平滑加权轮询的临时权重，受 tunnelBalancer.mu 保护
+
+	active  *atomic.Int64 // 当前经由该目标的连接数(UDP 为会话数)；重载时同地址目标共用，存量连接结束时才能正确扣减
+	healthy atomic.Bool
+
+	// 以下字段只由健康检测协程读写，展示时在 mu 下拷贝
+	failCount    int
+	successCount int
+	lastError    string
+	lastCheck    time.Time
+}
+
+// tunnelBalancer 一个隧道的全部目标
+type tunnelBalancer struct {
+	tunnelCode string
+	stage      int
+	health     model.TunnelHealthyConfig
+
+	mu        sync.Mutex
+	nodes     []*tunnelTargetNode
+	nextCheck time.Time
+	probing   atomic.Bool
+}
+
+// parseTunnelHealthyConfig 解析健康检测配置并补默认值
+func parseTunnelHealthyConfig(healthyJSON string) model.TunnelHealthyConfig {
+	var cfg model.TunnelHealthyConfig
+	if healthyJSON != "" {
+		_ = json.Unmarshal([]byte(healthyJSON), &cfg)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3
+	}
+	if cfg.FailCount <= 0 {
+		cfg.FailCount = 3
+	}
+	if cfg.SuccessCount <= 0 {
+		cfg.SuccessCount = 2
+	}
+	return cfg
+}
+
+// newTunnelBalancer 根据隧道配置和目标列表建立负载器。targets 的顺序即目标编号。
+func newTunnelBalancer(tunnel model.Tunnel, targets []model.TunnelLoadBalance) *tunnelBalancer {
+	b := &tunnelBalancer{
+		tunnelCode: tunnel.Code,
+		stage:      tunnel.LoadBalanceStage,
+		health:     parseTunnelHealthyConfig(tunnel.HealthyJSON),
+	}
+	for i, t := range targets {
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		probePort := t.RemotePort
+		if b.health.ProbePort > 0 {
+			probePort = b.health.ProbePort
+		}
+		node := &tunnelTargetNode{
+			index:     i,
+			addr:      net.JoinHostPort(t.RemoteIp, strconv.Itoa(t.RemotePort)),
+			probeAddr: net.JoinHostPort(t.RemoteIp, strconv.Itoa(probePort)),
+			weight:    weight,
+			active:    &atomic.Int64{},
+		}
+		node.healthy.Store(true)
+		b.nodes = append(b.nodes, node)
+	}
+	return b
+}
+
+// inheritState 配置重载时沿用同地址目标的健康状态和活跃连接数，避免编辑一下隧道就把已摘除的目标放回来
+func (b *tunnelBalancer) inheritState(old *tunnelBalancer) {
+	if old == nil {
+		return
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	byAddr := make(map[string]*tunnelTargetNode, len(old.nodes))
+	for _, n := range old.nodes {
+		byAddr[n.addr] = n
+	}
+	for _, n := range b.nodes {
+		if o, ok := byAddr[n.addr]; ok {
+			n.healthy.Store(o.healthy.Load())
+			n.active = o.active
+			n.failCount = o.failCount
+			n.successCount = o.successCount
+			n.lastError = o.lastError
+			n.lastCheck = o.lastCheck
+		}
+	}
+}
+
+// pick 为一个客户端选目标。全部目标都不健康时退化为在全部目标里选，宁可尝试也不直接拒绝。
+// 返回的节点已经计入 active，用完必须调用 release。
+func (b *tunnelBalancer) pick(clientIP string) *tunnelTargetNode {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.nodes) == 0 {
+		return nil
+	}
+
+	candidates := make([]*tunnelTargetNode, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		if n.healthy.Load() {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.nodes
+	}
+
+	var best *tunnelTargetNode
+	switch b.stage {
+	case model.TunnelLBLeastConn:
+		best = pickLeastConn(candidates)
+	case model.TunnelLBSourceHash:
+		best = pickSourceHash(candidates, clientIP)
+	default:
+		best = pickWeightedRoundRobin(candidates)
+	}
+	best.active.Add(1)
+	return best
+}
+
+// release 连接结束
+func (n *tunnelTargetNode) release() {
+	n.active.Add(-1)
+}
+
+// pickWeightedRoundRobin 平滑加权轮询，与 nginx 的做法一致
+func pickWeightedRoundRobin(nodes []*tunnelTargetNode) *tunnelTargetNode {
+	total := 0
+	var best *tunnelTargetNode
+	for _, n := range nodes {
+		total += n.weight
+		n.currentWeight += n.weight
+		if best == nil || n.currentWeight > best.currentWeight {
+			best = n
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// pickLeastConn 活跃连接数/权重 最小者；相同时取编号小的
+func pickLeastConn(nodes []*tunnelTargetNode) *tunnelTargetNode {
+	var best *tunnelTargetNode
+	var bestActive int64
+	for _, n := range nodes {
+		active := n.active.Load()
+		// active/weight < bestActive/best.weight，交叉相乘避免浮点
+		if best == nil || active*int64(best.weight) < bestActive*int64(n.weight) {
+			best = n
+			bestActive = active
+		}
+	}
+	return best
+}
+
+// pickSourceHash 加权 rendezvous 哈希：对每个目标算 -weight/ln(h)，取最大
+func pickSourceHash(nodes []*tunnelTargetNode, clientIP string) *tunnelTargetNode {
+	var best *tunnelTargetNode
+	bestScore := math.Inf(-1)
+	for _, n := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(clientIP))
+		h.Write([]byte{'|'})
+		h.Write([]byte(n.addr))
+		// 映射到 (0,1) 开区间
+		u := (float64(h.Sum64()>>11) + 0.5) / float64(uint64(1)<<53)
+		score := -float64(n.weight) / math.Log(u)
+		if score > bestScore {
+			best = n
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// reloadBalancer 按最新配置重建隧道的负载器。未启用负载或没有目标时删除，回到单目标 RemoteIp/RemotePort。
+func (waf *WafTunnelEngine) reloadBalancer(tunnel model.Tunnel) {
+	if tunnel.Code == "" {
+		return
+	}
+	if tunnel.IsEnableLoadBalance != 1 || global.GWAF_LOCAL_DB == nil {
+		waf.balancers.Delete(tunnel.Code)
+		return
+	}
+	var targets []model.TunnelLoadBalance
+	global.GWAF_LOCAL_DB.Where("tunnel_code = ?", tunnel.Code).Order("create_time asc").Find(&targets)
+	if len(targets) == 0 {
+		waf.balancers.Delete(tunnel.Code)
+		return
+	}
+	b := newTunnelBalancer(tunnel, targets)
+	if old, ok := waf.balancers.Load(tunnel.Code); ok {
+		b.inheritState(old.(*tunnelBalancer))
+	}
+	waf.balancers.Store(tunnel.Code, b)
+}
+
+// pickTarget 为新连接(UDP 为新会话)选目标地址。release 在连接结束时调用，用于最少连接数统计。
+func (waf *WafTunnelEngine) pickTarget(tunnel model.Tunnel, clientIP string) (addr string, release func()) {
+	if v, ok := waf.balancers.Load(tunnel.Code); ok {
+		if node := v.(*tunnelBalancer).pick(clientIP); node != nil {
+			return node.addr, node.release
+		}
+	}
+	return net.JoinHostPort(tunnel.RemoteIp, strconv.Itoa(tunnel.RemotePort)), func() {}
+}
+
+// GetTargetStatus 隧道各目标的健康状态和连接数。未启用负载时返回 nil。
+func (waf *WafTunnelEngine) GetTargetStatus(tunnelCode string) []waftunnelmodel.TunnelTargetStatus {
+	if v, ok := waf.balancers.Load(tunnelCode); ok {
+		return v.(*tunnelBalancer).status()
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package waftunnelengine
+
+import (
+	"SamWaf/global"
+	"SamWaf/model"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	sqlite "github.com/samwafgo/sqlitedriver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestBalancer(stage int, weights ...int) *tunnelBalancer {
+	targets := make([]model.TunnelLoadBalance, 0, len(weights))
+	for i, w := range weights {
+		targets = append(targets, model.TunnelLoadBalance{RemoteIp: "10.0.0." + strconv.Itoa(i+1), RemotePort: 6379, Weight: w})
+	}
+	return newTunnelBalancer(model.Tunnel{Code: "t1", LoadBalanceStage: stage}, targets)
+}
+
+// 加权轮询按权重比例分配，且不连续扎堆
+func TestTunnelBalancer_WeightedRoundRobin(t *testing.T) {
+	b := newTestBalancer(model.TunnelLBRoundRobin, 3, 1)
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		n := b.pick("1.1.1.1")
+		counts[n.addr]++
+		n.release()
+	}
+	if counts["10.0.0.1:6379"] != 6 || counts["10.0.0.2:6379"] != 2 {
+		t.Fatalf("权重 3:1 分配不对: %v", counts)
+	}
+}
+
+// 最少连接：连接不释放时新连接应落到空闲目标
+func TestTunnelBalancer_LeastConn(t *testing.T) {
+	b := newTestBalancer(model.TunnelLBLeastConn, 1, 1)
+	first := b.pick("1.1.1.1")
+	second := b.pick("1.1.1.2")
+	if first == second {
+		t.Fatalf("第二条连接应落到另一个目标")
+	}
+	second.release()
+	third := b.pick("1.1.1.3")
+	if third != second {
+		t.Fatalf("释放后应回到连接数少的目标，实际 %s", third.addr)
+	}
+}
+
+// 源地址哈希：同一IP固定；摘除其他目标不影响原本不在其上的客户端
+func TestTunnelBalancer_SourceHashSticky(t *testing.T) {
+	b := newTestBalancer(model.TunnelLBSourceHash, 1, 1, 1)
+	before := map[string]*tunnelTargetNode{}
+	for i := 0; i < 50; i++ {
+		ip := "192.168.1." + strconv.Itoa(i)
+		n := b.pick(ip)
+		n.release()
+		if again := b.pick(ip); again != n {
+			t.Fatalf("同一IP两次选到不同目标: %s", ip)
+		} else {
+			again.release()
+		}
+		before[ip] = n
+	}
+
+	down := b.nodes[0]
+	down.healthy.Store(false)
+	for ip, n := range before {
+		got := b.pick(ip)
+		got.release()
+		if got == down {
+			t.Fatalf("不健康目标不应被选中")
+		}
+		if n != down && got != n {
+			t.Fatalf("摘除无关目标后客户端 %s 发生了迁移", ip)
+		}
+	}
+}
+
+// 全部不健康时退化为在全部目标中选，不返回空
+func TestTunnelBalancer_AllUnhealthyFallback(t *testing.T) {
+	b := newTestBalancer(model.TunnelLBRoundRobin, 1, 1)
+	for _, n := range b.nodes {
+		n.healthy.Store(false)
+	}
+	if n := b.pick("1.1.1.1"); n == nil {
+		t.Fatalf("全部不健康时也应返回一个目标")
+	}
+}
+
+// 连续失败达到阈值才摘除，连续成功达到阈值才恢复
+func TestTunnelBalancer_HealthThreshold(t *testing.T) {
+	b := newTestBalancer(model.TunnelLBRoundRobin, 1)
+	n := b.nodes[0]
+	probeErr := errors.New("connection refused")
+	b.updateHealth(n, probeErr)
+	b.updateHealth(n, probeErr)
+	if !n.healthy.Load() {
+		t.Fatalf("未到失败阈值不应摘除")
+	}
+	b.updateHealth(n, probeErr)
+	if n.healthy.Load() {
+		t.Fatalf("连续失败 3 次应摘除")
+	}
+	b.updateHealth(n, nil)
+	if n.healthy.Load() {
+		t.Fatalf("成功 1 次不应立即恢复")
+	}
+	b.updateHealth(n, nil)
+	if !n.healthy.Load() {
+		t.Fatalf("连续成功 2 次应恢复")
+	}
+}
+
+// 重载时同地址目标沿用健康状态与连接计数，存量连接释放后计数不漂移
+func TestTunnelBalancer_InheritState(t *testing.T) {
+	old := newTestBalancer(model.TunnelLBLeastConn, 1, 1)
+	old.nodes[1].healthy.Store(false)
+	live := old.pick("1.1.1.1")
+
+	b := newTestBalancer(model.TunnelLBLeastConn, 1, 1)
+	b.inheritState(old)
+	if b.nodes[1].healthy.Load() {
+		t.Fatalf("重载不应把已摘除目标放回来")
+	}
+	live.release()
+	if b.nodes[0].active.Load() != 0 {
+		t.Fatalf("存量连接释放后新负载器计数应归零，实际 %d", b.nodes[0].active.Load())
+	}
+}
+
+// 编辑隧道需要重启服务(如切换 SSL)时，重建的负载器仍沿用各目标的健康状态
+func TestEditTunnelRestartKeepsTargetHealth(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tunnel_test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.TunnelLoadBalance{}); err != nil {
+		t.Fatalf("AutoMigrate 失败: %v", err)
+	}
+	oldDB := global.GWAF_LOCAL_DB
+	global.GWAF_LOCAL_DB = db
+	t.Cleanup(func() {
+		global.GWAF_LOCAL_DB = oldDB
+		if sqlDB, e := db.DB(); e == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	for i := 1; i <= 2; i++ {
+		target := model.TunnelLoadBalance{TunnelCode: "t1", RemoteIp: "10.0.0." + strconv.Itoa(i), RemotePort: 6379, Weight: 1}
+		target.Id = "lb" + strconv.Itoa(i)
+		db.Create(&target)
+	}
+
+	waf := NewWafTunnelEngine()
+	oldTunnel := model.Tunnel{Code: "t1", Protocol: "tcp", Port: "16379", StartStatus: 1, IsEnableLoadBalance: 1}
+	waf.LoadTunnel(oldTunnel)
+	v, ok := waf.balancers.Load("t1")
+	if !ok {
+		t.Fatal("启用负载后应建立负载器")
+	}
+	v.(*tunnelBalancer).nodes[1].healthy.Store(false)
+
+	newTunnel := oldTunnel
+	newTunnel.SSLStatus = 1
+	waf.EditTunnel(oldTunnel, newTunnel)
+	v, ok = waf.balancers.Load("t1")
+	if !ok {
+		t.Fatal("重启后应重新建立负载器")
+	}
+	if v.(*tunnelBalancer).nodes[1].healthy.Load() {
+		t.Fatal("重启服务不应把已摘除的目标放回来")
+	}
+}
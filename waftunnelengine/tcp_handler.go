@@ -2,6 +2,7 @@ package waftunnelengine
 
 import (
 	"SamWaf/common/zlog"
+	"SamWaf/model"
 	"SamWaf/model/waftunnelmodel"
 	"context"
 	"crypto/tls"
@@ -173,6 +174,7 @@ func (waf *WafTunnelEngine) startTCPServer(netRuntime waftunnelmodel.NetRunTime)
 				zlog.Warn(fmt.Sprintf("TCP入站连接数超过限制 [客户端IP:%s 客户端端口:%s 服务端口:%s 当前连接数:%d 最大限制:%d]",
 					clientIP, clientPort, serverPort, inConnCount, tunnelInfo.Tunnel.MaxInConnect))
 				conn.Close()
+				newConnAudit(tunnelInfo.Tunnel, "tcp", netRuntime.Port, clientIP, clientPort).finish(model.TunnelCloseLimit, model.TunnelDenyNone)
 				continue
 			}
 		}
@@ -203,25 +205,39 @@ func (waf *WafTunnelEngine) handleTCPConnection(clientConn net.Conn, port int) {
 		return
 	}
 
+	audit := newConnAudit(tunnelInfo.Tunnel, "tcp", port, clientIP, clientPort)
+
 	// 检查IP访问权限
 	if !CheckIPAccess("TCP", clientIP, clientPort, serverPort, tunnelInfo.Tunnel) {
 		zlog.Warn(fmt.Sprintf("TCP连接被拒绝 [客户端IP:%s 客户端端口:%s 服务端口:%s]", clientIP, clientPort, serverPort))
 		clientConn.Close()
+		audit.finish(model.TunnelCloseDenied, model.TunnelDenyIP)
 		return
 	}
 
 	// 检查时间访问权限
 	if !CheckTimeAccess("TCP", clientIP, clientPort, serverPort, tunnelInfo.Tunnel) {
 		clientConn.Close()
+		audit.finish(model.TunnelCloseDenied, model.TunnelDenyTime)
 		return
 	}
 
 	// 将客户端连接添加到活动连接列表，标记为来源连接
-
-	waf.TCPConnections.AddConn(port, clientConn, waftunnelmodel.ConnTypeSource)
+	waf.TCPConnections.AddConnInfo(port, clientConn, waftunnelmodel.ConnInfo{
+		ConnType: waftunnelmodel.ConnTypeSource,
+		Id:       audit.connId,
+		Counter:  audit.counter,
+	})
 	defer func() {
 		clientConn.Close()
+		// 被手工断开或整端口清理（服务停止）时，以外部原因为准
+		if reason, exists := waf.TCPConnections.CloseReasonOf(port, clientConn); !exists {
+			audit.forceReason(model.TunnelCloseStop)
+		} else if reason != "" {
+			audit.forceReason(reason)
+		}
 		waf.TCPConnections.RemoveConn(port, clientConn)
+		audit.finish("", model.TunnelDenyNone)
 	}()
 
 	// 检查出站连接数限制
@@ -230,21 +246,29 @@ func (waf *WafTunnelEngine) handleTCPConnection(clientConn net.Conn, port int) {
 		if outConnCount >= tunnelInfo.Tunnel.MaxOutConnect {
 			zlog.Warn(fmt.Sprintf("TCP出站连接数超过限制 [客户端IP:%s 客户端端口:%s 服务端口:%s 当前连接数:%d 最大限制:%d]",
 				clientIP, clientPort, serverPort, outConnCount, tunnelInfo.Tunnel.MaxOutConnect))
+			audit.setReason(model.TunnelCloseLimit)
 			return
 		}
 	}
 
-	// 连接到目标服务器
-	targetAddr := tunnelInfo.Tunnel.RemoteIp + ":" + strconv.Itoa(tunnelInfo.Tunnel.RemotePort)
+	// 连接到目标服务器（启用多目标负载时由负载策略挑选）
+	targetAddr, releaseTarget := waf.pickTarget(tunnelInfo.Tunnel, clientIP)
+	defer releaseTarget()
+	audit.targetAddr = targetAddr
 	targetConn, err := net.Dial("tcp", targetAddr)
 	if err != nil {
 		zlog.Error(fmt.Sprintf("连接目标服务器失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 目标地址:%s 错误:%s]",
 			clientIP, clientPort, serverPort, targetAddr, err.Error()))
+		audit.setReason(model.TunnelCloseDial)
 		return
 	}
 
-	// 将目标连接也添加到活动连接列表，标记为目标连接
-	waf.TCPConnections.AddConn(port, targetConn, waftunnelmodel.ConnTypeTarget)
+	// 将目标连接也添加到活动连接列表，标记为目标连接（与来源连接共用同一个ID，手工断开时两端一起关）
+	waf.TCPConnections.AddConnInfo(port, targetConn, waftunnelmodel.ConnInfo{
+		ConnType: waftunnelmodel.ConnTypeTarget,
+		Id:       audit.connId,
+		Counter:  audit.counter,
+	})
 	defer func() {
 		targetConn.Close()
 		waf.TCPConnections.RemoveConn(port, targetConn)
@@ -281,7 +305,8 @@ func (waf *WafTunnelEngine) handleTCPConnection(clientConn net.Conn, port int) {
 		defer cancel() // 任一方向断开时取消context
 
 		// 使用io.Copy，当连接断开时会自动返回
-		_, err := io.Copy(targetConn, clientConn)
+		_, err := io.Copy(&countingWriter{w: targetConn, n: &audit.counter.In}, clientConn)
+		audit.setReason(reasonFromCopyErr(err, model.TunnelCloseClient))
 		if err != nil {
 			zlog.Error(fmt.Sprintf("客户端->目标 数据转发结束 [客户端IP:%s 客户端端口:%s 服务端口:%s 错误:%s]",
 				clientIP, clientPort, serverPort, err.Error()))
@@ -297,7 +322,8 @@ func (waf *WafTunnelEngine) handleTCPConnection(clientConn net.Conn, port int) {
 		defer cancel() // 任一方向断开时取消context
 
 		// 使用io.Copy，当连接断开时会自动返回
-		_, err := io.Copy(clientConn, targetConn)
+		_, err := io.Copy(&countingWriter{w: clientConn, n: &audit.counter.Out}, targetConn)
+		audit.setReason(reasonFromCopyErr(err, model.TunnelCloseTarget))
 		if err != nil {
 			zlog.Error(fmt.Sprintf("目标->客户端 数据转发结束 [客户端IP:%s 客户端端口:%s 服务端口:%s 错误:%s]",
 				clientIP, clientPort, serverPort, err.Error()))
@@ -2,10 +2,15 @@ package waftunnelengine
 
 import (
 	"SamWaf/common/zlog"
+	"SamWaf/global"
+	"SamWaf/model"
 	"SamWaf/model/waftunnelmodel"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -108,8 +113,10 @@ func (waf *WafTunnelEngine) startUDPServer(netRuntime waftunnelmodel.NetRunTime)
 	serverPort := strconv.Itoa(netRuntime.Port)
 	zlog.Info(fmt.Sprintf("启动UDP服务器 [服务端口:%s]", serverPort))
 
-	// 处理UDP数据
-	buffer := make([]byte, 1024)
+	sessions := newUDPSessionTable()
+
+	// 处理UDP数据。64KB 足够装下任何 UDP 报文，避免大包被截断
+	buffer := make([]byte, 65535)
 	for {
 		n, remoteAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
@@ -117,6 +124,12 @@ func (waf *WafTunnelEngine) startUDPServer(netRuntime waftunnelmodel.NetRunTime)
 			break
 		}
 
+		// 已有会话：直接转发，访问控制在建会话时已经做过
+		if sess, ok := sessions.get(remoteAddr.String()); ok {
+			sess.forward(buffer[:n])
+			continue
+		}
+
 		// 获取客户端信息用于日志
 		clientIP := remoteAddr.IP.String()
 		clientPort := strconv.Itoa(remoteAddr.Port)
@@ -129,68 +142,167 @@ func (waf *WafTunnelEngine) startUDPServer(netRuntime waftunnelmodel.NetRunTime)
 			continue
 		}
 
-		// 检查入站连接数限制
-		if tunnelInfo.Tunnel.MaxInConnect > 0 {
-			inConnCount := waf.UDPConnections.GetPortConnsCountByType(netRuntime.Port, waftunnelmodel.ConnTypeSource)
-			if inConnCount >= tunnelInfo.Tunnel.MaxInConnect {
-				zlog.Warn(fmt.Sprintf("UDP入站连接数超过限制 [客户端IP:%s 客户端端口:%s 服务端口:%s 当前连接数:%d 最大限制:%d]",
-					clientIP, clientPort, serverPort, inConnCount, tunnelInfo.Tunnel.MaxInConnect))
-				continue
-			}
-		}
-
-		// 处理UDP数据
-		go waf.handleUDPData(conn, remoteAddr, buffer[:n], netRuntime.Port)
+		// 新会话在读循环里同步建立：UDP Dial 不走网络，很快；同时避免把复用中的 buffer 交给别的协程
+		waf.openUDPSession(conn, remoteAddr, buffer[:n], netRuntime.Port, tunnelInfo.Tunnel, sessions)
 	}
 
 	zlog.Info(fmt.Sprintf("UDP服务器关闭 [服务端口:%s]", serverPort))
+	sessions.closeAll()
 	waf.UDPConnections.RemoveConn(netRuntime.Port, conn)
 }
 
-// handleUDPData 处理UDP数据
-func (waf *WafTunnelEngine) handleUDPData(serverConn *net.UDPConn, clientAddr *net.UDPAddr, data []byte, port int) {
+// udpSession 一个客户端地址对应一个会话：会话内的报文都走同一条目标连接，
+// 目标的回包由会话自己的读协程送回客户端。会话空闲超时后关闭并落一条审计日志。
+type udpSession struct {
+	clientAddr *net.UDPAddr
+	targetConn *net.UDPConn
+	audit      *connAudit
+	release    func()       // 会话结束时归还负载目标的连接计数
+	lastActive atomic.Int64 // unix纳秒
+}
+
+// forward 客户端->目标
+func (s *udpSession) forward(data []byte) {
+	s.lastActive.Store(time.Now().UnixNano())
+	n, err := s.targetConn.Write(data)
+	if n > 0 {
+		s.audit.counter.In.Add(int64(n))
+	}
+	if err != nil {
+		zlog.Debug(fmt.Sprintf("发送数据到目标失败 [客户端地址:%s 错误:%s]", s.clientAddr.String(), err.Error()))
+	}
+}
+
+// udpSessionTable 单个 UDP 监听上的会话表
+type udpSessionTable struct {
+	mu    sync.Mutex
+	items map[string]*udpSession
+}
+
+func newUDPSessionTable() *udpSessionTable {
+	return &udpSessionTable{items: make(map[string]*udpSession)}
+}
+
+func (t *udpSessionTable) get(key string) (*udpSession, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.items[key]
+	return s, ok
+}
+
+func (t *udpSessionTable) set(key string, s *udpSession) {
+	t.mu.Lock()
+	t.items[key] = s
+	t.mu.Unlock()
+}
+
+func (t *udpSessionTable) remove(key string, s *udpSession) {
+	t.mu.Lock()
+	if cur, ok := t.items[key]; ok && cur == s {
+		delete(t.items, key)
+	}
+	t.mu.Unlock()
+}
+
+func (t *udpSessionTable) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.items)
+}
+
+// closeAll 监听关闭时收掉所有会话（读协程随之退出并各自落审计）
+func (t *udpSessionTable) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.items {
+		s.audit.forceReason(model.TunnelCloseStop)
+		s.targetConn.Close()
+	}
+}
+
+// udpIdleTimeout UDP 会话空闲超时：优先用读取超时，未配置时 60 秒
+func udpIdleTimeout(tunnel model.Tunnel) time.Duration {
+	if tunnel.ReadTimeout > 0 {
+		return time.Duration(tunnel.ReadTimeout) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// udpDenyLogOnce 同一来源被拒绝时，一分钟内只落一条审计，防止 UDP 洪水把日志库刷爆
+func udpDenyLogOnce(port int, clientIP string, rule string) bool {
+	key := "tunnel_udp_deny_" + strconv.Itoa(port) + "_" + rule + "_" + clientIP
+	if global.GCACHE_WAFCACHE == nil {
+		return true
+	}
+	if global.GCACHE_WAFCACHE.IsKeyExist(key) {
+		return false
+	}
+	global.GCACHE_WAFCACHE.SetWithTTl(key, "1", time.Minute)
+	return true
+}
+
+// openUDPSession 为新的客户端地址做访问控制并建立会话
+func (waf *WafTunnelEngine) openUDPSession(serverConn *net.UDPConn, clientAddr *net.UDPAddr, data []byte, port int, tunnel model.Tunnel, sessions *udpSessionTable) {
 	// 获取客户端IP和端口
 	clientIP := clientAddr.IP.String()
 	clientPort := strconv.Itoa(clientAddr.Port)
 	serverPort := strconv.Itoa(port)
 
-	// 获取隧道配置
-	tunnelInfo, ok := waf.TunnelTarget.Get("udp" + strconv.Itoa(port))
-	if !ok {
-		zlog.Error(fmt.Sprintf("未找到端口对应的隧道配置 [客户端IP:%s 客户端端口:%s 服务端口:%s]",
-			clientIP, clientPort, serverPort))
-		return
-	}
+	audit := newConnAudit(tunnel, "udp", port, clientIP, clientPort)
 
 	// 检查IP访问权限
-	if !CheckIPAccess("UDP", clientIP, clientPort, serverPort, tunnelInfo.Tunnel) {
+	if !CheckIPAccess("UDP", clientIP, clientPort, serverPort, tunnel) {
 		zlog.Warn(fmt.Sprintf("UDP数据被拒绝 [客户端IP:%s 客户端端口:%s 服务端口:%s]",
 			clientIP, clientPort, serverPort))
+		if udpDenyLogOnce(port, clientIP, model.TunnelDenyIP) {
+			audit.finish(model.TunnelCloseDenied, model.TunnelDenyIP)
+		}
 		return
 	}
 
 	// 检查时间访问权限
-	if !CheckTimeAccess("UDP", clientIP, clientPort, serverPort, tunnelInfo.Tunnel) {
+	if !CheckTimeAccess("UDP", clientIP, clientPort, serverPort, tunnel) {
+		if udpDenyLogOnce(port, clientIP, model.TunnelDenyTime) {
+			audit.finish(model.TunnelCloseDenied, model.TunnelDenyTime)
+		}
 		return
 	}
 
-	// 检查出站连接数限制
+	// 检查入站连接数限制（UDP 以会话数计）
+	if tunnel.MaxInConnect > 0 {
+		inConnCount := sessions.count()
+		if inConnCount >= tunnel.MaxInConnect {
+			zlog.Warn(fmt.Sprintf("UDP入站连接数超过限制 [客户端IP:%s 客户端端口:%s 服务端口:%s 当前连接数:%d 最大限制:%d]",
+				clientIP, clientPort, serverPort, inConnCount, tunnel.MaxInConnect))
+			if udpDenyLogOnce(port, clientIP, model.TunnelCloseLimit) {
+				audit.finish(model.TunnelCloseLimit, model.TunnelDenyNone)
+			}
+			return
+		}
+	}
 
-	if tunnelInfo.Tunnel.MaxOutConnect > 0 {
+	// 检查出站连接数限制
+	if tunnel.MaxOutConnect > 0 {
 		outConnCount := waf.UDPConnections.GetPortConnsCountByType(port, waftunnelmodel.ConnTypeTarget)
-		if outConnCount >= tunnelInfo.Tunnel.MaxOutConnect {
+		if outConnCount >= tunnel.MaxOutConnect {
 			zlog.Warn(fmt.Sprintf("UDP出站连接数超过限制 [客户端IP:%s 客户端端口:%s 服务端口:%s 当前连接数:%d 最大限制:%d]",
-				clientIP, clientPort, serverPort, outConnCount, tunnelInfo.Tunnel.MaxOutConnect))
+				clientIP, clientPort, serverPort, outConnCount, tunnel.MaxOutConnect))
+			if udpDenyLogOnce(port, clientIP, model.TunnelCloseLimit) {
+				audit.finish(model.TunnelCloseLimit, model.TunnelDenyNone)
+			}
 			return
 		}
 	}
 
-	// 连接到目标服务器
-	targetAddr := tunnelInfo.Tunnel.RemoteIp + ":" + strconv.Itoa(tunnelInfo.Tunnel.RemotePort)
+	// 连接到目标服务器。会话建立时选一次目标，整个会话固定在这个目标上
+	targetAddr, releaseTarget := waf.pickTarget(tunnel, clientIP)
+	audit.targetAddr = targetAddr
 	raddr, err := net.ResolveUDPAddr("udp", targetAddr)
 	if err != nil {
 		zlog.Error(fmt.Sprintf("解析目标地址失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 目标地址:%s 错误:%s]",
 			clientIP, clientPort, serverPort, targetAddr, err.Error()))
+		releaseTarget()
+		audit.finish(model.TunnelCloseDial, model.TunnelDenyNone)
 		return
 	}
 
@@ -199,53 +311,94 @@ func (waf *WafTunnelEngine) handleUDPData(serverConn *net.UDPConn, clientAddr *n
 	if err != nil {
 		zlog.Error(fmt.Sprintf("连接目标服务器失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 目标地址:%s 错误:%s]",
 			clientIP, clientPort, serverPort, targetAddr, err.Error()))
+		releaseTarget()
+		audit.finish(model.TunnelCloseDial, model.TunnelDenyNone)
 		return
 	}
 
-	// 将目标连接添加到活动连接列表，标记为目标连接
-	waf.UDPConnections.AddConn(port, targetConn, waftunnelmodel.ConnTypeTarget)
-	defer func() {
-		targetConn.Close()
-		waf.UDPConnections.RemoveConn(port, targetConn)
-	}()
-
-	// 设置超时
-	if tunnelInfo.Tunnel.ConnTimeout > 0 {
-		targetConn.SetDeadline(time.Now().Add(time.Duration(tunnelInfo.Tunnel.ConnTimeout) * time.Second))
+	sess := &udpSession{
+		clientAddr: clientAddr,
+		targetConn: targetConn,
+		audit:      audit,
+		release:    releaseTarget,
 	}
+	sess.lastActive.Store(time.Now().UnixNano())
+	sessionKey := clientAddr.String()
+	sessions.set(sessionKey, sess)
 
-	// 设置读取超时
-	if tunnelInfo.Tunnel.ReadTimeout > 0 {
-		targetConn.SetReadDeadline(time.Now().Add(time.Duration(tunnelInfo.Tunnel.ReadTimeout) * time.Second))
-	}
+	// 将目标连接添加到活动连接列表，标记为目标连接（一个会话一条）
+	waf.UDPConnections.AddConnInfo(port, targetConn, waftunnelmodel.ConnInfo{
+		ConnType:   waftunnelmodel.ConnTypeTarget,
+		Id:         audit.connId,
+		ClientAddr: sessionKey,
+		Counter:    audit.counter,
+	})
 
-	// 设置写入超时
-	if tunnelInfo.Tunnel.WriteTimeout > 0 {
-		targetConn.SetWriteDeadline(time.Now().Add(time.Duration(tunnelInfo.Tunnel.WriteTimeout) * time.Second))
-	}
+	go waf.runUDPSession(serverConn, sess, port, tunnel, sessions, sessionKey)
 
-	// 发送数据到目标
-	_, err = targetConn.Write(data)
-	if err != nil {
-		zlog.Error(fmt.Sprintf("发送数据到目标失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 错误:%s]",
-			clientIP, clientPort, serverPort, err.Error()))
-		return
-	}
+	// 发送首个报文到目标
+	sess.forward(data)
+}
 
-	// 接收目标响应
-	buffer := make([]byte, 4096)
-	n, _, err := targetConn.ReadFromUDP(buffer)
-	if err != nil {
-		zlog.Error(fmt.Sprintf("从目标接收数据失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 错误:%s]",
-			clientIP, clientPort, serverPort, err.Error()))
-		return
+// runUDPSession 会话读协程：目标->客户端，空闲超时后收尾
+func (waf *WafTunnelEngine) runUDPSession(serverConn *net.UDPConn, sess *udpSession, port int, tunnel model.Tunnel, sessions *udpSessionTable, sessionKey string) {
+	defer func() {
+		if e := recover(); e != nil {
+			zlog.Warn("udp session recover ", e)
+		}
+	}()
+	idle := udpIdleTimeout(tunnel)
+	buffer := make([]byte, 65535)
+	for {
+		deadline := time.Unix(0, sess.lastActive.Load()).Add(idle)
+		if tunnel.ConnTimeout > 0 {
+			// 连接超时是会话的绝对寿命，与 TCP 语义一致
+			if hard := sess.audit.start.Add(time.Duration(tunnel.ConnTimeout) * time.Second); hard.Before(deadline) {
+				deadline = hard
+			}
+		}
+		sess.targetConn.SetReadDeadline(deadline)
+		n, _, err := sess.targetConn.ReadFromUDP(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// 客户端这段时间还在发包就继续等
+				last := time.Unix(0, sess.lastActive.Load())
+				hardExpired := tunnel.ConnTimeout > 0 && time.Since(sess.audit.start) >= time.Duration(tunnel.ConnTimeout)*time.Second
+				if !hardExpired && time.Since(last) < idle {
+					continue
+				}
+				sess.audit.setReason(model.TunnelCloseTimeout)
+			} else {
+				sess.audit.setReason(model.TunnelCloseTarget)
+			}
+			break
+		}
+		sess.lastActive.Store(time.Now().UnixNano())
+		if tunnel.WriteTimeout > 0 {
+			serverConn.SetWriteDeadline(time.Now().Add(time.Duration(tunnel.WriteTimeout) * time.Second))
+		}
+		written, err := serverConn.WriteToUDP(buffer[:n], sess.clientAddr)
+		if written > 0 {
+			sess.audit.counter.Out.Add(int64(written))
+		}
+		if err != nil {
+			zlog.Error(fmt.Sprintf("发送响应到客户端失败 [客户端地址:%s 服务端口:%d 错误:%s]",
+				sessionKey, port, err.Error()))
+			sess.audit.setReason(model.TunnelCloseClient)
+			break
+		}
 	}
 
-	// 发送响应回客户端
-	_, err = serverConn.WriteToUDP(buffer[:n], clientAddr)
-	if err != nil {
-		zlog.Error(fmt.Sprintf("发送响应到客户端失败 [客户端IP:%s 客户端端口:%s 服务端口:%s 错误:%s]",
-			clientIP, clientPort, serverPort, err.Error()))
-		return
+	sessions.remove(sessionKey, sess)
+	sess.targetConn.Close()
+	sess.release()
+	if reason, exists := waf.UDPConnections.CloseReasonOf(port, sess.targetConn); !exists {
+		sess.audit.forceReason(model.TunnelCloseStop)
+	} else if reason != "" {
+		sess.audit.forceReason(reason)
 	}
+	waf.UDPConnections.RemoveConn(port, sess.targetConn)
+	sess.audit.finish("", model.TunnelDenyNone)
+	zlog.Debug(fmt.Sprintf("UDP会话结束 [客户端地址:%s 服务端口:%d]", sessionKey, port))
 }
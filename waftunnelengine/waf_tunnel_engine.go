@@ -8,6 +8,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type WafTunnelEngine struct {
@@ -19,6 +20,10 @@ type WafTunnelEngine struct {
 	TCPConnections *waftunnelmodel.SafeTCPConnMap
 	//UDP连接管理
 	UDPConnections *waftunnelmodel.SafeUDPConnMap
+
+	balancers  sync.Map // 多目标负载（key：隧道唯一码，value：*tunnelBalancer）
+	healthMu   sync.Mutex
+	healthStop chan struct{}
 }
 
 func NewWafTunnelEngine() *WafTunnelEngine {
@@ -35,15 +40,18 @@ func (waf *WafTunnelEngine) StartTunnel() {
 	// 启动tunnel
 	waf.LoadAllTunnel()
 	waf.StartAllTunnelServer()
+	waf.startHealthCheck()
 }
 
 // CloseTunnel 关闭tunnel
 func (waf *WafTunnelEngine) CloseTunnel() {
 	// 关闭tunnel
 	zlog.Info("开始关闭所有隧道服务...")
+	waf.stopHealthCheck()
 	waf.StopAllTunnelServer()
 	// 清理隧道目标信息
 	waf.TunnelTarget.Clear()
+	waf.balancers.Clear()
 
 	// 清理服务在线情况
 	waf.NetListerOnline.Clear()
@@ -64,6 +72,7 @@ func (waf *WafTunnelEngine) LoadAllTunnel() {
 func (waf *WafTunnelEngine) LoadTunnel(inTunnel model.Tunnel) []waftunnelmodel.NetRunTime {
 
 	netRunTimes := make([]waftunnelmodel.NetRunTime, 0)
+	waf.reloadBalancer(inTunnel)
 
 	// 先处理端口
 	portStr := inTunnel.Port
@@ -106,6 +115,8 @@ func (waf *WafTunnelEngine) LoadTunnel(inTunnel model.Tunnel) []waftunnelmodel.N
 func (waf *WafTunnelEngine) EditTunnel(oldTunnel model.Tunnel, newTunnel model.Tunnel) []waftunnelmodel.NetRunTime {
 	// 返回值：新增的端口运行时, 移除的端口运行时
 	addedRunTimes := make([]waftunnelmodel.NetRunTime, 0)
+	// 负载目标的增删改也走这里（新旧隧道相同），已建立的连接不受影响，新连接按新目标分配
+	waf.reloadBalancer(newTunnel)
 
 	// 解析旧端口列表
 	oldPortMap := make(map[string]bool)
@@ -173,10 +184,15 @@ func (waf *WafTunnelEngine) EditTunnel(oldTunnel model.Tunnel, newTunnel model.T
 
 			// 如果需要重启服务
 			if needRestart {
+				// RemoveTunnel 会删掉负载器，先留一份，重新加载时沿用各目标的健康状态
+				balancer, hasBalancer := waf.balancers.Load(newTunnel.Code)
 				// 先移除旧的服务
 				waf.RemoveTunnel(oldTunnel)
 				// 如果新状态是启动的，重新加载
 				if newTunnel.StartStatus != 0 {
+					if hasBalancer {
+						waf.balancers.Store(newTunnel.Code, balancer)
+					}
 					netRunTimes := waf.LoadTunnel(newTunnel)
 					addedRunTimes = append(addedRunTimes, netRunTimes...)
 				}
@@ -321,6 +337,8 @@ func (waf *WafTunnelEngine) RemoveTunnel(inTunnel model.Tunnel) []waftunnelmodel
 		}
 	}
 
+	waf.balancers.Delete(inTunnel.Code)
+
 	return removedRunTimes
 }
 